@@ -10,6 +10,7 @@ import (
 	crand "crypto/rand" // for seeding
 	"encoding/base32"
 	"encoding/binary"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
 	"io"
@@ -30,23 +31,25 @@ import (
 // AddrManager provides a concurrency safe address manager for caching potential
 // peers on the bitcoin network.
 type AddrManager struct {
-	mtx            sync.RWMutex
-	peersFile      string
-	lookupFunc     func(string) ([]net.IP, error)
-	rand           *rand.Rand
-	key            [32]byte
-	addrIndex      map[string]*KnownAddress // address key to ka for all addrs.
-	addrNew        [newBucketCount]map[string]*KnownAddress
-	addrTried      [triedBucketCount]*list.List
-	started        int32
-	shutdown       int32
-	wg             sync.WaitGroup
-	quit           chan struct{}
-	nTried         int
-	nNew           int
-	lamtx          sync.Mutex
-	localAddresses map[string]*localAddress
-	version        int
+	mtx             sync.RWMutex
+	peersFile       string
+	lookupFunc      func(string) ([]net.IP, error)
+	rand            *rand.Rand
+	key             [32]byte
+	addrIndex       map[string]*KnownAddress // address key to ka for all addrs.
+	addrNew         [newBucketCount]map[string]*KnownAddress
+	addrTried       [triedBucketCount]*list.List
+	triedCollisions map[string]*KnownAddress // new addrs to test before evicting.
+	asmap           *ASMap
+	started         int32
+	shutdown        int32
+	wg              sync.WaitGroup
+	quit            chan struct{}
+	nTried          int
+	nNew            int
+	lamtx           sync.Mutex
+	localAddresses  map[string]*localAddress
+	version         int
 }
 
 type serializedKnownAddress struct {
@@ -67,6 +70,7 @@ type serializedAddrManager struct {
 	Addresses    []*serializedKnownAddress
 	NewBuckets   [newBucketCount][]string // string is NetAddressKey
 	TriedBuckets [triedBucketCount][]string
+	ASMapHash    string // empty when no asmap is used.
 }
 
 type localAddress struct {
@@ -148,6 +152,18 @@ const (
 	// will consider evicting an address.
 	minBadDays = 7
 
+	// maxTriedCollisions is the maximum number of new addresses which are
+	// kept waiting for a test of the tried address they would evict.
+	maxTriedCollisions = 10
+
+	// triedReplaceHorizon is the duration since the last success of a tried
+	// address during which it is not evicted by a colliding new address.
+	triedReplaceHorizon = 4 * time.Hour
+
+	// triedTestWindow is the duration after which a colliding new address
+	// evicts the tried address when it could not be tested.
+	triedTestWindow = 40 * time.Minute
+
 	// getAddrMax is the most addresses that we will send in response
 	// to a getAddr (in practise the most addresses we will return from a
 	// call to AddressCache()).
@@ -300,8 +316,8 @@ func (a *AddrManager) getNewBucket(netAddr, srcAddr *wire.NetAddress) int {
 
 	data1 := []byte{}
 	data1 = append(data1, a.key[:]...)
-	data1 = append(data1, []byte(GroupKey(netAddr))...)
-	data1 = append(data1, []byte(GroupKey(srcAddr))...)
+	data1 = append(data1, []byte(a.GroupKey(netAddr))...)
+	data1 = append(data1, []byte(a.GroupKey(srcAddr))...)
 	hash1 := chainhash.DoubleHashB(data1)
 	hash64 := binary.LittleEndian.Uint64(hash1)
 	hash64 %= newBucketsPerGroup
@@ -309,7 +325,7 @@ func (a *AddrManager) getNewBucket(netAddr, srcAddr *wire.NetAddress) int {
 	binary.LittleEndian.PutUint64(hashbuf[:], hash64)
 	data2 := []byte{}
 	data2 = append(data2, a.key[:]...)
-	data2 = append(data2, GroupKey(srcAddr)...)
+	data2 = append(data2, a.GroupKey(srcAddr)...)
 	data2 = append(data2, hashbuf[:]...)
 
 	hash2 := chainhash.DoubleHashB(data2)
@@ -329,7 +345,7 @@ func (a *AddrManager) getTriedBucket(netAddr *wire.NetAddress) int {
 	binary.LittleEndian.PutUint64(hashbuf[:], hash64)
 	data2 := []byte{}
 	data2 = append(data2, a.key[:]...)
-	data2 = append(data2, GroupKey(netAddr)...)
+	data2 = append(data2, a.GroupKey(netAddr)...)
 	data2 = append(data2, hashbuf[:]...)
 
 	hash2 := chainhash.DoubleHashB(data2)
@@ -367,6 +383,7 @@ func (a *AddrManager) savePeers() {
 	sam := new(serializedAddrManager)
 	sam.Version = a.version
 	copy(sam.Key[:], a.key[:])
+	sam.ASMapHash = a.asmapHash()
 
 	sam.Addresses = make([]*serializedKnownAddress, len(a.addrIndex))
 	i := 0
@@ -501,6 +518,14 @@ func (a *AddrManager) deserializePeers(filePath string) error {
 		a.addrIndex[NetAddressKey(ka.na)] = ka
 	}
 
+	// The buckets of the addresses depend on the asmap, so they are
+	// recomputed when the asmap changed since the addresses were saved.
+	if sam.ASMapHash != a.asmapHash() {
+		log.Infof("Asmap changed since the addresses were saved -- "+
+			"rebucketing %d addresses", len(a.addrIndex))
+		return a.rebucketPeers(&sam)
+	}
+
 	for i := range sam.NewBuckets {
 		for _, val := range sam.NewBuckets[i] {
 			ka, ok := a.addrIndex[val]
@@ -562,6 +587,46 @@ func (a *AddrManager) DeserializeNetAddress(addr string,
 	return a.HostToNetAddress(host, uint16(port), services)
 }
 
+// rebucketPeers adds the addresses of the passed serialized address manager to
+// the buckets they belong to with the current asmap, instead of the buckets
+// they were saved in.  Tried addresses are kept tried when there is room for
+// them and are added as new addresses otherwise.  The addresses must already
+// be in the address index.
+func (a *AddrManager) rebucketPeers(sam *serializedAddrManager) error {
+	for i := range sam.TriedBuckets {
+		for _, val := range sam.TriedBuckets[i] {
+			ka, ok := a.addrIndex[val]
+			if !ok {
+				return fmt.Errorf("tried bucket contains %s but "+
+					"none in address list", val)
+			}
+
+			bucket := a.getTriedBucket(ka.na)
+			if a.addrTried[bucket].Len() >= triedBucketSize {
+				continue
+			}
+			ka.tried = true
+			a.nTried++
+			a.addrTried[bucket].PushBack(ka)
+		}
+	}
+
+	for k, ka := range a.addrIndex {
+		if ka.tried {
+			continue
+		}
+		bucket := a.getNewBucket(ka.na, ka.srcAddr)
+		if len(a.addrNew[bucket]) >= newBucketSize {
+			delete(a.addrIndex, k)
+			continue
+		}
+		ka.refs = 1
+		a.nNew++
+		a.addrNew[bucket][k] = ka
+	}
+	return nil
+}
+
 // Start begins the core address handler which manages a pool of known
 // addresses, timeouts, and interval based writes.
 func (a *AddrManager) Start() {
@@ -715,6 +780,7 @@ func (a *AddrManager) reset() {
 	for i := range a.addrTried {
 		a.addrTried[i] = list.New()
 	}
+	a.triedCollisions = make(map[string]*KnownAddress)
 }
 
 // HostToNetAddress returns a netaddress given a host address.  If the address
@@ -778,12 +844,21 @@ func (a *AddrManager) GetAddress() *KnownAddress {
 	a.mtx.Lock()
 	defer a.mtx.Unlock()
 
-	if a.numAddresses() == 0 {
+	return a.getAddress(false)
+}
+
+// getAddress returns a random address from the tried or new tables, or only
+// from the new table when newOnly is set.
+//
+// This function MUST be called with the address manager lock held (for
+// writes).
+func (a *AddrManager) getAddress(newOnly bool) *KnownAddress {
+	if a.numAddresses() == 0 || (newOnly && a.nNew == 0) {
 		return nil
 	}
 
 	// Use a 50% chance for choosing between tried and new table entries.
-	if a.nTried > 0 && (a.nNew == 0 || a.rand.Intn(2) == 0) {
+	if !newOnly && a.nTried > 0 && (a.nNew == 0 || a.rand.Intn(2) == 0) {
 		// Tried entry.
 		large := 1 << 30
 		factor := 1.0
@@ -840,6 +915,26 @@ func (a *AddrManager) GetAddress() *KnownAddress {
 	}
 }
 
+// GetFeelerAddress returns an address to test with a short-lived feeler
+// connection, or nil if there is none.  Pending collisions in the tried table
+// are resolved first, and the tried address a remaining collision would evict
+// is returned so it can be tested before being evicted.  Otherwise, a random
+// address from the new table is returned so it can be moved to the tried table
+// once it is known to be good.
+func (a *AddrManager) GetFeelerAddress() *KnownAddress {
+	a.mtx.Lock()
+	defer a.mtx.Unlock()
+
+	a.resolveTriedCollisions()
+	for key, ka := range a.triedCollisions {
+		if old := a.pickTried(a.getTriedBucket(ka.na)); old != nil {
+			return old.Value.(*KnownAddress)
+		}
+		delete(a.triedCollisions, key)
+	}
+	return a.getAddress(true)
+}
+
 func (a *AddrManager) find(addr *wire.NetAddress) *KnownAddress {
 	return a.addrIndex[NetAddressKey(addr)]
 }
@@ -908,11 +1003,34 @@ func (a *AddrManager) Good(addr *wire.NetAddress) {
 		return
 	}
 
-	// ok, need to move it to tried.
+	// The tried address which would be evicted is tested before it is
+	// replaced, so the new address is kept waiting when there is no room
+	// in its tried bucket.  The collision is resolved once the test
+	// succeeds or fails, or after the test window has passed.
+	addrKey := NetAddressKey(addr)
+	bucket := a.getTriedBucket(ka.na)
+	if a.addrTried[bucket].Len() >= triedBucketSize {
+		if len(a.triedCollisions) < maxTriedCollisions {
+			log.Tracef("Testing tried address before replacing it "+
+				"with %s", addrKey)
+			a.triedCollisions[addrKey] = ka
+		}
+		return
+	}
 
+	a.moveToTried(ka)
+}
+
+// moveToTried moves the passed address from the new table to the tried table,
+// evicting the oldest address in its tried bucket to the new table when there
+// is no room.
+//
+// This function MUST be called with the address manager lock held (for
+// writes).
+func (a *AddrManager) moveToTried(ka *KnownAddress) {
 	// remove from all new buckets.
 	// record one of the buckets in question and call it the `first'
-	addrKey := NetAddressKey(addr)
+	addrKey := NetAddressKey(ka.na)
 	oldBucket := -1
 	for i := range a.addrNew {
 		// we check for existence so we can record the first one
@@ -973,6 +1091,54 @@ func (a *AddrManager) Good(addr *wire.NetAddress) {
 	a.addrNew[newBucket][rmkey] = rmka
 }
 
+// resolveTriedCollisions resolves the collisions of new addresses with full
+// tried buckets.  The tried address which would be evicted is kept when it was
+// recently connected to, and evicted when a recent attempt to connect to it
+// failed or it could not be tested within the test window.
+//
+// This function MUST be called with the address manager lock held (for
+// writes).
+func (a *AddrManager) resolveTriedCollisions() {
+	now := time.Now()
+	for key, ka := range a.triedCollisions {
+		// The address was removed or moved to the tried table in the
+		// meantime.
+		if a.addrIndex[key] != ka || ka.tried {
+			delete(a.triedCollisions, key)
+			continue
+		}
+
+		bucket := a.getTriedBucket(ka.na)
+		if a.addrTried[bucket].Len() < triedBucketSize {
+			delete(a.triedCollisions, key)
+			a.moveToTried(ka)
+			continue
+		}
+
+		old := a.pickTried(bucket).Value.(*KnownAddress)
+		switch {
+		// Keep the tried address since it was recently connected to.
+		case now.Sub(old.lastsuccess) < triedReplaceHorizon:
+			log.Tracef("Keeping tried address %s over %s",
+				NetAddressKey(old.na), key)
+			delete(a.triedCollisions, key)
+
+		// Evict the tried address when the last attempt to connect to
+		// it failed.  The attempt is given a minute to succeed.
+		case now.Sub(old.lastattempt) < triedReplaceHorizon:
+			if now.Sub(old.lastattempt) > time.Minute {
+				delete(a.triedCollisions, key)
+				a.moveToTried(ka)
+			}
+
+		// Evict the tried address when it could not be tested in time.
+		case now.Sub(ka.lastsuccess) > triedTestWindow:
+			delete(a.triedCollisions, key)
+			a.moveToTried(ka)
+		}
+	}
+}
+
 // SetServices sets the services for the giiven address to the provided value.
 func (a *AddrManager) SetServices(addr *wire.NetAddress, services wire.ServiceFlag) {
 	a.mtx.Lock()
@@ -992,6 +1158,19 @@ func (a *AddrManager) SetServices(addr *wire.NetAddress, services wire.ServiceFl
 	}
 }
 
+// Services returns the services last known to be supported by the given
+// address, or 0 if the address is unknown to the address manager.
+func (a *AddrManager) Services(addr *wire.NetAddress) wire.ServiceFlag {
+	a.mtx.Lock()
+	defer a.mtx.Unlock()
+
+	ka := a.find(addr)
+	if ka == nil {
+		return 0
+	}
+	return ka.na.Services
+}
+
 // AddLocalAddress adds na to the list of known local addresses to advertise
 // with the given priority.
 func (a *AddrManager) AddLocalAddress(na *wire.NetAddress, priority AddressPriority) error {
@@ -1135,6 +1314,36 @@ func (a *AddrManager) GetBestLocalAddress(remoteAddr *wire.NetAddress) *wire.Net
 	return bestAddress
 }
 
+// SetASMap sets the asmap used to group addresses by the autonomous systems
+// which announce them.  It must be called before Start.
+func (a *AddrManager) SetASMap(asmap *ASMap) {
+	a.asmap = asmap
+}
+
+// asmapHash returns the hex encoded hash of the asmap in use, or an empty
+// string when no asmap is used.
+func (a *AddrManager) asmapHash() string {
+	if a.asmap == nil {
+		return ""
+	}
+	hash := a.asmap.Hash()
+	return hex.EncodeToString(hash[:])
+}
+
+// GroupKey returns a string representing the network group an address is part
+// of.  When an asmap is set and the address is announced by a known autonomous
+// system, it is the string "as" followed by the number of the autonomous
+// system.  Otherwise, it is the network group returned by the GroupKey
+// function.
+func (a *AddrManager) GroupKey(na *wire.NetAddress) string {
+	if a.asmap != nil {
+		if asn := a.asmap.ASN(na); asn != 0 {
+			return fmt.Sprintf("as%d", asn)
+		}
+	}
+	return GroupKey(na)
+}
+
 // New returns a new bitcoin address manager.
 // Use Start to begin processing asynchronous address updates.
 func New(dataDir string, lookupFunc func(string) ([]net.IP, error)) *AddrManager {
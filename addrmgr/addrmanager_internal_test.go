@@ -6,6 +6,7 @@ import (
 	"net"
 	"os"
 	"testing"
+	"time"
 
 	"github.com/btcsuite/btcd/wire"
 )
@@ -192,3 +193,74 @@ func TestAddrManagerV1ToV2(t *testing.T) {
 	addrMgr.loadPeers()
 	assertAddrs(t, addrMgr, expectedAddrs)
 }
+
+// TestTriedCollisions ensures a new address whose tried bucket is full only
+// evicts the oldest tried address of the bucket after testing it, and that the
+// tested address is kept when it was recently connected to.
+func TestTriedCollisions(t *testing.T) {
+	t.Parallel()
+
+	addrMgr := New("testtriedcollisions", nil)
+	srcAddr := wire.NewNetAddressIPPort(net.IPv4(173, 144, 173, 111), 8333, 0)
+	addr := wire.NewNetAddressIPPort(net.IPv4(173, 194, 115, 66), 8333, 0)
+	addrMgr.AddAddress(addr, srcAddr)
+	ka := addrMgr.find(addr)
+
+	// Fill the tried bucket of the address, the first address being the
+	// oldest one which is evicted.
+	now := time.Now()
+	bucket := addrMgr.getTriedBucket(addr)
+	for i := 0; i < triedBucketSize; i++ {
+		triedAddr := wire.NewNetAddressIPPort(
+			net.IPv4(10, 0, byte(i/256), byte(i)), 8333, 0)
+		triedAddr.Timestamp = now.Add(time.Duration(i) * time.Second)
+		triedKa := &KnownAddress{
+			na:          triedAddr,
+			srcAddr:     srcAddr,
+			lastsuccess: now.Add(-2 * triedReplaceHorizon),
+			tried:       true,
+		}
+		addrMgr.addrIndex[NetAddressKey(triedAddr)] = triedKa
+		addrMgr.addrTried[bucket].PushBack(triedKa)
+		addrMgr.nTried++
+	}
+	oldest := addrMgr.addrTried[bucket].Front().Value.(*KnownAddress)
+
+	// The new address waits for the oldest tried address to be tested,
+	// which is returned as the feeler address.
+	addrMgr.Good(addr)
+	if ka.tried || len(addrMgr.triedCollisions) != 1 {
+		t.Fatal("colliding address was moved to the tried table")
+	}
+	if feeler := addrMgr.GetFeelerAddress(); feeler != oldest {
+		t.Fatalf("feeler address %v, want %v", feeler.na, oldest.na)
+	}
+
+	// A connection to the tested address which was just attempted is
+	// given time to succeed.
+	oldest.lastattempt = now.Add(-30 * time.Second)
+	addrMgr.GetFeelerAddress()
+	if ka.tried || len(addrMgr.triedCollisions) != 1 {
+		t.Fatal("collision resolved before the test completed")
+	}
+
+	// The tested address is kept when the test succeeds.
+	addrMgr.Good(oldest.na)
+	addrMgr.GetFeelerAddress()
+	if ka.tried || !oldest.tried || len(addrMgr.triedCollisions) != 0 {
+		t.Fatal("tested address was evicted after a successful test")
+	}
+
+	// The tested address is evicted when the test fails.
+	oldest.lastsuccess = now.Add(-2 * triedReplaceHorizon)
+	addrMgr.Good(addr)
+	oldest.lastattempt = now.Add(-2 * time.Minute)
+	addrMgr.GetFeelerAddress()
+	if !ka.tried || oldest.tried || len(addrMgr.triedCollisions) != 0 {
+		t.Fatal("tested address was not evicted after a failed test")
+	}
+	if addrMgr.nTried != triedBucketSize || addrMgr.nNew != 1 {
+		t.Fatalf("unexpected table sizes: %d tried, %d new",
+			addrMgr.nTried, addrMgr.nNew)
+	}
+}
@@ -470,3 +470,26 @@ func TestNetAddressKey(t *testing.T) {
 	}
 
 }
+
+// TestServices ensures the services of known addresses are returned and kept
+// up to date, while unknown addresses have no services.
+func TestServices(t *testing.T) {
+	n := addrmgr.New("testservices", lookupFunc)
+	addr := wire.NewNetAddressIPPort(net.IPv4(173, 194, 115, 66), 8333,
+		wire.SFNodeNetwork|wire.SFNodeP2PV2)
+	if services := n.Services(addr); services != 0 {
+		t.Fatalf("unknown address has services %v", services)
+	}
+
+	srcAddr := wire.NewNetAddressIPPort(net.IPv4(173, 144, 173, 111), 8333, 0)
+	n.AddAddress(addr, srcAddr)
+	if services := n.Services(addr); services != addr.Services {
+		t.Fatalf("got services %v, want %v", services, addr.Services)
+	}
+
+	n.SetServices(addr, wire.SFNodeNetwork)
+	if services := n.Services(addr); services != wire.SFNodeNetwork {
+		t.Fatalf("got services %v, want %v", services,
+			wire.SFNodeNetwork)
+	}
+}
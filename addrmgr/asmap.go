@@ -0,0 +1,370 @@
+// Copyright (c) 2021 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package addrmgr
+
+import (
+	"crypto/sha256"
+	"errors"
+	"io/ioutil"
+	"net"
+
+	"github.com/btcsuite/btcd/wire"
+)
+
+// The asmap format is the one used by Bitcoin Core.  It is a compact binary
+// trie mapping IPv6 prefixes to autonomous system numbers, which is encoded
+// as a program of the following instructions.  The input of the program is
+// the 128 bit IPv6 address to look up, with IPv4 addresses mapped into IPv6
+// as ::ffff:a.b.c.d.
+//
+//   - RETURN asn: return asn
+//   - JUMP offset: consume an input bit and skip offset bits of the program
+//     when it is set
+//   - MATCH bits: consume input bits and return the default ASN unless they
+//     are equal to bits
+//   - DEFAULT asn: set the ASN returned by failed matches
+//
+// The instructions and their arguments are encoded with variable length
+// integers, and the program bits are stored in bytes starting with the least
+// significant bit.
+
+// asmapInvalid is the value returned when decoding an integer of an asmap
+// fails.  It is not a valid ASN.
+const asmapInvalid = 0xffffffff
+
+// Instructions of an asmap program.
+const (
+	asmapReturn uint32 = iota
+	asmapJump
+	asmapMatch
+	asmapDefault
+)
+
+// The sizes of the exponent classes of the variable length integers encoding
+// the instructions and their arguments.
+var (
+	asmapTypeBitSizes  = []uint8{0, 0, 1}
+	asmapASNBitSizes   = []uint8{15, 16, 17, 18, 19, 20, 21, 22, 23, 24}
+	asmapMatchBitSizes = []uint8{1, 2, 3, 4, 5, 6, 7, 8}
+	asmapJumpBitSizes  = []uint8{5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15, 16,
+		17, 18, 19, 20, 21, 22, 23, 24, 25, 26, 27, 28, 29, 30}
+)
+
+// ErrInvalidASMap describes an error where an asmap could not be used since it
+// is malformed.
+var ErrInvalidASMap = errors.New("invalid asmap")
+
+// ASMap maps IP addresses to the numbers of the autonomous systems which
+// announce them, so addresses can be grouped by the network operators which
+// control them rather than by their prefixes.
+type ASMap struct {
+	data    []byte
+	numBits int
+	hash    [sha256.Size]byte
+}
+
+// bit returns the bit at the passed position of the asmap program.
+func (m *ASMap) bit(pos int) bool {
+	return m.data[pos/8]>>(uint(pos)%8)&1 == 1
+}
+
+// decodeBits decodes a variable length integer of the asmap program at the
+// passed position with the passed minimum value and exponent class sizes.  It
+// returns the integer and the position after it, or asmapInvalid when the
+// integer straddles the end of the program.
+func (m *ASMap) decodeBits(pos int, minVal uint32, bitSizes []uint8) (uint32, int) {
+	val := minVal
+	for i, bitSize := range bitSizes {
+		// The last exponent class has no continuation bit.
+		var bit bool
+		if i != len(bitSizes)-1 {
+			if pos == m.numBits {
+				break
+			}
+			bit = m.bit(pos)
+			pos++
+		}
+		if bit {
+			val += 1 << bitSize
+			continue
+		}
+
+		for b := uint8(0); b < bitSize; b++ {
+			if pos == m.numBits {
+				return asmapInvalid, pos
+			}
+			if m.bit(pos) {
+				val += 1 << (bitSize - 1 - b)
+			}
+			pos++
+		}
+		return val, pos
+	}
+	return asmapInvalid, pos
+}
+
+// matchLen returns the number of input bits compared by a MATCH instruction
+// with the passed argument, which has a leading one bit before them.
+func matchLen(match uint32) int {
+	n := 0
+	for ; match > 1; match >>= 1 {
+		n++
+	}
+	return n
+}
+
+// ipBit returns the passed bit of the passed 16 byte IP address, starting with
+// the most significant bit.
+func ipBit(ip net.IP, bit int) bool {
+	return ip[bit/8]>>(7-uint(bit)%8)&1 == 1
+}
+
+// interpret runs the asmap program with the passed 16 byte IP address as
+// input and returns the resulting ASN.  The program must have passed the
+// sanity checks.
+func (m *ASMap) interpret(ip net.IP) uint32 {
+	const numIPBits = 8 * net.IPv6len
+	var defaultASN, val uint32
+	var opcode uint32
+	pos, bits := 0, numIPBits
+	for pos != m.numBits {
+		opcode, pos = m.decodeBits(pos, 0, asmapTypeBitSizes)
+		switch opcode {
+		case asmapReturn:
+			val, _ = m.decodeBits(pos, 1, asmapASNBitSizes)
+			if val == asmapInvalid {
+				return 0
+			}
+			return val
+
+		case asmapJump:
+			val, pos = m.decodeBits(pos, 17, asmapJumpBitSizes)
+			if val == asmapInvalid || bits == 0 ||
+				int64(val) >= int64(m.numBits-pos) {
+
+				return 0
+			}
+			if ipBit(ip, numIPBits-bits) {
+				pos += int(val)
+			}
+			bits--
+
+		case asmapMatch:
+			val, pos = m.decodeBits(pos, 2, asmapMatchBitSizes)
+			if val == asmapInvalid {
+				return 0
+			}
+			n := matchLen(val)
+			if bits < n {
+				return 0
+			}
+			for i := 0; i < n; i++ {
+				want := val>>uint(n-1-i)&1 == 1
+				if ipBit(ip, numIPBits-bits) != want {
+					return defaultASN
+				}
+				bits--
+			}
+
+		case asmapDefault:
+			val, pos = m.decodeBits(pos, 1, asmapASNBitSizes)
+			if val == asmapInvalid {
+				return 0
+			}
+			defaultASN = val
+
+		default:
+			return 0
+		}
+	}
+	return 0
+}
+
+// sanityCheck returns whether the asmap program is well formed, which ensures
+// it returns an ASN for all inputs with the passed number of bits without
+// reading past its end.
+func (m *ASMap) sanityCheck(bits int) bool {
+	// jump houses a position the program may jump to along with the number
+	// of input bits left after the jump.
+	type jump struct {
+		pos  int
+		bits int
+	}
+	var jumps []jump
+
+	var val uint32
+	var opcode uint32
+	prevOpcode := asmapJump
+	hadIncompleteMatch := false
+	pos := 0
+	for pos != m.numBits {
+		if len(jumps) > 0 && pos >= jumps[len(jumps)-1].pos {
+			// There was a jump into the middle of the previous
+			// instruction.
+			return false
+		}
+		opcode, pos = m.decodeBits(pos, 0, asmapTypeBitSizes)
+		switch opcode {
+		case asmapReturn:
+			// A RETURN right after a DEFAULT could be combined into
+			// just the RETURN.
+			if prevOpcode == asmapDefault {
+				return false
+			}
+			val, pos = m.decodeBits(pos, 1, asmapASNBitSizes)
+			if val == asmapInvalid {
+				return false
+			}
+
+			// Only zero padding up to the next byte may follow the
+			// last instruction.
+			if len(jumps) == 0 {
+				if m.numBits-pos > 7 {
+					return false
+				}
+				for ; pos != m.numBits; pos++ {
+					if m.bit(pos) {
+						return false
+					}
+				}
+				return true
+			}
+
+			// Continue as if the last jump was taken, which must
+			// lead to the next instruction, since the code would
+			// be unreachable otherwise.
+			last := jumps[len(jumps)-1]
+			if pos != last.pos {
+				return false
+			}
+			bits = last.bits
+			jumps = jumps[:len(jumps)-1]
+			prevOpcode = asmapJump
+
+		case asmapJump:
+			val, pos = m.decodeBits(pos, 17, asmapJumpBitSizes)
+			if val == asmapInvalid || int64(val) > int64(m.numBits-pos) ||
+				bits == 0 {
+
+				return false
+			}
+			bits--
+			jumpPos := pos + int(val)
+			if len(jumps) > 0 && jumpPos >= jumps[len(jumps)-1].pos {
+				// Intersecting jumps.
+				return false
+			}
+			jumps = append(jumps, jump{pos: jumpPos, bits: bits})
+			prevOpcode = asmapJump
+
+		case asmapMatch:
+			val, pos = m.decodeBits(pos, 2, asmapMatchBitSizes)
+			if val == asmapInvalid {
+				return false
+			}
+
+			// Within a sequence of matches at most one should
+			// compare less than 8 bits.
+			n := matchLen(val)
+			if prevOpcode != asmapMatch {
+				hadIncompleteMatch = false
+			}
+			if n < 8 && hadIncompleteMatch {
+				return false
+			}
+			hadIncompleteMatch = n < 8
+			if bits < n {
+				return false
+			}
+			bits -= n
+			prevOpcode = asmapMatch
+
+		case asmapDefault:
+			// Successive DEFAULTs could be combined into one.
+			if prevOpcode == asmapDefault {
+				return false
+			}
+			val, pos = m.decodeBits(pos, 1, asmapASNBitSizes)
+			if val == asmapInvalid {
+				return false
+			}
+			prevOpcode = asmapDefault
+
+		default:
+			return false
+		}
+	}
+
+	// The end was reached without a RETURN instruction.
+	return false
+}
+
+// DecodeASMap returns the asmap encoded by the passed bytes.  ErrInvalidASMap
+// is returned when the asmap is malformed.
+func DecodeASMap(data []byte) (*ASMap, error) {
+	m := &ASMap{
+		data:    data,
+		numBits: 8 * len(data),
+		hash:    sha256.Sum256(data),
+	}
+	if !m.sanityCheck(8 * net.IPv6len) {
+		return nil, ErrInvalidASMap
+	}
+	return m, nil
+}
+
+// LoadASMap reads and decodes the asmap file at the passed path.
+func LoadASMap(path string) (*ASMap, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return DecodeASMap(data)
+}
+
+// linkedIPv4 returns the IPv4 address embedded in the passed address when it
+// is an IPv4 address or an IPv6 address that tunnels or translates one, or nil
+// otherwise.
+func linkedIPv4(na *wire.NetAddress) net.IP {
+	switch {
+	case IsIPv4(na):
+		return na.IP.To4()
+
+	case IsRFC6145(na) || IsRFC6052(na):
+		return na.IP[12:16]
+
+	case IsRFC3964(na):
+		return na.IP[2:6]
+
+	case IsRFC4380(na):
+		// Teredo tunnels have the last 4 bytes as the v4 address XOR
+		// 0xff.
+		ip := net.IP(make([]byte, net.IPv4len))
+		for i, b := range na.IP[12:16] {
+			ip[i] = b ^ 0xff
+		}
+		return ip
+	}
+	return nil
+}
+
+// ASN returns the number of the autonomous system which announces the passed
+// address, or 0 when it is unknown.  Addresses which are not routable IP
+// addresses, such as Tor addresses, have no ASN.
+func (m *ASMap) ASN(na *wire.NetAddress) uint32 {
+	if !IsRoutable(na) || IsOnionCatTor(na) {
+		return 0
+	}
+	ip := na.IP.To16()
+	if ipv4 := linkedIPv4(na); ipv4 != nil {
+		ip = net.IPv4(ipv4[0], ipv4[1], ipv4[2], ipv4[3]).To16()
+	}
+	return m.interpret(ip)
+}
+
+// Hash returns the SHA256 hash of the encoded asmap, which identifies it.
+func (m *ASMap) Hash() [sha256.Size]byte {
+	return m.hash
+}
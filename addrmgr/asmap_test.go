@@ -0,0 +1,222 @@
+// Copyright (c) 2021 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package addrmgr
+
+import (
+	"io/ioutil"
+	"net"
+	"os"
+	"testing"
+
+	"github.com/btcsuite/btcd/wire"
+)
+
+// asmapBuilder builds asmap programs for the tests.
+type asmapBuilder struct {
+	bits []bool
+}
+
+// appendInt appends the variable length encoding of the passed integer with
+// the passed minimum value and exponent class sizes.
+func (b *asmapBuilder) appendInt(val, minVal uint32, bitSizes []uint8) {
+	val -= minVal
+	for i, bitSize := range bitSizes {
+		last := i == len(bitSizes)-1
+		if !last && val >= 1<<bitSize {
+			b.bits = append(b.bits, true)
+			val -= 1 << bitSize
+			continue
+		}
+		if !last {
+			b.bits = append(b.bits, false)
+		}
+		for j := int(bitSize) - 1; j >= 0; j-- {
+			b.bits = append(b.bits, val>>uint(j)&1 == 1)
+		}
+		return
+	}
+}
+
+func (b *asmapBuilder) ret(asn uint32) *asmapBuilder {
+	b.appendInt(asmapReturn, 0, asmapTypeBitSizes)
+	b.appendInt(asn, 1, asmapASNBitSizes)
+	return b
+}
+
+func (b *asmapBuilder) jump(offset int) *asmapBuilder {
+	b.appendInt(asmapJump, 0, asmapTypeBitSizes)
+	b.appendInt(uint32(offset), 17, asmapJumpBitSizes)
+	return b
+}
+
+// matchByte appends a MATCH instruction comparing the next 8 input bits with
+// the passed byte.
+func (b *asmapBuilder) matchByte(v byte) *asmapBuilder {
+	b.appendInt(asmapMatch, 0, asmapTypeBitSizes)
+	b.appendInt(0x100|uint32(v), 2, asmapMatchBitSizes)
+	return b
+}
+
+func (b *asmapBuilder) def(asn uint32) *asmapBuilder {
+	b.appendInt(asmapDefault, 0, asmapTypeBitSizes)
+	b.appendInt(asn, 1, asmapASNBitSizes)
+	return b
+}
+
+// bytes returns the program encoded with the least significant bit first.
+func (b *asmapBuilder) bytes() []byte {
+	data := make([]byte, (len(b.bits)+7)/8)
+	for i, bit := range b.bits {
+		if bit {
+			data[i/8] |= 1 << uint(i%8)
+		}
+	}
+	return data
+}
+
+// testASMap returns an asmap which maps the IPv4 addresses of 0.0.0.0/1 to AS
+// 100, the ones of 128.0.0.0/1 to AS 200 and all IPv6 addresses to AS 300.
+func testASMap() []byte {
+	b := new(asmapBuilder).def(300)
+	for i := 0; i < 10; i++ {
+		b.matchByte(0x00)
+	}
+	b.matchByte(0xff).matchByte(0xff)
+	return b.jump(len(new(asmapBuilder).ret(100).bits)).ret(100).ret(200).
+		bytes()
+}
+
+// TestASMap ensures asmaps are decoded and map addresses to the expected
+// autonomous systems, and that malformed asmaps are rejected.
+func TestASMap(t *testing.T) {
+	data := testASMap()
+	asmap, err := DecodeASMap(data)
+	if err != nil {
+		t.Fatalf("unable to decode asmap: %v", err)
+	}
+
+	tests := []struct {
+		ip   string
+		want uint32
+	}{
+		{"1.2.3.4", 100},
+		{"100.1.2.3", 100},
+		{"200.1.1.1", 200},
+		{"2a00:1450::1", 300},
+
+		// 6to4 address of 1.2.3.4.
+		{"2002:102:304::1", 100},
+
+		// Teredo address of 200.1.1.1.
+		{"2001:0:4136:e378:8000:63bf:37fe:fefe", 200},
+
+		// Addresses which are not routable or not IP addresses have no
+		// ASN.
+		{"10.0.0.1", 0},
+		{"127.0.0.1", 0},
+		{"fd87:d87e:eb43::1", 0},
+	}
+	for _, test := range tests {
+		na := wire.NewNetAddressIPPort(net.ParseIP(test.ip), 8333, 0)
+		if asn := asmap.ASN(na); asn != test.want {
+			t.Errorf("ASN(%s): got %d, want %d", test.ip, asn,
+				test.want)
+		}
+	}
+
+	malformed := [][]byte{
+		nil,
+		data[:len(data)-1],
+		append(append([]byte(nil), data...), 0),
+		new(asmapBuilder).def(1).ret(2).bytes(),
+	}
+	for i, data := range malformed {
+		if _, err := DecodeASMap(data); err != ErrInvalidASMap {
+			t.Errorf("malformed asmap #%d: got error %v, want %v", i,
+				err, ErrInvalidASMap)
+		}
+	}
+}
+
+// TestASMapGroupKey ensures addresses are grouped by autonomous system when an
+// asmap is set and are rebucketed when the asmap changes.
+func TestASMapGroupKey(t *testing.T) {
+	asmap, err := DecodeASMap(testASMap())
+	if err != nil {
+		t.Fatalf("unable to decode asmap: %v", err)
+	}
+
+	tempDir, err := ioutil.TempDir("", "addrmgr")
+	if err != nil {
+		t.Fatalf("unable to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	tests := []struct {
+		ip       string
+		group    string
+		asmapped string
+	}{
+		{"1.2.3.4", "1.2.0.0", "as100"},
+		{"100.1.2.3", "100.1.0.0", "as100"},
+		{"200.1.1.1", "200.1.0.0", "as200"},
+		{"10.0.0.1", "unroutable", "unroutable"},
+	}
+	addrMgr := New(tempDir, nil)
+	srcAddr := wire.NewNetAddressIPPort(net.ParseIP("173.194.115.66"),
+		8333, 0)
+	var addrs []*wire.NetAddress
+	for _, test := range tests {
+		na := wire.NewNetAddressIPPort(net.ParseIP(test.ip), 8333, 0)
+		if group := addrMgr.GroupKey(na); group != test.group {
+			t.Errorf("GroupKey(%s) without asmap: got %s, want %s",
+				test.ip, group, test.group)
+		}
+		addrMgr.AddAddress(na, srcAddr)
+		addrs = append(addrs, na)
+	}
+	addrMgr.Good(addrs[0])
+
+	// Addresses saved without an asmap are moved to the buckets they
+	// belong to with the asmap on load.
+	addrMgr.savePeers()
+	addrMgr = New(tempDir, nil)
+	addrMgr.SetASMap(asmap)
+	addrMgr.loadPeers()
+	for _, test := range tests {
+		na := wire.NewNetAddressIPPort(net.ParseIP(test.ip), 8333, 0)
+		if group := addrMgr.GroupKey(na); group != test.asmapped {
+			t.Errorf("GroupKey(%s) with asmap: got %s, want %s",
+				test.ip, group, test.asmapped)
+		}
+	}
+
+	// The unroutable address was never added.
+	if n := addrMgr.numAddresses(); n != len(addrs)-1 {
+		t.Fatalf("got %d addresses after rebucketing, want %d", n,
+			len(addrs)-1)
+	}
+	ka := addrMgr.find(addrs[0])
+	if ka == nil || !ka.tried {
+		t.Fatalf("tried address %v not tried after rebucketing",
+			addrs[0])
+	}
+	bucket := addrMgr.getTriedBucket(addrs[0])
+	found := false
+	for e := addrMgr.addrTried[bucket].Front(); e != nil; e = e.Next() {
+		found = found || e.Value.(*KnownAddress) == ka
+	}
+	if !found {
+		t.Fatalf("tried address %v not in its tried bucket %d",
+			addrs[0], bucket)
+	}
+	for _, na := range addrs[1:3] {
+		bucket := addrMgr.getNewBucket(na, srcAddr)
+		if _, ok := addrMgr.addrNew[bucket][NetAddressKey(na)]; !ok {
+			t.Fatalf("new address %v not in its new bucket %d", na,
+				bucket)
+		}
+	}
+}
@@ -28,6 +28,11 @@ generally helps provide greater peer diversity, and perhaps more importantly,
 drastically reduces the chances an attacker is able to coerce your peer into
 only connecting to nodes they control.
 
+By default, the groups are the IP prefixes of the addresses.  When an asmap is
+set, addresses are grouped by the autonomous systems which announce them
+instead, so a network operator which controls many prefixes can't dominate the
+selected addresses.
+
 The address manager also understands routability and Tor addresses and tries
 hard to only return routable addresses.  In addition, it uses the information
 provided by the caller about connected, known good, and attempted addresses to
@@ -0,0 +1,59 @@
+// Copyright (c) 2021 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+const (
+	// anchorsFilename is the name of the file in the data directory which
+	// holds the addresses of the anchor peers.
+	anchorsFilename = "anchors.json"
+
+	// maxAnchors is the maximum number of block relay only peers which are
+	// saved as anchors on shutdown and reconnected to on startup.
+	maxAnchors = 2
+)
+
+// loadAnchors returns the addresses of the anchor peers saved in the passed
+// data directory and removes the file, so the anchors are only used once even
+// when the node doesn't shut down cleanly.  A missing file yields no anchors.
+func loadAnchors(dataDir string) ([]string, error) {
+	filePath := filepath.Join(dataDir, anchorsFilename)
+	data, err := ioutil.ReadFile(filePath)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := os.Remove(filePath); err != nil {
+		return nil, err
+	}
+
+	var anchors []string
+	if err := json.Unmarshal(data, &anchors); err != nil {
+		return nil, err
+	}
+	if len(anchors) > maxAnchors {
+		anchors = anchors[:maxAnchors]
+	}
+	return anchors, nil
+}
+
+// saveAnchors saves the passed addresses of anchor peers to the passed data
+// directory.
+func saveAnchors(dataDir string, anchors []string) error {
+	data, err := json.Marshal(anchors)
+	if err != nil {
+		return err
+	}
+	filePath := filepath.Join(dataDir, anchorsFilename)
+	return ioutil.WriteFile(filePath, data, 0600)
+}
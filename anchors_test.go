@@ -0,0 +1,58 @@
+// Copyright (c) 2021 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// TestAnchors ensures saved anchors are loaded only once, the number of loaded
+// anchors is limited and corrupt files are rejected and removed.
+func TestAnchors(t *testing.T) {
+	dataDir, err := ioutil.TempDir("", "anchors")
+	if err != nil {
+		t.Fatalf("Failed creating a temporary directory: %v", err)
+	}
+	defer os.RemoveAll(dataDir)
+
+	anchors, err := loadAnchors(dataDir)
+	if err != nil || anchors != nil {
+		t.Fatalf("loaded anchors %v without a file: %v", anchors, err)
+	}
+
+	want := []string{"1.2.3.4:1331", "[2001:db8::1]:1331"}
+	saved := append(want, "5.6.7.8:1331")
+	if err := saveAnchors(dataDir, saved); err != nil {
+		t.Fatalf("unable to save anchors: %v", err)
+	}
+	anchors, err = loadAnchors(dataDir)
+	if err != nil {
+		t.Fatalf("unable to load anchors: %v", err)
+	}
+	if !reflect.DeepEqual(anchors, want) {
+		t.Fatalf("loaded anchors %v, want %v", anchors, want)
+	}
+
+	// The anchors are removed once loaded.
+	anchors, err = loadAnchors(dataDir)
+	if err != nil || anchors != nil {
+		t.Fatalf("loaded anchors %v twice: %v", anchors, err)
+	}
+
+	filePath := filepath.Join(dataDir, anchorsFilename)
+	if err := ioutil.WriteFile(filePath, []byte("{"), 0600); err != nil {
+		t.Fatalf("unable to write anchors file: %v", err)
+	}
+	if anchors, err := loadAnchors(dataDir); err == nil {
+		t.Fatalf("loaded anchors %v from corrupt file", anchors)
+	}
+	if _, err := os.Stat(filePath); !os.IsNotExist(err) {
+		t.Fatalf("corrupt anchors file was not removed: %v", err)
+	}
+}
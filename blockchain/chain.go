@@ -8,6 +8,7 @@ package blockchain
 import (
 	"container/list"
 	"fmt"
+	"math/big"
 	"sync"
 	"time"
 
@@ -1317,6 +1318,20 @@ func (b *BlockChain) BlockHeightByHash(hash *chainhash.Hash) (int32, error) {
 	return node.height, nil
 }
 
+// ChainWork returns the total amount of work in the chain up to and including
+// the block with the given hash.  The block does not have to be part of the
+// main chain.
+//
+// This function is safe for concurrent access.
+func (b *BlockChain) ChainWork(hash *chainhash.Hash) (*big.Int, error) {
+	node := b.index.LookupNode(hash)
+	if node == nil {
+		return nil, fmt.Errorf("block %s is not known", hash)
+	}
+
+	return new(big.Int).Set(node.workSum), nil
+}
+
 // BlockHashByHeight returns the hash of the block at the given height in the
 // main chain.
 //
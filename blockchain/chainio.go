@@ -8,6 +8,7 @@ import (
 	"bytes"
 	"encoding/binary"
 	"fmt"
+	"math"
 	"math/big"
 	"sync"
 	"time"
@@ -603,6 +604,23 @@ func outpointKey(outpoint wire.OutPoint) *[]byte {
 	return key
 }
 
+// decodeOutpointKey decodes the passed key of the utxo set, which must have
+// been created by the outpointKey function, into an outpoint.
+func decodeOutpointKey(key []byte) (wire.OutPoint, error) {
+	var outpoint wire.OutPoint
+	if len(key) <= chainhash.HashSize {
+		return outpoint, errDeserialize("unexpected end of data for " +
+			"outpoint key")
+	}
+	copy(outpoint.Hash[:], key[:chainhash.HashSize])
+	idx, bytesRead := deserializeVLQ(key[chainhash.HashSize:])
+	if bytesRead != len(key)-chainhash.HashSize || idx > math.MaxUint32 {
+		return outpoint, errDeserialize("invalid outpoint key index")
+	}
+	outpoint.Index = uint32(idx)
+	return outpoint, nil
+}
+
 // recycleOutpointKey puts the provided byte slice, which should have been
 // obtained via the outpointKey function, back on the free list.
 func recycleOutpointKey(key *[]byte) {
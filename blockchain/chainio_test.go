@@ -7,10 +7,12 @@ package blockchain
 import (
 	"bytes"
 	"errors"
+	"fmt"
 	"math/big"
 	"reflect"
 	"testing"
 
+	"github.com/btcsuite/btcd/chaincfg"
 	"github.com/btcsuite/btcd/database"
 	"github.com/btcsuite/btcd/wire"
 )
@@ -529,6 +531,82 @@ func TestUtxoSerialization(t *testing.T) {
 	}
 }
 
+// TestForEachUtxo ensures iterating the utxo set visits every unspent output
+// exactly once in key order across batch boundaries.
+func TestForEachUtxo(t *testing.T) {
+	chain, teardownFunc, err := chainSetup("foreachutxo",
+		&chaincfg.RegressionNetParams)
+	if err != nil {
+		t.Fatalf("Failed to setup chain instance: %v", err)
+	}
+	defer teardownFunc()
+
+	// Add enough outputs to the utxo set to span multiple batches, with
+	// several outputs of the same transaction at every hash.
+	numUtxos := utxoScanBatchSize*2 + 5
+	view := NewUtxoViewpoint()
+	for i := 0; i < numUtxos; i++ {
+		var outpoint wire.OutPoint
+		outpoint.Hash[0] = byte(i / 3 >> 8)
+		outpoint.Hash[1] = byte(i / 3)
+		outpoint.Index = uint32(i%3) * 200
+		view.entries[outpoint] = &UtxoEntry{
+			amount:      int64(i),
+			pkScript:    []byte{0x51},
+			blockHeight: int32(i),
+			packedFlags: tfModified,
+		}
+	}
+	err = chain.db.Update(func(dbTx database.Tx) error {
+		return dbPutUtxoView(dbTx, view)
+	})
+	if err != nil {
+		t.Fatalf("dbPutUtxoView: unexpected error: %v", err)
+	}
+
+	var visited int
+	var lastProgress float64
+	err = chain.ForEachUtxo(func(outpoint wire.OutPoint, entry *UtxoEntry) error {
+		want, ok := view.entries[outpoint]
+		if !ok {
+			return fmt.Errorf("unexpected outpoint %v", outpoint)
+		}
+		if entry.Amount() != want.Amount() ||
+			entry.BlockHeight() != want.BlockHeight() {
+
+			return fmt.Errorf("unexpected entry for %v", outpoint)
+		}
+		progress := UtxoSetProgress(outpoint)
+		if progress < lastProgress || progress >= 1 {
+			return fmt.Errorf("progress %v after %v", progress,
+				lastProgress)
+		}
+		lastProgress = progress
+		delete(view.entries, outpoint)
+		visited++
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("ForEachUtxo: unexpected error: %v", err)
+	}
+	if visited != numUtxos {
+		t.Fatalf("ForEachUtxo: visited %d outputs, want %d", visited,
+			numUtxos)
+	}
+
+	// Ensure the iteration stops with the error returned by the function.
+	errStop := errors.New("stop")
+	visited = 0
+	err = chain.ForEachUtxo(func(wire.OutPoint, *UtxoEntry) error {
+		visited++
+		return errStop
+	})
+	if err != errStop || visited != 1 {
+		t.Fatalf("ForEachUtxo: got %v after %d outputs, want %v after 1",
+			err, visited, errStop)
+	}
+}
+
 // TestUtxoEntryHeaderCodeErrors performs negative tests against unspent
 // transaction output header codes to ensure error paths work as expected.
 func TestUtxoEntryHeaderCodeErrors(t *testing.T) {
@@ -0,0 +1,836 @@
+// Copyright (c) 2021 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package indexers
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/btcsuite/btcd/blockchain"
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/database"
+	"github.com/btcsuite/btcd/txscript"
+	"github.com/btcsuite/btcd/wire"
+	"github.com/btcsuite/btcutil"
+)
+
+const (
+	// addrUtxoIndexName is the human-readable name for the index.
+	addrUtxoIndexName = "address utxo index"
+
+	// addrUtxoKeySize is the size of a key in the unspent outputs bucket.
+	// It consists of the address key + 32 bytes transaction hash + 4 bytes
+	// output index.
+	addrUtxoKeySize = addrKeySize + chainhash.HashSize + 4
+
+	// addrDeltaKeySize is the size of a key in the balance changes bucket.
+	// It consists of the address key + 4 bytes block height + 4 bytes
+	// transaction index within the block + 32 bytes transaction hash + 4
+	// bytes input or output index + 1 byte spending flag.
+	addrDeltaKeySize = addrKeySize + 4 + 4 + chainhash.HashSize + 4 + 1
+
+	// addrBalanceSize is the size of a value in the balances bucket.  It
+	// consists of 8 bytes balance + 8 bytes total received.
+	addrBalanceSize = 8 + 8
+)
+
+var (
+	// addrUtxoIndexKey is the key of the address utxo index and the parent
+	// db bucket used to house it.
+	addrUtxoIndexKey = []byte("addrutxoidx")
+
+	// addrUtxosBucketName is the name of the db bucket used to house the
+	// unspent outputs of each address.
+	addrUtxosBucketName = []byte("addrutxos")
+
+	// addrDeltasBucketName is the name of the db bucket used to house the
+	// balance changes of each address.
+	addrDeltasBucketName = []byte("addrdeltas")
+
+	// addrBalancesBucketName is the name of the db bucket used to house the
+	// current balance of each address.
+	addrBalancesBucketName = []byte("addrbalances")
+)
+
+// -----------------------------------------------------------------------------
+// The address utxo index tracks the unspent outputs, the current balance, and
+// every change to the balance of each address in the main chain.  It only
+// considers outputs which pay to a single address, so outputs such as bare
+// multisig are ignored since their value can't be attributed to one address.
+// Addresses are identified by the same address keys the address index uses.
+//
+// There are three buckets nested under the parent index bucket.
+//
+// The serialized format for keys and values in the unspent outputs bucket is:
+//
+//   <addr key><tx hash><output index> = <amount><height><pkscript>
+//
+//   Field           Type              Size
+//   addr key        [21]byte          21 bytes
+//   tx hash         chainhash.Hash    32 bytes
+//   output index    uint32 (BE)       4 bytes
+//   amount          int64             8 bytes
+//   height          uint32            4 bytes
+//   pkscript        []byte            variable
+//
+// The serialized format for keys and values in the balance changes bucket is:
+//
+//   <addr key><height><tx index><tx hash><index><spending> = <amount>
+//
+//   Field           Type              Size
+//   addr key        [21]byte          21 bytes
+//   height          uint32 (BE)       4 bytes
+//   tx index        uint32 (BE)       4 bytes
+//   tx hash         chainhash.Hash    32 bytes
+//   index           uint32 (BE)       4 bytes
+//   spending        bool              1 byte
+//   amount          int64             8 bytes
+//
+// The index is the output index for outputs that credit the address and the
+// input index for inputs that debit it.  The numeric key fields are big endian
+// so the changes for each address are ordered by their position in the chain,
+// which allows efficient height range queries.  The amount is negative for
+// inputs.
+//
+// The serialized format for keys and values in the balances bucket is:
+//
+//   <addr key> = <balance><received>
+//
+//   Field           Type              Size
+//   addr key        [21]byte          21 bytes
+//   balance         int64             8 bytes
+//   received        int64             8 bytes
+// -----------------------------------------------------------------------------
+
+// AddrBalance houses the balance of an address along with the total amount it
+// has ever received.
+type AddrBalance struct {
+	Balance  int64
+	Received int64
+}
+
+// AddrUtxo describes an unspent output that pays to an address.
+type AddrUtxo struct {
+	OutPoint wire.OutPoint
+	Amount   int64
+	PkScript []byte
+	Height   int32
+}
+
+// AddrDelta describes a change to the balance of an address caused by either
+// an output that pays to the address or an input that spends such an output.
+type AddrDelta struct {
+	// TxHash is the hash of the transaction that changes the balance.
+	TxHash chainhash.Hash
+
+	// Index is the index of the output that pays to the address when
+	// Spending is false and the index of the input that spends from the
+	// address otherwise.
+	Index    uint32
+	Spending bool
+
+	// Amount is the amount the balance changes by.  It is negative for
+	// inputs.
+	Amount int64
+
+	// Height and BlockIndex are the height of the block containing the
+	// transaction and the index of the transaction within it.  They are
+	// only set for confirmed transactions.
+	Height     int32
+	BlockIndex uint32
+
+	// PrevOut and Time are the output spent by an input and the time the
+	// transaction was added to the unconfirmed index.  They are only set
+	// for unconfirmed transactions.
+	PrevOut *wire.OutPoint
+	Time    time.Time
+}
+
+// addrUtxoKey returns the key in the unspent outputs bucket for the provided
+// address key and outpoint.
+func addrUtxoKey(addrKey [addrKeySize]byte, outPoint *wire.OutPoint) []byte {
+	key := make([]byte, addrUtxoKeySize)
+	copy(key, addrKey[:])
+	copy(key[addrKeySize:], outPoint.Hash[:])
+	binary.BigEndian.PutUint32(key[addrKeySize+chainhash.HashSize:], outPoint.Index)
+	return key
+}
+
+// serializeAddrUtxo serializes the provided unspent output details according
+// to the format described in detail above.
+func serializeAddrUtxo(amount int64, height int32, pkScript []byte) []byte {
+	serialized := make([]byte, 12+len(pkScript))
+	byteOrder.PutUint64(serialized, uint64(amount))
+	byteOrder.PutUint32(serialized[8:], uint32(height))
+	copy(serialized[12:], pkScript)
+	return serialized
+}
+
+// deserializeAddrUtxo decodes the passed serialized key and value from the
+// unspent outputs bucket according to the format described in detail above.
+func deserializeAddrUtxo(key, serialized []byte) (*AddrUtxo, error) {
+	if len(key) != addrUtxoKeySize || len(serialized) < 12 {
+		return nil, errDeserialize("unexpected end of data")
+	}
+
+	utxo := &AddrUtxo{
+		Amount:   int64(byteOrder.Uint64(serialized)),
+		Height:   int32(byteOrder.Uint32(serialized[8:])),
+		PkScript: make([]byte, len(serialized)-12),
+	}
+	copy(utxo.OutPoint.Hash[:], key[addrKeySize:])
+	utxo.OutPoint.Index = binary.BigEndian.Uint32(key[addrKeySize+chainhash.HashSize:])
+	copy(utxo.PkScript, serialized[12:])
+	return utxo, nil
+}
+
+// addrDeltaKey returns the key in the balance changes bucket for the provided
+// address key and balance change details.
+func addrDeltaKey(addrKey [addrKeySize]byte, height int32, blockIndex uint32,
+	txHash *chainhash.Hash, index uint32, spending bool) []byte {
+
+	key := make([]byte, addrDeltaKeySize)
+	copy(key, addrKey[:])
+	offset := addrKeySize
+	binary.BigEndian.PutUint32(key[offset:], uint32(height))
+	offset += 4
+	binary.BigEndian.PutUint32(key[offset:], blockIndex)
+	offset += 4
+	copy(key[offset:], txHash[:])
+	offset += chainhash.HashSize
+	binary.BigEndian.PutUint32(key[offset:], index)
+	offset += 4
+	if spending {
+		key[offset] = 1
+	}
+	return key
+}
+
+// deserializeAddrDelta decodes the passed serialized key and value from the
+// balance changes bucket according to the format described in detail above.
+func deserializeAddrDelta(key, serialized []byte) (*AddrDelta, error) {
+	if len(key) != addrDeltaKeySize || len(serialized) < 8 {
+		return nil, errDeserialize("unexpected end of data")
+	}
+
+	var delta AddrDelta
+	offset := addrKeySize
+	delta.Height = int32(binary.BigEndian.Uint32(key[offset:]))
+	offset += 4
+	delta.BlockIndex = binary.BigEndian.Uint32(key[offset:])
+	offset += 4
+	copy(delta.TxHash[:], key[offset:])
+	offset += chainhash.HashSize
+	delta.Index = binary.BigEndian.Uint32(key[offset:])
+	offset += 4
+	delta.Spending = key[offset] != 0
+	delta.Amount = int64(byteOrder.Uint64(serialized))
+	return &delta, nil
+}
+
+// serializeAddrBalance serializes the provided balance according to the format
+// described in detail above.
+func serializeAddrBalance(balance *AddrBalance) []byte {
+	serialized := make([]byte, addrBalanceSize)
+	byteOrder.PutUint64(serialized, uint64(balance.Balance))
+	byteOrder.PutUint64(serialized[8:], uint64(balance.Received))
+	return serialized
+}
+
+// deserializeAddrBalance decodes the passed serialized balance according to
+// the format described in detail above.
+func deserializeAddrBalance(serialized []byte) (*AddrBalance, error) {
+	if len(serialized) < addrBalanceSize {
+		return nil, errDeserialize("unexpected end of data")
+	}
+
+	return &AddrBalance{
+		Balance:  int64(byteOrder.Uint64(serialized)),
+		Received: int64(byteOrder.Uint64(serialized[8:])),
+	}, nil
+}
+
+// corruptionErr wraps the passed deserialization error in a database
+// corruption error with additional context.  Other errors are returned as is.
+func corruptionErr(err error, context string, addrKey [addrKeySize]byte) error {
+	if isDeserializeErr(err) {
+		return database.Error{
+			ErrorCode: database.ErrCorruption,
+			Description: fmt.Sprintf("failed to deserialize %s for "+
+				"address key %x: %v", context, addrKey, err),
+		}
+	}
+	return err
+}
+
+// addrBalanceUpdates tracks the balance changes for all of the addresses
+// involved in a block so the balance of each address is only read from and
+// written to the database once.
+type addrBalanceUpdates struct {
+	bucket   database.Bucket
+	balances map[[addrKeySize]byte]*AddrBalance
+}
+
+// get returns the balance for the passed address key, loading it from the
+// database as needed.
+func (u *addrBalanceUpdates) get(addrKey [addrKeySize]byte) (*AddrBalance, error) {
+	if balance, ok := u.balances[addrKey]; ok {
+		return balance, nil
+	}
+
+	balance := new(AddrBalance)
+	if serialized := u.bucket.Get(addrKey[:]); serialized != nil {
+		var err error
+		balance, err = deserializeAddrBalance(serialized)
+		if err != nil {
+			return nil, corruptionErr(err, "balance", addrKey)
+		}
+	}
+	u.balances[addrKey] = balance
+	return balance, nil
+}
+
+// write stores all of the modified balances to the database.  The entries for
+// addresses which have never received anything are removed entirely.
+func (u *addrBalanceUpdates) write() error {
+	for addrKey, balance := range u.balances {
+		if balance.Received == 0 && balance.Balance == 0 {
+			if err := u.bucket.Delete(addrKey[:]); err != nil {
+				return err
+			}
+			continue
+		}
+		err := u.bucket.Put(addrKey[:], serializeAddrBalance(balance))
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// AddrUtxoIndex implements an index of the unspent outputs, balance, and
+// balance changes of every address.  It allows the balance of an address to be
+// queried without scanning every transaction that involves it.
+//
+// In addition, support is provided for a memory-only index of the balance
+// changes caused by unconfirmed transactions such as those which are kept in
+// the memory pool before inclusion in a block.
+type AddrUtxoIndex struct {
+	// The following fields are set when the instance is created and can't
+	// be changed afterwards, so there is no need to protect them with a
+	// separate mutex.
+	db          database.DB
+	chainParams *chaincfg.Params
+
+	// The following fields track the balance changes of transactions that
+	// have not been included into a block yet.  They are protected by the
+	// unconfirmedLock field.
+	//
+	// The deltasByAddr field maps each address to the balance changes
+	// caused by each unconfirmed transaction that involves it, while the
+	// addrsByTx field is the reverse and is used to efficiently remove the
+	// changes once a transaction leaves the memory pool.
+	unconfirmedLock sync.RWMutex
+	deltasByAddr    map[[addrKeySize]byte]map[chainhash.Hash][]AddrDelta
+	addrsByTx       map[chainhash.Hash]map[[addrKeySize]byte]struct{}
+}
+
+// Ensure the AddrUtxoIndex type implements the Indexer interface.
+var _ Indexer = (*AddrUtxoIndex)(nil)
+
+// Ensure the AddrUtxoIndex type implements the NeedsInputser interface.
+var _ NeedsInputser = (*AddrUtxoIndex)(nil)
+
+// NeedsInputs signals that the index requires the referenced inputs in order
+// to properly create the index.
+//
+// This implements the NeedsInputser interface.
+func (idx *AddrUtxoIndex) NeedsInputs() bool {
+	return true
+}
+
+// Init is only provided to satisfy the Indexer interface as there is nothing to
+// initialize for this index.
+//
+// This is part of the Indexer interface.
+func (idx *AddrUtxoIndex) Init() error {
+	// Nothing to do.
+	return nil
+}
+
+// Key returns the database key to use for the index as a byte slice.
+//
+// This is part of the Indexer interface.
+func (idx *AddrUtxoIndex) Key() []byte {
+	return addrUtxoIndexKey
+}
+
+// Name returns the human-readable name of the index.
+//
+// This is part of the Indexer interface.
+func (idx *AddrUtxoIndex) Name() string {
+	return addrUtxoIndexName
+}
+
+// Create is invoked when the indexer manager determines the index needs to be
+// created for the first time.  It creates the parent bucket for the index
+// along with the buckets for the unspent outputs, balance changes, and
+// balances.
+//
+// This is part of the Indexer interface.
+func (idx *AddrUtxoIndex) Create(dbTx database.Tx) error {
+	parent, err := dbTx.Metadata().CreateBucket(addrUtxoIndexKey)
+	if err != nil {
+		return err
+	}
+	for _, name := range [][]byte{addrUtxosBucketName,
+		addrDeltasBucketName, addrBalancesBucketName} {
+
+		if _, err := parent.CreateBucket(name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// addrKeyForScript returns the address key for the passed public key script
+// when it pays to a single address of a type supported by the index.
+func (idx *AddrUtxoIndex) addrKeyForScript(pkScript []byte) ([addrKeySize]byte, bool) {
+	class, addrs, _, err := txscript.ExtractPkScriptAddrs(pkScript,
+		idx.chainParams)
+	if err != nil || len(addrs) != 1 || class == txscript.MultiSigTy {
+		return [addrKeySize]byte{}, false
+	}
+	addrKey, err := addrToKey(addrs[0])
+	if err != nil {
+		return [addrKeySize]byte{}, false
+	}
+	return addrKey, true
+}
+
+// ConnectBlock is invoked by the index manager when a new block has been
+// connected to the main chain.  This indexer adds the outputs created by the
+// block to the unspent outputs of the addresses they pay, removes the outputs
+// the block spends, and records the resulting balance changes.
+//
+// This is part of the Indexer interface.
+func (idx *AddrUtxoIndex) ConnectBlock(dbTx database.Tx, block *btcutil.Block,
+	stxos []blockchain.SpentTxOut) error {
+
+	parent := dbTx.Metadata().Bucket(addrUtxoIndexKey)
+	utxos := parent.Bucket(addrUtxosBucketName)
+	deltas := parent.Bucket(addrDeltasBucketName)
+	balances := &addrBalanceUpdates{
+		bucket:   parent.Bucket(addrBalancesBucketName),
+		balances: make(map[[addrKeySize]byte]*AddrBalance),
+	}
+
+	height := block.Height()
+	stxoIndex := 0
+	for txIdx, tx := range block.Transactions() {
+		msgTx := tx.MsgTx()
+		blockIndex := uint32(txIdx)
+
+		// Coinbases do not reference any inputs.  Since the block is
+		// required to have already gone through full validation, it has
+		// already been proven on the first transaction in the block is
+		// a coinbase.
+		if txIdx != 0 {
+			for inIdx, txIn := range msgTx.TxIn {
+				stxo := &stxos[stxoIndex]
+				stxoIndex++
+
+				addrKey, ok := idx.addrKeyForScript(stxo.PkScript)
+				if !ok {
+					continue
+				}
+
+				key := addrUtxoKey(addrKey, &txIn.PreviousOutPoint)
+				if err := utxos.Delete(key); err != nil {
+					return err
+				}
+				key = addrDeltaKey(addrKey, height, blockIndex,
+					tx.Hash(), uint32(inIdx), true)
+				var amount [8]byte
+				byteOrder.PutUint64(amount[:], uint64(-stxo.Amount))
+				if err := deltas.Put(key, amount[:]); err != nil {
+					return err
+				}
+				balance, err := balances.get(addrKey)
+				if err != nil {
+					return err
+				}
+				balance.Balance -= stxo.Amount
+			}
+		}
+
+		for outIdx, txOut := range msgTx.TxOut {
+			addrKey, ok := idx.addrKeyForScript(txOut.PkScript)
+			if !ok {
+				continue
+			}
+
+			outPoint := wire.OutPoint{Hash: *tx.Hash(), Index: uint32(outIdx)}
+			key := addrUtxoKey(addrKey, &outPoint)
+			value := serializeAddrUtxo(txOut.Value, height, txOut.PkScript)
+			if err := utxos.Put(key, value); err != nil {
+				return err
+			}
+			key = addrDeltaKey(addrKey, height, blockIndex, tx.Hash(),
+				uint32(outIdx), false)
+			var amount [8]byte
+			byteOrder.PutUint64(amount[:], uint64(txOut.Value))
+			if err := deltas.Put(key, amount[:]); err != nil {
+				return err
+			}
+			balance, err := balances.get(addrKey)
+			if err != nil {
+				return err
+			}
+			balance.Balance += txOut.Value
+			balance.Received += txOut.Value
+		}
+	}
+
+	return balances.write()
+}
+
+// DisconnectBlock is invoked by the index manager when a block has been
+// disconnected from the main chain.  This indexer reverses everything done
+// when the block was connected, which includes restoring the outputs the block
+// spent to the unspent outputs of the addresses they pay.
+//
+// This is part of the Indexer interface.
+func (idx *AddrUtxoIndex) DisconnectBlock(dbTx database.Tx, block *btcutil.Block,
+	stxos []blockchain.SpentTxOut) error {
+
+	parent := dbTx.Metadata().Bucket(addrUtxoIndexKey)
+	utxos := parent.Bucket(addrUtxosBucketName)
+	deltas := parent.Bucket(addrDeltasBucketName)
+	balances := &addrBalanceUpdates{
+		bucket:   parent.Bucket(addrBalancesBucketName),
+		balances: make(map[[addrKeySize]byte]*AddrBalance),
+	}
+
+	// The transactions are undone in reverse order so outputs that are
+	// both created and spent in the block are restored before they are
+	// removed again, so the spent outputs are consumed from the end.
+	height := block.Height()
+	stxoIndex := len(stxos)
+	transactions := block.Transactions()
+	for txIdx := len(transactions) - 1; txIdx >= 0; txIdx-- {
+		tx := transactions[txIdx]
+		msgTx := tx.MsgTx()
+		blockIndex := uint32(txIdx)
+
+		if txIdx != 0 {
+			stxoIndex -= len(msgTx.TxIn)
+			for inIdx, txIn := range msgTx.TxIn {
+				stxo := &stxos[stxoIndex+inIdx]
+				addrKey, ok := idx.addrKeyForScript(stxo.PkScript)
+				if !ok {
+					continue
+				}
+
+				key := addrUtxoKey(addrKey, &txIn.PreviousOutPoint)
+				value := serializeAddrUtxo(stxo.Amount, stxo.Height,
+					stxo.PkScript)
+				if err := utxos.Put(key, value); err != nil {
+					return err
+				}
+				key = addrDeltaKey(addrKey, height, blockIndex,
+					tx.Hash(), uint32(inIdx), true)
+				if err := deltas.Delete(key); err != nil {
+					return err
+				}
+				balance, err := balances.get(addrKey)
+				if err != nil {
+					return err
+				}
+				balance.Balance += stxo.Amount
+			}
+		}
+
+		for outIdx, txOut := range msgTx.TxOut {
+			addrKey, ok := idx.addrKeyForScript(txOut.PkScript)
+			if !ok {
+				continue
+			}
+
+			outPoint := wire.OutPoint{Hash: *tx.Hash(), Index: uint32(outIdx)}
+			if err := utxos.Delete(addrUtxoKey(addrKey, &outPoint)); err != nil {
+				return err
+			}
+			key := addrDeltaKey(addrKey, height, blockIndex, tx.Hash(),
+				uint32(outIdx), false)
+			if err := deltas.Delete(key); err != nil {
+				return err
+			}
+			balance, err := balances.get(addrKey)
+			if err != nil {
+				return err
+			}
+			balance.Balance -= txOut.Value
+			balance.Received -= txOut.Value
+		}
+	}
+
+	return balances.write()
+}
+
+// BalanceForAddress returns the confirmed balance of the passed address along
+// with the total amount it has received.
+//
+// NOTE: The results only include transactions confirmed in blocks.  See the
+// UnconfirmedDeltasForAddress method for obtaining the balance changes of
+// unconfirmed transactions.
+//
+// This function is safe for concurrent access.
+func (idx *AddrUtxoIndex) BalanceForAddress(addr btcutil.Address) (*AddrBalance, error) {
+	addrKey, err := addrToKey(addr)
+	if err != nil {
+		return nil, err
+	}
+
+	balance := new(AddrBalance)
+	err = idx.db.View(func(dbTx database.Tx) error {
+		bucket := dbTx.Metadata().Bucket(addrUtxoIndexKey).
+			Bucket(addrBalancesBucketName)
+		serialized := bucket.Get(addrKey[:])
+		if serialized == nil {
+			return nil
+		}
+
+		var err error
+		balance, err = deserializeAddrBalance(serialized)
+		return corruptionErr(err, "balance", addrKey)
+	})
+	return balance, err
+}
+
+// UtxosForAddress returns the confirmed unspent outputs that pay to the passed
+// address ordered by outpoint.
+//
+// This function is safe for concurrent access.
+func (idx *AddrUtxoIndex) UtxosForAddress(addr btcutil.Address) ([]*AddrUtxo, error) {
+	addrKey, err := addrToKey(addr)
+	if err != nil {
+		return nil, err
+	}
+
+	var utxos []*AddrUtxo
+	err = idx.db.View(func(dbTx database.Tx) error {
+		bucket := dbTx.Metadata().Bucket(addrUtxoIndexKey).
+			Bucket(addrUtxosBucketName)
+		cursor := bucket.Cursor()
+		for ok := cursor.Seek(addrKey[:]); ok &&
+			bytes.HasPrefix(cursor.Key(), addrKey[:]); ok = cursor.Next() {
+
+			utxo, err := deserializeAddrUtxo(cursor.Key(),
+				cursor.Value())
+			if err != nil {
+				return corruptionErr(err, "unspent output",
+					addrKey)
+			}
+			utxos = append(utxos, utxo)
+		}
+		return nil
+	})
+	return utxos, err
+}
+
+// DeltasForAddress returns the confirmed balance changes of the passed address
+// in blocks within the provided inclusive height range ordered by their
+// position in the chain.
+//
+// This function is safe for concurrent access.
+func (idx *AddrUtxoIndex) DeltasForAddress(addr btcutil.Address,
+	startHeight, endHeight int32) ([]*AddrDelta, error) {
+
+	addrKey, err := addrToKey(addr)
+	if err != nil {
+		return nil, err
+	}
+	if startHeight < 0 {
+		startHeight = 0
+	}
+
+	var deltas []*AddrDelta
+	err = idx.db.View(func(dbTx database.Tx) error {
+		bucket := dbTx.Metadata().Bucket(addrUtxoIndexKey).
+			Bucket(addrDeltasBucketName)
+		var seekKey [addrKeySize + 4]byte
+		copy(seekKey[:], addrKey[:])
+		binary.BigEndian.PutUint32(seekKey[addrKeySize:], uint32(startHeight))
+
+		cursor := bucket.Cursor()
+		for ok := cursor.Seek(seekKey[:]); ok &&
+			bytes.HasPrefix(cursor.Key(), addrKey[:]); ok = cursor.Next() {
+
+			delta, err := deserializeAddrDelta(cursor.Key(),
+				cursor.Value())
+			if err != nil {
+				return corruptionErr(err, "balance change",
+					addrKey)
+			}
+			if delta.Height > endHeight {
+				break
+			}
+			deltas = append(deltas, delta)
+		}
+		return nil
+	})
+	return deltas, err
+}
+
+// addUnconfirmedDelta adds the passed balance change for the address encoded
+// by the public key script to the unconfirmed (memory-only) index.
+//
+// This function MUST be called with the unconfirmed lock held (for writes).
+func (idx *AddrUtxoIndex) addUnconfirmedDelta(pkScript []byte, delta AddrDelta) {
+	addrKey, ok := idx.addrKeyForScript(pkScript)
+	if !ok {
+		return
+	}
+
+	txDeltas := idx.deltasByAddr[addrKey]
+	if txDeltas == nil {
+		txDeltas = make(map[chainhash.Hash][]AddrDelta)
+		idx.deltasByAddr[addrKey] = txDeltas
+	}
+	txDeltas[delta.TxHash] = append(txDeltas[delta.TxHash], delta)
+
+	addrs := idx.addrsByTx[delta.TxHash]
+	if addrs == nil {
+		addrs = make(map[[addrKeySize]byte]struct{})
+		idx.addrsByTx[delta.TxHash] = addrs
+	}
+	addrs[addrKey] = struct{}{}
+}
+
+// AddUnconfirmedTx adds the balance changes the transaction causes for all of
+// the addresses it involves to the unconfirmed (memory-only) index.
+//
+// NOTE: This transaction MUST have already been validated by the memory pool
+// before calling this function with it and have all of the inputs available in
+// the provided utxo view.  Failure to do so could result in some or all
+// balance changes not being indexed.
+//
+// This function is safe for concurrent access.
+func (idx *AddrUtxoIndex) AddUnconfirmedTx(tx *btcutil.Tx, utxoView *blockchain.UtxoViewpoint) {
+	now := time.Now()
+	txHash := *tx.Hash()
+
+	idx.unconfirmedLock.Lock()
+	defer idx.unconfirmedLock.Unlock()
+
+	for inIdx, txIn := range tx.MsgTx().TxIn {
+		entry := utxoView.LookupEntry(txIn.PreviousOutPoint)
+		if entry == nil {
+			// Ignore missing entries.  This should never happen
+			// in practice since the function comments specifically
+			// call out all inputs must be available.
+			continue
+		}
+		prevOut := txIn.PreviousOutPoint
+		idx.addUnconfirmedDelta(entry.PkScript(), AddrDelta{
+			TxHash:   txHash,
+			Index:    uint32(inIdx),
+			Spending: true,
+			Amount:   -entry.Amount(),
+			PrevOut:  &prevOut,
+			Time:     now,
+		})
+	}
+
+	for outIdx, txOut := range tx.MsgTx().TxOut {
+		idx.addUnconfirmedDelta(txOut.PkScript, AddrDelta{
+			TxHash: txHash,
+			Index:  uint32(outIdx),
+			Amount: txOut.Value,
+			Time:   now,
+		})
+	}
+}
+
+// RemoveUnconfirmedTx removes the passed transaction from the unconfirmed
+// (memory-only) index.
+//
+// This function is safe for concurrent access.
+func (idx *AddrUtxoIndex) RemoveUnconfirmedTx(hash *chainhash.Hash) {
+	idx.unconfirmedLock.Lock()
+	defer idx.unconfirmedLock.Unlock()
+
+	for addrKey := range idx.addrsByTx[*hash] {
+		delete(idx.deltasByAddr[addrKey], *hash)
+		if len(idx.deltasByAddr[addrKey]) == 0 {
+			delete(idx.deltasByAddr, addrKey)
+		}
+	}
+	delete(idx.addrsByTx, *hash)
+}
+
+// UnconfirmedDeltasForAddress returns the balance changes of the passed
+// address caused by the transactions currently in the unconfirmed
+// (memory-only) index ordered by the time they were added.  Unsupported
+// address types are ignored and will result in no results.
+//
+// This function is safe for concurrent access.
+func (idx *AddrUtxoIndex) UnconfirmedDeltasForAddress(addr btcutil.Address) []AddrDelta {
+	// Ignore unsupported address types.
+	addrKey, err := addrToKey(addr)
+	if err != nil {
+		return nil
+	}
+
+	idx.unconfirmedLock.RLock()
+	var deltas []AddrDelta
+	for _, txDeltas := range idx.deltasByAddr[addrKey] {
+		deltas = append(deltas, txDeltas...)
+	}
+	idx.unconfirmedLock.RUnlock()
+
+	sort.SliceStable(deltas, func(i, j int) bool {
+		if !deltas[i].Time.Equal(deltas[j].Time) {
+			return deltas[i].Time.Before(deltas[j].Time)
+		}
+		if deltas[i].TxHash != deltas[j].TxHash {
+			return bytes.Compare(deltas[i].TxHash[:],
+				deltas[j].TxHash[:]) < 0
+		}
+		if deltas[i].Spending != deltas[j].Spending {
+			return deltas[i].Spending
+		}
+		return deltas[i].Index < deltas[j].Index
+	})
+	return deltas
+}
+
+// NewAddrUtxoIndex returns a new instance of an indexer that is used to track
+// the unspent outputs, balances, and balance changes of all addresses in the
+// blockchain.
+//
+// It implements the Indexer interface which plugs into the IndexManager that in
+// turn is used by the blockchain package.  This allows the index to be
+// seamlessly maintained along with the chain.
+func NewAddrUtxoIndex(db database.DB, chainParams *chaincfg.Params) *AddrUtxoIndex {
+	return &AddrUtxoIndex{
+		db:           db,
+		chainParams:  chainParams,
+		deltasByAddr: make(map[[addrKeySize]byte]map[chainhash.Hash][]AddrDelta),
+		addrsByTx:    make(map[chainhash.Hash]map[[addrKeySize]byte]struct{}),
+	}
+}
+
+// DropAddrUtxoIndex drops the address utxo index from the provided database if
+// it exists.
+func DropAddrUtxoIndex(db database.DB, interrupt <-chan struct{}) error {
+	return dropIndex(db, addrUtxoIndexKey, addrUtxoIndexName, interrupt)
+}
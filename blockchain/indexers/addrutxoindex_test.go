@@ -0,0 +1,261 @@
+// Copyright (c) 2021 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package indexers
+
+import (
+	"io/ioutil"
+	"os"
+	"reflect"
+	"testing"
+
+	"github.com/btcsuite/btcd/blockchain"
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcd/database"
+	_ "github.com/btcsuite/btcd/database/ffldb"
+	"github.com/btcsuite/btcd/txscript"
+	"github.com/btcsuite/btcd/wire"
+	"github.com/btcsuite/btcutil"
+)
+
+// addrUtxoTestAddr returns a pay-to-pubkey-hash address for the test network
+// parameters along with its public key script.
+func addrUtxoTestAddr(t *testing.T, b byte) (btcutil.Address, []byte) {
+	t.Helper()
+
+	var hash160 [20]byte
+	hash160[0] = b
+	addr, err := btcutil.NewAddressPubKeyHash(hash160[:],
+		&chaincfg.MainNetParams)
+	if err != nil {
+		t.Fatalf("NewAddressPubKeyHash: unexpected error: %v", err)
+	}
+	pkScript, err := txscript.PayToAddrScript(addr)
+	if err != nil {
+		t.Fatalf("PayToAddrScript: unexpected error: %v", err)
+	}
+	return addr, pkScript
+}
+
+// TestAddrUtxoIndex ensures connecting and disconnecting blocks properly
+// maintains the unspent outputs, balances, and balance changes of addresses.
+func TestAddrUtxoIndex(t *testing.T) {
+	t.Parallel()
+
+	dbPath, err := ioutil.TempDir("", "addrutxoindex")
+	if err != nil {
+		t.Fatalf("TempDir: unexpected error: %v", err)
+	}
+	defer os.RemoveAll(dbPath)
+	db, err := database.Create("ffldb", dbPath, wire.MainNet)
+	if err != nil {
+		t.Fatalf("Create: unexpected error: %v", err)
+	}
+	defer db.Close()
+
+	idx := NewAddrUtxoIndex(db, &chaincfg.MainNetParams)
+	if err := db.Update(idx.Create); err != nil {
+		t.Fatalf("Create index: unexpected error: %v", err)
+	}
+
+	addrA, scriptA := addrUtxoTestAddr(t, 0xaa)
+	addrB, scriptB := addrUtxoTestAddr(t, 0xbb)
+	addrC, scriptC := addrUtxoTestAddr(t, 0xcc)
+
+	// Block 1 pays 50 to A and 10 to B in the coinbase.
+	coinbase1 := wire.NewMsgTx(wire.TxVersion)
+	coinbase1.AddTxIn(&wire.TxIn{PreviousOutPoint: wire.OutPoint{
+		Index: wire.MaxPrevOutIndex}})
+	coinbase1.AddTxOut(wire.NewTxOut(50, scriptA))
+	coinbase1.AddTxOut(wire.NewTxOut(10, scriptB))
+	block1 := btcutil.NewBlock(&wire.MsgBlock{
+		Transactions: []*wire.MsgTx{coinbase1},
+	})
+	block1.SetHeight(1)
+
+	// Block 2 pays 50 to B in the coinbase, spends the output to A while
+	// paying 30 to B and 19 back to A, and then spends that change to C.
+	coinbase2 := wire.NewMsgTx(wire.TxVersion)
+	coinbase2.AddTxIn(&wire.TxIn{
+		PreviousOutPoint: wire.OutPoint{Index: wire.MaxPrevOutIndex},
+		SignatureScript:  []byte{0x02},
+	})
+	coinbase2.AddTxOut(wire.NewTxOut(50, scriptB))
+	spend1 := wire.NewMsgTx(wire.TxVersion)
+	spend1.AddTxIn(wire.NewTxIn(&wire.OutPoint{Hash: coinbase1.TxHash()},
+		nil, nil))
+	spend1.AddTxOut(wire.NewTxOut(30, scriptB))
+	spend1.AddTxOut(wire.NewTxOut(19, scriptA))
+	spend2 := wire.NewMsgTx(wire.TxVersion)
+	spend2.AddTxIn(wire.NewTxIn(&wire.OutPoint{Hash: spend1.TxHash(),
+		Index: 1}, nil, nil))
+	spend2.AddTxOut(wire.NewTxOut(19, scriptC))
+	block2 := btcutil.NewBlock(&wire.MsgBlock{
+		Transactions: []*wire.MsgTx{coinbase2, spend1, spend2},
+	})
+	block2.SetHeight(2)
+	stxos2 := []blockchain.SpentTxOut{
+		{Amount: 50, PkScript: scriptA, Height: 1, IsCoinBase: true},
+		{Amount: 19, PkScript: scriptA, Height: 2},
+	}
+
+	connect := func(block *btcutil.Block, stxos []blockchain.SpentTxOut) {
+		t.Helper()
+		err := db.Update(func(dbTx database.Tx) error {
+			return idx.ConnectBlock(dbTx, block, stxos)
+		})
+		if err != nil {
+			t.Fatalf("ConnectBlock: unexpected error: %v", err)
+		}
+	}
+	disconnect := func(block *btcutil.Block, stxos []blockchain.SpentTxOut) {
+		t.Helper()
+		err := db.Update(func(dbTx database.Tx) error {
+			return idx.DisconnectBlock(dbTx, block, stxos)
+		})
+		if err != nil {
+			t.Fatalf("DisconnectBlock: unexpected error: %v", err)
+		}
+	}
+	checkBalance := func(addr btcutil.Address, want AddrBalance) {
+		t.Helper()
+		balance, err := idx.BalanceForAddress(addr)
+		if err != nil {
+			t.Fatalf("BalanceForAddress: unexpected error: %v", err)
+		}
+		if *balance != want {
+			t.Fatalf("BalanceForAddress(%v): got %+v, want %+v",
+				addr, *balance, want)
+		}
+	}
+	checkUtxos := func(addr btcutil.Address, want []wire.OutPoint) {
+		t.Helper()
+		utxos, err := idx.UtxosForAddress(addr)
+		if err != nil {
+			t.Fatalf("UtxosForAddress: unexpected error: %v", err)
+		}
+		got := make(map[wire.OutPoint]struct{})
+		for _, utxo := range utxos {
+			got[utxo.OutPoint] = struct{}{}
+		}
+		wantMap := make(map[wire.OutPoint]struct{})
+		for _, outPoint := range want {
+			wantMap[outPoint] = struct{}{}
+		}
+		if len(utxos) != len(want) || !reflect.DeepEqual(got, wantMap) {
+			t.Fatalf("UtxosForAddress(%v): got %v, want %v", addr,
+				got, wantMap)
+		}
+	}
+
+	connect(block1, nil)
+	checkBalance(addrA, AddrBalance{Balance: 50, Received: 50})
+	checkBalance(addrB, AddrBalance{Balance: 10, Received: 10})
+	checkUtxos(addrA, []wire.OutPoint{{Hash: coinbase1.TxHash()}})
+
+	connect(block2, stxos2)
+	checkBalance(addrA, AddrBalance{Balance: 0, Received: 69})
+	checkBalance(addrB, AddrBalance{Balance: 90, Received: 90})
+	checkBalance(addrC, AddrBalance{Balance: 19, Received: 19})
+	checkUtxos(addrA, nil)
+	checkUtxos(addrB, []wire.OutPoint{
+		{Hash: coinbase1.TxHash(), Index: 1},
+		{Hash: coinbase2.TxHash()},
+		{Hash: spend1.TxHash()},
+	})
+	checkUtxos(addrC, []wire.OutPoint{{Hash: spend2.TxHash()}})
+
+	// Ensure the balance changes of A in block 2 are returned in the order
+	// they appear in the block.
+	deltas, err := idx.DeltasForAddress(addrA, 2, 2)
+	if err != nil {
+		t.Fatalf("DeltasForAddress: unexpected error: %v", err)
+	}
+	wantDeltas := []AddrDelta{
+		{TxHash: spend1.TxHash(), Index: 0, Spending: true, Amount: -50,
+			Height: 2, BlockIndex: 1},
+		{TxHash: spend1.TxHash(), Index: 1, Amount: 19, Height: 2,
+			BlockIndex: 1},
+		{TxHash: spend2.TxHash(), Index: 0, Spending: true, Amount: -19,
+			Height: 2, BlockIndex: 2},
+	}
+	if len(deltas) != len(wantDeltas) {
+		t.Fatalf("DeltasForAddress: got %d deltas, want %d",
+			len(deltas), len(wantDeltas))
+	}
+	for i, delta := range deltas {
+		if !reflect.DeepEqual(*delta, wantDeltas[i]) {
+			t.Fatalf("DeltasForAddress #%d: got %+v, want %+v", i,
+				*delta, wantDeltas[i])
+		}
+	}
+	deltas, err = idx.DeltasForAddress(addrA, 0, 1)
+	if err != nil {
+		t.Fatalf("DeltasForAddress: unexpected error: %v", err)
+	}
+	if len(deltas) != 1 || deltas[0].Amount != 50 {
+		t.Fatalf("DeltasForAddress: unexpected deltas %+v", deltas)
+	}
+
+	// Ensure disconnecting block 2 restores the previous state.
+	disconnect(block2, stxos2)
+	checkBalance(addrA, AddrBalance{Balance: 50, Received: 50})
+	checkBalance(addrB, AddrBalance{Balance: 10, Received: 10})
+	checkBalance(addrC, AddrBalance{})
+	checkUtxos(addrA, []wire.OutPoint{{Hash: coinbase1.TxHash()}})
+	checkUtxos(addrC, nil)
+	deltas, err = idx.DeltasForAddress(addrA, 0, 100)
+	if err != nil {
+		t.Fatalf("DeltasForAddress: unexpected error: %v", err)
+	}
+	if len(deltas) != 1 {
+		t.Fatalf("DeltasForAddress: got %d deltas, want 1", len(deltas))
+	}
+}
+
+// TestAddrUtxoIndexUnconfirmed ensures the memory-only index of unconfirmed
+// balance changes is maintained properly.
+func TestAddrUtxoIndexUnconfirmed(t *testing.T) {
+	t.Parallel()
+
+	idx := NewAddrUtxoIndex(nil, &chaincfg.MainNetParams)
+	addrA, scriptA := addrUtxoTestAddr(t, 0xaa)
+	addrB, scriptB := addrUtxoTestAddr(t, 0xbb)
+
+	// Create a view with an output paying to A and a transaction that
+	// spends it to B.
+	prevTx := wire.NewMsgTx(wire.TxVersion)
+	prevTx.AddTxOut(wire.NewTxOut(100, scriptA))
+	view := blockchain.NewUtxoViewpoint()
+	view.AddTxOuts(btcutil.NewTx(prevTx), 1)
+	tx := wire.NewMsgTx(wire.TxVersion)
+	prevOut := wire.OutPoint{Hash: prevTx.TxHash()}
+	tx.AddTxIn(wire.NewTxIn(&prevOut, nil, nil))
+	tx.AddTxOut(wire.NewTxOut(90, scriptB))
+
+	idx.AddUnconfirmedTx(btcutil.NewTx(tx), view)
+	deltasA := idx.UnconfirmedDeltasForAddress(addrA)
+	if len(deltasA) != 1 || deltasA[0].Amount != -100 ||
+		!deltasA[0].Spending || *deltasA[0].PrevOut != prevOut {
+
+		t.Fatalf("UnconfirmedDeltasForAddress: unexpected deltas %+v",
+			deltasA)
+	}
+	deltasB := idx.UnconfirmedDeltasForAddress(addrB)
+	if len(deltasB) != 1 || deltasB[0].Amount != 90 ||
+		deltasB[0].Spending {
+
+		t.Fatalf("UnconfirmedDeltasForAddress: unexpected deltas %+v",
+			deltasB)
+	}
+
+	idx.RemoveUnconfirmedTx(&deltasB[0].TxHash)
+	if deltas := idx.UnconfirmedDeltasForAddress(addrA); len(deltas) != 0 {
+		t.Fatalf("UnconfirmedDeltasForAddress: unexpected deltas %+v",
+			deltas)
+	}
+	if len(idx.deltasByAddr) != 0 || len(idx.addrsByTx) != 0 {
+		t.Fatal("RemoveUnconfirmedTx: unconfirmed index not empty")
+	}
+}
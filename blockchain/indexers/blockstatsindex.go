@@ -0,0 +1,539 @@
+// Copyright (c) 2021 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package indexers
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"sort"
+
+	"github.com/btcsuite/btcd/blockchain"
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/database"
+	"github.com/btcsuite/btcd/wire"
+	"github.com/btcsuite/btcutil"
+)
+
+const (
+	// blockStatsIndexName is the human-readable name for the index.
+	blockStatsIndexName = "block stats index"
+
+	// NumFeeRatePercentiles is the number of fee rate percentiles kept for
+	// every block.  They are the 10th, 25th, 50th, 75th and 90th percentile
+	// of the fee rates weighted by transaction weight.
+	NumFeeRatePercentiles = 5
+
+	// numBlockStatsFields is the number of 8-byte integer fields that
+	// follow the block hash in a serialized block stats entry.
+	numBlockStatsFields = 26 + NumFeeRatePercentiles
+
+	// blockStatsEntrySize is the size of a value in the block stats index.
+	blockStatsEntrySize = chainhash.HashSize + numBlockStatsFields*8
+
+	// medianTimeBlocks is the number of previous blocks which are used to
+	// calculate the median time of a block.  It must match the value used
+	// by the consensus rules.
+	medianTimeBlocks = 11
+
+	// utxoOverhead is the approximate number of bytes, in addition to the
+	// serialized output, it costs to keep an output in the utxo set.  It
+	// consists of the 36 bytes outpoint + 4 bytes height + 1 byte coinbase
+	// flag and matches the value used by Groestlcoin Core.
+	utxoOverhead = 36 + 4 + 1
+)
+
+var (
+	// blockStatsIndexKey is the key of the block stats index and the db
+	// bucket used to house it.
+	blockStatsIndexKey = []byte("blockstatsbyheightidx")
+
+	// feeRatePercentiles are the percentiles of the total transaction
+	// weight at which the fee rate percentiles of a block are taken.
+	feeRatePercentiles = [NumFeeRatePercentiles]float64{
+		0.10, 0.25, 0.50, 0.75, 0.90,
+	}
+)
+
+// -----------------------------------------------------------------------------
+// The block stats index consists of an entry for every block in the main chain
+// which holds aggregate statistics about the block.  The entries are keyed by
+// block height so a range of heights can be read with a single cursor, and so
+// connecting a block at a height after a reorg simply replaces the previous
+// entry.  The block hash is stored in the entry to identify the block it
+// describes.
+//
+// The key is serialized in big endian so the entries are ordered by height.
+// All fields of the value are serialized in little endian.
+//
+// The serialized format for keys and values in the index is:
+//
+//   <height> = <block hash><stats field>...
+//
+//   Field          Type              Size
+//   height         uint32            4 bytes
+//   block hash     chainhash.Hash    32 bytes
+//   stats field    int64             8 bytes each, 31 fields
+//   -----
+//   Total: 4 byte key, 280 byte value
+//
+// The stats fields are serialized in the order returned by the fields method
+// of BlockStats.
+// -----------------------------------------------------------------------------
+
+// BlockStats houses aggregate statistics about a block.  All amounts are in
+// the smallest unit, fee rates are in the smallest unit per virtual byte, and
+// sizes are in bytes.  The statistics about fees, fee rates, and transaction
+// sizes exclude the coinbase transaction.
+type BlockStats struct {
+	Hash               chainhash.Hash
+	Height             int32
+	Time               int64
+	MedianTime         int64
+	Txs                int64
+	Ins                int64
+	Outs               int64
+	TotalOut           int64
+	TotalFee           int64
+	Subsidy            int64
+	TotalSize          int64
+	TotalWeight        int64
+	SegWitTxs          int64
+	SegWitTotalSize    int64
+	SegWitTotalWeight  int64
+	MinFee             int64
+	MaxFee             int64
+	AverageFee         int64
+	MedianFee          int64
+	MinFeeRate         int64
+	MaxFeeRate         int64
+	AverageFeeRate     int64
+	FeeRatePercentiles [NumFeeRatePercentiles]int64
+	MinTxSize          int64
+	MaxTxSize          int64
+	AverageTxSize      int64
+	MedianTxSize       int64
+	UTXOIncrease       int64
+	UTXOSizeIncrease   int64
+}
+
+// fields returns pointers to the fields of the stats which are serialized into
+// an index entry in the order they are serialized.
+func (s *BlockStats) fields() []*int64 {
+	fields := []*int64{
+		&s.Time, &s.MedianTime, &s.Txs, &s.Ins, &s.Outs, &s.TotalOut,
+		&s.TotalFee, &s.Subsidy, &s.TotalSize, &s.TotalWeight,
+		&s.SegWitTxs, &s.SegWitTotalSize, &s.SegWitTotalWeight,
+		&s.MinFee, &s.MaxFee, &s.AverageFee, &s.MedianFee,
+		&s.MinFeeRate, &s.MaxFeeRate, &s.AverageFeeRate,
+	}
+	for i := range s.FeeRatePercentiles {
+		fields = append(fields, &s.FeeRatePercentiles[i])
+	}
+	return append(fields, &s.MinTxSize, &s.MaxTxSize, &s.AverageTxSize,
+		&s.MedianTxSize, &s.UTXOIncrease, &s.UTXOSizeIncrease)
+}
+
+// blockStatsKey returns the key in the block stats index for the passed
+// height.
+func blockStatsKey(height int32) []byte {
+	var key [4]byte
+	binary.BigEndian.PutUint32(key[:], uint32(height))
+	return key[:]
+}
+
+// serializeBlockStats serializes the passed block stats according to the format
+// described in detail above.
+func serializeBlockStats(stats *BlockStats) []byte {
+	serialized := make([]byte, blockStatsEntrySize)
+	copy(serialized, stats.Hash[:])
+	offset := chainhash.HashSize
+	for _, field := range stats.fields() {
+		byteOrder.PutUint64(serialized[offset:], uint64(*field))
+		offset += 8
+	}
+	return serialized
+}
+
+// deserializeBlockStats decodes the passed serialized block stats for the block
+// at the passed height according to the format described in detail above.
+func deserializeBlockStats(height int32, serialized []byte) (*BlockStats, error) {
+	if len(serialized) < blockStatsEntrySize {
+		return nil, errDeserialize("unexpected end of data")
+	}
+
+	stats := BlockStats{Height: height}
+	copy(stats.Hash[:], serialized)
+	offset := chainhash.HashSize
+	for _, field := range stats.fields() {
+		*field = int64(byteOrder.Uint64(serialized[offset:]))
+		offset += 8
+	}
+	return &stats, nil
+}
+
+// medianInt64 returns the median of the passed values, averaging the two middle
+// values when there is an even number of them.  The passed slice is sorted in
+// place.
+func medianInt64(values []int64) int64 {
+	if len(values) == 0 {
+		return 0
+	}
+
+	sort.Slice(values, func(i, j int) bool { return values[i] < values[j] })
+	mid := len(values) / 2
+	if len(values)%2 == 0 {
+		return (values[mid-1] + values[mid]) / 2
+	}
+	return values[mid]
+}
+
+// feeRateWeight pairs the fee rate of a transaction with its weight.
+type feeRateWeight struct {
+	feeRate int64
+	weight  int64
+}
+
+// calcFeeRatePercentiles returns the fee rate percentiles of the passed
+// transactions weighted by their weight.  The passed slice is sorted in place.
+func calcFeeRatePercentiles(txns []feeRateWeight, totalWeight int64) [NumFeeRatePercentiles]int64 {
+	var result [NumFeeRatePercentiles]int64
+	if len(txns) == 0 {
+		return result
+	}
+
+	sort.Slice(txns, func(i, j int) bool {
+		if txns[i].feeRate != txns[j].feeRate {
+			return txns[i].feeRate < txns[j].feeRate
+		}
+		return txns[i].weight < txns[j].weight
+	})
+
+	next := 0
+	var cumulativeWeight int64
+	for _, txn := range txns {
+		cumulativeWeight += txn.weight
+		for next < NumFeeRatePercentiles && float64(cumulativeWeight) >=
+			float64(totalWeight)*feeRatePercentiles[next] {
+
+			result[next] = txn.feeRate
+			next++
+		}
+	}
+
+	// Fill any remaining percentiles with the highest fee rate.
+	for ; next < NumFeeRatePercentiles; next++ {
+		result[next] = txns[len(txns)-1].feeRate
+	}
+	return result
+}
+
+// calcBlockStats returns the statistics about the passed block.  The passed
+// spent outputs must be the outputs spent by the block in the order of the
+// inputs of its non-coinbase transactions and the passed previous timestamps
+// must be the timestamps of the blocks before it used to calculate its median
+// time.
+func calcBlockStats(block *btcutil.Block, stxos []blockchain.SpentTxOut,
+	prevTimestamps []int64, chainParams *chaincfg.Params) *BlockStats {
+
+	header := &block.MsgBlock().Header
+	stats := BlockStats{
+		Hash:    *block.Hash(),
+		Height:  block.Height(),
+		Time:    header.Timestamp.Unix(),
+		Subsidy: blockchain.CalcBlockSubsidy(block.Height(), chainParams),
+	}
+
+	// The median time uses the same calculation as the consensus rules.
+	timestamps := append([]int64{stats.Time}, prevTimestamps...)
+	sort.Slice(timestamps, func(i, j int) bool {
+		return timestamps[i] < timestamps[j]
+	})
+	stats.MedianTime = timestamps[len(timestamps)/2]
+
+	transactions := block.Transactions()
+	stats.Txs = int64(len(transactions))
+	fees := make([]int64, 0, len(transactions)-1)
+	sizes := make([]int64, 0, len(transactions)-1)
+	feeRates := make([]feeRateWeight, 0, len(transactions)-1)
+	stxoIndex := 0
+	for txIdx, tx := range transactions {
+		msgTx := tx.MsgTx()
+		stats.Outs += int64(len(msgTx.TxOut))
+
+		var totalOut int64
+		for _, txOut := range msgTx.TxOut {
+			totalOut += txOut.Value
+			stats.UTXOIncrease++
+			stats.UTXOSizeIncrease += int64(txOut.SerializeSize() +
+				utxoOverhead)
+		}
+
+		// The remaining stats only apply to non-coinbase transactions.
+		if txIdx == 0 {
+			continue
+		}
+
+		var totalIn int64
+		for range msgTx.TxIn {
+			stxo := &stxos[stxoIndex]
+			stxoIndex++
+
+			totalIn += stxo.Amount
+			stats.Ins++
+			stats.UTXOIncrease--
+			spentOut := wire.TxOut{Value: stxo.Amount,
+				PkScript: stxo.PkScript}
+			stats.UTXOSizeIncrease -= int64(spentOut.SerializeSize() +
+				utxoOverhead)
+		}
+
+		size := int64(msgTx.SerializeSize())
+		weight := blockchain.GetTransactionWeight(tx)
+		fee := totalIn - totalOut
+		feeRate := int64(0)
+		if weight > 0 {
+			feeRate = fee * blockchain.WitnessScaleFactor / weight
+		}
+
+		if msgTx.HasWitness() {
+			stats.SegWitTxs++
+			stats.SegWitTotalSize += size
+			stats.SegWitTotalWeight += weight
+		}
+
+		stats.TotalOut += totalOut
+		stats.TotalFee += fee
+		stats.TotalSize += size
+		stats.TotalWeight += weight
+		if len(fees) == 0 || fee < stats.MinFee {
+			stats.MinFee = fee
+		}
+		if fee > stats.MaxFee {
+			stats.MaxFee = fee
+		}
+		if len(fees) == 0 || feeRate < stats.MinFeeRate {
+			stats.MinFeeRate = feeRate
+		}
+		if feeRate > stats.MaxFeeRate {
+			stats.MaxFeeRate = feeRate
+		}
+		if len(sizes) == 0 || size < stats.MinTxSize {
+			stats.MinTxSize = size
+		}
+		if size > stats.MaxTxSize {
+			stats.MaxTxSize = size
+		}
+		fees = append(fees, fee)
+		sizes = append(sizes, size)
+		feeRates = append(feeRates, feeRateWeight{feeRate, weight})
+	}
+
+	if numTxns := int64(len(fees)); numTxns > 0 {
+		stats.AverageFee = stats.TotalFee / numTxns
+		stats.AverageTxSize = stats.TotalSize / numTxns
+		if stats.TotalWeight > 0 {
+			stats.AverageFeeRate = stats.TotalFee *
+				blockchain.WitnessScaleFactor / stats.TotalWeight
+		}
+	}
+	stats.MedianFee = medianInt64(fees)
+	stats.MedianTxSize = medianInt64(sizes)
+	stats.FeeRatePercentiles = calcFeeRatePercentiles(feeRates,
+		stats.TotalWeight)
+
+	return &stats
+}
+
+// dbFetchBlockStats fetches the block stats stored in the index for the passed
+// height.  It returns nil when there is no entry for the height.
+func dbFetchBlockStats(bucket database.Bucket, height int32) (*BlockStats, error) {
+	serialized := bucket.Get(blockStatsKey(height))
+	if serialized == nil {
+		return nil, nil
+	}
+
+	stats, err := deserializeBlockStats(height, serialized)
+	if err != nil {
+		return nil, database.Error{
+			ErrorCode: database.ErrCorruption,
+			Description: fmt.Sprintf("failed to deserialize block "+
+				"stats index entry for height %d: %v", height, err),
+		}
+	}
+	return stats, nil
+}
+
+// BlockStatsIndex implements an index that keeps aggregate statistics about
+// every block in the main chain keyed by block height.
+type BlockStatsIndex struct {
+	db          database.DB
+	chainParams *chaincfg.Params
+}
+
+// Ensure the BlockStatsIndex type implements the Indexer interface.
+var _ Indexer = (*BlockStatsIndex)(nil)
+
+// Ensure the BlockStatsIndex type implements the NeedsInputser interface.
+var _ NeedsInputser = (*BlockStatsIndex)(nil)
+
+// NeedsInputs signals that the index requires the referenced inputs in order
+// to properly create the index.
+//
+// This implements the NeedsInputser interface.
+func (idx *BlockStatsIndex) NeedsInputs() bool {
+	return true
+}
+
+// Init is only provided to satisfy the Indexer interface as there is nothing to
+// initialize for this index.
+//
+// This is part of the Indexer interface.
+func (idx *BlockStatsIndex) Init() error {
+	// Nothing to do.
+	return nil
+}
+
+// Key returns the database key to use for the index as a byte slice.
+//
+// This is part of the Indexer interface.
+func (idx *BlockStatsIndex) Key() []byte {
+	return blockStatsIndexKey
+}
+
+// Name returns the human-readable name of the index.
+//
+// This is part of the Indexer interface.
+func (idx *BlockStatsIndex) Name() string {
+	return blockStatsIndexName
+}
+
+// Create is invoked when the indexer manager determines the index needs
+// to be created for the first time.  It creates the bucket for the block stats
+// index.
+//
+// This is part of the Indexer interface.
+func (idx *BlockStatsIndex) Create(dbTx database.Tx) error {
+	_, err := dbTx.Metadata().CreateBucket(blockStatsIndexKey)
+	return err
+}
+
+// ConnectBlock is invoked by the index manager when a new block has been
+// connected to the main chain.  This indexer stores the statistics about the
+// block, replacing any entry left at its height by a block that is no longer
+// in the main chain.
+//
+// This is part of the Indexer interface.
+func (idx *BlockStatsIndex) ConnectBlock(dbTx database.Tx, block *btcutil.Block,
+	stxos []blockchain.SpentTxOut) error {
+
+	// Load the timestamps of the previous blocks from their entries in the
+	// index in order to calculate the median time of the block.
+	bucket := dbTx.Metadata().Bucket(blockStatsIndexKey)
+	prevTimestamps := make([]int64, 0, medianTimeBlocks-1)
+	for height := block.Height() - 1; height >= 0 &&
+		len(prevTimestamps) < medianTimeBlocks-1; height-- {
+
+		prevStats, err := dbFetchBlockStats(bucket, height)
+		if err != nil {
+			return err
+		}
+		if prevStats == nil {
+			break
+		}
+		prevTimestamps = append(prevTimestamps, prevStats.Time)
+	}
+
+	stats := calcBlockStats(block, stxos, prevTimestamps, idx.chainParams)
+	return bucket.Put(blockStatsKey(block.Height()), serializeBlockStats(stats))
+}
+
+// DisconnectBlock is invoked by the index manager when a block has been
+// disconnected from the main chain.  This indexer removes the statistics about
+// the block.
+//
+// This is part of the Indexer interface.
+func (idx *BlockStatsIndex) DisconnectBlock(dbTx database.Tx, block *btcutil.Block,
+	stxos []blockchain.SpentTxOut) error {
+
+	bucket := dbTx.Metadata().Bucket(blockStatsIndexKey)
+	return bucket.Delete(blockStatsKey(block.Height()))
+}
+
+// StatsForHeightRange returns the statistics about the blocks in the main chain
+// with heights in the passed inclusive range ordered by height.  Heights beyond
+// the tip of the index are skipped.
+//
+// This function is safe for concurrent access.
+func (idx *BlockStatsIndex) StatsForHeightRange(start, end int32) ([]*BlockStats, error) {
+	if start < 0 {
+		start = 0
+	}
+	if end < start {
+		return nil, nil
+	}
+
+	var stats []*BlockStats
+	err := idx.db.View(func(dbTx database.Tx) error {
+		bucket := dbTx.Metadata().Bucket(blockStatsIndexKey)
+		cursor := bucket.Cursor()
+		endKey := blockStatsKey(end)
+		for ok := cursor.Seek(blockStatsKey(start)); ok; ok = cursor.Next() {
+			key := cursor.Key()
+			if bytes.Compare(key, endKey) > 0 {
+				break
+			}
+
+			height := int32(binary.BigEndian.Uint32(key))
+			blockStats, err := deserializeBlockStats(height,
+				cursor.Value())
+			if err != nil {
+				return database.Error{
+					ErrorCode: database.ErrCorruption,
+					Description: fmt.Sprintf("failed to "+
+						"deserialize block stats index "+
+						"entry for height %d: %v", height,
+						err),
+				}
+			}
+			stats = append(stats, blockStats)
+		}
+		return nil
+	})
+	return stats, err
+}
+
+// StatsForHeight returns the statistics about the block in the main chain at
+// the passed height.  It returns nil when the index has no entry for the
+// height.
+//
+// This function is safe for concurrent access.
+func (idx *BlockStatsIndex) StatsForHeight(height int32) (*BlockStats, error) {
+	var stats *BlockStats
+	err := idx.db.View(func(dbTx database.Tx) error {
+		var err error
+		bucket := dbTx.Metadata().Bucket(blockStatsIndexKey)
+		stats, err = dbFetchBlockStats(bucket, height)
+		return err
+	})
+	return stats, err
+}
+
+// NewBlockStatsIndex returns a new instance of an indexer that is used to keep
+// aggregate statistics about every block in the main chain.
+//
+// It implements the Indexer interface which plugs into the IndexManager that in
+// turn is used by the blockchain package.  This allows the index to be
+// seamlessly maintained along with the chain.
+func NewBlockStatsIndex(db database.DB, chainParams *chaincfg.Params) *BlockStatsIndex {
+	return &BlockStatsIndex{db: db, chainParams: chainParams}
+}
+
+// DropBlockStatsIndex drops the block stats index from the provided database if
+// it exists.
+func DropBlockStatsIndex(db database.DB, interrupt <-chan struct{}) error {
+	return dropIndex(db, blockStatsIndexKey, blockStatsIndexName, interrupt)
+}
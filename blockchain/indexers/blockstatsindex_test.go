@@ -0,0 +1,218 @@
+// Copyright (c) 2021 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package indexers
+
+import (
+	"io/ioutil"
+	"os"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/btcsuite/btcd/blockchain"
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcd/database"
+	"github.com/btcsuite/btcd/wire"
+	"github.com/btcsuite/btcutil"
+)
+
+// TestBlockStatsSerialization ensures serializing and deserializing block stats
+// index entries works as expected.
+func TestBlockStatsSerialization(t *testing.T) {
+	t.Parallel()
+
+	stats := BlockStats{
+		Hash:               [32]byte{0x01, 0x02},
+		Height:             1000,
+		Time:               1600000000,
+		TotalFee:           12345,
+		FeeRatePercentiles: [NumFeeRatePercentiles]int64{1, 2, 3, 4, 5},
+		UTXOSizeIncrease:   -250,
+	}
+	serialized := serializeBlockStats(&stats)
+	if len(serialized) != blockStatsEntrySize {
+		t.Fatalf("serializeBlockStats: got %d bytes, want %d",
+			len(serialized), blockStatsEntrySize)
+	}
+	gotStats, err := deserializeBlockStats(stats.Height, serialized)
+	if err != nil {
+		t.Fatalf("deserializeBlockStats: unexpected error: %v", err)
+	}
+	if !reflect.DeepEqual(*gotStats, stats) {
+		t.Fatalf("deserializeBlockStats: got %+v, want %+v", *gotStats,
+			stats)
+	}
+
+	_, err = deserializeBlockStats(0, serialized[:blockStatsEntrySize-1])
+	if !isDeserializeErr(err) {
+		t.Fatalf("deserializeBlockStats: unexpected error: %v", err)
+	}
+}
+
+// TestFeeRatePercentiles ensures the fee rate percentiles are weighted by the
+// weight of the transactions.
+func TestFeeRatePercentiles(t *testing.T) {
+	t.Parallel()
+
+	txns := []feeRateWeight{
+		{feeRate: 50, weight: 100},
+		{feeRate: 1, weight: 800},
+		{feeRate: 10, weight: 100},
+	}
+	got := calcFeeRatePercentiles(txns, 1000)
+	want := [NumFeeRatePercentiles]int64{1, 1, 1, 1, 10}
+	if got != want {
+		t.Fatalf("calcFeeRatePercentiles: got %v, want %v", got, want)
+	}
+
+	got = calcFeeRatePercentiles(nil, 0)
+	if got != [NumFeeRatePercentiles]int64{} {
+		t.Fatalf("calcFeeRatePercentiles: got %v, want zeros", got)
+	}
+}
+
+// TestBlockStatsIndex ensures connecting and disconnecting blocks properly adds
+// and removes block stats index entries and calculates the stats.
+func TestBlockStatsIndex(t *testing.T) {
+	t.Parallel()
+
+	dbPath, err := ioutil.TempDir("", "blockstatsindex")
+	if err != nil {
+		t.Fatalf("TempDir: unexpected error: %v", err)
+	}
+	defer os.RemoveAll(dbPath)
+	db, err := database.Create("ffldb", dbPath, wire.MainNet)
+	if err != nil {
+		t.Fatalf("Create: unexpected error: %v", err)
+	}
+	defer db.Close()
+
+	params := &chaincfg.MainNetParams
+	idx := NewBlockStatsIndex(db, params)
+	if err := db.Update(idx.Create); err != nil {
+		t.Fatalf("Create index: unexpected error: %v", err)
+	}
+
+	connect := func(block *btcutil.Block, stxos []blockchain.SpentTxOut) {
+		t.Helper()
+		err := db.Update(func(dbTx database.Tx) error {
+			return idx.ConnectBlock(dbTx, block, stxos)
+		})
+		if err != nil {
+			t.Fatalf("ConnectBlock: unexpected error: %v", err)
+		}
+	}
+	newBlock := func(height int32, timestamp int64, txns ...*wire.MsgTx) *btcutil.Block {
+		coinbase := wire.NewMsgTx(wire.TxVersion)
+		coinbase.AddTxIn(&wire.TxIn{
+			PreviousOutPoint: wire.OutPoint{Index: wire.MaxPrevOutIndex},
+			SignatureScript:  []byte{byte(height)},
+		})
+		coinbase.AddTxOut(wire.NewTxOut(5000, []byte{0x51}))
+		block := btcutil.NewBlock(&wire.MsgBlock{
+			Header: wire.BlockHeader{
+				Timestamp: time.Unix(timestamp, 0),
+			},
+			Transactions: append([]*wire.MsgTx{coinbase}, txns...),
+		})
+		block.SetHeight(height)
+		return block
+	}
+
+	// Connect coinbase only blocks with decreasing timestamps so the median
+	// time differs from the block time.
+	for height := int32(0); height < 3; height++ {
+		connect(newBlock(height, int64(1000-height*100)), nil)
+	}
+
+	// Connect a block with two transactions paying fees of 100 and 300.
+	tx1 := wire.NewMsgTx(wire.TxVersion)
+	tx1.AddTxIn(wire.NewTxIn(&wire.OutPoint{Hash: [32]byte{0x01}}, nil, nil))
+	tx1.AddTxOut(wire.NewTxOut(900, []byte{0x51}))
+	tx2 := wire.NewMsgTx(wire.TxVersion)
+	tx2.AddTxIn(wire.NewTxIn(&wire.OutPoint{Hash: [32]byte{0x02}}, nil, nil))
+	tx2.AddTxIn(wire.NewTxIn(&wire.OutPoint{Hash: [32]byte{0x03}}, nil, nil))
+	tx2.AddTxOut(wire.NewTxOut(1700, []byte{0x51}))
+	stxos := []blockchain.SpentTxOut{
+		{Amount: 1000, PkScript: []byte{0x51}},
+		{Amount: 1000, PkScript: []byte{0x51}},
+		{Amount: 1000, PkScript: []byte{0x51}},
+	}
+	block3 := newBlock(3, 2000, tx1, tx2)
+	connect(block3, stxos)
+
+	stats, err := idx.StatsForHeight(3)
+	if err != nil {
+		t.Fatalf("StatsForHeight: unexpected error: %v", err)
+	}
+	if stats == nil || stats.Hash != *block3.Hash() {
+		t.Fatalf("StatsForHeight: unexpected stats %+v", stats)
+	}
+	size1, size2 := int64(tx1.SerializeSize()), int64(tx2.SerializeSize())
+	checks := []struct {
+		name string
+		got  int64
+		want int64
+	}{
+		{"Time", stats.Time, 2000},
+		{"MedianTime", stats.MedianTime, 1000},
+		{"Txs", stats.Txs, 3},
+		{"Ins", stats.Ins, 3},
+		{"Outs", stats.Outs, 3},
+		{"TotalOut", stats.TotalOut, 2600},
+		{"TotalFee", stats.TotalFee, 400},
+		{"Subsidy", stats.Subsidy, blockchain.CalcBlockSubsidy(3, params)},
+		{"TotalSize", stats.TotalSize, size1 + size2},
+		{"TotalWeight", stats.TotalWeight, (size1 + size2) * 4},
+		{"MinFee", stats.MinFee, 100},
+		{"MaxFee", stats.MaxFee, 300},
+		{"AverageFee", stats.AverageFee, 200},
+		{"MedianFee", stats.MedianFee, 200},
+		{"MinFeeRate", stats.MinFeeRate, 100 / size1},
+		{"MaxFeeRate", stats.MaxFeeRate, 300 / size2},
+		{"MinTxSize", stats.MinTxSize, size1},
+		{"MaxTxSize", stats.MaxTxSize, size2},
+		{"UTXOIncrease", stats.UTXOIncrease, 0},
+	}
+	for _, check := range checks {
+		if check.got != check.want {
+			t.Errorf("%s: got %d, want %d", check.name, check.got,
+				check.want)
+		}
+	}
+
+	// Ensure range queries return the entries in order and skip heights
+	// beyond the tip.
+	rangeStats, err := idx.StatsForHeightRange(1, 10)
+	if err != nil {
+		t.Fatalf("StatsForHeightRange: unexpected error: %v", err)
+	}
+	if len(rangeStats) != 3 || rangeStats[0].Height != 1 ||
+		rangeStats[2].Height != 3 {
+
+		t.Fatalf("StatsForHeightRange: unexpected stats %+v", rangeStats)
+	}
+
+	// Ensure disconnecting the block removes its entry and connecting a
+	// different block at the same height replaces it.
+	err = db.Update(func(dbTx database.Tx) error {
+		return idx.DisconnectBlock(dbTx, block3, stxos)
+	})
+	if err != nil {
+		t.Fatalf("DisconnectBlock: unexpected error: %v", err)
+	}
+	stats, err = idx.StatsForHeight(3)
+	if err != nil || stats != nil {
+		t.Fatalf("StatsForHeight: got %+v, %v, want nil", stats, err)
+	}
+	altBlock3 := newBlock(3, 2100)
+	connect(altBlock3, nil)
+	stats, err = idx.StatsForHeight(3)
+	if err != nil || stats == nil || stats.Hash != *altBlock3.Hash() ||
+		stats.TotalFee != 0 {
+
+		t.Fatalf("StatsForHeight: got %+v, %v", stats, err)
+	}
+}
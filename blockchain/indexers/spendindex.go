@@ -0,0 +1,237 @@
+// Copyright (c) 2021 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package indexers
+
+import (
+	"fmt"
+
+	"github.com/btcsuite/btcd/blockchain"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/database"
+	"github.com/btcsuite/btcd/wire"
+	"github.com/btcsuite/btcutil"
+)
+
+const (
+	// spendIndexName is the human-readable name for the index.
+	spendIndexName = "spent output index"
+
+	// spendKeySize is the size of a key in the spent output index.  It
+	// consists of the 32 bytes transaction hash + 4 bytes output index of
+	// the spent output.
+	spendKeySize = chainhash.HashSize + 4
+
+	// spendEntrySize is the size of a value in the spent output index.  It
+	// consists of the 32 bytes hash of the spending transaction + 4 bytes
+	// input index + 4 bytes block height.
+	spendEntrySize = chainhash.HashSize + 4 + 4
+)
+
+var (
+	// spendIndexKey is the key of the spent output index and the db bucket
+	// used to house it.
+	spendIndexKey = []byte("spendbyoutpointidx")
+)
+
+// -----------------------------------------------------------------------------
+// The spent output index consists of an entry for every output spent by a
+// transaction in the main chain.  Each entry maps the outpoint of the spent
+// output to the transaction input that spends it and the height of the block
+// that contains the spending transaction.
+//
+// The serialized format for keys and values in the index is:
+//
+//   <tx hash><output index> = <spending tx hash><input index><height>
+//
+//   Field              Type              Size
+//   tx hash            chainhash.Hash    32 bytes
+//   output index       uint32            4 bytes
+//   spending tx hash   chainhash.Hash    32 bytes
+//   input index        uint32            4 bytes
+//   height             uint32            4 bytes
+//   -----
+//   Total: 76 bytes
+// -----------------------------------------------------------------------------
+
+// SpendingInput identifies the transaction input that spends an output along
+// with the height of the block that contains the spending transaction.
+type SpendingInput struct {
+	TxHash     chainhash.Hash
+	InputIndex uint32
+	Height     int32
+}
+
+// spendKey returns the key in the spent output index for the passed outpoint.
+func spendKey(outPoint *wire.OutPoint) []byte {
+	key := make([]byte, spendKeySize)
+	copy(key, outPoint.Hash[:])
+	byteOrder.PutUint32(key[chainhash.HashSize:], outPoint.Index)
+	return key
+}
+
+// serializeSpendEntry serializes the passed spending input according to the
+// format described in detail above.
+func serializeSpendEntry(spend *SpendingInput) []byte {
+	serialized := make([]byte, spendEntrySize)
+	copy(serialized, spend.TxHash[:])
+	offset := chainhash.HashSize
+	byteOrder.PutUint32(serialized[offset:], spend.InputIndex)
+	offset += 4
+	byteOrder.PutUint32(serialized[offset:], uint32(spend.Height))
+	return serialized
+}
+
+// deserializeSpendEntry decodes the passed serialized spending input according
+// to the format described in detail above.
+func deserializeSpendEntry(serialized []byte) (*SpendingInput, error) {
+	if len(serialized) < spendEntrySize {
+		return nil, errDeserialize("unexpected end of data")
+	}
+
+	var spend SpendingInput
+	copy(spend.TxHash[:], serialized)
+	offset := chainhash.HashSize
+	spend.InputIndex = byteOrder.Uint32(serialized[offset:])
+	offset += 4
+	spend.Height = int32(byteOrder.Uint32(serialized[offset:]))
+	return &spend, nil
+}
+
+// SpendIndex implements an index that maps every spent output in the main
+// chain to the transaction input that spends it.
+type SpendIndex struct {
+	db database.DB
+}
+
+// Ensure the SpendIndex type implements the Indexer interface.
+var _ Indexer = (*SpendIndex)(nil)
+
+// Init is only provided to satisfy the Indexer interface as there is nothing to
+// initialize for this index.
+//
+// This is part of the Indexer interface.
+func (idx *SpendIndex) Init() error {
+	// Nothing to do.
+	return nil
+}
+
+// Key returns the database key to use for the index as a byte slice.
+//
+// This is part of the Indexer interface.
+func (idx *SpendIndex) Key() []byte {
+	return spendIndexKey
+}
+
+// Name returns the human-readable name of the index.
+//
+// This is part of the Indexer interface.
+func (idx *SpendIndex) Name() string {
+	return spendIndexName
+}
+
+// Create is invoked when the indexer manager determines the index needs
+// to be created for the first time.  It creates the bucket for the spent
+// output index.
+//
+// This is part of the Indexer interface.
+func (idx *SpendIndex) Create(dbTx database.Tx) error {
+	_, err := dbTx.Metadata().CreateBucket(spendIndexKey)
+	return err
+}
+
+// ConnectBlock is invoked by the index manager when a new block has been
+// connected to the main chain.  This indexer adds an entry for every output
+// spent by the transactions in the block.
+//
+// This is part of the Indexer interface.
+func (idx *SpendIndex) ConnectBlock(dbTx database.Tx, block *btcutil.Block,
+	stxos []blockchain.SpentTxOut) error {
+
+	bucket := dbTx.Metadata().Bucket(spendIndexKey)
+	for _, tx := range block.Transactions()[1:] {
+		for inIdx, txIn := range tx.MsgTx().TxIn {
+			spend := SpendingInput{
+				TxHash:     *tx.Hash(),
+				InputIndex: uint32(inIdx),
+				Height:     block.Height(),
+			}
+			err := bucket.Put(spendKey(&txIn.PreviousOutPoint),
+				serializeSpendEntry(&spend))
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// DisconnectBlock is invoked by the index manager when a block has been
+// disconnected from the main chain.  This indexer removes the entries for the
+// outputs spent by the transactions in the block.
+//
+// This is part of the Indexer interface.
+func (idx *SpendIndex) DisconnectBlock(dbTx database.Tx, block *btcutil.Block,
+	stxos []blockchain.SpentTxOut) error {
+
+	bucket := dbTx.Metadata().Bucket(spendIndexKey)
+	for _, tx := range block.Transactions()[1:] {
+		for _, txIn := range tx.MsgTx().TxIn {
+			err := bucket.Delete(spendKey(&txIn.PreviousOutPoint))
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// SpendingInputForOutPoint returns the transaction input in the main chain
+// that spends the passed outpoint.  It returns nil when there is no such input,
+// which is the case when the output is unspent, only spent by an unconfirmed
+// transaction, or does not exist.
+//
+// This function is safe for concurrent access.
+func (idx *SpendIndex) SpendingInputForOutPoint(outPoint *wire.OutPoint) (*SpendingInput, error) {
+	var spend *SpendingInput
+	err := idx.db.View(func(dbTx database.Tx) error {
+		bucket := dbTx.Metadata().Bucket(spendIndexKey)
+		serialized := bucket.Get(spendKey(outPoint))
+		if serialized == nil {
+			return nil
+		}
+
+		var err error
+		spend, err = deserializeSpendEntry(serialized)
+		if err != nil {
+			return database.Error{
+				ErrorCode: database.ErrCorruption,
+				Description: fmt.Sprintf("failed to deserialize "+
+					"spent output index entry for %v: %v",
+					outPoint, err),
+			}
+		}
+		return nil
+	})
+	return spend, err
+}
+
+// NewSpendIndex returns a new instance of an indexer that is used to create a
+// mapping of every spent output in the main chain to the transaction input that
+// spends it.
+//
+// It implements the Indexer interface which plugs into the IndexManager that in
+// turn is used by the blockchain package.  This allows the index to be
+// seamlessly maintained along with the chain.
+func NewSpendIndex(db database.DB) *SpendIndex {
+	return &SpendIndex{db: db}
+}
+
+// DropSpendIndex drops the spent output index from the provided database if it
+// exists.
+func DropSpendIndex(db database.DB, interrupt <-chan struct{}) error {
+	return dropIndex(db, spendIndexKey, spendIndexName, interrupt)
+}
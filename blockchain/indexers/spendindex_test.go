@@ -0,0 +1,119 @@
+// Copyright (c) 2021 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package indexers
+
+import (
+	"io/ioutil"
+	"os"
+	"reflect"
+	"testing"
+
+	"github.com/btcsuite/btcd/database"
+	"github.com/btcsuite/btcd/wire"
+	"github.com/btcsuite/btcutil"
+)
+
+// TestSpendEntrySerialization ensures serializing and deserializing spent
+// output index entries works as expected.
+func TestSpendEntrySerialization(t *testing.T) {
+	t.Parallel()
+
+	spend := SpendingInput{
+		TxHash:     [32]byte{0x01, 0x02},
+		InputIndex: 3,
+		Height:     500000,
+	}
+	serialized := serializeSpendEntry(&spend)
+	if len(serialized) != spendEntrySize {
+		t.Fatalf("serializeSpendEntry: got %d bytes, want %d",
+			len(serialized), spendEntrySize)
+	}
+	gotSpend, err := deserializeSpendEntry(serialized)
+	if err != nil {
+		t.Fatalf("deserializeSpendEntry: unexpected error: %v", err)
+	}
+	if !reflect.DeepEqual(*gotSpend, spend) {
+		t.Fatalf("deserializeSpendEntry: got %+v, want %+v", *gotSpend,
+			spend)
+	}
+
+	_, err = deserializeSpendEntry(serialized[:spendEntrySize-1])
+	if !isDeserializeErr(err) {
+		t.Fatalf("deserializeSpendEntry: unexpected error: %v", err)
+	}
+}
+
+// TestSpendIndex ensures connecting and disconnecting blocks properly adds and
+// removes spent output index entries.
+func TestSpendIndex(t *testing.T) {
+	t.Parallel()
+
+	dbPath, err := ioutil.TempDir("", "spendindex")
+	if err != nil {
+		t.Fatalf("TempDir: unexpected error: %v", err)
+	}
+	defer os.RemoveAll(dbPath)
+	db, err := database.Create("ffldb", dbPath, wire.MainNet)
+	if err != nil {
+		t.Fatalf("Create: unexpected error: %v", err)
+	}
+	defer db.Close()
+
+	idx := NewSpendIndex(db)
+	if err := db.Update(idx.Create); err != nil {
+		t.Fatalf("Create index: unexpected error: %v", err)
+	}
+
+	coinbase := wire.NewMsgTx(wire.TxVersion)
+	coinbase.AddTxIn(&wire.TxIn{PreviousOutPoint: wire.OutPoint{
+		Index: wire.MaxPrevOutIndex}})
+	coinbase.AddTxOut(wire.NewTxOut(50, nil))
+	spentOutPoint := wire.OutPoint{Hash: [32]byte{0xaa}, Index: 2}
+	spendTx := wire.NewMsgTx(wire.TxVersion)
+	spendTx.AddTxIn(wire.NewTxIn(&wire.OutPoint{Hash: [32]byte{0xbb}},
+		nil, nil))
+	spendTx.AddTxIn(wire.NewTxIn(&spentOutPoint, nil, nil))
+	spendTx.AddTxOut(wire.NewTxOut(10, nil))
+	block := btcutil.NewBlock(&wire.MsgBlock{
+		Transactions: []*wire.MsgTx{coinbase, spendTx},
+	})
+	block.SetHeight(7)
+
+	err = db.Update(func(dbTx database.Tx) error {
+		return idx.ConnectBlock(dbTx, block, nil)
+	})
+	if err != nil {
+		t.Fatalf("ConnectBlock: unexpected error: %v", err)
+	}
+
+	spend, err := idx.SpendingInputForOutPoint(&spentOutPoint)
+	if err != nil {
+		t.Fatalf("SpendingInputForOutPoint: unexpected error: %v", err)
+	}
+	want := SpendingInput{TxHash: spendTx.TxHash(), InputIndex: 1, Height: 7}
+	if spend == nil || *spend != want {
+		t.Fatalf("SpendingInputForOutPoint: got %+v, want %+v", spend,
+			want)
+	}
+
+	// The coinbase input does not spend anything.
+	spend, err = idx.SpendingInputForOutPoint(&coinbase.TxIn[0].PreviousOutPoint)
+	if err != nil || spend != nil {
+		t.Fatalf("SpendingInputForOutPoint: got %+v, %v, want nil",
+			spend, err)
+	}
+
+	err = db.Update(func(dbTx database.Tx) error {
+		return idx.DisconnectBlock(dbTx, block, nil)
+	})
+	if err != nil {
+		t.Fatalf("DisconnectBlock: unexpected error: %v", err)
+	}
+	spend, err = idx.SpendingInputForOutPoint(&spentOutPoint)
+	if err != nil || spend != nil {
+		t.Fatalf("SpendingInputForOutPoint: got %+v, %v, want nil",
+			spend, err)
+	}
+}
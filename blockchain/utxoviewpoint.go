@@ -5,6 +5,7 @@
 package blockchain
 
 import (
+	"bytes"
 	"fmt"
 
 	"github.com/btcsuite/btcd/chaincfg/chainhash"
@@ -656,3 +657,91 @@ func (b *BlockChain) FetchUtxoEntry(outpoint wire.OutPoint) (*UtxoEntry, error)
 
 	return entry, nil
 }
+
+// utxoScanBatchSize is the maximum number of unspent transaction outputs
+// ForEachUtxo loads from the database while holding the chain lock.
+const utxoScanBatchSize = 10000
+
+// UtxoSetProgress returns the approximate fraction of the utxo set, between 0
+// and 1, which is iterated by ForEachUtxo before the passed outpoint.  Since
+// the utxo set is keyed by transaction hash, the fraction is derived from the
+// leading bytes of the hash.
+func UtxoSetProgress(outpoint wire.OutPoint) float64 {
+	return float64(uint32(outpoint.Hash[0])<<8|uint32(outpoint.Hash[1])) /
+		(1 << 16)
+}
+
+// ForEachUtxo calls the passed function with every unspent transaction output
+// in the utxo set in the order of their keys, which is the byte order of their
+// transaction hashes.  The iteration stops when the function returns an
+// error, which is then returned.
+//
+// The utxo set is loaded in batches so the chain lock is not held for the
+// duration of the whole iteration, and the passed function is invoked without
+// holding it.  Each batch reflects the utxo set at the main chain tip at the
+// time the batch is loaded, so outputs created or spent by blocks connected
+// during the iteration may be visited or missed depending on their position
+// in the set.
+//
+// This function is safe for concurrent access however the passed entries are
+// NOT.
+func (b *BlockChain) ForEachUtxo(fn func(outpoint wire.OutPoint, entry *UtxoEntry) error) error {
+	type utxo struct {
+		outpoint wire.OutPoint
+		entry    *UtxoEntry
+	}
+
+	var lastKey []byte
+	batch := make([]utxo, 0, utxoScanBatchSize)
+	for {
+		batch = batch[:0]
+		b.chainLock.RLock()
+		err := b.db.View(func(dbTx database.Tx) error {
+			cursor := dbTx.Metadata().Bucket(utxoSetBucketName).Cursor()
+
+			// Resume after the last key of the previous batch.
+			ok := cursor.First()
+			if lastKey != nil {
+				ok = cursor.Seek(lastKey)
+				if ok && bytes.Equal(cursor.Key(), lastKey) {
+					ok = cursor.Next()
+				}
+			}
+			for ; ok && len(batch) < utxoScanBatchSize; ok = cursor.Next() {
+				key := cursor.Key()
+				outpoint, err := decodeOutpointKey(key)
+				if err != nil {
+					return database.Error{
+						ErrorCode: database.ErrCorruption,
+						Description: fmt.Sprintf("corrupt utxo "+
+							"key %x: %v", key, err),
+					}
+				}
+				entry, err := deserializeUtxoEntry(cursor.Value())
+				if err != nil {
+					return database.Error{
+						ErrorCode: database.ErrCorruption,
+						Description: fmt.Sprintf("corrupt utxo "+
+							"entry for %v: %v", outpoint, err),
+					}
+				}
+				batch = append(batch, utxo{outpoint, entry})
+				lastKey = append(lastKey[:0], key...)
+			}
+			return nil
+		})
+		b.chainLock.RUnlock()
+		if err != nil {
+			return err
+		}
+
+		for i := range batch {
+			if err := fn(batch[i].outpoint, batch[i].entry); err != nil {
+				return err
+			}
+		}
+		if len(batch) < utxoScanBatchSize {
+			return nil
+		}
+	}
+}
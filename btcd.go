@@ -115,6 +115,19 @@ func btcdMain(serverChan chan<- *server) error {
 		return nil
 	}
 
+	// Check the integrity of the database when requested.  The node is not
+	// started when corruption is detected since it would otherwise serve
+	// bad data to its peers.
+	if cfg.VerifyDB {
+		if err := verifyBlockDB(db, interrupt); err != nil {
+			if interruptRequested(interrupt) {
+				return nil
+			}
+			btcdLog.Errorf("%v", err)
+			return err
+		}
+	}
+
 	// Drop indexes and exit if requested.
 	//
 	// NOTE: The order is important here because dropping the tx index also
@@ -127,6 +140,30 @@ func btcdMain(serverChan chan<- *server) error {
 
 		return nil
 	}
+	if cfg.DropAddrUtxoIndex {
+		if err := indexers.DropAddrUtxoIndex(db, interrupt); err != nil {
+			btcdLog.Errorf("%v", err)
+			return err
+		}
+
+		return nil
+	}
+	if cfg.DropBlockStatsIndex {
+		if err := indexers.DropBlockStatsIndex(db, interrupt); err != nil {
+			btcdLog.Errorf("%v", err)
+			return err
+		}
+
+		return nil
+	}
+	if cfg.DropSpendIndex {
+		if err := indexers.DropSpendIndex(db, interrupt); err != nil {
+			btcdLog.Errorf("%v", err)
+			return err
+		}
+
+		return nil
+	}
 	if cfg.DropTxIndex {
 		if err := indexers.DropTxIndex(db, interrupt); err != nil {
 			btcdLog.Errorf("%v", err)
@@ -164,6 +201,11 @@ func btcdMain(serverChan chan<- *server) error {
 		serverChan <- server
 	}
 
+	// Compact the database in the background when requested.
+	if cfg.CompactDB {
+		go compactBlockDB(db)
+	}
+
 	// Wait until the interrupt signal is received from an OS signal or
 	// shutdown is requested through one of the subsystems such as the RPC
 	// server.
@@ -171,6 +213,43 @@ func btcdMain(serverChan chan<- *server) error {
 	return nil
 }
 
+// verifyBlockDB checks the integrity of the provided block database when the
+// database backend supports it.  An error is returned when the database is
+// corrupted or the check was interrupted.
+func verifyBlockDB(db database.DB, interrupt <-chan struct{}) error {
+	checker, ok := db.(database.IntegrityChecker)
+	if !ok {
+		btcdLog.Warnf("The %s database backend does not support "+
+			"integrity checks -- skipping", cfg.DbType)
+		return nil
+	}
+
+	btcdLog.Infof("Checking block database integrity (fully verifying "+
+		"%d%% of blocks)...", cfg.VerifyDBSamplePct)
+	sampleRate := float64(cfg.VerifyDBSamplePct) / 100
+	if err := checker.CheckIntegrity(sampleRate, interrupt); err != nil {
+		return fmt.Errorf("block database integrity check failed: %v",
+			err)
+	}
+
+	return nil
+}
+
+// compactBlockDB compacts the provided block database when the database
+// backend supports it.  It is intended to be run as a goroutine.
+func compactBlockDB(db database.DB) {
+	compactor, ok := db.(database.Compactor)
+	if !ok {
+		btcdLog.Warnf("The %s database backend does not support "+
+			"compaction -- skipping", cfg.DbType)
+		return
+	}
+
+	if err := compactor.Compact(); err != nil {
+		btcdLog.Errorf("Unable to compact block database: %v", err)
+	}
+}
+
 // removeRegressionDB removes the existing regression test database if running
 // in regression test mode and it already exists.
 func removeRegressionDB(dbPath string) error {
@@ -217,7 +296,7 @@ func warnMultipleDBs() {
 	// This is intentionally not using the known db types which depend
 	// on the database types compiled into the binary since we want to
 	// detect legacy db types as well.
-	dbTypes := []string{"ffldb", "leveldb", "sqlite"}
+	dbTypes := []string{"ffldb", "bboltdb", "leveldb", "sqlite"}
 	duplicateDbPaths := make([]string, 0, len(dbTypes)-1)
 	for _, dbType := range dbTypes {
 		if dbType == cfg.DbType {
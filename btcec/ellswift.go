@@ -0,0 +1,262 @@
+// Copyright (c) 2021 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package btcec
+
+import (
+	"crypto/rand"
+	"errors"
+	"io"
+	"math/big"
+)
+
+// EllswiftEncodingLen is the length of an ElligatorSwift encoded public key.
+const EllswiftEncodingLen = 64
+
+var (
+	// ellswiftC is a square root of -3 mod p, which is used by the
+	// ElligatorSwift mapping.
+	ellswiftC = fieldSqrt(new(big.Int).Sub(S256().P, big.NewInt(3)))
+
+	// errEllswiftEncoding is returned when no ElligatorSwift encoding is
+	// found for a public key within the maximum number of attempts, which
+	// doesn't happen in practice.
+	errEllswiftEncoding = errors.New("unable to find ElligatorSwift " +
+		"encoding")
+)
+
+// fieldMod returns a reduced modulo the field prime in place.
+func fieldMod(a *big.Int) *big.Int {
+	return a.Mod(a, S256().P)
+}
+
+// fieldInv returns the multiplicative inverse of a modulo the field prime.  The
+// inverse of zero is zero.
+func fieldInv(a *big.Int) *big.Int {
+	if a.Sign() == 0 {
+		return new(big.Int)
+	}
+	return new(big.Int).ModInverse(a, S256().P)
+}
+
+// fieldSqrt returns a square root of a modulo the field prime, or nil when a is
+// not a square.
+func fieldSqrt(a *big.Int) *big.Int {
+	curve := S256()
+	root := new(big.Int).Exp(a, curve.QPlus1Div4(), curve.P)
+	check := fieldMod(new(big.Int).Mul(root, root))
+	if check.Cmp(fieldMod(new(big.Int).Set(a))) != 0 {
+		return nil
+	}
+	return root
+}
+
+// fieldIsSquare returns whether a is a square modulo the field prime.
+func fieldIsSquare(a *big.Int) bool {
+	return big.Jacobi(fieldMod(new(big.Int).Set(a)), S256().P) >= 0
+}
+
+// curveRHS returns x^3 + 7 modulo the field prime.
+func curveRHS(x *big.Int) *big.Int {
+	rhs := new(big.Int).Mul(x, x)
+	rhs.Mul(rhs, x)
+	rhs.Add(rhs, big.NewInt(7))
+	return fieldMod(rhs)
+}
+
+// xSwiftEC returns the x coordinate on the curve the field elements u and t
+// are mapped to by the SwiftEC mapping as defined in BIP0324.
+func xSwiftEC(u, t *big.Int) *big.Int {
+	p := S256().P
+	u = fieldMod(new(big.Int).Set(u))
+	t = fieldMod(new(big.Int).Set(t))
+	if u.Sign() == 0 {
+		u.SetInt64(1)
+	}
+	if t.Sign() == 0 {
+		t.SetInt64(1)
+	}
+
+	// t is doubled when u^3 + t^2 + 7 is zero, which would otherwise lead
+	// to a division by zero.
+	t2 := fieldMod(new(big.Int).Mul(t, t))
+	u3b := curveRHS(u)
+	if fieldMod(new(big.Int).Add(u3b, t2)).Sign() == 0 {
+		t = fieldMod(t.Lsh(t, 1))
+		t2 = fieldMod(new(big.Int).Mul(t, t))
+	}
+
+	// X = (u^3 + 7 - t^2) / (2t)
+	x := new(big.Int).Sub(u3b, t2)
+	x.Mul(x, fieldInv(fieldMod(new(big.Int).Lsh(t, 1))))
+	fieldMod(x)
+
+	// Y = (X + t) / (c * u)
+	y := new(big.Int).Add(x, t)
+	y.Mul(y, fieldInv(fieldMod(new(big.Int).Mul(ellswiftC, u))))
+	fieldMod(y)
+
+	// The first of the candidates u + 4Y^2, (-X/Y - u) / 2 and
+	// (X/Y - u) / 2 which is on the curve is returned.  At least one of
+	// them always is.
+	half := fieldInv(big.NewInt(2))
+	xDivY := fieldMod(new(big.Int).Mul(x, fieldInv(y)))
+	candidates := [3]*big.Int{
+		new(big.Int).Add(u, new(big.Int).Lsh(new(big.Int).Mul(y, y), 2)),
+		new(big.Int).Mul(new(big.Int).Sub(new(big.Int).Neg(xDivY), u), half),
+		new(big.Int).Mul(new(big.Int).Sub(xDivY, u), half),
+	}
+	for _, candidate := range candidates {
+		fieldMod(candidate)
+		if fieldIsSquare(curveRHS(candidate)) {
+			return candidate
+		}
+	}
+
+	// Not reached since one of the candidates is always on the curve.
+	return new(big.Int).Mod(candidates[0], p)
+}
+
+// xSwiftECInv returns a field element t such that xSwiftEC(u, t) is x, or nil
+// when there is none for the passed case.  The cases 0 through 7 select which
+// of the candidates of xSwiftEC and which square roots are used, which is
+// how the reverse mapping picks one of the possible preimages.
+func xSwiftECInv(x, u *big.Int, c int) *big.Int {
+	var v, s *big.Int
+	if c&2 == 0 {
+		// The first candidate is only selected when the encoded x is
+		// the first candidate on the curve.
+		negXU := fieldMod(new(big.Int).Neg(new(big.Int).Add(x, u)))
+		if fieldIsSquare(curveRHS(negXU)) {
+			return nil
+		}
+		v = x
+
+		// s = -(u^3 + 7) / (u^2 + uv + v^2)
+		denom := new(big.Int).Mul(u, u)
+		denom.Add(denom, new(big.Int).Mul(u, v))
+		denom.Add(denom, new(big.Int).Mul(v, v))
+		fieldMod(denom)
+		s = new(big.Int).Neg(curveRHS(u))
+		s.Mul(s, fieldInv(denom))
+		fieldMod(s)
+	} else {
+		s = fieldMod(new(big.Int).Sub(x, u))
+		if s.Sign() == 0 {
+			return nil
+		}
+
+		// r = sqrt(-s * (4(u^3 + 7) + 3su^2))
+		r := new(big.Int).Lsh(curveRHS(u), 2)
+		r.Add(r, new(big.Int).Mul(big.NewInt(3), new(big.Int).Mul(s,
+			new(big.Int).Mul(u, u))))
+		r.Mul(r, new(big.Int).Neg(s))
+		r = fieldSqrt(fieldMod(r))
+		if r == nil {
+			return nil
+		}
+		if c&1 == 1 && r.Sign() == 0 {
+			return nil
+		}
+
+		// v = (r/s - u) / 2
+		v = new(big.Int).Mul(r, fieldInv(s))
+		v.Sub(v, u)
+		v.Mul(v, fieldInv(big.NewInt(2)))
+		fieldMod(v)
+	}
+
+	w := fieldSqrt(s)
+	if w == nil {
+		return nil
+	}
+
+	// The result is w * (u * (1 -/+ c) / 2 + v) with the sign of w and c
+	// selected by the case.
+	half := fieldInv(big.NewInt(2))
+	factor := big.NewInt(1)
+	if c&1 == 0 {
+		factor.Sub(factor, ellswiftC)
+	} else {
+		factor.Add(factor, ellswiftC)
+	}
+	t := new(big.Int).Mul(u, factor)
+	t.Mul(t, half)
+	t.Add(t, v)
+	t.Mul(t, w)
+	if c&5 == 0 || c&5 == 5 {
+		t.Neg(t)
+	}
+	return fieldMod(t)
+}
+
+// randFieldElement returns a uniformly random non-zero field element read from
+// the passed reader.
+func randFieldElement(r io.Reader) (*big.Int, error) {
+	var buf [32]byte
+	for {
+		if _, err := io.ReadFull(r, buf[:]); err != nil {
+			return nil, err
+		}
+		e := new(big.Int).SetBytes(buf[:])
+		if e.Sign() != 0 && e.Cmp(S256().P) < 0 {
+			return e, nil
+		}
+	}
+}
+
+// EllswiftEncode returns a random ElligatorSwift encoding of the passed public
+// key as defined in BIP0324.  The encoding is indistinguishable from 64
+// uniformly random bytes and decodes to the x coordinate of the key.
+func EllswiftEncode(pubKey *PublicKey) ([EllswiftEncodingLen]byte, error) {
+	var encoding [EllswiftEncodingLen]byte
+	x := pubKey.X
+	var caseByte [1]byte
+	for i := 0; i < 1000; i++ {
+		u, err := randFieldElement(rand.Reader)
+		if err != nil {
+			return encoding, err
+		}
+		if _, err := rand.Read(caseByte[:]); err != nil {
+			return encoding, err
+		}
+		t := xSwiftECInv(x, u, int(caseByte[0]&7))
+		if t == nil {
+			continue
+		}
+
+		b := paddedAppend(32, nil, u.Bytes())
+		b = paddedAppend(32, b, t.Bytes())
+		copy(encoding[:], b)
+		return encoding, nil
+	}
+	return encoding, errEllswiftEncoding
+}
+
+// EllswiftDecode returns the public key with an even y coordinate whose x
+// coordinate is encoded by the passed ElligatorSwift encoding.  Every 64 byte
+// string is a valid encoding.
+func EllswiftDecode(encoding [EllswiftEncodingLen]byte) *PublicKey {
+	u := new(big.Int).SetBytes(encoding[:32])
+	t := new(big.Int).SetBytes(encoding[32:])
+	x := xSwiftEC(u, t)
+	y := fieldSqrt(curveRHS(x))
+	if isOdd(y) {
+		y.Sub(S256().P, y)
+	}
+	return &PublicKey{Curve: S256(), X: x, Y: y}
+}
+
+// EllswiftECDH returns the x coordinate of the shared point of the passed
+// private key and the public key encoded by the passed ElligatorSwift
+// encoding as a 32 byte big-endian number.
+func EllswiftECDH(privKey *PrivateKey,
+	encoding [EllswiftEncodingLen]byte) [32]byte {
+
+	var secret [32]byte
+	pubKey := EllswiftDecode(encoding)
+	x, _ := S256().ScalarMult(pubKey.X, pubKey.Y, privKey.D.Bytes())
+	copy(secret[:], paddedAppend(32, nil, x.Bytes()))
+	return secret
+}
@@ -44,6 +44,17 @@ func NewNodeCmd(subCmd NodeSubCmd, target string, connectSubCmd *string) *NodeCm
 	}
 }
 
+// CompactDBCmd defines the compactdb JSON-RPC command.  This command is not a
+// standard Bitcoin command.  It is an extension for btcd.
+type CompactDBCmd struct{}
+
+// NewCompactDBCmd returns a new CompactDBCmd which can be used to issue a
+// compactdb JSON-RPC command.  This command is not a standard Bitcoin command.
+// It is an extension for btcd.
+func NewCompactDBCmd() *CompactDBCmd {
+	return &CompactDBCmd{}
+}
+
 // DebugLevelCmd defines the debuglevel JSON-RPC command.  This command is not a
 // standard Bitcoin command.  It is an extension for btcd.
 type DebugLevelCmd struct {
@@ -98,6 +109,26 @@ func NewGetBestBlockCmd() *GetBestBlockCmd {
 	return &GetBestBlockCmd{}
 }
 
+// GetBlockStatsRangeCmd defines the getblockstatsrange JSON-RPC command.
+type GetBlockStatsRangeCmd struct {
+	StartHeight int32
+	EndHeight   int32
+	Stats       *[]string
+}
+
+// NewGetBlockStatsRangeCmd returns a new instance which can be used to issue a
+// getblockstatsrange JSON-RPC command.
+//
+// The parameters which are pointers indicate they are optional.  Passing nil
+// for optional parameters will use the default value.
+func NewGetBlockStatsRangeCmd(startHeight, endHeight int32, stats *[]string) *GetBlockStatsRangeCmd {
+	return &GetBlockStatsRangeCmd{
+		StartHeight: startHeight,
+		EndHeight:   endHeight,
+		Stats:       stats,
+	}
+}
+
 // GetCurrentNetCmd defines the getcurrentnet JSON-RPC command.
 type GetCurrentNetCmd struct{}
 
@@ -145,11 +176,13 @@ func init() {
 	// No special flags for commands in this file.
 	flags := UsageFlag(0)
 
+	MustRegisterCmd("compactdb", (*CompactDBCmd)(nil), flags)
 	MustRegisterCmd("debuglevel", (*DebugLevelCmd)(nil), flags)
 	MustRegisterCmd("node", (*NodeCmd)(nil), flags)
 	MustRegisterCmd("generate", (*GenerateCmd)(nil), flags)
 	MustRegisterCmd("generatetoaddress", (*GenerateToAddressCmd)(nil), flags)
 	MustRegisterCmd("getbestblock", (*GetBestBlockCmd)(nil), flags)
+	MustRegisterCmd("getblockstatsrange", (*GetBlockStatsRangeCmd)(nil), flags)
 	MustRegisterCmd("getcurrentnet", (*GetCurrentNetCmd)(nil), flags)
 	MustRegisterCmd("getheaders", (*GetHeadersCmd)(nil), flags)
 	MustRegisterCmd("version", (*VersionCmd)(nil), flags)
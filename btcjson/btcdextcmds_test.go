@@ -30,6 +30,17 @@ func TestBtcdExtCmds(t *testing.T) {
 		marshalled   string
 		unmarshalled interface{}
 	}{
+		{
+			name: "compactdb",
+			newCmd: func() (interface{}, error) {
+				return btcjson.NewCmd("compactdb")
+			},
+			staticCmd: func() interface{} {
+				return btcjson.NewCompactDBCmd()
+			},
+			marshalled:   `{"jsonrpc":"1.0","method":"compactdb","params":[],"id":1}`,
+			unmarshalled: &btcjson.CompactDBCmd{},
+		},
 		{
 			name: "debuglevel",
 			newCmd: func() (interface{}, error) {
@@ -143,6 +154,37 @@ func TestBtcdExtCmds(t *testing.T) {
 			marshalled:   `{"jsonrpc":"1.0","method":"getbestblock","params":[],"id":1}`,
 			unmarshalled: &btcjson.GetBestBlockCmd{},
 		},
+		{
+			name: "getblockstatsrange",
+			newCmd: func() (interface{}, error) {
+				return btcjson.NewCmd("getblockstatsrange", 100, 200)
+			},
+			staticCmd: func() interface{} {
+				return btcjson.NewGetBlockStatsRangeCmd(100, 200, nil)
+			},
+			marshalled: `{"jsonrpc":"1.0","method":"getblockstatsrange","params":[100,200],"id":1}`,
+			unmarshalled: &btcjson.GetBlockStatsRangeCmd{
+				StartHeight: 100,
+				EndHeight:   200,
+			},
+		},
+		{
+			name: "getblockstatsrange optional stats",
+			newCmd: func() (interface{}, error) {
+				return btcjson.NewCmd("getblockstatsrange", 100, 200,
+					[]string{"totalfee", "height"})
+			},
+			staticCmd: func() interface{} {
+				return btcjson.NewGetBlockStatsRangeCmd(100, 200,
+					&[]string{"totalfee", "height"})
+			},
+			marshalled: `{"jsonrpc":"1.0","method":"getblockstatsrange","params":[100,200,["totalfee","height"]],"id":1}`,
+			unmarshalled: &btcjson.GetBlockStatsRangeCmd{
+				StartHeight: 100,
+				EndHeight:   200,
+				Stats:       &[]string{"totalfee", "height"},
+			},
+		},
 		{
 			name: "getcurrentnet",
 			newCmd: func() (interface{}, error) {
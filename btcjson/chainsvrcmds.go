@@ -184,6 +184,65 @@ func NewGetAddedNodeInfoCmd(dns bool, node *string) *GetAddedNodeInfoCmd {
 	}
 }
 
+// GetAddressBalanceCmd defines the getaddressbalance JSON-RPC command.
+type GetAddressBalanceCmd struct {
+	Addresses []string
+}
+
+// NewGetAddressBalanceCmd returns a new instance which can be used to issue a
+// getaddressbalance JSON-RPC command.
+func NewGetAddressBalanceCmd(addresses []string) *GetAddressBalanceCmd {
+	return &GetAddressBalanceCmd{
+		Addresses: addresses,
+	}
+}
+
+// GetAddressDeltasCmd defines the getaddressdeltas JSON-RPC command.
+type GetAddressDeltasCmd struct {
+	Addresses []string
+	Start     *int32
+	End       *int32
+}
+
+// NewGetAddressDeltasCmd returns a new instance which can be used to issue a
+// getaddressdeltas JSON-RPC command.
+//
+// The parameters which are pointers indicate they are optional.  Passing nil
+// for optional parameters will use the default value.
+func NewGetAddressDeltasCmd(addresses []string, start, end *int32) *GetAddressDeltasCmd {
+	return &GetAddressDeltasCmd{
+		Addresses: addresses,
+		Start:     start,
+		End:       end,
+	}
+}
+
+// GetAddressMempoolCmd defines the getaddressmempool JSON-RPC command.
+type GetAddressMempoolCmd struct {
+	Addresses []string
+}
+
+// NewGetAddressMempoolCmd returns a new instance which can be used to issue a
+// getaddressmempool JSON-RPC command.
+func NewGetAddressMempoolCmd(addresses []string) *GetAddressMempoolCmd {
+	return &GetAddressMempoolCmd{
+		Addresses: addresses,
+	}
+}
+
+// GetAddressUtxosCmd defines the getaddressutxos JSON-RPC command.
+type GetAddressUtxosCmd struct {
+	Addresses []string
+}
+
+// NewGetAddressUtxosCmd returns a new instance which can be used to issue a
+// getaddressutxos JSON-RPC command.
+func NewGetAddressUtxosCmd(addresses []string) *GetAddressUtxosCmd {
+	return &GetAddressUtxosCmd{
+		Addresses: addresses,
+	}
+}
+
 // GetBestBlockHashCmd defines the getbestblockhash JSON-RPC command.
 type GetBestBlockHashCmd struct{}
 
@@ -665,6 +724,21 @@ func NewGetRawTransactionCmd(txHash string, verbose *int) *GetRawTransactionCmd
 	}
 }
 
+// GetSpentInfoCmd defines the getspentinfo JSON-RPC command.
+type GetSpentInfoCmd struct {
+	TxID  string
+	Index uint32
+}
+
+// NewGetSpentInfoCmd returns a new instance which can be used to issue a
+// getspentinfo JSON-RPC command.
+func NewGetSpentInfoCmd(txID string, index uint32) *GetSpentInfoCmd {
+	return &GetSpentInfoCmd{
+		TxID:  txID,
+		Index: index,
+	}
+}
+
 // GetTxOutCmd defines the gettxout JSON-RPC command.
 type GetTxOutCmd struct {
 	Txid           string
@@ -792,6 +866,75 @@ func NewReconsiderBlockCmd(blockHash string) *ReconsiderBlockCmd {
 	}
 }
 
+// ScanTxOutSetAction defines the actions of the scantxoutset JSON-RPC command.
+type ScanTxOutSetAction string
+
+const (
+	// ScanTxOutSetStart starts a scan of the UTXO set.
+	ScanTxOutSetStart ScanTxOutSetAction = "start"
+
+	// ScanTxOutSetAbort aborts the scan in progress.
+	ScanTxOutSetAbort ScanTxOutSetAction = "abort"
+
+	// ScanTxOutSetStatus returns the progress of the scan in progress.
+	ScanTxOutSetStatus ScanTxOutSetAction = "status"
+)
+
+// ScanObject describes an output descriptor to scan the UTXO set for.  The
+// Range of ranged descriptors defaults to [0,1000] when not specified.
+type ScanObject struct {
+	Descriptor string           `json:"desc"`
+	Range      *DescriptorRange `json:"range,omitempty"`
+}
+
+// MarshalJSON implements the json.Marshaler interface for ScanObject.  Scan
+// objects without range are marshalled as plain descriptor strings.
+func (o ScanObject) MarshalJSON() ([]byte, error) {
+	if o.Range == nil {
+		return json.Marshal(o.Descriptor)
+	}
+
+	// Marshal an alias without the MarshalJSON method to avoid recursion.
+	type scanObject ScanObject
+	return json.Marshal(scanObject(o))
+}
+
+// UnmarshalJSON implements the json.Unmarshaler interface for ScanObject,
+// accepting both plain descriptor strings and objects.
+func (o *ScanObject) UnmarshalJSON(data []byte) error {
+	var desc string
+	if err := json.Unmarshal(data, &desc); err == nil {
+		*o = ScanObject{Descriptor: desc}
+		return nil
+	}
+
+	type scanObject ScanObject
+	var obj scanObject
+	if err := json.Unmarshal(data, &obj); err != nil {
+		return err
+	}
+	*o = ScanObject(obj)
+	return nil
+}
+
+// ScanTxOutSetCmd defines the scantxoutset JSON-RPC command.
+type ScanTxOutSetCmd struct {
+	Action      ScanTxOutSetAction
+	ScanObjects *[]ScanObject
+}
+
+// NewScanTxOutSetCmd returns a new instance which can be used to issue a
+// scantxoutset JSON-RPC command.
+//
+// The parameters which are pointers indicate they are optional.  Passing nil
+// for optional parameters will use the default value.
+func NewScanTxOutSetCmd(action ScanTxOutSetAction, scanObjects *[]ScanObject) *ScanTxOutSetCmd {
+	return &ScanTxOutSetCmd{
+		Action:      action,
+		ScanObjects: scanObjects,
+	}
+}
+
 // SearchRawTransactionsCmd defines the searchrawtransactions JSON-RPC command.
 type SearchRawTransactionsCmd struct {
 	Address     string
@@ -1053,6 +1196,10 @@ func init() {
 	MustRegisterCmd("deriveaddresses", (*DeriveAddressesCmd)(nil), flags)
 	MustRegisterCmd("fundrawtransaction", (*FundRawTransactionCmd)(nil), flags)
 	MustRegisterCmd("getaddednodeinfo", (*GetAddedNodeInfoCmd)(nil), flags)
+	MustRegisterCmd("getaddressbalance", (*GetAddressBalanceCmd)(nil), flags)
+	MustRegisterCmd("getaddressdeltas", (*GetAddressDeltasCmd)(nil), flags)
+	MustRegisterCmd("getaddressmempool", (*GetAddressMempoolCmd)(nil), flags)
+	MustRegisterCmd("getaddressutxos", (*GetAddressUtxosCmd)(nil), flags)
 	MustRegisterCmd("getbestblockhash", (*GetBestBlockHashCmd)(nil), flags)
 	MustRegisterCmd("getblock", (*GetBlockCmd)(nil), flags)
 	MustRegisterCmd("getblockchaininfo", (*GetBlockChainInfoCmd)(nil), flags)
@@ -1082,6 +1229,7 @@ func init() {
 	MustRegisterCmd("getpeerinfo", (*GetPeerInfoCmd)(nil), flags)
 	MustRegisterCmd("getrawmempool", (*GetRawMempoolCmd)(nil), flags)
 	MustRegisterCmd("getrawtransaction", (*GetRawTransactionCmd)(nil), flags)
+	MustRegisterCmd("getspentinfo", (*GetSpentInfoCmd)(nil), flags)
 	MustRegisterCmd("gettxout", (*GetTxOutCmd)(nil), flags)
 	MustRegisterCmd("gettxoutproof", (*GetTxOutProofCmd)(nil), flags)
 	MustRegisterCmd("gettxoutsetinfo", (*GetTxOutSetInfoCmd)(nil), flags)
@@ -1091,6 +1239,7 @@ func init() {
 	MustRegisterCmd("ping", (*PingCmd)(nil), flags)
 	MustRegisterCmd("preciousblock", (*PreciousBlockCmd)(nil), flags)
 	MustRegisterCmd("reconsiderblock", (*ReconsiderBlockCmd)(nil), flags)
+	MustRegisterCmd("scantxoutset", (*ScanTxOutSetCmd)(nil), flags)
 	MustRegisterCmd("searchrawtransactions", (*SearchRawTransactionsCmd)(nil), flags)
 	MustRegisterCmd("sendrawtransaction", (*SendRawTransactionCmd)(nil), flags)
 	MustRegisterCmd("setgenerate", (*SetGenerateCmd)(nil), flags)
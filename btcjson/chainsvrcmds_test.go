@@ -290,6 +290,74 @@ func TestChainSvrCmds(t *testing.T) {
 				Node: btcjson.String("127.0.0.1"),
 			},
 		},
+		{
+			name: "getaddressbalance",
+			newCmd: func() (interface{}, error) {
+				return btcjson.NewCmd("getaddressbalance", []string{"1Address"})
+			},
+			staticCmd: func() interface{} {
+				return btcjson.NewGetAddressBalanceCmd([]string{"1Address"})
+			},
+			marshalled: `{"jsonrpc":"1.0","method":"getaddressbalance","params":[["1Address"]],"id":1}`,
+			unmarshalled: &btcjson.GetAddressBalanceCmd{
+				Addresses: []string{"1Address"},
+			},
+		},
+		{
+			name: "getaddressdeltas",
+			newCmd: func() (interface{}, error) {
+				return btcjson.NewCmd("getaddressdeltas", []string{"1Address"})
+			},
+			staticCmd: func() interface{} {
+				return btcjson.NewGetAddressDeltasCmd([]string{"1Address"}, nil, nil)
+			},
+			marshalled: `{"jsonrpc":"1.0","method":"getaddressdeltas","params":[["1Address"]],"id":1}`,
+			unmarshalled: &btcjson.GetAddressDeltasCmd{
+				Addresses: []string{"1Address"},
+			},
+		},
+		{
+			name: "getaddressdeltas optional",
+			newCmd: func() (interface{}, error) {
+				return btcjson.NewCmd("getaddressdeltas", []string{"1Address"}, 10, 20)
+			},
+			staticCmd: func() interface{} {
+				return btcjson.NewGetAddressDeltasCmd([]string{"1Address"},
+					btcjson.Int32(10), btcjson.Int32(20))
+			},
+			marshalled: `{"jsonrpc":"1.0","method":"getaddressdeltas","params":[["1Address"],10,20],"id":1}`,
+			unmarshalled: &btcjson.GetAddressDeltasCmd{
+				Addresses: []string{"1Address"},
+				Start:     btcjson.Int32(10),
+				End:       btcjson.Int32(20),
+			},
+		},
+		{
+			name: "getaddressmempool",
+			newCmd: func() (interface{}, error) {
+				return btcjson.NewCmd("getaddressmempool", []string{"1Address"})
+			},
+			staticCmd: func() interface{} {
+				return btcjson.NewGetAddressMempoolCmd([]string{"1Address"})
+			},
+			marshalled: `{"jsonrpc":"1.0","method":"getaddressmempool","params":[["1Address"]],"id":1}`,
+			unmarshalled: &btcjson.GetAddressMempoolCmd{
+				Addresses: []string{"1Address"},
+			},
+		},
+		{
+			name: "getaddressutxos",
+			newCmd: func() (interface{}, error) {
+				return btcjson.NewCmd("getaddressutxos", []string{"1Address"})
+			},
+			staticCmd: func() interface{} {
+				return btcjson.NewGetAddressUtxosCmd([]string{"1Address"})
+			},
+			marshalled: `{"jsonrpc":"1.0","method":"getaddressutxos","params":[["1Address"]],"id":1}`,
+			unmarshalled: &btcjson.GetAddressUtxosCmd{
+				Addresses: []string{"1Address"},
+			},
+		},
 		{
 			name: "getbestblockhash",
 			newCmd: func() (interface{}, error) {
@@ -889,6 +957,20 @@ func TestChainSvrCmds(t *testing.T) {
 				Verbose: btcjson.Int(1),
 			},
 		},
+		{
+			name: "getspentinfo",
+			newCmd: func() (interface{}, error) {
+				return btcjson.NewCmd("getspentinfo", "123", 1)
+			},
+			staticCmd: func() interface{} {
+				return btcjson.NewGetSpentInfoCmd("123", 1)
+			},
+			marshalled: `{"jsonrpc":"1.0","method":"getspentinfo","params":["123",1],"id":1}`,
+			unmarshalled: &btcjson.GetSpentInfoCmd{
+				TxID:  "123",
+				Index: 1,
+			},
+		},
 		{
 			name: "gettxout",
 			newCmd: func() (interface{}, error) {
@@ -1062,6 +1144,47 @@ func TestChainSvrCmds(t *testing.T) {
 				BlockHash: "123",
 			},
 		},
+		{
+			name: "scantxoutset status",
+			newCmd: func() (interface{}, error) {
+				return btcjson.NewCmd("scantxoutset", btcjson.ScanTxOutSetStatus)
+			},
+			staticCmd: func() interface{} {
+				return btcjson.NewScanTxOutSetCmd(btcjson.ScanTxOutSetStatus, nil)
+			},
+			marshalled: `{"jsonrpc":"1.0","method":"scantxoutset","params":["status"],"id":1}`,
+			unmarshalled: &btcjson.ScanTxOutSetCmd{
+				Action: btcjson.ScanTxOutSetStatus,
+			},
+		},
+		{
+			name: "scantxoutset start",
+			newCmd: func() (interface{}, error) {
+				return btcjson.NewCmd("scantxoutset", "start",
+					`["addr(1Address)",{"desc":"wpkh(xpub/0/*)","range":[10,20]}]`)
+			},
+			staticCmd: func() interface{} {
+				return btcjson.NewScanTxOutSetCmd(btcjson.ScanTxOutSetStart,
+					&[]btcjson.ScanObject{
+						{Descriptor: "addr(1Address)"},
+						{
+							Descriptor: "wpkh(xpub/0/*)",
+							Range:      &btcjson.DescriptorRange{Value: []int{10, 20}},
+						},
+					})
+			},
+			marshalled: `{"jsonrpc":"1.0","method":"scantxoutset","params":["start",["addr(1Address)",{"desc":"wpkh(xpub/0/*)","range":[10,20]}]],"id":1}`,
+			unmarshalled: &btcjson.ScanTxOutSetCmd{
+				Action: btcjson.ScanTxOutSetStart,
+				ScanObjects: &[]btcjson.ScanObject{
+					{Descriptor: "addr(1Address)"},
+					{
+						Descriptor: "wpkh(xpub/0/*)",
+						Range:      &btcjson.DescriptorRange{Value: []int{10, 20}},
+					},
+				},
+			},
+		},
 		{
 			name: "searchrawtransactions",
 			newCmd: func() (interface{}, error) {
@@ -57,6 +57,7 @@ type GetBlockStatsResult struct {
 	SegWitTxs          int64   `json:"swtxs"`
 	Subsidy            int64   `json:"subsidy"`
 	Time               int64   `json:"time"`
+	TotalFee           int64   `json:"totalfee"`
 	TotalOut           int64   `json:"total_out"`
 	TotalSize          int64   `json:"total_size"`
 	TotalWeight        int64   `json:"total_weight"`
@@ -159,6 +160,48 @@ type GetAddedNodeInfoResult struct {
 	Addresses *[]GetAddedNodeInfoResultAddr `json:"addresses,omitempty"`
 }
 
+// GetAddressBalanceResult models the data from the getaddressbalance command.
+// All amounts are in satoshis.
+type GetAddressBalanceResult struct {
+	Balance     int64 `json:"balance"`
+	Received    int64 `json:"received"`
+	Unconfirmed int64 `json:"unconfirmed"`
+}
+
+// GetAddressDeltasResult models a balance change returned by the
+// getaddressdeltas command.
+type GetAddressDeltasResult struct {
+	Satoshis   int64  `json:"satoshis"`
+	TxID       string `json:"txid"`
+	Index      uint32 `json:"index"`
+	BlockIndex uint32 `json:"blockindex"`
+	Height     int32  `json:"height"`
+	Address    string `json:"address"`
+}
+
+// GetAddressMempoolResult models a balance change returned by the
+// getaddressmempool command.
+type GetAddressMempoolResult struct {
+	Address   string  `json:"address"`
+	TxID      string  `json:"txid"`
+	Index     uint32  `json:"index"`
+	Satoshis  int64   `json:"satoshis"`
+	Timestamp int64   `json:"timestamp"`
+	PrevTxID  string  `json:"prevtxid,omitempty"`
+	PrevOut   *uint32 `json:"prevout,omitempty"`
+}
+
+// GetAddressUtxosResult models an unspent output returned by the
+// getaddressutxos command.
+type GetAddressUtxosResult struct {
+	Address     string `json:"address"`
+	TxID        string `json:"txid"`
+	OutputIndex uint32 `json:"outputIndex"`
+	Script      string `json:"script"`
+	Satoshis    int64  `json:"satoshis"`
+	Height      int32  `json:"height"`
+}
+
 // SoftForkDescription describes the current state of a soft-fork which was
 // deployed using a super-majority block signalling.
 type SoftForkDescription struct {
@@ -404,6 +447,9 @@ type GetPeerInfoResult struct {
 	BanScore       int32   `json:"banscore"`
 	FeeFilter      int64   `json:"feefilter"`
 	SyncNode       bool    `json:"syncnode"`
+	TransportType  string  `json:"transport_protocol_type"`
+	SessionID      string  `json:"session_id"`
+	ConnectionType string  `json:"connection_type"`
 }
 
 // GetRawMempoolVerboseResult models the data returned from the getrawmempool
@@ -431,6 +477,13 @@ type ScriptPubKeyResult struct {
 	Addresses []string `json:"addresses,omitempty"`
 }
 
+// GetSpentInfoResult models the data from the getspentinfo command.
+type GetSpentInfoResult struct {
+	TxID   string `json:"txid"`
+	Index  uint32 `json:"index"`
+	Height int32  `json:"height"`
+}
+
 // GetTxOutResult models the data from the gettxout command.
 type GetTxOutResult struct {
 	BestBlock     string             `json:"bestblock"`
@@ -722,6 +775,34 @@ type TxRawResult struct {
 	Blocktime     int64  `json:"blocktime,omitempty"`
 }
 
+// ScanTxOutSetUnspent models an unspent output found by the scantxoutset
+// command.
+type ScanTxOutSetUnspent struct {
+	TxID         string  `json:"txid"`
+	Vout         uint32  `json:"vout"`
+	ScriptPubKey string  `json:"scriptPubKey"`
+	Descriptor   string  `json:"desc"`
+	Amount       float64 `json:"amount"`
+	Height       int32   `json:"height"`
+}
+
+// ScanTxOutSetResult models the data from the scantxoutset command when
+// starting a scan.
+type ScanTxOutSetResult struct {
+	Success     bool                  `json:"success"`
+	TxOuts      int64                 `json:"txouts"`
+	Height      int32                 `json:"height"`
+	BestBlock   string                `json:"bestblock"`
+	Unspents    []ScanTxOutSetUnspent `json:"unspents"`
+	TotalAmount float64               `json:"total_amount"`
+}
+
+// ScanTxOutSetStatusResult models the data from the scantxoutset command when
+// requesting the status of a scan in progress.
+type ScanTxOutSetStatusResult struct {
+	Progress float64 `json:"progress"`
+}
+
 // SearchRawTransactionsResult models the data from the searchrawtransaction
 // command.
 type SearchRawTransactionsResult struct {
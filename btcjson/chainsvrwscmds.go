@@ -102,15 +102,24 @@ type OutPoint struct {
 	Index uint32 `json:"index"`
 }
 
+// TxFilterDescriptor describes an output descriptor whose addresses are added
+// to a transaction filter.  Addresses of ranged descriptors are derived until
+// GapLimit consecutive addresses after the last used one are watched.
+type TxFilterDescriptor struct {
+	Descriptor string  `json:"desc"`
+	GapLimit   *uint32 `json:"gaplimit,omitempty"`
+}
+
 // LoadTxFilterCmd defines the loadtxfilter request parameters to load or
 // reload a transaction filter.
 //
 // NOTE: This is a btcd extension ported from github.com/decred/dcrd/dcrjson
 // and requires a websocket connection.
 type LoadTxFilterCmd struct {
-	Reload    bool
-	Addresses []string
-	OutPoints []OutPoint
+	Reload      bool
+	Addresses   []string
+	OutPoints   []OutPoint
+	Descriptors *[]TxFilterDescriptor
 }
 
 // NewLoadTxFilterCmd returns a new instance which can be used to issue a
@@ -210,6 +219,9 @@ func NewRescanCmd(beginBlock string, addresses []string, outPoints []OutPoint, e
 type RescanBlocksCmd struct {
 	// Block hashes as a string array.
 	BlockHashes []string
+
+	// Descriptors to add to the transaction filter before rescanning.
+	Descriptors *[]TxFilterDescriptor
 }
 
 // NewRescanBlocksCmd returns a new instance which can be used to issue a rescan
@@ -221,6 +233,28 @@ func NewRescanBlocksCmd(blockHashes []string) *RescanBlocksCmd {
 	return &RescanBlocksCmd{BlockHashes: blockHashes}
 }
 
+// ResumeNotificationsCmd defines the resumenotifications JSON-RPC command.
+//
+// NOTE: This is a btcd extension and requires a websocket connection.
+type ResumeNotificationsCmd struct {
+	BlockHash string
+	Sequence  *uint64
+}
+
+// NewResumeNotificationsCmd returns a new instance which can be used to issue
+// a resumenotifications JSON-RPC command.
+//
+// The parameters which are pointers indicate they are optional.  Passing nil
+// for optional parameters will use the default value.
+//
+// NOTE: This is a btcd extension and requires a websocket connection.
+func NewResumeNotificationsCmd(blockHash string, sequence *uint64) *ResumeNotificationsCmd {
+	return &ResumeNotificationsCmd{
+		BlockHash: blockHash,
+		Sequence:  sequence,
+	}
+}
+
 func init() {
 	// The commands in this file are only usable by websockets.
 	flags := UFWebsocketOnly
@@ -238,4 +272,5 @@ func init() {
 	MustRegisterCmd("stopnotifyreceived", (*StopNotifyReceivedCmd)(nil), flags)
 	MustRegisterCmd("rescan", (*RescanCmd)(nil), flags)
 	MustRegisterCmd("rescanblocks", (*RescanBlocksCmd)(nil), flags)
+	MustRegisterCmd("resumenotifications", (*ResumeNotificationsCmd)(nil), flags)
 }
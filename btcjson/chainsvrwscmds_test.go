@@ -213,6 +213,32 @@ func TestChainSvrWsCmds(t *testing.T) {
 				OutPoints: []btcjson.OutPoint{{Hash: "0000000000000000000000000000000000000000000000000000000000000123", Index: 0}},
 			},
 		},
+		{
+			name: "loadtxfilter descriptors",
+			newCmd: func() (interface{}, error) {
+				return btcjson.NewCmd("loadtxfilter", true, []string{}, []btcjson.OutPoint{},
+					[]btcjson.TxFilterDescriptor{{Descriptor: "wpkh(xpub/0/*)", GapLimit: btcjson.Uint32(100)}})
+			},
+			staticCmd: func() interface{} {
+				return &btcjson.LoadTxFilterCmd{
+					Reload:    true,
+					Addresses: []string{},
+					OutPoints: []btcjson.OutPoint{},
+					Descriptors: &[]btcjson.TxFilterDescriptor{
+						{Descriptor: "wpkh(xpub/0/*)", GapLimit: btcjson.Uint32(100)},
+					},
+				}
+			},
+			marshalled: `{"jsonrpc":"1.0","method":"loadtxfilter","params":[true,[],[],[{"desc":"wpkh(xpub/0/*)","gaplimit":100}]],"id":1}`,
+			unmarshalled: &btcjson.LoadTxFilterCmd{
+				Reload:    true,
+				Addresses: []string{},
+				OutPoints: []btcjson.OutPoint{},
+				Descriptors: &[]btcjson.TxFilterDescriptor{
+					{Descriptor: "wpkh(xpub/0/*)", GapLimit: btcjson.Uint32(100)},
+				},
+			},
+		},
 		{
 			name: "rescanblocks",
 			newCmd: func() (interface{}, error) {
@@ -227,6 +253,53 @@ func TestChainSvrWsCmds(t *testing.T) {
 				BlockHashes: []string{"0000000000000000000000000000000000000000000000000000000000000123"},
 			},
 		},
+		{
+			name: "rescanblocks descriptors",
+			newCmd: func() (interface{}, error) {
+				return btcjson.NewCmd("rescanblocks", `["0000000000000000000000000000000000000000000000000000000000000123"]`,
+					`[{"desc":"wpkh(xpub/0/*)"}]`)
+			},
+			staticCmd: func() interface{} {
+				return &btcjson.RescanBlocksCmd{
+					BlockHashes: []string{"0000000000000000000000000000000000000000000000000000000000000123"},
+					Descriptors: &[]btcjson.TxFilterDescriptor{{Descriptor: "wpkh(xpub/0/*)"}},
+				}
+			},
+			marshalled: `{"jsonrpc":"1.0","method":"rescanblocks","params":[["0000000000000000000000000000000000000000000000000000000000000123"],[{"desc":"wpkh(xpub/0/*)"}]],"id":1}`,
+			unmarshalled: &btcjson.RescanBlocksCmd{
+				BlockHashes: []string{"0000000000000000000000000000000000000000000000000000000000000123"},
+				Descriptors: &[]btcjson.TxFilterDescriptor{{Descriptor: "wpkh(xpub/0/*)"}},
+			},
+		},
+		{
+			name: "resumenotifications",
+			newCmd: func() (interface{}, error) {
+				return btcjson.NewCmd("resumenotifications", "0000000000000000000000000000000000000000000000000000000000000123")
+			},
+			staticCmd: func() interface{} {
+				return btcjson.NewResumeNotificationsCmd("0000000000000000000000000000000000000000000000000000000000000123", nil)
+			},
+			marshalled: `{"jsonrpc":"1.0","method":"resumenotifications","params":["0000000000000000000000000000000000000000000000000000000000000123"],"id":1}`,
+			unmarshalled: &btcjson.ResumeNotificationsCmd{
+				BlockHash: "0000000000000000000000000000000000000000000000000000000000000123",
+				Sequence:  nil,
+			},
+		},
+		{
+			name: "resumenotifications optional",
+			newCmd: func() (interface{}, error) {
+				return btcjson.NewCmd("resumenotifications", "0000000000000000000000000000000000000000000000000000000000000123", 1600000000000042)
+			},
+			staticCmd: func() interface{} {
+				return btcjson.NewResumeNotificationsCmd("0000000000000000000000000000000000000000000000000000000000000123",
+					btcjson.Uint64(1600000000000042))
+			},
+			marshalled: `{"jsonrpc":"1.0","method":"resumenotifications","params":["0000000000000000000000000000000000000000000000000000000000000123",1600000000000042],"id":1}`,
+			unmarshalled: &btcjson.ResumeNotificationsCmd{
+				BlockHash: "0000000000000000000000000000000000000000000000000000000000000123",
+				Sequence:  btcjson.Uint64(1600000000000042),
+			},
+		},
 	}
 
 	t.Logf("Running %d tests", len(tests))
@@ -19,3 +19,12 @@ type RescannedBlock struct {
 	Hash         string   `json:"hash"`
 	Transactions []string `json:"transactions"`
 }
+
+// ResumeNotificationsResult models the data from the resumenotifications
+// command.
+//
+// NOTE: This is a btcd extension.
+type ResumeNotificationsResult struct {
+	Sequence uint64 `json:"sequence"`
+	Replayed int    `json:"replayed"`
+}
@@ -37,6 +37,31 @@ func makeParams(rt reflect.Type, rv reflect.Value) []interface{} {
 // must be a registered type.  All commands provided by this package are
 // registered by default.
 func MarshalCmd(rpcVersion RPCVersion, id interface{}, cmd interface{}) ([]byte, error) {
+	rawCmd, err := newCmdRequest(rpcVersion, id, cmd)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(rawCmd)
+}
+
+// MarshalCmdWithSequence marshals the passed notification like MarshalCmd with
+// a nil id and adds the passed sequence number to the resulting JSON-RPC object
+// as an additional sequence field.  Clients that are not aware of the field
+// ignore it.
+func MarshalCmdWithSequence(rpcVersion RPCVersion, cmd interface{}, sequence uint64) ([]byte, error) {
+	rawCmd, err := newCmdRequest(rpcVersion, nil, cmd)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(&struct {
+		*Request
+		Sequence uint64 `json:"sequence"`
+	}{rawCmd, sequence})
+}
+
+// newCmdRequest returns a JSON-RPC request object for the passed command.  The
+// provided command type must be a registered type.
+func newCmdRequest(rpcVersion RPCVersion, id interface{}, cmd interface{}) (*Request, error) {
 	// Look up the cmd type and error out if not registered.
 	rt := reflect.TypeOf(cmd)
 	registerLock.RLock()
@@ -59,12 +84,8 @@ func MarshalCmd(rpcVersion RPCVersion, id interface{}, cmd interface{}) ([]byte,
 	// them if they are non-nil.
 	params := makeParams(rt.Elem(), rv.Elem())
 
-	// Generate and marshal the final JSON-RPC request.
-	rawCmd, err := NewRequest(rpcVersion, id, method, params)
-	if err != nil {
-		return nil, err
-	}
-	return json.Marshal(rawCmd)
+	// Generate the final JSON-RPC request.
+	return NewRequest(rpcVersion, id, method, params)
 }
 
 // checkNumParams ensures the supplied number of params is at least the minimum
@@ -475,6 +475,30 @@ func TestMarshalCmd(t *testing.T) {
 	}
 }
 
+// TestMarshalCmdWithSequence tests the MarshalCmdWithSequence function.
+func TestMarshalCmdWithSequence(t *testing.T) {
+	t.Parallel()
+
+	ntfn := btcjson.NewBlockConnectedNtfn("123", 100000, 123456789)
+	bytes, err := btcjson.MarshalCmdWithSequence(btcjson.RpcVersion1, ntfn, 42)
+	if err != nil {
+		t.Fatalf("MarshalCmdWithSequence: unexpected error: %v", err)
+	}
+	expected := `{"jsonrpc":"1.0","method":"blockconnected","params":["123",100000,123456789],"id":null,"sequence":42}`
+	if string(bytes) != expected {
+		t.Fatalf("MarshalCmdWithSequence: got %s, want %s", bytes, expected)
+	}
+
+	// Ensure the sequenced notification is still a valid request.
+	var request btcjson.Request
+	if err := json.Unmarshal(bytes, &request); err != nil {
+		t.Fatalf("Unmarshal: unexpected error: %v", err)
+	}
+	if _, err := btcjson.UnmarshalCmd(&request); err != nil {
+		t.Fatalf("UnmarshalCmd: unexpected error: %v", err)
+	}
+}
+
 // TestMarshalCmdErrors  tests the error paths of the MarshalCmd function.
 func TestMarshalCmdErrors(t *testing.T) {
 	t.Parallel()
@@ -60,6 +60,21 @@ var (
 	}
 )
 
+// These variables are the minimum chain work parameters for each default
+// network.  They are the least work the chain up to the last checkpoint of the
+// network can have, which is that of all of its blocks at the proof-of-work
+// limit.
+var (
+	// mainMinimumChainWork is the minimum chain work of the main network.
+	// It is the work of 2785001 blocks up to height 2785000 at 2^20 each.
+	mainMinimumChainWork = new(big.Int).Lsh(big.NewInt(2785001), 20)
+
+	// testNet3MinimumChainWork is the minimum chain work of the test
+	// network (version 3).  It is the work of 1341001 blocks up to height
+	// 1341000 at 2^24 each.
+	testNet3MinimumChainWork = new(big.Int).Lsh(big.NewInt(1341001), 24)
+)
+
 // Checkpoint identifies a known good point in the block chain.  Using
 // checkpoints allows a few optimizations for old blocks during initial download
 // and also prevents forks from old blocks.
@@ -205,6 +220,14 @@ type Params struct {
 	// Checkpoints ordered from oldest to newest.
 	Checkpoints []Checkpoint
 
+	// MinimumChainWork is the minimum amount of cumulative work a header
+	// chain must have before blocks are downloaded for it during the
+	// initial sync.  It protects against peers feeding long chains of
+	// cheap headers to a syncing node.  Like the checkpoints, it should be
+	// updated with the work of a recent block on every release.  A nil
+	// value disables the check.
+	MinimumChainWork *big.Int
+
 	// These fields are related to voting on consensus rule changes as
 	// defined by BIP0009.
 	//
@@ -285,6 +308,10 @@ var MainNetParams = Params{
 		{2785000, newHashFromStr("00000000000013811b5078b06f3b98aaad29b94f09d047144e473de35f481474")},
 	},
 
+	// Minimum cumulative work of header chains downloaded during the
+	// initial sync.
+	MinimumChainWork: mainMinimumChainWork,
+
 	// Consensus rule change deployments.
 	//
 	// The miner confirmation window is defined as:
@@ -440,6 +467,10 @@ var TestNet3Params = Params{
 		{1341000, newHashFromStr("00000022fb2732f1c237f9d90e5070e57500b19e9c65f51a2fb920b6580fc219")},
 	},
 
+	// Minimum cumulative work of header chains downloaded during the
+	// initial sync.
+	MinimumChainWork: testNet3MinimumChainWork,
+
 	// Consensus rule change deployments.
 	//
 	// The miner confirmation window is defined as:
@@ -12,6 +12,7 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"math/big"
 	"net"
 	"os"
 	"path/filepath"
@@ -26,9 +27,11 @@ import (
 	"github.com/btcsuite/btcd/chaincfg/chainhash"
 	"github.com/btcsuite/btcd/connmgr"
 	"github.com/btcsuite/btcd/database"
+	_ "github.com/btcsuite/btcd/database/bboltdb"
 	_ "github.com/btcsuite/btcd/database/ffldb"
 	"github.com/btcsuite/btcd/mempool"
 	"github.com/btcsuite/btcd/peer"
+	"github.com/btcsuite/btcd/zmqpub"
 	"github.com/btcsuite/btcutil"
 	"github.com/btcsuite/go-socks/socks"
 	flags "github.com/jessevdk/go-flags"
@@ -47,7 +50,10 @@ const (
 	defaultMaxRPCClients         = 10
 	defaultMaxRPCWebsockets      = 25
 	defaultMaxRPCConcurrentReqs  = 20
+	defaultRPCWSQueueSize        = 5000
+	defaultRPCWSJournalSize      = 10000
 	defaultDbType                = "ffldb"
+	defaultVerifyDBSamplePct     = 1
 	defaultFreeTxRelayLimit      = 15.0
 	defaultTrickleInterval       = peer.DefaultTrickleInterval
 	defaultBlockMinSize          = 0
@@ -97,8 +103,10 @@ type config struct {
 	AddCheckpoints       []string      `long:"addcheckpoint" description:"Add a custom checkpoint.  Format: '<height>:<hash>'"`
 	AddPeers             []string      `short:"a" long:"addpeer" description:"Add a peer to connect with at startup"`
 	AddrIndex            bool          `long:"addrindex" description:"Maintain a full address-based transaction index which makes the searchrawtransactions RPC available"`
+	AddrUtxoIndex        bool          `long:"addrutxoindex" description:"Maintain an index of the unspent outputs, balance, and balance changes of every address which makes the getaddressbalance, getaddressutxos, getaddressdeltas, and getaddressmempool RPCs available"`
 	AgentBlacklist       []string      `long:"agentblacklist" description:"A comma separated list of user-agent substrings which will cause grsd to reject any peers whose user-agent contains any of the blacklisted substrings."`
 	AgentWhitelist       []string      `long:"agentwhitelist" description:"A comma separated list of user-agent substrings which will cause grsd to require all peers' user-agents to contain one of the whitelisted substrings. The blacklist is applied before the blacklist, and an empty whitelist will allow all agents that do not fail the blacklist."`
+	ASMap                string        `long:"asmap" description:"Path to an asmap file which maps IP addresses to autonomous system numbers, used to diversify peer connections across network operators"`
 	BanDuration          time.Duration `long:"banduration" description:"How long to ban misbehaving peers.  Valid time units are {s, m, h}.  Minimum 1 second"`
 	BanThreshold         uint32        `long:"banthreshold" description:"Maximum allowed ban score before disconnecting and banning misbehaving peers."`
 	BlockMaxSize         uint32        `long:"blockmaxsize" description:"Maximum block size in bytes to be used when creating a block"`
@@ -107,6 +115,8 @@ type config struct {
 	BlockMinWeight       uint32        `long:"blockminweight" description:"Mininum block weight to be used when creating a block"`
 	BlockPrioritySize    uint32        `long:"blockprioritysize" description:"Size in bytes for high-priority/low-fee transactions when creating a block"`
 	BlocksOnly           bool          `long:"blocksonly" description:"Do not accept transactions from remote peers."`
+	BlockStatsIndex      bool          `long:"blockstatsindex" description:"Maintain an index of aggregate statistics about every block which makes the getblockstats and getblockstatsrange RPCs available"`
+	CompactDB            bool          `long:"compactdb" description:"Compact the database metadata in the background after start up to reclaim disk space (only supported by some database backends)"`
 	ConfigFile           string        `short:"C" long:"configfile" description:"Path to configuration file"`
 	ConnectPeers         []string      `long:"connect" description:"Connect only to the specified peers at startup"`
 	CPUProfile           string        `long:"cpuprofile" description:"Write CPU profile to the specified file"`
@@ -114,15 +124,21 @@ type config struct {
 	DbType               string        `long:"dbtype" description:"Database backend to use for the Block Chain"`
 	DebugLevel           string        `short:"d" long:"debuglevel" description:"Logging level for all subsystems {trace, debug, info, warn, error, critical} -- You may also specify <subsystem>=<level>,<subsystem2>=<level>,... to set the log level for individual subsystems -- Use show to list available subsystems"`
 	DropAddrIndex        bool          `long:"dropaddrindex" description:"Deletes the address-based transaction index from the database on start up and then exits."`
+	DropAddrUtxoIndex    bool          `long:"dropaddrutxoindex" description:"Deletes the address utxo index from the database on start up and then exits."`
+	DropBlockStatsIndex  bool          `long:"dropblockstatsindex" description:"Deletes the block stats index from the database on start up and then exits."`
 	DropCfIndex          bool          `long:"dropcfindex" description:"Deletes the index used for committed filtering (CF) support from the database on start up and then exits."`
+	DropSpendIndex       bool          `long:"dropspendindex" description:"Deletes the spent output index from the database on start up and then exits."`
 	DropTxIndex          bool          `long:"droptxindex" description:"Deletes the hash-based transaction index from the database on start up and then exits."`
 	ExternalIPs          []string      `long:"externalip" description:"Add an ip to the list of local addresses we claim to listen on to peers"`
 	Generate             bool          `long:"generate" description:"Generate (mine) groestlcoins using the CPU"`
 	FreeTxRelayLimit     float64       `long:"limitfreerelay" description:"Limit relay of transactions with no transaction fee to the given amount in thousands of bytes per minute"`
 	Listeners            []string      `long:"listen" description:"Add an interface/port to listen for connections (default all interfaces port: 1331, testnet: 17777)"`
 	LogDir               string        `long:"logdir" description:"Directory to log output."`
+	LogFormat            string        `long:"logformat" description:"Format of the log output {text, json} -- JSON entries carry the subsystem, level and related fields such as the peer address, block hash, RPC method and request ID"`
 	MaxOrphanTxs         int           `long:"maxorphantx" description:"Max number of orphan transactions to keep in memory"`
 	MaxPeers             int           `long:"maxpeers" description:"Max number of inbound and outbound peers"`
+	MetricsListeners     []string      `long:"metricslisten" description:"Add an interface/port to serve Prometheus metrics on at /metrics, e.g. 127.0.0.1:9332 -- NOTE: The port must be specified (default: disabled)"`
+	MinimumChainWork     string        `long:"minimumchainwork" description:"Minimum cumulative work in hex a header chain must have before blocks are downloaded for it during the initial sync (default: network specific, none on regtest and simnet)"`
 	MiningAddrs          []string      `long:"miningaddr" description:"Add the specified payment address to the list of addresses to use for generated blocks -- At least one address is required if the generate option is set"`
 	MinRelayTxFee        float64       `long:"minrelaytxfee" description:"The minimum transaction fee in GRS/kB to be considered a non-zero fee."`
 	DisableBanning       bool          `long:"nobanning" description:"Disable banning of misbehaving peers"`
@@ -130,15 +146,18 @@ type config struct {
 	DisableCheckpoints   bool          `long:"nocheckpoints" description:"Disable built-in checkpoints.  Don't do this unless you know what you're doing."`
 	DisableDNSSeed       bool          `long:"nodnsseed" description:"Disable DNS seeding for peers"`
 	DisableListen        bool          `long:"nolisten" description:"Disable listening for incoming connections -- NOTE: Listening is automatically disabled if the --connect or --proxy options are used without also specifying listen interfaces via --listen"`
+	NoNodeNetwork        bool          `long:"nonodenetwork" description:"Only serve the blocks of the main chain which are at most 288 blocks below the tip and advertise NODE_NETWORK_LIMITED instead of NODE_NETWORK (BIP0159)"`
 	NoOnion              bool          `long:"noonion" description:"Disable connecting to tor hidden services"`
 	NoPeerBloomFilters   bool          `long:"nopeerbloomfilters" description:"Disable bloom filtering support"`
 	NoRelayPriority      bool          `long:"norelaypriority" description:"Do not require free or low-fee transactions to have high priority for relaying"`
+	NoV2Transport        bool          `long:"nov2transport" description:"Disable the encrypted v2 transport protocol (BIP0324) for peer connections"`
 	NoWinService         bool          `long:"nowinservice" description:"Do not start as a background service on Windows -- NOTE: This flag only works on the command line, not in the config file"`
 	DisableRPC           bool          `long:"norpc" description:"Disable built-in RPC server -- NOTE: The RPC server is disabled by default if no rpcuser/rpcpass or rpclimituser/rpclimitpass is specified"`
 	DisableTLS           bool          `long:"notls" description:"Disable TLS for the RPC server -- NOTE: This is only allowed if the RPC server is bound to localhost"`
 	OnionProxy           string        `long:"onion" description:"Connect to tor hidden services via SOCKS5 proxy (eg. 127.0.0.1:9050)"`
 	OnionProxyPass       string        `long:"onionpass" default-mask:"-" description:"Password for onion proxy server"`
 	OnionProxyUser       string        `long:"onionuser" description:"Username for onion proxy server"`
+	PrivateBroadcast     bool          `long:"privatebroadcast" description:"Broadcast transactions submitted via RPC only through short-lived Tor connections to random peers and announce them to the connected peers once they are relayed back -- NOTE: This requires a Tor proxy set with --onion or --proxy"`
 	Profile              string        `long:"profile" description:"Enable HTTP profiling on given port -- NOTE port must be between 1024 and 65536"`
 	Proxy                string        `long:"proxy" description:"Connect via SOCKS5 proxy (eg. 127.0.0.1:9050)"`
 	ProxyPass            string        `long:"proxypass" default-mask:"-" description:"Password for proxy server"`
@@ -147,6 +166,8 @@ type config struct {
 	RejectNonStd         bool          `long:"rejectnonstd" description:"Reject non-standard transactions regardless of the default settings for the active network."`
 	RejectReplacement    bool          `long:"rejectreplacement" description:"Reject transactions that attempt to replace existing transactions within the mempool through the Replace-By-Fee (RBF) signaling policy."`
 	RelayNonStd          bool          `long:"relaynonstd" description:"Relay non-standard transactions regardless of the default settings for the active network."`
+	REST                 bool          `long:"rest" description:"Serve the unauthenticated read-only REST interface under /rest/ on the RPC listeners -- NOTE: This requires the RPC server to be enabled"`
+	RPCAuth              []string      `long:"rpcauth" description:"Add a user authenticated with a hashed password in the <user>:<salt>$<hash> format, where hash is the hex encoded HMAC-SHA256 of the password keyed with the salt -- Users are limited to the methods of the limited user unless whitelisted with --rpcwhitelist"`
 	RPCCert              string        `long:"rpccert" description:"File containing the certificate file"`
 	RPCKey               string        `long:"rpckey" description:"File containing the certificate key"`
 	RPCLimitPass         string        `long:"rpclimitpass" default-mask:"-" description:"Password for limited RPC connections"`
@@ -158,25 +179,40 @@ type config struct {
 	RPCQuirks            bool          `long:"rpcquirks" description:"Mirror some JSON-RPC quirks of Groestlcoin Core -- NOTE: Discouraged unless interoperability issues need to be worked around"`
 	RPCPass              string        `short:"P" long:"rpcpass" default-mask:"-" description:"Password for RPC connections"`
 	RPCUser              string        `short:"u" long:"rpcuser" description:"Username for RPC connections"`
+	RPCWSJournalSize     int           `long:"rpcwsjournalsize" description:"Number of recent block and transaction events kept so reconnecting websocket clients can resume their notifications -- 0 disables resuming from a sequence number or block hash"`
+	RPCWSOverflow        string        `long:"rpcwsoverflow" description:"Policy applied when the notification queue of a websocket client is full {disconnect, dropoldest, dropnewest}"`
+	RPCWSQueueSize       int           `long:"rpcwsqueuesize" description:"Max number of notifications queued for a websocket client before the overflow policy applies"`
+	RPCWhitelist         []string      `long:"rpcwhitelist" description:"Set the RPC methods a user may call in the <user>:<method>,<method>,... format -- Use * for all methods and @limited for the methods of the limited user -- The methods of users with multiple whitelists are intersected"`
 	SigCacheMaxSize      uint          `long:"sigcachemaxsize" description:"The maximum number of entries in the signature verification cache"`
 	SimNet               bool          `long:"simnet" description:"Use the simulation test network"`
 	SigNet               bool          `long:"signet" description:"Use the signet test network"`
 	SigNetChallenge      string        `long:"signetchallenge" description:"Connect to a custom signet network defined by this challenge instead of using the global default signet test network -- Can be specified multiple times"`
 	SigNetSeedNode       []string      `long:"signetseednode" description:"Specify a seed node for the signet network instead of using the global default signet network seed nodes"`
+	SpendIndex           bool          `long:"spendindex" description:"Maintain an index of the transaction input that spends every spent output which makes the getspentinfo RPC available"`
 	TestNet3             bool          `long:"testnet" description:"Use the test network"`
 	TorIsolation         bool          `long:"torisolation" description:"Enable Tor stream isolation by randomizing user credentials for each connection."`
-	TrickleInterval      time.Duration `long:"trickleinterval" description:"Minimum time between attempts to send new inventory to a connected peer"`
+	TrickleInterval      time.Duration `long:"trickleinterval" description:"Average time between attempts to send new inventory to an inbound peer, outbound peers use 2/5 of it"`
 	TxIndex              bool          `long:"txindex" description:"Maintain a full hash-based transaction index which makes all transactions available via the getrawtransaction RPC"`
 	UserAgentComments    []string      `long:"uacomment" description:"Comment to add to the user agent -- See BIP 14 for more information."`
 	Upnp                 bool          `long:"upnp" description:"Use UPnP to map our listening port outside of NAT"`
+	VerifyDB             bool          `long:"verifydb" description:"Check the integrity of the block database on start up before the node begins operating"`
+	VerifyDBSamplePct    int           `long:"verifydbsamplepct" description:"Percentage of blocks to fully load and verify when --verifydb is set (0-100); the block index is cross-checked for every block regardless"`
+	ZMQPubHashBlock      string        `long:"zmqpubhashblock" description:"Publish the hash of every connected block to ZMQ subscribers on the given address (e.g. tcp://127.0.0.1:28332)"`
+	ZMQPubHashTx         string        `long:"zmqpubhashtx" description:"Publish the hash of every transaction accepted to the mempool or in a connected or disconnected block to ZMQ subscribers on the given address"`
+	ZMQPubRawBlock       string        `long:"zmqpubrawblock" description:"Publish every connected block to ZMQ subscribers on the given address"`
+	ZMQPubRawTx          string        `long:"zmqpubrawtx" description:"Publish every transaction accepted to the mempool or in a connected or disconnected block to ZMQ subscribers on the given address"`
+	ZMQPubSequence       string        `long:"zmqpubsequence" description:"Publish block connection and disconnection and mempool acceptance events with sequence numbers to ZMQ subscribers on the given address"`
+	ZMQPubHWM            int           `long:"zmqpubhwm" description:"Max number of messages queued for a ZMQ subscriber before further messages are dropped"`
 	ShowVersion          bool          `short:"V" long:"version" description:"Display version information and exit"`
 	Whitelists           []string      `long:"whitelist" description:"Add an IP network or IP that will not be banned. (eg. 192.168.1.0/24 or ::1)"`
 	lookup               func(string) ([]net.IP, error)
 	oniondial            func(string, string, time.Duration) (net.Conn, error)
 	dial                 func(string, string, time.Duration) (net.Conn, error)
+	privateBroadcastDial func(string, string, time.Duration) (net.Conn, error)
 	addCheckpoints       []chaincfg.Checkpoint
 	miningAddrs          []btcutil.Address
 	minRelayTxFee        btcutil.Amount
+	minimumChainWork     *big.Int
 	whitelists           []*net.IPNet
 }
 
@@ -377,6 +413,19 @@ func parseCheckpoints(checkpointStrings []string) ([]chaincfg.Checkpoint, error)
 	return checkpoints, nil
 }
 
+// parseMinimumChainWork parses the hex minimum chain work option.  The minimum
+// chain work of the passed network is returned when the option is not set.
+func parseMinimumChainWork(workString string, params *chaincfg.Params) (*big.Int, error) {
+	if workString == "" {
+		return params.MinimumChainWork, nil
+	}
+	work, ok := new(big.Int).SetString(workString, 16)
+	if !ok || work.Sign() < 0 {
+		return nil, fmt.Errorf("%q is not a valid hex number", workString)
+	}
+	return work, nil
+}
+
 // filesExists reports whether the named file or directory exists.
 func fileExists(name string) bool {
 	if _, err := os.Stat(name); err != nil {
@@ -419,9 +468,15 @@ func loadConfig() (*config, []string, error) {
 		RPCMaxClients:        defaultMaxRPCClients,
 		RPCMaxWebsockets:     defaultMaxRPCWebsockets,
 		RPCMaxConcurrentReqs: defaultMaxRPCConcurrentReqs,
+		RPCWSQueueSize:       defaultRPCWSQueueSize,
+		RPCWSOverflow:        wsOverflowDisconnect,
+		RPCWSJournalSize:     defaultRPCWSJournalSize,
 		DataDir:              defaultDataDir,
 		LogDir:               defaultLogDir,
+		LogFormat:            logFormatText,
 		DbType:               defaultDbType,
+		VerifyDBSamplePct:    defaultVerifyDBSamplePct,
+		ZMQPubHWM:            zmqpub.DefaultHighWaterMark,
 		RPCKey:               defaultRPCKeyFile,
 		RPCCert:              defaultRPCCertFile,
 		MinRelayTxFee:        mempool.DefaultMinRelayTxFee.ToBTC(),
@@ -637,6 +692,10 @@ func loadConfig() (*config, []string, error) {
 	cfg.LogDir = cleanAndExpandPath(cfg.LogDir)
 	cfg.LogDir = filepath.Join(cfg.LogDir, netName(activeNetParams))
 
+	if cfg.ASMap != "" {
+		cfg.ASMap = cleanAndExpandPath(cfg.ASMap)
+	}
+
 	// Special show command to list supported subsystems and exit.
 	if cfg.DebugLevel == "show" {
 		fmt.Println("Supported subsystems", supportedSubsystems())
@@ -647,6 +706,18 @@ func loadConfig() (*config, []string, error) {
 	// logger variables may be used.
 	initLogRotator(filepath.Join(cfg.LogDir, defaultLogFilename))
 
+	// Validate and set the log format.
+	if cfg.LogFormat != logFormatText && cfg.LogFormat != logFormatJSON {
+		str := "%s: The specified log format [%v] is invalid -- " +
+			"supported formats [%s %s]"
+		err := fmt.Errorf(str, funcName, cfg.LogFormat, logFormatText,
+			logFormatJSON)
+		fmt.Fprintln(os.Stderr, err)
+		fmt.Fprintln(os.Stderr, usageMessage)
+		return nil, nil, err
+	}
+	backendLog.SetFormat(cfg.LogFormat)
+
 	// Parse, validate, and set debug log level(s).
 	if err := parseAndSetDebugLevels(cfg.DebugLevel); err != nil {
 		err := fmt.Errorf("%s: %v", funcName, err.Error())
@@ -665,6 +736,38 @@ func loadConfig() (*config, []string, error) {
 		return nil, nil, err
 	}
 
+	// Validate the percentage of blocks to verify.
+	if cfg.VerifyDBSamplePct < 0 || cfg.VerifyDBSamplePct > 100 {
+		str := "%s: The verifydbsamplepct option must be in the range " +
+			"0-100 -- parsed [%d]"
+		err := fmt.Errorf(str, funcName, cfg.VerifyDBSamplePct)
+		fmt.Fprintln(os.Stderr, err)
+		fmt.Fprintln(os.Stderr, usageMessage)
+		return nil, nil, err
+	}
+
+	// Validate the ZMQ high water mark.
+	if cfg.ZMQPubHWM < 1 {
+		str := "%s: The zmqpubhwm option must be greater than 0 " +
+			"-- parsed [%d]"
+		err := fmt.Errorf(str, funcName, cfg.ZMQPubHWM)
+		fmt.Fprintln(os.Stderr, err)
+		fmt.Fprintln(os.Stderr, usageMessage)
+		return nil, nil, err
+	}
+
+	// Validate the metrics listen addresses, which have no default port.
+	for _, addr := range cfg.MetricsListeners {
+		if _, _, err := net.SplitHostPort(addr); err != nil {
+			str := "%s: The metricslisten option must include a " +
+				"port -- parsed [%s]"
+			err := fmt.Errorf(str, funcName, addr)
+			fmt.Fprintln(os.Stderr, err)
+			fmt.Fprintln(os.Stderr, usageMessage)
+			return nil, nil, err
+		}
+	}
+
 	// Validate profile port number
 	if cfg.Profile != "" {
 		profilePort, err := strconv.Atoi(cfg.Profile)
@@ -770,14 +873,35 @@ func loadConfig() (*config, []string, error) {
 
 	// The RPC server is disabled if no username or password is provided.
 	if (cfg.RPCUser == "" || cfg.RPCPass == "") &&
-		(cfg.RPCLimitUser == "" || cfg.RPCLimitPass == "") {
+		(cfg.RPCLimitUser == "" || cfg.RPCLimitPass == "") &&
+		len(cfg.RPCAuth) == 0 {
 		cfg.DisableRPC = true
 	}
 
+	// Validate the users configured with --rpcauth and their whitelists.
+	if !cfg.DisableRPC {
+		if _, err := createRPCUsers(&cfg); err != nil {
+			err := fmt.Errorf("%s: %v", funcName, err)
+			fmt.Fprintln(os.Stderr, err)
+			fmt.Fprintln(os.Stderr, usageMessage)
+			return nil, nil, err
+		}
+	}
+
 	if cfg.DisableRPC {
 		btcdLog.Infof("RPC service is disabled")
 	}
 
+	// The REST interface is served by the RPC server.
+	if cfg.DisableRPC && cfg.REST {
+		str := "%s: the --rest option requires the RPC server to be " +
+			"enabled"
+		err := fmt.Errorf(str, funcName)
+		fmt.Fprintln(os.Stderr, err)
+		fmt.Fprintln(os.Stderr, usageMessage)
+		return nil, nil, err
+	}
+
 	// Default RPC to listen on localhost only.
 	if !cfg.DisableRPC && len(cfg.RPCListeners) == 0 {
 		addrs, err := net.LookupHost("localhost")
@@ -800,6 +924,35 @@ func loadConfig() (*config, []string, error) {
 		return nil, nil, err
 	}
 
+	// Validate the websocket notification queue and journal options.
+	if cfg.RPCWSQueueSize <= 0 {
+		str := "%s: The rpcwsqueuesize option must be greater than 0 " +
+			"-- parsed [%d]"
+		err := fmt.Errorf(str, funcName, cfg.RPCWSQueueSize)
+		fmt.Fprintln(os.Stderr, err)
+		fmt.Fprintln(os.Stderr, usageMessage)
+		return nil, nil, err
+	}
+	switch cfg.RPCWSOverflow {
+	case wsOverflowDisconnect, wsOverflowDropOldest, wsOverflowDropNewest:
+	default:
+		str := "%s: The rpcwsoverflow option must be one of %q, %q or " +
+			"%q -- parsed [%s]"
+		err := fmt.Errorf(str, funcName, wsOverflowDisconnect,
+			wsOverflowDropOldest, wsOverflowDropNewest, cfg.RPCWSOverflow)
+		fmt.Fprintln(os.Stderr, err)
+		fmt.Fprintln(os.Stderr, usageMessage)
+		return nil, nil, err
+	}
+	if cfg.RPCWSJournalSize < 0 {
+		str := "%s: The rpcwsjournalsize option may not be less than 0 " +
+			"-- parsed [%d]"
+		err := fmt.Errorf(str, funcName, cfg.RPCWSJournalSize)
+		fmt.Fprintln(os.Stderr, err)
+		fmt.Fprintln(os.Stderr, usageMessage)
+		return nil, nil, err
+	}
+
 	// Validate the the minrelaytxfee.
 	cfg.minRelayTxFee, err = btcutil.NewAmount(cfg.MinRelayTxFee)
 	if err != nil {
@@ -900,6 +1053,36 @@ func loadConfig() (*config, []string, error) {
 		return nil, nil, err
 	}
 
+	// --addrutxoindex and --dropaddrutxoindex do not mix.
+	if cfg.AddrUtxoIndex && cfg.DropAddrUtxoIndex {
+		err := fmt.Errorf("%s: the --addrutxoindex and "+
+			"--dropaddrutxoindex options may not be activated at "+
+			"the same time", funcName)
+		fmt.Fprintln(os.Stderr, err)
+		fmt.Fprintln(os.Stderr, usageMessage)
+		return nil, nil, err
+	}
+
+	// --spendindex and --dropspendindex do not mix.
+	if cfg.SpendIndex && cfg.DropSpendIndex {
+		err := fmt.Errorf("%s: the --spendindex and --dropspendindex "+
+			"options may not be activated at the same time",
+			funcName)
+		fmt.Fprintln(os.Stderr, err)
+		fmt.Fprintln(os.Stderr, usageMessage)
+		return nil, nil, err
+	}
+
+	// --blockstatsindex and --dropblockstatsindex do not mix.
+	if cfg.BlockStatsIndex && cfg.DropBlockStatsIndex {
+		err := fmt.Errorf("%s: the --blockstatsindex and "+
+			"--dropblockstatsindex options may not be activated at "+
+			"the same time", funcName)
+		fmt.Fprintln(os.Stderr, err)
+		fmt.Fprintln(os.Stderr, usageMessage)
+		return nil, nil, err
+	}
+
 	// --addrindex and --droptxindex do not mix.
 	if cfg.AddrIndex && cfg.DropTxIndex {
 		err := fmt.Errorf("%s: the --addrindex and --droptxindex "+
@@ -1010,6 +1193,17 @@ func loadConfig() (*config, []string, error) {
 		return nil, nil, err
 	}
 
+	// Parse the minimum chain work override.
+	cfg.minimumChainWork, err = parseMinimumChainWork(cfg.MinimumChainWork,
+		activeNetParams.Params)
+	if err != nil {
+		str := "%s: Error parsing minimum chain work: %v"
+		err := fmt.Errorf(str, funcName, err)
+		fmt.Fprintln(os.Stderr, err)
+		fmt.Fprintln(os.Stderr, usageMessage)
+		return nil, nil, err
+	}
+
 	// Tor stream isolation requires either proxy or onion proxy to be set.
 	if cfg.TorIsolation && cfg.Proxy == "" && cfg.OnionProxy == "" {
 		str := "%s: Tor stream isolation requires either proxy or " +
@@ -1116,6 +1310,40 @@ func loadConfig() (*config, []string, error) {
 		cfg.oniondial = cfg.dial
 	}
 
+	// Setup the dial function for private broadcast connections, which
+	// always go through the Tor proxy with stream isolation, so each of
+	// them uses a separate circuit.  The proxy set with --proxy is assumed
+	// to be a Tor proxy unless an onion-specific proxy is set or --noonion
+	// is specified.
+	if cfg.PrivateBroadcast {
+		torProxy := cfg.OnionProxy
+		if torProxy == "" && !cfg.NoOnion {
+			torProxy = cfg.Proxy
+		}
+		if torProxy == "" {
+			str := "%s: private broadcast requires a Tor proxy " +
+				"set with --onion or --proxy"
+			err := fmt.Errorf(str, funcName)
+			fmt.Fprintln(os.Stderr, err)
+			fmt.Fprintln(os.Stderr, usageMessage)
+			return nil, nil, err
+		}
+		if cfg.BlocksOnly {
+			str := "%s: the --privatebroadcast and --blocksonly " +
+				"options may not be used together"
+			err := fmt.Errorf(str, funcName)
+			fmt.Fprintln(os.Stderr, err)
+			fmt.Fprintln(os.Stderr, usageMessage)
+			return nil, nil, err
+		}
+
+		proxy := &socks.Proxy{
+			Addr:         torProxy,
+			TorIsolation: true,
+		}
+		cfg.privateBroadcastDial = proxy.DialTimeout
+	}
+
 	// Specifying --noonion means the onion address dial function results in
 	// an error.
 	if cfg.NoOnion {
@@ -2,11 +2,14 @@ package main
 
 import (
 	"io/ioutil"
+	"math/big"
 	"os"
 	"path/filepath"
 	"regexp"
 	"runtime"
 	"testing"
+
+	"github.com/btcsuite/btcd/chaincfg"
 )
 
 var (
@@ -70,3 +73,57 @@ func TestCreateDefaultConfigFile(t *testing.T) {
 		t.Error("Could not find rpcpass in generated default config file.")
 	}
 }
+
+// TestParseMinimumChainWork ensures the minimum chain work of the network is
+// used unless it is overridden and that only the test networks have none.
+func TestParseMinimumChainWork(t *testing.T) {
+	if chaincfg.MainNetParams.MinimumChainWork == nil {
+		t.Fatal("mainnet has no minimum chain work")
+	}
+	if chaincfg.TestNet3Params.MinimumChainWork == nil {
+		t.Fatal("testnet has no minimum chain work")
+	}
+
+	tests := []struct {
+		name   string
+		option string
+		params *chaincfg.Params
+		want   *big.Int
+	}{{
+		name:   "mainnet default",
+		params: &chaincfg.MainNetParams,
+		want:   chaincfg.MainNetParams.MinimumChainWork,
+	}, {
+		name:   "regtest default",
+		params: &chaincfg.RegressionNetParams,
+	}, {
+		name:   "override",
+		option: "1f00",
+		params: &chaincfg.MainNetParams,
+		want:   big.NewInt(0x1f00),
+	}, {
+		name:   "override regtest",
+		option: "0",
+		params: &chaincfg.RegressionNetParams,
+		want:   new(big.Int),
+	}}
+	for _, test := range tests {
+		work, err := parseMinimumChainWork(test.option, test.params)
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", test.name, err)
+			continue
+		}
+		if (work == nil) != (test.want == nil) ||
+			(work != nil && work.Cmp(test.want) != 0) {
+
+			t.Errorf("%s: got %v, want %v", test.name, work, test.want)
+		}
+	}
+
+	for _, option := range []string{"xyz", "-1"} {
+		_, err := parseMinimumChainWork(option, &chaincfg.MainNetParams)
+		if err == nil {
+			t.Errorf("%q: expected error", option)
+		}
+	}
+}
@@ -7,6 +7,7 @@ package connmgr
 import (
 	"errors"
 	"fmt"
+	"math/rand"
 	"net"
 	"sync"
 	"sync/atomic"
@@ -52,6 +53,38 @@ const (
 	ConnDisconnected
 )
 
+// ConnType represents the type of an outbound connection, which determines
+// what is exchanged with the peer.
+type ConnType uint8
+
+// ConnType can be either full relay, block relay only or feeler.  Full relay
+// connections relay blocks, transactions and addresses, while block relay only
+// connections only relay blocks.  Since block relay only connections reveal
+// neither the transactions nor the addresses known to a node, they are hard to
+// discover for an attacker trying to partition the network.  Feeler
+// connections are short-lived connections which test whether an address is
+// reachable and are not replaced when they are disconnected.
+const (
+	ConnFullRelay ConnType = iota
+	ConnBlockRelayOnly
+	ConnFeeler
+)
+
+// Map of connection types back to their constant names for pretty printing.
+var connTypeStrings = map[ConnType]string{
+	ConnFullRelay:      "outbound-full-relay",
+	ConnBlockRelayOnly: "block-relay-only",
+	ConnFeeler:         "feeler",
+}
+
+// String returns the ConnType in human-readable form.
+func (t ConnType) String() string {
+	if s, ok := connTypeStrings[t]; ok {
+		return s
+	}
+	return fmt.Sprintf("Unknown ConnType (%d)", uint8(t))
+}
+
 // ConnReq is the connection request to a network address. If permanent, the
 // connection will be retried on disconnection.
 type ConnReq struct {
@@ -61,6 +94,11 @@ type ConnReq struct {
 	Addr      net.Addr
 	Permanent bool
 
+	// Type is the type of the connection.  The type of connection requests
+	// made by the connection manager is chosen such that the targeted
+	// number of connections of each type is maintained.
+	Type ConnType
+
 	conn       net.Conn
 	state      ConnState
 	stateMtx   sync.RWMutex
@@ -124,6 +162,17 @@ type Config struct {
 	// maintain. Defaults to 8.
 	TargetOutbound uint32
 
+	// TargetBlockRelayOnly is the number of outbound block relay only
+	// connections to maintain in addition to TargetOutbound.  Defaults to
+	// 0.
+	TargetBlockRelayOnly uint32
+
+	// Anchors are the addresses of the first block relay only connections
+	// made when the connection manager is started, such as those of the
+	// block relay only peers before a restart.  They count towards
+	// TargetBlockRelayOnly and any addresses beyond it are ignored.
+	Anchors []net.Addr
+
 	// RetryDuration is the duration to wait before retrying connection
 	// requests. Defaults to 5s.
 	RetryDuration time.Duration
@@ -142,15 +191,28 @@ type Config struct {
 
 	// Dial connects to the address on the named network. It cannot be nil.
 	Dial func(net.Addr) (net.Conn, error)
+
+	// FeelerInterval is the average interval at which feeler connections
+	// are made once the targeted number of outbound connections is
+	// reached.  The intervals are exponentially distributed, so they can't
+	// be predicted.  Feeler connections are disabled when it is 0 or
+	// GetFeelerAddress is nil.
+	FeelerInterval time.Duration
+
+	// GetFeelerAddress is a way to get an address to test with a feeler
+	// connection.
+	GetFeelerAddress func() (net.Addr, error)
 }
 
 // registerPending is used to register a pending connection attempt. By
 // registering pending connection attempts we allow callers to cancel pending
 // connection attempts before their successful or in the case they're not
-// longer wanted.
+// longer wanted.  The type of connection requests made by the connection
+// manager itself is assigned during the registration.
 type registerPending struct {
-	c    *ConnReq
-	done chan struct{}
+	c          *ConnReq
+	assignType bool
+	done       chan struct{}
 }
 
 // handleConnected is used to queue a successful connection.
@@ -194,6 +256,14 @@ func (cm *ConnManager) handleFailedConn(c *ConnReq) {
 	if atomic.LoadInt32(&cm.stop) != 0 {
 		return
 	}
+
+	// Failed feeler connections are neither retried nor replaced, and
+	// don't indicate a network failure since they are expected to fail
+	// frequently.
+	if c.Type == ConnFeeler {
+		return
+	}
+
 	if c.Permanent {
 		c.retryCount++
 		d := time.Duration(c.retryCount) * cm.cfg.RetryDuration
@@ -219,6 +289,65 @@ func (cm *ConnManager) handleFailedConn(c *ConnReq) {
 	}
 }
 
+// targetConns returns the total number of outbound connections to maintain.
+func (cm *ConnManager) targetConns() uint32 {
+	return cm.cfg.TargetOutbound + cm.cfg.TargetBlockRelayOnly
+}
+
+// nextConnType returns the type of the next connection request made by the
+// connection manager given the pending and established connection requests.
+// Block relay only connections are made until their target is reached.
+func (cm *ConnManager) nextConnType(pending, conns map[uint64]*ConnReq) ConnType {
+	var numBlockRelayOnly uint32
+	for _, reqs := range []map[uint64]*ConnReq{pending, conns} {
+		for _, c := range reqs {
+			if c.Permanent || c.Type != ConnBlockRelayOnly {
+				continue
+			}
+
+			// Requests which failed are replaced by new ones.
+			if state := c.State(); state != ConnPending &&
+				state != ConnEstablished {
+
+				continue
+			}
+			numBlockRelayOnly++
+		}
+	}
+	if numBlockRelayOnly < cm.cfg.TargetBlockRelayOnly {
+		return ConnBlockRelayOnly
+	}
+	return ConnFullRelay
+}
+
+// feelerDelay returns a random delay until the next feeler connection.
+func (cm *ConnManager) feelerDelay() time.Duration {
+	return time.Duration(rand.ExpFloat64() * float64(cm.cfg.FeelerInterval))
+}
+
+// needFeeler returns whether a feeler connection should be made given the
+// established connections, which is the case once the targeted number of
+// outbound connections is reached.
+func (cm *ConnManager) needFeeler(conns map[uint64]*ConnReq) bool {
+	var numOutbound uint32
+	for _, c := range conns {
+		if !c.Permanent && c.Type != ConnFeeler {
+			numOutbound++
+		}
+	}
+	return numOutbound >= cm.targetConns()
+}
+
+// connectFeeler makes a feeler connection to an address to test.
+func (cm *ConnManager) connectFeeler() {
+	addr, err := cm.cfg.GetFeelerAddress()
+	if err != nil {
+		log.Debugf("No feeler address: %v", err)
+		return
+	}
+	cm.Connect(&ConnReq{Addr: addr, Type: ConnFeeler})
+}
+
 // connHandler handles all connection related requests.  It must be run as a
 // goroutine.
 //
@@ -234,16 +363,34 @@ func (cm *ConnManager) connHandler() {
 
 		// conns represents the set of all actively connected peers.
 		conns = make(map[uint64]*ConnReq, cm.cfg.TargetOutbound)
+
+		// feelerTimer fires when the next feeler connection is due.
+		// It is only set when feeler connections are enabled.
+		feelerTimer <-chan time.Time
 	)
+	feelersEnabled := cm.cfg.FeelerInterval > 0 &&
+		cm.cfg.GetFeelerAddress != nil
+	if feelersEnabled {
+		feelerTimer = time.After(cm.feelerDelay())
+	}
 
 out:
 	for {
 		select {
+		case <-feelerTimer:
+			feelerTimer = time.After(cm.feelerDelay())
+			if cm.needFeeler(conns) {
+				go cm.connectFeeler()
+			}
+
 		case req := <-cm.requests:
 			switch msg := req.(type) {
 
 			case registerPending:
 				connReq := msg.c
+				if msg.assignType {
+					connReq.Type = cm.nextConnType(pending, conns)
+				}
 				connReq.updateState(ConnPending)
 				pending[msg.c.id] = connReq
 				close(msg.done)
@@ -322,7 +469,7 @@ out:
 				// re added to the pending map, so that
 				// subsequent processing of connections and
 				// failures do not ignore the request.
-				if uint32(len(conns)) < cm.cfg.TargetOutbound ||
+				if uint32(len(conns)) < cm.targetConns() ||
 					connReq.Permanent {
 
 					connReq.updateState(ConnPending)
@@ -357,7 +504,8 @@ out:
 }
 
 // NewConnReq creates a new connection request and connects to the
-// corresponding address.
+// corresponding address.  The type of the request is chosen such that the
+// targeted number of connections of each type is maintained.
 func (cm *ConnManager) NewConnReq() {
 	if atomic.LoadInt32(&cm.stop) != 0 {
 		return
@@ -375,7 +523,7 @@ func (cm *ConnManager) NewConnReq() {
 	// Remove method.
 	done := make(chan struct{})
 	select {
-	case cm.requests <- registerPending{c, done}:
+	case cm.requests <- registerPending{c, true, done}:
 	case <-cm.quit:
 		return
 	}
@@ -425,7 +573,7 @@ func (cm *ConnManager) Connect(c *ConnReq) {
 		// cancel the connection via the Remove method.
 		done := make(chan struct{})
 		select {
-		case cm.requests <- registerPending{c, done}:
+		case cm.requests <- registerPending{c, false, done}:
 		case <-cm.quit:
 			return
 		}
@@ -526,7 +674,23 @@ func (cm *ConnManager) Start() {
 		}
 	}
 
-	for i := atomic.LoadUint64(&cm.connReqCount); i < uint64(cm.cfg.TargetOutbound); i++ {
+	// Register the connection requests of the anchors before any other
+	// automatic connection request, so they are counted when the types of
+	// the other requests are chosen.
+	for i, addr := range cm.cfg.Anchors {
+		if uint32(i) == cm.cfg.TargetBlockRelayOnly {
+			break
+		}
+
+		c := &ConnReq{Addr: addr, Type: ConnBlockRelayOnly}
+		atomic.StoreUint64(&c.id, atomic.AddUint64(&cm.connReqCount, 1))
+		done := make(chan struct{})
+		cm.requests <- registerPending{c, false, done}
+		<-done
+		go cm.Connect(c)
+	}
+
+	for i := atomic.LoadUint64(&cm.connReqCount); i < uint64(cm.targetConns()); i++ {
 		go cm.NewConnReq()
 	}
 }
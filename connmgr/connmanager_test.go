@@ -216,6 +216,200 @@ func TestTargetOutbound(t *testing.T) {
 	cmgr.Stop()
 }
 
+// TestTargetBlockRelayOnly tests the target number of block relay only
+// connections is maintained in addition to the target number of outbound
+// connections, including when block relay only connections are removed.
+func TestTargetBlockRelayOnly(t *testing.T) {
+	targetOutbound := uint32(4)
+	targetBlockRelayOnly := uint32(2)
+	connected := make(chan *ConnReq)
+	cmgr, err := New(&Config{
+		TargetOutbound:       targetOutbound,
+		TargetBlockRelayOnly: targetBlockRelayOnly,
+		Dial:                 mockDialer,
+		GetNewAddress: func() (net.Addr, error) {
+			return &net.TCPAddr{
+				IP:   net.ParseIP("127.0.0.1"),
+				Port: 18555,
+			}, nil
+		},
+		OnConnection: func(c *ConnReq, conn net.Conn) {
+			connected <- c
+		},
+	})
+	if err != nil {
+		t.Fatalf("New error: %v", err)
+	}
+	cmgr.Start()
+	var blockRelayOnly []*ConnReq
+	for i := uint32(0); i < targetOutbound+targetBlockRelayOnly; i++ {
+		c := <-connected
+		if c.Type == ConnBlockRelayOnly {
+			blockRelayOnly = append(blockRelayOnly, c)
+		}
+	}
+	if uint32(len(blockRelayOnly)) != targetBlockRelayOnly {
+		t.Fatalf("target block relay only: got %d connections, want %d",
+			len(blockRelayOnly), targetBlockRelayOnly)
+	}
+
+	select {
+	case c := <-connected:
+		t.Fatalf("target block relay only: got unexpected connection - "+
+			"%v", c.Addr)
+	case <-time.After(time.Millisecond):
+		break
+	}
+
+	// Removing a block relay only connection and requesting a new one
+	// results in another block relay only connection.
+	cmgr.Remove(blockRelayOnly[0].ID())
+	go cmgr.NewConnReq()
+	c := <-connected
+	if c.Type != ConnBlockRelayOnly {
+		t.Fatalf("target block relay only: got connection type %v, "+
+			"want %v", c.Type, ConnBlockRelayOnly)
+	}
+	cmgr.Stop()
+}
+
+// TestAnchors tests that the anchors are connected to as block relay only
+// connections which count towards the target number of block relay only
+// connections.
+func TestAnchors(t *testing.T) {
+	targetOutbound := uint32(2)
+	targetBlockRelayOnly := uint32(2)
+	anchors := []net.Addr{
+		&net.TCPAddr{IP: net.ParseIP("127.0.0.2"), Port: 18555},
+		&net.TCPAddr{IP: net.ParseIP("127.0.0.3"), Port: 18555},
+		&net.TCPAddr{IP: net.ParseIP("127.0.0.4"), Port: 18555},
+	}
+	connected := make(chan *ConnReq)
+	cmgr, err := New(&Config{
+		TargetOutbound:       targetOutbound,
+		TargetBlockRelayOnly: targetBlockRelayOnly,
+		Anchors:              anchors,
+		Dial:                 mockDialer,
+		GetNewAddress: func() (net.Addr, error) {
+			return &net.TCPAddr{
+				IP:   net.ParseIP("127.0.0.1"),
+				Port: 18555,
+			}, nil
+		},
+		OnConnection: func(c *ConnReq, conn net.Conn) {
+			connected <- c
+		},
+	})
+	if err != nil {
+		t.Fatalf("New error: %v", err)
+	}
+	cmgr.Start()
+	anchorConns := make(map[string]struct{})
+	var numFullRelay uint32
+	for i := uint32(0); i < targetOutbound+targetBlockRelayOnly; i++ {
+		c := <-connected
+		if c.Type != ConnBlockRelayOnly {
+			numFullRelay++
+			continue
+		}
+		anchorConns[c.Addr.String()] = struct{}{}
+	}
+	for _, addr := range anchors[:targetBlockRelayOnly] {
+		if _, ok := anchorConns[addr.String()]; !ok {
+			t.Fatalf("anchors: no block relay only connection to %v",
+				addr)
+		}
+	}
+	if uint32(len(anchorConns)) != targetBlockRelayOnly ||
+		numFullRelay != targetOutbound {
+
+		t.Fatalf("anchors: got %d block relay only and %d full relay "+
+			"connections, want %d and %d", len(anchorConns),
+			numFullRelay, targetBlockRelayOnly, targetOutbound)
+	}
+
+	select {
+	case c := <-connected:
+		t.Fatalf("anchors: got unexpected connection - %v", c.Addr)
+	case <-time.After(time.Millisecond):
+		break
+	}
+	cmgr.Stop()
+}
+
+// TestFeelerConnections tests that feeler connections are made once the
+// targeted number of outbound connections is reached and that they are not
+// replaced when they are disconnected.
+func TestFeelerConnections(t *testing.T) {
+	targetOutbound := uint32(2)
+	connected := make(chan *ConnReq)
+	disconnected := make(chan *ConnReq)
+	feelerAddr := &net.TCPAddr{
+		IP:   net.ParseIP("127.0.0.2"),
+		Port: 18555,
+	}
+	cmgr, err := New(&Config{
+		TargetOutbound: targetOutbound,
+		FeelerInterval: time.Millisecond,
+		Dial:           mockDialer,
+		GetNewAddress: func() (net.Addr, error) {
+			return &net.TCPAddr{
+				IP:   net.ParseIP("127.0.0.1"),
+				Port: 18555,
+			}, nil
+		},
+		GetFeelerAddress: func() (net.Addr, error) {
+			return feelerAddr, nil
+		},
+		OnConnection: func(c *ConnReq, conn net.Conn) {
+			connected <- c
+		},
+		OnDisconnection: func(c *ConnReq) {
+			disconnected <- c
+		},
+	})
+	if err != nil {
+		t.Fatalf("New error: %v", err)
+	}
+	cmgr.Start()
+	var numOutbound uint32
+	var feeler *ConnReq
+	for feeler == nil {
+		c := <-connected
+		if c.Type != ConnFeeler {
+			numOutbound++
+			continue
+		}
+		if numOutbound < targetOutbound {
+			t.Fatalf("feeler connection made with %d outbound "+
+				"connections, want %d", numOutbound, targetOutbound)
+		}
+		if c.Addr.String() != feelerAddr.String() {
+			t.Fatalf("feeler connection: got address %v, want %v",
+				c.Addr, feelerAddr)
+		}
+		feeler = c
+	}
+
+	// Disconnecting the feeler must not result in a replacement outbound
+	// connection.
+	go cmgr.Disconnect(feeler.ID())
+	<-disconnected
+	cmgr.Stop()
+	for {
+		select {
+		case c := <-connected:
+			if c.Type != ConnFeeler {
+				t.Fatalf("feeler connection was replaced by %v "+
+					"connection", c.Type)
+			}
+		case <-disconnected:
+		case <-time.After(10 * time.Millisecond):
+			return
+		}
+	}
+}
+
 // TestRetryPermanent tests that permanent connection requests are retried.
 //
 // We make a permanent connection request using Connect, disconnect it using
@@ -0,0 +1,1362 @@
+// Copyright (c) 2021 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package bboltdb
+
+import (
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/database"
+	"github.com/btcsuite/btcd/wire"
+	"github.com/btcsuite/btcutil"
+	bolt "go.etcd.io/bbolt"
+)
+
+const (
+	// dbFileName is the name of the bbolt file which houses both the
+	// metadata and the blocks.
+	dbFileName = "blocks.bbolt"
+
+	// blockHdrSize is the size of a block header.  This is simply the
+	// constant from wire and is only provided here for convenience since
+	// wire.MaxBlockHeaderPayload is quite long.
+	blockHdrSize = wire.MaxBlockHeaderPayload
+
+	// checksumSize is the number of bytes of the CRC-32 checksum which is
+	// appended to every serialized block.
+	//
+	// The serialized block row format is:
+	//   <serialized block><crc32 checksum>
+	checksumSize = 4
+
+	// initialMmapSize is the initial size of the memory map used by bbolt.
+	// Starting with a reasonably large map avoids frequent remaps while
+	// the database grows during the initial chain download since a remap
+	// must wait for all open read transactions to finish.
+	initialMmapSize = 256 * 1024 * 1024
+
+	// openTimeout is the maximum amount of time to wait to obtain the file
+	// lock on the database file.  The lock is held for as long as the
+	// database is open, so failing to obtain it almost always means
+	// another process is using the database.
+	openTimeout = time.Second
+)
+
+var (
+	// byteOrder is the preferred byte order used through the database.
+	byteOrder = binary.LittleEndian
+
+	// castagnoli houses the Catagnoli polynomial used for CRC-32 checksums.
+	castagnoli = crc32.MakeTable(crc32.Castagnoli)
+
+	// metadataBucketName is the name of the top-level bbolt bucket that
+	// backs the metadata bucket exposed to callers.
+	metadataBucketName = []byte("metadata")
+
+	// blocksBucketName is the name of the internal top-level bbolt bucket
+	// which houses the serialized blocks keyed by their hash.
+	blocksBucketName = []byte("blocks")
+
+	// dbInfoBucketName is the name of the internal top-level bbolt bucket
+	// which houses information about the database itself.
+	dbInfoBucketName = []byte("dbinfo")
+
+	// networkKeyName is the key in the database info bucket used to store
+	// the block network the database was created for.
+	networkKeyName = []byte("network")
+)
+
+// Common error strings.
+const (
+	// errDbNotOpenStr is the text to use for the database.ErrDbNotOpen
+	// error code.
+	errDbNotOpenStr = "database is not open"
+
+	// errTxClosedStr is the text to use for the database.ErrTxClosed error
+	// code.
+	errTxClosedStr = "database tx is closed"
+)
+
+// makeDbErr creates a database.Error given a set of arguments.
+func makeDbErr(c database.ErrorCode, desc string, err error) database.Error {
+	return database.Error{ErrorCode: c, Description: desc, Err: err}
+}
+
+// convertErr converts the passed bbolt error into a database error with an
+// equivalent error code and the passed description.  It also sets the passed
+// error as the underlying error.
+func convertErr(desc string, boltErr error) database.Error {
+	// Use the driver-specific error code by default.  The code below will
+	// update this with the converted error if it's recognized.
+	var code = database.ErrDriverSpecific
+
+	switch boltErr {
+	// Database open/create errors.
+	case bolt.ErrDatabaseNotOpen:
+		code = database.ErrDbNotOpen
+	case bolt.ErrDatabaseOpen, bolt.ErrTimeout:
+		code = database.ErrDbAlreadyOpen
+	case bolt.ErrInvalid, bolt.ErrVersionMismatch:
+		code = database.ErrInvalid
+	case bolt.ErrChecksum:
+		code = database.ErrCorruption
+
+	// Transaction errors.
+	case bolt.ErrTxNotWritable, bolt.ErrDatabaseReadOnly:
+		code = database.ErrTxNotWritable
+	case bolt.ErrTxClosed:
+		code = database.ErrTxClosed
+
+	// Metadata errors.
+	case bolt.ErrBucketNotFound:
+		code = database.ErrBucketNotFound
+	case bolt.ErrBucketExists:
+		code = database.ErrBucketExists
+	case bolt.ErrBucketNameRequired:
+		code = database.ErrBucketNameRequired
+	case bolt.ErrKeyRequired:
+		code = database.ErrKeyRequired
+	case bolt.ErrKeyTooLarge:
+		code = database.ErrKeyTooLarge
+	case bolt.ErrValueTooLarge:
+		code = database.ErrValueTooLarge
+	case bolt.ErrIncompatibleValue:
+		code = database.ErrIncompatibleValue
+	}
+
+	return database.Error{ErrorCode: code, Description: desc, Err: boltErr}
+}
+
+// copySlice returns a copy of the passed slice while preserving the
+// distinction between nil and empty slices.
+//
+// All data handed out by this driver is copied out of the memory map.  The
+// database interface only promises callers that returned data is valid for the
+// life of the transaction, however, unlike the leveldb-backed drivers,
+// accessing a memory-mapped slice after it has been unmapped crashes the
+// process rather than merely returning stale data, so this driver errs on the
+// side of safety.
+func copySlice(slice []byte) []byte {
+	if slice == nil {
+		return nil
+	}
+	ret := make([]byte, len(slice))
+	copy(ret, slice)
+	return ret
+}
+
+// cursor is an internal type used to represent a cursor over key/value pairs
+// and nested buckets of a bucket and implements the database.Cursor interface.
+type cursor struct {
+	bucket     *bucket
+	boltCursor *bolt.Cursor
+
+	// key and value house copies of the key/value pair the cursor is
+	// currently positioned at.  The key is nil when the cursor is
+	// exhausted or has not been positioned yet.
+	key   []byte
+	value []byte
+
+	// deletedKey is set to the key that was most recently removed via
+	// Delete.  It is used to reposition the underlying cursor on the next
+	// movement since bbolt cursors are not guaranteed to move correctly
+	// relative to a deleted item.
+	deletedKey []byte
+}
+
+// Enforce cursor implements the database.Cursor interface.
+var _ database.Cursor = (*cursor)(nil)
+
+// Bucket returns the bucket the cursor was created for.
+//
+// This function is part of the database.Cursor interface implementation.
+func (c *cursor) Bucket() database.Bucket {
+	// Ensure transaction state is valid.
+	if err := c.bucket.tx.checkClosed(); err != nil {
+		return nil
+	}
+
+	return c.bucket
+}
+
+// Delete removes the current key/value pair the cursor is at without
+// invalidating the cursor.
+//
+// Returns the following errors as required by the interface contract:
+//   - ErrIncompatibleValue if attempted when the cursor points to a nested
+//     bucket
+//   - ErrTxNotWritable if attempted against a read-only transaction
+//   - ErrTxClosed if the transaction has already been closed
+//
+// This function is part of the database.Cursor interface implementation.
+func (c *cursor) Delete() error {
+	// Ensure transaction state is valid.
+	if err := c.bucket.tx.checkClosed(); err != nil {
+		return err
+	}
+
+	// Ensure the transaction is writable.
+	if !c.bucket.tx.writable {
+		str := "deleting a value requires a writable database transaction"
+		return makeDbErr(database.ErrTxNotWritable, str, nil)
+	}
+
+	// Error if the cursor is exhausted or the current item was already
+	// deleted.
+	if c.key == nil || c.deletedKey != nil {
+		str := "cursor is exhausted"
+		return makeDbErr(database.ErrIncompatibleValue, str, nil)
+	}
+
+	// Do not allow buckets to be deleted via the cursor.
+	if c.value == nil {
+		str := "buckets may not be deleted from a cursor"
+		return makeDbErr(database.ErrIncompatibleValue, str, nil)
+	}
+
+	if err := c.boltCursor.Delete(); err != nil {
+		str := fmt.Sprintf("failed to delete key %q", c.key)
+		return convertErr(str, err)
+	}
+	c.deletedKey = c.key
+	return nil
+}
+
+// setPosition updates the cursor state from the passed key/value pair which
+// was returned by the underlying bbolt cursor and returns whether or not the
+// pair exists.
+func (c *cursor) setPosition(k, v []byte) bool {
+	c.deletedKey = nil
+	c.key = copySlice(k)
+	c.value = copySlice(v)
+	return c.key != nil
+}
+
+// First positions the cursor at the first key/value pair and returns whether or
+// not the pair exists.
+//
+// This function is part of the database.Cursor interface implementation.
+func (c *cursor) First() bool {
+	// Ensure transaction state is valid.
+	if err := c.bucket.tx.checkClosed(); err != nil {
+		return c.setPosition(nil, nil)
+	}
+
+	return c.setPosition(c.boltCursor.First())
+}
+
+// Last positions the cursor at the last key/value pair and returns whether or
+// not the pair exists.
+//
+// This function is part of the database.Cursor interface implementation.
+func (c *cursor) Last() bool {
+	// Ensure transaction state is valid.
+	if err := c.bucket.tx.checkClosed(); err != nil {
+		return c.setPosition(nil, nil)
+	}
+
+	return c.setPosition(c.boltCursor.Last())
+}
+
+// Next moves the cursor one key/value pair forward and returns whether or not
+// the pair exists.
+//
+// This function is part of the database.Cursor interface implementation.
+func (c *cursor) Next() bool {
+	// Ensure transaction state is valid.
+	if err := c.bucket.tx.checkClosed(); err != nil {
+		return c.setPosition(nil, nil)
+	}
+
+	// When the current item was deleted, seeking to its key positions the
+	// cursor at the item that followed it.
+	if c.deletedKey != nil {
+		return c.setPosition(c.boltCursor.Seek(c.deletedKey))
+	}
+
+	// Nothing to return if cursor is exhausted or not positioned.
+	if c.key == nil {
+		return false
+	}
+
+	return c.setPosition(c.boltCursor.Next())
+}
+
+// Prev moves the cursor one key/value pair backward and returns whether or not
+// the pair exists.
+//
+// This function is part of the database.Cursor interface implementation.
+func (c *cursor) Prev() bool {
+	// Ensure transaction state is valid.
+	if err := c.bucket.tx.checkClosed(); err != nil {
+		return c.setPosition(nil, nil)
+	}
+
+	// When the current item was deleted, seeking to its key positions the
+	// cursor at the item that followed it, so the previous item is the one
+	// before that or the last item when the deleted item was the last one.
+	if c.deletedKey != nil {
+		if k, _ := c.boltCursor.Seek(c.deletedKey); k == nil {
+			return c.setPosition(c.boltCursor.Last())
+		}
+		return c.setPosition(c.boltCursor.Prev())
+	}
+
+	// Nothing to return if cursor is exhausted or not positioned.
+	if c.key == nil {
+		return false
+	}
+
+	return c.setPosition(c.boltCursor.Prev())
+}
+
+// Seek positions the cursor at the first key/value pair that is greater than or
+// equal to the passed seek key.  Returns false if no suitable key was found.
+//
+// This function is part of the database.Cursor interface implementation.
+func (c *cursor) Seek(seek []byte) bool {
+	// Ensure transaction state is valid.
+	if err := c.bucket.tx.checkClosed(); err != nil {
+		return c.setPosition(nil, nil)
+	}
+
+	return c.setPosition(c.boltCursor.Seek(seek))
+}
+
+// Key returns the current key the cursor is pointing to.
+//
+// This function is part of the database.Cursor interface implementation.
+func (c *cursor) Key() []byte {
+	// Ensure transaction state is valid.
+	if err := c.bucket.tx.checkClosed(); err != nil {
+		return nil
+	}
+
+	return c.key
+}
+
+// Value returns the current value the cursor is pointing to.  This will be nil
+// for nested buckets.
+//
+// This function is part of the database.Cursor interface implementation.
+func (c *cursor) Value() []byte {
+	// Ensure transaction state is valid.
+	if err := c.bucket.tx.checkClosed(); err != nil {
+		return nil
+	}
+
+	return c.value
+}
+
+// bucket is an internal type used to represent a collection of key/value pairs
+// and implements the database.Bucket interface.
+type bucket struct {
+	tx         *transaction
+	boltBucket *bolt.Bucket
+}
+
+// Enforce bucket implements the database.Bucket interface.
+var _ database.Bucket = (*bucket)(nil)
+
+// Bucket retrieves a nested bucket with the given key.  Returns nil if
+// the bucket does not exist.
+//
+// This function is part of the database.Bucket interface implementation.
+func (b *bucket) Bucket(key []byte) database.Bucket {
+	// Ensure transaction state is valid.
+	if err := b.tx.checkClosed(); err != nil {
+		return nil
+	}
+
+	childBucket := b.boltBucket.Bucket(key)
+	if childBucket == nil {
+		return nil
+	}
+
+	return &bucket{tx: b.tx, boltBucket: childBucket}
+}
+
+// CreateBucket creates and returns a new nested bucket with the given key.
+//
+// Returns the following errors as required by the interface contract:
+//   - ErrBucketExists if the bucket already exists
+//   - ErrBucketNameRequired if the key is empty
+//   - ErrIncompatibleValue if the key is otherwise invalid for the particular
+//     implementation
+//   - ErrTxNotWritable if attempted against a read-only transaction
+//   - ErrTxClosed if the transaction has already been closed
+//
+// This function is part of the database.Bucket interface implementation.
+func (b *bucket) CreateBucket(key []byte) (database.Bucket, error) {
+	// Ensure transaction state is valid.
+	if err := b.tx.checkClosed(); err != nil {
+		return nil, err
+	}
+
+	// Ensure the transaction is writable.
+	if !b.tx.writable {
+		str := "create bucket requires a writable database transaction"
+		return nil, makeDbErr(database.ErrTxNotWritable, str, nil)
+	}
+
+	// Ensure a key was provided.
+	if len(key) == 0 {
+		str := "create bucket requires a key"
+		return nil, makeDbErr(database.ErrBucketNameRequired, str, nil)
+	}
+
+	childBucket, err := b.boltBucket.CreateBucket(key)
+	if err != nil {
+		str := fmt.Sprintf("failed to create bucket with key %q", key)
+		return nil, convertErr(str, err)
+	}
+	return &bucket{tx: b.tx, boltBucket: childBucket}, nil
+}
+
+// CreateBucketIfNotExists creates and returns a new nested bucket with the
+// given key if it does not already exist.
+//
+// Returns the following errors as required by the interface contract:
+//   - ErrBucketNameRequired if the key is empty
+//   - ErrIncompatibleValue if the key is otherwise invalid for the particular
+//     implementation
+//   - ErrTxNotWritable if attempted against a read-only transaction
+//   - ErrTxClosed if the transaction has already been closed
+//
+// This function is part of the database.Bucket interface implementation.
+func (b *bucket) CreateBucketIfNotExists(key []byte) (database.Bucket, error) {
+	// Ensure transaction state is valid.
+	if err := b.tx.checkClosed(); err != nil {
+		return nil, err
+	}
+
+	// Ensure the transaction is writable.
+	if !b.tx.writable {
+		str := "create bucket requires a writable database transaction"
+		return nil, makeDbErr(database.ErrTxNotWritable, str, nil)
+	}
+
+	// Return existing bucket if it already exists, otherwise create it.
+	if bucket := b.Bucket(key); bucket != nil {
+		return bucket, nil
+	}
+	return b.CreateBucket(key)
+}
+
+// DeleteBucket removes a nested bucket with the given key.
+//
+// Returns the following errors as required by the interface contract:
+//   - ErrBucketNotFound if the specified bucket does not exist
+//   - ErrTxNotWritable if attempted against a read-only transaction
+//   - ErrTxClosed if the transaction has already been closed
+//
+// This function is part of the database.Bucket interface implementation.
+func (b *bucket) DeleteBucket(key []byte) error {
+	// Ensure transaction state is valid.
+	if err := b.tx.checkClosed(); err != nil {
+		return err
+	}
+
+	// Ensure the transaction is writable.
+	if !b.tx.writable {
+		str := "delete bucket requires a writable database transaction"
+		return makeDbErr(database.ErrTxNotWritable, str, nil)
+	}
+
+	// bbolt removes all nested buckets and their keys along with the
+	// bucket itself.
+	if err := b.boltBucket.DeleteBucket(key); err != nil {
+		str := fmt.Sprintf("failed to delete bucket %q", key)
+		return convertErr(str, err)
+	}
+	return nil
+}
+
+// Cursor returns a new cursor, allowing for iteration over the bucket's
+// key/value pairs and nested buckets in forward or backward order.
+//
+// You must seek to a position using the First, Last, or Seek functions before
+// calling the Next, Prev, Key, or Value functions.  Failure to do so will
+// result in the same return values as an exhausted cursor, which is false for
+// the Prev and Next functions and nil for Key and Value functions.
+//
+// This function is part of the database.Bucket interface implementation.
+func (b *bucket) Cursor() database.Cursor {
+	// Ensure transaction state is valid.
+	if err := b.tx.checkClosed(); err != nil {
+		return &cursor{bucket: b}
+	}
+
+	return &cursor{bucket: b, boltCursor: b.boltBucket.Cursor()}
+}
+
+// ForEach invokes the passed function with every key/value pair in the bucket.
+// This does not include nested buckets or the key/value pairs within those
+// nested buckets.
+//
+// WARNING: It is not safe to mutate data while iterating with this method.
+// Doing so may cause the underlying cursor to be invalidated and return
+// unexpected keys and/or values.
+//
+// Returns the following errors as required by the interface contract:
+//   - ErrTxClosed if the transaction has already been closed
+//
+// This function is part of the database.Bucket interface implementation.
+func (b *bucket) ForEach(fn func(k, v []byte) error) error {
+	// Ensure transaction state is valid.
+	if err := b.tx.checkClosed(); err != nil {
+		return err
+	}
+
+	// Invoke the callback for each cursor item that is not a nested
+	// bucket.  Return the error returned from the callback when it is
+	// non-nil.
+	c := b.boltBucket.Cursor()
+	for k, v := c.First(); k != nil; k, v = c.Next() {
+		if v == nil {
+			continue
+		}
+		if err := fn(copySlice(k), copySlice(v)); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// ForEachBucket invokes the passed function with the key of every nested bucket
+// in the current bucket.  This does not include any nested buckets within those
+// nested buckets.
+//
+// WARNING: It is not safe to mutate data while iterating with this method.
+// Doing so may cause the underlying cursor to be invalidated and return
+// unexpected keys.
+//
+// Returns the following errors as required by the interface contract:
+//   - ErrTxClosed if the transaction has already been closed
+//
+// This function is part of the database.Bucket interface implementation.
+func (b *bucket) ForEachBucket(fn func(k []byte) error) error {
+	// Ensure transaction state is valid.
+	if err := b.tx.checkClosed(); err != nil {
+		return err
+	}
+
+	// Invoke the callback for each cursor item that is a nested bucket.
+	// Return the error returned from the callback when it is non-nil.
+	c := b.boltBucket.Cursor()
+	for k, v := c.First(); k != nil; k, v = c.Next() {
+		if v != nil {
+			continue
+		}
+		if err := fn(copySlice(k)); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Writable returns whether or not the bucket is writable.
+//
+// This function is part of the database.Bucket interface implementation.
+func (b *bucket) Writable() bool {
+	return b.tx.writable
+}
+
+// Put saves the specified key/value pair to the bucket.  Keys that do not
+// already exist are added and keys that already exist are overwritten.
+//
+// Returns the following errors as required by the interface contract:
+//   - ErrKeyRequired if the key is empty
+//   - ErrIncompatibleValue if the key is the same as an existing bucket
+//   - ErrTxNotWritable if attempted against a read-only transaction
+//   - ErrTxClosed if the transaction has already been closed
+//
+// This function is part of the database.Bucket interface implementation.
+func (b *bucket) Put(key, value []byte) error {
+	// Ensure transaction state is valid.
+	if err := b.tx.checkClosed(); err != nil {
+		return err
+	}
+
+	// Ensure the transaction is writable.
+	if !b.tx.writable {
+		str := "setting a key requires a writable database transaction"
+		return makeDbErr(database.ErrTxNotWritable, str, nil)
+	}
+
+	// Ensure a key was provided.
+	if len(key) == 0 {
+		str := "put requires a key"
+		return makeDbErr(database.ErrKeyRequired, str, nil)
+	}
+
+	// bbolt uses nil values to identify nested buckets, so store keys
+	// without a value as an empty slice instead.
+	if value == nil {
+		value = []byte{}
+	}
+
+	if err := b.boltBucket.Put(key, value); err != nil {
+		str := fmt.Sprintf("failed to put key %q", key)
+		return convertErr(str, err)
+	}
+	return nil
+}
+
+// Get returns the value for the given key.  Returns nil if the key does not
+// exist in this bucket.  An empty slice is returned for keys that exist but
+// have no value assigned.
+//
+// This function is part of the database.Bucket interface implementation.
+func (b *bucket) Get(key []byte) []byte {
+	// Ensure transaction state is valid.
+	if err := b.tx.checkClosed(); err != nil {
+		return nil
+	}
+
+	// Nothing to return if there is no key.
+	if len(key) == 0 {
+		return nil
+	}
+
+	return copySlice(b.boltBucket.Get(key))
+}
+
+// Delete removes the specified key from the bucket.  Deleting a key that does
+// not exist does not return an error.
+//
+// Returns the following errors as required by the interface contract:
+//   - ErrKeyRequired if the key is empty
+//   - ErrIncompatibleValue if the key is the same as an existing bucket
+//   - ErrTxNotWritable if attempted against a read-only transaction
+//   - ErrTxClosed if the transaction has already been closed
+//
+// This function is part of the database.Bucket interface implementation.
+func (b *bucket) Delete(key []byte) error {
+	// Ensure transaction state is valid.
+	if err := b.tx.checkClosed(); err != nil {
+		return err
+	}
+
+	// Ensure the transaction is writable.
+	if !b.tx.writable {
+		str := "deleting a value requires a writable database transaction"
+		return makeDbErr(database.ErrTxNotWritable, str, nil)
+	}
+
+	// Nothing to do if there is no key.
+	if len(key) == 0 {
+		return nil
+	}
+
+	if err := b.boltBucket.Delete(key); err != nil {
+		str := fmt.Sprintf("failed to delete key %q", key)
+		return convertErr(str, err)
+	}
+	return nil
+}
+
+// transaction represents a database transaction.  It can either be read-only or
+// read-write and implements the database.Tx interface.  The transaction
+// provides a root bucket against which all read and writes occur.
+type transaction struct {
+	managed      bool         // Is the transaction managed?
+	closed       bool         // Is the transaction closed?
+	writable     bool         // Is the transaction writable?
+	db           *db          // DB instance the tx was created from.
+	boltTx       *bolt.Tx     // Underlying bbolt transaction.
+	metaBucket   *bucket      // The root metadata bucket.
+	blocksBucket *bolt.Bucket // The internal block storage bucket.
+}
+
+// Enforce transaction implements the database.Tx interface.
+var _ database.Tx = (*transaction)(nil)
+
+// checkClosed returns an error if the the database or transaction is closed.
+func (tx *transaction) checkClosed() error {
+	// The transaction is no longer valid if it has been closed.
+	if tx.closed {
+		return makeDbErr(database.ErrTxClosed, errTxClosedStr, nil)
+	}
+
+	return nil
+}
+
+// Metadata returns the top-most bucket for all metadata storage.
+//
+// This function is part of the database.Tx interface implementation.
+func (tx *transaction) Metadata() database.Bucket {
+	return tx.metaBucket
+}
+
+// hasBlock returns whether or not a block with the given hash exists.
+func (tx *transaction) hasBlock(hash *chainhash.Hash) bool {
+	return tx.blocksBucket.Get(hash[:]) != nil
+}
+
+// StoreBlock stores the provided block into the database.  There are no checks
+// to ensure the block connects to a previous block, contains double spends, or
+// any additional functionality such as transaction indexing.  It simply stores
+// the block in the database.
+//
+// Returns the following errors as required by the interface contract:
+//   - ErrBlockExists when the block hash already exists
+//   - ErrTxNotWritable if attempted against a read-only transaction
+//   - ErrTxClosed if the transaction has already been closed
+//
+// This function is part of the database.Tx interface implementation.
+func (tx *transaction) StoreBlock(block *btcutil.Block) error {
+	// Ensure transaction state is valid.
+	if err := tx.checkClosed(); err != nil {
+		return err
+	}
+
+	// Ensure the transaction is writable.
+	if !tx.writable {
+		str := "store block requires a writable database transaction"
+		return makeDbErr(database.ErrTxNotWritable, str, nil)
+	}
+
+	// Reject the block if it already exists.
+	blockHash := block.Hash()
+	if tx.hasBlock(blockHash) {
+		str := fmt.Sprintf("block %s already exists", blockHash)
+		return makeDbErr(database.ErrBlockExists, str, nil)
+	}
+
+	blockBytes, err := block.Bytes()
+	if err != nil {
+		str := fmt.Sprintf("failed to get serialized bytes for block %s",
+			blockHash)
+		return makeDbErr(database.ErrDriverSpecific, str, err)
+	}
+
+	// Store the block along with a checksum so corruption can be detected
+	// when it is loaded.
+	blockRow := make([]byte, len(blockBytes)+checksumSize)
+	copy(blockRow, blockBytes)
+	checksum := crc32.Checksum(blockBytes, castagnoli)
+	byteOrder.PutUint32(blockRow[len(blockBytes):], checksum)
+	if err := tx.blocksBucket.Put(blockHash[:], blockRow); err != nil {
+		str := fmt.Sprintf("failed to store block %s", blockHash)
+		return convertErr(str, err)
+	}
+	log.Tracef("Stored block %s", blockHash)
+
+	return nil
+}
+
+// HasBlock returns whether or not a block with the given hash exists in the
+// database.
+//
+// Returns the following errors as required by the interface contract:
+//   - ErrTxClosed if the transaction has already been closed
+//
+// This function is part of the database.Tx interface implementation.
+func (tx *transaction) HasBlock(hash *chainhash.Hash) (bool, error) {
+	// Ensure transaction state is valid.
+	if err := tx.checkClosed(); err != nil {
+		return false, err
+	}
+
+	return tx.hasBlock(hash), nil
+}
+
+// HasBlocks returns whether or not the blocks with the provided hashes
+// exist in the database.
+//
+// Returns the following errors as required by the interface contract:
+//   - ErrTxClosed if the transaction has already been closed
+//
+// This function is part of the database.Tx interface implementation.
+func (tx *transaction) HasBlocks(hashes []chainhash.Hash) ([]bool, error) {
+	// Ensure transaction state is valid.
+	if err := tx.checkClosed(); err != nil {
+		return nil, err
+	}
+
+	results := make([]bool, len(hashes))
+	for i := range hashes {
+		results[i] = tx.hasBlock(&hashes[i])
+	}
+
+	return results, nil
+}
+
+// fetchBlockData returns the serialized block for the provided hash without the
+// trailing checksum.  It will return ErrBlockNotFound if there is no entry and
+// ErrCorruption if the stored entry is too short to hold a block.
+//
+// NOTE: The returned slice points into the memory map and must be copied before
+// being handed to callers.
+func (tx *transaction) fetchBlockData(hash *chainhash.Hash) ([]byte, []byte, error) {
+	blockRow := tx.blocksBucket.Get(hash[:])
+	if blockRow == nil {
+		str := fmt.Sprintf("block %s does not exist", hash)
+		return nil, nil, makeDbErr(database.ErrBlockNotFound, str, nil)
+	}
+	if len(blockRow) < blockHdrSize+checksumSize {
+		str := fmt.Sprintf("corrupt entry for block %s: %d bytes is "+
+			"too short to hold a block", hash, len(blockRow))
+		return nil, nil, makeDbErr(database.ErrCorruption, str, nil)
+	}
+
+	n := len(blockRow) - checksumSize
+	return blockRow[:n], blockRow[n:], nil
+}
+
+// FetchBlockHeader returns the raw serialized bytes for the block header
+// identified by the given hash.  The raw bytes are in the format returned by
+// Serialize on a wire.BlockHeader.
+//
+// Returns the following errors as required by the interface contract:
+//   - ErrBlockNotFound if the requested block hash does not exist
+//   - ErrTxClosed if the transaction has already been closed
+//   - ErrCorruption if the database has somehow become corrupted
+//
+// This function is part of the database.Tx interface implementation.
+func (tx *transaction) FetchBlockHeader(hash *chainhash.Hash) ([]byte, error) {
+	return tx.FetchBlockRegion(&database.BlockRegion{
+		Hash:   hash,
+		Offset: 0,
+		Len:    blockHdrSize,
+	})
+}
+
+// FetchBlockHeaders returns the raw serialized bytes for the block headers
+// identified by the given hashes.  The raw bytes are in the format returned by
+// Serialize on a wire.BlockHeader.
+//
+// Returns the following errors as required by the interface contract:
+//   - ErrBlockNotFound if any of the request block hashes do not exist
+//   - ErrTxClosed if the transaction has already been closed
+//   - ErrCorruption if the database has somehow become corrupted
+//
+// This function is part of the database.Tx interface implementation.
+func (tx *transaction) FetchBlockHeaders(hashes []chainhash.Hash) ([][]byte, error) {
+	regions := make([]database.BlockRegion, len(hashes))
+	for i := range hashes {
+		regions[i].Hash = &hashes[i]
+		regions[i].Offset = 0
+		regions[i].Len = blockHdrSize
+	}
+	return tx.FetchBlockRegions(regions)
+}
+
+// FetchBlock returns the raw serialized bytes for the block identified by the
+// given hash.  The raw bytes are in the format returned by Serialize on a
+// wire.MsgBlock.
+//
+// The checksum stored with the block is verified on every load.
+//
+// Returns the following errors as required by the interface contract:
+//   - ErrBlockNotFound if the requested block hash does not exist
+//   - ErrTxClosed if the transaction has already been closed
+//   - ErrCorruption if the database has somehow become corrupted
+//
+// This function is part of the database.Tx interface implementation.
+func (tx *transaction) FetchBlock(hash *chainhash.Hash) ([]byte, error) {
+	// Ensure transaction state is valid.
+	if err := tx.checkClosed(); err != nil {
+		return nil, err
+	}
+
+	blockBytes, serializedChecksum, err := tx.fetchBlockData(hash)
+	if err != nil {
+		return nil, err
+	}
+
+	// Calculate the checksum of the read data and ensure it matches the
+	// serialized checksum.
+	calculatedChecksum := crc32.Checksum(blockBytes, castagnoli)
+	expectedChecksum := byteOrder.Uint32(serializedChecksum)
+	if calculatedChecksum != expectedChecksum {
+		str := fmt.Sprintf("block data for block %s checksum does not "+
+			"match - got %x, want %x", hash, calculatedChecksum,
+			expectedChecksum)
+		return nil, makeDbErr(database.ErrCorruption, str, nil)
+	}
+
+	return copySlice(blockBytes), nil
+}
+
+// FetchBlocks returns the raw serialized bytes for the blocks identified by the
+// given hashes.  The raw bytes are in the format returned by Serialize on a
+// wire.MsgBlock.
+//
+// Returns the following errors as required by the interface contract:
+//   - ErrBlockNotFound if any of the requested block hashed do not exist
+//   - ErrTxClosed if the transaction has already been closed
+//   - ErrCorruption if the database has somehow become corrupted
+//
+// This function is part of the database.Tx interface implementation.
+func (tx *transaction) FetchBlocks(hashes []chainhash.Hash) ([][]byte, error) {
+	// Ensure transaction state is valid.
+	if err := tx.checkClosed(); err != nil {
+		return nil, err
+	}
+
+	blocks := make([][]byte, len(hashes))
+	for i := range hashes {
+		var err error
+		blocks[i], err = tx.FetchBlock(&hashes[i])
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return blocks, nil
+}
+
+// FetchBlockRegion returns the raw serialized bytes for the given block region.
+//
+// The raw bytes are in the format returned by Serialize on a wire.MsgBlock and
+// the Offset field in the provided BlockRegion is zero-based and relative to
+// the start of the block (byte 0).
+//
+// Returns the following errors as required by the interface contract:
+//   - ErrBlockNotFound if the requested block hash does not exist
+//   - ErrBlockRegionInvalid if the region exceeds the bounds of the associated
+//     block
+//   - ErrTxClosed if the transaction has already been closed
+//   - ErrCorruption if the database has somehow become corrupted
+//
+// This function is part of the database.Tx interface implementation.
+func (tx *transaction) FetchBlockRegion(region *database.BlockRegion) ([]byte, error) {
+	// Ensure transaction state is valid.
+	if err := tx.checkClosed(); err != nil {
+		return nil, err
+	}
+
+	blockBytes, _, err := tx.fetchBlockData(region.Hash)
+	if err != nil {
+		return nil, err
+	}
+
+	// Ensure the region is within the bounds of the block.
+	blockLen := uint32(len(blockBytes))
+	endOffset := region.Offset + region.Len
+	if endOffset < region.Offset || endOffset > blockLen {
+		str := fmt.Sprintf("block %s region offset %d, length %d "+
+			"exceeds block length of %d", region.Hash,
+			region.Offset, region.Len, blockLen)
+		return nil, makeDbErr(database.ErrBlockRegionInvalid, str, nil)
+	}
+
+	return copySlice(blockBytes[region.Offset:endOffset]), nil
+}
+
+// FetchBlockRegions returns the raw serialized bytes for the given block
+// regions.
+//
+// The raw bytes are in the format returned by Serialize on a wire.MsgBlock and
+// the Offset fields in the provided BlockRegions are zero-based and relative to
+// the start of the block (byte 0).
+//
+// Returns the following errors as required by the interface contract:
+//   - ErrBlockNotFound if any of the request block hashes do not exist
+//   - ErrBlockRegionInvalid if one or more region exceed the bounds of the
+//     associated block
+//   - ErrTxClosed if the transaction has already been closed
+//   - ErrCorruption if the database has somehow become corrupted
+//
+// This function is part of the database.Tx interface implementation.
+func (tx *transaction) FetchBlockRegions(regions []database.BlockRegion) ([][]byte, error) {
+	// Ensure transaction state is valid.
+	if err := tx.checkClosed(); err != nil {
+		return nil, err
+	}
+
+	blockRegions := make([][]byte, len(regions))
+	for i := range regions {
+		var err error
+		blockRegions[i], err = tx.FetchBlockRegion(&regions[i])
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return blockRegions, nil
+}
+
+// close marks the transaction closed then releases the underlying bbolt
+// transaction, when it has not already been committed, along with the
+// transaction read lock.
+func (tx *transaction) close() {
+	tx.closed = true
+
+	// The error is ignored here since the only possible error is that the
+	// underlying transaction is already closed.
+	if tx.boltTx != nil {
+		_ = tx.boltTx.Rollback()
+		tx.boltTx = nil
+	}
+
+	tx.db.closeLock.RUnlock()
+}
+
+// Commit commits all changes that have been made to the root metadata bucket
+// and all of its sub-buckets as well as all new blocks to persistent storage.
+//
+// This function is part of the database.Tx interface implementation.
+func (tx *transaction) Commit() error {
+	// Prevent commits on managed transactions.
+	if tx.managed {
+		tx.close()
+		panic("managed transaction commit not allowed")
+	}
+
+	// Ensure transaction state is valid.
+	if err := tx.checkClosed(); err != nil {
+		return err
+	}
+
+	// Regardless of whether the commit succeeds, the transaction is closed
+	// on return.
+	defer tx.close()
+
+	// Ensure the transaction is writable.
+	if !tx.writable {
+		str := "Commit requires a writable database transaction"
+		return makeDbErr(database.ErrTxNotWritable, str, nil)
+	}
+
+	// bbolt automatically rolls the transaction back when the commit
+	// fails, so there is nothing left to release in either case.
+	boltTx := tx.boltTx
+	tx.boltTx = nil
+	if err := boltTx.Commit(); err != nil {
+		return convertErr("failed to commit transaction", err)
+	}
+
+	return nil
+}
+
+// Rollback undoes all changes that have been made to the root bucket and all of
+// its sub-buckets.
+//
+// This function is part of the database.Tx interface implementation.
+func (tx *transaction) Rollback() error {
+	// Prevent rollbacks on managed transactions.
+	if tx.managed {
+		tx.close()
+		panic("managed transaction rollback not allowed")
+	}
+
+	// Ensure transaction state is valid.
+	if err := tx.checkClosed(); err != nil {
+		return err
+	}
+
+	tx.close()
+	return nil
+}
+
+// db represents a collection of namespaces which are persisted and implements
+// the database.DB interface.  All database access is performed through
+// transactions which are obtained through the specific Namespace.
+type db struct {
+	closeLock sync.RWMutex // Make database close block while txns active.
+	closed    bool         // Is the database closed?
+	bdb       *bolt.DB     // Underlying bbolt database.
+}
+
+// Enforce db implements the database.DB interface.
+var _ database.DB = (*db)(nil)
+
+// Type returns the database driver type the current database instance was
+// created with.
+//
+// This function is part of the database.DB interface implementation.
+func (db *db) Type() string {
+	return dbType
+}
+
+// begin is the implementation function for the Begin database method.  See its
+// documentation for more details.
+//
+// This function is only separate because it returns the internal transaction
+// which is used by the managed transaction code while the database method
+// returns the interface.
+func (db *db) begin(writable bool) (*transaction, error) {
+	// Whenever a new transaction is started, grab a read lock against the
+	// database to ensure Close will wait for the transaction to finish.
+	// This lock will not be released until the transaction is closed (via
+	// Rollback or Commit).
+	db.closeLock.RLock()
+	if db.closed {
+		db.closeLock.RUnlock()
+		return nil, makeDbErr(database.ErrDbNotOpen, errDbNotOpenStr,
+			nil)
+	}
+
+	// Start the underlying bbolt transaction.  bbolt itself ensures only a
+	// single write transaction can be active at the same time, so this
+	// will block when a write transaction is requested while another one
+	// is already open.
+	boltTx, err := db.bdb.Begin(writable)
+	if err != nil {
+		db.closeLock.RUnlock()
+		return nil, convertErr("failed to begin transaction", err)
+	}
+
+	tx := &transaction{
+		writable:     writable,
+		db:           db,
+		boltTx:       boltTx,
+		blocksBucket: boltTx.Bucket(blocksBucketName),
+	}
+	tx.metaBucket = &bucket{
+		tx:         tx,
+		boltBucket: boltTx.Bucket(metadataBucketName),
+	}
+	return tx, nil
+}
+
+// Begin starts a transaction which is either read-only or read-write depending
+// on the specified flag.  Multiple read-only transactions can be started
+// simultaneously while only a single read-write transaction can be started at a
+// time.  The call will block when starting a read-write transaction when one is
+// already open.
+//
+// NOTE: The transaction must be closed by calling Rollback or Commit on it when
+// it is no longer needed.  Failure to do so will result in unclaimed memory and
+// prevent the database from growing.
+//
+// This function is part of the database.DB interface implementation.
+func (db *db) Begin(writable bool) (database.Tx, error) {
+	return db.begin(writable)
+}
+
+// rollbackOnPanic rolls the passed transaction back if the code in the calling
+// function panics.  This is needed since the mutex on a transaction must be
+// released and a panic in called code would prevent that from happening.
+//
+// NOTE: This can only be handled manually for managed transactions since they
+// control the life-cycle of the transaction.  As the documentation on Begin
+// calls out, callers opting to use manual transactions will have to ensure the
+// transaction is rolled back on panic if it desires that functionality as well
+// or the database will fail to close since the read-lock will never be
+// released.
+func rollbackOnPanic(tx *transaction) {
+	if err := recover(); err != nil {
+		tx.managed = false
+		_ = tx.Rollback()
+		panic(err)
+	}
+}
+
+// View invokes the passed function in the context of a managed read-only
+// transaction with the root bucket for the namespace.  Any errors returned from
+// the user-supplied function are returned from this function.
+//
+// This function is part of the database.DB interface implementation.
+func (db *db) View(fn func(database.Tx) error) error {
+	// Start a read-only transaction.
+	tx, err := db.begin(false)
+	if err != nil {
+		return err
+	}
+
+	// Since the user-provided function might panic, ensure the transaction
+	// releases all mutexes and resources.  There is no guarantee the caller
+	// won't use recover and keep going.  Thus, the database must still be
+	// in a usable state on panics due to caller issues.
+	defer rollbackOnPanic(tx)
+
+	tx.managed = true
+	err = fn(tx)
+	tx.managed = false
+	if err != nil {
+		// The error is ignored here because nothing was written yet
+		// and regardless of a rollback failure, the tx is closed now
+		// anyways.
+		_ = tx.Rollback()
+		return err
+	}
+
+	return tx.Rollback()
+}
+
+// Update invokes the passed function in the context of a managed read-write
+// transaction with the root bucket for the namespace.  Any errors returned from
+// the user-supplied function will cause the transaction to be rolled back and
+// are returned from this function.  Otherwise, the transaction is committed
+// when the user-supplied function returns a nil error.
+//
+// This function is part of the database.DB interface implementation.
+func (db *db) Update(fn func(database.Tx) error) error {
+	// Start a read-write transaction.
+	tx, err := db.begin(true)
+	if err != nil {
+		return err
+	}
+
+	// Since the user-provided function might panic, ensure the transaction
+	// releases all mutexes and resources.  There is no guarantee the caller
+	// won't use recover and keep going.  Thus, the database must still be
+	// in a usable state on panics due to caller issues.
+	defer rollbackOnPanic(tx)
+
+	tx.managed = true
+	err = fn(tx)
+	tx.managed = false
+	if err != nil {
+		// The error is ignored here because nothing was written yet
+		// and regardless of a rollback failure, the tx is closed now
+		// anyways.
+		_ = tx.Rollback()
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// Close cleanly shuts down the database and syncs all data.  It will block
+// until all database transactions have been finalized (rolled back or
+// committed).
+//
+// This function is part of the database.DB interface implementation.
+func (db *db) Close() error {
+	// Since all transactions have a read lock on this mutex, this will
+	// cause Close to wait for all readers to complete.
+	db.closeLock.Lock()
+	defer db.closeLock.Unlock()
+
+	if db.closed {
+		return makeDbErr(database.ErrDbNotOpen, errDbNotOpenStr, nil)
+	}
+	db.closed = true
+
+	if err := db.bdb.Close(); err != nil {
+		return convertErr("failed to close database", err)
+	}
+	return nil
+}
+
+// filesExists reports whether the named file or directory exists.
+func fileExists(name string) bool {
+	if _, err := os.Stat(name); err != nil {
+		if os.IsNotExist(err) {
+			return false
+		}
+	}
+	return true
+}
+
+// initDB creates the initial buckets and values used by the package.
+func initDB(bdb *bolt.DB, network wire.BitcoinNet) error {
+	err := bdb.Update(func(tx *bolt.Tx) error {
+		for _, name := range [][]byte{metadataBucketName,
+			blocksBucketName, dbInfoBucketName} {
+
+			if _, err := tx.CreateBucket(name); err != nil {
+				return err
+			}
+		}
+
+		var serializedNet [4]byte
+		byteOrder.PutUint32(serializedNet[:], uint32(network))
+		infoBucket := tx.Bucket(dbInfoBucketName)
+		return infoBucket.Put(networkKeyName, serializedNet[:])
+	})
+	if err != nil {
+		str := fmt.Sprintf("failed to initialize database: %v", err)
+		return convertErr(str, err)
+	}
+
+	return nil
+}
+
+// checkDB ensures the internal buckets exist and the database was created for
+// the provided network.
+func checkDB(bdb *bolt.DB, network wire.BitcoinNet) error {
+	return bdb.View(func(tx *bolt.Tx) error {
+		for _, name := range [][]byte{metadataBucketName,
+			blocksBucketName, dbInfoBucketName} {
+
+			if tx.Bucket(name) == nil {
+				str := fmt.Sprintf("internal bucket %q does not "+
+					"exist", name)
+				return makeDbErr(database.ErrCorruption, str, nil)
+			}
+		}
+
+		serializedNet := tx.Bucket(dbInfoBucketName).Get(networkKeyName)
+		if len(serializedNet) != 4 {
+			str := "database network is missing"
+			return makeDbErr(database.ErrCorruption, str, nil)
+		}
+		dbNet := wire.BitcoinNet(byteOrder.Uint32(serializedNet))
+		if dbNet != network {
+			str := fmt.Sprintf("database is for network %v, not %v",
+				dbNet, network)
+			return makeDbErr(database.ErrInvalid, str, nil)
+		}
+
+		return nil
+	})
+}
+
+// openDB opens the database at the provided path.  database.ErrDbDoesNotExist
+// is returned if the database doesn't exist and the create flag is not set.
+func openDB(dbPath string, network wire.BitcoinNet, create bool) (database.DB, error) {
+	// Error if the database doesn't exist and the create flag is not set
+	// or it already exists and the create flag is set.
+	dbFilePath := filepath.Join(dbPath, dbFileName)
+	dbExists := fileExists(dbFilePath)
+	if !create && !dbExists {
+		str := fmt.Sprintf("database %q does not exist", dbFilePath)
+		return nil, makeDbErr(database.ErrDbDoesNotExist, str, nil)
+	}
+	if create && dbExists {
+		str := fmt.Sprintf("database %q already exists", dbFilePath)
+		return nil, makeDbErr(database.ErrDbExists, str, nil)
+	}
+
+	// Ensure the full path to the database exists.
+	if !dbExists {
+		// The error can be ignored here since the call to bolt.Open
+		// will fail if the directory couldn't be created.
+		_ = os.MkdirAll(dbPath, 0700)
+	}
+
+	// Open the database (will create it if needed).  The freelist is not
+	// synced to disk since it can be rebuilt on open and syncing it makes
+	// every commit considerably more expensive for large databases.
+	opts := bolt.Options{
+		Timeout:         openTimeout,
+		NoFreelistSync:  true,
+		FreelistType:    bolt.FreelistMapType,
+		InitialMmapSize: initialMmapSize,
+	}
+	bdb, err := bolt.Open(dbFilePath, 0600, &opts)
+	if err != nil {
+		return nil, convertErr(err.Error(), err)
+	}
+
+	if create {
+		err = initDB(bdb, network)
+	} else {
+		err = checkDB(bdb, network)
+	}
+	if err != nil {
+		_ = bdb.Close()
+		if create {
+			_ = os.Remove(dbFilePath)
+		}
+		return nil, err
+	}
+
+	return &db{bdb: bdb}, nil
+}
@@ -0,0 +1,31 @@
+// Copyright (c) 2021 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+/*
+Package bboltdb implements a driver for the database package that uses bbolt
+for the backing metadata and block storage.
+
+This driver is an alternative to the default ffldb driver.  It stores both the
+metadata and the blocks in a single memory-mapped bbolt file which makes it
+well suited for hosts with fast solid-state storage.  Blocks are stored with a
+checksum which is verified whenever a full block is loaded in order to detect
+corruption.
+
+Usage
+
+This package is a driver to the database package and provides the database type
+of "bboltdb".  The parameters the Open and Create functions take are the
+database path as a string and the block network:
+
+	db, err := database.Open("bboltdb", "path/to/database", wire.MainNet)
+	if err != nil {
+		// Handle error
+	}
+
+	db, err := database.Create("bboltdb", "path/to/database", wire.MainNet)
+	if err != nil {
+		// Handle error
+	}
+*/
+package bboltdb
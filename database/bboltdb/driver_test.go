@@ -0,0 +1,132 @@
+// Copyright (c) 2021 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package bboltdb_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/btcsuite/btcd/database"
+	_ "github.com/btcsuite/btcd/database/bboltdb"
+	"github.com/btcsuite/btcd/database/internal/dbtest"
+	"github.com/btcsuite/btcd/wire"
+)
+
+// dbType is the database type name for this driver.
+const dbType = "bboltdb"
+
+// TestCreateOpenFail ensures that errors related to creating and opening a
+// database are handled properly.
+func TestCreateOpenFail(t *testing.T) {
+	t.Parallel()
+
+	dbtest.TestCreateOpenFail(t, dbType)
+}
+
+// TestPersistence ensures that values stored are still valid after closing and
+// reopening the database.
+func TestPersistence(t *testing.T) {
+	t.Parallel()
+
+	dbtest.TestPersistence(t, dbType)
+}
+
+// TestReopenFail ensures that attempting to create an existing database or to
+// open it for a different network returns the expected errors.
+func TestReopenFail(t *testing.T) {
+	t.Parallel()
+
+	// Create a new database and close it again.
+	dbPath := filepath.Join(os.TempDir(), "bboltdb-reopenfail")
+	_ = os.RemoveAll(dbPath)
+	db, err := database.Create(dbType, dbPath, dbtest.BlockDataNet)
+	if err != nil {
+		t.Errorf("Failed to create test database (%s) %v", dbType, err)
+		return
+	}
+	defer os.RemoveAll(dbPath)
+	db.Close()
+
+	_, err = database.Create(dbType, dbPath, dbtest.BlockDataNet)
+	if !dbtest.CheckDbError(t, "Create existing", err,
+		database.ErrDbExists) {
+		return
+	}
+	_, err = database.Open(dbType, dbPath, wire.TestNet3)
+	if !dbtest.CheckDbError(t, "Open wrong network", err,
+		database.ErrInvalid) {
+		return
+	}
+
+	// Ensure the database still opens for its own network.
+	db, err = database.Open(dbType, dbPath, dbtest.BlockDataNet)
+	if err != nil {
+		t.Errorf("Failed to open test database (%s) %v", dbType, err)
+		return
+	}
+	db.Close()
+}
+
+// TestCheckIntegrity ensures the integrity check passes for a database that
+// contains blocks and honors the interrupt channel.
+func TestCheckIntegrity(t *testing.T) {
+	t.Parallel()
+
+	// Create a new database to run tests against.
+	dbPath := filepath.Join(os.TempDir(), "bboltdb-checkintegritytest")
+	_ = os.RemoveAll(dbPath)
+	db, err := database.Create(dbType, dbPath, dbtest.BlockDataNet)
+	if err != nil {
+		t.Errorf("Failed to create test database (%s) %v", dbType, err)
+		return
+	}
+	defer os.RemoveAll(dbPath)
+	defer db.Close()
+
+	blocks, err := dbtest.LoadBlocks(t, dbtest.BlockDataFile,
+		dbtest.BlockDataNet)
+	if err != nil {
+		t.Errorf("LoadBlocks: Unexpected error: %v", err)
+		return
+	}
+	err = db.Update(func(tx database.Tx) error {
+		for _, block := range blocks[:10] {
+			if err := tx.StoreBlock(block); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Errorf("Update: unexpected error: %v", err)
+		return
+	}
+
+	checker, ok := db.(database.IntegrityChecker)
+	if !ok {
+		t.Errorf("database does not implement database.IntegrityChecker")
+		return
+	}
+	if err := checker.CheckIntegrity(1, nil); err != nil {
+		t.Errorf("CheckIntegrity: unexpected error: %v", err)
+		return
+	}
+
+	interrupt := make(chan struct{})
+	close(interrupt)
+	err = checker.CheckIntegrity(1, interrupt)
+	if !dbtest.CheckDbError(t, "CheckIntegrity interrupted", err,
+		database.ErrDriverSpecific) {
+		return
+	}
+}
+
+// TestInterface performs all interfaces tests for this database driver.
+func TestInterface(t *testing.T) {
+	t.Parallel()
+
+	dbtest.TestInterface(t, dbType, nil)
+}
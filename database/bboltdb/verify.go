@@ -0,0 +1,109 @@
+// Copyright (c) 2021 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package bboltdb
+
+import (
+	"bytes"
+	"fmt"
+	"hash/crc32"
+	"math/rand"
+	"time"
+
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/database"
+	"github.com/btcsuite/btcd/wire"
+)
+
+const (
+	// verifyProgressInterval is the minimum amount of time between the
+	// progress messages logged while checking the integrity of the
+	// database.
+	verifyProgressInterval = time.Second * 10
+)
+
+// Enforce db implements the optional database.IntegrityChecker interface.
+var _ database.IntegrityChecker = (*db)(nil)
+
+// CheckIntegrity ensures every entry in the block storage bucket is large
+// enough to hold a block and fully verifies the checksum and hash of a random
+// sample of the blocks, as determined by the provided sample rate.
+//
+// This function is part of the database.IntegrityChecker interface
+// implementation.
+func (db *db) CheckIntegrity(sampleRate float64, interrupt <-chan struct{}) error {
+	return db.View(func(dbTx database.Tx) error {
+		tx := dbTx.(*transaction)
+
+		var numChecked, numVerified int64
+		lastLog := time.Now()
+		cursor := tx.blocksBucket.Cursor()
+		for k, _ := cursor.First(); k != nil; k, _ = cursor.Next() {
+			select {
+			case <-interrupt:
+				str := "integrity check interrupted"
+				return makeDbErr(database.ErrDriverSpecific, str,
+					nil)
+			default:
+			}
+
+			var hash chainhash.Hash
+			if err := hash.SetBytes(k); err != nil {
+				str := fmt.Sprintf("invalid block key %x", k)
+				return makeDbErr(database.ErrCorruption, str, err)
+			}
+			blockBytes, serializedChecksum, err := tx.fetchBlockData(&hash)
+			if err != nil {
+				return err
+			}
+			if sampleRate >= 1 || rand.Float64() < sampleRate {
+				err := verifyBlock(&hash, blockBytes, serializedChecksum)
+				if err != nil {
+					return err
+				}
+				numVerified++
+			}
+			numChecked++
+
+			if time.Since(lastLog) >= verifyProgressInterval {
+				log.Infof("Checked %d blocks (%d fully "+
+					"verified)", numChecked, numVerified)
+				lastLog = time.Now()
+			}
+		}
+
+		log.Infof("Database integrity check passed: checked %d blocks "+
+			"(%d fully verified)", numChecked, numVerified)
+		return nil
+	})
+}
+
+// verifyBlock ensures the provided serialized block matches its stored
+// checksum and that the hash of its header matches the hash the block is
+// stored under.
+func verifyBlock(hash *chainhash.Hash, blockBytes, serializedChecksum []byte) error {
+	calculatedChecksum := crc32.Checksum(blockBytes, castagnoli)
+	expectedChecksum := byteOrder.Uint32(serializedChecksum)
+	if calculatedChecksum != expectedChecksum {
+		str := fmt.Sprintf("block data for block %s checksum does not "+
+			"match - got %x, want %x", hash, calculatedChecksum,
+			expectedChecksum)
+		return makeDbErr(database.ErrCorruption, str, nil)
+	}
+
+	var header wire.BlockHeader
+	err := header.Deserialize(bytes.NewReader(blockBytes))
+	if err != nil {
+		str := fmt.Sprintf("failed to deserialize header of block %s: "+
+			"%v", hash, err)
+		return makeDbErr(database.ErrCorruption, str, err)
+	}
+	if gotHash := header.BlockHash(); gotHash != *hash {
+		str := fmt.Sprintf("block data stored under hash %s is for "+
+			"block %s", hash, gotHash)
+		return makeDbErr(database.ErrCorruption, str, nil)
+	}
+
+	return nil
+}
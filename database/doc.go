@@ -14,7 +14,9 @@ simple and efficient manner.
 
 The default backend, ffldb, has a strong focus on speed, efficiency, and
 robustness.  It makes use leveldb for the metadata, flat files for block
-storage, and strict checksums in key areas to ensure data integrity.
+storage, and strict checksums in key areas to ensure data integrity.  An
+alternative backend, bboltdb, keeps both the metadata and the blocks in a single
+memory-mapped bbolt file.
 
 A quick overview of the features database provides are as follows:
 
@@ -1734,8 +1734,12 @@ type db struct {
 	cache     *dbCache     // Cache layer which wraps underlying leveldb DB.
 }
 
-// Enforce db implements the database.DB interface.
-var _ database.DB = (*db)(nil)
+// Enforce db implements the database.DB and the optional
+// database.CacheStatsReporter interfaces.
+var (
+	_ database.DB                 = (*db)(nil)
+	_ database.CacheStatsReporter = (*db)(nil)
+)
 
 // Type returns the database driver type the current database instance was
 // created with.
@@ -1745,6 +1749,16 @@ func (db *db) Type() string {
 	return dbType
 }
 
+// CacheStats returns the number of metadata key lookups that were served by the
+// database cache and the number that had to consult the underlying leveldb
+// database since the database was opened.
+//
+// This function is part of the database.CacheStatsReporter interface
+// implementation.
+func (db *db) CacheStats() (uint64, uint64) {
+	return db.cache.CacheStats()
+}
+
 // begin is the implementation function for the Begin database method.  See its
 // documentation for more details.
 //
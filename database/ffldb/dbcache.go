@@ -8,6 +8,7 @@ import (
 	"bytes"
 	"fmt"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/btcsuite/btcd/database/internal/treap"
@@ -285,6 +286,7 @@ func (iter *dbCacheIterator) Error() error {
 // dbCacheSnapshot defines a snapshot of the database cache and underlying
 // database at a particular point in time.
 type dbCacheSnapshot struct {
+	cache         *dbCache
 	dbSnapshot    *leveldb.Snapshot
 	pendingKeys   *treap.Immutable
 	pendingRemove *treap.Immutable
@@ -294,13 +296,16 @@ type dbCacheSnapshot struct {
 func (snap *dbCacheSnapshot) Has(key []byte) bool {
 	// Check the cached entries first.
 	if snap.pendingRemove.Has(key) {
+		atomic.AddUint64(&snap.cache.hits, 1)
 		return false
 	}
 	if snap.pendingKeys.Has(key) {
+		atomic.AddUint64(&snap.cache.hits, 1)
 		return true
 	}
 
 	// Consult the database.
+	atomic.AddUint64(&snap.cache.misses, 1)
 	hasKey, _ := snap.dbSnapshot.Has(key, nil)
 	return hasKey
 }
@@ -310,13 +315,16 @@ func (snap *dbCacheSnapshot) Has(key []byte) bool {
 func (snap *dbCacheSnapshot) Get(key []byte) []byte {
 	// Check the cached entries first.
 	if snap.pendingRemove.Has(key) {
+		atomic.AddUint64(&snap.cache.hits, 1)
 		return nil
 	}
 	if value := snap.pendingKeys.Get(key); value != nil {
+		atomic.AddUint64(&snap.cache.hits, 1)
 		return value
 	}
 
 	// Consult the database.
+	atomic.AddUint64(&snap.cache.misses, 1)
 	value, err := snap.dbSnapshot.Get(key, nil)
 	if err != nil {
 		return nil
@@ -354,6 +362,13 @@ func (snap *dbCacheSnapshot) NewIterator(slice *util.Range) *dbCacheIterator {
 // can commit transactions at will without incurring large performance hits due
 // to frequent disk syncs.
 type dbCache struct {
+	// hits and misses are the number of key lookups that were served by
+	// the cache and the number that had to consult the underlying
+	// database.  They must be accessed atomically and are the first fields
+	// so they are properly aligned on 32-bit platforms.
+	hits   uint64
+	misses uint64
+
 	// ldb is the underlying leveldb DB for metadata.
 	ldb *leveldb.DB
 
@@ -407,6 +422,7 @@ func (c *dbCache) Snapshot() (*dbCacheSnapshot, error) {
 	// which is used to atomically swap the root.
 	c.cacheLock.RLock()
 	cacheSnapshot := &dbCacheSnapshot{
+		cache:         c,
 		dbSnapshot:    dbSnapshot,
 		pendingKeys:   c.cachedKeys,
 		pendingRemove: c.cachedRemove,
@@ -415,6 +431,14 @@ func (c *dbCache) Snapshot() (*dbCacheSnapshot, error) {
 	return cacheSnapshot, nil
 }
 
+// CacheStats returns the number of key lookups that were served by the cache
+// and the number that had to consult the underlying database.
+//
+// This function is safe for concurrent access.
+func (c *dbCache) CacheStats() (uint64, uint64) {
+	return atomic.LoadUint64(&c.hits), atomic.LoadUint64(&c.misses)
+}
+
 // updateDB invokes the passed function in the context of a managed leveldb
 // transaction.  Any errors returned from the user-supplied function will cause
 // the transaction to be rolled back and are returned from this function.
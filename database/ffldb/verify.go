@@ -0,0 +1,228 @@
+// Copyright (c) 2021 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+// This file contains the implementation of the optional database.Compactor and
+// database.IntegrityChecker interfaces.
+
+package ffldb
+
+import (
+	"bytes"
+	"fmt"
+	"math/rand"
+	"time"
+
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/database"
+	"github.com/btcsuite/btcd/wire"
+	"github.com/btcsuite/goleveldb/leveldb/util"
+)
+
+const (
+	// verifyProgressInterval is the minimum amount of time between the
+	// progress messages logged while checking the integrity of the
+	// database.
+	verifyProgressInterval = time.Second * 10
+)
+
+// Enforce db implements the optional database.Compactor and
+// database.IntegrityChecker interfaces.
+var (
+	_ database.Compactor        = (*db)(nil)
+	_ database.IntegrityChecker = (*db)(nil)
+)
+
+// Compact flushes the database cache and then compacts the entire underlying
+// leveldb metadata database.  Compaction discards deleted and overwritten keys
+// which reclaims disk space.  Transactions, including write transactions, may
+// be used while the compaction is in progress.
+//
+// This function is part of the database.Compactor interface implementation.
+func (db *db) Compact() error {
+	// The cache may only be flushed while holding the write lock.  The
+	// locking order is the same as the one used when starting a write
+	// transaction.
+	db.writeLock.Lock()
+	db.closeLock.RLock()
+	defer db.closeLock.RUnlock()
+	if db.closed {
+		db.writeLock.Unlock()
+		return makeDbErr(database.ErrDbNotOpen, errDbNotOpenStr, nil)
+	}
+
+	// Flush the cache so recently committed data is compacted as well.
+	err := db.cache.flush()
+	db.writeLock.Unlock()
+	if err != nil {
+		return err
+	}
+
+	log.Infof("Compacting database metadata...")
+	start := time.Now()
+	if err := db.cache.ldb.CompactRange(util.Range{}); err != nil {
+		return convertErr("failed to compact database", err)
+	}
+	log.Infof("Compacted database metadata in %v",
+		time.Since(start).Truncate(time.Millisecond))
+
+	return nil
+}
+
+// checkBlockRecord ensures the block record at the provided location in the
+// flat files exists and starts with the network and block length expected for
+// the block.  This only requires a small read, so it is inexpensive enough to
+// do for every block.
+//
+// Returns ErrCorruption when the record is missing or does not match.
+func (s *blockStore) checkBlockRecord(hash *chainhash.Hash, loc blockLocation) error {
+	// The location must not be past the position new blocks are written
+	// to.  This is done under the write cursor lock since the fields are
+	// modified by the writer.
+	wc := s.writeCursor
+	wc.RLock()
+	curFileNum, curOffset := wc.curFileNum, wc.curOffset
+	wc.RUnlock()
+	endOffset := uint64(loc.fileOffset) + uint64(loc.blockLen)
+	if loc.blockFileNum > curFileNum || (loc.blockFileNum == curFileNum &&
+		endOffset > uint64(curOffset)) {
+
+		str := fmt.Sprintf("block index entry for block %s claims file "+
+			"%d, offset %d, length %d which is beyond the block data "+
+			"at file %d, offset %d", hash, loc.blockFileNum,
+			loc.fileOffset, loc.blockLen, curFileNum, curOffset)
+		return makeDbErr(database.ErrCorruption, str, nil)
+	}
+
+	// Read the network and block length that prefix the block record.
+	blockFile, err := s.blockFile(loc.blockFileNum)
+	if err != nil {
+		str := fmt.Sprintf("block file %d for block %s is not "+
+			"available: %v", loc.blockFileNum, hash, err)
+		return makeDbErr(database.ErrCorruption, str, err)
+	}
+	var recordHdr [8]byte
+	_, err = blockFile.file.ReadAt(recordHdr[:], int64(loc.fileOffset))
+	blockFile.RUnlock()
+	if err != nil {
+		str := fmt.Sprintf("failed to read record for block %s from "+
+			"file %d, offset %d: %v", hash, loc.blockFileNum,
+			loc.fileOffset, err)
+		return makeDbErr(database.ErrCorruption, str, err)
+	}
+
+	serializedNet := byteOrder.Uint32(recordHdr[0:4])
+	if serializedNet != uint32(s.network) {
+		str := fmt.Sprintf("record for block %s in file %d, offset %d "+
+			"is for the wrong network - got %d, want %d", hash,
+			loc.blockFileNum, loc.fileOffset, serializedNet,
+			uint32(s.network))
+		return makeDbErr(database.ErrCorruption, str, nil)
+	}
+	serializedLen := byteOrder.Uint32(recordHdr[4:8])
+	if serializedLen+12 != loc.blockLen {
+		str := fmt.Sprintf("record for block %s in file %d, offset %d "+
+			"has length %d, but the block index claims %d", hash,
+			loc.blockFileNum, loc.fileOffset, serializedLen,
+			loc.blockLen-12)
+		return makeDbErr(database.ErrCorruption, str, nil)
+	}
+
+	return nil
+}
+
+// verifyBlock fully loads the block at the provided location, which verifies
+// its checksum, and ensures the hash of the loaded block header matches the
+// hash the block is indexed by.
+//
+// Returns ErrCorruption when the block data does not match.
+func (s *blockStore) verifyBlock(hash *chainhash.Hash, loc blockLocation) error {
+	blockBytes, err := s.readBlock(hash, loc)
+	if err != nil {
+		if dbErr, ok := err.(database.Error); ok &&
+			dbErr.ErrorCode == database.ErrCorruption {
+
+			return err
+		}
+		str := fmt.Sprintf("failed to verify block %s: %v", hash, err)
+		return makeDbErr(database.ErrCorruption, str, err)
+	}
+
+	var header wire.BlockHeader
+	err = header.Deserialize(bytes.NewReader(blockBytes))
+	if err != nil {
+		str := fmt.Sprintf("failed to deserialize header of block %s: "+
+			"%v", hash, err)
+		return makeDbErr(database.ErrCorruption, str, err)
+	}
+	if gotHash := header.BlockHash(); gotHash != *hash {
+		str := fmt.Sprintf("block data indexed by hash %s is for block "+
+			"%s", hash, gotHash)
+		return makeDbErr(database.ErrCorruption, str, nil)
+	}
+
+	return nil
+}
+
+// CheckIntegrity cross-checks every entry in the block index against the flat
+// block files and fully loads a random sample of the blocks, as determined by
+// the provided sample rate, to verify their checksums and hashes.
+//
+// This function is part of the database.IntegrityChecker interface
+// implementation.
+func (db *db) CheckIntegrity(sampleRate float64, interrupt <-chan struct{}) error {
+	return db.View(func(dbTx database.Tx) error {
+		tx := dbTx.(*transaction)
+
+		var numChecked, numVerified int64
+		lastLog := time.Now()
+		cursor := tx.blockIdxBucket.Cursor()
+		for ok := cursor.First(); ok; ok = cursor.Next() {
+			select {
+			case <-interrupt:
+				str := "integrity check interrupted"
+				return makeDbErr(database.ErrDriverSpecific, str,
+					nil)
+			default:
+			}
+
+			var hash chainhash.Hash
+			if err := hash.SetBytes(cursor.Key()); err != nil {
+				str := fmt.Sprintf("invalid block index key %x",
+					cursor.Key())
+				return makeDbErr(database.ErrCorruption, str, err)
+			}
+			blockRow := cursor.Value()
+			if len(blockRow) < blockLocSize {
+				str := fmt.Sprintf("block index entry for block "+
+					"%s is %d bytes, want at least %d", hash,
+					len(blockRow), blockLocSize)
+				return makeDbErr(database.ErrCorruption, str, nil)
+			}
+			loc := deserializeBlockLoc(blockRow)
+
+			err := tx.db.store.checkBlockRecord(&hash, loc)
+			if err != nil {
+				return err
+			}
+			if sampleRate >= 1 || rand.Float64() < sampleRate {
+				err := tx.db.store.verifyBlock(&hash, loc)
+				if err != nil {
+					return err
+				}
+				numVerified++
+			}
+			numChecked++
+
+			if time.Since(lastLog) >= verifyProgressInterval {
+				log.Infof("Checked %d blocks (%d fully "+
+					"verified)", numChecked, numVerified)
+				lastLog = time.Now()
+			}
+		}
+
+		log.Infof("Database integrity check passed: checked %d blocks "+
+			"(%d fully verified)", numChecked, numVerified)
+		return nil
+	})
+}
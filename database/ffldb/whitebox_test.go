@@ -598,6 +598,150 @@ func testCorruption(tc *testContext) bool {
 	return true
 }
 
+// testIntegrityCheck ensures the database integrity check and compaction
+// behave as expected, including detecting corruption in the block files.
+func testIntegrityCheck(tc *testContext) bool {
+	if !resetDatabase(tc) {
+		return false
+	}
+
+	// Insert the first block into the mock file.
+	err := tc.db.Update(func(tx database.Tx) error {
+		err := tx.StoreBlock(tc.blocks[0])
+		if err != nil {
+			tc.t.Errorf("StoreBlock: unexpected error: %v", err)
+			return errSubTestFail
+		}
+
+		return nil
+	})
+	if err != nil {
+		if err != errSubTestFail {
+			tc.t.Errorf("Update: unexpected error: %v", err)
+		}
+		return false
+	}
+
+	// Ensure the intact database passes the check and can be compacted.
+	ffdb := tc.db.(*db)
+	if err := ffdb.CheckIntegrity(1, nil); err != nil {
+		tc.t.Errorf("CheckIntegrity: unexpected error: %v", err)
+		return false
+	}
+	if err := ffdb.Compact(); err != nil {
+		tc.t.Errorf("Compact: unexpected error: %v", err)
+		return false
+	}
+
+	// Ensure an interrupted check returns an error.
+	interrupt := make(chan struct{})
+	close(interrupt)
+	err = ffdb.CheckIntegrity(1, interrupt)
+	if !checkDbError(tc.t, "CheckIntegrity interrupted", err,
+		database.ErrDriverSpecific) {
+		return false
+	}
+
+	// Ensure corruption is detected by intentionally modifying the bytes
+	// stored to the mock file.  Corruption in the block data itself is
+	// only detected when the block is part of the sample.
+	tests := []struct {
+		offset      uint32
+		sampleRate  float64
+		wantErrCode database.ErrorCode
+	}{
+		// One of the network bytes.
+		{2, 0, database.ErrCorruption},
+
+		// One of the block length bytes.
+		{6, 0, database.ErrCorruption},
+
+		// Random header byte.
+		{17, 1, database.ErrCorruption},
+
+		// Random transaction byte.
+		{90, 1, database.ErrCorruption},
+	}
+	data := tc.files[0].file.(*mockFile).data
+	for i, test := range tests {
+		// Corrupt the byte at the offset by a single bit.
+		data[test.offset] ^= 0x10
+
+		testName := fmt.Sprintf("CheckIntegrity (test #%d): "+
+			"corruption", i)
+		err := ffdb.CheckIntegrity(test.sampleRate, nil)
+		if !checkDbError(tc.t, testName, err, test.wantErrCode) {
+			return false
+		}
+
+		// Reset the corrupted data back to the original.
+		data[test.offset] ^= 0x10
+	}
+
+	// Ensure corruption in the block data is not detected when the block
+	// is not sampled.
+	data[90] ^= 0x10
+	err = ffdb.CheckIntegrity(0, nil)
+	data[90] ^= 0x10
+	if err != nil {
+		tc.t.Errorf("CheckIntegrity: unexpected error: %v", err)
+		return false
+	}
+
+	return true
+}
+
+// testCacheStats ensures the metadata key lookups served by the database cache
+// and the underlying leveldb database are counted as expected.
+func testCacheStats(tc *testContext) bool {
+	if !resetDatabase(tc) {
+		return false
+	}
+
+	// Flush the cache so the key stored before is only available from the
+	// underlying database while the key stored after is cached.
+	ffdb := tc.db.(*db)
+	key1, key2, key3 := []byte("cachekey1"), []byte("cachekey2"), []byte("cachekey3")
+	err := tc.db.Update(func(tx database.Tx) error {
+		return tx.Metadata().Put(key1, []byte("value"))
+	})
+	if err != nil {
+		tc.t.Errorf("Update: unexpected error: %v", err)
+		return false
+	}
+	if err := ffdb.cache.flush(); err != nil {
+		tc.t.Errorf("flush: unexpected error: %v", err)
+		return false
+	}
+	err = tc.db.Update(func(tx database.Tx) error {
+		return tx.Metadata().Put(key2, []byte("value"))
+	})
+	if err != nil {
+		tc.t.Errorf("Update: unexpected error: %v", err)
+		return false
+	}
+
+	hits, misses := ffdb.CacheStats()
+	err = tc.db.View(func(tx database.Tx) error {
+		tx.Metadata().Get(key1)
+		tx.Metadata().Get(key2)
+		tx.Metadata().Get(key3)
+		return nil
+	})
+	if err != nil {
+		tc.t.Errorf("View: unexpected error: %v", err)
+		return false
+	}
+	gotHits, gotMisses := ffdb.CacheStats()
+	if gotHits-hits != 1 || gotMisses-misses != 2 {
+		tc.t.Errorf("CacheStats: got %d hits and %d misses, want 1 "+
+			"and 2", gotHits-hits, gotMisses-misses)
+		return false
+	}
+
+	return true
+}
+
 // TestFailureScenarios ensures several failure scenarios such as database
 // corruption, block file write failures, and rollback failures are handled
 // correctly.
@@ -702,5 +846,15 @@ func TestFailureScenarios(t *testing.T) {
 	}
 
 	// Test various corruption scenarios.
-	testCorruption(tc)
+	if !testCorruption(tc) {
+		return
+	}
+
+	// Test the integrity check detects corruption.
+	if !testIntegrityCheck(tc) {
+		return
+	}
+
+	// Test the cache statistics.
+	testCacheStats(tc)
 }
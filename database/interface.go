@@ -464,3 +464,46 @@ type DB interface {
 	// back or committed).
 	Close() error
 }
+
+// Compactor is an optional interface which may be implemented by a DB to allow
+// the underlying storage to be compacted while the database remains open.
+// Compaction discards deleted and overwritten data which reclaims disk space
+// and typically improves read performance.
+type Compactor interface {
+	// Compact compacts the underlying storage of the entire database.
+	// Concurrent transactions are permitted while compaction is in
+	// progress, however, it can take a long time for large databases.
+	//
+	// The interface contract guarantees at least the following errors will
+	// be returned (other implementation-specific errors are possible):
+	//   - ErrDbNotOpen if the database is not open
+	Compact() error
+}
+
+// IntegrityChecker is an optional interface which may be implemented by a DB to
+// allow the consistency of the stored blocks to be verified.
+type IntegrityChecker interface {
+	// CheckIntegrity ensures every block in the database is accounted for
+	// by the underlying block storage and fully loads and verifies the
+	// checksum and hash of a random sample of them.  The sampleRate
+	// parameter is the fraction of blocks to fully verify, where 0 only
+	// performs the cheap cross-checks and 1 verifies every block.
+	//
+	// The check stops early when the interrupt channel is closed, in which
+	// case an error is returned.
+	//
+	// The interface contract guarantees at least the following errors will
+	// be returned (other implementation-specific errors are possible):
+	//   - ErrCorruption if any inconsistencies are detected
+	//   - ErrDbNotOpen if the database is not open
+	CheckIntegrity(sampleRate float64, interrupt <-chan struct{}) error
+}
+
+// CacheStatsReporter is an optional interface which may be implemented by a DB
+// which caches metadata in memory to report how effective the cache is.
+type CacheStatsReporter interface {
+	// CacheStats returns the number of metadata key lookups that were
+	// served by the cache and the number of lookups that had to consult the
+	// underlying storage since the database was opened.
+	CacheStats() (hits, misses uint64)
+}
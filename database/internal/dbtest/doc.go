@@ -0,0 +1,13 @@
+// Copyright (c) 2015-2016 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+/*
+Package dbtest provides the tests which every backend driver of the database
+package must pass.
+
+Each driver has its own driver_test.go file which invokes the functions of this
+package with its driver type to ensure the driver properly implements the
+interface, along with any tests which are specific to the driver.
+*/
+package dbtest
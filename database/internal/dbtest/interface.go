@@ -2,30 +2,16 @@
 // Use of this source code is governed by an ISC
 // license that can be found in the LICENSE file.
 
-// This file intended to be copied into each backend driver directory.  Each
-// driver should have their own driver_test.go file which creates a database and
-// invokes the testInterface function in this file to ensure the driver properly
-// implements the interface.
-//
-// NOTE: When copying this file into the backend driver folder, the package name
-// will need to be changed accordingly.
-
-package ffldb_test
+package dbtest
 
 import (
 	"bytes"
-	"compress/bzip2"
-	"encoding/binary"
 	"fmt"
-	"io"
-	"os"
-	"path/filepath"
 	"reflect"
 	"sync/atomic"
 	"testing"
 	"time"
 
-	"github.com/btcsuite/btcd/chaincfg"
 	"github.com/btcsuite/btcd/chaincfg/chainhash"
 	"github.com/btcsuite/btcd/database"
 	"github.com/btcsuite/btcd/wire"
@@ -33,105 +19,10 @@ import (
 )
 
 var (
-	// blockDataNet is the expected network in the test block data.
-	blockDataNet = wire.MainNet
-
-	// blockDataFile is the path to a file containing the first 256 blocks
-	// of the block chain.
-	blockDataFile = filepath.Join("..", "testdata", "blocks1-256.bz2")
-
 	// errSubTestFail is used to signal that a sub test returned false.
 	errSubTestFail = fmt.Errorf("sub test failure")
 )
 
-// loadBlocks loads the blocks contained in the testdata directory and returns
-// a slice of them.
-func loadBlocks(t *testing.T, dataFile string, network wire.BitcoinNet) ([]*btcutil.Block, error) {
-	// Open the file that contains the blocks for reading.
-	fi, err := os.Open(dataFile)
-	if err != nil {
-		t.Errorf("failed to open file %v, err %v", dataFile, err)
-		return nil, err
-	}
-	defer func() {
-		if err := fi.Close(); err != nil {
-			t.Errorf("failed to close file %v %v", dataFile,
-				err)
-		}
-	}()
-	dr := bzip2.NewReader(fi)
-
-	// Set the first block as the genesis block.
-	blocks := make([]*btcutil.Block, 0, 256)
-	genesis := btcutil.NewBlock(chaincfg.MainNetParams.GenesisBlock)
-	blocks = append(blocks, genesis)
-
-	// Load the remaining blocks.
-	for height := 1; ; height++ {
-		var net uint32
-		err := binary.Read(dr, binary.LittleEndian, &net)
-		if err == io.EOF {
-			// Hit end of file at the expected offset.  No error.
-			break
-		}
-		if err != nil {
-			t.Errorf("Failed to load network type for block %d: %v",
-				height, err)
-			return nil, err
-		}
-		if net != uint32(network) {
-			t.Errorf("Block doesn't match network: %v expects %v",
-				net, network)
-			return nil, err
-		}
-
-		var blockLen uint32
-		err = binary.Read(dr, binary.LittleEndian, &blockLen)
-		if err != nil {
-			t.Errorf("Failed to load block size for block %d: %v",
-				height, err)
-			return nil, err
-		}
-
-		// Read the block.
-		blockBytes := make([]byte, blockLen)
-		_, err = io.ReadFull(dr, blockBytes)
-		if err != nil {
-			t.Errorf("Failed to load block %d: %v", height, err)
-			return nil, err
-		}
-
-		// Deserialize and store the block.
-		block, err := btcutil.NewBlockFromBytes(blockBytes)
-		if err != nil {
-			t.Errorf("Failed to parse block %v: %v", height, err)
-			return nil, err
-		}
-		blocks = append(blocks, block)
-	}
-
-	return blocks, nil
-}
-
-// checkDbError ensures the passed error is a database.Error with an error code
-// that matches the passed  error code.
-func checkDbError(t *testing.T, testName string, gotErr error, wantErrCode database.ErrorCode) bool {
-	dbErr, ok := gotErr.(database.Error)
-	if !ok {
-		t.Errorf("%s: unexpected error type - got %T, want %T",
-			testName, gotErr, database.Error{})
-		return false
-	}
-	if dbErr.ErrorCode != wantErrCode {
-		t.Errorf("%s: unexpected error code - got %s (%s), want %s",
-			testName, dbErr.ErrorCode, dbErr.Description,
-			wantErrCode)
-		return false
-	}
-
-	return true
-}
-
 // testContext is used to store context information about a running test which
 // is passed into helper functions.
 type testContext struct {
@@ -504,7 +395,7 @@ func testBucketInterface(tc *testContext, bucket database.Bucket) bool {
 		// expected error.
 		wantErrCode := database.ErrBucketExists
 		_, err = bucket.CreateBucket(testBucketName)
-		if !checkDbError(tc.t, "CreateBucket", err, wantErrCode) {
+		if !CheckDbError(tc.t, "CreateBucket", err, wantErrCode) {
 			return false
 		}
 
@@ -540,7 +431,7 @@ func testBucketInterface(tc *testContext, bucket database.Bucket) bool {
 		// expected error.
 		wantErrCode = database.ErrBucketNotFound
 		err = bucket.DeleteBucket(testBucketName)
-		if !checkDbError(tc.t, "DeleteBucket", err, wantErrCode) {
+		if !CheckDbError(tc.t, "DeleteBucket", err, wantErrCode) {
 			return false
 		}
 
@@ -578,21 +469,21 @@ func testBucketInterface(tc *testContext, bucket database.Bucket) bool {
 		wantErrCode := database.ErrTxNotWritable
 		failBytes := []byte("fail")
 		err := bucket.Put(failBytes, failBytes)
-		if !checkDbError(tc.t, testName, err, wantErrCode) {
+		if !CheckDbError(tc.t, testName, err, wantErrCode) {
 			return false
 		}
 
 		// Delete should fail with bucket that is not writable.
 		testName = "unwritable tx delete"
 		err = bucket.Delete(failBytes)
-		if !checkDbError(tc.t, testName, err, wantErrCode) {
+		if !CheckDbError(tc.t, testName, err, wantErrCode) {
 			return false
 		}
 
 		// CreateBucket should fail with bucket that is not writable.
 		testName = "unwritable tx create bucket"
 		_, err = bucket.CreateBucket(failBytes)
-		if !checkDbError(tc.t, testName, err, wantErrCode) {
+		if !CheckDbError(tc.t, testName, err, wantErrCode) {
 			return false
 		}
 
@@ -600,14 +491,14 @@ func testBucketInterface(tc *testContext, bucket database.Bucket) bool {
 		// writable.
 		testName = "unwritable tx create bucket if not exists"
 		_, err = bucket.CreateBucketIfNotExists(failBytes)
-		if !checkDbError(tc.t, testName, err, wantErrCode) {
+		if !CheckDbError(tc.t, testName, err, wantErrCode) {
 			return false
 		}
 
 		// DeleteBucket should fail with bucket that is not writable.
 		testName = "unwritable tx delete bucket"
 		err = bucket.DeleteBucket(failBytes)
-		if !checkDbError(tc.t, testName, err, wantErrCode) {
+		if !CheckDbError(tc.t, testName, err, wantErrCode) {
 			return false
 		}
 
@@ -681,7 +572,7 @@ func testMetadataManualTxInterface(tc *testContext) bool {
 			testName := "unwritable tx commit"
 			wantErrCode := database.ErrTxNotWritable
 			err := tx.Commit()
-			if !checkDbError(tc.t, testName, err, wantErrCode) {
+			if !CheckDbError(tc.t, testName, err, wantErrCode) {
 				_ = tx.Rollback()
 				return false
 			}
@@ -1133,7 +1024,7 @@ func testFetchBlockIOMissing(tc *testContext, tx database.Tx) bool {
 		// Ensure FetchBlock returns expected error.
 		testName := fmt.Sprintf("FetchBlock #%d on missing block", i)
 		_, err = tx.FetchBlock(blockHash)
-		if !checkDbError(tc.t, testName, err, wantErrCode) {
+		if !CheckDbError(tc.t, testName, err, wantErrCode) {
 			return false
 		}
 
@@ -1141,7 +1032,7 @@ func testFetchBlockIOMissing(tc *testContext, tx database.Tx) bool {
 		testName = fmt.Sprintf("FetchBlockHeader #%d on missing block",
 			i)
 		_, err = tx.FetchBlockHeader(blockHash)
-		if !checkDbError(tc.t, testName, err, wantErrCode) {
+		if !CheckDbError(tc.t, testName, err, wantErrCode) {
 			return false
 		}
 
@@ -1154,7 +1045,7 @@ func testFetchBlockIOMissing(tc *testContext, tx database.Tx) bool {
 		}
 		allBlockRegions[i] = region
 		_, err = tx.FetchBlockRegion(&region)
-		if !checkDbError(tc.t, testName, err, wantErrCode) {
+		if !CheckDbError(tc.t, testName, err, wantErrCode) {
 			return false
 		}
 
@@ -1177,21 +1068,21 @@ func testFetchBlockIOMissing(tc *testContext, tx database.Tx) bool {
 	// Ensure FetchBlocks returns expected error.
 	testName := "FetchBlocks on missing blocks"
 	_, err := tx.FetchBlocks(allBlockHashes)
-	if !checkDbError(tc.t, testName, err, wantErrCode) {
+	if !CheckDbError(tc.t, testName, err, wantErrCode) {
 		return false
 	}
 
 	// Ensure FetchBlockHeaders returns expected error.
 	testName = "FetchBlockHeaders on missing blocks"
 	_, err = tx.FetchBlockHeaders(allBlockHashes)
-	if !checkDbError(tc.t, testName, err, wantErrCode) {
+	if !CheckDbError(tc.t, testName, err, wantErrCode) {
 		return false
 	}
 
 	// Ensure FetchBlockRegions returns expected error.
 	testName = "FetchBlockRegions on missing blocks"
 	_, err = tx.FetchBlockRegions(allBlockRegions)
-	if !checkDbError(tc.t, testName, err, wantErrCode) {
+	if !CheckDbError(tc.t, testName, err, wantErrCode) {
 		return false
 	}
 
@@ -1323,7 +1214,7 @@ func testFetchBlockIO(tc *testContext, tx database.Tx) bool {
 			badBlockHash)
 		wantErrCode := database.ErrBlockNotFound
 		_, err = tx.FetchBlock(badBlockHash)
-		if !checkDbError(tc.t, testName, err, wantErrCode) {
+		if !CheckDbError(tc.t, testName, err, wantErrCode) {
 			return false
 		}
 
@@ -1332,7 +1223,7 @@ func testFetchBlockIO(tc *testContext, tx database.Tx) bool {
 		testName = fmt.Sprintf("FetchBlockHeader(%s) invalid block",
 			badBlockHash)
 		_, err = tx.FetchBlockHeader(badBlockHash)
-		if !checkDbError(tc.t, testName, err, wantErrCode) {
+		if !CheckDbError(tc.t, testName, err, wantErrCode) {
 			return false
 		}
 
@@ -1344,7 +1235,7 @@ func testFetchBlockIO(tc *testContext, tx database.Tx) bool {
 		region.Hash = badBlockHash
 		region.Offset = ^uint32(0)
 		_, err = tx.FetchBlockRegion(&region)
-		if !checkDbError(tc.t, testName, err, wantErrCode) {
+		if !CheckDbError(tc.t, testName, err, wantErrCode) {
 			return false
 		}
 
@@ -1356,7 +1247,7 @@ func testFetchBlockIO(tc *testContext, tx database.Tx) bool {
 		region.Hash = blockHash
 		region.Offset = ^uint32(0)
 		_, err = tx.FetchBlockRegion(&region)
-		if !checkDbError(tc.t, testName, err, wantErrCode) {
+		if !CheckDbError(tc.t, testName, err, wantErrCode) {
 			return false
 		}
 	}
@@ -1466,7 +1357,7 @@ func testFetchBlockIO(tc *testContext, tx database.Tx) bool {
 	badBlockHashes[len(badBlockHashes)-1] = chainhash.Hash{}
 	wantErrCode := database.ErrBlockNotFound
 	_, err = tx.FetchBlocks(badBlockHashes)
-	if !checkDbError(tc.t, testName, err, wantErrCode) {
+	if !CheckDbError(tc.t, testName, err, wantErrCode) {
 		return false
 	}
 
@@ -1474,7 +1365,7 @@ func testFetchBlockIO(tc *testContext, tx database.Tx) bool {
 	// expected error.
 	testName = "FetchBlockHeaders invalid hash"
 	_, err = tx.FetchBlockHeaders(badBlockHashes)
-	if !checkDbError(tc.t, testName, err, wantErrCode) {
+	if !CheckDbError(tc.t, testName, err, wantErrCode) {
 		return false
 	}
 
@@ -1486,7 +1377,7 @@ func testFetchBlockIO(tc *testContext, tx database.Tx) bool {
 	badBlockRegions[len(badBlockRegions)-1].Hash = &chainhash.Hash{}
 	wantErrCode = database.ErrBlockNotFound
 	_, err = tx.FetchBlockRegions(badBlockRegions)
-	if !checkDbError(tc.t, testName, err, wantErrCode) {
+	if !CheckDbError(tc.t, testName, err, wantErrCode) {
 		return false
 	}
 
@@ -1499,7 +1390,7 @@ func testFetchBlockIO(tc *testContext, tx database.Tx) bool {
 	}
 	wantErrCode = database.ErrBlockRegionInvalid
 	_, err = tx.FetchBlockRegions(badBlockRegions)
-	return checkDbError(tc.t, testName, err, wantErrCode)
+	return CheckDbError(tc.t, testName, err, wantErrCode)
 }
 
 // testBlockIOTxInterface ensures that the block IO interface works as expected
@@ -1513,7 +1404,7 @@ func testBlockIOTxInterface(tc *testContext) bool {
 		for i, block := range tc.blocks {
 			testName := fmt.Sprintf("StoreBlock(%d) on ro tx", i)
 			err := tx.StoreBlock(block)
-			if !checkDbError(tc.t, testName, err, wantErrCode) {
+			if !CheckDbError(tc.t, testName, err, wantErrCode) {
 				return errSubTestFail
 			}
 		}
@@ -1550,7 +1441,7 @@ func testBlockIOTxInterface(tc *testContext) bool {
 			testName := fmt.Sprintf("duplicate block entry #%d "+
 				"(before commit)", i)
 			err := tx.StoreBlock(block)
-			if !checkDbError(tc.t, testName, err, wantErrCode) {
+			if !CheckDbError(tc.t, testName, err, wantErrCode) {
 				return errSubTestFail
 			}
 		}
@@ -1608,7 +1499,7 @@ func testBlockIOTxInterface(tc *testContext) bool {
 				"(before commit)", i)
 			wantErrCode := database.ErrBlockExists
 			err := tx.StoreBlock(block)
-			if !checkDbError(tc.t, testName, err, wantErrCode) {
+			if !CheckDbError(tc.t, testName, err, wantErrCode) {
 				return errSubTestFail
 			}
 		}
@@ -1662,7 +1553,7 @@ func testBlockIOTxInterface(tc *testContext) bool {
 			testName := fmt.Sprintf("duplicate block entry #%d "+
 				"(before commit)", i)
 			err := tx.StoreBlock(block)
-			if !checkDbError(tc.t, testName, err, wantErrCode) {
+			if !CheckDbError(tc.t, testName, err, wantErrCode) {
 				return errSubTestFail
 			}
 		}
@@ -1702,42 +1593,42 @@ func testClosedTxInterface(tc *testContext, tx database.Tx) bool {
 	// Ensure CreateBucket returns expected error.
 	testName := "CreateBucket on closed tx"
 	_, err := bucket.CreateBucket(bucketName)
-	if !checkDbError(tc.t, testName, err, wantErrCode) {
+	if !CheckDbError(tc.t, testName, err, wantErrCode) {
 		return false
 	}
 
 	// Ensure CreateBucketIfNotExists returns expected error.
 	testName = "CreateBucketIfNotExists on closed tx"
 	_, err = bucket.CreateBucketIfNotExists(bucketName)
-	if !checkDbError(tc.t, testName, err, wantErrCode) {
+	if !CheckDbError(tc.t, testName, err, wantErrCode) {
 		return false
 	}
 
 	// Ensure Delete returns expected error.
 	testName = "Delete on closed tx"
 	err = bucket.Delete(keyName)
-	if !checkDbError(tc.t, testName, err, wantErrCode) {
+	if !CheckDbError(tc.t, testName, err, wantErrCode) {
 		return false
 	}
 
 	// Ensure DeleteBucket returns expected error.
 	testName = "DeleteBucket on closed tx"
 	err = bucket.DeleteBucket(bucketName)
-	if !checkDbError(tc.t, testName, err, wantErrCode) {
+	if !CheckDbError(tc.t, testName, err, wantErrCode) {
 		return false
 	}
 
 	// Ensure ForEach returns expected error.
 	testName = "ForEach on closed tx"
 	err = bucket.ForEach(nil)
-	if !checkDbError(tc.t, testName, err, wantErrCode) {
+	if !CheckDbError(tc.t, testName, err, wantErrCode) {
 		return false
 	}
 
 	// Ensure ForEachBucket returns expected error.
 	testName = "ForEachBucket on closed tx"
 	err = bucket.ForEachBucket(nil)
-	if !checkDbError(tc.t, testName, err, wantErrCode) {
+	if !CheckDbError(tc.t, testName, err, wantErrCode) {
 		return false
 	}
 
@@ -1751,7 +1642,7 @@ func testClosedTxInterface(tc *testContext, tx database.Tx) bool {
 	// Ensure Put returns expected error.
 	testName = "Put on closed tx"
 	err = bucket.Put(keyName, []byte("test"))
-	if !checkDbError(tc.t, testName, err, wantErrCode) {
+	if !CheckDbError(tc.t, testName, err, wantErrCode) {
 		return false
 	}
 
@@ -1769,7 +1660,7 @@ func testClosedTxInterface(tc *testContext, tx database.Tx) bool {
 	// Ensure Cursor.Delete returns expected error.
 	testName = "Cursor.Delete on closed tx"
 	err = cursor.Delete()
-	if !checkDbError(tc.t, testName, err, wantErrCode) {
+	if !CheckDbError(tc.t, testName, err, wantErrCode) {
 		return false
 	}
 
@@ -1851,21 +1742,21 @@ func testClosedTxInterface(tc *testContext, tx database.Tx) bool {
 		// Ensure StoreBlock returns expected error.
 		testName = "StoreBlock on closed tx"
 		err = tx.StoreBlock(block)
-		if !checkDbError(tc.t, testName, err, wantErrCode) {
+		if !CheckDbError(tc.t, testName, err, wantErrCode) {
 			return false
 		}
 
 		// Ensure FetchBlock returns expected error.
 		testName = fmt.Sprintf("FetchBlock #%d on closed tx", i)
 		_, err = tx.FetchBlock(blockHash)
-		if !checkDbError(tc.t, testName, err, wantErrCode) {
+		if !CheckDbError(tc.t, testName, err, wantErrCode) {
 			return false
 		}
 
 		// Ensure FetchBlockHeader returns expected error.
 		testName = fmt.Sprintf("FetchBlockHeader #%d on closed tx", i)
 		_, err = tx.FetchBlockHeader(blockHash)
-		if !checkDbError(tc.t, testName, err, wantErrCode) {
+		if !CheckDbError(tc.t, testName, err, wantErrCode) {
 			return false
 		}
 
@@ -1878,14 +1769,14 @@ func testClosedTxInterface(tc *testContext, tx database.Tx) bool {
 		}
 		allBlockRegions[i] = region
 		_, err = tx.FetchBlockRegion(&region)
-		if !checkDbError(tc.t, testName, err, wantErrCode) {
+		if !CheckDbError(tc.t, testName, err, wantErrCode) {
 			return false
 		}
 
 		// Ensure HasBlock returns expected error.
 		testName = fmt.Sprintf("HasBlock #%d on closed tx", i)
 		_, err = tx.HasBlock(blockHash)
-		if !checkDbError(tc.t, testName, err, wantErrCode) {
+		if !CheckDbError(tc.t, testName, err, wantErrCode) {
 			return false
 		}
 	}
@@ -1897,28 +1788,28 @@ func testClosedTxInterface(tc *testContext, tx database.Tx) bool {
 	// Ensure FetchBlocks returns expected error.
 	testName = "FetchBlocks on closed tx"
 	_, err = tx.FetchBlocks(allBlockHashes)
-	if !checkDbError(tc.t, testName, err, wantErrCode) {
+	if !CheckDbError(tc.t, testName, err, wantErrCode) {
 		return false
 	}
 
 	// Ensure FetchBlockHeaders returns expected error.
 	testName = "FetchBlockHeaders on closed tx"
 	_, err = tx.FetchBlockHeaders(allBlockHashes)
-	if !checkDbError(tc.t, testName, err, wantErrCode) {
+	if !CheckDbError(tc.t, testName, err, wantErrCode) {
 		return false
 	}
 
 	// Ensure FetchBlockRegions returns expected error.
 	testName = "FetchBlockRegions on closed tx"
 	_, err = tx.FetchBlockRegions(allBlockRegions)
-	if !checkDbError(tc.t, testName, err, wantErrCode) {
+	if !CheckDbError(tc.t, testName, err, wantErrCode) {
 		return false
 	}
 
 	// Ensure HasBlocks returns expected error.
 	testName = "HasBlocks on closed tx"
 	_, err = tx.HasBlocks(allBlockHashes)
-	if !checkDbError(tc.t, testName, err, wantErrCode) {
+	if !CheckDbError(tc.t, testName, err, wantErrCode) {
 		return false
 	}
 
@@ -1929,11 +1820,11 @@ func testClosedTxInterface(tc *testContext, tx database.Tx) bool {
 	// Ensure that attempting to rollback or commit a transaction that is
 	// already closed returns the expected error.
 	err = tx.Rollback()
-	if !checkDbError(tc.t, "closed tx rollback", err, wantErrCode) {
+	if !CheckDbError(tc.t, "closed tx rollback", err, wantErrCode) {
 		return false
 	}
 	err = tx.Commit()
-	return checkDbError(tc.t, "closed tx commit", err, wantErrCode)
+	return CheckDbError(tc.t, "closed tx commit", err, wantErrCode)
 }
 
 // testTxClosed ensures that both the metadata and block IO API functions behave
@@ -2260,9 +2151,9 @@ func testInterface(t *testing.T, db database.DB) {
 
 	// Load the test blocks and store in the test context for use throughout
 	// the tests.
-	blocks, err := loadBlocks(t, blockDataFile, blockDataNet)
+	blocks, err := LoadBlocks(t, BlockDataFile, BlockDataNet)
 	if err != nil {
-		t.Errorf("loadBlocks: Unexpected error: %v", err)
+		t.Errorf("LoadBlocks: Unexpected error: %v", err)
 		return
 	}
 	context.blocks = blocks
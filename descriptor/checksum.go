@@ -0,0 +1,118 @@
+// Copyright (c) 2021 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package descriptor
+
+import (
+	"fmt"
+	"strings"
+)
+
+const (
+	// inputCharset is the set of characters that may be used in a
+	// descriptor.  The position of a character determines the symbols it
+	// contributes to the checksum.
+	inputCharset = "0123456789()[],'/*abcdefgh@:$%{}" +
+		"IJKLMNOPQRSTUVWXYZ&+-.;<=>?!^_|~" +
+		"ijklmnopqrstuvwxyzABCDEFGH`#\"\\ "
+
+	// checksumCharset is the set of characters used to encode the checksum.
+	checksumCharset = "qpzry9x8gf2tvdw0s3jn54khce6mua7l"
+
+	// ChecksumLength is the number of characters of a descriptor checksum.
+	ChecksumLength = 8
+)
+
+// checksumGenerator is the generator of the BCH code the checksum is based on.
+var checksumGenerator = [5]uint64{
+	0xf5dee51989, 0xa9fdca3312, 0x1bab10e32d, 0x3706b1677a, 0x644d626ffd,
+}
+
+// polymod updates the passed checksum state with the passed symbol.
+func polymod(chk uint64, symbol uint64) uint64 {
+	top := chk >> 35
+	chk = (chk&0x7ffffffff)<<5 ^ symbol
+	for i := uint(0); i < 5; i++ {
+		if (top>>i)&1 == 1 {
+			chk ^= checksumGenerator[i]
+		}
+	}
+	return chk
+}
+
+// Checksum returns the checksum of the passed descriptor, which must not
+// include a checksum, as defined by BIP0380.
+func Checksum(desc string) (string, error) {
+	chk := uint64(1)
+	var groups [3]uint64
+	var numGroups int
+	for i := 0; i < len(desc); i++ {
+		pos := strings.IndexByte(inputCharset, desc[i])
+		if pos < 0 {
+			return "", fmt.Errorf("invalid character %q in descriptor",
+				desc[i])
+		}
+
+		// Each character contributes its lower 5 bits as a symbol and
+		// every group of three characters contributes an additional
+		// symbol composed of their upper bits.
+		chk = polymod(chk, uint64(pos&31))
+		groups[numGroups] = uint64(pos >> 5)
+		numGroups++
+		if numGroups == 3 {
+			chk = polymod(chk, groups[0]*9+groups[1]*3+groups[2])
+			numGroups = 0
+		}
+	}
+	switch numGroups {
+	case 1:
+		chk = polymod(chk, groups[0])
+	case 2:
+		chk = polymod(chk, groups[0]*3+groups[1])
+	}
+	for i := 0; i < ChecksumLength; i++ {
+		chk = polymod(chk, 0)
+	}
+	chk ^= 1
+
+	var checksum [ChecksumLength]byte
+	for i := range checksum {
+		checksum[i] = checksumCharset[(chk>>(5*(7-uint(i))))&31]
+	}
+	return string(checksum[:]), nil
+}
+
+// AddChecksum returns the passed descriptor, which must not include a
+// checksum, followed by its checksum.
+func AddChecksum(desc string) (string, error) {
+	checksum, err := Checksum(desc)
+	if err != nil {
+		return "", err
+	}
+	return desc + "#" + checksum, nil
+}
+
+// splitChecksum splits the passed descriptor into the descriptor and its
+// checksum, which is empty when the descriptor does not include one.  An error
+// is returned when the included checksum is invalid.
+func splitChecksum(desc string) (string, string, error) {
+	pos := strings.IndexByte(desc, '#')
+	if pos < 0 {
+		return desc, "", nil
+	}
+	desc, checksum := desc[:pos], desc[pos+1:]
+	if len(checksum) != ChecksumLength {
+		return "", "", fmt.Errorf("expected %d character checksum, "+
+			"not %d characters", ChecksumLength, len(checksum))
+	}
+	want, err := Checksum(desc)
+	if err != nil {
+		return "", "", err
+	}
+	if checksum != want {
+		return "", "", fmt.Errorf("provided checksum '%s' does not "+
+			"match computed checksum '%s'", checksum, want)
+	}
+	return desc, checksum, nil
+}
@@ -0,0 +1,461 @@
+// Copyright (c) 2021 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package descriptor
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/btcsuite/btcd/btcec"
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcd/txscript"
+	"github.com/btcsuite/btcutil"
+)
+
+const (
+	// MaxPubKeysPerMultiSig is the maximum number of keys allowed in a
+	// multi or sortedmulti expression.
+	MaxPubKeysPerMultiSig = 20
+
+	// maxPubKeysPerP2SHMultiSig is the maximum number of keys allowed in a
+	// multi or sortedmulti expression directly inside sh, which is bounded
+	// by the maximum size of the redeem script.
+	maxPubKeysPerP2SHMultiSig = 15
+)
+
+// Type identifies the kind of output script a descriptor describes.
+type Type int
+
+// These constants define the supported descriptor types.
+const (
+	// TypePKH describes pay-to-pubkey-hash outputs: pkh(KEY).
+	TypePKH Type = iota
+
+	// TypeWPKH describes pay-to-witness-pubkey-hash outputs: wpkh(KEY).
+	TypeWPKH
+
+	// TypeSHWPKH describes pay-to-witness-pubkey-hash outputs nested in
+	// pay-to-script-hash outputs: sh(wpkh(KEY)).
+	TypeSHWPKH
+
+	// TypeSHMulti describes multisig pay-to-script-hash outputs:
+	// sh(multi(...)) or sh(sortedmulti(...)).
+	TypeSHMulti
+
+	// TypeWSHMulti describes multisig pay-to-witness-script-hash outputs:
+	// wsh(multi(...)) or wsh(sortedmulti(...)).
+	TypeWSHMulti
+
+	// TypeSHWSHMulti describes multisig pay-to-witness-script-hash outputs
+	// nested in pay-to-script-hash outputs: sh(wsh(multi(...))) or
+	// sh(wsh(sortedmulti(...))).
+	TypeSHWSHMulti
+
+	// TypeAddr describes the output script paying to an address:
+	// addr(ADDR).
+	TypeAddr
+
+	// TypeRaw describes a raw output script: raw(HEX).
+	TypeRaw
+)
+
+// Descriptor is a parsed output script descriptor.  It describes a single
+// output script or, when ranged, a sequence of output scripts indexed by a
+// derivation index.
+type Descriptor struct {
+	params *chaincfg.Params
+	typ    Type
+	keys   []*keyExpr
+
+	// threshold and sorted describe the multisig expression of multisig
+	// descriptors.
+	threshold int
+	sorted    bool
+
+	// addr and script describe addr and raw descriptors respectively.
+	addr   btcutil.Address
+	script []byte
+}
+
+// Parse parses the passed descriptor for the passed network.  The descriptor
+// may include a checksum, which is validated when present.
+func Parse(desc string, params *chaincfg.Params) (*Descriptor, error) {
+	desc, _, err := splitChecksum(desc)
+	if err != nil {
+		return nil, err
+	}
+
+	d := &Descriptor{params: params}
+	name, inner, err := splitFunc(desc)
+	if err != nil {
+		return nil, err
+	}
+	switch name {
+	case "pkh":
+		d.typ = TypePKH
+		err = d.parseKeys(inner, true)
+
+	case "wpkh":
+		d.typ = TypeWPKH
+		err = d.parseKeys(inner, false)
+
+	case "wsh":
+		d.typ = TypeWSHMulti
+		err = d.parseMulti(inner, false, MaxPubKeysPerMultiSig)
+
+	case "addr":
+		d.typ = TypeAddr
+		d.addr, err = btcutil.DecodeAddress(inner, params)
+		if err != nil {
+			break
+		}
+		// Hex encoded public keys are decoded as pay-to-pubkey
+		// addresses, which are not addresses in the usual sense.
+		if _, ok := d.addr.(*btcutil.AddressPubKey); ok {
+			err = fmt.Errorf("'%s' is not a valid address", inner)
+		} else if !d.addr.IsForNet(params) {
+			err = fmt.Errorf("address '%s' is not for network %s",
+				inner, params.Name)
+		}
+
+	case "raw":
+		d.typ = TypeRaw
+		d.script, err = hex.DecodeString(inner)
+		if err == nil && len(d.script) == 0 {
+			err = errors.New("raw script must not be empty")
+		}
+
+	case "sh":
+		innerName, innerArgs, err := splitFunc(inner)
+		if err != nil {
+			return nil, err
+		}
+		switch innerName {
+		case "wpkh":
+			d.typ = TypeSHWPKH
+			err = d.parseKeys(innerArgs, false)
+
+		case "wsh":
+			d.typ = TypeSHWSHMulti
+			err = d.parseMulti(innerArgs, false,
+				MaxPubKeysPerMultiSig)
+
+		case "multi", "sortedmulti":
+			d.typ = TypeSHMulti
+			err = d.parseMulti(inner, true,
+				maxPubKeysPerP2SHMultiSig)
+			if err == nil && d.multiSigScriptLen() >
+				txscript.MaxScriptElementSize {
+
+				err = errors.New("redeem script exceeds the " +
+					"maximum script element size")
+			}
+
+		default:
+			err = fmt.Errorf("'%s' is not supported inside sh()",
+				innerName)
+		}
+		if err != nil {
+			return nil, err
+		}
+
+	default:
+		err = fmt.Errorf("'%s' descriptors are not supported", name)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return d, nil
+}
+
+// splitFunc splits an expression in the name(args) format into its name and
+// arguments.
+func splitFunc(expr string) (string, string, error) {
+	open := strings.IndexByte(expr, '(')
+	if open <= 0 || !strings.HasSuffix(expr, ")") {
+		return "", "", fmt.Errorf("'%s' is not a valid script expression",
+			expr)
+	}
+	return expr[:open], expr[open+1 : len(expr)-1], nil
+}
+
+// parseKeys parses the single key expression of pkh and wpkh descriptors.
+func (d *Descriptor) parseKeys(expr string, allowUncompressed bool) error {
+	key, err := parseKeyExpr(expr, d.params, allowUncompressed)
+	if err != nil {
+		return err
+	}
+	d.keys = []*keyExpr{key}
+	return nil
+}
+
+// parseMulti parses a multi or sortedmulti expression with at most maxKeys
+// keys.
+func (d *Descriptor) parseMulti(expr string, allowUncompressed bool, maxKeys int) error {
+	name, args, err := splitFunc(expr)
+	if err != nil {
+		return err
+	}
+	switch name {
+	case "multi":
+	case "sortedmulti":
+		d.sorted = true
+	default:
+		return fmt.Errorf("'%s' is not supported, expected multi or "+
+			"sortedmulti", name)
+	}
+
+	elems := strings.Split(args, ",")
+	if len(elems) < 2 {
+		return fmt.Errorf("%s requires a threshold and at least one key",
+			name)
+	}
+	threshold, err := strconv.Atoi(elems[0])
+	if err != nil {
+		return fmt.Errorf("multi threshold '%s' is not valid", elems[0])
+	}
+	numKeys := len(elems) - 1
+	if numKeys > maxKeys {
+		return fmt.Errorf("cannot have %d keys in multisig, at most %d "+
+			"are allowed", numKeys, maxKeys)
+	}
+	if threshold < 1 || threshold > numKeys {
+		return fmt.Errorf("multisig threshold %d is out of range for %d "+
+			"keys", threshold, numKeys)
+	}
+	for _, elem := range elems[1:] {
+		key, err := parseKeyExpr(elem, d.params, allowUncompressed)
+		if err != nil {
+			return err
+		}
+		d.keys = append(d.keys, key)
+	}
+	d.threshold = threshold
+	return nil
+}
+
+// Type returns the type of the descriptor.
+func (d *Descriptor) Type() Type {
+	return d.typ
+}
+
+// IsRange returns whether the descriptor describes a sequence of output
+// scripts indexed by a derivation index.
+func (d *Descriptor) IsRange() bool {
+	for _, key := range d.keys {
+		if key.wildcard != wildcardNone {
+			return true
+		}
+	}
+	return false
+}
+
+// IsSolvable returns whether the descriptor contains all information needed to
+// sign for its output scripts, given the private keys, which is the case for
+// all descriptors except addr and raw descriptors.
+func (d *Descriptor) IsSolvable() bool {
+	return d.typ != TypeAddr && d.typ != TypeRaw
+}
+
+// HasPrivateKeys returns whether any key of the descriptor was provided as
+// private key.
+func (d *Descriptor) HasPrivateKeys() bool {
+	for _, key := range d.keys {
+		if key.hasPrivateKey {
+			return true
+		}
+	}
+	return false
+}
+
+// String returns the canonical form of the descriptor without checksum, in
+// which private keys are replaced by their public keys.
+func (d *Descriptor) String() string {
+	switch d.typ {
+	case TypeAddr:
+		return "addr(" + d.addr.EncodeAddress() + ")"
+	case TypeRaw:
+		return "raw(" + hex.EncodeToString(d.script) + ")"
+	}
+
+	var inner string
+	if d.threshold != 0 {
+		keys := make([]string, 0, len(d.keys)+1)
+		keys = append(keys, strconv.Itoa(d.threshold))
+		for _, key := range d.keys {
+			keys = append(keys, key.String())
+		}
+		name := "multi"
+		if d.sorted {
+			name = "sortedmulti"
+		}
+		inner = name + "(" + strings.Join(keys, ",") + ")"
+	} else {
+		inner = d.keys[0].String()
+	}
+
+	switch d.typ {
+	case TypePKH:
+		return "pkh(" + inner + ")"
+	case TypeWPKH:
+		return "wpkh(" + inner + ")"
+	case TypeSHWPKH:
+		return "sh(wpkh(" + inner + "))"
+	case TypeSHMulti:
+		return "sh(" + inner + ")"
+	case TypeWSHMulti:
+		return "wsh(" + inner + ")"
+	default:
+		return "sh(wsh(" + inner + "))"
+	}
+}
+
+// multiSigScriptLen returns the length of the multisig script of multisig
+// descriptors, which is the same for all derivation indexes.
+func (d *Descriptor) multiSigScriptLen() int {
+	// The threshold, number of keys, and OP_CHECKMULTISIG opcodes along
+	// with a data push of every key.
+	scriptLen := 3
+	for _, key := range d.keys {
+		if key.extKey != nil {
+			scriptLen += 1 + btcec.PubKeyBytesLenCompressed
+		} else {
+			scriptLen += 1 + len(key.pubKey)
+		}
+	}
+	return scriptLen
+}
+
+// multiSigScript returns the multisig script of multisig descriptors at the
+// passed derivation index.
+func (d *Descriptor) multiSigScript(index uint32) ([]byte, error) {
+	pubKeys := make([][]byte, 0, len(d.keys))
+	for _, key := range d.keys {
+		pubKey, err := key.pubKeyAt(index)
+		if err != nil {
+			return nil, err
+		}
+		pubKeys = append(pubKeys, pubKey)
+	}
+	if d.sorted {
+		sort.Slice(pubKeys, func(i, j int) bool {
+			return bytes.Compare(pubKeys[i], pubKeys[j]) < 0
+		})
+	}
+
+	builder := txscript.NewScriptBuilder().AddInt64(int64(d.threshold))
+	for _, pubKey := range pubKeys {
+		builder.AddData(pubKey)
+	}
+	builder.AddInt64(int64(len(pubKeys)))
+	builder.AddOp(txscript.OP_CHECKMULTISIG)
+	return builder.Script()
+}
+
+// Address returns the address of the output script the descriptor describes
+// at the passed derivation index.  The index is ignored for descriptors that
+// are not ranged.
+func (d *Descriptor) Address(index uint32) (btcutil.Address, error) {
+	switch d.typ {
+	case TypeAddr:
+		return d.addr, nil
+
+	case TypeRaw:
+		class, addrs, _, err := txscript.ExtractPkScriptAddrs(d.script,
+			d.params)
+		if err != nil || len(addrs) != 1 ||
+			class == txscript.MultiSigTy {
+
+			return nil, errors.New("raw script does not pay to an " +
+				"address")
+		}
+		return addrs[0], nil
+	}
+
+	if d.threshold != 0 {
+		script, err := d.multiSigScript(index)
+		if err != nil {
+			return nil, err
+		}
+		switch d.typ {
+		case TypeSHMulti:
+			return btcutil.NewAddressScriptHash(script, d.params)
+
+		case TypeWSHMulti:
+			scriptHash := sha256.Sum256(script)
+			return btcutil.NewAddressWitnessScriptHash(scriptHash[:],
+				d.params)
+
+		default:
+			scriptHash := sha256.Sum256(script)
+			witnessScript, err := txscript.NewScriptBuilder().
+				AddOp(txscript.OP_0).AddData(scriptHash[:]).Script()
+			if err != nil {
+				return nil, err
+			}
+			return btcutil.NewAddressScriptHash(witnessScript, d.params)
+		}
+	}
+
+	pubKey, err := d.keys[0].pubKeyAt(index)
+	if err != nil {
+		return nil, err
+	}
+	pubKeyHash := btcutil.Hash160(pubKey)
+	switch d.typ {
+	case TypePKH:
+		return btcutil.NewAddressPubKeyHash(pubKeyHash, d.params)
+
+	case TypeWPKH:
+		return btcutil.NewAddressWitnessPubKeyHash(pubKeyHash, d.params)
+
+	default:
+		witnessScript, err := txscript.NewScriptBuilder().
+			AddOp(txscript.OP_0).AddData(pubKeyHash).Script()
+		if err != nil {
+			return nil, err
+		}
+		return btcutil.NewAddressScriptHash(witnessScript, d.params)
+	}
+}
+
+// Script returns the output script the descriptor describes at the passed
+// derivation index.  The index is ignored for descriptors that are not ranged.
+func (d *Descriptor) Script(index uint32) ([]byte, error) {
+	if d.typ == TypeRaw {
+		script := make([]byte, len(d.script))
+		copy(script, d.script)
+		return script, nil
+	}
+
+	addr, err := d.Address(index)
+	if err != nil {
+		return nil, err
+	}
+	return txscript.PayToAddrScript(addr)
+}
+
+// Derive returns the descriptor describing the output script at the passed
+// derivation index, in which every extended key is replaced by the public key
+// derived from it along with the origin of the derived key.  Descriptors that
+// are not ranged and do not contain extended keys are returned unchanged.
+func (d *Descriptor) Derive(index uint32) (*Descriptor, error) {
+	derived := *d
+	derived.keys = make([]*keyExpr, 0, len(d.keys))
+	for _, key := range d.keys {
+		derivedKey, err := key.derive(index)
+		if err != nil {
+			return nil, err
+		}
+		derived.keys = append(derived.keys, derivedKey)
+	}
+	return &derived, nil
+}
@@ -0,0 +1,424 @@
+// Copyright (c) 2021 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package descriptor
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"strings"
+	"testing"
+
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcd/txscript"
+	"github.com/btcsuite/btcutil"
+	"github.com/btcsuite/btcutil/hdkeychain"
+)
+
+const (
+	// pubKey1 and pubKey2 are the compressed public keys for the private
+	// keys 1 and 2.
+	pubKey1 = "0279be667ef9dcbbac55a06295ce870b07029bfcdb2dce28d959f2815b16f81798"
+	pubKey2 = "02c6047f9441ed7d6d3045406e95c07cd85c778e4b8cef3ca7abac09b95c709ee5"
+)
+
+// hexToBytes converts the passed hex string into bytes and will panic if there
+// is an error.  This is only provided for the hard-coded constants so errors in
+// the source code can be detected.
+func hexToBytes(s string) []byte {
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		panic("invalid hex in source file: " + s)
+	}
+	return b
+}
+
+// testMasterKey returns the master key of the first BIP0032 test vector.
+func testMasterKey(t *testing.T) *hdkeychain.ExtendedKey {
+	seed := hexToBytes("000102030405060708090a0b0c0d0e0f")
+	master, err := hdkeychain.NewMaster(seed, &chaincfg.MainNetParams)
+	if err != nil {
+		t.Fatalf("NewMaster: unexpected error: %v", err)
+	}
+	return master
+}
+
+// TestChecksum ensures descriptor checksums are computed and validated as
+// specified by BIP0380.
+func TestChecksum(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		desc     string
+		checksum string
+	}{
+		{"raw(deadbeef)", "89f8spxm"},
+		{"pkh(" + pubKey1 + ")", "e48zzw02"},
+	}
+	for _, test := range tests {
+		checksum, err := Checksum(test.desc)
+		if err != nil {
+			t.Errorf("Checksum(%q): unexpected error: %v", test.desc, err)
+			continue
+		}
+		if checksum != test.checksum {
+			t.Errorf("Checksum(%q): got %s, want %s", test.desc,
+				checksum, test.checksum)
+			continue
+		}
+		desc, gotChecksum, err := splitChecksum(test.desc + "#" + checksum)
+		if err != nil || desc != test.desc || gotChecksum != checksum {
+			t.Errorf("splitChecksum(%q): got %q, %q, %v", test.desc,
+				desc, gotChecksum, err)
+		}
+	}
+
+	// Ensure invalid checksums and characters are rejected.
+	invalid := []string{
+		"raw(deadbeef)#89f8spxn",
+		"raw(deadbeef)#89f8spx",
+		"raw(deadbeef)#",
+		"raw(deadbeef\x01)#89f8spxm",
+	}
+	for _, desc := range invalid {
+		if _, _, err := splitChecksum(desc); err == nil {
+			t.Errorf("splitChecksum(%q): expected error", desc)
+		}
+	}
+}
+
+// TestParse ensures descriptors are parsed into the expected canonical form
+// and output scripts.
+func TestParse(t *testing.T) {
+	t.Parallel()
+
+	master := testMasterKey(t)
+	xprv := master.String()
+	xpubKey, err := master.Neuter()
+	if err != nil {
+		t.Fatalf("Neuter: unexpected error: %v", err)
+	}
+	xpub := xpubKey.String()
+
+	pubKeyHash1 := hexToBytes("751e76e8199196d454941c45d1b3a323f1433bd6")
+	multiScript := func(keys ...string) []byte {
+		builder := txscript.NewScriptBuilder().AddInt64(1)
+		for _, key := range keys {
+			builder.AddData(hexToBytes(key))
+		}
+		script, _ := builder.AddInt64(int64(len(keys))).
+			AddOp(txscript.OP_CHECKMULTISIG).Script()
+		return script
+	}
+	p2sh := func(script []byte) []byte {
+		return append(append([]byte{txscript.OP_HASH160, txscript.OP_DATA_20},
+			btcutil.Hash160(script)...), txscript.OP_EQUAL)
+	}
+	p2wsh := func(script []byte) []byte {
+		witnessScript, _ := txscript.NewScriptBuilder().
+			AddOp(txscript.OP_0).AddData(sha256Hash(script)).Script()
+		return witnessScript
+	}
+	p2wpkh := append([]byte{txscript.OP_0, txscript.OP_DATA_20},
+		pubKeyHash1...)
+
+	tests := []struct {
+		name      string
+		desc      string
+		canonical string
+		isRange   bool
+		index     uint32
+		script    []byte
+	}{
+		{
+			name:      "pkh",
+			desc:      "pkh(" + pubKey1 + ")",
+			canonical: "pkh(" + pubKey1 + ")",
+			script:    p2pkhScript(hexToBytes(pubKey1)),
+		},
+		{
+			name:      "wpkh with checksum",
+			desc:      "wpkh(" + pubKey1 + ")#" + mustChecksum("wpkh("+pubKey1+")"),
+			canonical: "wpkh(" + pubKey1 + ")",
+			script:    p2wpkh,
+		},
+		{
+			name:      "sh(wpkh) with key origin",
+			desc:      "sh(wpkh([d34db33f/49h/0h/0h]" + pubKey1 + "))",
+			canonical: "sh(wpkh([d34db33f/49'/0'/0']" + pubKey1 + "))",
+			script:    p2sh(p2wpkh),
+		},
+		{
+			name:      "sh(multi)",
+			desc:      "sh(multi(1," + pubKey2 + "," + pubKey1 + "))",
+			canonical: "sh(multi(1," + pubKey2 + "," + pubKey1 + "))",
+			script:    p2sh(multiScript(pubKey2, pubKey1)),
+		},
+		{
+			name:      "wsh(sortedmulti)",
+			desc:      "wsh(sortedmulti(1," + pubKey2 + "," + pubKey1 + "))",
+			canonical: "wsh(sortedmulti(1," + pubKey2 + "," + pubKey1 + "))",
+			script:    p2wsh(multiScript(pubKey1, pubKey2)),
+		},
+		{
+			name:      "sh(wsh(multi))",
+			desc:      "sh(wsh(multi(1," + pubKey1 + "," + pubKey2 + ")))",
+			canonical: "sh(wsh(multi(1," + pubKey1 + "," + pubKey2 + ")))",
+			script:    p2sh(p2wsh(multiScript(pubKey1, pubKey2))),
+		},
+		{
+			// BIP0032 test vector 1 chain m/0'/1.
+			name:      "xprv with hardened path",
+			desc:      "pkh(" + xprv + "/0h/1)",
+			canonical: "pkh(" + xpub + "/0'/1)",
+			script: p2pkhScript(hexToBytes("03501e454bf00751f24b1b489a" +
+				"a925215d66af2234e3891c3b21a52bedb3cd711c")),
+		},
+		{
+			// BIP0032 test vector 1 chain m/0'/1/2'.
+			name:      "ranged wpkh with hardened wildcard",
+			desc:      "wpkh(" + xprv + "/0'/1/*')",
+			canonical: "wpkh(" + xpub + "/0'/1/*')",
+			isRange:   true,
+			index:     2,
+			script: append([]byte{txscript.OP_0, txscript.OP_DATA_20},
+				btcutil.Hash160(hexToBytes("0357bfe1e341d01c69fe56543099"+
+					"56cbea516822fba8a601743a012a7896ee8dc2"))...),
+		},
+	}
+	for _, test := range tests {
+		d, err := Parse(test.desc, &chaincfg.MainNetParams)
+		if err != nil {
+			t.Errorf("%s: Parse: unexpected error: %v", test.name, err)
+			continue
+		}
+		if got := d.String(); got != test.canonical {
+			t.Errorf("%s: String: got %s, want %s", test.name, got,
+				test.canonical)
+		}
+		if d.IsRange() != test.isRange {
+			t.Errorf("%s: IsRange: got %v, want %v", test.name,
+				d.IsRange(), test.isRange)
+		}
+		script, err := d.Script(test.index)
+		if err != nil {
+			t.Errorf("%s: Script: unexpected error: %v", test.name, err)
+			continue
+		}
+		if !bytes.Equal(script, test.script) {
+			t.Errorf("%s: Script: got %x, want %x", test.name, script,
+				test.script)
+		}
+	}
+
+	// Ensure addr and raw descriptors describe the scripts of their address
+	// and hex script respectively.
+	addr, err := btcutil.NewAddressWitnessPubKeyHash(pubKeyHash1,
+		&chaincfg.MainNetParams)
+	if err != nil {
+		t.Fatalf("NewAddressWitnessPubKeyHash: unexpected error: %v", err)
+	}
+	for _, desc := range []string{
+		"addr(" + addr.EncodeAddress() + ")",
+		"raw(" + hex.EncodeToString(p2wpkh) + ")",
+	} {
+		d, err := Parse(desc, &chaincfg.MainNetParams)
+		if err != nil {
+			t.Errorf("Parse(%q): unexpected error: %v", desc, err)
+			continue
+		}
+		if d.String() != desc || d.IsSolvable() || d.IsRange() {
+			t.Errorf("Parse(%q): got %s, solvable %v, range %v", desc,
+				d.String(), d.IsSolvable(), d.IsRange())
+		}
+		script, err := d.Script(0)
+		if err != nil || !bytes.Equal(script, p2wpkh) {
+			t.Errorf("Script(%q): got %x, %v, want %x", desc, script,
+				err, p2wpkh)
+		}
+		gotAddr, err := d.Address(0)
+		if err != nil || gotAddr.EncodeAddress() != addr.EncodeAddress() {
+			t.Errorf("Address(%q): got %v, %v, want %v", desc, gotAddr,
+				err, addr)
+		}
+	}
+
+	// Ensure derived descriptors replace extended keys by the derived
+	// public keys along with their origin.
+	ranged, err := Parse("wpkh("+xprv+"/0'/1/*')", &chaincfg.MainNetParams)
+	if err != nil {
+		t.Fatalf("Parse: unexpected error: %v", err)
+	}
+	derived, err := ranged.Derive(2)
+	if err != nil {
+		t.Fatalf("Derive: unexpected error: %v", err)
+	}
+	want := "wpkh([3442193e/0'/1/2']0357bfe1e341d01c69fe5654309956cbea5168" +
+		"22fba8a601743a012a7896ee8dc2)"
+	if derived.String() != want || derived.IsRange() {
+		t.Errorf("Derive: got %s, range %v, want %s", derived.String(),
+			derived.IsRange(), want)
+	}
+	withOrigin, err := Parse("sh(multi(1,[d34db33f/48']"+xpub+"/1/*,"+
+		pubKey1+"))", &chaincfg.MainNetParams)
+	if err != nil {
+		t.Fatalf("Parse: unexpected error: %v", err)
+	}
+	derived, err = withOrigin.Derive(7)
+	if err != nil {
+		t.Fatalf("Derive: unexpected error: %v", err)
+	}
+	if !strings.HasPrefix(derived.String(), "sh(multi(1,[d34db33f/48'/1/7]") {
+		t.Errorf("Derive: got %s, want origin [d34db33f/48'/1/7]",
+			derived.String())
+	}
+	for _, d := range []*Descriptor{ranged, withOrigin} {
+		derived, _ := d.Derive(7)
+		script, _ := d.Script(7)
+		derivedScript, err := derived.Script(0)
+		if err != nil || !bytes.Equal(script, derivedScript) {
+			t.Errorf("Derive(%s): got script %x, %v, want %x", d,
+				derivedScript, err, script)
+		}
+	}
+
+	// Ensure ranged descriptors of extended public keys derive the same
+	// scripts as those of the corresponding private keys.
+	pubDesc, err := Parse("wpkh("+xpub+"/1/*)", &chaincfg.MainNetParams)
+	if err != nil {
+		t.Fatalf("Parse: unexpected error: %v", err)
+	}
+	privDesc, err := Parse("wpkh("+xprv+"/1/*)", &chaincfg.MainNetParams)
+	if err != nil {
+		t.Fatalf("Parse: unexpected error: %v", err)
+	}
+	if pubDesc.HasPrivateKeys() || !privDesc.HasPrivateKeys() {
+		t.Fatal("HasPrivateKeys: unexpected result")
+	}
+	for i := uint32(0); i < 3; i++ {
+		pubScript, _ := pubDesc.Script(i)
+		privScript, _ := privDesc.Script(i)
+		if !bytes.Equal(pubScript, privScript) {
+			t.Errorf("Script(%d): got %x, want %x", i, pubScript,
+				privScript)
+		}
+	}
+}
+
+// TestChildKeyCache ensures the public keys derived at the derivation indexes
+// of ranged descriptors are cached and match the keys derived along the full
+// path.
+func TestChildKeyCache(t *testing.T) {
+	t.Parallel()
+
+	master := testMasterKey(t)
+	desc, err := Parse("pkh("+master.String()+"/0'/1/*)",
+		&chaincfg.MainNetParams)
+	if err != nil {
+		t.Fatalf("Parse: unexpected error: %v", err)
+	}
+	key := desc.keys[0]
+	for i := uint32(0); i < 3; i++ {
+		extKey := master
+		for _, step := range []uint32{hdkeychain.HardenedKeyStart, 1, i} {
+			extKey, err = extKey.Derive(step)
+			if err != nil {
+				t.Fatalf("Derive: unexpected error: %v", err)
+			}
+		}
+		pubKey, err := extKey.ECPubKey()
+		if err != nil {
+			t.Fatalf("ECPubKey: unexpected error: %v", err)
+		}
+		want := pubKey.SerializeCompressed()
+
+		// Derive the key twice to ensure the cached key is returned
+		// the second time.
+		for j := 0; j < 2; j++ {
+			got, err := key.pubKeyAt(i)
+			if err != nil || !bytes.Equal(got, want) {
+				t.Fatalf("pubKeyAt(%d): got %x, %v, want %x", i,
+					got, err, want)
+			}
+		}
+		if !bytes.Equal(key.childKeys[i], want) {
+			t.Fatalf("pubKeyAt(%d): key not cached", i)
+		}
+	}
+	if len(key.childKeys) != 3 {
+		t.Fatalf("got %d cached keys, want 3", len(key.childKeys))
+	}
+}
+
+// TestParseErrors ensures invalid descriptors are rejected.
+func TestParseErrors(t *testing.T) {
+	t.Parallel()
+
+	xpubKey, err := testMasterKey(t).Neuter()
+	if err != nil {
+		t.Fatalf("Neuter: unexpected error: %v", err)
+	}
+	xpub := xpubKey.String()
+	uncompressed := "0479be667ef9dcbbac55a06295ce870b07029bfcdb2dce28d959f" +
+		"2815b16f81798483ada7726a3c4655da4fbfc0e1108a8fd17b448a68554199c" +
+		"47d08ffb10d4b8"
+
+	tests := []struct {
+		name string
+		desc string
+	}{
+		{"unsupported script", "combo(" + pubKey1 + ")"},
+		{"empty raw script", "raw()"},
+		{"invalid address", "addr(" + pubKey1 + ")"},
+		{"bad checksum", "pkh(" + pubKey1 + ")#e48zzw03"},
+		{"invalid pubkey", "pkh(02" + pubKey1[4:] + "00)"},
+		{"uncompressed wpkh", "wpkh(" + uncompressed + ")"},
+		{"uncompressed wsh", "wsh(multi(1," + uncompressed + "))"},
+		{"hardened from xpub", "wpkh(" + xpub + "/0'/*)"},
+		{"hardened wildcard from xpub", "wpkh(" + xpub + "/*')"},
+		{"wildcard not last", "wpkh(" + xpub + "/*/0)"},
+		{"bad fingerprint", "wpkh([d34db3/0]" + pubKey1 + ")"},
+		{"unterminated origin", "wpkh([d34db33f/0" + pubKey1 + ")"},
+		{"threshold too high", "wsh(multi(3," + pubKey1 + "," + pubKey2 + "))"},
+		{"zero threshold", "wsh(multi(0," + pubKey1 + "))"},
+		{"redeem script too large", "sh(multi(1" + strings.Repeat(","+uncompressed, 8) + "))"},
+		{"unsupported in sh", "sh(pkh(" + pubKey1 + "))"},
+		{"unsupported in wsh", "wsh(wpkh(" + pubKey1 + "))"},
+		{"wrong network", "wpkh(" + xpub + "/0)"},
+	}
+	for _, test := range tests {
+		params := &chaincfg.MainNetParams
+		if test.name == "wrong network" {
+			params = &chaincfg.TestNet3Params
+		}
+		if _, err := Parse(test.desc, params); err == nil {
+			t.Errorf("%s: Parse(%q): expected error", test.name, test.desc)
+		}
+	}
+}
+
+// mustChecksum returns the checksum of the passed descriptor and will panic if
+// there is an error.  This is only provided for the hard-coded constants so
+// errors in the source code can be detected.
+func mustChecksum(desc string) string {
+	checksum, err := Checksum(desc)
+	if err != nil {
+		panic("invalid descriptor in source file: " + desc)
+	}
+	return checksum
+}
+
+// p2pkhScript returns the pay-to-pubkey-hash script of the passed public key.
+func p2pkhScript(pubKey []byte) []byte {
+	script := []byte{txscript.OP_DUP, txscript.OP_HASH160, txscript.OP_DATA_20}
+	script = append(script, btcutil.Hash160(pubKey)...)
+	return append(script, txscript.OP_EQUALVERIFY, txscript.OP_CHECKSIG)
+}
+
+// sha256Hash returns the single SHA256 hash of the passed data.
+func sha256Hash(b []byte) []byte {
+	hash := sha256.Sum256(b)
+	return hash[:]
+}
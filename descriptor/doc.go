@@ -0,0 +1,44 @@
+// Copyright (c) 2021 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+/*
+Package descriptor implements parsing of output script descriptors as defined
+by BIP0380 and the address and script derivation they describe.
+
+Descriptor Overview
+
+An output script descriptor is a human readable description of a set of output
+scripts, along with an optional 8 character checksum separated by a '#'
+character.  The following script expressions are supported:
+
+  - pkh(KEY):                  pay-to-pubkey-hash
+  - wpkh(KEY):                 pay-to-witness-pubkey-hash
+  - sh(wpkh(KEY)):             pay-to-witness-pubkey-hash nested in
+                               pay-to-script-hash
+  - sh(multi(k,KEY,...)):      multisig pay-to-script-hash
+  - wsh(multi(k,KEY,...)):     multisig pay-to-witness-script-hash
+  - sh(wsh(multi(k,KEY,...))): multisig pay-to-witness-script-hash nested in
+                               pay-to-script-hash
+  - addr(ADDR):                the output script paying to an address
+  - raw(HEX):                  a hex encoded output script
+
+The sortedmulti expression may be used instead of multi, in which case the
+public keys are sorted lexicographically when building the script.
+
+Key Expressions
+
+A KEY is a hex encoded public key, a private key in WIF, or an extended public
+or private key followed by a derivation path, optionally preceded by key origin
+information in the [fingerprint/path] format.  A derivation path may end with
+a '*' wildcard, which makes the descriptor ranged: it then describes one output
+script for every derivation index.  Hardened derivation steps are marked by a
+trailing ' or h character and require an extended private key.
+
+Private keys are only used to derive public keys and are never included when a
+descriptor is converted back to its canonical string form.  The descriptor of a
+single output script of a ranged descriptor, in which extended keys are
+replaced by the derived public keys along with their origin, is returned by
+Derive.
+*/
+package descriptor
@@ -0,0 +1,336 @@
+// Copyright (c) 2021 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package descriptor
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/btcsuite/btcd/btcec"
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcutil"
+	"github.com/btcsuite/btcutil/hdkeychain"
+)
+
+// wildcard describes whether and how the last derivation step of an extended
+// key expression is replaced by the derivation index.
+type wildcard int
+
+const (
+	wildcardNone wildcard = iota
+	wildcardUnhardened
+	wildcardHardened
+)
+
+// keyExpr is a parsed key expression of a descriptor.  It is either a fixed
+// public key, a fixed private key in WIF, or an extended key along with the
+// derivation path to apply to it.
+type keyExpr struct {
+	// origin is the key origin information including the surrounding
+	// brackets or empty when the key has none.
+	origin string
+
+	// pubKey is the serialized public key of fixed keys and of extended
+	// keys without wildcard.
+	pubKey []byte
+
+	// extKey, path and wildcard describe extended keys.
+	extKey   *hdkeychain.ExtendedKey
+	path     []uint32
+	wildcard wildcard
+
+	// pathKey is the extended key derived from extKey along path, from
+	// which the keys at the derivation indexes of ranged descriptors are
+	// derived.
+	pathKey *hdkeychain.ExtendedKey
+
+	// childKeys caches the serialized public keys derived from pathKey at
+	// the derivation indexes of ranged descriptors.  It is protected by
+	// childKeysMtx.
+	childKeysMtx sync.Mutex
+	childKeys    map[uint32][]byte
+
+	// hasPrivateKey specifies whether the key was provided as private key.
+	hasPrivateKey bool
+}
+
+// parseKeyExpr parses a key expression.  Uncompressed public keys are rejected
+// unless allowUncompressed is set.
+func parseKeyExpr(s string, params *chaincfg.Params, allowUncompressed bool) (*keyExpr, error) {
+	key := &keyExpr{}
+
+	// Parse the optional key origin in the [fingerprint/path] format.
+	if strings.HasPrefix(s, "[") {
+		end := strings.IndexByte(s, ']')
+		if end < 0 {
+			return nil, errors.New("key origin start '[' character " +
+				"without matching ']' character")
+		}
+		origin := s[1:end]
+		elems := strings.Split(origin, "/")
+		fingerprint, err := hex.DecodeString(elems[0])
+		if err != nil || len(fingerprint) != 4 {
+			return nil, fmt.Errorf("fingerprint '%s' is not 4 bytes "+
+				"hex encoded", elems[0])
+		}
+		if _, _, err := parsePath(elems[1:], false); err != nil {
+			return nil, err
+		}
+		key.origin = "[" + normalizeHardened(origin) + "]"
+		s = s[end+1:]
+	}
+	if s == "" {
+		return nil, errors.New("no key provided")
+	}
+
+	elems := strings.Split(s, "/")
+	if len(elems) == 1 {
+		return parseFixedKey(key, s, params, allowUncompressed)
+	}
+
+	extKey, err := hdkeychain.NewKeyFromString(elems[0])
+	if err != nil {
+		return nil, fmt.Errorf("key '%s' is not valid", elems[0])
+	}
+	if !extKey.IsForNet(params) {
+		return nil, fmt.Errorf("extended key '%s' is not for network %s",
+			elems[0], params.Name)
+	}
+	key.extKey = extKey
+	key.hasPrivateKey = extKey.IsPrivate()
+	key.path, key.wildcard, err = parsePath(elems[1:], true)
+	if err != nil {
+		return nil, err
+	}
+
+	// Hardened derivation requires the private key.
+	hardened := key.wildcard == wildcardHardened
+	for _, step := range key.path {
+		hardened = hardened || step >= hdkeychain.HardenedKeyStart
+	}
+	if hardened && !key.hasPrivateKey {
+		return nil, errors.New("hardened derivation requires an " +
+			"extended private key")
+	}
+
+	key.pathKey = extKey
+	for _, step := range key.path {
+		key.pathKey, err = key.pathKey.Derive(step)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// The public key of extended keys without wildcard is fixed, so it is
+	// only derived once.
+	if key.wildcard == wildcardNone {
+		pubKey, err := key.pathKey.ECPubKey()
+		if err != nil {
+			return nil, err
+		}
+		key.pubKey = pubKey.SerializeCompressed()
+	} else {
+		key.childKeys = make(map[uint32][]byte)
+	}
+	return key, nil
+}
+
+// parseFixedKey parses a hex encoded public key or a private key in WIF into
+// the passed key expression.
+func parseFixedKey(key *keyExpr, s string, params *chaincfg.Params,
+	allowUncompressed bool) (*keyExpr, error) {
+
+	if pubKey, err := hex.DecodeString(s); err == nil {
+		if _, err := btcec.ParsePubKey(pubKey, btcec.S256()); err != nil {
+			return nil, fmt.Errorf("pubkey '%s' is invalid", s)
+		}
+		if len(pubKey) != btcec.PubKeyBytesLenCompressed &&
+			!allowUncompressed {
+
+			return nil, errors.New("uncompressed keys are not " +
+				"allowed")
+		}
+		key.pubKey = pubKey
+		return key, nil
+	}
+
+	wif, err := btcutil.DecodeWIF(s)
+	if err != nil {
+		return nil, fmt.Errorf("key '%s' is not valid", s)
+	}
+	if !wif.IsForNet(params) {
+		return nil, fmt.Errorf("private key '%s' is not for network %s",
+			s, params.Name)
+	}
+	if !wif.CompressPubKey && !allowUncompressed {
+		return nil, errors.New("uncompressed keys are not allowed")
+	}
+	key.pubKey = wif.SerializePubKey()
+	key.hasPrivateKey = true
+	return key, nil
+}
+
+// parsePath parses the elements of a derivation path.  A trailing wildcard is
+// only accepted when allowWildcard is set.
+func parsePath(elems []string, allowWildcard bool) ([]uint32, wildcard, error) {
+	path := make([]uint32, 0, len(elems))
+	for i, elem := range elems {
+		hardened := strings.HasSuffix(elem, "'") ||
+			strings.HasSuffix(elem, "h")
+		if hardened {
+			elem = elem[:len(elem)-1]
+		}
+
+		if elem == "*" {
+			if !allowWildcard || i != len(elems)-1 {
+				return nil, wildcardNone, errors.New("'*' may " +
+					"only appear as last element in a key path")
+			}
+			if hardened {
+				return path, wildcardHardened, nil
+			}
+			return path, wildcardUnhardened, nil
+		}
+
+		index, err := strconv.ParseUint(elem, 10, 32)
+		if err != nil || index >= hdkeychain.HardenedKeyStart {
+			return nil, wildcardNone, fmt.Errorf("key path value "+
+				"'%s' is out of range", elem)
+		}
+		if hardened {
+			index += hdkeychain.HardenedKeyStart
+		}
+		path = append(path, uint32(index))
+	}
+	return path, wildcardNone, nil
+}
+
+// normalizeHardened returns the passed path with all hardened markers
+// represented by the ' character.
+func normalizeHardened(path string) string {
+	return strings.Replace(path, "h", "'", -1)
+}
+
+// pubKeyAt returns the serialized compressed or uncompressed public key of the
+// key expression at the passed derivation index.  The index is ignored for
+// keys without wildcard.  The returned key must be treated as read only since
+// derived keys are cached.
+//
+// This function is safe for concurrent access.
+func (k *keyExpr) pubKeyAt(index uint32) ([]byte, error) {
+	if k.wildcard == wildcardNone {
+		return k.pubKey, nil
+	}
+	if index >= hdkeychain.HardenedKeyStart {
+		return nil, fmt.Errorf("derivation index %d is out of range",
+			index)
+	}
+
+	k.childKeysMtx.Lock()
+	defer k.childKeysMtx.Unlock()
+	if pubKey, ok := k.childKeys[index]; ok {
+		return pubKey, nil
+	}
+
+	childIndex := index
+	if k.wildcard == wildcardHardened {
+		childIndex += hdkeychain.HardenedKeyStart
+	}
+	extKey, err := k.pathKey.Derive(childIndex)
+	if err != nil {
+		return nil, err
+	}
+	pubKey, err := extKey.ECPubKey()
+	if err != nil {
+		return nil, err
+	}
+	serialized := pubKey.SerializeCompressed()
+	k.childKeys[index] = serialized
+	return serialized, nil
+}
+
+// String returns the key expression with private keys replaced by their public
+// keys.
+func (k *keyExpr) String() string {
+	if k.extKey == nil {
+		return k.origin + hex.EncodeToString(k.pubKey)
+	}
+
+	extKey := k.extKey
+	if extKey.IsPrivate() {
+		// Neutering only fails for keys of unregistered networks,
+		// which are rejected when parsing.
+		extKey, _ = extKey.Neuter()
+	}
+	var b strings.Builder
+	b.WriteString(k.origin)
+	b.WriteString(extKey.String())
+	b.WriteString(formatPath(k.path))
+	switch k.wildcard {
+	case wildcardUnhardened:
+		b.WriteString("/*")
+	case wildcardHardened:
+		b.WriteString("/*'")
+	}
+	return b.String()
+}
+
+// derive returns the key expression of the public key the key expression
+// describes at the passed derivation index.  The origin of the derived key
+// extends the origin of the extended key or, when it has none, starts at the
+// fingerprint of the extended key.  Keys that are not extended keys are
+// returned unchanged.
+func (k *keyExpr) derive(index uint32) (*keyExpr, error) {
+	if k.extKey == nil {
+		return k, nil
+	}
+
+	pubKey, err := k.pubKeyAt(index)
+	if err != nil {
+		return nil, err
+	}
+
+	origin := strings.TrimSuffix(k.origin, "]")
+	if origin == "" {
+		extPubKey, err := k.extKey.ECPubKey()
+		if err != nil {
+			return nil, err
+		}
+		fingerprint := btcutil.Hash160(extPubKey.SerializeCompressed())[:4]
+		origin = "[" + hex.EncodeToString(fingerprint)
+	}
+	path := k.path
+	switch k.wildcard {
+	case wildcardUnhardened:
+		path = append(path[:len(path):len(path)], index)
+	case wildcardHardened:
+		path = append(path[:len(path):len(path)],
+			index+hdkeychain.HardenedKeyStart)
+	}
+
+	return &keyExpr{
+		origin:        origin + formatPath(path) + "]",
+		pubKey:        pubKey,
+		hasPrivateKey: k.hasPrivateKey,
+	}, nil
+}
+
+// formatPath returns the passed derivation path in the /step/step' format in
+// which hardened steps are marked by the ' character.
+func formatPath(path []uint32) string {
+	var b strings.Builder
+	for _, step := range path {
+		if step >= hdkeychain.HardenedKeyStart {
+			fmt.Fprintf(&b, "/%d'", step-hdkeychain.HardenedKeyStart)
+		} else {
+			fmt.Fprintf(&b, "/%d", step)
+		}
+	}
+	return b.String()
+}
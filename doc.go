@@ -27,6 +27,11 @@ Application Options:
       --addrindex             Maintain a full address-based transaction index
                               which makes the searchrawtransactions RPC
                               available
+      --addrutxoindex         Maintain an index of the unspent outputs, balance,
+                              and balance changes of every address which makes
+                              the getaddressbalance, getaddressutxos,
+                              getaddressdeltas, and getaddressmempool RPCs
+                              available
       --agentblacklist=       A comma separated list of user-agent substrings
                               which will cause grsd to reject any peers whose
                               user-agent contains any of the blacklisted
@@ -37,6 +42,9 @@ Application Options:
                               substrings. The blacklist is applied before the
                               blacklist, and an empty whitelist will allow all
                               agents that do not fail the blacklist.
+      --asmap=                Path to an asmap file which maps IP addresses to
+                              autonomous system numbers, used to diversify peer
+                              connections across network operators
       --banduration=          How long to ban misbehaving peers.  Valid time
                               units are {s, m, h}.  Minimum 1 second (default:
                               24h0m0s)
@@ -54,6 +62,12 @@ Application Options:
                               transactions when creating a block (default:
                               50000)
       --blocksonly            Do not accept transactions from remote peers.
+      --blockstatsindex       Maintain an index of aggregate statistics about
+                              every block which makes the getblockstats and
+                              getblockstatsrange RPCs available
+      --compactdb             Compact the database metadata in the background
+                              after start up to reclaim disk space (only
+                              supported by some database backends)
   -C, --configfile=           Path to configuration file
       --connect=              Connect only to the specified peers at startup
       --cpuprofile=           Write CPU profile to the specified file
@@ -69,9 +83,15 @@ Application Options:
                               info)
       --dropaddrindex         Deletes the address-based transaction index from
                               the database on start up and then exits.
+      --dropaddrutxoindex     Deletes the address utxo index from the database
+                              on start up and then exits.
+      --dropblockstatsindex   Deletes the block stats index from the database
+                              on start up and then exits.
       --dropcfindex           Deletes the index used for committed filtering
                               (CF) support from the database on start up and
                               then exits.
+      --dropspendindex        Deletes the spent output index from the database
+                              on start up and then exits.
       --droptxindex           Deletes the hash-based transaction index from the
                               database on start up and then exits.
       --externalip=           Add an ip to the list of local addresses we claim
@@ -84,10 +104,21 @@ Application Options:
                               (default all interfaces port: 1331, testnet:
                               17777)
       --logdir=               Directory to log output.
+      --logformat=            Format of the log output {text, json} -- JSON
+                              entries carry the subsystem, level and related
+                              fields such as the peer address, block hash, RPC
+                              method and request ID (default: text)
       --maxorphantx=          Max number of orphan transactions to keep in
                               memory (default: 100)
       --maxpeers=             Max number of inbound and outbound peers
                               (default: 125)
+      --metricslisten=        Add an interface/port to serve Prometheus metrics
+                              on at /metrics, e.g. 127.0.0.1:9332 -- NOTE: The
+                              port must be specified (default: disabled)
+      --minimumchainwork=     Minimum cumulative work in hex a header chain must
+                              have before blocks are downloaded for it during
+                              the initial sync (default: network specific,
+                              none on regtest and simnet)
       --miningaddr=           Add the specified payment address to the list of
                               addresses to use for generated blocks -- At least
                               one address is required if the generate option is
@@ -103,17 +134,23 @@ Application Options:
                               NOTE: Listening is automatically disabled if the
                               --connect or --proxy options are used without
                               also specifying listen interfaces via --listen
+      --nonodenetwork         Only serve the blocks of the main chain which are
+                              at most 288 blocks below the tip and advertise
+                              NODE_NETWORK_LIMITED instead of NODE_NETWORK
+                              (BIP0159)
       --noonion               Disable connecting to tor hidden services
       --nopeerbloomfilters    Disable bloom filtering support
       --norelaypriority       Do not require free or low-fee transactions to
                               have high priority for relaying
+      --nov2transport         Disable the encrypted v2 transport protocol
+                              (BIP0324) for peer connections
       --nowinservice          Do not start as a background service on Windows
                               -- NOTE: This flag only works on the command
                               line, not in the config file
       --norpc                 Disable built-in RPC server -- NOTE: The RPC
                               server is disabled by default if no
-                              rpcuser/rpcpass or rpclimituser/rpclimitpass is
-                              specified
+                              rpcuser/rpcpass, rpclimituser/rpclimitpass or
+                              rpcauth is specified
       --notls                 Disable TLS for the RPC server -- NOTE: This is
                               only allowed if the RPC server is bound to
                               localhost
@@ -121,6 +158,11 @@ Application Options:
                               (eg. 127.0.0.1:9050)
       --onionpass=            Password for onion proxy server
       --onionuser=            Username for onion proxy server
+      --privatebroadcast      Broadcast transactions submitted via RPC only
+                              through short-lived Tor connections to random
+                              peers and announce them to the connected peers
+                              once they are relayed back -- NOTE: This
+                              requires a Tor proxy set with --onion or --proxy
       --profile=              Enable HTTP profiling on given port -- NOTE port
                               must be between 1024 and 65536
       --proxy=                Connect via SOCKS5 proxy (eg. 127.0.0.1:9050)
@@ -134,6 +176,15 @@ Application Options:
                               the Replace-By-Fee (RBF) signaling policy.
       --relaynonstd           Relay non-standard transactions regardless of the
                               default settings for the active network.
+      --rest                  Serve the unauthenticated read-only REST
+                              interface under /rest/ on the RPC listeners --
+                              NOTE: This requires the RPC server to be enabled
+      --rpcauth=              Add a user authenticated with a hashed password
+                              in the <user>:<salt>$<hash> format, where hash is
+                              the hex encoded HMAC-SHA256 of the password keyed
+                              with the salt -- Users are limited to the methods
+                              of the limited user unless whitelisted with
+                              --rpcwhitelist
       --rpccert=              File containing the certificate file
       --rpckey=               File containing the certificate key
       --rpclimitpass=         Password for limited RPC connections
@@ -151,6 +202,21 @@ Application Options:
                               issues need to be worked around
   -P, --rpcpass=              Password for RPC connections
   -u, --rpcuser=              Username for RPC connections
+      --rpcwhitelist=         Set the RPC methods a user may call in the
+                              <user>:<method>,<method>,... format -- Use * for
+                              all methods and @limited for the methods of the
+                              limited user -- The methods of users with
+                              multiple whitelists are intersected
+      --rpcwsjournalsize=     Number of recent block and transaction events
+                              kept so reconnecting websocket clients can resume
+                              their notifications -- 0 disables resuming from a
+                              sequence number or block hash (default: 10000)
+      --rpcwsoverflow=        Policy applied when the notification queue of a
+                              websocket client is full {disconnect, dropoldest,
+                              dropnewest} (default: disconnect)
+      --rpcwsqueuesize=       Max number of notifications queued for a
+                              websocket client before the overflow policy
+                              applies (default: 5000)
       --sigcachemaxsize=      The maximum number of entries in the signature
                               verification cache (default: 100000)
       --simnet                Use the simulation test network
@@ -162,20 +228,47 @@ Application Options:
       --signetseednode=       Specify a seed node for the signet network
                               instead of using the global default signet
                               network seed nodes
+      --spendindex            Maintain an index of the transaction input that
+                              spends every spent output which makes the
+                              getspentinfo RPC available
       --testnet               Use the test network
       --torisolation          Enable Tor stream isolation by randomizing user
                               credentials for each connection.
-      --trickleinterval=      Minimum time between attempts to send new
-                              inventory to a connected peer (default: 10s)
+      --trickleinterval=      Average time between attempts to send new
+                              inventory to an inbound peer, outbound peers use
+                              2/5 of it (default: 10s)
       --txindex               Maintain a full hash-based transaction index
                               which makes all transactions available via the
                               getrawtransaction RPC
       --uacomment=            Comment to add to the user agent -- See BIP 14
                               for more information.
       --upnp                  Use UPnP to map our listening port outside of NAT
+      --verifydb              Check the integrity of the block database on
+                              start up before the node begins operating
+      --verifydbsamplepct=    Percentage of blocks to fully load and verify
+                              when --verifydb is set (0-100); the block index
+                              is cross-checked for every block regardless
+                              (default: 1)
   -V, --version               Display version information and exit
       --whitelist=            Add an IP network or IP that will not be banned.
                               (eg. 192.168.1.0/24 or ::1)
+      --zmqpubhashblock=      Publish the hash of every connected block to ZMQ
+                              subscribers on the given address (e.g.
+                              tcp://127.0.0.1:28332)
+      --zmqpubhashtx=         Publish the hash of every transaction accepted to
+                              the mempool or in a connected or disconnected
+                              block to ZMQ subscribers on the given address
+      --zmqpubrawblock=       Publish every connected block to ZMQ subscribers
+                              on the given address
+      --zmqpubrawtx=          Publish every transaction accepted to the mempool
+                              or in a connected or disconnected block to ZMQ
+                              subscribers on the given address
+      --zmqpubsequence=       Publish block connection and disconnection and
+                              mempool acceptance events with sequence numbers
+                              to ZMQ subscribers on the given address
+      --zmqpubhwm=            Max number of messages queued for a ZMQ
+                              subscriber before further messages are dropped
+                              (default: 1000)
 
 Help Options:
   -h, --help                  Show this help message
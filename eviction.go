@@ -0,0 +1,177 @@
+// Copyright (c) 2021 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"encoding/binary"
+	"sort"
+	"time"
+
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+)
+
+const (
+	// evictProtectNetGroups is the number of inbound peers with the highest
+	// keyed network group which are protected from eviction.  Since the key
+	// is random and not known to the remote peers, an attacker can't
+	// predict which network groups are protected.
+	evictProtectNetGroups = 4
+
+	// evictProtectPing is the number of inbound peers with the lowest ping
+	// times which are protected from eviction.
+	evictProtectPing = 8
+
+	// evictProtectTx is the number of inbound peers which most recently
+	// sent new transactions that are protected from eviction.
+	evictProtectTx = 4
+
+	// evictProtectBlockRelayOnly is the number of inbound peers which don't
+	// relay transactions and most recently sent new blocks that are
+	// protected from eviction.
+	evictProtectBlockRelayOnly = 8
+
+	// evictProtectBlock is the number of inbound peers which most recently
+	// sent new blocks that are protected from eviction.
+	evictProtectBlock = 4
+)
+
+// evictionCandidate houses the details of an inbound peer which are used to
+// decide whether it is evicted to make room for a new inbound peer.
+type evictionCandidate struct {
+	id            int32
+	timeConnected time.Time
+	pingMicros    int64
+	lastBlockTime time.Time
+	lastTxTime    time.Time
+	relayTxs      bool
+	netGroup      string
+	keyedNetGroup uint64
+}
+
+// hasPing returns whether the ping time of the candidate is known.
+func (c *evictionCandidate) hasPing() bool {
+	return c.pingMicros > 0
+}
+
+// keyedNetGroup returns the keyed network group of the passed network group,
+// which can't be predicted without the passed key.
+func keyedNetGroup(key []byte, netGroup string) uint64 {
+	data := make([]byte, 0, len(key)+len(netGroup))
+	data = append(data, key...)
+	data = append(data, netGroup...)
+	return binary.LittleEndian.Uint64(chainhash.HashB(data))
+}
+
+// protectLast sorts the passed candidates with the passed less function and
+// removes up to k candidates from the end of the sorted list which satisfy
+// the passed filter, which protects them from eviction.  A nil filter is
+// satisfied by all candidates.  The remaining candidates are returned.
+func protectLast(candidates []*evictionCandidate, k int,
+	less func(a, b *evictionCandidate) bool,
+	filter func(c *evictionCandidate) bool) []*evictionCandidate {
+
+	sort.SliceStable(candidates, func(i, j int) bool {
+		return less(candidates[i], candidates[j])
+	})
+
+	protected := 0
+	for i := len(candidates) - 1; i >= 0 && protected < k; i-- {
+		if filter != nil && !filter(candidates[i]) {
+			continue
+		}
+		candidates = append(candidates[:i], candidates[i+1:]...)
+		protected++
+	}
+	return candidates
+}
+
+// selectPeerToEvict returns the inbound peer among the passed candidates to
+// disconnect in order to make room for a new inbound peer, or nil when all of
+// them are protected.
+//
+// Peers are protected which are hard for an attacker to imitate in order to
+// fill all inbound slots: peers from varied network groups, peers with low
+// ping times, peers which recently sent new transactions or blocks and peers
+// which have been connected the longest.  The youngest peer of the network
+// group with the most remaining peers is evicted, so attackers which control
+// addresses of few network groups mostly evict each other.
+func selectPeerToEvict(candidates []*evictionCandidate) *evictionCandidate {
+	// Don't modify the order of the caller's candidates.
+	candidates = append([]*evictionCandidate(nil), candidates...)
+
+	candidates = protectLast(candidates, evictProtectNetGroups,
+		func(a, b *evictionCandidate) bool {
+			return a.keyedNetGroup < b.keyedNetGroup
+		}, nil)
+
+	// Peers with unknown ping times sort first, so they are not protected.
+	candidates = protectLast(candidates, evictProtectPing,
+		func(a, b *evictionCandidate) bool {
+			if a.hasPing() != b.hasPing() {
+				return !a.hasPing()
+			}
+			return a.pingMicros > b.pingMicros
+		}, nil)
+
+	candidates = protectLast(candidates, evictProtectTx,
+		func(a, b *evictionCandidate) bool {
+			if !a.lastTxTime.Equal(b.lastTxTime) {
+				return a.lastTxTime.Before(b.lastTxTime)
+			}
+			if a.relayTxs != b.relayTxs {
+				return !a.relayTxs
+			}
+			return a.timeConnected.After(b.timeConnected)
+		}, nil)
+
+	lessBlockTime := func(a, b *evictionCandidate) bool {
+		if !a.lastBlockTime.Equal(b.lastBlockTime) {
+			return a.lastBlockTime.Before(b.lastBlockTime)
+		}
+		return a.timeConnected.After(b.timeConnected)
+	}
+	candidates = protectLast(candidates, evictProtectBlockRelayOnly,
+		func(a, b *evictionCandidate) bool {
+			if a.relayTxs != b.relayTxs {
+				return a.relayTxs
+			}
+			return lessBlockTime(a, b)
+		}, func(c *evictionCandidate) bool {
+			return !c.relayTxs
+		})
+	candidates = protectLast(candidates, evictProtectBlock, lessBlockTime,
+		nil)
+
+	// Protect half of the remaining peers which have been connected the
+	// longest.
+	candidates = protectLast(candidates, len(candidates)/2,
+		func(a, b *evictionCandidate) bool {
+			return a.timeConnected.After(b.timeConnected)
+		}, nil)
+	if len(candidates) == 0 {
+		return nil
+	}
+
+	// Find the network group with the most peers, preferring the one with
+	// the youngest peer when several have the same number of peers.
+	// Since the candidates are sorted from the youngest to the oldest,
+	// the first candidate of each group is its youngest.
+	groups := make(map[string][]*evictionCandidate)
+	for _, c := range candidates {
+		groups[c.netGroup] = append(groups[c.netGroup], c)
+	}
+	var evictGroup []*evictionCandidate
+	for _, group := range groups {
+		switch {
+		case len(group) > len(evictGroup):
+			evictGroup = group
+		case len(group) == len(evictGroup) &&
+			group[0].timeConnected.After(evictGroup[0].timeConnected):
+
+			evictGroup = group
+		}
+	}
+	return evictGroup[0]
+}
@@ -0,0 +1,127 @@
+// Copyright (c) 2021 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+// protectedCandidates returns eviction candidates which are all protected from
+// eviction by exactly one of the protections, given that no other candidates
+// qualify for the protections other than the one by uptime.
+func protectedCandidates(now time.Time) []*evictionCandidate {
+	var candidates []*evictionCandidate
+	for id := int32(0); id < 28; id++ {
+		c := &evictionCandidate{
+			id:            id,
+			timeConnected: now,
+			relayTxs:      true,
+			netGroup:      "protected",
+		}
+		switch {
+		case id < 4:
+			c.keyedNetGroup = uint64(1000 + id)
+		case id < 12:
+			c.pingMicros = int64(10 + id)
+		case id < 16:
+			c.lastTxTime = now.Add(time.Duration(id) * time.Second)
+		case id < 24:
+			c.relayTxs = false
+			c.lastBlockTime = now.Add(time.Duration(id) * time.Second)
+		default:
+			c.lastBlockTime = now.Add(time.Duration(id) * time.Second)
+		}
+		candidates = append(candidates, c)
+	}
+	return candidates
+}
+
+// TestSelectPeerToEvict ensures inbound peers are protected from eviction as
+// intended and the youngest peer of the largest network group is evicted.
+func TestSelectPeerToEvict(t *testing.T) {
+	if c := selectPeerToEvict(nil); c != nil {
+		t.Fatalf("evicted peer %d without candidates", c.id)
+	}
+
+	// Only the candidates which don't qualify for any protection other
+	// than the one by uptime are evicted, from the youngest to the oldest,
+	// until all remaining candidates are protected.
+	now := time.Now()
+	candidates := protectedCandidates(now)
+	for id := int32(100); id < 120; id++ {
+		candidates = append(candidates, &evictionCandidate{
+			id:            id,
+			timeConnected: now.Add(time.Duration(id) * time.Minute),
+			relayTxs:      true,
+			netGroup:      "unprotected",
+		})
+	}
+	for wantID := int32(119); wantID >= 100; wantID-- {
+		c := selectPeerToEvict(candidates)
+		if c == nil {
+			t.Fatalf("no peer evicted, want peer %d", wantID)
+		}
+		if c.id != wantID {
+			t.Fatalf("evicted peer %d, want peer %d", c.id, wantID)
+		}
+		for i := range candidates {
+			if candidates[i] == c {
+				candidates = append(candidates[:i],
+					candidates[i+1:]...)
+				break
+			}
+		}
+	}
+	if c := selectPeerToEvict(candidates); c != nil {
+		t.Fatalf("evicted protected peer %d", c.id)
+	}
+
+	// The youngest candidate of the network group with the most
+	// candidates is evicted, preferring the group with the youngest
+	// candidate on ties.  The five oldest unprotected candidates are
+	// protected by their uptime.
+	tests := []struct {
+		name      string
+		netGroups []string
+		wantID    int32
+	}{
+		{
+			name:      "largest group",
+			netGroups: []string{"a", "a", "a", "b", "b"},
+			wantID:    107,
+		},
+		{
+			name:      "largest group with youngest peer",
+			netGroups: []string{"a", "a", "b", "b", "b"},
+			wantID:    109,
+		},
+		{
+			name:      "tie broken by youngest peer",
+			netGroups: []string{"a", "a", "b", "b", "c"},
+			wantID:    108,
+		},
+	}
+	for _, test := range tests {
+		candidates := protectedCandidates(now)
+		for i := int32(0); i < 10; i++ {
+			netGroup := "old"
+			if i >= 5 {
+				netGroup = test.netGroups[i-5]
+			}
+			candidates = append(candidates, &evictionCandidate{
+				id:            100 + i,
+				timeConnected: now.Add(time.Duration(i) * time.Minute),
+				relayTxs:      true,
+				netGroup:      netGroup,
+			})
+		}
+		c := selectPeerToEvict(candidates)
+		if c == nil || c.id != test.wantID {
+			t.Fatalf("%s: evicted %+v, want peer %d", test.name, c,
+				test.wantID)
+		}
+	}
+}
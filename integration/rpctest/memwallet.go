@@ -6,8 +6,10 @@ package rpctest
 
 import (
 	"bytes"
+	"crypto/sha256"
 	"encoding/binary"
 	"fmt"
+	"sort"
 	"sync"
 
 	"github.com/btcsuite/btcd/blockchain"
@@ -33,6 +35,108 @@ var (
 	}
 )
 
+// AddressType identifies the type of an address of the memWallet, which
+// determines how the outputs paying to it are spent.
+type AddressType uint8
+
+const (
+	// P2PKH is a pay-to-pubkey-hash address.
+	P2PKH AddressType = iota
+
+	// P2WPKH is a native segwit pay-to-witness-pubkey-hash address.
+	P2WPKH
+
+	// P2SHP2WPKH is a pay-to-witness-pubkey-hash output nested in a
+	// pay-to-script-hash address.
+	P2SHP2WPKH
+
+	// P2WSHMultisig is a native segwit pay-to-witness-script-hash address
+	// of a multisig script whose keys are all held by the wallet.
+	P2WSHMultisig
+)
+
+// String returns the AddressType in human-readable form.
+func (t AddressType) String() string {
+	switch t {
+	case P2PKH:
+		return "p2pkh"
+	case P2WPKH:
+		return "p2wpkh"
+	case P2SHP2WPKH:
+		return "p2sh-p2wpkh"
+	case P2WSHMultisig:
+		return "p2wsh-multisig"
+	}
+	return fmt.Sprintf("unknown address type %d", uint8(t))
+}
+
+const (
+	// inputBaseSize is the size of an input without its sigScript: the
+	// outpoint, the sequence number and the sigScript length.
+	inputBaseSize = 32 + 4 + 4 + 1
+
+	// p2pkhSigScriptSize is the largest size of a sigScript which spends a
+	// p2pkh output: OP_DATA_73 <sig> OP_DATA_33 <pubkey>
+	p2pkhSigScriptSize = 1 + 73 + 1 + 33
+
+	// p2wpkhWitnessSize is the largest size of a witness which spends a
+	// p2wpkh output: <item count> <sig length> <sig> <pubkey length>
+	// <pubkey>
+	p2wpkhWitnessSize = 1 + 1 + 73 + 1 + 33
+
+	// nestedP2WPKHSigScriptSize is the size of the sigScript which spends
+	// a p2sh-p2wpkh output: OP_DATA_22 OP_0 OP_DATA_20 <pubkey hash>
+	nestedP2WPKHSigScriptSize = 1 + 22
+
+	// p2pkhOutputSize is the size of a p2pkh change output: the value, the
+	// pkScript length and the pkScript.
+	p2pkhOutputSize = 8 + 1 + 25
+
+	// changeDustLimit is the smallest change output the wallet creates.
+	// Smaller change is added to the fee instead, since the output would
+	// be rejected as dust at the default minimum relay fee.
+	changeDustLimit = btcutil.Amount(546)
+)
+
+// walletAddr is an address of the memWallet along with the information
+// required to spend the outputs paying to it.
+type walletAddr struct {
+	addr     btcutil.Address
+	addrType AddressType
+	pkScript []byte
+
+	// keyIndexes are the indexes of the keys of the address from the
+	// hdRoot.  All addresses except multisig ones have a single key.
+	keyIndexes []uint32
+
+	// script is the redeem script of a p2sh-p2wpkh address, or the witness
+	// script of a multisig address which requires nRequired signatures.
+	script    []byte
+	nRequired int
+}
+
+// inputWeight returns the estimated weight of an input spending an output
+// paying to the address.
+func (a *walletAddr) inputWeight() int {
+	const scale = blockchain.WitnessScaleFactor
+
+	switch a.addrType {
+	case P2WPKH:
+		return inputBaseSize*scale + p2wpkhWitnessSize
+	case P2SHP2WPKH:
+		return (inputBaseSize+nestedP2WPKHSigScriptSize)*scale +
+			p2wpkhWitnessSize
+	case P2WSHMultisig:
+		// <item count> OP_0 <sig length> <sig>... <script length>
+		// <script>
+		witnessSize := 1 + 1 + a.nRequired*(1+73) +
+			wire.VarIntSerializeSize(uint64(len(a.script))) +
+			len(a.script)
+		return inputBaseSize*scale + witnessSize
+	}
+	return (inputBaseSize + p2pkhSigScriptSize) * scale
+}
+
 // utxo represents an unspent output spendable by the memWallet. The maturity
 // height of the transaction is recorded in order to properly observe the
 // maturity period of direct coinbase outputs.
@@ -85,8 +189,8 @@ type memWallet struct {
 	currentHeight int32
 
 	// addrs tracks all addresses belonging to the wallet. The addresses
-	// are indexed by their keypath from the hdRoot.
-	addrs map[uint32]btcutil.Address
+	// are indexed by the keypath of their first key from the hdRoot.
+	addrs map[uint32]*walletAddr
 
 	// utxos is the set of utxos spendable by the wallet.
 	utxos map[wire.OutPoint]*utxo
@@ -140,8 +244,17 @@ func newMemWallet(net *chaincfg.Params, harnessID uint32) (*memWallet, error) {
 
 	// Track the coinbase generation address to ensure we properly track
 	// newly generated bitcoin we can spend.
-	addrs := make(map[uint32]btcutil.Address)
-	addrs[0] = coinbaseAddr
+	coinbaseScript, err := txscript.PayToAddrScript(coinbaseAddr)
+	if err != nil {
+		return nil, err
+	}
+	addrs := make(map[uint32]*walletAddr)
+	addrs[0] = &walletAddr{
+		addr:       coinbaseAddr,
+		addrType:   P2PKH,
+		pkScript:   coinbaseScript,
+		keyIndexes: []uint32{0},
+	}
 
 	return &memWallet{
 		net:               net,
@@ -256,8 +369,7 @@ func (m *memWallet) evalOutputs(outputs []*wire.TxOut, txHash *chainhash.Hash,
 		// Scan all the addresses we currently control to see if the
 		// output is paying to us.
 		for keyIndex, addr := range m.addrs {
-			pkHash := addr.ScriptAddress()
-			if !bytes.Contains(pkScript, pkHash) {
+			if !bytes.Equal(pkScript, addr.pkScript) {
 				continue
 			}
 
@@ -331,39 +443,122 @@ func (m *memWallet) unwindBlock(update *chainUpdate) {
 	delete(m.reorgJournal, update.blockHeight)
 }
 
-// newAddress returns a new address from the wallet's hd key chain.  It also
-// loads the address into the RPC client's transaction filter to ensure any
-// transactions that involve it are delivered via the notifications.
-func (m *memWallet) newAddress() (btcutil.Address, error) {
-	index := m.hdIndex
-
+// deriveKey returns the private key with the passed index from the hdRoot.
+func (m *memWallet) deriveKey(index uint32) (*btcec.PrivateKey, error) {
 	childKey, err := m.hdRoot.Derive(index)
 	if err != nil {
 		return nil, err
 	}
-	privKey, err := childKey.ECPrivKey()
+	return childKey.ECPrivKey()
+}
+
+// newWalletAddr returns a new address of the passed type from the wallet's hd
+// key chain.  Multisig addresses use nKeys new keys and require nRequired
+// signatures, while the other types use a single new key.  It also loads the
+// address into the RPC client's transaction filter to ensure any transactions
+// that involve it are delivered via the notifications.
+//
+// NOTE: The memWallet's mutex must be held when this function is called.
+func (m *memWallet) newWalletAddr(addrType AddressType, nRequired,
+	nKeys int) (*walletAddr, error) {
+
+	if addrType != P2WSHMultisig {
+		nKeys = 1
+	}
+	if nKeys < 1 || (addrType == P2WSHMultisig &&
+		(nRequired < 1 || nRequired > nKeys)) {
+
+		return nil, fmt.Errorf("invalid multisig of %d of %d keys",
+			nRequired, nKeys)
+	}
+
+	wa := &walletAddr{
+		addrType:   addrType,
+		keyIndexes: make([]uint32, nKeys),
+		nRequired:  nRequired,
+	}
+	pubKeys := make([]*btcutil.AddressPubKey, nKeys)
+	for i := range pubKeys {
+		index := m.hdIndex + uint32(i)
+		privKey, err := m.deriveKey(index)
+		if err != nil {
+			return nil, err
+		}
+		pubKeys[i], err = btcutil.NewAddressPubKey(
+			privKey.PubKey().SerializeCompressed(), m.net)
+		if err != nil {
+			return nil, err
+		}
+		wa.keyIndexes[i] = index
+	}
+
+	var err error
+	pkHash := btcutil.Hash160(pubKeys[0].ScriptAddress())
+	switch addrType {
+	case P2PKH:
+		wa.addr = pubKeys[0].AddressPubKeyHash()
+
+	case P2WPKH:
+		wa.addr, err = btcutil.NewAddressWitnessPubKeyHash(pkHash, m.net)
+
+	case P2SHP2WPKH:
+		var witnessAddr btcutil.Address
+		witnessAddr, err = btcutil.NewAddressWitnessPubKeyHash(pkHash,
+			m.net)
+		if err != nil {
+			return nil, err
+		}
+		wa.script, err = txscript.PayToAddrScript(witnessAddr)
+		if err != nil {
+			return nil, err
+		}
+		wa.addr, err = btcutil.NewAddressScriptHash(wa.script, m.net)
+
+	case P2WSHMultisig:
+		wa.script, err = txscript.MultiSigScript(pubKeys, nRequired)
+		if err != nil {
+			return nil, err
+		}
+		scriptHash := sha256.Sum256(wa.script)
+		wa.addr, err = btcutil.NewAddressWitnessScriptHash(
+			scriptHash[:], m.net)
+
+	default:
+		return nil, fmt.Errorf("unsupported address type %v", addrType)
+	}
 	if err != nil {
 		return nil, err
 	}
 
-	addr, err := keyToAddr(privKey, m.net)
+	wa.pkScript, err = txscript.PayToAddrScript(wa.addr)
 	if err != nil {
 		return nil, err
 	}
 
-	err = m.rpc.LoadTxFilter(false, []btcutil.Address{addr}, nil)
+	err = m.rpc.LoadTxFilter(false, []btcutil.Address{wa.addr}, nil)
 	if err != nil {
 		return nil, err
 	}
 
-	m.addrs[index] = addr
+	m.addrs[wa.keyIndexes[0]] = wa
 
-	m.hdIndex++
+	m.hdIndex += uint32(nKeys)
 
-	return addr, nil
+	return wa, nil
+}
+
+// newAddress returns a new p2pkh address from the wallet's hd key chain.
+//
+// NOTE: The memWallet's mutex must be held when this function is called.
+func (m *memWallet) newAddress() (btcutil.Address, error) {
+	wa, err := m.newWalletAddr(P2PKH, 0, 1)
+	if err != nil {
+		return nil, err
+	}
+	return wa.addr, nil
 }
 
-// NewAddress returns a fresh address spendable by the wallet.
+// NewAddress returns a fresh p2pkh address spendable by the wallet.
 //
 // This function is safe for concurrent access.
 func (m *memWallet) NewAddress() (btcutil.Address, error) {
@@ -373,82 +568,255 @@ func (m *memWallet) NewAddress() (btcutil.Address, error) {
 	return m.newAddress()
 }
 
+// NewAddressOfType returns a fresh address of the passed type spendable by the
+// wallet.  Multisig addresses are created as 1-of-1 multisigs, use
+// NewMultisigAddress for other multisigs.
+//
+// This function is safe for concurrent access.
+func (m *memWallet) NewAddressOfType(addrType AddressType) (btcutil.Address, error) {
+	m.Lock()
+	defer m.Unlock()
+
+	wa, err := m.newWalletAddr(addrType, 1, 1)
+	if err != nil {
+		return nil, err
+	}
+	return wa.addr, nil
+}
+
+// NewMultisigAddress returns a fresh p2wsh address of a multisig script of
+// nKeys fresh keys which requires nRequired signatures.  The wallet holds all
+// keys, so it can spend the outputs paying to the address.
+//
+// This function is safe for concurrent access.
+func (m *memWallet) NewMultisigAddress(nRequired, nKeys int) (btcutil.Address, error) {
+	m.Lock()
+	defer m.Unlock()
+
+	wa, err := m.newWalletAddr(P2WSHMultisig, nRequired, nKeys)
+	if err != nil {
+		return nil, err
+	}
+	return wa.addr, nil
+}
+
+// estimateFee returns the fee of the passed transaction, whose inputs spend
+// outputs paying to the passed addresses and have not been signed yet, at the
+// passed fee rate in satoshis per virtual byte.  An additional p2pkh change
+// output is accounted for when change is set.
+func estimateFee(tx *wire.MsgTx, inputAddrs []*walletAddr,
+	feeRate btcutil.Amount, change bool) btcutil.Amount {
+
+	const scale = blockchain.WitnessScaleFactor
+
+	// The stripped size of the transaction includes the inputs without
+	// their sigScripts, so only the sigScripts and witnesses are added.
+	weight := tx.SerializeSizeStripped() * scale
+	hasWitness := false
+	for _, addr := range inputAddrs {
+		weight += addr.inputWeight() - inputBaseSize*scale
+		hasWitness = hasWitness || addr.addrType != P2PKH
+	}
+	if hasWitness {
+		// The segwit marker and flag.
+		weight += 2
+	}
+	if change {
+		weight += p2pkhOutputSize * scale
+	}
+
+	vsize := (weight + scale - 1) / scale
+	return btcutil.Amount(vsize) * feeRate
+}
+
 // fundTx attempts to fund a transaction sending amt bitcoin. The coins are
 // selected such that the final amount spent pays enough fees as dictated by the
 // passed fee rate. The passed fee rate should be expressed in
-// satoshis-per-byte. The transaction being funded can optionally include a
-// change output indicated by the change boolean.
+// satoshis-per-virtual-byte. The transaction being funded can optionally
+// include a change output indicated by the change boolean.
+//
+// Only outputs whose value exceeds the fee for spending them are considered.
+// The smallest output which covers the amount and fees on its own is preferred,
+// otherwise the outputs with the largest effective value are selected until
+// they cover the amount and fees.  Change below the dust limit is added to the
+// fee.
 //
 // NOTE: The memWallet's mutex must be held when this function is called.
 func (m *memWallet) fundTx(tx *wire.MsgTx, amt btcutil.Amount,
 	feeRate btcutil.Amount, change bool) error {
 
-	const (
-		// spendSize is the largest number of bytes of a sigScript
-		// which spends a p2pkh output: OP_DATA_73 <sig> OP_DATA_33 <pubkey>
-		spendSize = 1 + 73 + 1 + 33
-	)
+	const scale = blockchain.WitnessScaleFactor
 
-	var (
-		amtSelected btcutil.Amount
-		txSize      int
-	)
+	type candidate struct {
+		outPoint       wire.OutPoint
+		addr           *walletAddr
+		value          btcutil.Amount
+		effectiveValue btcutil.Amount
+	}
 
+	// Gather the spendable outputs which are worth spending at the
+	// passed fee rate, skipping any outputs that are still currently
+	// immature or are currently locked.
+	var candidates []candidate
 	for outPoint, utxo := range m.utxos {
-		// Skip any outputs that are still currently immature or are
-		// currently locked.
 		if !utxo.isMature(m.currentHeight) || utxo.isLocked {
 			continue
 		}
+		addr := m.addrs[utxo.keyIndex]
+		inputVSize := (addr.inputWeight() + scale - 1) / scale
+		effectiveValue := utxo.value - btcutil.Amount(inputVSize)*feeRate
+		if effectiveValue <= 0 {
+			continue
+		}
+		candidates = append(candidates, candidate{
+			outPoint:       outPoint,
+			addr:           addr,
+			value:          utxo.value,
+			effectiveValue: effectiveValue,
+		})
+	}
+	sort.Slice(candidates, func(i, j int) bool {
+		return candidates[i].effectiveValue > candidates[j].effectiveValue
+	})
+
+	// The effective values must cover the amount along with the fee for
+	// the transaction without inputs.
+	target := amt + estimateFee(tx, nil, feeRate, change)
+
+	var selected []candidate
+	for i := len(candidates) - 1; i >= 0; i-- {
+		if candidates[i].effectiveValue >= target {
+			selected = candidates[i : i+1]
+			break
+		}
+	}
+	if selected == nil {
+		var total btcutil.Amount
+		for i, c := range candidates {
+			total += c.effectiveValue
+			if total >= target {
+				selected = candidates[:i+1]
+				break
+			}
+		}
+	}
+	if selected == nil {
+		// If we've reached this point, then coin selection failed due
+		// to an insufficient amount of coins.
+		return fmt.Errorf("not enough funds for coin selection")
+	}
 
-		amtSelected += utxo.value
-
-		// Add the selected output to the transaction, updating the
-		// current tx size while accounting for the size of the future
-		// sigScript.
+	var amtSelected btcutil.Amount
+	inputAddrs := make([]*walletAddr, 0, len(selected))
+	for _, c := range selected {
+		outPoint := c.outPoint
 		tx.AddTxIn(wire.NewTxIn(&outPoint, nil, nil))
-		txSize = tx.SerializeSize() + spendSize*len(tx.TxIn)
-
-		// Calculate the fee required for the txn at this point
-		// observing the specified fee rate. If we don't have enough
-		// coins from he current amount selected to pay the fee, then
-		// continue to grab more coins.
-		reqFee := btcutil.Amount(txSize * int(feeRate))
-		if amtSelected-reqFee < amt {
-			continue
+		inputAddrs = append(inputAddrs, c.addr)
+		amtSelected += c.value
+	}
+
+	// If we have any change left over which isn't dust and we should
+	// create a change output, then add an additional output to the
+	// transaction reserved for it.
+	changeVal := amtSelected - amt - estimateFee(tx, inputAddrs, feeRate,
+		true)
+	if change && changeVal >= changeDustLimit {
+		addr, err := m.newAddress()
+		if err != nil {
+			return err
+		}
+		pkScript, err := txscript.PayToAddrScript(addr)
+		if err != nil {
+			return err
+		}
+		changeOutput := &wire.TxOut{
+			Value:    int64(changeVal),
+			PkScript: pkScript,
+		}
+		tx.AddTxOut(changeOutput)
+	}
+
+	return nil
+}
+
+// signInput populates the sigScript and witness of the input with the passed
+// index of the transaction, which spends the passed output.
+//
+// NOTE: The memWallet's mutex must be held when this function is called.
+func (m *memWallet) signInput(tx *wire.MsgTx, sigHashes *txscript.TxSigHashes,
+	idx int, utxo *utxo) error {
+
+	addr := m.addrs[utxo.keyIndex]
+	privKeys := make([]*btcec.PrivateKey, len(addr.keyIndexes))
+	for i, index := range addr.keyIndexes {
+		privKey, err := m.deriveKey(index)
+		if err != nil {
+			return err
 		}
+		privKeys[i] = privKey
+	}
 
-		// If we have any change left over and we should create a change
-		// output, then add an additional output to the transaction
-		// reserved for it.
-		changeVal := amtSelected - amt - reqFee
-		if changeVal > 0 && change {
-			addr, err := m.newAddress()
-			if err != nil {
-				return err
-			}
-			pkScript, err := txscript.PayToAddrScript(addr)
+	txIn := tx.TxIn[idx]
+	value := int64(utxo.value)
+	switch addr.addrType {
+	case P2PKH:
+		sigScript, err := txscript.SignatureScript(tx, idx,
+			utxo.pkScript, txscript.SigHashAll, privKeys[0], true)
+		if err != nil {
+			return err
+		}
+		txIn.SignatureScript = sigScript
+
+	case P2WPKH:
+		witness, err := txscript.WitnessSignature(tx, sigHashes, idx,
+			value, utxo.pkScript, txscript.SigHashAll, privKeys[0],
+			true)
+		if err != nil {
+			return err
+		}
+		txIn.Witness = witness
+
+	case P2SHP2WPKH:
+		witness, err := txscript.WitnessSignature(tx, sigHashes, idx,
+			value, addr.script, txscript.SigHashAll, privKeys[0],
+			true)
+		if err != nil {
+			return err
+		}
+		sigScript, err := txscript.NewScriptBuilder().
+			AddData(addr.script).Script()
+		if err != nil {
+			return err
+		}
+		txIn.SignatureScript = sigScript
+		txIn.Witness = witness
+
+	case P2WSHMultisig:
+		// The witness starts with an empty item due to the off-by-one
+		// bug of OP_CHECKMULTISIG, followed by the signatures of the
+		// first keys in the order of the script and the script itself.
+		witness := wire.TxWitness{nil}
+		for _, privKey := range privKeys[:addr.nRequired] {
+			sig, err := txscript.RawTxInWitnessSignature(tx,
+				sigHashes, idx, value, addr.script,
+				txscript.SigHashAll, privKey)
 			if err != nil {
 				return err
 			}
-			changeOutput := &wire.TxOut{
-				Value:    int64(changeVal),
-				PkScript: pkScript,
-			}
-			tx.AddTxOut(changeOutput)
+			witness = append(witness, sig)
 		}
+		txIn.Witness = append(witness, addr.script)
 
-		return nil
+	default:
+		return fmt.Errorf("unsupported address type %v", addr.addrType)
 	}
 
-	// If we've reached this point, then coin selection failed due to an
-	// insufficient amount of coins.
-	return fmt.Errorf("not enough funds for coin selection")
+	return nil
 }
 
 // SendOutputs creates, then sends a transaction paying to the specified output
 // while observing the passed fee rate. The passed fee rate should be expressed
-// in satoshis-per-byte.
+// in satoshis-per-virtual-byte.
 func (m *memWallet) SendOutputs(outputs []*wire.TxOut,
 	feeRate btcutil.Amount) (*chainhash.Hash, error) {
 
@@ -462,7 +830,7 @@ func (m *memWallet) SendOutputs(outputs []*wire.TxOut,
 
 // SendOutputsWithoutChange creates and sends a transaction that pays to the
 // specified outputs while observing the passed fee rate and ignoring a change
-// output. The passed fee rate should be expressed in sat/b.
+// output. The passed fee rate should be expressed in sat/vb.
 func (m *memWallet) SendOutputsWithoutChange(outputs []*wire.TxOut,
 	feeRate btcutil.Amount) (*chainhash.Hash, error) {
 
@@ -476,8 +844,8 @@ func (m *memWallet) SendOutputsWithoutChange(outputs []*wire.TxOut,
 
 // CreateTransaction returns a fully signed transaction paying to the specified
 // outputs while observing the desired fee rate. The passed fee rate should be
-// expressed in satoshis-per-byte. The transaction being created can optionally
-// include a change output indicated by the change boolean.
+// expressed in satoshis-per-virtual-byte. The transaction being created can
+// optionally include a change output indicated by the change boolean.
 //
 // This function is safe for concurrent access.
 func (m *memWallet) CreateTransaction(outputs []*wire.TxOut,
@@ -501,32 +869,17 @@ func (m *memWallet) CreateTransaction(outputs []*wire.TxOut,
 		return nil, err
 	}
 
-	// Populate all the selected inputs with valid sigScript for spending.
-	// Along the way record all outputs being spent in order to avoid a
-	// potential double spend.
+	// Populate all the selected inputs with a valid sigScript and witness
+	// for spending.  Along the way record all outputs being spent in order
+	// to avoid a potential double spend.
+	sigHashes := txscript.NewTxSigHashes(tx)
 	spentOutputs := make([]*utxo, 0, len(tx.TxIn))
 	for i, txIn := range tx.TxIn {
-		outPoint := txIn.PreviousOutPoint
-		utxo := m.utxos[outPoint]
-
-		extendedKey, err := m.hdRoot.Derive(utxo.keyIndex)
-		if err != nil {
+		utxo := m.utxos[txIn.PreviousOutPoint]
+		if err := m.signInput(tx, sigHashes, i, utxo); err != nil {
 			return nil, err
 		}
 
-		privKey, err := extendedKey.ECPrivKey()
-		if err != nil {
-			return nil, err
-		}
-
-		sigScript, err := txscript.SignatureScript(tx, i, utxo.pkScript,
-			txscript.SigHashAll, privKey, true)
-		if err != nil {
-			return nil, err
-		}
-
-		txIn.SignatureScript = sigScript
-
 		spentOutputs = append(spentOutputs, utxo)
 	}
 
@@ -0,0 +1,139 @@
+// Copyright (c) 2021 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+// This file is ignored during the regular tests due to the following build tag.
+// +build rpctest
+
+package rpctest
+
+import (
+	"testing"
+	"time"
+
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/txscript"
+	"github.com/btcsuite/btcd/wire"
+	"github.com/btcsuite/btcutil"
+)
+
+// TestMemWalletWitnessSpends ensures the memWallet can fund and spend the
+// outputs of all its address types once segwit is active.
+func TestMemWalletWitnessSpends(t *testing.T) {
+	harness, err := New(&chaincfg.SimNetParams, nil, nil, "")
+	if err != nil {
+		t.Fatalf("unable to create harness: %v", err)
+	}
+	defer harness.TearDown()
+	if err := harness.SetUp(true, 5); err != nil {
+		t.Fatalf("unable to set up harness: %v", err)
+	}
+
+	// Segwit activates after three confirmation windows on simnet: one to
+	// start the deployment, one to lock it in and one until it's active.
+	window := harness.ActiveNet.MinerConfirmationWindow
+	if _, err := harness.Client.Generate(3 * window); err != nil {
+		t.Fatalf("unable to generate blocks: %v", err)
+	}
+	info, err := harness.Client.GetBlockChainInfo()
+	if err != nil {
+		t.Fatalf("unable to get blockchain info: %v", err)
+	}
+	segwit := info.SoftForks.Bip9SoftForks["segwit"]
+	if segwit == nil || segwit.Status != "active" {
+		t.Fatalf("segwit not active: %v", segwit)
+	}
+
+	assertTxMined := func(txid *chainhash.Hash) {
+		blockHashes, err := harness.Client.Generate(1)
+		if err != nil {
+			t.Fatalf("unable to generate block: %v", err)
+		}
+		block, err := harness.Client.GetBlock(blockHashes[0])
+		if err != nil {
+			t.Fatalf("unable to get block: %v", err)
+		}
+		mined := false
+		for _, tx := range block.Transactions[1:] {
+			if tx.TxHash() == *txid {
+				mined = true
+				break
+			}
+		}
+		if !mined {
+			t.Fatalf("transaction %v not mined", txid)
+		}
+
+		// The wallet processes the block asynchronously, so wait until
+		// its outputs are spendable.
+		_, height, err := harness.Client.GetBestBlock()
+		if err != nil {
+			t.Fatalf("unable to get best block: %v", err)
+		}
+		deadline := time.Now().Add(10 * time.Second)
+		for harness.wallet.SyncedHeight() < height {
+			if time.Now().After(deadline) {
+				t.Fatalf("wallet not synced to height %d", height)
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+	}
+
+	newAddrs := map[string]func() (btcutil.Address, error){
+		P2WPKH.String(): func() (btcutil.Address, error) {
+			return harness.NewAddressOfType(P2WPKH)
+		},
+		P2SHP2WPKH.String(): func() (btcutil.Address, error) {
+			return harness.NewAddressOfType(P2SHP2WPKH)
+		},
+		"p2wsh 1-of-1": func() (btcutil.Address, error) {
+			return harness.NewAddressOfType(P2WSHMultisig)
+		},
+		"p2wsh 2-of-3": func() (btcutil.Address, error) {
+			return harness.NewMultisigAddress(2, 3)
+		},
+	}
+	for name, newAddr := range newAddrs {
+		// Fund a fresh address with an output smaller than any other
+		// output of the wallet.
+		addr, err := newAddr()
+		if err != nil {
+			t.Fatalf("%s: unable to create address: %v", name, err)
+		}
+		pkScript, err := txscript.PayToAddrScript(addr)
+		if err != nil {
+			t.Fatalf("%s: unable to create script: %v", name, err)
+		}
+		fundAmt := btcutil.Amount(btcutil.SatoshiPerBitcoin)
+		output := wire.NewTxOut(int64(fundAmt), pkScript)
+		txid, err := harness.SendOutputs([]*wire.TxOut{output}, 10)
+		if err != nil {
+			t.Fatalf("%s: unable to fund address: %v", name, err)
+		}
+		assertTxMined(txid)
+
+		// The coin selection prefers the smallest sufficient output,
+		// so a spend of half the funded amount must spend the witness
+		// output.
+		spendAmt := fundAmt / 2
+		output = wire.NewTxOut(int64(spendAmt), pkScript)
+		tx, err := harness.CreateTransaction([]*wire.TxOut{output}, 10,
+			true)
+		if err != nil {
+			t.Fatalf("%s: unable to create spend: %v", name, err)
+		}
+		if len(tx.TxIn) != 1 || tx.TxIn[0].PreviousOutPoint.Hash != *txid {
+			t.Fatalf("%s: spend does not spend the funded output",
+				name)
+		}
+		if len(tx.TxIn[0].Witness) == 0 {
+			t.Fatalf("%s: spend has no witness", name)
+		}
+		txid, err = harness.Client.SendRawTransaction(tx, true)
+		if err != nil {
+			t.Fatalf("%s: unable to send spend: %v", name, err)
+		}
+		assertTxMined(txid)
+	}
+}
@@ -0,0 +1,346 @@
+// Copyright (c) 2021 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package rpctest
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcd/rpcclient"
+)
+
+const (
+	// linkConnectTimeout is the maximum duration to wait for the source
+	// node of a link to establish the connection to the target node.
+	linkConnectTimeout = 30 * time.Second
+
+	// linkPollInterval is the interval at which the peers of a node are
+	// polled while waiting for a link to be established.
+	linkPollInterval = 50 * time.Millisecond
+)
+
+// Link declares a peer-to-peer connection of a network from the node with the
+// index From to the node with the index To.  The connection is persistent, so
+// the From node reconnects when it is lost.
+type Link struct {
+	From int
+	To   int
+}
+
+// ChainLinks returns the links of a network of numNodes nodes where each node
+// is connected to the next one.
+func ChainLinks(numNodes int) []Link {
+	links := make([]Link, 0, numNodes)
+	for i := 0; i+1 < numNodes; i++ {
+		links = append(links, Link{From: i, To: i + 1})
+	}
+	return links
+}
+
+// StarLinks returns the links of a network of numNodes nodes where every node
+// is connected to the first one.
+func StarLinks(numNodes int) []Link {
+	links := make([]Link, 0, numNodes)
+	for i := 1; i < numNodes; i++ {
+		links = append(links, Link{From: i, To: 0})
+	}
+	return links
+}
+
+// FullMeshLinks returns the links of a network of numNodes nodes where every
+// node is connected to every other node.
+func FullMeshLinks(numNodes int) []Link {
+	links := make([]Link, 0, numNodes*(numNodes-1)/2)
+	for i := 0; i < numNodes; i++ {
+		for j := i + 1; j < numNodes; j++ {
+			links = append(links, Link{From: i, To: j})
+		}
+	}
+	return links
+}
+
+// NetworkConfig describes a network of test harnesses.
+type NetworkConfig struct {
+	// ActiveNet is the parameters of the blockchain of all nodes.
+	ActiveNet *chaincfg.Params
+
+	// NumNodes is the number of nodes of the network.
+	NumNodes int
+
+	// Links are the peer-to-peer connections between the nodes.
+	Links []Link
+
+	// ExtraArgs are passed to all nodes while NodeArgs are only passed to
+	// the node with the index of the key.
+	ExtraArgs []string
+	NodeArgs  map[int][]string
+
+	// CustomExePath is the btcd executable used to start the nodes.  A new
+	// binary is built on demand when it is empty.
+	CustomExePath string
+}
+
+// networkLink is an established link of a network.
+type networkLink struct {
+	Link
+	proxy *linkProxy
+	cut   bool
+}
+
+// Network is a group of test harnesses connected in a declared topology.  Every
+// link is relayed by a proxy between the two nodes, which makes it possible to
+// partition and heal the network and to delay or drop specific messages in
+// order to test reorgs, relay and ban logic.
+//
+// The methods of a network are not safe for concurrent access.
+type Network struct {
+	nodes []*Harness
+	links []*networkLink
+}
+
+// NewNetwork creates the test harnesses of a network according to the passed
+// configuration.  The nodes are only started and linked by SetUp.
+func NewNetwork(config *NetworkConfig) (*Network, error) {
+	if config.NumNodes < 1 {
+		return nil, fmt.Errorf("a network requires at least one node")
+	}
+	n := &Network{
+		nodes: make([]*Harness, 0, config.NumNodes),
+	}
+	for _, link := range config.Links {
+		if link.From == link.To || link.From < 0 || link.To < 0 ||
+			link.From >= config.NumNodes ||
+			link.To >= config.NumNodes {
+
+			return nil, fmt.Errorf("invalid link from node %d to "+
+				"node %d", link.From, link.To)
+		}
+		n.links = append(n.links, &networkLink{Link: link})
+	}
+
+	for i := 0; i < config.NumNodes; i++ {
+		args := append([]string(nil), config.ExtraArgs...)
+		args = append(args, config.NodeArgs[i]...)
+		harness, err := New(config.ActiveNet, nil, args,
+			config.CustomExePath)
+		if err != nil {
+			n.TearDown()
+			return nil, err
+		}
+		n.nodes = append(n.nodes, harness)
+	}
+
+	return n, nil
+}
+
+// SetUp starts all nodes of the network, optionally generates a test chain
+// with the passed number of mature coinbase outputs on the first node, and
+// establishes the links.  It returns once all nodes share the same best chain.
+func (n *Network) SetUp(createTestChain bool, numMatureOutputs uint32) error {
+	for i, node := range n.nodes {
+		err := node.SetUp(createTestChain && i == 0, numMatureOutputs)
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, link := range n.links {
+		target := n.nodes[link.To].P2PAddress()
+		proxy, err := newLinkProxy(target)
+		if err != nil {
+			return err
+		}
+		link.proxy = proxy
+		if err := n.connectLink(link); err != nil {
+			return err
+		}
+	}
+
+	return JoinNodes(n.nodes, Blocks)
+}
+
+// TearDown stops all proxies and tears down all nodes of the network.
+func (n *Network) TearDown() error {
+	var firstErr error
+	for _, link := range n.links {
+		if link.proxy == nil {
+			continue
+		}
+		if err := link.proxy.close(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	for _, node := range n.nodes {
+		if err := node.TearDown(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+// Node returns the test harness of the node with the passed index.
+func (n *Network) Node(i int) *Harness {
+	return n.nodes[i]
+}
+
+// Nodes returns the test harnesses of all nodes of the network.
+func (n *Network) Nodes() []*Harness {
+	return append([]*Harness(nil), n.nodes...)
+}
+
+// connectLink makes the source node of the passed link connect to its proxy
+// and waits until the connection has been established.
+func (n *Network) connectLink(link *networkLink) error {
+	from := n.nodes[link.From]
+	addr := link.proxy.addr()
+	if err := from.Client.AddNode(addr, rpcclient.ANAdd); err != nil {
+		return err
+	}
+
+	deadline := time.Now().Add(linkConnectTimeout)
+	for {
+		peers, err := from.Client.GetPeerInfo()
+		if err != nil {
+			return err
+		}
+		for _, peer := range peers {
+			if peer.Addr == addr {
+				return nil
+			}
+		}
+		if time.Now().After(deadline) {
+			return fmt.Errorf("timeout connecting node %d to node %d",
+				link.From, link.To)
+		}
+		time.Sleep(linkPollInterval)
+	}
+}
+
+// Partition splits the network into the passed groups of node indexes by
+// cutting all links between nodes of different groups.  Nodes which are not
+// part of any group form a group of their own.  Links within a group which
+// were cut by an earlier partition are not restored.
+func (n *Network) Partition(groups ...[]int) error {
+	group := make(map[int]int)
+	for i, nodes := range groups {
+		for _, node := range nodes {
+			if node < 0 || node >= len(n.nodes) {
+				return fmt.Errorf("invalid node %d", node)
+			}
+			group[node] = i
+		}
+	}
+	groupOf := func(node int) int {
+		if i, ok := group[node]; ok {
+			return i
+		}
+		return len(groups) + node
+	}
+
+	for _, link := range n.links {
+		if link.cut || groupOf(link.From) == groupOf(link.To) {
+			continue
+		}
+
+		// Remove the persistent connection before blocking the proxy,
+		// since blocking it drops the connection, after which the
+		// source node no longer knows the peer.  The source node only
+		// retries the connection after several seconds, so it can't
+		// reconnect before the proxy is blocked.
+		from := n.nodes[link.From]
+		err := from.Client.AddNode(link.proxy.addr(), rpcclient.ANRemove)
+		if err != nil {
+			return err
+		}
+		link.proxy.setBlocked(true)
+		link.cut = true
+	}
+	return nil
+}
+
+// Heal restores all links cut by Partition and waits until they have been
+// established again.
+func (n *Network) Heal() error {
+	for _, link := range n.links {
+		if !link.cut {
+			continue
+		}
+		link.proxy.setBlocked(false)
+		link.cut = false
+		if err := n.connectLink(link); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// findLink returns the link between the two passed nodes along with the
+// direction of the messages sent from the first node over it.
+func (n *Network) findLink(from, to int) (*networkLink, int, error) {
+	for _, link := range n.links {
+		switch {
+		case link.From == from && link.To == to:
+			return link, 0, nil
+		case link.From == to && link.To == from:
+			return link, 1, nil
+		}
+	}
+	return nil, 0, fmt.Errorf("no link between node %d and node %d", from,
+		to)
+}
+
+// DelayMessages delays the delivery of all messages with the passed command,
+// such as "inv" or "block", which the node with the index from sends to the
+// node with the index to.  The nodes must be linked.  A zero delay removes the
+// fault.
+func (n *Network) DelayMessages(from, to int, command string, delay time.Duration) error {
+	link, direction, err := n.findLink(from, to)
+	if err != nil {
+		return err
+	}
+	link.proxy.setFault(direction, command, faultRule{delay: delay})
+	return nil
+}
+
+// DropMessages drops all messages with the passed command, such as "tx", which
+// the node with the index from sends to the node with the index to.  The nodes
+// must be linked.
+func (n *Network) DropMessages(from, to int, command string) error {
+	link, direction, err := n.findLink(from, to)
+	if err != nil {
+		return err
+	}
+	link.proxy.setFault(direction, command, faultRule{drop: true})
+	return nil
+}
+
+// ClearFaults removes all message delays and drops of the network.
+func (n *Network) ClearFaults() {
+	for _, link := range n.links {
+		if link.proxy != nil {
+			link.proxy.clearFaults()
+		}
+	}
+}
+
+// WaitForConvergence blocks until the passed nodes, or all nodes of the
+// network when none are passed, are synced with respect to the passed join
+// type.  An error is returned when they did not converge within the timeout.
+func (n *Network) WaitForConvergence(joinType JoinType, timeout time.Duration,
+	nodes ...int) error {
+
+	harnesses := n.nodes
+	if len(nodes) > 0 {
+		harnesses = make([]*Harness, 0, len(nodes))
+		for _, node := range nodes {
+			if node < 0 || node >= len(n.nodes) {
+				return fmt.Errorf("invalid node %d", node)
+			}
+			harnesses = append(harnesses, n.nodes[node])
+		}
+	}
+	return JoinNodesTimeout(harnesses, joinType, timeout)
+}
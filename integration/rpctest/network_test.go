@@ -0,0 +1,109 @@
+// Copyright (c) 2021 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+// This file is ignored during the regular tests due to the following build tag.
+// +build rpctest
+
+package rpctest
+
+import (
+	"testing"
+	"time"
+
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcd/wire"
+)
+
+// convergenceTimeout is the maximum duration to wait for the nodes of a
+// network to converge in the tests.
+const convergenceTimeout = 30 * time.Second
+
+// TestNetworkPartition ensures the nodes of a partitioned network follow their
+// own chains and reorganize to the chain with the most work once the network
+// is healed, and that dropped messages prevent relay until the faults are
+// cleared.
+func TestNetworkPartition(t *testing.T) {
+	network, err := NewNetwork(&NetworkConfig{
+		ActiveNet: &chaincfg.SimNetParams,
+		NumNodes:  3,
+		Links:     ChainLinks(3),
+	})
+	if err != nil {
+		t.Fatalf("unable to create network: %v", err)
+	}
+	defer network.TearDown()
+	if err := network.SetUp(true, 5); err != nil {
+		t.Fatalf("unable to set up network: %v", err)
+	}
+
+	// Split the network and mine a longer chain on the side of the last
+	// node.
+	if err := network.Partition([]int{0}, []int{1, 2}); err != nil {
+		t.Fatalf("unable to partition network: %v", err)
+	}
+	if _, err := network.Node(0).Client.Generate(2); err != nil {
+		t.Fatalf("unable to generate blocks: %v", err)
+	}
+	if _, err := network.Node(2).Client.Generate(4); err != nil {
+		t.Fatalf("unable to generate blocks: %v", err)
+	}
+	err = network.WaitForConvergence(Blocks, convergenceTimeout, 1, 2)
+	if err != nil {
+		t.Fatalf("partition did not converge: %v", err)
+	}
+	err = network.WaitForConvergence(Blocks, time.Second)
+	if err == nil {
+		t.Fatal("partitioned network converged")
+	}
+
+	// Once healed, the first node must reorganize to the longer chain.
+	if err := network.Heal(); err != nil {
+		t.Fatalf("unable to heal network: %v", err)
+	}
+	err = network.WaitForConvergence(Blocks, convergenceTimeout)
+	if err != nil {
+		t.Fatalf("network did not converge after healing: %v", err)
+	}
+	hash2, _, err := network.Node(2).Client.GetBestBlock()
+	if err != nil {
+		t.Fatalf("unable to get best block: %v", err)
+	}
+	hash0, _, err := network.Node(0).Client.GetBestBlock()
+	if err != nil {
+		t.Fatalf("unable to get best block: %v", err)
+	}
+	if *hash0 != *hash2 {
+		t.Fatalf("first node did not reorganize to %v", hash2)
+	}
+
+	// Blocks are not announced while the announcements from the second to
+	// the first node are dropped.
+	for _, command := range []string{wire.CmdInv, wire.CmdHeaders} {
+		if err := network.DropMessages(1, 0, command); err != nil {
+			t.Fatalf("unable to drop messages: %v", err)
+		}
+	}
+	if _, err := network.Node(2).Client.Generate(1); err != nil {
+		t.Fatalf("unable to generate blocks: %v", err)
+	}
+	err = network.WaitForConvergence(Blocks, convergenceTimeout, 1, 2)
+	if err != nil {
+		t.Fatalf("linked nodes did not converge: %v", err)
+	}
+	err = network.WaitForConvergence(Blocks, time.Second)
+	if err == nil {
+		t.Fatal("block announced despite dropped messages")
+	}
+
+	// Clearing the faults lets the next block through.
+	network.ClearFaults()
+	if _, err := network.Node(2).Client.Generate(1); err != nil {
+		t.Fatalf("unable to generate blocks: %v", err)
+	}
+	err = network.WaitForConvergence(Blocks, convergenceTimeout)
+	if err != nil {
+		t.Fatalf("network did not converge after clearing faults: %v",
+			err)
+	}
+}
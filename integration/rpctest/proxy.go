@@ -0,0 +1,231 @@
+// Copyright (c) 2021 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package rpctest
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/btcsuite/btcd/wire"
+)
+
+const (
+	// msgHeaderSize is the size of the header of a peer-to-peer message,
+	// which consists of the network magic, the command, the payload length
+	// and the payload checksum.
+	msgHeaderSize = 24
+
+	// msgCommandOffset and msgLengthOffset are the offsets of the command
+	// and the payload length within a message header.
+	msgCommandOffset = 4
+	msgLengthOffset  = 16
+)
+
+// faultRule describes how the messages with a given command which flow in one
+// direction of a link are tampered with.  Dropped messages are never
+// delivered, while delayed messages are delivered after the delay, possibly
+// after messages that were sent later.
+type faultRule struct {
+	drop  bool
+	delay time.Duration
+}
+
+// linkProxy relays the peer-to-peer connections of a link between two nodes.
+// The node at the source of the link connects to the proxy, which in turn
+// connects to the node at the target of the link.  The proxy frames the
+// relayed messages so it can inject faults for specific commands, and it can
+// block the link entirely to partition the network.
+type linkProxy struct {
+	listener net.Listener
+	target   string
+
+	mtx     sync.Mutex
+	blocked bool
+	conns   map[net.Conn]struct{}
+
+	// faults holds the fault rules for the messages sent by the source
+	// (index 0) and target (index 1) node keyed by command.
+	faults [2]map[string]faultRule
+
+	wg sync.WaitGroup
+}
+
+// newLinkProxy returns a proxy listening on a local address which relays the
+// connections it accepts to the passed target address.
+func newLinkProxy(target string) (*linkProxy, error) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, err
+	}
+	p := &linkProxy{
+		listener: listener,
+		target:   target,
+		conns:    make(map[net.Conn]struct{}),
+		faults: [2]map[string]faultRule{
+			make(map[string]faultRule),
+			make(map[string]faultRule),
+		},
+	}
+	p.wg.Add(1)
+	go p.acceptConns()
+	return p, nil
+}
+
+// addr returns the address the source node must connect to.
+func (p *linkProxy) addr() string {
+	return p.listener.Addr().String()
+}
+
+// acceptConns accepts connections until the listener is closed and relays
+// them to the target unless the link is blocked.
+//
+// This must be run as a goroutine.
+func (p *linkProxy) acceptConns() {
+	defer p.wg.Done()
+
+	for {
+		conn, err := p.listener.Accept()
+		if err != nil {
+			return
+		}
+
+		p.mtx.Lock()
+		blocked := p.blocked
+		p.mtx.Unlock()
+		if blocked {
+			conn.Close()
+			continue
+		}
+
+		targetConn, err := net.Dial("tcp", p.target)
+		if err != nil {
+			conn.Close()
+			continue
+		}
+
+		// The link might have been blocked while connecting.
+		p.mtx.Lock()
+		if p.blocked {
+			p.mtx.Unlock()
+			conn.Close()
+			targetConn.Close()
+			continue
+		}
+		p.conns[conn] = struct{}{}
+		p.conns[targetConn] = struct{}{}
+		p.mtx.Unlock()
+
+		var writeMtx [2]sync.Mutex
+		p.wg.Add(2)
+		go p.relay(conn, targetConn, 0, &writeMtx[1])
+		go p.relay(targetConn, conn, 1, &writeMtx[0])
+	}
+}
+
+// relay reads the messages sent in the passed direction from src and writes
+// them to dst, applying the fault rules of the direction, until either
+// connection fails.  Both connections are closed when relaying stops.
+//
+// This must be run as a goroutine.
+func (p *linkProxy) relay(src, dst net.Conn, direction int, dstMtx *sync.Mutex) {
+	defer p.wg.Done()
+	defer func() {
+		p.mtx.Lock()
+		delete(p.conns, src)
+		delete(p.conns, dst)
+		p.mtx.Unlock()
+		src.Close()
+		dst.Close()
+	}()
+
+	write := func(msg []byte) {
+		dstMtx.Lock()
+		dst.Write(msg)
+		dstMtx.Unlock()
+	}
+
+	header := make([]byte, msgHeaderSize)
+	for {
+		if _, err := io.ReadFull(src, header); err != nil {
+			return
+		}
+		length := binary.LittleEndian.Uint32(header[msgLengthOffset:])
+		if length > wire.MaxMessagePayload {
+			return
+		}
+		msg := make([]byte, msgHeaderSize+int(length))
+		copy(msg, header)
+		if _, err := io.ReadFull(src, msg[msgHeaderSize:]); err != nil {
+			return
+		}
+
+		command := string(bytes.TrimRight(
+			header[msgCommandOffset:msgLengthOffset], "\x00"))
+		p.mtx.Lock()
+		rule := p.faults[direction][command]
+		p.mtx.Unlock()
+		switch {
+		case rule.drop:
+		case rule.delay > 0:
+			time.AfterFunc(rule.delay, func() { write(msg) })
+		default:
+			write(msg)
+		}
+	}
+}
+
+// setFault sets the fault rule for the messages with the passed command sent
+// in the passed direction.  A zero rule removes any fault.
+func (p *linkProxy) setFault(direction int, command string, rule faultRule) {
+	p.mtx.Lock()
+	defer p.mtx.Unlock()
+
+	if rule == (faultRule{}) {
+		delete(p.faults[direction], command)
+		return
+	}
+	p.faults[direction][command] = rule
+}
+
+// clearFaults removes all fault rules of the proxy.
+func (p *linkProxy) clearFaults() {
+	p.mtx.Lock()
+	defer p.mtx.Unlock()
+
+	for direction := range p.faults {
+		p.faults[direction] = make(map[string]faultRule)
+	}
+}
+
+// setBlocked blocks or unblocks the link.  Blocking the link closes all
+// relayed connections and refuses new ones until it is unblocked.
+func (p *linkProxy) setBlocked(blocked bool) {
+	p.mtx.Lock()
+	defer p.mtx.Unlock()
+
+	p.blocked = blocked
+	if blocked {
+		for conn := range p.conns {
+			conn.Close()
+		}
+	}
+}
+
+// close stops the proxy and closes all relayed connections.
+func (p *linkProxy) close() error {
+	err := p.listener.Close()
+	p.setBlocked(true)
+	p.wg.Wait()
+	if err != nil {
+		return fmt.Errorf("unable to close proxy for %s: %v", p.target,
+			err)
+	}
+	return nil
+}
@@ -0,0 +1,129 @@
+// Copyright (c) 2021 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package rpctest
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcd/wire"
+)
+
+// TestLinkProxy ensures the link proxy relays messages in both directions and
+// drops, delays and blocks them as configured.
+func TestLinkProxy(t *testing.T) {
+	t.Parallel()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("unable to listen: %v", err)
+	}
+	defer listener.Close()
+
+	proxy, err := newLinkProxy(listener.Addr().String())
+	if err != nil {
+		t.Fatalf("unable to create proxy: %v", err)
+	}
+	defer proxy.close()
+
+	// connect connects a source node to the proxy and returns both ends of
+	// the relayed connection.
+	connect := func() (net.Conn, net.Conn) {
+		source, err := net.Dial("tcp", proxy.addr())
+		if err != nil {
+			t.Fatalf("unable to connect to proxy: %v", err)
+		}
+		target, err := listener.Accept()
+		if err != nil {
+			t.Fatalf("unable to accept relayed connection: %v", err)
+		}
+		return source, target
+	}
+
+	pver := wire.ProtocolVersion
+	btcnet := chaincfg.SimNetParams.Net
+	send := func(conn net.Conn, msg wire.Message) {
+		if err := wire.WriteMessage(conn, msg, pver, btcnet); err != nil {
+			t.Fatalf("unable to write %s: %v", msg.Command(), err)
+		}
+	}
+	receive := func(conn net.Conn) wire.Message {
+		conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+		msg, _, err := wire.ReadMessage(conn, pver, btcnet)
+		if err != nil {
+			t.Fatalf("unable to read message: %v", err)
+		}
+		return msg
+	}
+
+	source, target := connect()
+	defer source.Close()
+	defer target.Close()
+
+	// Messages are relayed in both directions.
+	send(source, wire.NewMsgPing(1))
+	if msg, ok := receive(target).(*wire.MsgPing); !ok || msg.Nonce != 1 {
+		t.Fatalf("unexpected message relayed to target: %v", msg)
+	}
+	send(target, wire.NewMsgPong(1))
+	if _, ok := receive(source).(*wire.MsgPong); !ok {
+		t.Fatal("pong not relayed to source")
+	}
+
+	// Dropped messages are never delivered, while delayed messages are
+	// delivered after those sent later.
+	proxy.setFault(0, wire.CmdPing, faultRule{drop: true})
+	proxy.setFault(0, wire.CmdSendHeaders, faultRule{delay: 200 * time.Millisecond})
+	send(source, wire.NewMsgSendHeaders())
+	send(source, wire.NewMsgPing(2))
+	send(source, wire.NewMsgVerAck())
+	if _, ok := receive(target).(*wire.MsgVerAck); !ok {
+		t.Fatal("verack not relayed first")
+	}
+	if _, ok := receive(target).(*wire.MsgSendHeaders); !ok {
+		t.Fatal("delayed sendheaders not relayed")
+	}
+
+	// The faults only apply to their direction and are removed again.
+	send(target, wire.NewMsgPing(3))
+	if _, ok := receive(source).(*wire.MsgPing); !ok {
+		t.Fatal("ping of target not relayed")
+	}
+	proxy.clearFaults()
+	send(source, wire.NewMsgPing(4))
+	if msg, ok := receive(target).(*wire.MsgPing); !ok || msg.Nonce != 4 {
+		t.Fatalf("unexpected message relayed after clearing faults: %v",
+			msg)
+	}
+
+	// Blocking the link closes the relayed connection and refuses new
+	// ones.
+	proxy.setBlocked(true)
+	source.SetReadDeadline(time.Now().Add(5 * time.Second))
+	if _, err := source.Read(make([]byte, 1)); err == nil {
+		t.Fatal("relayed connection not closed by blocking the link")
+	}
+	blocked, err := net.Dial("tcp", proxy.addr())
+	if err != nil {
+		t.Fatalf("unable to connect to proxy: %v", err)
+	}
+	blocked.SetReadDeadline(time.Now().Add(5 * time.Second))
+	if _, err := blocked.Read(make([]byte, 1)); err == nil {
+		t.Fatal("connection to blocked link not closed")
+	}
+	blocked.Close()
+
+	// Unblocking the link relays new connections again.
+	proxy.setBlocked(false)
+	source2, target2 := connect()
+	defer source2.Close()
+	defer target2.Close()
+	send(source2, wire.NewMsgPing(5))
+	if msg, ok := receive(target2).(*wire.MsgPing); !ok || msg.Nonce != 5 {
+		t.Fatalf("unexpected message relayed after unblocking: %v", msg)
+	}
+}
@@ -373,6 +373,23 @@ func (h *Harness) NewAddress() (btcutil.Address, error) {
 	return h.wallet.NewAddress()
 }
 
+// NewAddressOfType returns a fresh address of the passed type spendable by the
+// Harness' internal wallet.
+//
+// This function is safe for concurrent access.
+func (h *Harness) NewAddressOfType(addrType AddressType) (btcutil.Address, error) {
+	return h.wallet.NewAddressOfType(addrType)
+}
+
+// NewMultisigAddress returns a fresh p2wsh multisig address of nKeys keys which
+// requires nRequired signatures and is spendable by the Harness' internal
+// wallet.
+//
+// This function is safe for concurrent access.
+func (h *Harness) NewMultisigAddress(nRequired, nKeys int) (btcutil.Address, error) {
+	return h.wallet.NewMultisigAddress(nRequired, nKeys)
+}
+
 // ConfirmedBalance returns the confirmed balance of the Harness' internal
 // wallet.
 //
@@ -394,7 +411,7 @@ func (h *Harness) SendOutputs(targetOutputs []*wire.TxOut,
 
 // SendOutputsWithoutChange creates and sends a transaction that pays to the
 // specified outputs while observing the passed fee rate and ignoring a change
-// output. The passed fee rate should be expressed in sat/b.
+// output. The passed fee rate should be expressed in sat/vb.
 //
 // This function is safe for concurrent access.
 func (h *Harness) SendOutputsWithoutChange(targetOutputs []*wire.TxOut,
@@ -405,13 +422,13 @@ func (h *Harness) SendOutputsWithoutChange(targetOutputs []*wire.TxOut,
 
 // CreateTransaction returns a fully signed transaction paying to the specified
 // outputs while observing the desired fee rate. The passed fee rate should be
-// expressed in satoshis-per-byte. The transaction being created can optionally
-// include a change output indicated by the change boolean. Any unspent outputs
-// selected as inputs for the crafted transaction are marked as unspendable in
-// order to avoid potential double-spends by future calls to this method. If the
-// created transaction is cancelled for any reason then the selected inputs MUST
-// be freed via a call to UnlockOutputs. Otherwise, the locked inputs won't be
-// returned to the pool of spendable outputs.
+// expressed in satoshis-per-virtual-byte. The transaction being created can
+// optionally include a change output indicated by the change boolean. Any
+// unspent outputs selected as inputs for the crafted transaction are marked as
+// unspendable in order to avoid potential double-spends by future calls to this
+// method. If the created transaction is cancelled for any reason then the
+// selected inputs MUST be freed via a call to UnlockOutputs. Otherwise, the
+// locked inputs won't be returned to the pool of spendable outputs.
 //
 // This function is safe for concurrent access.
 func (h *Harness) CreateTransaction(targetOutputs []*wire.TxOut,
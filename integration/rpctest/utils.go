@@ -5,6 +5,7 @@
 package rpctest
 
 import (
+	"fmt"
 	"reflect"
 	"time"
 
@@ -34,73 +35,86 @@ const (
 // harnesses are at a consistent state before proceeding to an assertion or
 // check within rpc tests.
 func JoinNodes(nodes []*Harness, joinType JoinType) error {
+	return JoinNodesTimeout(nodes, joinType, 0)
+}
+
+// JoinNodesTimeout is like JoinNodes, however it returns an error when the
+// nodes are not synced within the passed timeout.  A zero timeout waits
+// forever.  This function can be used to assert the eventual convergence of
+// nodes, such as after a network partition has been healed.
+func JoinNodesTimeout(nodes []*Harness, joinType JoinType,
+	timeout time.Duration) error {
+
+	var nodesMatch func([]*Harness) (bool, error)
 	switch joinType {
 	case Blocks:
-		return syncBlocks(nodes)
+		nodesMatch = blocksMatch
 	case Mempools:
-		return syncMempools(nodes)
+		nodesMatch = mempoolsMatch
+	default:
+		return nil
 	}
-	return nil
-}
 
-// syncMempools blocks until all nodes have identical mempools.
-func syncMempools(nodes []*Harness) error {
-	poolsMatch := false
-
-retry:
-	for !poolsMatch {
-		firstPool, err := nodes[0].Client.GetRawMempool()
+	var deadline time.Time
+	if timeout > 0 {
+		deadline = time.Now().Add(timeout)
+	}
+	for {
+		match, err := nodesMatch(nodes)
 		if err != nil {
 			return err
 		}
+		if match {
+			return nil
+		}
+		if !deadline.IsZero() && time.Now().After(deadline) {
+			return fmt.Errorf("nodes not synced after %v", timeout)
+		}
+		time.Sleep(time.Millisecond * 100)
+	}
+}
 
-		// If all nodes have an identical mempool with respect to the
-		// first node, then we're done. Otherwise, drop back to the top
-		// of the loop and retry after a short wait period.
-		for _, node := range nodes[1:] {
-			nodePool, err := node.Client.GetRawMempool()
-			if err != nil {
-				return err
-			}
-
-			if !reflect.DeepEqual(firstPool, nodePool) {
-				time.Sleep(time.Millisecond * 100)
-				continue retry
-			}
+// mempoolsMatch returns whether all nodes have identical mempools.
+func mempoolsMatch(nodes []*Harness) (bool, error) {
+	firstPool, err := nodes[0].Client.GetRawMempool()
+	if err != nil {
+		return false, err
+	}
+
+	// All nodes must have an identical mempool with respect to the first
+	// node.
+	for _, node := range nodes[1:] {
+		nodePool, err := node.Client.GetRawMempool()
+		if err != nil {
+			return false, err
 		}
 
-		poolsMatch = true
+		if !reflect.DeepEqual(firstPool, nodePool) {
+			return false, nil
+		}
 	}
 
-	return nil
+	return true, nil
 }
 
-// syncBlocks blocks until all nodes report the same best chain.
-func syncBlocks(nodes []*Harness) error {
-	blocksMatch := false
-
-retry:
-	for !blocksMatch {
-		var prevHash *chainhash.Hash
-		var prevHeight int32
-		for _, node := range nodes {
-			blockHash, blockHeight, err := node.Client.GetBestBlock()
-			if err != nil {
-				return err
-			}
-			if prevHash != nil && (*blockHash != *prevHash ||
-				blockHeight != prevHeight) {
-
-				time.Sleep(time.Millisecond * 100)
-				continue retry
-			}
-			prevHash, prevHeight = blockHash, blockHeight
+// blocksMatch returns whether all nodes report the same best chain.
+func blocksMatch(nodes []*Harness) (bool, error) {
+	var prevHash *chainhash.Hash
+	var prevHeight int32
+	for _, node := range nodes {
+		blockHash, blockHeight, err := node.Client.GetBestBlock()
+		if err != nil {
+			return false, err
 		}
+		if prevHash != nil && (*blockHash != *prevHash ||
+			blockHeight != prevHeight) {
 
-		blocksMatch = true
+			return false, nil
+		}
+		prevHash, prevHeight = blockHash, blockHeight
 	}
 
-	return nil
+	return true, nil
 }
 
 // ConnectNode establishes a new peer-to-peer connection between the "from"
@@ -0,0 +1,171 @@
+// Copyright (c) 2021 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+// This file is ignored during the regular tests due to the following build tag.
+// +build rpctest
+
+package integration
+
+import (
+	"fmt"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcd/integration/rpctest"
+	"github.com/btcsuite/btcd/rpcclient"
+)
+
+// TestParallelBlockDownload ensures a node which syncs a chain in headers-first
+// mode downloads the blocks from all of its peers rather than only from its
+// sync peer.
+func TestParallelBlockDownload(t *testing.T) {
+	const (
+		numBlocks = 2000
+
+		// minBytesPerPeer is the least number of bytes the syncing
+		// node must have received from each peer, which is about a
+		// tenth of the blocks.
+		minBytesPerPeer = numBlocks / 10 * 200
+	)
+
+	// Create a chain on the first node and sync it to the second one.
+	miner, err := rpctest.New(&chaincfg.SimNetParams, nil, nil, "")
+	if err != nil {
+		t.Fatalf("unable to create miner: %v", err)
+	}
+	defer miner.TearDown()
+	if err := miner.SetUp(false, 0); err != nil {
+		t.Fatalf("unable to set up miner: %v", err)
+	}
+	if _, err := miner.Client.Generate(numBlocks); err != nil {
+		t.Fatalf("unable to generate blocks: %v", err)
+	}
+
+	relay, err := rpctest.New(&chaincfg.SimNetParams, nil, nil, "")
+	if err != nil {
+		t.Fatalf("unable to create relay: %v", err)
+	}
+	defer relay.TearDown()
+	if err := relay.SetUp(false, 0); err != nil {
+		t.Fatalf("unable to set up relay: %v", err)
+	}
+	if err := rpctest.ConnectNode(relay, miner); err != nil {
+		t.Fatalf("unable to connect relay: %v", err)
+	}
+	nodes := []*rpctest.Harness{miner, relay}
+	err = rpctest.JoinNodesTimeout(nodes, rpctest.Blocks, time.Minute)
+	if err != nil {
+		t.Fatalf("relay did not sync: %v", err)
+	}
+
+	// A third node connected to both must download blocks from each.
+	syncer, err := rpctest.New(&chaincfg.SimNetParams, nil, nil, "")
+	if err != nil {
+		t.Fatalf("unable to create syncing node: %v", err)
+	}
+	defer syncer.TearDown()
+	if err := syncer.SetUp(false, 0); err != nil {
+		t.Fatalf("unable to set up syncing node: %v", err)
+	}
+	for _, peer := range []string{miner.P2PAddress(), relay.P2PAddress()} {
+		err := syncer.Client.AddNode(peer, rpcclient.ANAdd)
+		if err != nil {
+			t.Fatalf("unable to connect syncing node: %v", err)
+		}
+	}
+	nodes = append(nodes, syncer)
+	err = rpctest.JoinNodesTimeout(nodes, rpctest.Blocks, time.Minute)
+	if err != nil {
+		t.Fatalf("node did not sync: %v", err)
+	}
+
+	peers, err := syncer.Client.GetPeerInfo()
+	if err != nil {
+		t.Fatalf("unable to get peer info: %v", err)
+	}
+	if len(peers) != 2 {
+		t.Fatalf("syncing node has %d peers instead of 2", len(peers))
+	}
+	for _, peer := range peers {
+		if peer.BytesRecv < minBytesPerPeer {
+			t.Errorf("only received %d bytes from peer %s",
+				peer.BytesRecv, peer.Addr)
+		}
+	}
+}
+
+// TestMinimumChainWork ensures a node only syncs a chain of headers with at
+// least the configured minimum chain work.
+func TestMinimumChainWork(t *testing.T) {
+	// The chain spans several headers messages, so the headers are
+	// presynced and downloaded again.
+	const numBlocks = 2500
+
+	miner, err := rpctest.New(&chaincfg.SimNetParams, nil, nil, "")
+	if err != nil {
+		t.Fatalf("unable to create miner: %v", err)
+	}
+	defer miner.TearDown()
+	if err := miner.SetUp(false, 0); err != nil {
+		t.Fatalf("unable to set up miner: %v", err)
+	}
+	if _, err := miner.Client.Generate(numBlocks); err != nil {
+		t.Fatalf("unable to generate blocks: %v", err)
+	}
+	info, err := miner.Client.GetBlockChainInfo()
+	if err != nil {
+		t.Fatalf("unable to get blockchain info: %v", err)
+	}
+	chainWork, ok := new(big.Int).SetString(info.ChainWork, 16)
+	if !ok {
+		t.Fatalf("invalid chain work %q", info.ChainWork)
+	}
+
+	// newSyncer returns a node which requires the passed minimum chain
+	// work and is connected to the miner.
+	newSyncer := func(minChainWork *big.Int) *rpctest.Harness {
+		args := []string{fmt.Sprintf("--minimumchainwork=%x",
+			minChainWork)}
+		syncer, err := rpctest.New(&chaincfg.SimNetParams, nil, args, "")
+		if err != nil {
+			t.Fatalf("unable to create syncing node: %v", err)
+		}
+		if err := syncer.SetUp(false, 0); err != nil {
+			syncer.TearDown()
+			t.Fatalf("unable to set up syncing node: %v", err)
+		}
+		err = syncer.Client.AddNode(miner.P2PAddress(), rpcclient.ANAdd)
+		if err != nil {
+			syncer.TearDown()
+			t.Fatalf("unable to connect syncing node: %v", err)
+		}
+		return syncer
+	}
+
+	// A node which requires more work than the chain has must not
+	// download any block, while a node which requires exactly the work of
+	// the chain syncs it.
+	lowWorkSyncer := newSyncer(new(big.Int).Lsh(chainWork, 1))
+	defer lowWorkSyncer.TearDown()
+	syncer := newSyncer(chainWork)
+	defer syncer.TearDown()
+
+	nodes := []*rpctest.Harness{miner, syncer}
+	err = rpctest.JoinNodesTimeout(nodes, rpctest.Blocks, time.Minute)
+	if err != nil {
+		t.Fatalf("node did not sync: %v", err)
+	}
+
+	time.Sleep(2 * time.Second)
+	_, height, err := lowWorkSyncer.Client.GetBestBlock()
+	if err != nil {
+		t.Fatalf("unable to get best block: %v", err)
+	}
+	if height != 0 {
+		t.Fatalf("node synced %d blocks of a chain with too little "+
+			"work", height)
+	}
+}
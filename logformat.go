@@ -0,0 +1,327 @@
+// Copyright (c) 2021 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/btcsuite/btclog"
+)
+
+// These constants define the supported log formats.
+const (
+	logFormatText = "text"
+	logFormatJSON = "json"
+)
+
+// Keys of the structured fields of JSON log entries.
+const (
+	logFieldPeer      = "peer"
+	logFieldBlock     = "block"
+	logFieldMethod    = "method"
+	logFieldRequestID = "request_id"
+)
+
+// logBackend creates subsystem loggers which write either the plain text lines
+// of a btclog backend or JSON objects, one per line, to the same writer.  The
+// format can be switched at any time, which allows the loggers to be created
+// before the configuration has been loaded.
+type logBackend struct {
+	text *btclog.Backend
+
+	// json is set to 1 when entries are written as JSON.  It must be
+	// accessed atomically.
+	json int32
+
+	mtx sync.Mutex
+	w   io.Writer
+}
+
+// newLogBackend returns a new log backend which writes plain text lines to the
+// passed writer until the format is changed.
+func newLogBackend(w io.Writer) *logBackend {
+	return &logBackend{
+		text: btclog.NewBackend(w),
+		w:    w,
+	}
+}
+
+// SetFormat sets the format of the log entries to either logFormatText or
+// logFormatJSON.
+func (b *logBackend) SetFormat(format string) {
+	var json int32
+	if format == logFormatJSON {
+		json = 1
+	}
+	atomic.StoreInt32(&b.json, json)
+}
+
+// Logger returns a new logger for the passed subsystem which defaults to the
+// info level.
+func (b *logBackend) Logger(subsystem string) *subsystemLogger {
+	// The level is filtered by the subsystem logger, so the text logger
+	// must pass everything on.
+	text := b.text.Logger(subsystem)
+	text.SetLevel(btclog.LevelTrace)
+
+	level := uint32(btclog.LevelInfo)
+	return &subsystemLogger{
+		backend:   b,
+		subsystem: subsystem,
+		text:      text,
+		level:     &level,
+	}
+}
+
+// logLevelNames maps the log levels to the names reported in JSON log entries,
+// which are the names accepted by the debuglevel option.
+var logLevelNames = map[btclog.Level]string{
+	btclog.LevelTrace:    "trace",
+	btclog.LevelDebug:    "debug",
+	btclog.LevelInfo:     "info",
+	btclog.LevelWarn:     "warn",
+	btclog.LevelError:    "error",
+	btclog.LevelCritical: "critical",
+}
+
+// logField is a structured field of a log entry.
+type logField struct {
+	key   string
+	value string
+}
+
+// subsystemLogger is a btclog.Logger for a subsystem which writes entries in
+// the format of its backend.  Loggers derived from it with withFields share
+// its level and attach additional fields to every entry.
+type subsystemLogger struct {
+	backend   *logBackend
+	subsystem string
+	text      btclog.Logger
+	fields    []logField
+
+	// level is the btclog.Level of the logger.  It must be accessed
+	// atomically.
+	level *uint32
+}
+
+// Ensure subsystemLogger implements the btclog.Logger interface.
+var _ btclog.Logger = (*subsystemLogger)(nil)
+
+// withFields returns a logger which shares the level of l and attaches the
+// passed fields, given as alternating keys and values, to every entry in
+// addition to the fields of l.
+func (l *subsystemLogger) withFields(keyValues ...string) *subsystemLogger {
+	fields := make([]logField, len(l.fields), len(l.fields)+len(keyValues)/2)
+	copy(fields, l.fields)
+	for i := 0; i+1 < len(keyValues); i += 2 {
+		fields = append(fields, logField{keyValues[i], keyValues[i+1]})
+	}
+
+	derived := *l
+	derived.fields = fields
+	return &derived
+}
+
+// textPrefix returns the fields of the logger formatted as key=value pairs
+// to prefix plain text messages with.
+func (l *subsystemLogger) textPrefix() string {
+	var prefix strings.Builder
+	for _, field := range l.fields {
+		fmt.Fprintf(&prefix, "%s=%s ", field.key, field.value)
+	}
+	return prefix.String()
+}
+
+// write writes an entry with the passed level.  The message is formatted
+// according to the format specifier when printf is set, or using the default
+// formats of the arguments like btclog otherwise.
+func (l *subsystemLogger) write(level btclog.Level, printf bool, format string,
+	args []interface{}) {
+
+	if level < l.Level() {
+		return
+	}
+
+	var msg string
+	if printf {
+		msg = fmt.Sprintf(format, args...)
+	} else {
+		msg = strings.TrimSuffix(fmt.Sprintln(args...), "\n")
+	}
+
+	if atomic.LoadInt32(&l.backend.json) == 0 {
+		l.writeText(level, msg)
+		return
+	}
+	l.backend.writeJSON(time.Now(), level, l.subsystem, msg, l.fields)
+}
+
+// writeText writes an entry with the passed level and message prefixed by the
+// fields of the logger using the text logger.
+func (l *subsystemLogger) writeText(level btclog.Level, msg string) {
+	var printf func(string, ...interface{})
+	switch level {
+	case btclog.LevelTrace:
+		printf = l.text.Tracef
+	case btclog.LevelDebug:
+		printf = l.text.Debugf
+	case btclog.LevelInfo:
+		printf = l.text.Infof
+	case btclog.LevelWarn:
+		printf = l.text.Warnf
+	case btclog.LevelError:
+		printf = l.text.Errorf
+	default:
+		printf = l.text.Criticalf
+	}
+	printf("%s%s", l.textPrefix(), msg)
+}
+
+// writeJSON writes a log entry as a JSON object on a single line.
+func (b *logBackend) writeJSON(t time.Time, level btclog.Level, subsystem,
+	msg string, fields []logField) {
+
+	var buf bytes.Buffer
+	writeString := func(key, value string) {
+		// Marshalling a string never fails.
+		k, _ := json.Marshal(key)
+		v, _ := json.Marshal(value)
+		buf.WriteByte(',')
+		buf.Write(k)
+		buf.WriteByte(':')
+		buf.Write(v)
+	}
+	buf.WriteString(`{"time":"`)
+	buf.WriteString(t.UTC().Format(time.RFC3339Nano))
+	buf.WriteByte('"')
+	writeString("level", logLevelNames[level])
+	writeString("subsystem", subsystem)
+	writeString("msg", msg)
+	for _, field := range fields {
+		writeString(field.key, field.value)
+	}
+	buf.WriteString("}\n")
+
+	b.mtx.Lock()
+	b.w.Write(buf.Bytes())
+	b.mtx.Unlock()
+}
+
+// Tracef formats message according to format specifier and writes to log with
+// LevelTrace.
+//
+// This is part of the btclog.Logger interface.
+func (l *subsystemLogger) Tracef(format string, args ...interface{}) {
+	l.write(btclog.LevelTrace, true, format, args)
+}
+
+// Debugf formats message according to format specifier and writes to log with
+// LevelDebug.
+//
+// This is part of the btclog.Logger interface.
+func (l *subsystemLogger) Debugf(format string, args ...interface{}) {
+	l.write(btclog.LevelDebug, true, format, args)
+}
+
+// Infof formats message according to format specifier and writes to log with
+// LevelInfo.
+//
+// This is part of the btclog.Logger interface.
+func (l *subsystemLogger) Infof(format string, args ...interface{}) {
+	l.write(btclog.LevelInfo, true, format, args)
+}
+
+// Warnf formats message according to format specifier and writes to log with
+// LevelWarn.
+//
+// This is part of the btclog.Logger interface.
+func (l *subsystemLogger) Warnf(format string, args ...interface{}) {
+	l.write(btclog.LevelWarn, true, format, args)
+}
+
+// Errorf formats message according to format specifier and writes to log with
+// LevelError.
+//
+// This is part of the btclog.Logger interface.
+func (l *subsystemLogger) Errorf(format string, args ...interface{}) {
+	l.write(btclog.LevelError, true, format, args)
+}
+
+// Criticalf formats message according to format specifier and writes to log
+// with LevelCritical.
+//
+// This is part of the btclog.Logger interface.
+func (l *subsystemLogger) Criticalf(format string, args ...interface{}) {
+	l.write(btclog.LevelCritical, true, format, args)
+}
+
+// Trace formats message using the default formats for its operands and writes
+// to log with LevelTrace.
+//
+// This is part of the btclog.Logger interface.
+func (l *subsystemLogger) Trace(args ...interface{}) {
+	l.write(btclog.LevelTrace, false, "", args)
+}
+
+// Debug formats message using the default formats for its operands and writes
+// to log with LevelDebug.
+//
+// This is part of the btclog.Logger interface.
+func (l *subsystemLogger) Debug(args ...interface{}) {
+	l.write(btclog.LevelDebug, false, "", args)
+}
+
+// Info formats message using the default formats for its operands and writes
+// to log with LevelInfo.
+//
+// This is part of the btclog.Logger interface.
+func (l *subsystemLogger) Info(args ...interface{}) {
+	l.write(btclog.LevelInfo, false, "", args)
+}
+
+// Warn formats message using the default formats for its operands and writes
+// to log with LevelWarn.
+//
+// This is part of the btclog.Logger interface.
+func (l *subsystemLogger) Warn(args ...interface{}) {
+	l.write(btclog.LevelWarn, false, "", args)
+}
+
+// Error formats message using the default formats for its operands and writes
+// to log with LevelError.
+//
+// This is part of the btclog.Logger interface.
+func (l *subsystemLogger) Error(args ...interface{}) {
+	l.write(btclog.LevelError, false, "", args)
+}
+
+// Critical formats message using the default formats for its operands and
+// writes to log with LevelCritical.
+//
+// This is part of the btclog.Logger interface.
+func (l *subsystemLogger) Critical(args ...interface{}) {
+	l.write(btclog.LevelCritical, false, "", args)
+}
+
+// Level returns the current logging level.
+//
+// This is part of the btclog.Logger interface.
+func (l *subsystemLogger) Level() btclog.Level {
+	return btclog.Level(atomic.LoadUint32(l.level))
+}
+
+// SetLevel changes the logging level to the passed level.
+//
+// This is part of the btclog.Logger interface.
+func (l *subsystemLogger) SetLevel(level btclog.Level) {
+	atomic.StoreUint32(l.level, uint32(level))
+}
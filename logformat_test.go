@@ -0,0 +1,113 @@
+// Copyright (c) 2021 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btclog"
+)
+
+// TestLogFormats ensures subsystem loggers write entries in the configured
+// format with the expected fields and respect their level.
+func TestLogFormats(t *testing.T) {
+	t.Parallel()
+
+	var buf bytes.Buffer
+	backend := newLogBackend(&buf)
+	log := backend.Logger("TEST")
+	hash := chainhash.Hash{0x01}
+
+	// Plain text lines are prefixed with the fields of derived loggers.
+	log.withFields(logFieldRequestID, "abc").Infof("Hello %s", "world")
+	log.Debugf("Filtered")
+	got := buf.String()
+	if !strings.HasSuffix(got, " [INF] TEST: request_id=abc Hello world\n") {
+		t.Fatalf("text: unexpected entry %q", got)
+	}
+
+	// JSON entries carry the fields of derived loggers only, no matter what
+	// the arguments are.  Derived loggers share the level of their parent.
+	backend.SetFormat(logFormatJSON)
+	buf.Reset()
+	rpcLog := log.withFields(logFieldRequestID, "abc", logFieldMethod,
+		"getblock")
+	log.SetLevel(btclog.LevelDebug)
+	rpcLog.withFields(logFieldBlock, hash.String(), logFieldPeer,
+		"1.2.3.4:1331").Debugf("Processed block %v", &hash)
+	log.Warnf("Block %v", hash)
+	log.Tracef("Filtered")
+
+	lines := strings.Split(strings.TrimSuffix(buf.String(), "\n"), "\n")
+	want := []map[string]string{{
+		"level":           "debug",
+		"subsystem":       "TEST",
+		"msg":             "Processed block " + hash.String(),
+		logFieldRequestID: "abc",
+		logFieldMethod:    "getblock",
+		logFieldBlock:     hash.String(),
+		logFieldPeer:      "1.2.3.4:1331",
+	}, {
+		"level":     "warn",
+		"subsystem": "TEST",
+		"msg":       "Block " + hash.String(),
+	}}
+	if len(lines) != len(want) {
+		t.Fatalf("json: got %d entries, want %d: %q", len(lines),
+			len(want), buf.String())
+	}
+	for i, line := range lines {
+		var entry map[string]string
+		if err := json.Unmarshal([]byte(line), &entry); err != nil {
+			t.Fatalf("json: entry %d is invalid: %v", i, err)
+		}
+		if entry["time"] == "" {
+			t.Fatalf("json: entry %d has no time", i)
+		}
+		delete(entry, "time")
+		if len(entry) != len(want[i]) {
+			t.Fatalf("json: entry %d: got %v, want %v", i, entry,
+				want[i])
+		}
+		for key, value := range want[i] {
+			if entry[key] != value {
+				t.Fatalf("json: entry %d: got %v, want %v", i,
+					entry, want[i])
+			}
+		}
+	}
+}
+
+// TestValidRequestID ensures only acceptable correlation IDs provided by
+// clients are used.
+func TestValidRequestID(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		id    string
+		valid bool
+	}{
+		{"", false},
+		{"abc-123_DEF.4", true},
+		{strings.Repeat("a", maxRequestIDLen), true},
+		{strings.Repeat("a", maxRequestIDLen+1), false},
+		{"abc def", false},
+		{"abc\n", false},
+		{`"abc"`, false},
+	}
+	for _, test := range tests {
+		if got := validRequestID(test.id); got != test.valid {
+			t.Errorf("validRequestID(%q): got %v, want %v", test.id,
+				got, test.valid)
+		}
+	}
+	if id := newRequestID(); !validRequestID(id) {
+		t.Errorf("newRequestID: generated invalid ID %q", id)
+	}
+}
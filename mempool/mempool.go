@@ -100,6 +100,12 @@ type Config struct {
 	// This can be nil if the address index is not enabled.
 	AddrIndex *indexers.AddrIndex
 
+	// AddrUtxoIndex defines the optional address utxo index instance to
+	// use for indexing the balance changes of the unconfirmed transactions
+	// in the memory pool.  This can be nil if the address utxo index is
+	// not enabled.
+	AddrUtxoIndex *indexers.AddrUtxoIndex
+
 	// FeeEstimatator provides a feeEstimator. If it is not nil, the mempool
 	// records all new transactions it observes into the feeEstimator.
 	FeeEstimator *FeeEstimator
@@ -485,6 +491,9 @@ func (mp *TxPool) removeTransaction(tx *btcutil.Tx, removeRedeemers bool) {
 		if mp.cfg.AddrIndex != nil {
 			mp.cfg.AddrIndex.RemoveUnconfirmedTx(txHash)
 		}
+		if mp.cfg.AddrUtxoIndex != nil {
+			mp.cfg.AddrUtxoIndex.RemoveUnconfirmedTx(txHash)
+		}
 
 		// Mark the referenced outpoints as unspent by the pool.
 		for _, txIn := range txDesc.Tx.MsgTx().TxIn {
@@ -558,6 +567,9 @@ func (mp *TxPool) addTransaction(utxoView *blockchain.UtxoViewpoint, tx *btcutil
 	if mp.cfg.AddrIndex != nil {
 		mp.cfg.AddrIndex.AddUnconfirmedTx(tx, utxoView)
 	}
+	if mp.cfg.AddrUtxoIndex != nil {
+		mp.cfg.AddrUtxoIndex.AddUnconfirmedTx(tx, utxoView)
+	}
 
 	// Record this tx for fee estimation if enabled.
 	if mp.cfg.FeeEstimator != nil {
@@ -825,6 +837,24 @@ func (mp *TxPool) FetchTransaction(txHash *chainhash.Hash) (*btcutil.Tx, error)
 	return nil, fmt.Errorf("transaction is not in the pool")
 }
 
+// FetchTxDesc returns the descriptor of the requested transaction from the
+// transaction pool.  This only fetches from the main transaction pool and does
+// not include orphans.
+//
+// This function is safe for concurrent access.
+func (mp *TxPool) FetchTxDesc(txHash *chainhash.Hash) (*TxDesc, error) {
+	// Protect concurrent access.
+	mp.mtx.RLock()
+	txDesc, exists := mp.pool[*txHash]
+	mp.mtx.RUnlock()
+
+	if exists {
+		return txDesc, nil
+	}
+
+	return nil, fmt.Errorf("transaction is not in the pool")
+}
+
 // validateReplacement determines whether a transaction is deemed as a valid
 // replacement of all of its conflicts according to the RBF policy. If it is
 // valid, no error is returned. Otherwise, an error is returned indicating what
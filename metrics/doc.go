@@ -0,0 +1,35 @@
+// Copyright (c) 2021 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+/*
+Package metrics implements counters, gauges and histograms which are exported
+in the Prometheus text exposition format.
+
+Overview
+
+A Registry holds metric families which are identified by their name.  Counters,
+gauges and histograms are created with the methods of the registry, either as a
+single metric or as a vec of metrics which are distinguished by the values of
+their labels.  Metrics whose values are tracked elsewhere, such as the traffic
+of connected peers, can instead be collected on demand with NewGaugeFunc and
+NewFunc.
+
+The registry implements http.Handler, so it can be served to Prometheus
+directly without the caller depending on the Prometheus client libraries:
+
+	registry := metrics.NewRegistry()
+	requests := registry.NewCounterVec("app_requests_total",
+		"Number of requests per method.", "method")
+	latency := registry.NewHistogram("app_request_duration_seconds",
+		"Time taken to serve a request.", metrics.DefaultBuckets)
+
+	requests.With("getblock").Inc()
+	latency.Observe(0.02)
+
+	http.Handle("/metrics", registry)
+
+All metrics are safe for concurrent access and updating them does not block, so
+they can be used on hot paths.
+*/
+package metrics
@@ -0,0 +1,268 @@
+// Copyright (c) 2021 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package metrics
+
+import (
+	"math"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// Type identifies the type of a metric family as reported to Prometheus.
+type Type string
+
+// These constants define the supported metric types.
+const (
+	TypeCounter   Type = "counter"
+	TypeGauge     Type = "gauge"
+	TypeHistogram Type = "histogram"
+)
+
+// atomicFloat is a float64 which is safe for concurrent access.
+type atomicFloat struct {
+	bits uint64
+}
+
+// Add adds the passed value.
+func (f *atomicFloat) Add(v float64) {
+	for {
+		old := atomic.LoadUint64(&f.bits)
+		sum := math.Float64bits(math.Float64frombits(old) + v)
+		if atomic.CompareAndSwapUint64(&f.bits, old, sum) {
+			return
+		}
+	}
+}
+
+// Set sets the value to the passed value.
+func (f *atomicFloat) Set(v float64) {
+	atomic.StoreUint64(&f.bits, math.Float64bits(v))
+}
+
+// Value returns the current value.
+func (f *atomicFloat) Value() float64 {
+	return math.Float64frombits(atomic.LoadUint64(&f.bits))
+}
+
+// Counter is a metric whose value only ever increases, such as the number of
+// requests served.
+//
+// All methods are safe for concurrent access.
+type Counter struct {
+	value atomicFloat
+}
+
+// Inc increments the counter by one.
+func (c *Counter) Inc() {
+	c.value.Add(1)
+}
+
+// Add increments the counter by the passed value.  Negative values are
+// ignored since counters must not decrease.
+func (c *Counter) Add(v float64) {
+	if v > 0 {
+		c.value.Add(v)
+	}
+}
+
+// Value returns the current value of the counter.
+func (c *Counter) Value() float64 {
+	return c.value.Value()
+}
+
+// Gauge is a metric whose value can arbitrarily go up and down, such as the
+// number of connected peers.
+//
+// All methods are safe for concurrent access.
+type Gauge struct {
+	value atomicFloat
+}
+
+// Set sets the gauge to the passed value.
+func (g *Gauge) Set(v float64) {
+	g.value.Set(v)
+}
+
+// Add adds the passed value, which may be negative, to the gauge.
+func (g *Gauge) Add(v float64) {
+	g.value.Add(v)
+}
+
+// Value returns the current value of the gauge.
+func (g *Gauge) Value() float64 {
+	return g.value.Value()
+}
+
+// Histogram samples observations, such as request latencies, and counts them
+// in configurable buckets.  It also tracks the number and the sum of all
+// observations.
+//
+// All methods are safe for concurrent access.
+type Histogram struct {
+	// sum is the sum of all observations.  It is the first field so it is
+	// properly aligned for atomic access on 32-bit platforms.
+	sum atomicFloat
+
+	// upperBounds are the sorted inclusive upper bounds of the buckets.
+	// The implicit +Inf bucket is not included.
+	upperBounds []float64
+
+	// counts holds the number of observations that fell into each bucket
+	// followed by the number that exceeded all upper bounds.  Note that
+	// the counts are not cumulative.
+	counts []uint64
+}
+
+// newHistogram returns a new histogram using the passed bucket upper bounds,
+// which must be sorted in increasing order.
+func newHistogram(upperBounds []float64) *Histogram {
+	return &Histogram{
+		upperBounds: upperBounds,
+		counts:      make([]uint64, len(upperBounds)+1),
+	}
+}
+
+// Observe adds the passed observation to the histogram.
+func (h *Histogram) Observe(v float64) {
+	i := sort.SearchFloat64s(h.upperBounds, v)
+	atomic.AddUint64(&h.counts[i], 1)
+	h.sum.Add(v)
+}
+
+// snapshot returns the cumulative bucket counts along with the total number
+// and sum of the observations.  Observations made while the snapshot is taken
+// might only be partially reflected.
+func (h *Histogram) snapshot() ([]uint64, uint64, float64) {
+	cumulative := make([]uint64, len(h.counts))
+	var total uint64
+	for i := range h.counts {
+		total += atomic.LoadUint64(&h.counts[i])
+		cumulative[i] = total
+	}
+	return cumulative, total, h.sum.Value()
+}
+
+// DefaultBuckets are histogram bucket upper bounds suitable for latencies in
+// seconds ranging from a millisecond to a minute.
+var DefaultBuckets = []float64{.001, .0025, .005, .01, .025, .05, .1, .25,
+	.5, 1, 2.5, 5, 10, 30, 60}
+
+// ExponentialBuckets returns count histogram bucket upper bounds where the
+// first is start and each subsequent one is the previous multiplied by factor.
+// It panics when count is less than one, start is not positive or factor is
+// not greater than one.
+func ExponentialBuckets(start, factor float64, count int) []float64 {
+	if count < 1 || start <= 0 || factor <= 1 {
+		panic("metrics: invalid exponential buckets")
+	}
+	buckets := make([]float64, count)
+	for i := range buckets {
+		buckets[i] = start
+		start *= factor
+	}
+	return buckets
+}
+
+// vec is a collection of metrics of a family which are distinguished by the
+// values of their labels.
+type vec struct {
+	labels  []string
+	newFunc func() interface{}
+
+	mtx     sync.RWMutex
+	metrics map[string]interface{}
+}
+
+// labelValuesSep separates the label values of a metric in the keys of the
+// metrics map of a vec.  It can't occur in valid UTF-8 label values.
+const labelValuesSep = "\xff"
+
+// with returns the metric with the passed label values, creating it if it does
+// not exist yet.  It panics when the number of label values does not match the
+// number of labels of the vec.
+func (v *vec) with(values []string) interface{} {
+	if len(values) != len(v.labels) {
+		panic("metrics: wrong number of label values")
+	}
+	key := strings.Join(values, labelValuesSep)
+
+	v.mtx.RLock()
+	metric, ok := v.metrics[key]
+	v.mtx.RUnlock()
+	if ok {
+		return metric
+	}
+
+	v.mtx.Lock()
+	defer v.mtx.Unlock()
+	if metric, ok := v.metrics[key]; ok {
+		return metric
+	}
+	metric = v.newFunc()
+	v.metrics[key] = metric
+	return metric
+}
+
+// forEach invokes the passed function with the label values and the metric of
+// each metric in the vec sorted by the label values.
+func (v *vec) forEach(fn func(values []string, metric interface{})) {
+	v.mtx.RLock()
+	keys := make([]string, 0, len(v.metrics))
+	for key := range v.metrics {
+		keys = append(keys, key)
+	}
+	metrics := make([]interface{}, len(keys))
+	sort.Strings(keys)
+	for i, key := range keys {
+		metrics[i] = v.metrics[key]
+	}
+	v.mtx.RUnlock()
+
+	for i, key := range keys {
+		var values []string
+		if len(v.labels) > 0 {
+			values = strings.Split(key, labelValuesSep)
+		}
+		fn(values, metrics[i])
+	}
+}
+
+// CounterVec is a collection of counters which are distinguished by the values
+// of their labels, such as the number of calls per RPC method.
+type CounterVec struct {
+	vec
+}
+
+// With returns the counter with the passed label values, which must be given
+// in the order of the labels of the vec.
+func (v *CounterVec) With(values ...string) *Counter {
+	return v.with(values).(*Counter)
+}
+
+// GaugeVec is a collection of gauges which are distinguished by the values of
+// their labels.
+type GaugeVec struct {
+	vec
+}
+
+// With returns the gauge with the passed label values, which must be given in
+// the order of the labels of the vec.
+func (v *GaugeVec) With(values ...string) *Gauge {
+	return v.with(values).(*Gauge)
+}
+
+// HistogramVec is a collection of histograms which are distinguished by the
+// values of their labels, such as the latency per RPC method.
+type HistogramVec struct {
+	vec
+}
+
+// With returns the histogram with the passed label values, which must be given
+// in the order of the labels of the vec.
+func (v *HistogramVec) With(values ...string) *Histogram {
+	return v.with(values).(*Histogram)
+}
@@ -0,0 +1,193 @@
+// Copyright (c) 2021 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package metrics
+
+import (
+	"bytes"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+)
+
+// TestRegistryWrite ensures the metrics of a registry are written in the
+// Prometheus text exposition format as expected.
+func TestRegistryWrite(t *testing.T) {
+	t.Parallel()
+
+	r := NewRegistry()
+	blocks := r.NewCounter("test_blocks_total", "Number of blocks.")
+	height := r.NewGauge("test_height", "Chain height.")
+	calls := r.NewCounterVec("test_calls_total", "Calls per method.",
+		"method")
+	latency := r.NewHistogram("test_latency_seconds", "Latency.",
+		[]float64{0.1, 1})
+	r.NewGaugeFunc("test_func", "Line one\nwith \\ backslash.",
+		func() float64 { return math.Inf(1) })
+	r.NewFunc("test_peer_bytes_total", "Bytes per peer.", TypeCounter,
+		[]string{"addr", "direction"},
+		func(emit func(float64, ...string)) {
+			emit(10, `1.2.3.4:1331`, "sent")
+			emit(20, `we"ird\`, "received")
+		})
+
+	blocks.Inc()
+	blocks.Add(2.5)
+	blocks.Add(-1)
+	height.Set(100)
+	height.Add(-1)
+	calls.With("getblock").Inc()
+	calls.With("getblock").Inc()
+	calls.With("getinfo").Inc()
+	latency.Observe(0.05)
+	latency.Observe(0.1)
+	latency.Observe(0.5)
+	latency.Observe(3)
+
+	want := `# HELP test_blocks_total Number of blocks.
+# TYPE test_blocks_total counter
+test_blocks_total 3.5
+# HELP test_height Chain height.
+# TYPE test_height gauge
+test_height 99
+# HELP test_calls_total Calls per method.
+# TYPE test_calls_total counter
+test_calls_total{method="getblock"} 2
+test_calls_total{method="getinfo"} 1
+# HELP test_latency_seconds Latency.
+# TYPE test_latency_seconds histogram
+test_latency_seconds_bucket{le="0.1"} 2
+test_latency_seconds_bucket{le="1"} 3
+test_latency_seconds_bucket{le="+Inf"} 4
+test_latency_seconds_sum 3.65
+test_latency_seconds_count 4
+# HELP test_func Line one\nwith \\ backslash.
+# TYPE test_func gauge
+test_func +Inf
+# HELP test_peer_bytes_total Bytes per peer.
+# TYPE test_peer_bytes_total counter
+test_peer_bytes_total{addr="1.2.3.4:1331",direction="sent"} 10
+test_peer_bytes_total{addr="we\"ird\\",direction="received"} 20
+`
+	var buf bytes.Buffer
+	n, err := r.WriteTo(&buf)
+	if err != nil {
+		t.Fatalf("WriteTo: unexpected error: %v", err)
+	}
+	if got := buf.String(); got != want {
+		t.Fatalf("WriteTo: got\n%s\nwant\n%s", got, want)
+	}
+	if n != int64(buf.Len()) {
+		t.Fatalf("WriteTo: got %d bytes written, want %d", n, buf.Len())
+	}
+
+	// Ensure the registry is served over HTTP with the expected content
+	// type and only for GET and HEAD requests.
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest("GET", "/metrics", nil))
+	if w.Code != http.StatusOK || w.Body.String() != want {
+		t.Fatalf("ServeHTTP: got status %d and body\n%s", w.Code,
+			w.Body.String())
+	}
+	if got := w.Header().Get("Content-Type"); got != ContentType {
+		t.Fatalf("ServeHTTP: got content type %q, want %q", got,
+			ContentType)
+	}
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest("POST", "/metrics", nil))
+	if w.Code != http.StatusMethodNotAllowed {
+		t.Fatalf("ServeHTTP: got status %d for POST, want %d", w.Code,
+			http.StatusMethodNotAllowed)
+	}
+}
+
+// TestConcurrentUpdates ensures metrics may be updated concurrently without
+// losing updates.
+func TestConcurrentUpdates(t *testing.T) {
+	t.Parallel()
+
+	r := NewRegistry()
+	counter := r.NewCounterVec("test_total", "Counter.", "label")
+	histogram := r.NewHistogram("test_seconds", "Histogram.",
+		ExponentialBuckets(1, 2, 4))
+
+	const goroutines, updates = 8, 1000
+	var wg sync.WaitGroup
+	for i := 0; i < goroutines; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < updates; j++ {
+				counter.With("a").Inc()
+				histogram.Observe(float64(j % 10))
+			}
+		}()
+	}
+	wg.Wait()
+
+	if got := counter.With("a").Value(); got != goroutines*updates {
+		t.Fatalf("counter: got %v, want %v", got, goroutines*updates)
+	}
+	cumulative, count, sum := histogram.snapshot()
+	if count != goroutines*updates {
+		t.Fatalf("histogram count: got %d, want %d", count,
+			goroutines*updates)
+	}
+	if want := float64(goroutines * updates / 10 * 45); sum != want {
+		t.Fatalf("histogram sum: got %v, want %v", sum, want)
+	}
+
+	// The buckets have the upper bounds 1, 2, 4 and 8, so they contain the
+	// observations 0-1, 0-2, 0-4 and 0-8.
+	for i, want := range []uint64{2, 3, 5, 9, 10} {
+		want *= goroutines * updates / 10
+		if cumulative[i] != want {
+			t.Fatalf("histogram bucket %d: got %d, want %d", i,
+				cumulative[i], want)
+		}
+	}
+}
+
+// TestInvalidMetrics ensures invalid metric definitions are rejected.
+func TestInvalidMetrics(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name string
+		fn   func(r *Registry)
+	}{
+		{"invalid name", func(r *Registry) { r.NewCounter("1abc", "") }},
+		{"invalid label", func(r *Registry) { r.NewGaugeVec("abc", "", "a:b") }},
+		{"reserved label", func(r *Registry) { r.NewGaugeVec("abc", "", "__a") }},
+		{"le label", func(r *Registry) {
+			r.NewHistogramVec("abc", "", DefaultBuckets, "le")
+		}},
+		{"unsorted buckets", func(r *Registry) {
+			r.NewHistogram("abc", "", []float64{1, 1})
+		}},
+		{"duplicate", func(r *Registry) {
+			r.NewCounter("abc", "")
+			r.NewGauge("abc", "")
+		}},
+		{"histogram func", func(r *Registry) {
+			r.NewFunc("abc", "", TypeHistogram, nil, nil)
+		}},
+		{"label values", func(r *Registry) {
+			r.NewCounterVec("abc", "", "a", "b").With("a")
+		}},
+	}
+
+	for _, test := range tests {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("%s: did not panic", test.name)
+				}
+			}()
+			test.fn(NewRegistry())
+		}()
+	}
+}
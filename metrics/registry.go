@@ -0,0 +1,365 @@
+// Copyright (c) 2021 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package metrics
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// ContentType is the content type of the Prometheus text exposition format
+// written by a Registry.
+const ContentType = "text/plain; version=0.0.4; charset=utf-8"
+
+// CollectFunc is invoked whenever the metrics of a registry are written to
+// collect the current values of a metric family whose values are computed on
+// demand.  The passed emit function must be called with the value and the
+// label values of every metric of the family.
+type CollectFunc func(emit func(value float64, labelValues ...string))
+
+// family is a group of metrics which share a name, help text and type.
+type family struct {
+	name   string
+	help   string
+	typ    Type
+	labels []string
+
+	// collect invokes the passed function with the label values and the
+	// metric of each metric of the family.  A metric is either a *Counter,
+	// *Gauge, *Histogram, a float64 or a func() float64 which returns the
+	// value.
+	collect func(fn func(labelValues []string, metric interface{}))
+}
+
+// Registry holds metric families and writes their current values in the
+// Prometheus text exposition format.  It implements http.Handler so it can be
+// served directly to Prometheus.
+//
+// The functions that create metrics panic when passed an invalid or duplicate
+// name since that is a programming error.  All methods are safe for concurrent
+// access.
+type Registry struct {
+	mtx      sync.Mutex
+	families []*family
+	names    map[string]struct{}
+}
+
+// NewRegistry returns a new empty registry.
+func NewRegistry() *Registry {
+	return &Registry{names: make(map[string]struct{})}
+}
+
+// validName returns whether the passed string is a valid metric name, or when
+// label is set, a valid label name.
+func validName(name string, label bool) bool {
+	if name == "" {
+		return false
+	}
+	for i, c := range name {
+		switch {
+		case c == '_' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z':
+		case c >= '0' && c <= '9' && i > 0:
+		case c == ':' && !label:
+		default:
+			return false
+		}
+	}
+	return !label || !strings.HasPrefix(name, "__")
+}
+
+// register adds the passed family to the registry.
+func (r *Registry) register(f *family) {
+	if !validName(f.name, false) {
+		panic(fmt.Sprintf("metrics: invalid metric name %q", f.name))
+	}
+	for _, label := range f.labels {
+		if !validName(label, true) ||
+			(f.typ == TypeHistogram && label == "le") {
+
+			panic(fmt.Sprintf("metrics: invalid label name %q of "+
+				"metric %q", label, f.name))
+		}
+	}
+
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+	if _, ok := r.names[f.name]; ok {
+		panic(fmt.Sprintf("metrics: duplicate metric name %q", f.name))
+	}
+	r.names[f.name] = struct{}{}
+	r.families = append(r.families, f)
+}
+
+// registerSingle adds a family consisting of the single passed metric without
+// labels to the registry.
+func (r *Registry) registerSingle(name, help string, typ Type, metric interface{}) {
+	r.register(&family{
+		name: name,
+		help: help,
+		typ:  typ,
+		collect: func(fn func([]string, interface{})) {
+			fn(nil, metric)
+		},
+	})
+}
+
+// registerVec adds a family consisting of the metrics of the passed vec to the
+// registry.
+func (r *Registry) registerVec(name, help string, typ Type, v *vec) {
+	r.register(&family{
+		name:    name,
+		help:    help,
+		typ:     typ,
+		labels:  v.labels,
+		collect: v.forEach,
+	})
+}
+
+// NewCounter registers and returns a new counter.
+func (r *Registry) NewCounter(name, help string) *Counter {
+	c := new(Counter)
+	r.registerSingle(name, help, TypeCounter, c)
+	return c
+}
+
+// NewCounterVec registers and returns a new collection of counters which are
+// distinguished by the values of the passed labels.
+func (r *Registry) NewCounterVec(name, help string, labels ...string) *CounterVec {
+	v := &CounterVec{vec{
+		labels:  labels,
+		newFunc: func() interface{} { return new(Counter) },
+		metrics: make(map[string]interface{}),
+	}}
+	r.registerVec(name, help, TypeCounter, &v.vec)
+	return v
+}
+
+// NewGauge registers and returns a new gauge.
+func (r *Registry) NewGauge(name, help string) *Gauge {
+	g := new(Gauge)
+	r.registerSingle(name, help, TypeGauge, g)
+	return g
+}
+
+// NewGaugeVec registers and returns a new collection of gauges which are
+// distinguished by the values of the passed labels.
+func (r *Registry) NewGaugeVec(name, help string, labels ...string) *GaugeVec {
+	v := &GaugeVec{vec{
+		labels:  labels,
+		newFunc: func() interface{} { return new(Gauge) },
+		metrics: make(map[string]interface{}),
+	}}
+	r.registerVec(name, help, TypeGauge, &v.vec)
+	return v
+}
+
+// NewHistogram registers and returns a new histogram with the passed bucket
+// upper bounds, which must be sorted in increasing order.
+func (r *Registry) NewHistogram(name, help string, buckets []float64) *Histogram {
+	checkBuckets(buckets)
+	h := newHistogram(buckets)
+	r.registerSingle(name, help, TypeHistogram, h)
+	return h
+}
+
+// NewHistogramVec registers and returns a new collection of histograms with
+// the passed bucket upper bounds which are distinguished by the values of the
+// passed labels.
+func (r *Registry) NewHistogramVec(name, help string, buckets []float64, labels ...string) *HistogramVec {
+	checkBuckets(buckets)
+	v := &HistogramVec{vec{
+		labels:  labels,
+		newFunc: func() interface{} { return newHistogram(buckets) },
+		metrics: make(map[string]interface{}),
+	}}
+	r.registerVec(name, help, TypeHistogram, &v.vec)
+	return v
+}
+
+// checkBuckets panics when the passed bucket upper bounds are not sorted in
+// strictly increasing order.
+func checkBuckets(buckets []float64) {
+	for i := 1; i < len(buckets); i++ {
+		if buckets[i] <= buckets[i-1] {
+			panic("metrics: histogram buckets are not sorted")
+		}
+	}
+}
+
+// NewGaugeFunc registers a gauge whose value is obtained by invoking the
+// passed function whenever the metrics are written.
+func (r *Registry) NewGaugeFunc(name, help string, fn func() float64) {
+	r.registerSingle(name, help, TypeGauge, fn)
+}
+
+// NewFunc registers a family of counters or gauges, according to the passed
+// type, which is collected by invoking the passed function whenever the
+// metrics are written.  This is useful for metrics of short-lived objects,
+// such as peers, whose values are tracked elsewhere.
+func (r *Registry) NewFunc(name, help string, typ Type, labels []string, fn CollectFunc) {
+	if typ != TypeCounter && typ != TypeGauge {
+		panic(fmt.Sprintf("metrics: unsupported type %q of metric %q",
+			typ, name))
+	}
+	r.register(&family{
+		name:   name,
+		help:   help,
+		typ:    typ,
+		labels: labels,
+		collect: func(collectFn func([]string, interface{})) {
+			fn(func(value float64, labelValues ...string) {
+				if len(labelValues) != len(labels) {
+					panic("metrics: wrong number of label " +
+						"values")
+				}
+				collectFn(labelValues, value)
+			})
+		},
+	})
+}
+
+// formatFloat formats the passed value as expected by Prometheus.
+func formatFloat(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	case math.IsNaN(v):
+		return "NaN"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+var (
+	// helpEscaper escapes the help text of a metric family.
+	helpEscaper = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+
+	// labelValueEscaper escapes the value of a label.
+	labelValueEscaper = strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`,
+		`\"`)
+)
+
+// writeSample writes a single sample of the family with the passed name suffix,
+// label values and value to w.  The extra label and value, if not empty, are
+// appended to the labels of the family.
+func (f *family) writeSample(w *bufio.Writer, suffix string, labelValues []string,
+	extraLabel, extraValue string, value float64) {
+
+	w.WriteString(f.name)
+	w.WriteString(suffix)
+	if len(f.labels) > 0 || extraLabel != "" {
+		w.WriteByte('{')
+		for i, label := range f.labels {
+			if i > 0 {
+				w.WriteByte(',')
+			}
+			w.WriteString(label)
+			w.WriteString(`="`)
+			labelValueEscaper.WriteString(w, labelValues[i])
+			w.WriteByte('"')
+		}
+		if extraLabel != "" {
+			if len(f.labels) > 0 {
+				w.WriteByte(',')
+			}
+			w.WriteString(extraLabel)
+			w.WriteString(`="`)
+			w.WriteString(extraValue)
+			w.WriteByte('"')
+		}
+		w.WriteByte('}')
+	}
+	w.WriteByte(' ')
+	w.WriteString(formatFloat(value))
+	w.WriteByte('\n')
+}
+
+// write writes the family in the Prometheus text exposition format to w.
+func (f *family) write(w *bufio.Writer) {
+	fmt.Fprintf(w, "# HELP %s %s\n", f.name, helpEscaper.Replace(f.help))
+	fmt.Fprintf(w, "# TYPE %s %s\n", f.name, f.typ)
+	f.collect(func(labelValues []string, metric interface{}) {
+		switch m := metric.(type) {
+		case *Counter:
+			f.writeSample(w, "", labelValues, "", "", m.Value())
+		case *Gauge:
+			f.writeSample(w, "", labelValues, "", "", m.Value())
+		case float64:
+			f.writeSample(w, "", labelValues, "", "", m)
+		case func() float64:
+			f.writeSample(w, "", labelValues, "", "", m())
+		case *Histogram:
+			cumulative, count, sum := m.snapshot()
+			for i, upperBound := range m.upperBounds {
+				f.writeSample(w, "_bucket", labelValues, "le",
+					formatFloat(upperBound),
+					float64(cumulative[i]))
+			}
+			f.writeSample(w, "_bucket", labelValues, "le", "+Inf",
+				float64(count))
+			f.writeSample(w, "_sum", labelValues, "", "", sum)
+			f.writeSample(w, "_count", labelValues, "", "",
+				float64(count))
+		}
+	})
+}
+
+// WriteTo writes the current values of all metrics of the registry in the
+// Prometheus text exposition format to w.  The families are written in the
+// order they were registered.
+//
+// This is part of the io.WriterTo interface.
+func (r *Registry) WriteTo(w io.Writer) (int64, error) {
+	r.mtx.Lock()
+	families := make([]*family, len(r.families))
+	copy(families, r.families)
+	r.mtx.Unlock()
+
+	cw := &countingWriter{w: w}
+	bw := bufio.NewWriter(cw)
+	for _, f := range families {
+		f.write(bw)
+	}
+	err := bw.Flush()
+	return cw.n, err
+}
+
+// countingWriter is an io.Writer which counts the bytes written to the wrapped
+// writer.
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+// Write writes the passed bytes to the wrapped writer.
+//
+// This is part of the io.Writer interface.
+func (cw *countingWriter) Write(p []byte) (int, error) {
+	n, err := cw.w.Write(p)
+	cw.n += int64(n)
+	return n, err
+}
+
+// ServeHTTP writes the current values of all metrics of the registry to the
+// response.
+//
+// This is part of the http.Handler interface.
+func (r *Registry) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodGet && req.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		http.Error(w, "405 Method not allowed.",
+			http.StatusMethodNotAllowed)
+		return
+	}
+	w.Header().Set("Content-Type", ContentType)
+	r.WriteTo(w)
+}
@@ -0,0 +1,251 @@
+// Copyright (c) 2021 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/btcsuite/btcd/database"
+	"github.com/btcsuite/btcd/metrics"
+	"github.com/btcsuite/btcutil"
+)
+
+const (
+	// metricsPath is the path under which the metrics are served.
+	metricsPath = "/metrics"
+
+	// metricsReadTimeout is the maximum duration for reading a request to
+	// the metrics endpoint.
+	metricsReadTimeout = 10 * time.Second
+)
+
+// serverMetrics holds the metrics of the server which are served to Prometheus
+// by the metrics endpoint.  Most metrics are collected from the chain, memory
+// pool, peers and database whenever they are scraped, while the metrics which
+// are observed as events happen are exposed as fields.
+type serverMetrics struct {
+	registry   *metrics.Registry
+	listeners  []net.Listener
+	httpServer *http.Server
+	wg         sync.WaitGroup
+
+	// blockProcessing is the time taken to process blocks, which includes
+	// their validation and connection.
+	blockProcessing *metrics.Histogram
+
+	// rpcRequests and rpcDuration are the number of calls and the latency
+	// of the standard RPC methods.
+	rpcRequests *metrics.CounterVec
+	rpcDuration *metrics.HistogramVec
+}
+
+// connectedPeers returns the connected peers of the server or nil when the
+// server is shutting down.
+func (s *server) connectedPeers() []*serverPeer {
+	replyChan := make(chan []*serverPeer)
+	select {
+	case s.query <- getPeersMsg{reply: replyChan}:
+		return <-replyChan
+	case <-s.quit:
+		return nil
+	}
+}
+
+// boolToFloat returns 1 for true and 0 for false.
+func boolToFloat(b bool) float64 {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+// newServerMetrics returns the metrics of the passed server which are served
+// on the passed listeners once started.
+func newServerMetrics(s *server, listeners []net.Listener) *serverMetrics {
+	r := metrics.NewRegistry()
+	m := &serverMetrics{
+		registry:  r,
+		listeners: listeners,
+	}
+
+	// Chain and sync state.
+	r.NewGaugeFunc("grsd_chain_height", "Height of the best chain.",
+		func() float64 {
+			return float64(s.chain.BestSnapshot().Height)
+		})
+	r.NewGaugeFunc("grsd_chain_best_block_timestamp_seconds",
+		"Timestamp of the best block.", func() float64 {
+			best := s.chain.BestSnapshot()
+			header, err := s.chain.HeaderByHash(&best.Hash)
+			if err != nil {
+				return 0
+			}
+			return float64(header.Timestamp.Unix())
+		})
+	r.NewGaugeFunc("grsd_chain_synced", "Whether the chain is believed "+
+		"to be synced (1) or not (0).", func() float64 {
+		return boolToFloat(s.chain.IsCurrent())
+	})
+	r.NewGaugeFunc("grsd_sync_peer_height", "Highest best block height "+
+		"announced by a connected peer.", func() float64 {
+		return float64(m.bestPeerHeight(s))
+	})
+	r.NewGaugeFunc("grsd_sync_progress", "Height of the best chain "+
+		"relative to the highest best block height announced by a "+
+		"connected peer, between 0 and 1.", func() float64 {
+		height := s.chain.BestSnapshot().Height
+		peerHeight := m.bestPeerHeight(s)
+		if peerHeight <= height || peerHeight <= 0 {
+			return 1
+		}
+		return float64(height) / float64(peerHeight)
+	})
+	m.blockProcessing = r.NewHistogram(
+		"grsd_block_processing_duration_seconds", "Time taken to "+
+			"validate and connect blocks.", metrics.DefaultBuckets)
+
+	// Memory pool.
+	r.NewGaugeFunc("grsd_mempool_transactions", "Number of transactions "+
+		"in the memory pool.", func() float64 {
+		return float64(s.txMemPool.Count())
+	})
+	r.NewGaugeFunc("grsd_mempool_bytes", "Total serialized size of the "+
+		"transactions in the memory pool.", func() float64 {
+		var size int
+		for _, txD := range s.txMemPool.TxDescs() {
+			size += txD.Tx.MsgTx().SerializeSize()
+		}
+		return float64(size)
+	})
+	r.NewGaugeFunc("grsd_mempool_fees_grs", "Total fees of the "+
+		"transactions in the memory pool in GRS.", func() float64 {
+		var fees int64
+		for _, txD := range s.txMemPool.TxDescs() {
+			fees += txD.Fee
+		}
+		return btcutil.Amount(fees).ToBTC()
+	})
+
+	// Peers and network traffic.
+	r.NewFunc("grsd_peers", "Number of connected peers.",
+		metrics.TypeGauge, []string{"direction"},
+		func(emit func(float64, ...string)) {
+			var inbound, outbound float64
+			for _, sp := range s.connectedPeers() {
+				if sp.Inbound() {
+					inbound++
+				} else {
+					outbound++
+				}
+			}
+			emit(inbound, "inbound")
+			emit(outbound, "outbound")
+		})
+	r.NewFunc("grsd_peer_bytes_total", "Bytes sent to and received from "+
+		"connected peers per message command.", metrics.TypeCounter,
+		[]string{"peer_id", "addr", "direction", "command"},
+		func(emit func(float64, ...string)) {
+			for _, sp := range s.connectedPeers() {
+				stats := sp.StatsSnapshot()
+				id := strconv.FormatInt(int64(stats.ID), 10)
+				for command, n := range stats.BytesSentPerMsg {
+					emit(float64(n), id, stats.Addr, "sent",
+						command)
+				}
+				for command, n := range stats.BytesRecvPerMsg {
+					emit(float64(n), id, stats.Addr,
+						"received", command)
+				}
+			}
+		})
+	r.NewFunc("grsd_net_bytes_total", "Bytes sent to and received from "+
+		"all peers since start.", metrics.TypeCounter,
+		[]string{"direction"}, func(emit func(float64, ...string)) {
+			received, sent := s.NetTotals()
+			emit(float64(sent), "sent")
+			emit(float64(received), "received")
+		})
+
+	// RPC server.
+	m.rpcRequests = r.NewCounterVec("grsd_rpc_requests_total",
+		"Number of calls per RPC method and result.", "method",
+		"result")
+	m.rpcDuration = r.NewHistogramVec("grsd_rpc_request_duration_seconds",
+		"Time taken to serve calls per RPC method.",
+		metrics.DefaultBuckets, "method")
+
+	// Database.
+	if reporter, ok := s.db.(database.CacheStatsReporter); ok {
+		r.NewFunc("grsd_db_cache_lookups_total", "Number of metadata "+
+			"lookups served by the database cache (hit) or the "+
+			"underlying storage (miss).", metrics.TypeCounter,
+			[]string{"result"}, func(emit func(float64, ...string)) {
+				hits, misses := reporter.CacheStats()
+				emit(float64(hits), "hit")
+				emit(float64(misses), "miss")
+			})
+	}
+
+	return m
+}
+
+// bestPeerHeight returns the highest best block height announced by a
+// connected peer.
+func (m *serverMetrics) bestPeerHeight(s *server) int32 {
+	var height int32
+	for _, sp := range s.connectedPeers() {
+		if lastBlock := sp.LastBlock(); lastBlock > height {
+			height = lastBlock
+		}
+	}
+	return height
+}
+
+// observeBlockProcessing records the time taken to process a block.
+func (m *serverMetrics) observeBlockProcessing(elapsed time.Duration) {
+	m.blockProcessing.Observe(elapsed.Seconds())
+}
+
+// observeRPC records a call to the passed RPC method which took the passed
+// time and failed when the passed error is not nil.
+func (m *serverMetrics) observeRPC(method string, elapsed time.Duration, err error) {
+	result := "success"
+	if err != nil {
+		result = "error"
+	}
+	m.rpcRequests.With(method, result).Inc()
+	m.rpcDuration.With(method).Observe(elapsed.Seconds())
+}
+
+// Start begins serving the metrics on the configured listeners.
+func (m *serverMetrics) Start() {
+	mux := http.NewServeMux()
+	mux.Handle(metricsPath, m.registry)
+	m.httpServer = &http.Server{
+		Handler:     mux,
+		ReadTimeout: metricsReadTimeout,
+	}
+	for _, listener := range m.listeners {
+		m.wg.Add(1)
+		go func(listener net.Listener) {
+			srvrLog.Infof("Metrics server listening on %s",
+				listener.Addr())
+			m.httpServer.Serve(listener)
+			m.wg.Done()
+		}(listener)
+	}
+}
+
+// Stop stops serving the metrics and closes the listeners.
+func (m *serverMetrics) Stop() {
+	if m.httpServer != nil {
+		m.httpServer.Close()
+	}
+	m.wg.Wait()
+}
@@ -6,8 +6,18 @@
 Package netsync implements a concurrency safe block syncing protocol. The
 SyncManager communicates with connected peers to perform an initial block
 download, keep the chain and unconfirmed transaction pool in sync, and announce
-new blocks connected to the chain. Currently the sync manager selects a single
-sync peer that it downloads all blocks from until it is up to date with the
-longest chain the sync peer is aware of.
+new blocks connected to the chain. The sync manager selects a single sync peer
+that it downloads the headers of its chain from. The blocks of the headers are
+downloaded in parallel from all peers which have them within a sliding window
+after the latest processed block, and requests that time out are re-assigned
+to other peers, until the chain is up to date with the chain the sync peer is
+aware of.
+
+While the chain has less than the minimum chain work of the network, the
+headers of the sync peer are first only checked and their work summed up
+without storing them. Once they prove to have the minimum chain work, they are
+downloaded again and verified to match the checked headers before any blocks
+are downloaded, so peers can't exhaust the resources of the node with long
+chains of cheap headers.
 */
 package netsync
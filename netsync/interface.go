@@ -5,6 +5,9 @@
 package netsync
 
 import (
+	"math/big"
+	"time"
+
 	"github.com/btcsuite/btcd/blockchain"
 	"github.com/btcsuite/btcd/chaincfg"
 	"github.com/btcsuite/btcd/chaincfg/chainhash"
@@ -37,5 +40,15 @@ type Config struct {
 	DisableCheckpoints bool
 	MaxPeers           int
 
+	// MinimumChainWork is the minimum amount of work a header chain must
+	// have before its blocks are downloaded during the initial sync.  A
+	// nil value disables the check.
+	MinimumChainWork *big.Int
+
 	FeeEstimator *mempool.FeeEstimator
+
+	// BlockProcessed, if set, is invoked with the time it took the chain to
+	// process each block handled by the sync manager, which includes the
+	// validation and connection of the block.
+	BlockProcessed func(elapsed time.Duration)
 }
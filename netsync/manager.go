@@ -6,6 +6,7 @@ package netsync
 
 import (
 	"container/list"
+	"math/big"
 	"math/rand"
 	"net"
 	"sync"
@@ -23,10 +24,46 @@ import (
 )
 
 const (
-	// minInFlightBlocks is the minimum number of blocks that should be
-	// in the request queue for headers-first mode before requesting
-	// more.
-	minInFlightBlocks = 10
+	// blockDownloadWindow is the maximum number of blocks after the latest
+	// processed block which are downloaded in parallel in headers-first
+	// mode.  Blocks which arrive out of order are held in memory until
+	// all blocks before them have been processed, so the window also
+	// bounds the memory used by the download.
+	blockDownloadWindow = 256
+
+	// maxBlocksInFlightPerPeer is the maximum number of blocks requested
+	// from a single peer at once in headers-first mode.
+	maxBlocksInFlightPerPeer = 16
+
+	// maxHeaderListLen is the number of headers whose blocks have not been
+	// processed yet after which no more headers are requested in
+	// headers-first mode until the blocks have caught up.
+	maxHeaderListLen = 50 * wire.MaxBlockHeadersPerMsg
+
+	// blockRequestTimeout is the time after which a block requested in
+	// headers-first mode is requested from another peer.
+	blockRequestTimeout = 2 * time.Minute
+
+	// windowStallTimeout is the time after which the peer the first block
+	// of the download window was requested from is disconnected, since it
+	// stalls the processing of all blocks after it.
+	windowStallTimeout = 30 * time.Second
+
+	// blockRequestCheckInterval is the interval at which the block
+	// requests of headers-first mode are checked for timeouts.
+	blockRequestCheckInterval = 5 * time.Second
+
+	// presyncCommitmentInterval is the number of heights between the
+	// hashes of the headers which are remembered during the presync of
+	// low-work headers in order to verify that the headers downloaded
+	// afterwards are the same.
+	presyncCommitmentInterval = 1000
+
+	// maxPresyncBlocksPerSecond is the maximum average number of blocks per
+	// second a chain of headers can have due to the rule that the timestamp
+	// of a block must be after the median time of the previous blocks.  It
+	// bounds the number of headers which are presynced from a peer.
+	maxPresyncBlocksPerSecond = 6
 
 	// maxRejectedTxns is the maximum number of rejected transactions
 	// hashes to store in memory.
@@ -139,16 +176,50 @@ type pauseMsg struct {
 }
 
 // headerNode is used as a node in a list of headers that are linked together
-// between checkpoints.
+// in headers-first mode.  The blocks of the headers are downloaded in parallel
+// and held by their nodes until they can be processed in order.
 type headerNode struct {
 	height int32
 	hash   *chainhash.Hash
+
+	// workSum is the total amount of work in the chain up to and including
+	// the header.
+	workSum *big.Int
+
+	// requestedFrom is the peer the block was requested from at
+	// requestTime, or the peer which delivered the block once it has been
+	// received.  It is nil while the block is not requested.
+	requestedFrom *peerpkg.Peer
+	requestTime   time.Time
+
+	// block is the downloaded block until it is processed.
+	block *btcutil.Block
+
+	// failedPeers are the peers which did not deliver the block in time
+	// or did not have it.  The block is requested from other peers first.
+	failedPeers map[*peerpkg.Peer]struct{}
+}
+
+// headerPresync tracks the presync of the headers of the sync peer, which is
+// performed when the chain of the node has less than the minimum chain work.
+// The headers are only checked and their work is summed up without storing
+// them, so a peer can't exhaust the memory of the node with a long chain of
+// cheap headers.  The hashes of the headers at every presyncCommitmentInterval
+// heights are remembered to verify that the same headers are sent again once
+// the chain has proven to have sufficient work.
+type headerPresync struct {
+	lastHash    chainhash.Hash
+	lastHeight  int32
+	maxHeight   int64
+	workSum     *big.Int
+	commitments map[int32]chainhash.Hash
 }
 
 // peerSyncState stores additional information that the SyncManager tracks
 // about a peer.
 type peerSyncState struct {
 	syncCandidate   bool
+	limited         bool
 	requestQueue    []*wire.InvVect
 	requestedTxns   map[chainhash.Hash]struct{}
 	requestedBlocks map[chainhash.Hash]struct{}
@@ -198,30 +269,67 @@ type SyncManager struct {
 	peerStates       map[*peerpkg.Peer]*peerSyncState
 	lastProgressTime time.Time
 
-	// The following fields are used for headers-first mode.
+	// The following fields are used for headers-first mode.  The front of
+	// the header list is the latest processed block, which allows the
+	// headers after it to prove they link to the chain properly, and the
+	// blocks of the remaining headers are downloaded from all peers.
 	headersFirstMode bool
 	headerList       *list.List
-	startHeader      *list.Element
+	headerIndex      map[chainhash.Hash]*list.Element
+	headersRequested bool
+	headersSynced    bool
+	fastAddHeight    int32
 	nextCheckpoint   *chaincfg.Checkpoint
 
+	// The following fields protect headers-first mode against chains of
+	// headers with less than the minimum chain work.  The commitments of a
+	// completed presync are verified against the headers downloaded
+	// afterwards.
+	minChainWork      *big.Int
+	presync           *headerPresync
+	headerCommitments map[int32]chainhash.Hash
+
 	// An optional fee estimator.
 	feeEstimator *mempool.FeeEstimator
+
+	// An optional observer of the time taken to process blocks.
+	blockProcessed func(time.Duration)
 }
 
 // resetHeaderState sets the headers-first mode state to values appropriate for
-// syncing from a new peer.
+// syncing from a new peer.  Any pending block requests of the header list are
+// cancelled.
 func (sm *SyncManager) resetHeaderState(newestHash *chainhash.Hash, newestHeight int32) {
+	for e := sm.headerList.Front(); e != nil; e = e.Next() {
+		sm.cancelBlockRequest(e.Value.(*headerNode), false)
+	}
+
 	sm.headersFirstMode = false
+	sm.headersRequested = false
+	sm.headersSynced = false
+	sm.fastAddHeight = 0
+	sm.presync = nil
+	sm.headerCommitments = nil
 	sm.headerList.Init()
-	sm.startHeader = nil
+	sm.headerIndex = make(map[chainhash.Hash]*list.Element)
+	sm.nextCheckpoint = sm.findNextHeaderCheckpoint(newestHeight)
 
-	// When there is a next checkpoint, add an entry for the latest known
-	// block into the header pool.  This allows the next downloaded header
-	// to prove it links to the chain properly.
-	if sm.nextCheckpoint != nil {
-		node := headerNode{height: newestHeight, hash: newestHash}
-		sm.headerList.PushBack(&node)
+	workSum, err := sm.chain.ChainWork(newestHash)
+	if err != nil {
+		log.Errorf("Failed to get chain work of block %v: %v",
+			newestHash, err)
+		workSum = new(big.Int)
+	}
+
+	// Add an entry for the latest known block into the header list.  This
+	// allows the next downloaded header to prove it links to the chain
+	// properly.
+	node := headerNode{
+		height:  newestHeight,
+		hash:    newestHash,
+		workSum: workSum,
 	}
+	sm.headerIndex[*newestHash] = sm.headerList.PushBack(&node)
 }
 
 // findNextHeaderCheckpoint returns the next checkpoint after the passed height.
@@ -311,9 +419,8 @@ func (sm *SyncManager) startSync() {
 
 	// Pick randomly from the set of peers greater than our block height,
 	// falling back to a random peer of the same height if none are greater.
-	//
-	// TODO(conner): Use a better algorithm to ranking peers based on
-	// observed metrics and/or sync in parallel.
+	// The sync peer only provides the headers in headers-first mode, while
+	// the blocks are downloaded from all peers in parallel.
 	var bestPeer *peerpkg.Peer
 	switch {
 	case len(higherPeers) > 0:
@@ -327,8 +434,11 @@ func (sm *SyncManager) startSync() {
 	if bestPeer != nil {
 		// Clear the requestedBlocks if the sync peer changes, otherwise
 		// we may ignore blocks we need that the last sync peer failed
-		// to send.
-		sm.requestedBlocks = make(map[chainhash.Hash]struct{})
+		// to send.  The requests of headers-first mode are tracked per
+		// header instead and remain valid.
+		if !sm.headersFirstMode {
+			sm.requestedBlocks = make(map[chainhash.Hash]struct{})
+		}
 
 		locator, err := sm.chain.LatestBlockLocator()
 		if err != nil {
@@ -340,36 +450,50 @@ func (sm *SyncManager) startSync() {
 		log.Infof("Syncing to block height %d from peer %v",
 			bestPeer.LastBlock(), bestPeer.Addr())
 
-		// When the current height is less than a known checkpoint we
-		// can use block headers to learn about which blocks comprise
-		// the chain up to the checkpoint and perform less validation
-		// for them.  This is possible since each header contains the
-		// hash of the previous header and a merkle root.  Therefore if
-		// we validate all of the received headers link together
-		// properly and the checkpoint hashes match, we can be sure the
-		// hashes for the blocks in between are accurate.  Further, once
-		// the full blocks are downloaded, the merkle root is computed
-		// and compared against the value in the header which proves the
-		// full block hasn't been tampered with.
+		// When the peer has blocks we don't, use block headers to learn
+		// about which blocks comprise its chain.  Each header contains
+		// the hash of the previous header and a merkle root, so once
+		// the received headers are validated to link together
+		// properly, the blocks can be downloaded from all peers in
+		// parallel and the merkle root computed for each block proves
+		// it hasn't been tampered with.  Further, the blocks up to a
+		// checkpoint the headers were verified against are eligible
+		// for less validation.
 		//
-		// Once we have passed the final checkpoint, or checkpoints are
-		// disabled, use standard inv messages learn about the blocks
-		// and fully validate them.  Finally, regression test mode does
-		// not support the headers-first approach so do normal block
-		// downloads when in regression test mode.
-		if sm.nextCheckpoint != nil &&
-			best.Height < sm.nextCheckpoint.Height &&
-			sm.chainParams != &chaincfg.RegressionNetParams {
+		// When a previous sync peer was lost during headers-first mode,
+		// the header download continues from the new sync peer.
+		// Otherwise, use standard inv messages to learn about new
+		// blocks.  Finally, regression test mode does not support the
+		// headers-first approach so do normal block downloads when in
+		// regression test mode.
+		sm.syncPeer = bestPeer
+		switch {
+		case sm.headersFirstMode:
+			if !sm.headersSynced {
+				sm.requestHeaders(bestPeer)
+			}
 
-			bestPeer.PushGetHeadersMsg(locator, sm.nextCheckpoint.Hash)
+		case bestPeer.LastBlock() > best.Height &&
+			sm.chainParams != &chaincfg.RegressionNetParams:
+
+			sm.resetHeaderState(&best.Hash, best.Height)
 			sm.headersFirstMode = true
-			log.Infof("Downloading headers for blocks %d to "+
-				"%d from peer %s", best.Height+1,
-				sm.nextCheckpoint.Height, bestPeer.Addr())
-		} else {
+			if sm.needsPresync() {
+				sm.startPresync()
+				log.Infof("Presyncing headers after %d from "+
+					"peer %s to verify they have the "+
+					"minimum chain work", best.Height,
+					bestPeer.Addr())
+			} else {
+				log.Infof("Downloading headers for blocks "+
+					"after %d from peer %s", best.Height,
+					bestPeer.Addr())
+			}
+			sm.requestHeaders(bestPeer)
+
+		default:
 			bestPeer.PushGetBlocksMsg(locator, &zeroHash)
 		}
-		sm.syncPeer = bestPeer
 
 		// Reset the last progress time now that we have a non-nil
 		// syncPeer to avoid instantly detecting it as stalled in the
@@ -417,6 +541,26 @@ func (sm *SyncManager) isSyncCandidate(peer *peerpkg.Peer) bool {
 	return true
 }
 
+// isLimitedPeer returns whether or not the peer is not a full node, but serves
+// the recent blocks of its best chain (BIP0159), so that it can be used to
+// download blocks which are near its tip.
+func (sm *SyncManager) isLimitedPeer(peer *peerpkg.Peer) bool {
+	nodeServices := peer.Services()
+	if nodeServices&wire.SFNodeNetwork == wire.SFNodeNetwork ||
+		nodeServices&wire.SFNodeNetworkLimited != wire.SFNodeNetworkLimited {
+
+		return false
+	}
+
+	// Witness data can't be downloaded from the peer when it isn't
+	// upgraded after the segwit soft-fork package has activated.
+	segwitActive, err := sm.chain.IsDeploymentActive(chaincfg.DeploymentSegwit)
+	if err != nil {
+		log.Errorf("Unable to query for segwit soft-fork state: %v", err)
+	}
+	return !segwitActive || peer.IsWitnessEnabled()
+}
+
 // handleNewPeerMsg deals with new peers that have signalled they may
 // be considered as a sync peer (they have already successfully negotiated).  It
 // also starts syncing if needed.  It is invoked from the syncHandler goroutine.
@@ -432,6 +576,7 @@ func (sm *SyncManager) handleNewPeerMsg(peer *peerpkg.Peer) {
 	isSyncCandidate := sm.isSyncCandidate(peer)
 	sm.peerStates[peer] = &peerSyncState{
 		syncCandidate:   isSyncCandidate,
+		limited:         !isSyncCandidate && sm.isLimitedPeer(peer),
 		requestedTxns:   make(map[chainhash.Hash]struct{}),
 		requestedBlocks: make(map[chainhash.Hash]struct{}),
 	}
@@ -440,6 +585,11 @@ func (sm *SyncManager) handleNewPeerMsg(peer *peerpkg.Peer) {
 	if isSyncCandidate && sm.syncPeer == nil {
 		sm.startSync()
 	}
+
+	// Let the new peer take part in the block download.
+	if isSyncCandidate && sm.headersFirstMode {
+		sm.fetchBlocks()
+	}
 }
 
 // handleStallSample will switch to a new sync peer if the current one has
@@ -467,7 +617,7 @@ func (sm *SyncManager) handleStallSample() {
 		return
 	}
 
-	sm.clearRequestedState(state)
+	sm.clearRequestedState(sm.syncPeer, state)
 
 	disconnectSyncPeer := sm.shouldDCStalledSyncPeer()
 	sm.updateSyncPeer(disconnectSyncPeer)
@@ -511,19 +661,24 @@ func (sm *SyncManager) handleDonePeerMsg(peer *peerpkg.Peer) {
 
 	log.Infof("Lost peer %s", peer)
 
-	sm.clearRequestedState(state)
+	sm.clearRequestedState(peer, state)
 
 	if peer == sm.syncPeer {
 		// Update the sync peer. The server has already disconnected the
 		// peer before signaling to the sync manager.
 		sm.updateSyncPeer(false)
 	}
+
+	// Request the blocks the peer didn't deliver from the other peers.
+	if sm.headersFirstMode {
+		sm.fetchBlocks()
+	}
 }
 
 // clearRequestedState wipes all expected transactions and blocks from the sync
 // manager's requested maps that were requested under a peer's sync state, This
 // allows them to be rerequested by a subsequent sync peer.
-func (sm *SyncManager) clearRequestedState(state *peerSyncState) {
+func (sm *SyncManager) clearRequestedState(peer *peerpkg.Peer, state *peerSyncState) {
 	// Remove requested transactions from the global map so that they will
 	// be fetched from elsewhere next time we get an inv.
 	for txHash := range state.requestedTxns {
@@ -534,30 +689,47 @@ func (sm *SyncManager) clearRequestedState(state *peerSyncState) {
 	// fetched from elsewhere next time we get an inv.
 	// TODO: we could possibly here check which peers have these blocks
 	// and request them now to speed things up a little.
+	//
+	// Blocks of the header list might have been re-assigned to other peers
+	// in the meantime, so they are only released when still requested from
+	// this peer.
 	for blockHash := range state.requestedBlocks {
+		if e, exists := sm.headerIndex[blockHash]; exists {
+			node := e.Value.(*headerNode)
+			if node.requestedFrom != peer || node.block != nil {
+				continue
+			}
+			node.requestedFrom = nil
+		}
 		delete(sm.requestedBlocks, blockHash)
 	}
 }
 
 // updateSyncPeer choose a new sync peer to replace the current one. If
 // dcSyncPeer is true, this method will also disconnect the current sync peer.
-// If we are in header first mode, any header state related to prefetching is
-// also reset in preparation for the next sync peer.
+// If we are in header first mode, the headers downloaded so far are kept and
+// the header download continues from the next sync peer, unless the headers
+// have to be presynced from the next sync peer again.
 func (sm *SyncManager) updateSyncPeer(dcSyncPeer bool) {
 	log.Debugf("Updating sync peer, no progress for: %v",
 		time.Since(sm.lastProgressTime))
 
-	// First, disconnect the current sync peer if requested.
+	// First, disconnect the current sync peer if requested.  It is no
+	// longer a candidate since it is disconnected asynchronously.
 	if dcSyncPeer {
+		if state, exists := sm.peerStates[sm.syncPeer]; exists {
+			state.syncCandidate = false
+		}
 		sm.syncPeer.Disconnect()
 	}
 
-	// Reset any header state before we choose our next active sync peer.
-	if sm.headersFirstMode {
+	// The presynced headers are specific to the chain of the sync peer.
+	if sm.presync != nil || sm.headerCommitments != nil {
 		best := sm.chain.BestSnapshot()
 		sm.resetHeaderState(&best.Hash, best.Height)
 	}
 
+	sm.headersRequested = false
 	sm.syncPeer = nil
 	sm.startSync()
 }
@@ -626,6 +798,9 @@ func (sm *SyncManager) handleTxMsg(tmsg *txMsg) {
 		return
 	}
 
+	if len(acceptedTxs) > 0 {
+		peer.UpdateLastTxTime(time.Now())
+	}
 	sm.peerNotifier.AnnounceNewTransactions(acceptedTxs)
 }
 
@@ -636,6 +811,15 @@ func (sm *SyncManager) current() bool {
 		return false
 	}
 
+	// A chain with less than the minimum chain work is never current.
+	if sm.minChainWork != nil {
+		best := sm.chain.BestSnapshot()
+		workSum, err := sm.chain.ChainWork(&best.Hash)
+		if err != nil || workSum.Cmp(sm.minChainWork) < 0 {
+			return false
+		}
+	}
+
 	// if blockChain thinks we are current and we have no syncPeer it
 	// is probably right.
 	if sm.syncPeer == nil {
@@ -650,6 +834,28 @@ func (sm *SyncManager) current() bool {
 	return true
 }
 
+// processBlock processes the passed block with the chain and reports the time
+// it took to the configured observer, if any.
+func (sm *SyncManager) processBlock(block *btcutil.Block, flags blockchain.BehaviorFlags) (bool, error) {
+	start := time.Now()
+	_, isOrphan, err := sm.chain.ProcessBlock(block, flags)
+	if sm.blockProcessed != nil {
+		sm.blockProcessed(time.Since(start))
+	}
+	return isOrphan, err
+}
+
+// updateLastBlockTime updates the time the peer last sent a new block when the
+// passed block extended the best chain of a chain which is current.  Blocks
+// downloaded during the initial sync don't count, so they don't protect the
+// peers serving them from eviction.
+func (sm *SyncManager) updateLastBlockTime(peer *peerpkg.Peer, hash *chainhash.Hash) {
+	if sm.chain.BestSnapshot().Hash != *hash || !sm.current() {
+		return
+	}
+	peer.UpdateLastBlockTime(time.Now())
+}
+
 // handleBlockMsg handles block messages from all peers.
 func (sm *SyncManager) handleBlockMsg(bmsg *blockMsg) {
 	peer := bmsg.peer
@@ -659,9 +865,12 @@ func (sm *SyncManager) handleBlockMsg(bmsg *blockMsg) {
 		return
 	}
 
-	// If we didn't ask for this block then the peer is misbehaving.
+	// If we didn't ask for this block then the peer is misbehaving.  The
+	// blocks of the header list are an exception, since a peer might still
+	// deliver one after its request timed out and was re-assigned.
 	blockHash := bmsg.block.Hash()
-	if _, exists = state.requestedBlocks[*blockHash]; !exists {
+	node := sm.pendingHeaderNode(blockHash)
+	if _, exists = state.requestedBlocks[*blockHash]; !exists && node == nil {
 		// The regression test intentionally sends some blocks twice
 		// to test duplicate block insertion fails.  Don't disconnect
 		// the peer or ignore the block when we're in regression test
@@ -675,28 +884,11 @@ func (sm *SyncManager) handleBlockMsg(bmsg *blockMsg) {
 		}
 	}
 
-	// When in headers-first mode, if the block matches the hash of the
-	// first header in the list of headers that are being fetched, it's
-	// eligible for less validation since the headers have already been
-	// verified to link together and are valid up to the next checkpoint.
-	// Also, remove the list entry for all blocks except the checkpoint
-	// since it is needed to verify the next round of headers links
-	// properly.
-	isCheckpointBlock := false
-	behaviorFlags := blockchain.BFNone
-	if sm.headersFirstMode {
-		firstNodeEl := sm.headerList.Front()
-		if firstNodeEl != nil {
-			firstNode := firstNodeEl.Value.(*headerNode)
-			if blockHash.IsEqual(firstNode.hash) {
-				behaviorFlags |= blockchain.BFFastAdd
-				if firstNode.hash.IsEqual(sm.nextCheckpoint.Hash) {
-					isCheckpointBlock = true
-				} else {
-					sm.headerList.Remove(firstNodeEl)
-				}
-			}
-		}
+	// The blocks of the header list are processed in order once all
+	// blocks before them have been received.
+	if node != nil {
+		sm.handleHeaderBlock(peer, state, node, bmsg.block)
+		return
 	}
 
 	// Remove block from request maps. Either chain will know about it and
@@ -707,7 +899,7 @@ func (sm *SyncManager) handleBlockMsg(bmsg *blockMsg) {
 
 	// Process the block to include validation, best chain selection, orphan
 	// handling, etc.
-	_, isOrphan, err := sm.chain.ProcessBlock(bmsg.block, behaviorFlags)
+	isOrphan, err := sm.processBlock(bmsg.block, blockchain.BFNone)
 	if err != nil {
 		// When the error is a rule error, it means the block was simply
 		// rejected as opposed to something actually going wrong, so log
@@ -778,6 +970,7 @@ func (sm *SyncManager) handleBlockMsg(bmsg *blockMsg) {
 		if peer == sm.syncPeer {
 			sm.lastProgressTime = time.Now()
 		}
+		sm.updateLastBlockTime(peer, blockHash)
 
 		// When the block is not an orphan, log information about it and
 		// update the chain state.
@@ -804,115 +997,400 @@ func (sm *SyncManager) handleBlockMsg(bmsg *blockMsg) {
 				peer)
 		}
 	}
+}
 
-	// Nothing more to do if we aren't in headers-first mode.
+// pendingHeaderNode returns the node of the header list for the block with the
+// passed hash when the block has not been processed yet, or nil otherwise.
+func (sm *SyncManager) pendingHeaderNode(hash *chainhash.Hash) *headerNode {
 	if !sm.headersFirstMode {
-		return
+		return nil
 	}
+	e, exists := sm.headerIndex[*hash]
+	if !exists || e == sm.headerList.Front() {
+		return nil
+	}
+	return e.Value.(*headerNode)
+}
 
-	// This is headers-first mode, so if the block is not a checkpoint
-	// request more blocks using the header list when the request queue is
-	// getting short.
-	if !isCheckpointBlock {
-		if sm.startHeader != nil &&
-			len(state.requestedBlocks) < minInFlightBlocks {
-			sm.fetchHeaderBlocks()
+// handleHeaderBlock handles a block of the header list received in
+// headers-first mode.  The block is held until all blocks before it have been
+// received, after which the blocks are processed in order and more blocks are
+// requested from the peers with free download slots.
+func (sm *SyncManager) handleHeaderBlock(peer *peerpkg.Peer, state *peerSyncState,
+	node *headerNode, block *btcutil.Block) {
+
+	delete(state.requestedBlocks, *node.hash)
+	if node.block == nil {
+		// The block might have been re-assigned to another peer, whose
+		// request is no longer needed.
+		if node.requestedFrom != peer {
+			sm.cancelBlockRequest(node, false)
 		}
+		delete(sm.requestedBlocks, *node.hash)
+		node.requestedFrom = peer
+		node.block = block
+	}
+
+	sm.processHeaderBlocks()
+	if !sm.headersFirstMode {
 		return
 	}
 
-	// This is headers-first mode and the block is a checkpoint.  When
-	// there is a next checkpoint, get the next round of headers by asking
-	// for headers starting from the block after this one up to the next
-	// checkpoint.
-	prevHeight := sm.nextCheckpoint.Height
-	prevHash := sm.nextCheckpoint.Hash
-	sm.nextCheckpoint = sm.findNextHeaderCheckpoint(prevHeight)
-	if sm.nextCheckpoint != nil {
-		locator := blockchain.BlockLocator([]*chainhash.Hash{prevHash})
-		err := peer.PushGetHeadersMsg(locator, sm.nextCheckpoint.Hash)
-		if err != nil {
-			log.Warnf("Failed to send getheaders message to "+
-				"peer %s: %v", peer.Addr(), err)
+	// Request more headers once the blocks have caught up with them.
+	if sm.syncPeer != nil && !sm.headersRequested && !sm.headersSynced &&
+		sm.headerList.Len() < maxHeaderListLen {
+
+		sm.requestHeaders(sm.syncPeer)
+	}
+
+	sm.fetchBlocks()
+}
+
+// processHeaderBlocks processes the received blocks at the front of the header
+// list in order.  Each processed block becomes the new front of the list.
+// Headers-first mode is left once the blocks of all headers of the sync peer
+// have been processed.
+func (sm *SyncManager) processHeaderBlocks() {
+	for {
+		prevEl := sm.headerList.Front()
+		e := prevEl.Next()
+		if e == nil {
+			break
+		}
+		node := e.Value.(*headerNode)
+		if node.block == nil {
+			break
+		}
+
+		// Blocks up to a checkpoint the headers have been verified
+		// against are eligible for less validation since the headers
+		// have already been verified to link together and are valid up
+		// to the checkpoint.
+		behaviorFlags := blockchain.BFNone
+		if node.height <= sm.fastAddHeight {
+			behaviorFlags |= blockchain.BFFastAdd
+		}
+
+		// A block that is already known, such as one that was processed
+		// as an orphan, doesn't need to be processed again.
+		peer := node.requestedFrom
+		_, err := sm.processBlock(node.block, behaviorFlags)
+		if err != nil && !isDuplicateBlockErr(err) {
+			sm.handleHeaderBlockError(peer, node, err)
 			return
 		}
-		log.Infof("Downloading headers for blocks %d to %d from "+
-			"peer %s", prevHeight+1, sm.nextCheckpoint.Height,
-			sm.syncPeer.Addr())
+
+		if err == nil {
+			sm.updateLastBlockTime(peer, node.hash)
+		}
+
+		sm.headerList.Remove(prevEl)
+		delete(sm.headerIndex, *prevEl.Value.(*headerNode).hash)
+		sm.progressLogger.LogBlockHeight(node.block)
+		node.block = nil
+		node.failedPeers = nil
+		sm.lastProgressTime = time.Now()
+
+		// Clear the rejected transactions.
+		sm.rejectedTxns = make(map[chainhash.Hash]struct{})
+
+		// The peer which delivered the block has at least its height.
+		if peer.LastBlock() < node.height {
+			peer.UpdateLastBlockHeight(node.height)
+		}
+	}
+
+	// Switch to normal mode once all headers of the sync peer have been
+	// downloaded and their blocks processed.  Blocks announced in the
+	// meantime are then requested from the sync peer.
+	if !sm.headersSynced || sm.headerList.Len() > 1 {
 		return
 	}
+	best := sm.chain.BestSnapshot()
+	sm.resetHeaderState(&best.Hash, best.Height)
+	log.Infof("Finished headers-first sync at height %d -- switching to "+
+		"normal mode", best.Height)
+	if sm.syncPeer == nil {
+		return
+	}
+	locator, err := sm.chain.LatestBlockLocator()
+	if err != nil {
+		log.Errorf("Failed to get block locator for the latest "+
+			"block: %v", err)
+		return
+	}
+	sm.syncPeer.PushGetBlocksMsg(locator, &zeroHash)
+}
 
-	// This is headers-first mode, the block is a checkpoint, and there are
-	// no more checkpoints, so switch to normal mode by requesting blocks
-	// from the block after this one up to the end of the chain (zero hash).
-	sm.headersFirstMode = false
-	sm.headerList.Init()
-	log.Infof("Reached the final checkpoint -- switching to normal mode")
-	locator := blockchain.BlockLocator([]*chainhash.Hash{blockHash})
-	err = peer.PushGetBlocksMsg(locator, &zeroHash)
+// handleHeaderBlockError handles the failure to process the block of the passed
+// node of the header list, which was received from the passed peer.
+func (sm *SyncManager) handleHeaderBlockError(peer *peerpkg.Peer, node *headerNode, err error) {
+	// When the error is a rule error, it means the block was simply
+	// rejected as opposed to something actually going wrong, so log it as
+	// such.  Otherwise, something really did go wrong, so log it as an
+	// actual error.
+	if _, ok := err.(blockchain.RuleError); ok {
+		log.Infof("Rejected block %v from %s: %v", node.hash, peer, err)
+	} else {
+		log.Errorf("Failed to process block %v: %v", node.hash, err)
+	}
+	if dbErr, ok := err.(database.Error); ok && dbErr.ErrorCode ==
+		database.ErrCorruption {
+		panic(dbErr)
+	}
+
+	// Convert the error into an appropriate reject message and send it.
+	code, reason := mempool.ErrToRejectErr(err)
+	peer.PushRejectMsg(wire.CmdBlock, code, reason, node.hash, false)
+
+	// A block which doesn't match its header was tampered with by the peer
+	// that sent it, so it is requested from another peer.
+	if isMutatedBlockErr(err) {
+		node.block = nil
+		node.requestedFrom = nil
+		if node.failedPeers == nil {
+			node.failedPeers = make(map[*peerpkg.Peer]struct{})
+		}
+		node.failedPeers[peer] = struct{}{}
+		sm.fetchBlocks()
+		return
+	}
+
+	// Otherwise the chain of headers is invalid, so it is abandoned along
+	// with the sync peer that provided it.
+	best := sm.chain.BestSnapshot()
+	sm.resetHeaderState(&best.Hash, best.Height)
+	if sm.syncPeer != nil {
+		sm.updateSyncPeer(true)
+	}
+}
+
+// isDuplicateBlockErr returns whether the passed error is a rule error for a
+// block which is already known.
+func isDuplicateBlockErr(err error) bool {
+	rErr, ok := err.(blockchain.RuleError)
+	return ok && rErr.ErrorCode == blockchain.ErrDuplicateBlock
+}
+
+// isMutatedBlockErr returns whether the passed error is a rule error for a block
+// whose transactions don't match its header.
+func isMutatedBlockErr(err error) bool {
+	rErr, ok := err.(blockchain.RuleError)
+	if !ok {
+		return false
+	}
+	switch rErr.ErrorCode {
+	case blockchain.ErrBadMerkleRoot, blockchain.ErrUnexpectedWitness,
+		blockchain.ErrWitnessCommitmentMismatch:
+		return true
+	}
+	return false
+}
+
+// cancelBlockRequest removes the pending request for the block of the passed
+// node of the header list, if any, so it can be requested again.  When failed
+// is set, the block is requested from other peers than the one that failed to
+// deliver it first.
+func (sm *SyncManager) cancelBlockRequest(node *headerNode, failed bool) {
+	peer := node.requestedFrom
+	if peer == nil || node.block != nil {
+		return
+	}
+
+	if state, exists := sm.peerStates[peer]; exists {
+		delete(state.requestedBlocks, *node.hash)
+	}
+	delete(sm.requestedBlocks, *node.hash)
+	node.requestedFrom = nil
+
+	if failed {
+		if node.failedPeers == nil {
+			node.failedPeers = make(map[*peerpkg.Peer]struct{})
+		}
+		node.failedPeers[peer] = struct{}{}
+	}
+}
+
+// requestHeaders requests the headers after the last header of the header list,
+// or after the last presynced header, from the passed peer.  The locator also includes the main chain so that the
+// peer can respond with the headers of its chain when it forks from the header
+// list.
+func (sm *SyncManager) requestHeaders(peer *peerpkg.Peer) {
+	tipHash := sm.headerList.Back().Value.(*headerNode).hash
+	if sm.presync != nil {
+		// The peer remembers the hash to filter duplicate requests, so
+		// it must not be modified by the presync.
+		lastHash := sm.presync.lastHash
+		tipHash = &lastHash
+	}
+	locator := blockchain.BlockLocator([]*chainhash.Hash{tipHash})
+	chainLocator, err := sm.chain.LatestBlockLocator()
 	if err != nil {
-		log.Warnf("Failed to send getblocks message to peer %s: %v",
+		log.Errorf("Failed to get block locator for the latest "+
+			"block: %v", err)
+		return
+	}
+	locator = append(locator, chainLocator...)
+	if len(locator) > wire.MaxBlockLocatorsPerMsg {
+		locator = locator[:wire.MaxBlockLocatorsPerMsg]
+	}
+
+	err = peer.PushGetHeadersMsg(locator, &zeroHash)
+	if err != nil {
+		log.Warnf("Failed to send getheaders message to peer %s: %v",
 			peer.Addr(), err)
 		return
 	}
+	sm.headersRequested = true
 }
 
-// fetchHeaderBlocks creates and sends a request to the syncPeer for the next
-// list of blocks to be downloaded based on the current list of headers.
-func (sm *SyncManager) fetchHeaderBlocks() {
-	// Nothing to do if there is no start header.
-	if sm.startHeader == nil {
-		log.Warnf("fetchHeaderBlocks called with no start header")
+// fetchBlocks requests the blocks of the headers in the download window, which
+// starts after the latest processed block of the header list, from the peers
+// with free download slots.  No blocks are downloaded for headers which are
+// not known to be part of a chain with the minimum chain work.  Peers which
+// only serve recent blocks are included, but only used for blocks near their
+// tip.
+func (sm *SyncManager) fetchBlocks() {
+	if !sm.headersHaveMinChainWork() {
 		return
 	}
 
-	// Build up a getdata request for the list of blocks the headers
-	// describe.  The size hint will be limited to wire.MaxInvPerMsg by
-	// the function, so no need to double check it here.
-	gdmsg := wire.NewMsgGetDataSizeHint(uint(sm.headerList.Len()))
-	numRequested := 0
-	for e := sm.startHeader; e != nil; e = e.Next() {
-		node, ok := e.Value.(*headerNode)
-		if !ok {
-			log.Warn("Header list node type is not a headerNode")
+	var peers []*peerpkg.Peer
+	for peer, state := range sm.peerStates {
+		if (state.syncCandidate || state.limited) &&
+			len(state.requestedBlocks) < maxBlocksInFlightPerPeer {
+
+			peers = append(peers, peer)
+		}
+	}
+	if len(peers) == 0 {
+		return
+	}
+
+	requests := make(map[*peerpkg.Peer]*wire.MsgGetData)
+	e := sm.headerList.Front().Next()
+	for i := 0; e != nil && i < blockDownloadWindow; i++ {
+		node := e.Value.(*headerNode)
+		e = e.Next()
+		if node.block != nil || node.requestedFrom != nil {
 			continue
 		}
 
+		peer := sm.downloadPeer(peers, node)
+		if peer == nil {
+			continue
+		}
+		state := sm.peerStates[peer]
+		sm.requestedBlocks[*node.hash] = struct{}{}
+		state.requestedBlocks[*node.hash] = struct{}{}
+		node.requestedFrom = peer
+		node.requestTime = time.Now()
+
+		// If we're fetching from a witness enabled peer post-fork,
+		// then ensure that we receive all the witness data in the
+		// blocks.
 		iv := wire.NewInvVect(wire.InvTypeBlock, node.hash)
-		haveInv, err := sm.haveInventory(iv)
-		if err != nil {
-			log.Warnf("Unexpected failure when checking for "+
-				"existing inventory during header block "+
-				"fetch: %v", err)
+		if peer.IsWitnessEnabled() {
+			iv.Type = wire.InvTypeWitnessBlock
 		}
-		if !haveInv {
-			syncPeerState := sm.peerStates[sm.syncPeer]
+		gdmsg, exists := requests[peer]
+		if !exists {
+			gdmsg = wire.NewMsgGetData()
+			requests[peer] = gdmsg
+		}
+		gdmsg.AddInvVect(iv)
+	}
 
-			sm.requestedBlocks[*node.hash] = struct{}{}
-			syncPeerState.requestedBlocks[*node.hash] = struct{}{}
+	for peer, gdmsg := range requests {
+		peer.QueueMessage(gdmsg, nil)
+	}
+}
 
-			// If we're fetching from a witness enabled peer
-			// post-fork, then ensure that we receive all the
-			// witness data in the blocks.
-			if sm.syncPeer.IsWitnessEnabled() {
-				iv.Type = wire.InvTypeWitnessBlock
-			}
+// downloadPeer returns the peer among the passed ones to request the block of
+// the passed node of the header list from.  It is the peer with the fewest
+// blocks in flight which is known to have the block, preferring peers that
+// didn't fail to deliver it before.  Peers which only serve recent blocks are
+// only considered when the block is within wire.NodeNetworkLimitedBlocks of
+// their tip.  Nil is returned when no peer has a free download slot.
+func (sm *SyncManager) downloadPeer(peers []*peerpkg.Peer, node *headerNode) *peerpkg.Peer {
+	var bestPeer, failedPeer *peerpkg.Peer
+	bestInFlight := maxBlocksInFlightPerPeer
+	failedInFlight := maxBlocksInFlightPerPeer
+	for _, peer := range peers {
+		state := sm.peerStates[peer]
+		inFlight := len(state.requestedBlocks)
+		if inFlight >= maxBlocksInFlightPerPeer {
+			continue
+		}
 
-			gdmsg.AddInvVect(iv)
-			numRequested++
+		if state.limited && peer.LastBlock()-node.height >=
+			wire.NodeNetworkLimitedBlocks {
+
+			continue
 		}
-		sm.startHeader = e.Next()
-		if numRequested >= wire.MaxInvPerMsg {
-			break
+
+		// The sync peer provided the header, so it has the block, while
+		// other peers must have reported a sufficient height.
+		if peer != sm.syncPeer && peer.LastBlock() < node.height {
+			continue
+		}
+
+		if _, failed := node.failedPeers[peer]; failed {
+			if inFlight < failedInFlight {
+				failedPeer, failedInFlight = peer, inFlight
+			}
+			continue
+		}
+		if inFlight < bestInFlight {
+			bestPeer, bestInFlight = peer, inFlight
 		}
 	}
-	if len(gdmsg.InvList) > 0 {
-		sm.syncPeer.QueueMessage(gdmsg, nil)
+
+	if bestPeer != nil {
+		return bestPeer
 	}
+	return failedPeer
+}
+
+// handleBlockRequestTimeouts requests the blocks of the download window whose
+// requests timed out from other peers.  The peer the first block of the window
+// was requested from is disconnected once windowStallTimeout has passed, since
+// it stalls the processing of all blocks after it.
+func (sm *SyncManager) handleBlockRequestTimeouts() {
+	if atomic.LoadInt32(&sm.shutdown) != 0 || !sm.headersFirstMode {
+		return
+	}
+
+	now := time.Now()
+	e := sm.headerList.Front().Next()
+	for i := 0; e != nil && i < blockDownloadWindow; i++ {
+		node := e.Value.(*headerNode)
+		e = e.Next()
+		peer := node.requestedFrom
+		if node.block != nil || peer == nil {
+			continue
+		}
+
+		elapsed := now.Sub(node.requestTime)
+		switch {
+		case i == 0 && elapsed > windowStallTimeout:
+			log.Infof("Peer %s is stalling the download of block "+
+				"%v -- disconnecting", peer.Addr(), node.hash)
+			sm.cancelBlockRequest(node, true)
+			peer.Disconnect()
+
+		case elapsed > blockRequestTimeout:
+			log.Debugf("Request for block %v from peer %s timed "+
+				"out", node.hash, peer.Addr())
+			sm.cancelBlockRequest(node, true)
+		}
+	}
+
+	sm.fetchBlocks()
 }
 
 // handleHeadersMsg handles block header messages from all peers.  Headers are
-// requested when performing a headers-first sync.
+// requested from the sync peer when performing a headers-first sync.
 func (sm *SyncManager) handleHeadersMsg(hmsg *headersMsg) {
 	peer := hmsg.peer
 	_, exists := sm.peerStates[peer]
@@ -931,54 +1409,104 @@ func (sm *SyncManager) handleHeadersMsg(hmsg *headersMsg) {
 		return
 	}
 
-	// Nothing to do for an empty headers message.
+	// Ignore the response to a request of a previous sync peer.
+	if peer != sm.syncPeer {
+		log.Debugf("Ignoring %d headers from %s which is not the "+
+			"sync peer", numHeaders, peer.Addr())
+		return
+	}
+	sm.headersRequested = false
+	sm.lastProgressTime = time.Now()
+
+	// Headers are only stored once they are known to be part of a chain
+	// with the minimum chain work.
+	if sm.presync != nil && !sm.handlePresyncHeaders(peer, msg.Headers) {
+		return
+	}
+
+	// The sync peer has no more headers when it sends an empty headers
+	// message.
 	if numHeaders == 0 {
+		sm.headersSynced = true
+		sm.processHeaderBlocks()
 		return
 	}
 
+	// Find the header the received headers connect to.  This is usually
+	// the last header of the list, however the chain of the peer might
+	// fork from an earlier header or from the main chain, in which case
+	// the headers after the fork point are replaced.
+	prevHash := msg.Headers[0].PrevBlock
+	prevNodeEl, exists := sm.headerIndex[prevHash]
+	if !exists {
+		height, err := sm.chain.BlockHeightByHash(&prevHash)
+		if err != nil {
+			log.Warnf("Received block headers that do not "+
+				"connect to the chain from peer %s -- "+
+				"disconnecting", peer.Addr())
+			peer.Disconnect()
+			return
+		}
+		sm.resetHeaderState(&prevHash, height)
+		sm.headersFirstMode = true
+		prevNodeEl = sm.headerList.Front()
+		if sm.needsPresync() {
+			sm.startPresync()
+			if !sm.handlePresyncHeaders(peer, msg.Headers) {
+				return
+			}
+		}
+	}
+	sm.truncateHeaders(prevNodeEl)
+
 	// Process all of the received headers ensuring each one connects to the
-	// previous and that checkpoints match.
-	receivedCheckpoint := false
-	var finalHash *chainhash.Hash
+	// previous, has valid proof of work, and that checkpoints match.
+	prevNode := prevNodeEl.Value.(*headerNode)
 	for _, blockHeader := range msg.Headers {
 		blockHash := blockHeader.BlockHash()
-		finalHash = &blockHash
 
-		// Ensure there is a previous header to compare against.
-		prevNodeEl := sm.headerList.Back()
-		if prevNodeEl == nil {
-			log.Warnf("Header list does not contain a previous" +
-				"element as expected -- disconnecting peer")
+		// Ensure the header properly connects to the previous one.
+		if !prevNode.hash.IsEqual(&blockHeader.PrevBlock) {
+			log.Warnf("Received block header that does not "+
+				"properly connect to the chain from peer %s "+
+				"-- disconnecting", peer.Addr())
 			peer.Disconnect()
 			return
 		}
 
-		// Ensure the header properly connects to the previous one and
-		// add it to the list of headers.
-		node := headerNode{hash: &blockHash}
-		prevNode := prevNodeEl.Value.(*headerNode)
-		if prevNode.hash.IsEqual(&blockHeader.PrevBlock) {
-			node.height = prevNode.height + 1
-			e := sm.headerList.PushBack(&node)
-			if sm.startHeader == nil {
-				sm.startHeader = e
-			}
-		} else {
-			log.Warnf("Received block header that does not "+
-				"properly connect to the chain from peer %s "+
-				"-- disconnecting", peer.Addr())
+		err := blockchain.CheckHeaderProofOfWork(blockHeader,
+			sm.chainParams.PowLimit)
+		if err != nil {
+			log.Warnf("Received block header %v with invalid proof "+
+				"of work from peer %s: %v -- disconnecting",
+				blockHash, peer.Addr(), err)
+			peer.Disconnect()
+			return
+		}
+
+		// Verify the header matches the presynced header at its height.
+		node := &headerNode{
+			height: prevNode.height + 1,
+			hash:   &blockHash,
+			workSum: new(big.Int).Add(prevNode.workSum,
+				blockchain.CalcWork(blockHeader.Bits)),
+		}
+		if commitment, ok := sm.headerCommitments[node.height]; ok &&
+			commitment != blockHash {
+
+			log.Warnf("Block header at height %d/hash %s from "+
+				"peer %s does not match the presynced header "+
+				"%s -- disconnecting", node.height, node.hash,
+				peer.Addr(), commitment)
 			peer.Disconnect()
 			return
 		}
 
 		// Verify the header at the next checkpoint height matches.
-		if node.height == sm.nextCheckpoint.Height {
-			if node.hash.IsEqual(sm.nextCheckpoint.Hash) {
-				receivedCheckpoint = true
-				log.Infof("Verified downloaded block "+
-					"header against checkpoint at height "+
-					"%d/hash %s", node.height, node.hash)
-			} else {
+		if sm.nextCheckpoint != nil &&
+			node.height == sm.nextCheckpoint.Height {
+
+			if !node.hash.IsEqual(sm.nextCheckpoint.Hash) {
 				log.Warnf("Block header at height %d/hash "+
 					"%s from peer %s does NOT match "+
 					"expected checkpoint hash of %s -- "+
@@ -988,34 +1516,214 @@ func (sm *SyncManager) handleHeadersMsg(hmsg *headersMsg) {
 				peer.Disconnect()
 				return
 			}
-			break
+			log.Infof("Verified downloaded block header against "+
+				"checkpoint at height %d/hash %s", node.height,
+				node.hash)
+			sm.fastAddHeight = node.height
+			sm.nextCheckpoint = sm.findNextHeaderCheckpoint(
+				node.height)
 		}
+
+		sm.headerIndex[blockHash] = sm.headerList.PushBack(node)
+		prevNode = node
 	}
 
-	// When this header is a checkpoint, switch to fetching the blocks for
-	// all of the headers since the last checkpoint.
-	if receivedCheckpoint {
-		// Since the first entry of the list is always the final block
-		// that is already in the database and is only used to ensure
-		// the next header links properly, it must be removed before
-		// fetching the blocks.
-		sm.headerList.Remove(sm.headerList.Front())
-		log.Infof("Received %v block headers: Fetching blocks",
-			sm.headerList.Len())
-		sm.progressLogger.SetLastLogTime(time.Now())
-		sm.fetchHeaderBlocks()
-		return
+	// A headers message which is not full means the sync peer has no more
+	// headers.  Otherwise, request the next batch of headers unless the
+	// blocks have to catch up first.
+	log.Infof("Received %d block headers up to height %d from peer %s: "+
+		"fetching blocks", numHeaders, prevNode.height, peer.Addr())
+	sm.progressLogger.SetLastLogTime(time.Now())
+	if numHeaders < wire.MaxBlockHeadersPerMsg {
+		sm.headersSynced = true
+	} else if sm.headerList.Len() < maxHeaderListLen {
+		sm.requestHeaders(peer)
 	}
 
-	// This header is not a checkpoint, so request the next batch of
-	// headers starting from the latest known header and ending with the
-	// next checkpoint.
-	locator := blockchain.BlockLocator([]*chainhash.Hash{finalHash})
-	err := peer.PushGetHeadersMsg(locator, sm.nextCheckpoint.Hash)
+	sm.fetchBlocks()
+}
+
+// needsPresync returns whether the headers after the front of the header list
+// have to be presynced because the chain up to it has less than the minimum
+// chain work.
+func (sm *SyncManager) needsPresync() bool {
+	if sm.minChainWork == nil {
+		return false
+	}
+	anchor := sm.headerList.Front().Value.(*headerNode)
+	return anchor.workSum.Cmp(sm.minChainWork) < 0
+}
+
+// headersHaveMinChainWork returns whether the headers of the header list are
+// known to be part of a chain with the minimum chain work, either because the
+// work of the headers is sufficient or because they match presynced headers
+// with sufficient work.
+func (sm *SyncManager) headersHaveMinChainWork() bool {
+	if sm.minChainWork == nil || sm.headerCommitments != nil {
+		return true
+	}
+	tip := sm.headerList.Back().Value.(*headerNode)
+	return tip.workSum.Cmp(sm.minChainWork) >= 0
+}
+
+// startPresync starts the presync of the headers after the front of the header
+// list.
+func (sm *SyncManager) startPresync() {
+	anchor := sm.headerList.Front().Value.(*headerNode)
+	anchorTime := sm.chainParams.GenesisBlock.Header.Timestamp
+	header, err := sm.chain.HeaderByHash(anchor.hash)
 	if err != nil {
-		log.Warnf("Failed to send getheaders message to "+
-			"peer %s: %v", peer.Addr(), err)
-		return
+		log.Errorf("Failed to get header of block %v: %v", anchor.hash,
+			err)
+	} else {
+		anchorTime = header.Timestamp
+	}
+
+	// The timestamps of the headers can't be later than the maximum time
+	// offset, which limits how many headers can follow the anchor.
+	maxTime := time.Now().Add(time.Second * blockchain.MaxTimeOffsetSeconds)
+	maxSeconds := int64(maxTime.Sub(anchorTime) / time.Second)
+	if maxSeconds < 0 {
+		maxSeconds = 0
+	}
+
+	sm.presync = &headerPresync{
+		lastHash:    *anchor.hash,
+		lastHeight:  anchor.height,
+		maxHeight:   int64(anchor.height) + maxSeconds*maxPresyncBlocksPerSecond,
+		workSum:     new(big.Int).Set(anchor.workSum),
+		commitments: make(map[int32]chainhash.Hash),
+	}
+}
+
+// handlePresyncHeaders handles the passed headers received from the passed
+// sync peer while presyncing.  It returns true when the headers have to be
+// processed normally, which is the case when they reach the minimum chain work
+// within the first headers message.  Otherwise, the headers are downloaded
+// again once the presync completes.
+func (sm *SyncManager) handlePresyncHeaders(peer *peerpkg.Peer,
+	headers []*wire.BlockHeader) bool {
+
+	// The chain of the peer might fork from the main chain before the
+	// front of the header list, in which case the presync starts from the
+	// fork point.
+	ps := sm.presync
+	firstHeight := ps.lastHeight
+	anchor := sm.headerList.Front().Value.(*headerNode)
+	if len(headers) > 0 && headers[0].PrevBlock != ps.lastHash &&
+		firstHeight == anchor.height {
+
+		prevHash := headers[0].PrevBlock
+		height, err := sm.chain.BlockHeightByHash(&prevHash)
+		if err == nil {
+			sm.resetHeaderState(&prevHash, height)
+			sm.headersFirstMode = true
+			sm.startPresync()
+			ps = sm.presync
+			firstHeight = ps.lastHeight
+		}
+	}
+
+	maxTimestamp := time.Now().Add(time.Second *
+		blockchain.MaxTimeOffsetSeconds)
+	for _, blockHeader := range headers {
+		if blockHeader.PrevBlock != ps.lastHash {
+			log.Warnf("Received block header that does not "+
+				"properly connect to the presynced headers "+
+				"from peer %s -- disconnecting", peer.Addr())
+			peer.Disconnect()
+			return false
+		}
+
+		blockHash := blockHeader.BlockHash()
+		err := blockchain.CheckHeaderProofOfWork(blockHeader,
+			sm.chainParams.PowLimit)
+		if err != nil {
+			log.Warnf("Received block header %v with invalid proof "+
+				"of work from peer %s: %v -- disconnecting",
+				blockHash, peer.Addr(), err)
+			peer.Disconnect()
+			return false
+		}
+		if blockHeader.Timestamp.After(maxTimestamp) {
+			log.Warnf("Received block header %v with a timestamp "+
+				"too far in the future from peer %s -- "+
+				"disconnecting", blockHash, peer.Addr())
+			peer.Disconnect()
+			return false
+		}
+
+		ps.lastHash = blockHash
+		ps.lastHeight++
+		if int64(ps.lastHeight) > ps.maxHeight {
+			log.Warnf("Received more block headers than possible "+
+				"by their timestamps from peer %s -- "+
+				"disconnecting", peer.Addr())
+			peer.Disconnect()
+			return false
+		}
+		ps.workSum.Add(ps.workSum, blockchain.CalcWork(blockHeader.Bits))
+		if ps.lastHeight%presyncCommitmentInterval == 0 {
+			ps.commitments[ps.lastHeight] = blockHash
+		}
+	}
+
+	// Once the presynced headers have sufficient work, they are processed
+	// normally when they are all in this message.  Otherwise, they are
+	// downloaded again from the front of the header list and verified
+	// against the commitments.
+	if ps.workSum.Cmp(sm.minChainWork) >= 0 {
+		log.Infof("Presynced block headers up to height %d from peer "+
+			"%s have the minimum chain work", ps.lastHeight,
+			peer.Addr())
+		sm.presync = nil
+		if firstHeight == anchor.height {
+			return true
+		}
+		sm.headerCommitments = ps.commitments
+		sm.requestHeaders(peer)
+		return false
+	}
+
+	// A headers message which is not full means the sync peer has no more
+	// headers, so it is not synced from as its chain has too little work.
+	if len(headers) < wire.MaxBlockHeadersPerMsg {
+		log.Infof("Block headers up to height %d from peer %s have "+
+			"less than the minimum chain work -- not syncing from "+
+			"it", ps.lastHeight, peer.Addr())
+		if state, exists := sm.peerStates[peer]; exists {
+			state.syncCandidate = false
+		}
+		best := sm.chain.BestSnapshot()
+		sm.resetHeaderState(&best.Hash, best.Height)
+		sm.updateSyncPeer(false)
+		return false
+	}
+
+	log.Infof("Presynced %d block headers up to height %d from peer %s",
+		len(headers), ps.lastHeight, peer.Addr())
+	sm.requestHeaders(peer)
+	return false
+}
+
+// truncateHeaders removes all headers after the passed element of the header
+// list along with their downloaded blocks and pending requests.
+func (sm *SyncManager) truncateHeaders(lastEl *list.Element) {
+	for e := lastEl.Next(); e != nil; {
+		next := e.Next()
+		node := e.Value.(*headerNode)
+		sm.cancelBlockRequest(node, false)
+		delete(sm.headerIndex, *node.hash)
+		sm.headerList.Remove(e)
+		e = next
+	}
+
+	// The checkpoints after the last header need to be verified again.
+	last := lastEl.Value.(*headerNode)
+	sm.headersSynced = false
+	sm.nextCheckpoint = sm.findNextHeaderCheckpoint(last.height)
+	if sm.fastAddHeight > last.height {
+		sm.fastAddHeight = last.height
 	}
 }
 
@@ -1035,6 +1743,12 @@ func (sm *SyncManager) handleNotFoundMsg(nfmsg *notFoundMsg) {
 			fallthrough
 		case wire.InvTypeBlock:
 			if _, exists := state.requestedBlocks[inv.Hash]; exists {
+				// Blocks of the header list are requested
+				// from another peer.
+				node := sm.pendingHeaderNode(&inv.Hash)
+				if node != nil && node.requestedFrom == peer {
+					sm.cancelBlockRequest(node, true)
+				}
 				delete(state.requestedBlocks, inv.Hash)
 				delete(sm.requestedBlocks, inv.Hash)
 			}
@@ -1048,6 +1762,10 @@ func (sm *SyncManager) handleNotFoundMsg(nfmsg *notFoundMsg) {
 			}
 		}
 	}
+
+	if sm.headersFirstMode {
+		sm.fetchBlocks()
+	}
 }
 
 // haveInventory returns whether or not the inventory represented by the passed
@@ -1308,6 +2026,8 @@ func (sm *SyncManager) handleInvMsg(imsg *invMsg) {
 func (sm *SyncManager) blockHandler() {
 	stallTicker := time.NewTicker(stallSampleInterval)
 	defer stallTicker.Stop()
+	requestTicker := time.NewTicker(blockRequestCheckInterval)
+	defer requestTicker.Stop()
 
 out:
 	for {
@@ -1345,8 +2065,8 @@ out:
 				msg.reply <- peerID
 
 			case processBlockMsg:
-				_, isOrphan, err := sm.chain.ProcessBlock(
-					msg.block, msg.flags)
+				isOrphan, err := sm.processBlock(msg.block,
+					msg.flags)
 				if err != nil {
 					msg.reply <- processBlockResponse{
 						isOrphan: false,
@@ -1374,6 +2094,9 @@ out:
 		case <-stallTicker.C:
 			sm.handleStallSample()
 
+		case <-requestTicker.C:
+			sm.handleBlockRequestTimeouts()
+
 		case <-sm.quit:
 			break out
 		}
@@ -1631,18 +2354,15 @@ func New(config *Config) (*SyncManager, error) {
 		headerList:      list.New(),
 		quit:            make(chan struct{}),
 		feeEstimator:    config.FeeEstimator,
+		blockProcessed:  config.BlockProcessed,
+		minChainWork:    config.MinimumChainWork,
 	}
 
-	best := sm.chain.BestSnapshot()
-	if !config.DisableCheckpoints {
-		// Initialize the next checkpoint based on the current height.
-		sm.nextCheckpoint = sm.findNextHeaderCheckpoint(best.Height)
-		if sm.nextCheckpoint != nil {
-			sm.resetHeaderState(&best.Hash, best.Height)
-		}
-	} else {
+	if config.DisableCheckpoints {
 		log.Info("Checkpoints are disabled")
 	}
+	best := sm.chain.BestSnapshot()
+	sm.resetHeaderState(&best.Hash, best.Height)
 
 	sm.chain.Subscribe(sm.handleBlockchainNotification)
 
@@ -0,0 +1,765 @@
+// Copyright (c) 2021 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package netsync
+
+import (
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/btcsuite/btcd/blockchain"
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/database"
+	_ "github.com/btcsuite/btcd/database/ffldb"
+	"github.com/btcsuite/btcd/mempool"
+	peerpkg "github.com/btcsuite/btcd/peer"
+	"github.com/btcsuite/btcd/txscript"
+	"github.com/btcsuite/btcd/wire"
+	"github.com/btcsuite/btcutil"
+)
+
+// mockPeerNotifier is a PeerNotifier which ignores all notifications.
+type mockPeerNotifier struct{}
+
+func (n *mockPeerNotifier) AnnounceNewTransactions(newTxs []*mempool.TxDesc) {}
+
+func (n *mockPeerNotifier) UpdatePeerHeights(latestBlkHash *chainhash.Hash,
+	latestHeight int32, updateSource *peerpkg.Peer) {
+}
+
+func (n *mockPeerNotifier) RelayInventory(invVect *wire.InvVect, data interface{}) {}
+
+func (n *mockPeerNotifier) TransactionConfirmed(tx *btcutil.Tx) {}
+
+// testParams are the chain parameters used by the tests.  The simulation test
+// network allows blocks to be solved quickly while still using headers-first
+// mode, unlike the regression test network.
+var testParams = &chaincfg.SimNetParams
+
+// newTestSyncManager returns a sync manager backed by a new chain in a
+// temporary database, along with a function which removes the database.  The
+// handler of the sync manager is not started, so the tests call its handle
+// methods directly.
+func newTestSyncManager(t *testing.T, config *Config) (*SyncManager, func()) {
+	t.Helper()
+
+	DisableLog()
+	dbPath, err := ioutil.TempDir("", "netsynctest")
+	if err != nil {
+		t.Fatalf("unable to create temp dir: %v", err)
+	}
+	db, err := database.Create("ffldb", filepath.Join(dbPath, "db"),
+		testParams.Net)
+	if err != nil {
+		os.RemoveAll(dbPath)
+		t.Fatalf("unable to create database: %v", err)
+	}
+	teardown := func() {
+		db.Close()
+		os.RemoveAll(dbPath)
+	}
+
+	chain, err := blockchain.New(&blockchain.Config{
+		DB:          db,
+		ChainParams: testParams,
+		TimeSource:  blockchain.NewMedianTime(),
+		SigCache:    txscript.NewSigCache(1000),
+	})
+	if err != nil {
+		teardown()
+		t.Fatalf("unable to create chain: %v", err)
+	}
+
+	config.PeerNotifier = &mockPeerNotifier{}
+	config.Chain = chain
+	config.ChainParams = testParams
+	config.MaxPeers = 8
+	sm, err := New(config)
+	if err != nil {
+		teardown()
+		t.Fatalf("unable to create sync manager: %v", err)
+	}
+	return sm, teardown
+}
+
+// newTestPeer returns a peer with the passed address which reported the passed
+// height.  The peer is never connected, so the messages queued to it are
+// dropped.
+func newTestPeer(t *testing.T, addr string, height int32) *peerpkg.Peer {
+	t.Helper()
+
+	p, err := peerpkg.NewOutboundPeer(&peerpkg.Config{
+		ChainParams: testParams,
+	}, addr)
+	if err != nil {
+		t.Fatalf("unable to create peer: %v", err)
+	}
+	p.UpdateLastBlockHeight(height)
+	return p
+}
+
+// addTestPeer registers the passed peer with the sync manager as a full node
+// when limited is false, or as a peer which only serves recent blocks
+// otherwise.  The services of a peer are only known after its version
+// negotiation, so this mirrors handleNewPeerMsg with the sync state set up
+// directly.
+func addTestPeer(sm *SyncManager, p *peerpkg.Peer, limited bool) {
+	sm.peerStates[p] = &peerSyncState{
+		syncCandidate:   !limited,
+		limited:         limited,
+		requestedTxns:   make(map[chainhash.Hash]struct{}),
+		requestedBlocks: make(map[chainhash.Hash]struct{}),
+	}
+	if !limited && sm.syncPeer == nil {
+		sm.startSync()
+	}
+	if sm.headersFirstMode {
+		sm.fetchBlocks()
+	}
+}
+
+// isDisconnected returns whether the passed peer has been disconnected.
+func isDisconnected(p *peerpkg.Peer) bool {
+	done := make(chan struct{})
+	go func() {
+		p.WaitForDisconnect()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return true
+	case <-time.After(50 * time.Millisecond):
+		return false
+	}
+}
+
+// solveTestHeader updates the nonce of the passed header so that its hash
+// satisfies the proof of work limit of the test network.
+func solveTestHeader(t *testing.T, header *wire.BlockHeader) {
+	t.Helper()
+
+	target := blockchain.CompactToBig(header.Bits)
+	for nonce := uint32(0); ; nonce++ {
+		header.Nonce = nonce
+		hash := header.BlockHash()
+		if blockchain.HashToBig(&hash).Cmp(target) <= 0 {
+			return
+		}
+		if nonce == ^uint32(0) {
+			t.Fatal("unable to solve block header")
+		}
+	}
+}
+
+// makeTestBlocks returns a chain of the passed number of valid blocks after
+// the passed block at the passed height.  The extra nonce is included in the
+// coinbase transactions so that different chains can be built on the same
+// block.
+func makeTestBlocks(t *testing.T, prev *wire.MsgBlock, prevHeight int32,
+	extraNonce int64, numBlocks int) []*btcutil.Block {
+
+	t.Helper()
+
+	blocks := make([]*btcutil.Block, 0, numBlocks)
+	prevHash := prev.BlockHash()
+	timestamp := prev.Header.Timestamp
+	for i := 0; i < numBlocks; i++ {
+		height := prevHeight + int32(i) + 1
+		coinbaseScript, err := txscript.NewScriptBuilder().
+			AddInt64(int64(height)).AddInt64(extraNonce).Script()
+		if err != nil {
+			t.Fatalf("unable to create coinbase script: %v", err)
+		}
+		coinbaseTx := wire.NewMsgTx(wire.TxVersion)
+		coinbaseTx.AddTxIn(&wire.TxIn{
+			PreviousOutPoint: *wire.NewOutPoint(&chainhash.Hash{},
+				wire.MaxPrevOutIndex),
+			SignatureScript: coinbaseScript,
+			Sequence:        wire.MaxTxInSequenceNum,
+		})
+		coinbaseTx.AddTxOut(wire.NewTxOut(0, []byte{txscript.OP_TRUE}))
+
+		timestamp = timestamp.Add(time.Minute)
+		msgBlock := wire.NewMsgBlock(&wire.BlockHeader{
+			Version:    4,
+			PrevBlock:  prevHash,
+			MerkleRoot: coinbaseTx.TxHash(),
+			Timestamp:  timestamp,
+			Bits:       testParams.PowLimitBits,
+		})
+		msgBlock.AddTransaction(coinbaseTx)
+		solveTestHeader(t, &msgBlock.Header)
+
+		block := btcutil.NewBlock(msgBlock)
+		block.SetHeight(height)
+		blocks = append(blocks, block)
+		prevHash = msgBlock.BlockHash()
+	}
+	return blocks
+}
+
+// headersMsgFor returns a headers message from the passed peer with the headers
+// of the passed blocks.
+func headersMsgFor(p *peerpkg.Peer, blocks []*btcutil.Block) *headersMsg {
+	msg := wire.NewMsgHeaders()
+	for _, block := range blocks {
+		msg.AddBlockHeader(&block.MsgBlock().Header)
+	}
+	return &headersMsg{headers: msg, peer: p}
+}
+
+// checkRequestedFrom ensures the block with the passed hash is pending in the
+// header list and requested from the passed peer only.
+func checkRequestedFrom(sm *SyncManager, hash *chainhash.Hash, want *peerpkg.Peer) error {
+	node := sm.pendingHeaderNode(hash)
+	if node == nil {
+		return fmt.Errorf("block %v is not pending", hash)
+	}
+	if node.requestedFrom != want {
+		return fmt.Errorf("block %v requested from %v, want %v", hash,
+			node.requestedFrom, want)
+	}
+	for p, state := range sm.peerStates {
+		_, requested := state.requestedBlocks[*hash]
+		if requested != (p == want) {
+			return fmt.Errorf("block %v requested from %v: %v, "+
+				"want %v", hash, p, requested, p == want)
+		}
+	}
+	return nil
+}
+
+// startTestSync returns a sync manager which downloads the passed number of
+// test blocks in headers-first mode from two peers, the first of which is the
+// sync peer, along with the blocks and a teardown function.
+func startTestSync(t *testing.T, numBlocks int) (*SyncManager, []*btcutil.Block,
+	[2]*peerpkg.Peer, func()) {
+
+	t.Helper()
+
+	sm, teardown := newTestSyncManager(t, &Config{})
+	blocks := makeTestBlocks(t, testParams.GenesisBlock, 0, 0, numBlocks)
+	peers := [2]*peerpkg.Peer{
+		newTestPeer(t, "10.0.0.1:18555", int32(numBlocks)),
+		newTestPeer(t, "10.0.0.2:18555", int32(numBlocks)),
+	}
+	addTestPeer(sm, peers[0], false)
+	addTestPeer(sm, peers[1], false)
+	if sm.syncPeer != peers[0] || !sm.headersFirstMode {
+		teardown()
+		t.Fatalf("not syncing headers-first from the first peer")
+	}
+	sm.handleHeadersMsg(headersMsgFor(peers[0], blocks))
+	return sm, blocks, peers, teardown
+}
+
+// otherPeer returns the test peer which isn't the passed one.
+func otherPeer(peers [2]*peerpkg.Peer, p *peerpkg.Peer) *peerpkg.Peer {
+	if p == peers[0] {
+		return peers[1]
+	}
+	return peers[0]
+}
+
+// TestBlockRequestReassignment ensures the block requests of headers-first mode
+// are re-assigned to another peer when they time out or the peer doesn't have
+// the block, and that the peer stalling the download window is disconnected.
+func TestBlockRequestReassignment(t *testing.T) {
+	sm, blocks, peers, teardown := startTestSync(t, 10)
+	defer teardown()
+
+	// All blocks are requested and spread across both peers.
+	for _, state := range sm.peerStates {
+		if len(state.requestedBlocks) != len(blocks)/2 {
+			t.Fatalf("peer has %d blocks in flight, want %d",
+				len(state.requestedBlocks), len(blocks)/2)
+		}
+	}
+
+	// A timed out request is re-assigned to the other peer.
+	node := sm.pendingHeaderNode(blocks[1].Hash())
+	timedOutPeer := node.requestedFrom
+	node.requestTime = time.Now().Add(-blockRequestTimeout - time.Second)
+	sm.handleBlockRequestTimeouts()
+	err := checkRequestedFrom(sm, blocks[1].Hash(),
+		otherPeer(peers, timedOutPeer))
+	if err != nil {
+		t.Fatalf("timed out request: %v", err)
+	}
+	if _, ok := node.failedPeers[timedOutPeer]; !ok {
+		t.Fatal("timed out peer not recorded as failed")
+	}
+	if isDisconnected(timedOutPeer) {
+		t.Fatal("peer with a timed out request was disconnected")
+	}
+
+	// The block is still accepted from the peer which timed out, and the
+	// request to the other peer is cancelled.
+	sm.handleBlockMsg(&blockMsg{block: blocks[1], peer: timedOutPeer})
+	if node.block == nil || node.requestedFrom != timedOutPeer {
+		t.Fatal("late block was not accepted")
+	}
+	for p, state := range sm.peerStates {
+		if _, ok := state.requestedBlocks[*blocks[1].Hash()]; ok {
+			t.Fatalf("block still requested from %v", p)
+		}
+	}
+
+	// A block the peer doesn't have is requested from the other peer.
+	node = sm.pendingHeaderNode(blocks[2].Hash())
+	notFoundPeer := node.requestedFrom
+	notFound := wire.NewMsgNotFound()
+	notFound.AddInvVect(wire.NewInvVect(wire.InvTypeBlock, blocks[2].Hash()))
+	sm.handleNotFoundMsg(&notFoundMsg{notFound: notFound, peer: notFoundPeer})
+	err = checkRequestedFrom(sm, blocks[2].Hash(),
+		otherPeer(peers, notFoundPeer))
+	if err != nil {
+		t.Fatalf("block not found: %v", err)
+	}
+
+	// The peer which stalls the first block of the window is disconnected.
+	node = sm.pendingHeaderNode(blocks[0].Hash())
+	stallingPeer := node.requestedFrom
+	node.requestTime = time.Now().Add(-windowStallTimeout - time.Second)
+	sm.handleBlockRequestTimeouts()
+	err = checkRequestedFrom(sm, blocks[0].Hash(),
+		otherPeer(peers, stallingPeer))
+	if err != nil {
+		t.Fatalf("stalled request: %v", err)
+	}
+	if !isDisconnected(stallingPeer) {
+		t.Fatal("stalling peer was not disconnected")
+	}
+}
+
+// TestMutatedBlockRetry ensures a block which doesn't match its header is not
+// accepted and requested again from another peer.
+func TestMutatedBlockRetry(t *testing.T) {
+	sm, blocks, peers, teardown := startTestSync(t, 2)
+	defer teardown()
+
+	// Mutate the coinbase transaction of the first block, which keeps the
+	// block hash but invalidates the merkle root.
+	node := sm.pendingHeaderNode(blocks[0].Hash())
+	badPeer := node.requestedFrom
+	mutated := *blocks[0].MsgBlock()
+	coinbaseTx := mutated.Transactions[0].Copy()
+	coinbaseTx.TxOut[0].Value++
+	mutated.Transactions = []*wire.MsgTx{coinbaseTx}
+	sm.handleBlockMsg(&blockMsg{
+		block: btcutil.NewBlock(&mutated),
+		peer:  badPeer,
+	})
+
+	if best := sm.chain.BestSnapshot(); best.Height != 0 {
+		t.Fatalf("mutated block connected at height %d", best.Height)
+	}
+	if _, ok := node.failedPeers[badPeer]; !ok {
+		t.Fatal("peer which sent the mutated block not recorded as " +
+			"failed")
+	}
+	goodPeer := otherPeer(peers, badPeer)
+	if err := checkRequestedFrom(sm, blocks[0].Hash(), goodPeer); err != nil {
+		t.Fatalf("mutated block: %v", err)
+	}
+
+	// The intact block from the other peer is connected.
+	sm.handleBlockMsg(&blockMsg{block: blocks[0], peer: goodPeer})
+	best := sm.chain.BestSnapshot()
+	if best.Height != 1 || best.Hash != *blocks[0].Hash() {
+		t.Fatalf("best block %v at height %d, want %v at height 1",
+			best.Hash, best.Height, blocks[0].Hash())
+	}
+}
+
+// TestHeadersFork ensures the header list is truncated when the sync peer sends
+// headers which fork from it, or from the main chain, and that the requests of
+// the replaced headers are cancelled.
+func TestHeadersFork(t *testing.T) {
+	sm, blocks, peers, teardown := startTestSync(t, 10)
+	defer teardown()
+
+	// Switch to a fork which branches off after the fifth header.
+	fork := makeTestBlocks(t, blocks[4].MsgBlock(), 5, 1, 7)
+	sm.handleHeadersMsg(headersMsgFor(peers[0], fork))
+	if want := 1 + 5 + len(fork); sm.headerList.Len() != want {
+		t.Fatalf("header list has %d headers, want %d",
+			sm.headerList.Len(), want)
+	}
+	for _, block := range blocks[5:] {
+		if _, ok := sm.headerIndex[*block.Hash()]; ok {
+			t.Fatalf("replaced header %v still indexed", block.Hash())
+		}
+		if _, ok := sm.requestedBlocks[*block.Hash()]; ok {
+			t.Fatalf("replaced block %v still requested",
+				block.Hash())
+		}
+		for _, state := range sm.peerStates {
+			if _, ok := state.requestedBlocks[*block.Hash()]; ok {
+				t.Fatalf("replaced block %v still requested "+
+					"from peer", block.Hash())
+			}
+		}
+	}
+	for _, block := range fork {
+		if node := sm.pendingHeaderNode(block.Hash()); node == nil ||
+			node.requestedFrom == nil {
+
+			t.Fatalf("fork block %v not requested", block.Hash())
+		}
+	}
+
+	// Connect the first three blocks, after which the headers of a fork
+	// from the second block replace the whole header list.
+	for _, block := range blocks[:3] {
+		node := sm.pendingHeaderNode(block.Hash())
+		sm.handleBlockMsg(&blockMsg{block: block, peer: node.requestedFrom})
+	}
+	if best := sm.chain.BestSnapshot(); best.Height != 3 {
+		t.Fatalf("best height %d, want 3", best.Height)
+	}
+	fork = makeTestBlocks(t, blocks[1].MsgBlock(), 2, 2, 4)
+	sm.handleHeadersMsg(headersMsgFor(peers[0], fork))
+	front := sm.headerList.Front().Value.(*headerNode)
+	if *front.hash != *blocks[1].Hash() || front.height != 2 {
+		t.Fatalf("header list starts at %v height %d, want %v "+
+			"height 2", front.hash, front.height, blocks[1].Hash())
+	}
+	if want := 1 + len(fork); sm.headerList.Len() != want {
+		t.Fatalf("header list has %d headers, want %d",
+			sm.headerList.Len(), want)
+	}
+	if len(sm.requestedBlocks) != len(fork) {
+		t.Fatalf("%d blocks requested, want %d",
+			len(sm.requestedBlocks), len(fork))
+	}
+}
+
+// TestHeadersFirstToNormalMode ensures headers-first mode is left once all
+// headers of the sync peer have been received and their blocks processed.
+func TestHeadersFirstToNormalMode(t *testing.T) {
+	sm, blocks, peers, teardown := startTestSync(t, 5)
+	defer teardown()
+
+	// The blocks are processed in order, regardless of the order they are
+	// received in.
+	for i := len(blocks) - 1; i >= 0; i-- {
+		if !sm.headersFirstMode {
+			t.Fatalf("left headers-first mode with %d blocks "+
+				"left", i+1)
+		}
+		node := sm.pendingHeaderNode(blocks[i].Hash())
+		sm.handleBlockMsg(&blockMsg{
+			block: blocks[i],
+			peer:  node.requestedFrom,
+		})
+	}
+
+	best := sm.chain.BestSnapshot()
+	if best.Height != int32(len(blocks)) {
+		t.Fatalf("best height %d, want %d", best.Height, len(blocks))
+	}
+	if sm.headersFirstMode {
+		t.Fatal("still in headers-first mode")
+	}
+	if sm.headerList.Len() != 1 || len(sm.requestedBlocks) != 0 {
+		t.Fatalf("header list has %d headers and %d requested blocks "+
+			"after the sync", sm.headerList.Len(),
+			len(sm.requestedBlocks))
+	}
+	if sm.syncPeer != peers[0] {
+		t.Fatal("sync peer changed")
+	}
+
+	// Headers are no longer accepted in normal mode.
+	more := makeTestBlocks(t, blocks[len(blocks)-1].MsgBlock(),
+		best.Height, 0, 1)
+	sm.handleHeadersMsg(headersMsgFor(peers[0], more))
+	if !isDisconnected(peers[0]) {
+		t.Fatal("peer sending unrequested headers not disconnected")
+	}
+}
+
+// TestLastBlockTime ensures the time a peer last sent a new block is only
+// updated for blocks which extend the best chain once it is current, and not
+// for the blocks downloaded during the initial sync.
+func TestLastBlockTime(t *testing.T) {
+	sm, blocks, peers, teardown := startTestSync(t, 5)
+	defer teardown()
+
+	for _, block := range blocks {
+		node := sm.pendingHeaderNode(block.Hash())
+		sm.handleBlockMsg(&blockMsg{
+			block: block,
+			peer:  node.requestedFrom,
+		})
+	}
+	for _, p := range peers {
+		if !p.LastBlockTime().IsZero() {
+			t.Fatalf("last block time of %v updated during the "+
+				"initial sync", p)
+		}
+	}
+
+	// A recent block makes the chain current, so the peer sending it is
+	// credited with it.
+	msgBlock := makeTestBlocks(t, blocks[len(blocks)-1].MsgBlock(),
+		int32(len(blocks)), 0, 1)[0].MsgBlock()
+	msgBlock.Header.Timestamp = time.Unix(time.Now().Unix(), 0)
+	solveTestHeader(t, &msgBlock.Header)
+	block := btcutil.NewBlock(msgBlock)
+	sm.peerStates[peers[1]].requestedBlocks[*block.Hash()] = struct{}{}
+	sm.requestedBlocks[*block.Hash()] = struct{}{}
+	sm.handleBlockMsg(&blockMsg{block: block, peer: peers[1]})
+
+	if best := sm.chain.BestSnapshot(); best.Hash != *block.Hash() {
+		t.Fatalf("best block %v, want %v", best.Hash, block.Hash())
+	}
+	if peers[1].LastBlockTime().IsZero() {
+		t.Fatal("last block time not updated for a new tip")
+	}
+	if !peers[0].LastBlockTime().IsZero() {
+		t.Fatal("last block time updated for another peer")
+	}
+}
+
+// makeTestHeaders returns a chain of the passed number of block headers with
+// the passed timestamp after the block with the passed hash.  Only the proof
+// of work of the headers is valid, which suffices for the presync.
+func makeTestHeaders(t *testing.T, prevHash chainhash.Hash, timestamp time.Time,
+	numHeaders int) []*wire.BlockHeader {
+
+	t.Helper()
+
+	headers := make([]*wire.BlockHeader, 0, numHeaders)
+	for i := 0; i < numHeaders; i++ {
+		header := &wire.BlockHeader{
+			Version:   4,
+			PrevBlock: prevHash,
+			Timestamp: timestamp,
+			Bits:      testParams.PowLimitBits,
+		}
+		solveTestHeader(t, header)
+		headers = append(headers, header)
+		prevHash = header.BlockHash()
+	}
+	return headers
+}
+
+// checkNoHeadersStored ensures the header list of the passed sync manager is
+// empty and no blocks are requested.
+func checkNoHeadersStored(sm *SyncManager) error {
+	if sm.headerList.Len() != 1 {
+		return fmt.Errorf("header list has %d headers, want none",
+			sm.headerList.Len()-1)
+	}
+	if len(sm.requestedBlocks) != 0 {
+		return fmt.Errorf("%d blocks requested, want none",
+			len(sm.requestedBlocks))
+	}
+	for p, state := range sm.peerStates {
+		if len(state.requestedBlocks) != 0 {
+			return fmt.Errorf("%d blocks requested from %v, want "+
+				"none", len(state.requestedBlocks), p)
+		}
+	}
+	return nil
+}
+
+// TestLowWorkHeadersNotDownloaded ensures the blocks of a chain of headers with
+// less than the minimum chain work are never downloaded, and that neither the
+// header list nor the block index of the chain store its headers.
+func TestLowWorkHeadersNotDownloaded(t *testing.T) {
+	genesisWork := blockchain.CalcWork(testParams.PowLimitBits)
+	minChainWork := new(big.Int).Mul(genesisWork, big.NewInt(1000000))
+	sm, teardown := newTestSyncManager(t, &Config{
+		MinimumChainWork: minChainWork,
+	})
+	defer teardown()
+
+	headers := makeTestHeaders(t, testParams.GenesisBlock.BlockHash(),
+		testParams.GenesisBlock.Header.Timestamp,
+		2*wire.MaxBlockHeadersPerMsg+10)
+	peers := [2]*peerpkg.Peer{
+		newTestPeer(t, "10.0.0.1:18555", int32(len(headers))),
+		newTestPeer(t, "10.0.0.2:18555", int32(len(headers))),
+	}
+	addTestPeer(sm, peers[0], false)
+	addTestPeer(sm, peers[1], false)
+	if sm.syncPeer != peers[0] || sm.presync == nil {
+		t.Fatal("not presyncing headers from the first peer")
+	}
+
+	// The headers are presynced without being stored, until the sync peer
+	// runs out of headers before reaching the minimum chain work.
+	for start := 0; start < len(headers); {
+		end := start + wire.MaxBlockHeadersPerMsg
+		if end > len(headers) {
+			end = len(headers)
+		}
+		msg := wire.NewMsgHeaders()
+		for _, header := range headers[start:end] {
+			msg.AddBlockHeader(header)
+		}
+		sm.handleHeadersMsg(&headersMsg{headers: msg, peer: peers[0]})
+		if err := checkNoHeadersStored(sm); err != nil {
+			t.Fatalf("after %d headers: %v", end, err)
+		}
+		start = end
+	}
+	if sm.peerStates[peers[0]].syncCandidate {
+		t.Fatal("peer with a low-work chain is still a sync candidate")
+	}
+	if isDisconnected(peers[0]) {
+		t.Fatal("peer with a valid low-work chain was disconnected")
+	}
+	if sm.syncPeer != peers[1] || sm.presync == nil ||
+		sm.presync.lastHeight != 0 {
+
+		t.Fatal("not presyncing headers from the other peer")
+	}
+	for _, header := range headers {
+		hash := header.BlockHash()
+		if have, _ := sm.chain.HaveBlock(&hash); have {
+			t.Fatalf("low-work block %v known to the chain", hash)
+		}
+		if _, err := sm.chain.BlockHeightByHash(&hash); err == nil {
+			t.Fatalf("low-work header %v in the block index", hash)
+		}
+	}
+}
+
+// TestPresyncMemoryBounded ensures the memory used to presync a chain of
+// low-work headers is bounded, since only commitments to some of the headers
+// are kept, and the sync peer is disconnected once it sends more headers than
+// possible by their timestamps.
+func TestPresyncMemoryBounded(t *testing.T) {
+	genesisWork := blockchain.CalcWork(testParams.PowLimitBits)
+	minChainWork := new(big.Int).Mul(genesisWork, big.NewInt(1000000000))
+	sm, teardown := newTestSyncManager(t, &Config{
+		MinimumChainWork: minChainWork,
+	})
+	defer teardown()
+
+	// Connect a block with the current time, which limits the number of
+	// headers after it to those with a timestamp up to the maximum time
+	// offset in the future.
+	anchor := makeTestBlocks(t, testParams.GenesisBlock, 0, 0, 1)[0].MsgBlock()
+	anchor.Header.Timestamp = time.Unix(time.Now().Unix(), 0)
+	solveTestHeader(t, &anchor.Header)
+	_, _, err := sm.chain.ProcessBlock(btcutil.NewBlock(anchor),
+		blockchain.BFNone)
+	if err != nil {
+		t.Fatalf("unable to process block: %v", err)
+	}
+
+	p := newTestPeer(t, "10.0.0.1:18555", 1000000000)
+	addTestPeer(sm, p, false)
+	ps := sm.presync
+	if ps == nil {
+		t.Fatal("not presyncing headers")
+	}
+	maxHeaders := int64(blockchain.MaxTimeOffsetSeconds+60) *
+		maxPresyncBlocksPerSecond
+	if ps.maxHeight < 1 || ps.maxHeight > 1+maxHeaders {
+		t.Fatalf("presync allows headers up to height %d, want at most "+
+			"%d", ps.maxHeight, 1+maxHeaders)
+	}
+
+	prevHash := anchor.BlockHash()
+	for !isDisconnected(p) {
+		if int64(ps.lastHeight) > ps.maxHeight {
+			t.Fatalf("presynced headers up to height %d, limit %d",
+				ps.lastHeight, ps.maxHeight)
+		}
+		headers := makeTestHeaders(t, prevHash, anchor.Header.Timestamp,
+			wire.MaxBlockHeadersPerMsg)
+		msg := wire.NewMsgHeaders()
+		for _, header := range headers {
+			msg.AddBlockHeader(header)
+		}
+		sm.handleHeadersMsg(&headersMsg{headers: msg, peer: p})
+		prevHash = headers[len(headers)-1].BlockHash()
+
+		if err := checkNoHeadersStored(sm); err != nil {
+			t.Fatalf("at height %d: %v", ps.lastHeight, err)
+		}
+		want := int(ps.lastHeight) / presyncCommitmentInterval
+		if len(ps.commitments) != want {
+			t.Fatalf("%d commitments at height %d, want %d",
+				len(ps.commitments), ps.lastHeight, want)
+		}
+	}
+	if int64(ps.lastHeight) != ps.maxHeight+1 {
+		t.Fatalf("disconnected at height %d, want %d", ps.lastHeight,
+			ps.maxHeight+1)
+	}
+}
+
+// TestDownloadPeerLimited ensures blocks are only downloaded from peers which
+// serve the recent blocks of their chain when the blocks are within
+// wire.NodeNetworkLimitedBlocks of their tip.
+func TestDownloadPeerLimited(t *testing.T) {
+	sm, teardown := newTestSyncManager(t, &Config{})
+	defer teardown()
+
+	const peerHeight = 1000
+	full := newTestPeer(t, "10.0.0.1:18555", peerHeight)
+	limited := newTestPeer(t, "10.0.0.2:18555", peerHeight)
+	addTestPeer(sm, full, false)
+	addTestPeer(sm, limited, true)
+
+	tests := []struct {
+		name   string
+		peer   *peerpkg.Peer
+		height int32
+		want   *peerpkg.Peer
+	}{
+		{
+			name:   "full peer old block",
+			peer:   full,
+			height: peerHeight - wire.NodeNetworkLimitedBlocks,
+			want:   full,
+		},
+		{
+			name:   "limited peer old block",
+			peer:   limited,
+			height: peerHeight - wire.NodeNetworkLimitedBlocks,
+			want:   nil,
+		},
+		{
+			name:   "limited peer oldest recent block",
+			peer:   limited,
+			height: peerHeight - wire.NodeNetworkLimitedBlocks + 1,
+			want:   limited,
+		},
+		{
+			name:   "limited peer tip",
+			peer:   limited,
+			height: peerHeight,
+			want:   limited,
+		},
+		{
+			name:   "limited peer block after tip",
+			peer:   limited,
+			height: peerHeight + 1,
+			want:   nil,
+		},
+	}
+
+	for _, test := range tests {
+		node := &headerNode{height: test.height, hash: &chainhash.Hash{}}
+		got := sm.downloadPeer([]*peerpkg.Peer{test.peer}, node)
+		if got != test.want {
+			t.Errorf("%s: got download peer %v, want %v", test.name,
+				got, test.want)
+		}
+	}
+}
@@ -0,0 +1,22 @@
+// Copyright (c) 2021 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+/*
+This test file is part of the peer package rather than than the peer_test
+package so it can bridge access to the internals to properly test cases which
+are either not possible or can't reliably be tested via the public interface.
+The functions are only exported while the tests are being run.
+*/
+
+package peer
+
+import "time"
+
+// TstSetTrickleAfter replaces the function which returns the channel that
+// signals the next attempt to trickle inventory to the passed peer after the
+// passed random delay, so the tests control when inventory is trickled.  It
+// must be called before the peer is associated with a connection.
+func TstSetTrickleAfter(p *Peer, trickleAfter func(time.Duration) <-chan time.Time) {
+	p.trickleAfter = trickleAfter
+}
@@ -8,11 +8,13 @@ package peer
 import (
 	"bytes"
 	"container/list"
+	"encoding/hex"
 	"errors"
 	"fmt"
 	"io"
 	"math/rand"
 	"net"
+	"sort"
 	"strconv"
 	"sync"
 	"sync/atomic"
@@ -21,6 +23,7 @@ import (
 	"github.com/btcsuite/btcd/blockchain"
 	"github.com/btcsuite/btcd/chaincfg"
 	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/v2transport"
 	"github.com/btcsuite/btcd/wire"
 	"github.com/btcsuite/go-socks/socks"
 	"github.com/davecgh/go-spew/spew"
@@ -31,14 +34,18 @@ const (
 	// MaxProtocolVersion is the max protocol version the peer supports.
 	MaxProtocolVersion = wire.FeeFilterVersion
 
-	// DefaultTrickleInterval is the min time between attempts to send an
-	// inv message to a peer.
+	// DefaultTrickleInterval is the average time between attempts to send
+	// an inv message to an inbound peer.  Outbound peers use 2/5 of it.
 	DefaultTrickleInterval = 10 * time.Second
 
 	// MinAcceptableProtocolVersion is the lowest protocol version that a
 	// connected peer may support.
 	MinAcceptableProtocolVersion = wire.MultipleAddressVersion
 
+	// OtherMsgCommand is the command the bytes of messages that could not be
+	// decoded are accounted to in the per message statistics of a peer.
+	OtherMsgCommand = "*other*"
+
 	// outputBufferSize is the number of elements the output channels use.
 	outputBufferSize = 50
 
@@ -46,6 +53,11 @@ const (
 	// message when trickling inventory to remote peers.
 	maxInvTrickleSize = 1000
 
+	// invTrickleRate is the number of inventory items per second of the
+	// trickle interval that are announced to a peer at once unless a
+	// larger backlog of inventory is queued for it.
+	invTrickleRate = 7
+
 	// maxKnownInventory is the maximum number of items to keep in the known
 	// inventory cache.
 	maxKnownInventory = 1000
@@ -268,10 +280,30 @@ type Config struct {
 	// messages.
 	Listeners MessageListeners
 
-	// TrickleInterval is the duration of the ticker which trickles down the
-	// inventory to a peer.
+	// TrickleInterval is the average time between attempts to trickle down
+	// the inventory to an inbound peer.  Outbound peers use 2/5 of it.
+	// The actual delays are drawn from an exponential distribution for each
+	// peer, so the timing of announcements to different peers is not
+	// correlated.
 	TrickleInterval time.Duration
 
+	// TxFeeRate returns the fee rate in satoshi per kilobyte of the
+	// transaction with the passed hash and whether the transaction is still
+	// known.  It is used to announce trickled transaction inventory with
+	// the highest fee rates first and to drop the inventory of transactions
+	// which have been removed since it was queued.  This can be nil in
+	// which case transaction inventory is announced in the order it was
+	// queued.
+	TxFeeRate func(hash *chainhash.Hash) (int64, bool)
+
+	// V2Transport specifies whether the encrypted v2 transport protocol
+	// (BIP0324) is used for the connection.  Inbound peers fall back to the
+	// v1 transport when the remote peer doesn't use it, while outbound
+	// peers are disconnected when the handshake fails, which is reported
+	// by V2HandshakeFailed so the connection can be retried with the v1
+	// transport.
+	V2Transport bool
+
 	// AllowSelfConns is only used to allow the tests to bypass the self
 	// connection detecting and disconnect logic since they intentionally
 	// do so for testing purposes.
@@ -380,6 +412,18 @@ type StatsSnap struct {
 	LastPingNonce  uint64
 	LastPingTime   time.Time
 	LastPingMicros int64
+
+	// TransportProtocol is the transport protocol of the connection, which
+	// is either "v1" or "v2".  SessionID is the hex encoded session ID of
+	// the v2 transport and empty for the v1 transport.
+	TransportProtocol string
+	SessionID         string
+
+	// BytesSentPerMsg and BytesRecvPerMsg hold the number of bytes sent
+	// and received per message command.  Bytes of messages that could not
+	// be decoded are accounted to the OtherMsgCommand.
+	BytesSentPerMsg map[string]uint64
+	BytesRecvPerMsg map[string]uint64
 }
 
 // HashFunc is a function which returns a block hash, height and error
@@ -431,6 +475,10 @@ type Peer struct {
 
 	conn net.Conn
 
+	// connReader is the reader of the connection, which also returns the
+	// bytes read while detecting a v1 transport inbound peer.
+	connReader io.Reader
+
 	// These fields are set at creation time and never modified, so they are
 	// safe to read from concurrently without a mutex.
 	addr    string
@@ -448,10 +496,13 @@ type Peer struct {
 	sendHeadersPreferred bool   // peer sent a sendheaders message
 	verAckReceived       bool
 	witnessEnabled       bool
+	v2Transport          *v2transport.Transport
+	v2HandshakeFailed    bool
 
 	wireEncoding wire.MessageEncoding
 
 	knownInventory     lru.Cache
+	trickleAfter       func(time.Duration) <-chan time.Time // time.After outside tests
 	prevGetBlocksMtx   sync.Mutex
 	prevGetBlocksBegin *chainhash.Hash
 	prevGetBlocksStop  *chainhash.Hash
@@ -467,10 +518,18 @@ type Peer struct {
 	startingHeight     int32
 	lastBlock          int32
 	lastAnnouncedBlock *chainhash.Hash
+	lastBlockTime      time.Time // Time the peer last sent a new block.
+	lastTxTime         time.Time // Time the peer last sent a new tx.
 	lastPingNonce      uint64    // Set to nonce if we have a pending ping.
 	lastPingTime       time.Time // Time we sent last ping.
 	lastPingMicros     int64     // Time for last ping to return.
 
+	// These fields track the number of bytes sent and received per message
+	// command and are protected by the msgBytesMtx mutex.
+	msgBytesMtx     sync.Mutex
+	bytesSentPerMsg map[string]uint64
+	bytesRecvPerMsg map[string]uint64
+
 	stallControl  chan stallControlMsg
 	outputQueue   chan outMsg
 	sendQueue     chan outMsg
@@ -517,6 +576,26 @@ func (p *Peer) UpdateLastAnnouncedBlock(blkHash *chainhash.Hash) {
 	p.statsMtx.Unlock()
 }
 
+// UpdateLastBlockTime updates the time the peer last sent a block which was new
+// to the local node.
+//
+// This function is safe for concurrent access.
+func (p *Peer) UpdateLastBlockTime(t time.Time) {
+	p.statsMtx.Lock()
+	p.lastBlockTime = t
+	p.statsMtx.Unlock()
+}
+
+// UpdateLastTxTime updates the time the peer last sent a transaction which was
+// new to the local node.
+//
+// This function is safe for concurrent access.
+func (p *Peer) UpdateLastTxTime(t time.Time) {
+	p.statsMtx.Lock()
+	p.lastTxTime = t
+	p.statsMtx.Unlock()
+}
+
 // AddKnownInventory adds the passed inventory to the cache of known inventory
 // for the peer.
 //
@@ -537,6 +616,11 @@ func (p *Peer) StatsSnapshot() *StatsSnap {
 	userAgent := p.userAgent
 	services := p.services
 	protocolVersion := p.advertisedProtoVer
+	transportProtocol, sessionID := "v1", ""
+	if p.v2Transport != nil {
+		id := p.v2Transport.SessionID()
+		transportProtocol, sessionID = "v2", hex.EncodeToString(id[:])
+	}
 	p.flagsMtx.Unlock()
 
 	// Get a copy of all relevant flags and stats.
@@ -558,9 +642,24 @@ func (p *Peer) StatsSnapshot() *StatsSnap {
 		LastPingNonce:  p.lastPingNonce,
 		LastPingMicros: p.lastPingMicros,
 		LastPingTime:   p.lastPingTime,
+
+		TransportProtocol: transportProtocol,
+		SessionID:         sessionID,
 	}
 
 	p.statsMtx.RUnlock()
+
+	p.msgBytesMtx.Lock()
+	statsSnap.BytesSentPerMsg = make(map[string]uint64, len(p.bytesSentPerMsg))
+	for command, n := range p.bytesSentPerMsg {
+		statsSnap.BytesSentPerMsg[command] = n
+	}
+	statsSnap.BytesRecvPerMsg = make(map[string]uint64, len(p.bytesRecvPerMsg))
+	for command, n := range p.bytesRecvPerMsg {
+		statsSnap.BytesRecvPerMsg[command] = n
+	}
+	p.msgBytesMtx.Unlock()
+
 	return statsSnap
 }
 
@@ -668,6 +767,30 @@ func (p *Peer) LastPingMicros() int64 {
 	return lastPingMicros
 }
 
+// LastBlockTime returns the time the peer last sent a block which was new to
+// the local node.
+//
+// This function is safe for concurrent access.
+func (p *Peer) LastBlockTime() time.Time {
+	p.statsMtx.RLock()
+	lastBlockTime := p.lastBlockTime
+	p.statsMtx.RUnlock()
+
+	return lastBlockTime
+}
+
+// LastTxTime returns the time the peer last sent a transaction which was new to
+// the local node.
+//
+// This function is safe for concurrent access.
+func (p *Peer) LastTxTime() time.Time {
+	p.statsMtx.RLock()
+	lastTxTime := p.lastTxTime
+	p.statsMtx.RUnlock()
+
+	return lastTxTime
+}
+
 // VersionKnown returns the whether or not the version of a peer is known
 // locally.
 //
@@ -1009,11 +1132,39 @@ func (p *Peer) handlePongMsg(msg *wire.MsgPong) {
 	}
 }
 
+// addMsgBytes adds the passed number of bytes sent or received for the passed
+// message to the passed per message command counters.  A nil message accounts
+// the bytes to the OtherMsgCommand.
+//
+// This function is safe for concurrent access.
+func (p *Peer) addMsgBytes(perMsg map[string]uint64, msg wire.Message, n int) {
+	if n == 0 {
+		return
+	}
+	command := OtherMsgCommand
+	if msg != nil {
+		command = msg.Command()
+	}
+	p.msgBytesMtx.Lock()
+	perMsg[command] += uint64(n)
+	p.msgBytesMtx.Unlock()
+}
+
 // readMessage reads the next bitcoin message from the peer with logging.
 func (p *Peer) readMessage(encoding wire.MessageEncoding) (wire.Message, []byte, error) {
-	n, msg, buf, err := wire.ReadMessageWithEncodingN(p.conn,
-		p.ProtocolVersion(), p.cfg.ChainParams.Net, encoding)
+	var n int
+	var msg wire.Message
+	var buf []byte
+	var err error
+	if p.v2Transport != nil {
+		n, msg, buf, err = p.v2Transport.ReadMessage(
+			p.ProtocolVersion(), encoding)
+	} else {
+		n, msg, buf, err = wire.ReadMessageWithEncodingN(p.connReader,
+			p.ProtocolVersion(), p.cfg.ChainParams.Net, encoding)
+	}
 	atomic.AddUint64(&p.bytesReceived, uint64(n))
+	p.addMsgBytes(p.bytesRecvPerMsg, msg, n)
 	if p.cfg.Listeners.OnRead != nil {
 		p.cfg.Listeners.OnRead(p, n, msg, err)
 	}
@@ -1074,9 +1225,16 @@ func (p *Peer) writeMessage(msg wire.Message, enc wire.MessageEncoding) error {
 	}))
 
 	// Write the message to the peer.
-	n, err := wire.WriteMessageWithEncodingN(p.conn, msg,
-		p.ProtocolVersion(), p.cfg.ChainParams.Net, enc)
+	var n int
+	var err error
+	if p.v2Transport != nil {
+		n, err = p.v2Transport.WriteMessage(msg, p.ProtocolVersion(), enc)
+	} else {
+		n, err = wire.WriteMessageWithEncodingN(p.conn, msg,
+			p.ProtocolVersion(), p.cfg.ChainParams.Net, enc)
+	}
 	atomic.AddUint64(&p.bytesSent, uint64(n))
+	p.addMsgBytes(p.bytesSentPerMsg, msg, n)
 	if p.cfg.Listeners.OnWrite != nil {
 		p.cfg.Listeners.OnWrite(p, n, msg, err)
 	}
@@ -1545,6 +1703,83 @@ out:
 	log.Tracef("Peer input handler done for %s", p)
 }
 
+// trickleDelay returns a random delay until the next attempt to trickle down
+// the queued inventory to the peer.  The delays are exponentially distributed,
+// so the announcements form a Poisson process which makes it hard for
+// observers connected to several peers to infer the origin of transactions
+// from the timing of the announcements.  Outbound peers, which are chosen by
+// us, have shorter delays than inbound peers, which may be controlled by an
+// observer.
+func (p *Peer) trickleDelay() time.Duration {
+	avg := p.cfg.TrickleInterval
+	if !p.inbound {
+		avg = avg * 2 / 5
+	}
+	return time.Duration(rand.ExpFloat64() * float64(avg))
+}
+
+// nextTrickleInventory removes the transaction inventory to announce next from
+// the passed trickle queue and returns it.  Inventory the peer already knows
+// about and transactions which are no longer known are dropped.  Transactions
+// are announced with the highest fee rates first, and the number of items
+// announced at once is limited to a rate proportional to the trickle interval
+// which grows with the size of the queue.  The items which are not announced
+// are left in the queue.
+func (p *Peer) nextTrickleInventory(invSendQueue *list.List) []*wire.InvVect {
+	// Allow an additional 5 items per announcement for every
+	// maxInvTrickleSize queued items, so the queue can't grow without
+	// bounds.
+	limit := int(invTrickleRate*p.cfg.TrickleInterval.Seconds()) +
+		invSendQueue.Len()/maxInvTrickleSize*5
+	if limit > maxInvTrickleSize {
+		limit = maxInvTrickleSize
+	}
+	if limit < 1 {
+		limit = 1
+	}
+
+	type queuedInv struct {
+		iv      *wire.InvVect
+		feeRate int64
+	}
+	queued := make([]queuedInv, 0, invSendQueue.Len())
+	for e := invSendQueue.Front(); e != nil; e = invSendQueue.Front() {
+		iv := invSendQueue.Remove(e).(*wire.InvVect)
+
+		// Don't send inventory that became known after the initial
+		// check.
+		if p.knownInventory.Contains(iv) {
+			continue
+		}
+
+		qi := queuedInv{iv: iv}
+		if p.cfg.TxFeeRate != nil {
+			feeRate, ok := p.cfg.TxFeeRate(&iv.Hash)
+			if !ok {
+				continue
+			}
+			qi.feeRate = feeRate
+		}
+		queued = append(queued, qi)
+	}
+
+	sort.SliceStable(queued, func(i, j int) bool {
+		return queued[i].feeRate > queued[j].feeRate
+	})
+
+	if limit > len(queued) {
+		limit = len(queued)
+	}
+	invs := make([]*wire.InvVect, 0, limit)
+	for _, qi := range queued[:limit] {
+		invs = append(invs, qi.iv)
+	}
+	for _, qi := range queued[limit:] {
+		invSendQueue.PushBack(qi.iv)
+	}
+	return invs
+}
+
 // queueHandler handles the queuing of outgoing data for the peer. This runs as
 // a muxer for various sources of input so we can ensure that server and peer
 // handlers will not block on us sending a message.  That data is then passed on
@@ -1552,8 +1787,7 @@ out:
 func (p *Peer) queueHandler() {
 	pendingMsgs := list.New()
 	invSendQueue := list.New()
-	trickleTicker := time.NewTicker(p.cfg.TrickleInterval)
-	defer trickleTicker.Stop()
+	trickleTimer := p.trickleAfter(p.trickleDelay())
 
 	// We keep the waiting flag so that we know if we have a message queued
 	// to the outHandler or not.  We could use the presence of a head of
@@ -1599,22 +1833,25 @@ out:
 		case iv := <-p.outputInvChan:
 			// No handshake?  They'll find out soon enough.
 			if p.VersionKnown() {
-				// If this is a new block, then we'll blast it
-				// out immediately, sipping the inv trickle
-				// queue.
-				if iv.Type == wire.InvTypeBlock ||
-					iv.Type == wire.InvTypeWitnessBlock {
+				// Transactions are trickled to the peer, while
+				// any other inventory such as a new block is
+				// blasted out immediately, skipping the inv
+				// trickle queue.
+				if iv.Type == wire.InvTypeTx ||
+					iv.Type == wire.InvTypeWitnessTx {
 
+					invSendQueue.PushBack(iv)
+				} else {
 					invMsg := wire.NewMsgInvSizeHint(1)
 					invMsg.AddInvVect(iv)
 					waiting = queuePacket(outMsg{msg: invMsg},
 						pendingMsgs, waiting)
-				} else {
-					invSendQueue.PushBack(iv)
 				}
 			}
 
-		case <-trickleTicker.C:
+		case <-trickleTimer:
+			trickleTimer = p.trickleAfter(p.trickleDelay())
+
 			// Don't send anything if we're disconnecting or there
 			// is no queued inventory.
 			// version is known if send queue has any entries.
@@ -1623,34 +1860,20 @@ out:
 				continue
 			}
 
-			// Create and send as many inv messages as needed to
-			// drain the inventory send queue.
-			invMsg := wire.NewMsgInvSizeHint(uint(invSendQueue.Len()))
-			for e := invSendQueue.Front(); e != nil; e = invSendQueue.Front() {
-				iv := invSendQueue.Remove(e).(*wire.InvVect)
-
-				// Don't send inventory that became known after
-				// the initial check.
-				if p.knownInventory.Contains(iv) {
-					continue
-				}
-
+			invs := p.nextTrickleInventory(invSendQueue)
+			if len(invs) == 0 {
+				continue
+			}
+			invMsg := wire.NewMsgInvSizeHint(uint(len(invs)))
+			for _, iv := range invs {
 				invMsg.AddInvVect(iv)
-				if len(invMsg.InvList) >= maxInvTrickleSize {
-					waiting = queuePacket(
-						outMsg{msg: invMsg},
-						pendingMsgs, waiting)
-					invMsg = wire.NewMsgInvSizeHint(uint(invSendQueue.Len()))
-				}
 
 				// Add the inventory that is being relayed to
 				// the known inventory for the peer.
 				p.AddKnownInventory(iv)
 			}
-			if len(invMsg.InvList) > 0 {
-				waiting = queuePacket(outMsg{msg: invMsg},
-					pendingMsgs, waiting)
-			}
+			waiting = queuePacket(outMsg{msg: invMsg}, pendingMsgs,
+				waiting)
 
 		case <-p.quit:
 			break out
@@ -1829,9 +2052,10 @@ func (p *Peer) QueueMessageWithEncoding(msg wire.Message, doneChan chan<- struct
 	p.outputQueue <- outMsg{msg: msg, encoding: encoding, doneChan: doneChan}
 }
 
-// QueueInventory adds the passed inventory to the inventory send queue which
-// might not be sent right away, rather it is trickled to the peer in batches.
-// Inventory that the peer is already known to have is ignored.
+// QueueInventory adds the passed inventory to the inventory send queue.
+// Transaction inventory might not be sent right away, rather it is trickled to
+// the peer in batches, while other inventory such as new blocks is sent
+// immediately.  Inventory that the peer is already known to have is ignored.
 //
 // This function is safe for concurrent access.
 func (p *Peer) QueueInventory(invVect *wire.InvVect) {
@@ -2126,12 +2350,62 @@ func (p *Peer) negotiateOutboundProtocol() error {
 	return p.writeMessage(wire.NewMsgVerAck(), wire.LatestEncoding)
 }
 
+// negotiateTransport performs the handshake of the v2 transport when it is
+// enabled.  An inbound peer which uses the v1 transport continues with it, while
+// a failed handshake of an outbound peer is recorded so the connection can be
+// retried with the v1 transport.
+func (p *Peer) negotiateTransport() error {
+	if !p.cfg.V2Transport {
+		return nil
+	}
+
+	transport := v2transport.NewTransport(p.conn, p.cfg.ChainParams.Net,
+		!p.inbound)
+	err := transport.Handshake()
+	if err == v2transport.ErrV1Transport {
+		log.Debugf("Peer %s uses the v1 transport", p)
+		p.connReader = io.MultiReader(
+			bytes.NewReader(transport.ReceivedPrefix()), p.conn)
+		return nil
+	}
+	if err != nil {
+		if !p.inbound {
+			p.flagsMtx.Lock()
+			p.v2HandshakeFailed = true
+			p.flagsMtx.Unlock()
+		}
+		return fmt.Errorf("v2 transport handshake failed: %v", err)
+	}
+
+	p.flagsMtx.Lock()
+	p.v2Transport = transport
+	p.flagsMtx.Unlock()
+	return nil
+}
+
+// V2HandshakeFailed returns whether the handshake of the v2 transport of an
+// outbound peer failed, which happens when the remote peer only supports the
+// v1 transport.
+//
+// This function is safe for concurrent access.
+func (p *Peer) V2HandshakeFailed() bool {
+	p.flagsMtx.Lock()
+	failed := p.v2HandshakeFailed
+	p.flagsMtx.Unlock()
+
+	return failed
+}
+
 // start begins processing input and output messages.
 func (p *Peer) start() error {
 	log.Tracef("Starting peer %s", p)
 
 	negotiateErr := make(chan error, 1)
 	go func() {
+		if err := p.negotiateTransport(); err != nil {
+			negotiateErr <- err
+			return
+		}
 		if p.inbound {
 			negotiateErr <- p.negotiateInboundProtocol()
 		} else {
@@ -2172,6 +2446,7 @@ func (p *Peer) AssociateConnection(conn net.Conn) {
 	}
 
 	p.conn = conn
+	p.connReader = conn
 	p.timeConnected = time.Now()
 
 	if p.inbound {
@@ -2230,6 +2505,7 @@ func newPeerBase(origCfg *Config, inbound bool) *Peer {
 		inbound:         inbound,
 		wireEncoding:    wire.BaseEncoding,
 		knownInventory:  lru.NewCache(maxKnownInventory),
+		trickleAfter:    time.After,
 		stallControl:    make(chan stallControlMsg, 1), // nonblocking sync
 		outputQueue:     make(chan outMsg, outputBufferSize),
 		sendQueue:       make(chan outMsg, 1),   // nonblocking sync
@@ -2239,6 +2515,8 @@ func newPeerBase(origCfg *Config, inbound bool) *Peer {
 		queueQuit:       make(chan struct{}),
 		outQuit:         make(chan struct{}),
 		quit:            make(chan struct{}),
+		bytesSentPerMsg: make(map[string]uint64),
+		bytesRecvPerMsg: make(map[string]uint64),
 		cfg:             cfg, // Copy so caller can't mutate.
 		services:        cfg.Services,
 		protocolVersion: cfg.ProtocolVersion,
@@ -177,6 +177,25 @@ func testPeer(t *testing.T, p *peer.Peer, s peerStats) {
 		return
 	}
 
+	stats := p.StatsSnapshot()
+	var sentPerMsg, recvPerMsg uint64
+	for _, n := range stats.BytesSentPerMsg {
+		sentPerMsg += n
+	}
+	for _, n := range stats.BytesRecvPerMsg {
+		recvPerMsg += n
+	}
+	if sentPerMsg != s.wantBytesSent || stats.BytesSentPerMsg[wire.CmdVerAck] != 24 {
+		t.Errorf("testPeer: wrong BytesSentPerMsg - got %v, want total %v",
+			stats.BytesSentPerMsg, s.wantBytesSent)
+		return
+	}
+	if recvPerMsg != s.wantBytesReceived || stats.BytesRecvPerMsg[wire.CmdVerAck] != 24 {
+		t.Errorf("testPeer: wrong BytesRecvPerMsg - got %v, want total %v",
+			stats.BytesRecvPerMsg, s.wantBytesReceived)
+		return
+	}
+
 	if p.StartingHeight() != s.wantStartingHeight {
 		t.Errorf("testPeer: wrong StartingHeight - got %v, want %v", p.StartingHeight(), s.wantStartingHeight)
 		return
@@ -193,7 +212,7 @@ func testPeer(t *testing.T, p *peer.Peer, s peerStats) {
 		return
 	}
 
-	stats := p.StatsSnapshot()
+	stats = p.StatsSnapshot()
 
 	if p.ID() != stats.ID {
 		t.Errorf("testPeer: wrong ID - got %v, want %v", p.ID(), stats.ID)
@@ -989,3 +1008,231 @@ func TestUpdateLastBlockHeight(t *testing.T) {
 			remotePeerHeight+1)
 	}
 }
+
+// TestTrickleInventory ensures transaction inventory is trickled to a peer
+// with the highest fee rates first, in announcements limited by the trickle
+// interval, that transactions which are no longer known are dropped, and that
+// block inventory is announced immediately.
+func TestTrickleInventory(t *testing.T) {
+	// The fee rates of the transactions to announce, where transactions
+	// without a fee rate are no longer known.
+	feeRates := map[chainhash.Hash]int64{
+		{0x01}: 1000,
+		{0x02}: 5000,
+		{0x03}: 3000,
+		{0x05}: 4000,
+		{0x06}: 2000,
+	}
+
+	verack := make(chan struct{})
+	invs := make(chan *wire.MsgInv, 10)
+	peerCfg := peer.Config{
+		Listeners: peer.MessageListeners{
+			OnVerAck: func(p *peer.Peer, msg *wire.MsgVerAck) {
+				verack <- struct{}{}
+			},
+			OnInv: func(p *peer.Peer, msg *wire.MsgInv) {
+				invs <- msg
+			},
+		},
+		UserAgentName:    "peer",
+		UserAgentVersion: "1.0",
+		ChainParams:      &chaincfg.MainNetParams,
+		Services:         0,
+		AllowSelfConns:   true,
+
+		// Up to 3 items are announced at once.
+		TrickleInterval: 500 * time.Millisecond,
+		TxFeeRate: func(hash *chainhash.Hash) (int64, bool) {
+			feeRate, ok := feeRates[*hash]
+			return feeRate, ok
+		},
+	}
+	inConn, outConn := pipe(
+		&conn{laddr: "10.0.0.1:9108", raddr: "10.0.0.2:9108"},
+		&conn{laddr: "10.0.0.2:9108", raddr: "10.0.0.1:9108"},
+	)
+	outPeer, err := peer.NewOutboundPeer(&peerCfg, inConn.laddr)
+	if err != nil {
+		t.Fatalf("NewOutboundPeer: unexpected err: %v\n", err)
+	}
+
+	// Inventory is only trickled to the outbound peer when the test
+	// signals it, regardless of the random delays.
+	trickle := make(chan time.Time)
+	peer.TstSetTrickleAfter(outPeer, func(time.Duration) <-chan time.Time {
+		return trickle
+	})
+	outPeer.AssociateConnection(outConn)
+	inPeer := peer.NewInboundPeer(&peerCfg)
+	inPeer.AssociateConnection(inConn)
+	defer outPeer.Disconnect()
+	defer inPeer.Disconnect()
+
+	// Wait for the veracks from the initial protocol version negotiation.
+	for i := 0; i < 2; i++ {
+		select {
+		case <-verack:
+		case <-time.After(time.Second):
+			t.Fatal("verack timeout")
+		}
+	}
+
+	// receiveInv returns the next announcement received from the outbound
+	// peer.
+	receiveInv := func() *wire.MsgInv {
+		t.Helper()
+		select {
+		case msg := <-invs:
+			return msg
+		case <-time.After(time.Second):
+			t.Fatal("announcement timeout")
+		}
+		return nil
+	}
+
+	// Block inventory is announced immediately, while the transactions
+	// queued before it wait for the next trickle.
+	for i := byte(1); i <= 6; i++ {
+		hash := chainhash.Hash{i}
+		outPeer.QueueInventory(wire.NewInvVect(wire.InvTypeTx, &hash))
+	}
+	blockHash := chainhash.Hash{0xff}
+	outPeer.QueueInventory(wire.NewInvVect(wire.InvTypeBlock, &blockHash))
+	msg := receiveInv()
+	if len(msg.InvList) != 1 || msg.InvList[0].Hash != blockHash {
+		t.Fatalf("got announcement %v, want block %v", msg.InvList,
+			blockHash)
+	}
+
+	// The transactions are announced by fee rate in announcements of at
+	// most 3 items.
+	wantAnnouncements := [][]chainhash.Hash{
+		{{0x02}, {0x05}, {0x03}},
+		{{0x06}, {0x01}},
+	}
+	for i, want := range wantAnnouncements {
+		trickle <- time.Now()
+		msg := receiveInv()
+		if len(msg.InvList) != len(want) {
+			t.Fatalf("announcement %d has %d items, want %d", i,
+				len(msg.InvList), len(want))
+		}
+		for j, iv := range msg.InvList {
+			if iv.Type != wire.InvTypeTx || iv.Hash != want[j] {
+				t.Fatalf("announcement %d item %d is %v, want "+
+					"transaction %v", i, j, iv, want[j])
+			}
+		}
+	}
+
+	// Nothing is announced once the queue is empty, so the next block is
+	// the next announcement.
+	trickle <- time.Now()
+	blockHash = chainhash.Hash{0xfe}
+	outPeer.QueueInventory(wire.NewInvVect(wire.InvTypeBlock, &blockHash))
+	msg = receiveInv()
+	if len(msg.InvList) != 1 || msg.InvList[0].Hash != blockHash {
+		t.Fatalf("got announcement %v, want block %v", msg.InvList,
+			blockHash)
+	}
+}
+
+// TestV2Transport ensures peers which both use the v2 transport negotiate it,
+// an inbound peer falls back to the v1 transport for an outbound peer which
+// doesn't use it, and an outbound peer reports a failed handshake with an
+// inbound peer which only uses the v1 transport.
+func TestV2Transport(t *testing.T) {
+	tests := []struct {
+		name          string
+		inboundV2     bool
+		outboundV2    bool
+		wantProtocol  string
+		wantConnected bool
+	}{
+		{"both v2", true, true, "v2", true},
+		{"v1 outbound", true, false, "v1", true},
+		{"v1 inbound", false, true, "", false},
+	}
+	for _, test := range tests {
+		verack := make(chan struct{}, 2)
+		inCfg := peer.Config{
+			Listeners: peer.MessageListeners{
+				OnVerAck: func(p *peer.Peer, msg *wire.MsgVerAck) {
+					verack <- struct{}{}
+				},
+			},
+			UserAgentName:    "peer",
+			UserAgentVersion: "1.0",
+			ChainParams:      &chaincfg.MainNetParams,
+			AllowSelfConns:   true,
+			V2Transport:      test.inboundV2,
+		}
+		outCfg := inCfg
+		outCfg.V2Transport = test.outboundV2
+
+		inConn, outConn := pipe(
+			&conn{laddr: "10.0.0.1:8333", raddr: "10.0.0.2:8333"},
+			&conn{laddr: "10.0.0.2:8333", raddr: "10.0.0.1:8333"},
+		)
+		inPeer := peer.NewInboundPeer(&inCfg)
+		inPeer.AssociateConnection(inConn)
+		outPeer, err := peer.NewOutboundPeer(&outCfg, inConn.laddr)
+		if err != nil {
+			t.Fatalf("%s: NewOutboundPeer: unexpected err: %v",
+				test.name, err)
+		}
+		outPeer.AssociateConnection(outConn)
+
+		if !test.wantConnected {
+			// The inbound peer reads the key of the outbound peer
+			// as a v1 message and disconnects.
+			done := make(chan struct{})
+			go func() {
+				outPeer.WaitForDisconnect()
+				close(done)
+			}()
+			select {
+			case <-done:
+			case <-time.After(5 * time.Second):
+				t.Fatalf("%s: peer did not disconnect", test.name)
+			}
+			if !outPeer.V2HandshakeFailed() {
+				t.Fatalf("%s: failed handshake not reported",
+					test.name)
+			}
+			inPeer.Disconnect()
+			continue
+		}
+
+		for i := 0; i < 2; i++ {
+			select {
+			case <-verack:
+			case <-time.After(5 * time.Second):
+				t.Fatalf("%s: verack timeout", test.name)
+			}
+		}
+		inStats, outStats := inPeer.StatsSnapshot(), outPeer.StatsSnapshot()
+		if inStats.TransportProtocol != test.wantProtocol ||
+			outStats.TransportProtocol != test.wantProtocol {
+
+			t.Fatalf("%s: transport protocols %s and %s, want %s",
+				test.name, inStats.TransportProtocol,
+				outStats.TransportProtocol, test.wantProtocol)
+		}
+		if inStats.SessionID != outStats.SessionID {
+			t.Fatalf("%s: session IDs %s and %s differ", test.name,
+				inStats.SessionID, outStats.SessionID)
+		}
+		if (test.wantProtocol == "v2") != (inStats.SessionID != "") {
+			t.Fatalf("%s: unexpected session ID %q", test.name,
+				inStats.SessionID)
+		}
+		if outPeer.V2HandshakeFailed() {
+			t.Fatalf("%s: handshake reported as failed", test.name)
+		}
+
+		inPeer.Disconnect()
+		outPeer.Disconnect()
+	}
+}
@@ -0,0 +1,317 @@
+// Copyright (c) 2021 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"errors"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/btcsuite/btcd/addrmgr"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/mempool"
+	"github.com/btcsuite/btcd/peer"
+	"github.com/btcsuite/btcd/wire"
+	"github.com/btcsuite/btcutil"
+)
+
+const (
+	// privateBroadcastPeers is the number of peers each privately broadcast
+	// transaction is sent to before waiting for it to be relayed back.
+	privateBroadcastPeers = 2
+
+	// privateBroadcastRetryInterval is the time to wait for a privately
+	// broadcast transaction to be relayed back before it is sent to another
+	// peer.
+	privateBroadcastRetryInterval = 5 * time.Minute
+
+	// privateBroadcastCheckInterval is the interval at which the privately
+	// broadcast transactions are checked for connections to make.
+	privateBroadcastCheckInterval = 10 * time.Second
+
+	// privateBroadcastTimeout is the maximum duration of a private
+	// broadcast connection, including the time to connect through Tor.
+	privateBroadcastTimeout = time.Minute
+
+	// maxPrivateBroadcastConns is the maximum number of private broadcast
+	// connections open at the same time.
+	maxPrivateBroadcastConns = 8
+
+	// privateBroadcastAddrTries is the maximum number of addresses which
+	// are tried in order to find a peer to send a transaction to.
+	privateBroadcastAddrTries = 100
+)
+
+// privateTx houses a transaction submitted via RPC which is being broadcast
+// privately, along with any transactions accepted to the mempool because they
+// depend on it, which are announced along with it once it was relayed back.
+type privateTx struct {
+	txns       []*mempool.TxDesc
+	sends      int
+	lastSend   time.Time
+	connecting bool
+}
+
+// privateBroadcaster broadcasts the transactions submitted via RPC without
+// revealing that they originate from this node.  Each transaction is sent to
+// a few random peers through short-lived connections over Tor which carry
+// only that transaction.  The transaction stays in the mempool, but it is not
+// announced, served or included in mempool responses to the regular peers
+// until one of them relays it back, at which point it is announced as usual.
+type privateBroadcaster struct {
+	server *server
+	dial   func(string, string, time.Duration) (net.Conn, error)
+
+	mtx   sync.Mutex
+	txns  map[chainhash.Hash]*privateTx
+	conns int
+
+	wakeup chan struct{}
+}
+
+// newPrivateBroadcaster returns a private broadcaster for the passed server
+// which makes its connections with the passed dial function.
+func newPrivateBroadcaster(s *server, dial func(string, string, time.Duration) (net.Conn, error)) *privateBroadcaster {
+	return &privateBroadcaster{
+		server: s,
+		dial:   dial,
+		txns:   make(map[chainhash.Hash]*privateTx),
+		wakeup: make(chan struct{}, 1),
+	}
+}
+
+// Add broadcasts the passed transactions privately.  The first transaction is
+// the one which was submitted, the others were accepted to the mempool because
+// they depend on it.
+func (b *privateBroadcaster) Add(txns []*mempool.TxDesc) {
+	ptx := &privateTx{txns: txns}
+	b.mtx.Lock()
+	for _, txD := range txns {
+		b.txns[*txD.Tx.Hash()] = ptx
+	}
+	b.mtx.Unlock()
+
+	select {
+	case b.wakeup <- struct{}{}:
+	default:
+	}
+}
+
+// IsPending returns whether the transaction with the passed hash is waiting to
+// be relayed back and must therefore not be revealed to the regular peers.
+func (b *privateBroadcaster) IsPending(hash *chainhash.Hash) bool {
+	b.mtx.Lock()
+	_, ok := b.txns[*hash]
+	b.mtx.Unlock()
+	return ok
+}
+
+// remove stops broadcasting the passed transaction privately.
+//
+// This function MUST be called with the broadcaster lock held.
+func (b *privateBroadcaster) remove(ptx *privateTx) {
+	for _, txD := range ptx.txns {
+		delete(b.txns, *txD.Tx.Hash())
+	}
+}
+
+// TxSeen is invoked when a regular peer announces a transaction.  When it is
+// a privately broadcast transaction, it has reached the network without being
+// linked to this node, so it is announced to the peers as usual.
+func (b *privateBroadcaster) TxSeen(hash *chainhash.Hash) {
+	b.mtx.Lock()
+	ptx, ok := b.txns[*hash]
+	if ok {
+		b.remove(ptx)
+	}
+	b.mtx.Unlock()
+	if !ok {
+		return
+	}
+
+	txD := ptx.txns[0]
+	srvrLog.Infof("Privately broadcast transaction %v was relayed back "+
+		"after %d sends", txD.Tx.Hash(), ptx.sends)
+
+	b.server.relayTransactions(ptx.txns)
+	iv := wire.NewInvVect(wire.InvTypeTx, txD.Tx.Hash())
+	b.server.AddRebroadcastInventory(iv, txD)
+}
+
+// startConnections starts the private broadcast connections for the
+// transactions which have not been sent to enough peers yet or which have not
+// been relayed back for a while.  Transactions which left the mempool, for
+// example because they were mined, are no longer broadcast.
+func (b *privateBroadcaster) startConnections() {
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+
+	for hash, ptx := range b.txns {
+		if !hash.IsEqual(ptx.txns[0].Tx.Hash()) || ptx.connecting {
+			continue
+		}
+		if !b.server.txMemPool.HaveTransaction(&hash) {
+			b.remove(ptx)
+			continue
+		}
+		if ptx.sends >= privateBroadcastPeers &&
+			time.Since(ptx.lastSend) < privateBroadcastRetryInterval {
+
+			continue
+		}
+		if b.conns >= maxPrivateBroadcastConns {
+			return
+		}
+
+		ptx.connecting = true
+		b.conns++
+		b.server.wg.Add(1)
+		go b.broadcast(ptx)
+	}
+}
+
+// broadcast sends the passed transaction to a random peer and records the
+// result.  It must be run as a goroutine.
+func (b *privateBroadcaster) broadcast(ptx *privateTx) {
+	tx := ptx.txns[0].Tx
+	addr, err := b.sendTx(tx)
+
+	b.mtx.Lock()
+	ptx.connecting = false
+	b.conns--
+	if err == nil {
+		ptx.sends++
+		ptx.lastSend = time.Now()
+	}
+	b.mtx.Unlock()
+
+	if err != nil {
+		srvrLog.Debugf("Unable to privately broadcast transaction %v: %v",
+			tx.Hash(), err)
+	} else {
+		srvrLog.Debugf("Privately broadcast transaction %v to %s",
+			tx.Hash(), addr)
+	}
+	b.server.wg.Done()
+}
+
+// randomAddress returns a random address of a peer to privately broadcast a
+// transaction to.
+func (b *privateBroadcaster) randomAddress() (string, error) {
+	for tries := 0; tries < privateBroadcastAddrTries; tries++ {
+		ka := b.server.addrManager.GetAddress()
+		if ka == nil {
+			break
+		}
+		na := ka.NetAddress()
+		if !addrmgr.IsRoutable(na) {
+			continue
+		}
+		return addrmgr.NetAddressKey(na), nil
+	}
+	return "", errors.New("no address to connect to")
+}
+
+// sendTx sends the passed transaction to a random peer through a connection
+// which is only used for it and returns the address of the peer.  The peer
+// is announced the transaction once the version negotiation completes, and
+// the connection is closed once it requested and was sent the transaction.
+func (b *privateBroadcaster) sendTx(tx *btcutil.Tx) (string, error) {
+	addr, err := b.randomAddress()
+	if err != nil {
+		return "", err
+	}
+	conn, err := b.dial("tcp", addr, privateBroadcastTimeout)
+	if err != nil {
+		return addr, err
+	}
+
+	// The connection doesn't advertise any services, block height or
+	// interest in transactions, so it can't be linked to this node.
+	var sendOnce sync.Once
+	sent := make(chan struct{}, 1)
+	peerCfg := &peer.Config{
+		Listeners: peer.MessageListeners{
+			OnVerAck: func(p *peer.Peer, msg *wire.MsgVerAck) {
+				invMsg := wire.NewMsgInvSizeHint(1)
+				iv := wire.NewInvVect(wire.InvTypeTx, tx.Hash())
+				invMsg.AddInvVect(iv)
+				p.QueueMessage(invMsg, nil)
+			},
+			OnGetData: func(p *peer.Peer, msg *wire.MsgGetData) {
+				for _, iv := range msg.InvList {
+					if !iv.Hash.IsEqual(tx.Hash()) {
+						continue
+					}
+					encoding := wire.BaseEncoding
+					if iv.Type == wire.InvTypeWitnessTx {
+						encoding = wire.WitnessEncoding
+					}
+					sendOnce.Do(func() {
+						p.QueueMessageWithEncoding(
+							tx.MsgTx(), sent,
+							encoding)
+					})
+				}
+			},
+		},
+		HostToNetAddress: b.server.addrManager.HostToNetAddress,
+		UserAgentName:    userAgentName,
+		UserAgentVersion: userAgentVersion,
+		ChainParams:      b.server.chainParams,
+		DisableRelayTx:   true,
+		ProtocolVersion:  peer.MaxProtocolVersion,
+	}
+	p, err := peer.NewOutboundPeer(peerCfg, addr)
+	if err != nil {
+		conn.Close()
+		return addr, err
+	}
+	p.AssociateConnection(conn)
+
+	disconnected := make(chan struct{})
+	go func() {
+		p.WaitForDisconnect()
+		close(disconnected)
+	}()
+
+	timeout := time.NewTimer(privateBroadcastTimeout)
+	defer timeout.Stop()
+	select {
+	case <-sent:
+	case <-disconnected:
+		err = errors.New("peer disconnected")
+	case <-timeout.C:
+		err = errors.New("timeout")
+	case <-b.server.quit:
+		err = errors.New("server shutting down")
+	}
+	p.Disconnect()
+	p.WaitForDisconnect()
+	return addr, err
+}
+
+// handler periodically starts the private broadcast connections.  It must be
+// run as a goroutine.
+func (b *privateBroadcaster) handler() {
+	ticker := time.NewTicker(privateBroadcastCheckInterval)
+	defer ticker.Stop()
+
+out:
+	for {
+		select {
+		case <-b.wakeup:
+			b.startConnections()
+
+		case <-ticker.C:
+			b.startConnections()
+
+		case <-b.server.quit:
+			break out
+		}
+	}
+	b.server.wg.Done()
+}
@@ -0,0 +1,293 @@
+// Copyright (c) 2021 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"io/ioutil"
+	"net"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/btcsuite/btcd/addrmgr"
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/peer"
+	"github.com/btcsuite/btcd/wire"
+	"github.com/btcsuite/btclog"
+	"github.com/btcsuite/btcutil"
+)
+
+// pipeConn is a net.Conn created by net.Pipe with TCP addresses, which peers
+// require.
+type pipeConn struct {
+	net.Conn
+	localAddr  net.Addr
+	remoteAddr net.Addr
+}
+
+func (c *pipeConn) LocalAddr() net.Addr  { return c.localAddr }
+func (c *pipeConn) RemoteAddr() net.Addr { return c.remoteAddr }
+
+// TestPrivateBroadcastSendTx ensures a privately broadcast transaction is
+// announced and sent to a peer at a known address through a connection which
+// doesn't advertise any services or interest in transactions.
+func TestPrivateBroadcastSendTx(t *testing.T) {
+	tempDir, err := ioutil.TempDir("", "privatebroadcast")
+	if err != nil {
+		t.Fatalf("unable to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	const remoteAddr = "1.2.3.4:8333"
+	s := &server{
+		addrManager: addrmgr.New(tempDir, nil),
+		chainParams: &chaincfg.MainNetParams,
+		quit:        make(chan struct{}),
+	}
+	na := wire.NewNetAddressIPPort(net.ParseIP("1.2.3.4"), 8333, 0)
+	srcAddr := wire.NewNetAddressIPPort(net.ParseIP("5.6.7.8"), 8333, 0)
+	s.addrManager.AddAddress(na, srcAddr)
+
+	// Serve the connection as the remote peer, which completes the version
+	// negotiation and requests announced transactions.  The remote peer
+	// isn't a peer.Peer, since it would be detected as a self connection.
+	versions := make(chan *wire.MsgVersion, 1)
+	txns := make(chan *wire.MsgTx, 1)
+	serve := func(conn net.Conn) {
+		pver := peer.MaxProtocolVersion
+		btcnet := chaincfg.MainNetParams.Net
+		for {
+			msg, _, err := wire.ReadMessage(conn, pver, btcnet)
+			if err != nil {
+				return
+			}
+			var reply wire.Message
+			switch msg := msg.(type) {
+			case *wire.MsgVersion:
+				versions <- msg
+				me := wire.NewNetAddressIPPort(net.ParseIP("1.2.3.4"),
+					8333, wire.SFNodeNetwork)
+				you := wire.NewNetAddressIPPort(net.IPv4zero, 0, 0)
+				version := wire.NewMsgVersion(me, you, 1, 100)
+				version.Services = wire.SFNodeNetwork
+				err = wire.WriteMessage(conn, version, pver, btcnet)
+				reply = wire.NewMsgVerAck()
+			case *wire.MsgInv:
+				getData := wire.NewMsgGetData()
+				for _, iv := range msg.InvList {
+					getData.AddInvVect(iv)
+				}
+				reply = getData
+			case *wire.MsgTx:
+				txns <- msg
+			}
+			if err == nil && reply != nil {
+				err = wire.WriteMessage(conn, reply, pver, btcnet)
+			}
+			if err != nil {
+				return
+			}
+		}
+	}
+	var dialed string
+	dial := func(network, addr string, timeout time.Duration) (net.Conn, error) {
+		dialed = addr
+		tcpAddr, err := net.ResolveTCPAddr("tcp", addr)
+		if err != nil {
+			return nil, err
+		}
+		torAddr := &net.TCPAddr{IP: net.ParseIP("127.0.0.1"), Port: 9050}
+		local, remote := net.Pipe()
+		go serve(remote)
+		return &pipeConn{local, torAddr, tcpAddr}, nil
+	}
+	b := newPrivateBroadcaster(s, dial)
+
+	msgTx := wire.NewMsgTx(wire.TxVersion)
+	msgTx.AddTxOut(wire.NewTxOut(1000, []byte{0x51}))
+	tx := btcutil.NewTx(msgTx)
+	addr, err := b.sendTx(tx)
+	if err != nil {
+		t.Fatalf("unable to send transaction: %v", err)
+	}
+	if addr != remoteAddr || dialed != remoteAddr {
+		t.Fatalf("sent transaction to %s after dialing %s, want %s",
+			addr, dialed, remoteAddr)
+	}
+
+	select {
+	case msg := <-versions:
+		if msg.Services != 0 || msg.LastBlock != 0 || !msg.DisableRelayTx {
+			t.Fatalf("unexpected version message: services %v, "+
+				"last block %d, disable relay tx %v",
+				msg.Services, msg.LastBlock, msg.DisableRelayTx)
+		}
+	default:
+		t.Fatal("no version message received")
+	}
+
+	select {
+	case msg := <-txns:
+		if msg.TxHash() != *tx.Hash() {
+			t.Fatalf("received transaction %v, want %v",
+				msg.TxHash(), tx.Hash())
+		}
+	case <-time.After(time.Second):
+		t.Fatal("transaction not received")
+	}
+}
+
+// connectTestPeer connects the passed server peer as an inbound peer to a
+// remote peer which completes the version negotiation, and returns the
+// messages the remote peer receives afterwards.
+func connectTestPeer(t *testing.T, sp *serverPeer) <-chan wire.Message {
+	t.Helper()
+
+	params := &chaincfg.SimNetParams
+	sp.Peer = peer.NewInboundPeer(&peer.Config{
+		ChainParams:     params,
+		TrickleInterval: time.Millisecond,
+	})
+	local, remote := net.Pipe()
+	conn := &pipeConn{
+		Conn:       local,
+		localAddr:  &net.TCPAddr{IP: net.ParseIP("127.0.0.1"), Port: 18555},
+		remoteAddr: &net.TCPAddr{IP: net.ParseIP("1.2.3.4"), Port: 18555},
+	}
+
+	msgs := make(chan wire.Message, 16)
+	go func() {
+		pver := peer.MaxProtocolVersion
+		me := wire.NewNetAddressIPPort(net.ParseIP("1.2.3.4"), 18555, 0)
+		you := wire.NewNetAddressIPPort(net.IPv4zero, 0, 0)
+		version := wire.NewMsgVersion(me, you, 1, 0)
+		err := wire.WriteMessage(remote, version, pver, params.Net)
+		for err == nil {
+			var msg wire.Message
+			msg, _, err = wire.ReadMessage(remote, pver, params.Net)
+			if err != nil {
+				break
+			}
+			switch msg.(type) {
+			case *wire.MsgVersion:
+			case *wire.MsgVerAck:
+				err = wire.WriteMessage(remote, wire.NewMsgVerAck(),
+					pver, params.Net)
+			default:
+				msgs <- msg
+			}
+		}
+		remote.Close()
+	}()
+	sp.AssociateConnection(conn)
+
+	for i := 0; !sp.VerAckReceived(); i++ {
+		if i == 100 {
+			t.Fatal("version negotiation did not complete")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	return msgs
+}
+
+// TestPrivateBroadcastWithheld ensures a transaction which is waiting to be
+// relayed back after being broadcast privately is neither served nor included
+// in mempool responses to the regular peers, and that it is relayed as usual
+// once a peer announces it.
+func TestPrivateBroadcastWithheld(t *testing.T) {
+	// The loggers can't be used before the log rotator is initialized,
+	// and banning requires a configuration.
+	srvrLog.SetLevel(btclog.LevelOff)
+	peerLog.SetLevel(btclog.LevelOff)
+	defer func(prevCfg *config) { cfg = prevCfg }(cfg)
+	cfg = &config{DisableBanning: true}
+
+	params := &chaincfg.SimNetParams
+	chain, teardown := newTestChain(t, int(params.CoinbaseMaturity)+2)
+	defer teardown()
+	txPool, txDescs := newTestMemPool(t, chain, 2)
+	public, pending := txDescs[0].Tx.Hash(), txDescs[1].Tx.Hash()
+
+	s := &server{
+		chain:                chain,
+		chainParams:          params,
+		txMemPool:            txPool,
+		services:             wire.SFNodeNetwork | wire.SFNodeBloom,
+		relayInv:             make(chan relayMsg, 2),
+		modifyRebroadcastInv: make(chan interface{}, 2),
+		quit:                 make(chan struct{}),
+	}
+	s.privateBroadcaster = newPrivateBroadcaster(s, nil)
+	s.privateBroadcaster.Add(txDescs[1:])
+
+	sp := newServerPeer(s, false)
+	msgs := connectTestPeer(t, sp)
+	defer sp.Disconnect()
+
+	// mempoolInv returns the transactions announced in response to a
+	// mempool request.
+	mempoolInv := func() map[chainhash.Hash]bool {
+		t.Helper()
+
+		sp.OnMemPool(sp.Peer, wire.NewMsgMemPool())
+		for {
+			select {
+			case msg := <-msgs:
+				inv, ok := msg.(*wire.MsgInv)
+				if !ok {
+					continue
+				}
+				hashes := make(map[chainhash.Hash]bool)
+				for _, iv := range inv.InvList {
+					hashes[iv.Hash] = true
+				}
+				return hashes
+			case <-time.After(time.Second):
+				t.Fatal("no inventory received")
+			}
+		}
+	}
+	// pushTx returns whether the transaction with the passed hash is served
+	// in response to a getdata request.
+	pushTx := func(hash *chainhash.Hash) bool {
+		done := make(chan struct{}, 1)
+		err := s.pushTxMsg(sp, hash, done, nil, wire.WitnessEncoding)
+		<-done
+		return err == nil
+	}
+
+	if inv := mempoolInv(); !inv[*public] || inv[*pending] {
+		t.Fatalf("mempool inventory %v, want only %v", inv, public)
+	}
+	if !pushTx(public) {
+		t.Fatal("public transaction not served")
+	}
+	if pushTx(pending) {
+		t.Fatal("pending transaction served")
+	}
+
+	// Once a peer announces the transaction, it is relayed and revealed
+	// like any other transaction.
+	s.privateBroadcaster.TxSeen(pending)
+	select {
+	case msg := <-s.relayInv:
+		if msg.invVect.Hash != *pending {
+			t.Fatalf("relayed %v, want %v", msg.invVect.Hash, pending)
+		}
+	default:
+		t.Fatal("transaction not relayed")
+	}
+	if s.privateBroadcaster.IsPending(pending) {
+		t.Fatal("transaction still pending")
+	}
+	if inv := mempoolInv(); !inv[*public] || !inv[*pending] {
+		t.Fatalf("mempool inventory %v, want %v and %v", inv, public,
+			pending)
+	}
+	if !pushTx(pending) {
+		t.Fatal("transaction not served after being relayed back")
+	}
+}
@@ -0,0 +1,711 @@
+// Copyright (c) 2021 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/btcsuite/btcd/btcjson"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/txscript"
+	"github.com/btcsuite/btcd/wire"
+	"github.com/btcsuite/btcutil"
+)
+
+const (
+	// restPathPrefix is the path under which the RPC server serves the
+	// REST interface.
+	restPathPrefix = "/rest/"
+
+	// defaultRESTHeadersCount is the number of headers returned by the
+	// headers endpoint when no count is requested.
+	defaultRESTHeadersCount = 5
+
+	// maxRESTHeadersCount is the maximum number of headers returned by
+	// the headers endpoint.
+	maxRESTHeadersCount = 2000
+
+	// maxRESTGetUTXOsOutpoints is the maximum number of outpoints that
+	// may be queried with a single request to the getutxos endpoint.
+	maxRESTGetUTXOsOutpoints = 15
+
+	// restMempoolHeight is the height reported by the getutxos endpoint
+	// for the outputs of transactions in the memory pool.
+	restMempoolHeight = 0x7fffffff
+)
+
+// restFormat identifies the encoding of the response to a REST request.
+type restFormat int
+
+// These constants define the response encodings supported by the REST
+// interface.
+const (
+	restFormatBinary restFormat = iota
+	restFormatHex
+	restFormatJSON
+)
+
+// restFormats maps the extension of a REST request path to the response
+// encoding it selects.
+var restFormats = map[string]restFormat{
+	"bin":  restFormatBinary,
+	"hex":  restFormatHex,
+	"json": restFormatJSON,
+}
+
+// restError is an error returned by a REST handler which is reported to the
+// client with the HTTP status code it carries.
+type restError struct {
+	code    int
+	message string
+}
+
+// Error satisfies the error interface.
+func (e *restError) Error() string {
+	return e.message
+}
+
+// restErrorf returns a REST error with the passed HTTP status code and a
+// message formatted according to the format specifier.
+func restErrorf(code int, format string, args ...interface{}) *restError {
+	return &restError{code: code, message: fmt.Sprintf(format, args...)}
+}
+
+// restFormatError returns the REST error for a request which asks for an
+// encoding that the endpoint does not support.
+func restFormatError(available string) *restError {
+	return restErrorf(http.StatusNotFound, "output format not found "+
+		"(available: %s)", available)
+}
+
+// restRPCError converts an error returned by an RPC handler to the REST error
+// reported to the client.
+func restRPCError(err error) *restError {
+	rpcErr, ok := err.(*btcjson.RPCError)
+	if !ok {
+		return restErrorf(http.StatusInternalServerError, "%v", err)
+	}
+
+	// Note that ErrRPCBlockNotFound and ErrRPCNoTxInfo share the same
+	// code.
+	code := http.StatusInternalServerError
+	switch rpcErr.Code {
+	case btcjson.ErrRPCBlockNotFound:
+		code = http.StatusNotFound
+	case btcjson.ErrRPCDecodeHexString, btcjson.ErrRPCInvalidParameter:
+		code = http.StatusBadRequest
+	}
+	return &restError{code: code, message: rpcErr.Message}
+}
+
+// parseRESTPath splits the path of a REST request, excluding the /rest/
+// prefix, into the name of the endpoint, the parameters following it and the
+// requested response encoding.  For example, block/notxdetails/<hash>.json is
+// split into block, notxdetails/<hash> and the JSON encoding.
+func parseRESTPath(path string) (string, string, restFormat, error) {
+	dot := strings.LastIndexByte(path, '.')
+	if dot == -1 {
+		return "", "", 0, restFormatError("bin, hex, json")
+	}
+	format, ok := restFormats[path[dot+1:]]
+	if !ok {
+		return "", "", 0, restFormatError("bin, hex, json")
+	}
+	endpoint, params := path[:dot], ""
+	if slash := strings.IndexByte(endpoint, '/'); slash != -1 {
+		endpoint, params = endpoint[:slash], endpoint[slash+1:]
+	}
+	return endpoint, params, format, nil
+}
+
+// parseRESTHash decodes a block or transaction hash provided in the path of a
+// REST request.  Unlike chainhash.NewHashFromStr, the hash must not be
+// abbreviated.
+func parseRESTHash(str string) (*chainhash.Hash, error) {
+	if len(str) != chainhash.MaxHashStringSize {
+		return nil, restErrorf(http.StatusBadRequest, "Invalid hash: %s",
+			str)
+	}
+	hash, err := chainhash.NewHashFromStr(str)
+	if err != nil {
+		return nil, restErrorf(http.StatusBadRequest, "Invalid hash: %s",
+			str)
+	}
+	return hash, nil
+}
+
+// restHandler handles a request to a REST endpoint.  The passed params are the
+// path of the request following the name of the endpoint.  Binary and hex
+// responses are returned as a byte slice, which is hex encoded for the hex
+// encoding, or as a string that is written as is.  JSON responses are returned
+// as a value which is marshalled.
+type restHandler func(s *rpcServer, r *http.Request, req *rpcRequest, params string, format restFormat) (interface{}, error)
+
+// restHandlers maps the name of each REST endpoint to its handler.
+var restHandlers = map[string]restHandler{
+	"block":             handleRESTBlock,
+	"blockhashbyheight": handleRESTBlockHashByHeight,
+	"chaininfo":         handleRESTChainInfo,
+	"getutxos":          handleRESTGetUTXOs,
+	"headers":           handleRESTHeaders,
+	"mempool":           handleRESTMempool,
+	"tx":                handleRESTTx,
+}
+
+// handleRESTTx handles requests to /rest/tx/<txid>.<bin|hex|json>.
+//
+// Transactions that are not in the memory pool are only available when the
+// transaction index is enabled.
+func handleRESTTx(s *rpcServer, r *http.Request, req *rpcRequest, params string, format restFormat) (interface{}, error) {
+	hash, err := parseRESTHash(params)
+	if err != nil {
+		return nil, err
+	}
+
+	// A transaction which is waiting to be broadcast privately is not
+	// part of any block yet, so respond exactly as if it was not in the
+	// memory pool either.
+	if s.cfg.ConnMgr.PrivateBroadcastPending(hash) {
+		if s.cfg.TxIndex == nil {
+			return nil, restRPCError(rpcNoTxIndexError())
+		}
+		return nil, restRPCError(rpcNoTxInfoError(hash))
+	}
+
+	var verbose int
+	if format == restFormatJSON {
+		verbose = 1
+	}
+	result, err := handleGetRawTransaction(s, &btcjson.GetRawTransactionCmd{
+		Txid:    params,
+		Verbose: &verbose,
+	}, req)
+	if err != nil {
+		return nil, restRPCError(err)
+	}
+	if format == restFormatBinary {
+		return hex.DecodeString(result.(string))
+	}
+	return result, nil
+}
+
+// handleRESTBlock handles requests to /rest/block/<hash>.<bin|hex|json> and
+// /rest/block/notxdetails/<hash>.<bin|hex|json>.  The JSON encoding only
+// includes the transaction hashes instead of the decoded transactions for the
+// latter.
+func handleRESTBlock(s *rpcServer, r *http.Request, req *rpcRequest, params string, format restFormat) (interface{}, error) {
+	txDetails := true
+	if strings.HasPrefix(params, "notxdetails/") {
+		params = strings.TrimPrefix(params, "notxdetails/")
+		txDetails = false
+	}
+	if _, err := parseRESTHash(params); err != nil {
+		return nil, err
+	}
+
+	var verbosity int
+	if format == restFormatJSON {
+		verbosity = 2
+		if !txDetails {
+			verbosity = 1
+		}
+	}
+	result, err := handleGetBlock(s, &btcjson.GetBlockCmd{
+		Hash:      params,
+		Verbosity: &verbosity,
+	}, req)
+	if err != nil {
+		return nil, restRPCError(err)
+	}
+	if format == restFormatBinary {
+		return hex.DecodeString(result.(string))
+	}
+	return result, nil
+}
+
+// handleRESTHeaders handles requests to
+// /rest/headers/<count>/<hash>.<bin|hex|json> and
+// /rest/headers/<hash>.<bin|hex|json>?count=<count>.  It returns up to count
+// headers of the main chain starting with the header of the given block, which
+// is none when the block is not part of the main chain.
+func handleRESTHeaders(s *rpcServer, r *http.Request, req *rpcRequest, params string, format restFormat) (interface{}, error) {
+	countStr := r.URL.Query().Get("count")
+	if slash := strings.IndexByte(params, '/'); slash != -1 {
+		countStr, params = params[:slash], params[slash+1:]
+	}
+	count := defaultRESTHeadersCount
+	if countStr != "" {
+		var err error
+		count, err = strconv.Atoi(countStr)
+		if err != nil || count < 1 || count > maxRESTHeadersCount {
+			return nil, restErrorf(http.StatusBadRequest, "Header "+
+				"count is invalid or out of acceptable range "+
+				"(1-%d): %s", maxRESTHeadersCount, countStr)
+		}
+	}
+	hash, err := parseRESTHash(params)
+	if err != nil {
+		return nil, err
+	}
+
+	// Collect the hashes of the requested main chain blocks.
+	var hashes []*chainhash.Hash
+	height, err := s.cfg.Chain.BlockHeightByHash(hash)
+	if err == nil {
+		for i := 0; i < count; i++ {
+			hash, err := s.cfg.Chain.BlockHashByHeight(height + int32(i))
+			if err != nil {
+				break
+			}
+			hashes = append(hashes, hash)
+		}
+	}
+
+	if format == restFormatJSON {
+		verbose := true
+		headers := make([]interface{}, 0, len(hashes))
+		for _, hash := range hashes {
+			header, err := handleGetBlockHeader(s,
+				&btcjson.GetBlockHeaderCmd{
+					Hash:    hash.String(),
+					Verbose: &verbose,
+				}, req)
+			if err != nil {
+				return nil, restRPCError(err)
+			}
+			headers = append(headers, header)
+		}
+		return headers, nil
+	}
+
+	var buf bytes.Buffer
+	buf.Grow(len(hashes) * wire.MaxBlockHeaderPayload)
+	for _, hash := range hashes {
+		header, err := s.cfg.Chain.HeaderByHash(hash)
+		if err != nil {
+			return nil, restErrorf(http.StatusNotFound, "Block not "+
+				"found: %s", hash)
+		}
+		if err := header.Serialize(&buf); err != nil {
+			return nil, restErrorf(http.StatusInternalServerError,
+				"Failed to serialize block header: %v", err)
+		}
+	}
+	return buf.Bytes(), nil
+}
+
+// restBlockHashResult models the JSON response of the blockhashbyheight
+// endpoint.
+type restBlockHashResult struct {
+	BlockHash string `json:"blockhash"`
+}
+
+// handleRESTBlockHashByHeight handles requests to
+// /rest/blockhashbyheight/<height>.<bin|hex|json>.  The binary encoding is the
+// hash in internal byte order while the hex and JSON encodings use the usual
+// byte-reversed order.
+func handleRESTBlockHashByHeight(s *rpcServer, r *http.Request, req *rpcRequest, params string, format restFormat) (interface{}, error) {
+	height, err := strconv.ParseInt(params, 10, 32)
+	if err != nil || height < 0 {
+		return nil, restErrorf(http.StatusBadRequest, "Invalid height: %s",
+			params)
+	}
+	hash, err := s.cfg.Chain.BlockHashByHeight(int32(height))
+	if err != nil {
+		return nil, restErrorf(http.StatusNotFound, "Block height out "+
+			"of range")
+	}
+
+	switch format {
+	case restFormatBinary:
+		return hash.CloneBytes(), nil
+	case restFormatHex:
+		return hash.String(), nil
+	default:
+		return &restBlockHashResult{BlockHash: hash.String()}, nil
+	}
+}
+
+// handleRESTChainInfo handles requests to /rest/chaininfo.json.
+func handleRESTChainInfo(s *rpcServer, r *http.Request, req *rpcRequest, params string, format restFormat) (interface{}, error) {
+	if format != restFormatJSON {
+		return nil, restFormatError("json")
+	}
+	if params != "" {
+		return nil, restErrorf(http.StatusNotFound, "Unknown REST "+
+			"endpoint")
+	}
+
+	result, err := handleGetBlockChainInfo(s, nil, req)
+	if err != nil {
+		return nil, restRPCError(err)
+	}
+	return result, nil
+}
+
+// handleRESTMempool handles requests to /rest/mempool/info.json and
+// /rest/mempool/contents.json.
+//
+// Transactions which are waiting to be broadcast privately are left out, so
+// they can't be linked to this node.
+func handleRESTMempool(s *rpcServer, r *http.Request, req *rpcRequest, params string, format restFormat) (interface{}, error) {
+	if format != restFormatJSON {
+		return nil, restFormatError("json")
+	}
+
+	switch params {
+	case "info":
+		result := &btcjson.GetMempoolInfoResult{}
+		for _, txD := range s.cfg.TxMemPool.TxDescs() {
+			if s.cfg.ConnMgr.PrivateBroadcastPending(txD.Tx.Hash()) {
+				continue
+			}
+			result.Size++
+			result.Bytes += int64(txD.Tx.MsgTx().SerializeSize())
+		}
+		return result, nil
+
+	case "contents":
+		result := s.cfg.TxMemPool.RawMempoolVerbose()
+		for txid := range result {
+			hash, err := chainhash.NewHashFromStr(txid)
+			if err != nil {
+				return nil, restErrorf(http.StatusInternalServerError,
+					"Invalid transaction hash: %v", err)
+			}
+			if s.cfg.ConnMgr.PrivateBroadcastPending(hash) {
+				delete(result, txid)
+			}
+		}
+
+		// Remove the dependencies on the transactions which were left
+		// out as well.
+		for _, entry := range result {
+			depends := entry.Depends[:0]
+			for _, txid := range entry.Depends {
+				if _, ok := result[txid]; ok {
+					depends = append(depends, txid)
+				}
+			}
+			entry.Depends = depends
+		}
+		return result, nil
+
+	default:
+		return nil, restErrorf(http.StatusNotFound, "Unknown REST "+
+			"endpoint")
+	}
+}
+
+// parseRESTOutpoints parses the outpoints of a request to the getutxos
+// endpoint, which are separated by slashes and formatted as <txid>-<index>.
+func parseRESTOutpoints(params string) ([]wire.OutPoint, error) {
+	if params == "" {
+		return nil, restErrorf(http.StatusBadRequest, "Error: empty "+
+			"request")
+	}
+	strs := strings.Split(params, "/")
+	if len(strs) > maxRESTGetUTXOsOutpoints {
+		return nil, restErrorf(http.StatusBadRequest, "Error: max "+
+			"outpoints exceeded (max: %d, tried: %d)",
+			maxRESTGetUTXOsOutpoints, len(strs))
+	}
+
+	outpoints := make([]wire.OutPoint, 0, len(strs))
+	for _, str := range strs {
+		dash := strings.LastIndexByte(str, '-')
+		if dash == -1 {
+			return nil, restErrorf(http.StatusBadRequest, "Parse "+
+				"error: %s", str)
+		}
+		hash, err := parseRESTHash(str[:dash])
+		if err != nil {
+			return nil, err
+		}
+		index, err := strconv.ParseUint(str[dash+1:], 10, 32)
+		if err != nil {
+			return nil, restErrorf(http.StatusBadRequest, "Parse "+
+				"error: %s", str)
+		}
+		outpoints = append(outpoints, wire.OutPoint{
+			Hash:  *hash,
+			Index: uint32(index),
+		})
+	}
+	return outpoints, nil
+}
+
+// restUTXO is an unspent output found by the getutxos endpoint.
+type restUTXO struct {
+	height uint32
+	txOut  *wire.TxOut
+}
+
+// restGetUTXOsResult models the JSON response of the getutxos endpoint.
+type restGetUTXOsResult struct {
+	ChainHeight  int32                    `json:"chainHeight"`
+	ChainTipHash string                   `json:"chaintipHash"`
+	Bitmap       string                   `json:"bitmap"`
+	UTXOs        []restGetUTXOsResultUTXO `json:"utxos"`
+}
+
+// restGetUTXOsResultUTXO models an unspent output of the JSON response of the
+// getutxos endpoint.
+type restGetUTXOsResultUTXO struct {
+	Height       uint32                     `json:"height"`
+	Value        float64                    `json:"value"`
+	ScriptPubKey btcjson.ScriptPubKeyResult `json:"scriptPubKey"`
+}
+
+// serializeRESTUTXOs writes the binary encoding of the response of the
+// getutxos endpoint to w.  The encoding is compatible with the one used by
+// Groestlcoin Core: the chain height and tip hash, followed by the bitmap of
+// the outpoints that are unspent and the unspent outputs, each preceded by
+// the height of the block that contains it.
+func serializeRESTUTXOs(w io.Writer, height int32, tip *chainhash.Hash, bitmap []byte, utxos []restUTXO) error {
+	err := binary.Write(w, binary.LittleEndian, height)
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(tip[:]); err != nil {
+		return err
+	}
+	if err := wire.WriteVarBytes(w, 0, bitmap); err != nil {
+		return err
+	}
+	if err := wire.WriteVarInt(w, 0, uint64(len(utxos))); err != nil {
+		return err
+	}
+	for _, utxo := range utxos {
+		// The first field is a transaction version that has been
+		// deprecated by Groestlcoin Core and is always zero.
+		var buf [16]byte
+		binary.LittleEndian.PutUint32(buf[4:8], utxo.height)
+		binary.LittleEndian.PutUint64(buf[8:], uint64(utxo.txOut.Value))
+		if _, err := w.Write(buf[:]); err != nil {
+			return err
+		}
+		err := wire.WriteVarBytes(w, 0, utxo.txOut.PkScript)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// handleRESTGetUTXOs handles requests to
+// /rest/getutxos/<txid>-<n>/<txid>-<n>/.../<txid>-<n>.<bin|hex|json> and
+// /rest/getutxos/checkmempool/<txid>-<n>/.../<txid>-<n>.<bin|hex|json>.
+//
+// When checkmempool is given, outputs spent by transactions in the memory
+// pool are treated as spent and outputs of transactions in the memory pool as
+// unspent.  Transactions which are waiting to be broadcast privately are
+// ignored, so they can't be linked to this node.
+func handleRESTGetUTXOs(s *rpcServer, r *http.Request, req *rpcRequest, params string, format restFormat) (interface{}, error) {
+	checkMempool := false
+	if params == "checkmempool" || strings.HasPrefix(params, "checkmempool/") {
+		params = strings.TrimPrefix(params[len("checkmempool"):], "/")
+		checkMempool = true
+	}
+	outpoints, err := parseRESTOutpoints(params)
+	if err != nil {
+		return nil, err
+	}
+
+	best := s.cfg.Chain.BestSnapshot()
+	bitmap := make([]byte, (len(outpoints)+7)/8)
+	bitmapStr := make([]byte, len(outpoints))
+	utxos := make([]restUTXO, 0, len(outpoints))
+	for i, outpoint := range outpoints {
+		bitmapStr[i] = '0'
+
+		var mempoolTx, spendingTx *btcutil.Tx
+		if checkMempool {
+			mempoolTx, _ = s.cfg.TxMemPool.FetchTransaction(
+				&outpoint.Hash)
+			if mempoolTx != nil && s.cfg.ConnMgr.
+				PrivateBroadcastPending(mempoolTx.Hash()) {
+
+				mempoolTx = nil
+			}
+			spendingTx = s.cfg.TxMemPool.CheckSpend(outpoint)
+			if spendingTx != nil && s.cfg.ConnMgr.
+				PrivateBroadcastPending(spendingTx.Hash()) {
+
+				spendingTx = nil
+			}
+		}
+
+		var utxo *restUTXO
+		switch {
+		case spendingTx != nil:
+		case mempoolTx != nil:
+			txOuts := mempoolTx.MsgTx().TxOut
+			if outpoint.Index < uint32(len(txOuts)) {
+				utxo = &restUTXO{
+					height: restMempoolHeight,
+					txOut:  txOuts[outpoint.Index],
+				}
+			}
+
+		default:
+			entry, err := s.cfg.Chain.FetchUtxoEntry(outpoint)
+			if err != nil {
+				return nil, restErrorf(http.StatusInternalServerError,
+					"Failed to fetch utxo: %v", err)
+			}
+			if entry != nil && !entry.IsSpent() {
+				utxo = &restUTXO{
+					height: uint32(entry.BlockHeight()),
+					txOut: wire.NewTxOut(entry.Amount(),
+						entry.PkScript()),
+				}
+			}
+		}
+		if utxo == nil {
+			continue
+		}
+
+		bitmap[i/8] |= 1 << uint(i%8)
+		bitmapStr[i] = '1'
+		utxos = append(utxos, *utxo)
+	}
+
+	if format != restFormatJSON {
+		var buf bytes.Buffer
+		err := serializeRESTUTXOs(&buf, best.Height, &best.Hash, bitmap,
+			utxos)
+		if err != nil {
+			return nil, restErrorf(http.StatusInternalServerError,
+				"Failed to serialize utxos: %v", err)
+		}
+		return buf.Bytes(), nil
+	}
+
+	result := &restGetUTXOsResult{
+		ChainHeight:  best.Height,
+		ChainTipHash: best.Hash.String(),
+		Bitmap:       string(bitmapStr),
+		UTXOs:        make([]restGetUTXOsResultUTXO, 0, len(utxos)),
+	}
+	for _, utxo := range utxos {
+		// Ignore the errors since an unparsable script simply has no
+		// addresses and is disassembled with [error] inline.
+		pkScript := utxo.txOut.PkScript
+		disbuf, _ := txscript.DisasmString(pkScript)
+		scriptClass, addrs, reqSigs, _ := txscript.ExtractPkScriptAddrs(
+			pkScript, s.cfg.ChainParams)
+		addresses := make([]string, len(addrs))
+		for i, addr := range addrs {
+			addresses[i] = addr.EncodeAddress()
+		}
+
+		result.UTXOs = append(result.UTXOs, restGetUTXOsResultUTXO{
+			Height: utxo.height,
+			Value:  btcutil.Amount(utxo.txOut.Value).ToBTC(),
+			ScriptPubKey: btcjson.ScriptPubKeyResult{
+				Asm:       disbuf,
+				Hex:       hex.EncodeToString(pkScript),
+				ReqSigs:   int32(reqSigs),
+				Type:      scriptClass.String(),
+				Addresses: addresses,
+			},
+		})
+	}
+	return result, nil
+}
+
+// writeRESTError writes the passed error returned by a REST handler to w as a
+// plain text response.
+func writeRESTError(w http.ResponseWriter, err error) {
+	code := http.StatusInternalServerError
+	if restErr, ok := err.(*restError); ok {
+		code = restErr.code
+	}
+	w.Header().Set("Content-Type", "text/plain")
+	w.WriteHeader(code)
+	fmt.Fprintf(w, "%v\r\n", err)
+}
+
+// handleREST serves a request to the unauthenticated, read-only REST
+// interface.
+func (s *rpcServer) handleREST(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		writeRESTError(w, restErrorf(http.StatusMethodNotAllowed,
+			"Method not allowed"))
+		return
+	}
+
+	path := strings.TrimPrefix(r.URL.Path, restPathPrefix)
+	endpoint, params, format, err := parseRESTPath(path)
+	if err != nil {
+		writeRESTError(w, err)
+		return
+	}
+	handler, ok := restHandlers[endpoint]
+	if !ok {
+		writeRESTError(w, restErrorf(http.StatusNotFound, "Unknown "+
+			"REST endpoint"))
+		return
+	}
+
+	// Use the correlation ID provided by the client if it is acceptable and
+	// return it in the response like for JSON-RPC requests.
+	reqID := r.Header.Get(requestIDHeader)
+	if !validRequestID(reqID) {
+		reqID = newRequestID()
+	}
+	w.Header().Set(requestIDHeader, reqID)
+	req := &rpcRequest{
+		log: rpcsLog.withFields(logFieldRequestID, reqID,
+			logFieldMethod, "rest/"+endpoint),
+	}
+	result, err := handler(s, r, req, params, format)
+	if err != nil {
+		writeRESTError(w, err)
+		return
+	}
+
+	var body []byte
+	var contentType string
+	switch format {
+	case restFormatBinary:
+		body, contentType = result.([]byte), "application/octet-stream"
+
+	case restFormatHex:
+		contentType = "text/plain"
+		switch result := result.(type) {
+		case []byte:
+			body = []byte(hex.EncodeToString(result) + "\n")
+		case string:
+			body = []byte(result + "\n")
+		}
+
+	case restFormatJSON:
+		contentType = "application/json"
+		body, err = json.Marshal(result)
+		if err != nil {
+			req.log.Errorf("Failed to marshal REST response: %v",
+				err)
+			writeRESTError(w, err)
+			return
+		}
+		body = append(body, '\n')
+	}
+
+	w.Header().Set("Content-Type", contentType)
+	if _, err := w.Write(body); err != nil {
+		req.log.Errorf("Failed to write REST response: %v", err)
+	}
+}
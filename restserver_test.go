@@ -0,0 +1,245 @@
+// Copyright (c) 2021 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/btcsuite/btcd/btcjson"
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/wire"
+)
+
+// TestParseRESTPath ensures the paths of REST requests are split into the
+// endpoint, its parameters and the response encoding as expected.
+func TestParseRESTPath(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		path     string
+		endpoint string
+		params   string
+		format   restFormat
+		valid    bool
+	}{
+		{"chaininfo.json", "chaininfo", "", restFormatJSON, true},
+		{"mempool/contents.json", "mempool", "contents", restFormatJSON, true},
+		{"block/notxdetails/00ab.hex", "block", "notxdetails/00ab", restFormatHex, true},
+		{"headers/5/00ab.bin", "headers", "5/00ab", restFormatBinary, true},
+		{"getutxos/00ab-0/00cd-1.json", "getutxos", "00ab-0/00cd-1", restFormatJSON, true},
+		{"chaininfo", "", "", 0, false},
+		{"chaininfo.xml", "", "", 0, false},
+		{"tx/00ab.json/", "", "", 0, false},
+	}
+
+	for _, test := range tests {
+		endpoint, params, format, err := parseRESTPath(test.path)
+		if !test.valid {
+			restErr, ok := err.(*restError)
+			if !ok || restErr.code != http.StatusNotFound {
+				t.Errorf("%s: unexpected error: %v", test.path, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", test.path, err)
+			continue
+		}
+		if endpoint != test.endpoint || params != test.params ||
+			format != test.format {
+
+			t.Errorf("%s: got (%q, %q, %d), want (%q, %q, %d)",
+				test.path, endpoint, params, format,
+				test.endpoint, test.params, test.format)
+		}
+	}
+}
+
+// TestParseRESTOutpoints ensures the outpoints of requests to the getutxos
+// endpoint are parsed and validated as expected.
+func TestParseRESTOutpoints(t *testing.T) {
+	t.Parallel()
+
+	txid := "4a5e1e4baab89f3a32518a88c31bc87f618f76673e2cc77ab2127b7afdeda33b"
+	hash, _ := chainhash.NewHashFromStr(txid)
+
+	outpoints, err := parseRESTOutpoints(txid + "-0/" + txid + "-4294967295")
+	if err != nil {
+		t.Fatalf("parseRESTOutpoints: unexpected error: %v", err)
+	}
+	want := []wire.OutPoint{{Hash: *hash, Index: 0}, {Hash: *hash, Index: 4294967295}}
+	if len(outpoints) != len(want) || outpoints[0] != want[0] ||
+		outpoints[1] != want[1] {
+
+		t.Fatalf("parseRESTOutpoints: got %v, want %v", outpoints, want)
+	}
+
+	tooMany := txid + "-0"
+	for i := 0; i < maxRESTGetUTXOsOutpoints; i++ {
+		tooMany += "/" + txid + "-0"
+	}
+	for _, params := range []string{
+		"",
+		txid,
+		txid + "-",
+		txid + "--1",
+		txid + "-4294967296",
+		txid[:63] + "-0",
+		tooMany,
+	} {
+		_, err := parseRESTOutpoints(params)
+		restErr, ok := err.(*restError)
+		if !ok || restErr.code != http.StatusBadRequest {
+			t.Errorf("parseRESTOutpoints(%q): unexpected error: %v",
+				params, err)
+		}
+	}
+}
+
+// TestSerializeRESTUTXOs ensures the binary encoding of the response of the
+// getutxos endpoint matches the one used by Groestlcoin Core.
+func TestSerializeRESTUTXOs(t *testing.T) {
+	t.Parallel()
+
+	tip := chainhash.Hash{0x01, 0x02}
+	utxos := []restUTXO{
+		{height: 100, txOut: wire.NewTxOut(5000000000, []byte{0x51})},
+		{height: restMempoolHeight, txOut: wire.NewTxOut(1, nil)},
+	}
+	var buf bytes.Buffer
+	err := serializeRESTUTXOs(&buf, 200, &tip, []byte{0x05}, utxos)
+	if err != nil {
+		t.Fatalf("serializeRESTUTXOs: unexpected error: %v", err)
+	}
+
+	want := "c8000000" + // chain height
+		hex.EncodeToString(tip[:]) + // chain tip hash
+		"0105" + // bitmap
+		"02" + // number of utxos
+		"00000000" + "64000000" + "00f2052a01000000" + "0151" +
+		"00000000" + "ffffff7f" + "0100000000000000" + "00"
+	if got := hex.EncodeToString(buf.Bytes()); got != want {
+		t.Fatalf("serializeRESTUTXOs: got %s, want %s", got, want)
+	}
+}
+
+// TestHandleRESTErrors ensures invalid REST requests are rejected with the
+// expected HTTP status codes before any chain data is accessed.
+func TestHandleRESTErrors(t *testing.T) {
+	t.Parallel()
+
+	s := &rpcServer{}
+	tests := []struct {
+		method string
+		path   string
+		code   int
+	}{
+		{"POST", "/rest/chaininfo.json", http.StatusMethodNotAllowed},
+		{"GET", "/rest/chaininfo.html", http.StatusNotFound},
+		{"GET", "/rest/unknown.json", http.StatusNotFound},
+		{"GET", "/rest/chaininfo.bin", http.StatusNotFound},
+		{"GET", "/rest/mempool/contents.hex", http.StatusNotFound},
+		{"GET", "/rest/mempool/unknown.json", http.StatusNotFound},
+		{"GET", "/rest/tx/00ab.json", http.StatusBadRequest},
+		{"GET", "/rest/block/notxdetails/xyz.bin", http.StatusBadRequest},
+		{"GET", "/rest/headers/0/00ab.bin", http.StatusBadRequest},
+		{"GET", "/rest/headers/2001/00ab.bin", http.StatusBadRequest},
+		{"GET", "/rest/blockhashbyheight/-1.hex", http.StatusBadRequest},
+		{"GET", "/rest/getutxos/checkmempool.json", http.StatusBadRequest},
+	}
+
+	for _, test := range tests {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(test.method, test.path, nil)
+		s.handleREST(w, r)
+		if w.Code != test.code {
+			t.Errorf("%s %s: got status %d, want %d", test.method,
+				test.path, w.Code, test.code)
+		}
+	}
+}
+
+// TestRESTPrivateBroadcastPending ensures the REST endpoints which read the
+// memory pool treat transactions that are waiting to be broadcast privately as
+// absent.
+func TestRESTPrivateBroadcastPending(t *testing.T) {
+	params := &chaincfg.SimNetParams
+	chain, teardown := newTestChain(t, int(params.CoinbaseMaturity)+2)
+	defer teardown()
+
+	// Add a transaction spending the coinbase of each of the first two
+	// blocks to the memory pool, the latter of which is broadcast
+	// privately.
+	txPool, txDescs := newTestMemPool(t, chain, 2)
+	srv := &server{}
+	srv.privateBroadcaster = newPrivateBroadcaster(srv, nil)
+	srv.privateBroadcaster.Add(txDescs[1:])
+	public, pending := *txDescs[0].Tx.Hash(), *txDescs[1].Tx.Hash()
+	coinbaseHashes := [2]chainhash.Hash{
+		txDescs[0].Tx.MsgTx().TxIn[0].PreviousOutPoint.Hash,
+		txDescs[1].Tx.MsgTx().TxIn[0].PreviousOutPoint.Hash,
+	}
+
+	s := &rpcServer{cfg: rpcserverConfig{
+		ConnMgr:     &rpcConnManager{server: srv},
+		Chain:       chain,
+		ChainParams: params,
+		TxMemPool:   txPool,
+	}}
+	get := func(path string, result interface{}) int {
+		t.Helper()
+
+		w := httptest.NewRecorder()
+		s.handleREST(w, httptest.NewRequest("GET", path, nil))
+		if result != nil && w.Code == http.StatusOK {
+			err := json.Unmarshal(w.Body.Bytes(), result)
+			if err != nil {
+				t.Fatalf("%s: unable to decode response: %v",
+					path, err)
+			}
+		}
+		return w.Code
+	}
+
+	var info btcjson.GetMempoolInfoResult
+	get("/rest/mempool/info.json", &info)
+	if info.Size != 1 {
+		t.Errorf("mempool info: got size %d, want 1", info.Size)
+	}
+
+	var contents map[string]*btcjson.GetRawMempoolVerboseResult
+	get("/rest/mempool/contents.json", &contents)
+	if _, ok := contents[public.String()]; !ok || len(contents) != 1 {
+		t.Errorf("mempool contents: got %v, want only %v", contents,
+			public)
+	}
+
+	if code := get("/rest/tx/"+public.String()+".hex", nil); code != http.StatusOK {
+		t.Errorf("public tx: got status %d, want %d", code,
+			http.StatusOK)
+	}
+	if code := get("/rest/tx/"+pending.String()+".hex", nil); code != http.StatusNotFound {
+		t.Errorf("pending tx: got status %d, want %d", code,
+			http.StatusNotFound)
+	}
+
+	// The output of the pending transaction must be unknown and the
+	// coinbase output it spends unspent, while the public transaction is
+	// taken into account as usual.
+	var utxos restGetUTXOsResult
+	get(fmt.Sprintf("/rest/getutxos/checkmempool/%v-0/%v-0/%v-0/%v-0.json",
+		public, pending, coinbaseHashes[0], coinbaseHashes[1]), &utxos)
+	if utxos.Bitmap != "1001" {
+		t.Errorf("getutxos: got bitmap %q, want %q", utxos.Bitmap,
+			"1001")
+	}
+}
@@ -61,6 +61,15 @@ func (p *rpcPeer) FeeFilter() int64 {
 	return atomic.LoadInt64(&(*serverPeer)(p).feeFilter)
 }
 
+// ConnectionType returns the type of the connection to the peer, which is
+// one of inbound, manual, outbound-full-relay, block-relay-only or feeler.
+//
+// This function is safe for concurrent access and is part of the rpcserverPeer
+// interface implementation.
+func (p *rpcPeer) ConnectionType() string {
+	return (*serverPeer)(p).connectionType()
+}
+
 // rpcConnManager provides a connection manager for use with the RPC server and
 // implements the rpcserverConnManager interface.
 type rpcConnManager struct {
@@ -223,6 +232,31 @@ func (cm *rpcConnManager) RelayTransactions(txns []*mempool.TxDesc) {
 	cm.server.relayTransactions(txns)
 }
 
+// PrivateBroadcast broadcasts the passed transactions through short-lived Tor
+// connections and announces them to all connected peers once they are relayed
+// back.  It returns false without doing anything when private broadcast is
+// disabled.
+//
+// This function is safe for concurrent access and is part of the
+// rpcserverConnManager interface implementation.
+func (cm *rpcConnManager) PrivateBroadcast(txns []*mempool.TxDesc) bool {
+	if cm.server.privateBroadcaster == nil {
+		return false
+	}
+	cm.server.privateBroadcaster.Add(txns)
+	return true
+}
+
+// PrivateBroadcastPending returns whether the transaction with the passed hash
+// is waiting to be relayed back after being broadcast privately.
+//
+// This function is safe for concurrent access and is part of the
+// rpcserverConnManager interface implementation.
+func (cm *rpcConnManager) PrivateBroadcastPending(hash *chainhash.Hash) bool {
+	return cm.server.privateBroadcaster != nil &&
+		cm.server.privateBroadcaster.IsPending(hash)
+}
+
 // NodeAddresses returns an array consisting node addresses which can
 // potentially be used to find new nodes in the network.
 //
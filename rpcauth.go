@@ -0,0 +1,260 @@
+// Copyright (c) 2021 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"strings"
+)
+
+const (
+	// rpcWhitelistAll is the whitelist token that authorizes a user to call
+	// all methods.
+	rpcWhitelistAll = "*"
+
+	// rpcWhitelistLimited is the whitelist token that expands to the methods
+	// that may be called by the limited user.
+	rpcWhitelistLimited = "@limited"
+)
+
+// rpcUser houses the credentials of a user of the RPC server along with the
+// methods the user is authorized to call.
+type rpcUser struct {
+	name string
+
+	// authsha is the SHA-256 hash of the HTTP basic authorization header
+	// of a user configured with a plain text password.
+	authsha [sha256.Size]byte
+
+	// salt and passwordHMAC are the salt and the HMAC-SHA256 of the password
+	// keyed with the salt of a user configured with --rpcauth.  They are
+	// only set for those users.
+	salt         string
+	passwordHMAC []byte
+
+	// allowedMethods is the set of methods the user is authorized to call.
+	// A nil set authorizes all methods.
+	allowedMethods map[string]struct{}
+}
+
+// isAuthorized returns whether the user is authorized to call the passed
+// method.
+func (u *rpcUser) isAuthorized(method string) bool {
+	if u.allowedMethods == nil {
+		return true
+	}
+	_, ok := u.allowedMethods[method]
+	return ok
+}
+
+// unauthorizedMessage returns the message of the error returned to the user
+// when calling the passed method is not authorized.
+func (u *rpcUser) unauthorizedMessage(method string) string {
+	return fmt.Sprintf("user %q is not authorized to call method %q",
+		u.name, method)
+}
+
+// newPlainRPCUser returns a user authenticated with the passed plain text
+// password that is authorized to call the passed methods.
+func newPlainRPCUser(name, password string, allowedMethods map[string]struct{}) *rpcUser {
+	login := name + ":" + password
+	auth := "Basic " + base64.StdEncoding.EncodeToString([]byte(login))
+	return &rpcUser{
+		name:           name,
+		authsha:        sha256.Sum256([]byte(auth)),
+		allowedMethods: allowedMethods,
+	}
+}
+
+// parseRPCAuth parses an --rpcauth entry in the <user>:<salt>$<hash> format,
+// where hash is the hex encoded HMAC-SHA256 of the password keyed with the
+// salt, into a user that is authorized to call the limited methods.
+func parseRPCAuth(entry string) (*rpcUser, error) {
+	fields := strings.SplitN(entry, ":", 2)
+	if len(fields) != 2 || fields[0] == "" {
+		return nil, fmt.Errorf("malformed rpcauth entry %q", entry)
+	}
+	saltHash := strings.SplitN(fields[1], "$", 2)
+	if len(saltHash) != 2 || saltHash[0] == "" {
+		return nil, fmt.Errorf("malformed rpcauth entry for user %q",
+			fields[0])
+	}
+	passwordHMAC, err := hex.DecodeString(saltHash[1])
+	if err != nil || len(passwordHMAC) != sha256.Size {
+		return nil, fmt.Errorf("malformed rpcauth password hash for "+
+			"user %q", fields[0])
+	}
+	return &rpcUser{
+		name:           fields[0],
+		salt:           saltHash[0],
+		passwordHMAC:   passwordHMAC,
+		allowedMethods: limitedRPCMethods(),
+	}, nil
+}
+
+// limitedRPCMethods returns a copy of the set of methods that may be called by
+// limited users.
+func limitedRPCMethods() map[string]struct{} {
+	methods := make(map[string]struct{}, len(rpcLimited))
+	for method := range rpcLimited {
+		methods[method] = struct{}{}
+	}
+	return methods
+}
+
+// parseRPCWhitelist parses an --rpcwhitelist entry in the
+// <user>:<method>,<method>,... format and returns the user name and the set of
+// whitelisted methods.  The rpcWhitelistLimited token expands to the limited
+// methods and the rpcWhitelistAll token results in a nil set, which authorizes
+// all methods.
+func parseRPCWhitelist(entry string) (string, map[string]struct{}, error) {
+	fields := strings.SplitN(entry, ":", 2)
+	if len(fields) != 2 || fields[0] == "" {
+		return "", nil, fmt.Errorf("malformed rpcwhitelist entry %q", entry)
+	}
+
+	methods := make(map[string]struct{})
+	for _, method := range strings.Split(fields[1], ",") {
+		method = strings.TrimSpace(method)
+		switch method {
+		case "":
+			continue
+
+		case rpcWhitelistAll:
+			return fields[0], nil, nil
+
+		case rpcWhitelistLimited:
+			for method := range rpcLimited {
+				methods[method] = struct{}{}
+			}
+			continue
+		}
+
+		_, isRPC := rpcHandlers[method]
+		_, isWS := wsHandlers[method]
+		if !isRPC && !isWS {
+			return "", nil, fmt.Errorf("unknown method %q in rpcwhitelist "+
+				"entry for user %q", method, fields[0])
+		}
+		methods[method] = struct{}{}
+	}
+	return fields[0], methods, nil
+}
+
+// intersectRPCMethods returns the methods contained in both passed sets, where
+// a nil set contains all methods.
+func intersectRPCMethods(a, b map[string]struct{}) map[string]struct{} {
+	if a == nil {
+		return b
+	}
+	if b == nil {
+		return a
+	}
+	methods := make(map[string]struct{})
+	for method := range a {
+		if _, ok := b[method]; ok {
+			methods[method] = struct{}{}
+		}
+	}
+	return methods
+}
+
+// createRPCUsers returns the users of the RPC server configured by the passed
+// config.  The admin user is authorized to call all methods, while the limited
+// user and users configured with --rpcauth are authorized to call the limited
+// methods.  The methods of each user can be restricted further or extended
+// with --rpcwhitelist.  Multiple whitelists of the same user are intersected.
+func createRPCUsers(cfg *config) ([]*rpcUser, error) {
+	// The limited user is added first as in environments with limited users,
+	// those are probably expected to have a higher volume of calls.
+	var users []*rpcUser
+	if cfg.RPCLimitUser != "" && cfg.RPCLimitPass != "" {
+		users = append(users, newPlainRPCUser(cfg.RPCLimitUser,
+			cfg.RPCLimitPass, limitedRPCMethods()))
+	}
+	if cfg.RPCUser != "" && cfg.RPCPass != "" {
+		users = append(users, newPlainRPCUser(cfg.RPCUser, cfg.RPCPass, nil))
+	}
+	for _, entry := range cfg.RPCAuth {
+		user, err := parseRPCAuth(entry)
+		if err != nil {
+			return nil, err
+		}
+		for _, other := range users {
+			if other.name == user.name {
+				return nil, fmt.Errorf("rpcauth user %q is configured "+
+					"more than once", user.name)
+			}
+		}
+		users = append(users, user)
+	}
+
+	whitelisted := make(map[*rpcUser]struct{})
+	for _, entry := range cfg.RPCWhitelist {
+		name, methods, err := parseRPCWhitelist(entry)
+		if err != nil {
+			return nil, err
+		}
+		var user *rpcUser
+		for _, u := range users {
+			if u.name == name {
+				user = u
+				break
+			}
+		}
+		if user == nil {
+			return nil, fmt.Errorf("rpcwhitelist entry for unknown "+
+				"user %q", name)
+		}
+
+		// The first whitelist of a user replaces the default methods
+		// and any additional whitelists restrict them further.
+		if _, ok := whitelisted[user]; !ok {
+			user.allowedMethods = methods
+			whitelisted[user] = struct{}{}
+			continue
+		}
+		user.allowedMethods = intersectRPCMethods(user.allowedMethods,
+			methods)
+	}
+
+	return users, nil
+}
+
+// authenticate returns the user identified by the passed credentials or nil
+// when they do not match any user.
+//
+// This check is time-constant for users configured with plain text passwords.
+func (s *rpcServer) authenticate(username, password string) *rpcUser {
+	login := username + ":" + password
+	auth := "Basic " + base64.StdEncoding.EncodeToString([]byte(login))
+	authsha := sha256.Sum256([]byte(auth))
+
+	var match *rpcUser
+	for _, user := range s.users {
+		if user.passwordHMAC != nil {
+			if user.name != username || match != nil {
+				continue
+			}
+			mac := hmac.New(sha256.New, []byte(user.salt))
+			mac.Write([]byte(password))
+			if hmac.Equal(mac.Sum(nil), user.passwordHMAC) {
+				match = user
+			}
+			continue
+		}
+
+		cmp := subtle.ConstantTimeCompare(authsha[:], user.authsha[:])
+		if cmp == 1 && match == nil {
+			match = user
+		}
+	}
+	return match
+}
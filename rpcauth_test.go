@@ -0,0 +1,202 @@
+// Copyright (c) 2021 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"testing"
+
+	"github.com/btcsuite/btcd/btcjson"
+	"github.com/btcsuite/btclog"
+)
+
+// testRPCAuth returns an --rpcauth entry for the passed user, salt and
+// password.
+func testRPCAuth(user, salt, password string) string {
+	mac := hmac.New(sha256.New, []byte(salt))
+	mac.Write([]byte(password))
+	return user + ":" + salt + "$" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// TestRPCUsers ensures users are created from the config, authenticated and
+// authorized as expected.
+func TestRPCUsers(t *testing.T) {
+	t.Parallel()
+
+	testCfg := &config{
+		RPCUser:      "admin",
+		RPCPass:      "adminpass",
+		RPCLimitUser: "limited",
+		RPCLimitPass: "limitedpass",
+		RPCAuth: []string{
+			testRPCAuth("explorer", "cb77f0957de88ff388cf817ddbc7273", "explorerpass"),
+			testRPCAuth("miner", "a1b2c3", "minerpass"),
+			testRPCAuth("monitor", "d4e5f6", "monitorpass"),
+		},
+		RPCWhitelist: []string{
+			"miner:getblocktemplate,submitblock,getblockcount",
+			"miner:getblocktemplate,submitblock",
+			"monitor:@limited,getpeerinfo",
+			"limited:*",
+		},
+	}
+	users, err := createRPCUsers(testCfg)
+	if err != nil {
+		t.Fatalf("createRPCUsers: unexpected error: %v", err)
+	}
+	s := &rpcServer{users: users}
+
+	tests := []struct {
+		name       string
+		user       string
+		password   string
+		authorized []string
+		denied     []string
+	}{
+		{
+			name:       "admin",
+			user:       "admin",
+			password:   "adminpass",
+			authorized: []string{"stop", "getblock", "notifyblocks"},
+		},
+		{
+			name:       "whitelisted limited user",
+			user:       "limited",
+			password:   "limitedpass",
+			authorized: []string{"stop", "getblock"},
+		},
+		{
+			name:       "rpcauth user without whitelist",
+			user:       "explorer",
+			password:   "explorerpass",
+			authorized: []string{"getblock", "notifyblocks"},
+			denied:     []string{"stop", "getpeerinfo"},
+		},
+		{
+			name:       "intersected whitelists",
+			user:       "miner",
+			password:   "minerpass",
+			authorized: []string{"getblocktemplate", "submitblock"},
+			denied:     []string{"getblockcount", "getblock"},
+		},
+		{
+			name:       "whitelist extending limited methods",
+			user:       "monitor",
+			password:   "monitorpass",
+			authorized: []string{"getpeerinfo", "getblock"},
+			denied:     []string{"stop", "addnode"},
+		},
+	}
+	for _, test := range tests {
+		user := s.authenticate(test.user, test.password)
+		if user == nil || user.name != test.user {
+			t.Errorf("%s: authenticate: got %v, want user %q", test.name,
+				user, test.user)
+			continue
+		}
+		for _, method := range test.authorized {
+			if !user.isAuthorized(method) {
+				t.Errorf("%s: method %q not authorized", test.name,
+					method)
+			}
+		}
+		for _, method := range test.denied {
+			if user.isAuthorized(method) {
+				t.Errorf("%s: method %q authorized", test.name, method)
+			}
+		}
+	}
+
+	// Ensure wrong passwords and unknown users are rejected.
+	credentials := [][2]string{
+		{"admin", "limitedpass"},
+		{"explorer", "minerpass"},
+		{"unknown", "adminpass"},
+	}
+	for _, c := range credentials {
+		if user := s.authenticate(c[0], c[1]); user != nil {
+			t.Errorf("authenticate(%q, %q): got user %q, want nil", c[0],
+				c[1], user.name)
+		}
+	}
+}
+
+// TestRPCUsersErrors ensures invalid rpcauth and rpcwhitelist entries are
+// rejected.
+func TestRPCUsersErrors(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name      string
+		auth      []string
+		whitelist []string
+	}{
+		{
+			name: "missing salt",
+			auth: []string{"user:$" + hex.EncodeToString(make([]byte, 32))},
+		},
+		{
+			name: "short hash",
+			auth: []string{"user:salt$00"},
+		},
+		{
+			name: "duplicate user",
+			auth: []string{testRPCAuth("admin", "salt", "pass")},
+		},
+		{
+			name:      "unknown user",
+			whitelist: []string{"unknown:getblock"},
+		},
+		{
+			name:      "unknown method",
+			whitelist: []string{"admin:getblock,notamethod"},
+		},
+		{
+			name:      "malformed whitelist",
+			whitelist: []string{"getblock"},
+		},
+	}
+	for _, test := range tests {
+		testCfg := &config{
+			RPCUser:      "admin",
+			RPCPass:      "adminpass",
+			RPCAuth:      test.auth,
+			RPCWhitelist: test.whitelist,
+		}
+		if _, err := createRPCUsers(testCfg); err == nil {
+			t.Errorf("%s: createRPCUsers: expected error", test.name)
+		}
+	}
+}
+
+// TestRPCUnauthorizedMethod ensures the error returned when a user calls a
+// method it is not authorized to call names the denied method.
+func TestRPCUnauthorizedMethod(t *testing.T) {
+	// The logger can't be used before the log rotator is initialized.
+	rpcsLog.SetLevel(btclog.LevelOff)
+
+	s := &rpcServer{}
+	user := newPlainRPCUser("limited", "limitedpass",
+		map[string]struct{}{"getblock": {}})
+	request := &btcjson.Request{
+		Jsonrpc: btcjson.RpcVersion1,
+		Method:  "stop",
+		Params:  []json.RawMessage{},
+		ID:      1,
+	}
+	reply := s.processRequest(request, user, "", nil)
+
+	var resp btcjson.Response
+	if err := json.Unmarshal(reply, &resp); err != nil {
+		t.Fatalf("unable to decode reply: %v", err)
+	}
+	want := `user "limited" is not authorized to call method "stop"`
+	if resp.Error == nil || resp.Error.Message != want {
+		t.Fatalf("got error %v, want %q", resp.Error, want)
+	}
+}
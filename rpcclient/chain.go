@@ -1382,3 +1382,116 @@ func (c *Client) GetDescriptorInfoAsync(descriptor string) FutureGetDescriptorIn
 func (c *Client) GetDescriptorInfo(descriptor string) (*btcjson.GetDescriptorInfoResult, error) {
 	return c.GetDescriptorInfoAsync(descriptor).Receive()
 }
+
+// FutureScanTxOutSetResult is a future promise to deliver the result of a
+// ScanTxOutSetAsync RPC invocation (or an applicable error).
+type FutureScanTxOutSetResult chan *response
+
+// Receive waits for the response promised by the future and returns the
+// unspent outputs found by the scan.
+func (r FutureScanTxOutSetResult) Receive() (*btcjson.ScanTxOutSetResult, error) {
+	res, err := receiveFuture(r)
+	if err != nil {
+		return nil, err
+	}
+
+	var scanResult btcjson.ScanTxOutSetResult
+	err = json.Unmarshal(res, &scanResult)
+	if err != nil {
+		return nil, err
+	}
+
+	return &scanResult, nil
+}
+
+// ScanTxOutSetAsync returns an instance of a type that can be used to get the
+// result of the RPC at some future time by invoking the Receive function on the
+// returned instance.
+//
+// See ScanTxOutSet for the blocking version and more details.
+func (c *Client) ScanTxOutSetAsync(scanObjects []btcjson.ScanObject) FutureScanTxOutSetResult {
+	cmd := btcjson.NewScanTxOutSetCmd(btcjson.ScanTxOutSetStart, &scanObjects)
+	return c.sendCmd(cmd)
+}
+
+// ScanTxOutSet scans the UTXO set for unspent outputs matching the passed
+// output descriptors and returns once the scan completes.
+//
+// See btcjson.ScanTxOutSetResult for details about the result.
+func (c *Client) ScanTxOutSet(scanObjects []btcjson.ScanObject) (*btcjson.ScanTxOutSetResult, error) {
+	return c.ScanTxOutSetAsync(scanObjects).Receive()
+}
+
+// FutureScanTxOutSetStatusResult is a future promise to deliver the result of
+// a ScanTxOutSetStatusAsync RPC invocation (or an applicable error).
+type FutureScanTxOutSetStatusResult chan *response
+
+// Receive waits for the response promised by the future and returns the
+// progress of the scan in progress or nil when no scan is in progress.
+func (r FutureScanTxOutSetStatusResult) Receive() (*btcjson.ScanTxOutSetStatusResult, error) {
+	res, err := receiveFuture(r)
+	if err != nil {
+		return nil, err
+	}
+
+	var status *btcjson.ScanTxOutSetStatusResult
+	err = json.Unmarshal(res, &status)
+	if err != nil {
+		return nil, err
+	}
+
+	return status, nil
+}
+
+// ScanTxOutSetStatusAsync returns an instance of a type that can be used to
+// get the result of the RPC at some future time by invoking the Receive
+// function on the returned instance.
+//
+// See ScanTxOutSetStatus for the blocking version and more details.
+func (c *Client) ScanTxOutSetStatusAsync() FutureScanTxOutSetStatusResult {
+	cmd := btcjson.NewScanTxOutSetCmd(btcjson.ScanTxOutSetStatus, nil)
+	return c.sendCmd(cmd)
+}
+
+// ScanTxOutSetStatus returns the progress of the UTXO set scan in progress or
+// nil when no scan is in progress.
+func (c *Client) ScanTxOutSetStatus() (*btcjson.ScanTxOutSetStatusResult, error) {
+	return c.ScanTxOutSetStatusAsync().Receive()
+}
+
+// FutureAbortScanTxOutSetResult is a future promise to deliver the result of
+// an AbortScanTxOutSetAsync RPC invocation (or an applicable error).
+type FutureAbortScanTxOutSetResult chan *response
+
+// Receive waits for the response promised by the future and returns whether a
+// scan was aborted.
+func (r FutureAbortScanTxOutSetResult) Receive() (bool, error) {
+	res, err := receiveFuture(r)
+	if err != nil {
+		return false, err
+	}
+
+	var aborted bool
+	err = json.Unmarshal(res, &aborted)
+	if err != nil {
+		return false, err
+	}
+
+	return aborted, nil
+}
+
+// AbortScanTxOutSetAsync returns an instance of a type that can be used to get
+// the result of the RPC at some future time by invoking the Receive function
+// on the returned instance.
+//
+// See AbortScanTxOutSet for the blocking version and more details.
+func (c *Client) AbortScanTxOutSetAsync() FutureAbortScanTxOutSetResult {
+	cmd := btcjson.NewScanTxOutSetCmd(btcjson.ScanTxOutSetAbort, nil)
+	return c.sendCmd(cmd)
+}
+
+// AbortScanTxOutSet aborts the UTXO set scan in progress and returns whether a
+// scan was aborted.
+func (c *Client) AbortScanTxOutSet() (bool, error) {
+	return c.AbortScanTxOutSetAsync().Receive()
+}
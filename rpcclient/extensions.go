@@ -18,6 +18,37 @@ import (
 	"github.com/btcsuite/btcutil"
 )
 
+// FutureCompactDBResult is a future promise to deliver the result of a
+// CompactDBAsync RPC invocation (or an applicable error).
+type FutureCompactDBResult chan *response
+
+// Receive waits for the response promised by the future and returns an error
+// if the database could not be compacted.
+func (r FutureCompactDBResult) Receive() error {
+	_, err := receiveFuture(r)
+	return err
+}
+
+// CompactDBAsync returns an instance of a type that can be used to get the
+// result of the RPC at some future time by invoking the Receive function on
+// the returned instance.
+//
+// See CompactDB for the blocking version and more details.
+//
+// NOTE: This is a btcd extension.
+func (c *Client) CompactDBAsync() FutureCompactDBResult {
+	cmd := btcjson.NewCompactDBCmd()
+	return c.sendCmd(cmd)
+}
+
+// CompactDB compacts the database metadata of the server to reclaim disk
+// space.  The call returns once the compaction has completed.
+//
+// NOTE: This is a btcd extension.
+func (c *Client) CompactDB() error {
+	return c.CompactDBAsync().Receive()
+}
+
 // FutureDebugLevelResult is a future promise to deliver the result of a
 // DebugLevelAsync RPC invocation (or an applicable error).
 type FutureDebugLevelResult chan *response
@@ -194,6 +225,48 @@ func (c *Client) GetBestBlock() (*chainhash.Hash, int32, error) {
 	return c.GetBestBlockAsync().Receive()
 }
 
+// FutureGetBlockStatsRangeResult is a future promise to deliver the result of
+// a GetBlockStatsRangeAsync RPC invocation (or an applicable error).
+type FutureGetBlockStatsRangeResult chan *response
+
+// Receive waits for the response promised by the future and returns the
+// statistics of the blocks in the requested height range.
+func (r FutureGetBlockStatsRangeResult) Receive() ([]btcjson.GetBlockStatsResult, error) {
+	res, err := receiveFuture(r)
+	if err != nil {
+		return nil, err
+	}
+
+	var blockStats []btcjson.GetBlockStatsResult
+	err = json.Unmarshal(res, &blockStats)
+	if err != nil {
+		return nil, err
+	}
+	return blockStats, nil
+}
+
+// GetBlockStatsRangeAsync returns an instance of a type that can be used to get
+// the result of the RPC at some future time by invoking the Receive function on
+// the returned instance.
+//
+// See GetBlockStatsRange for the blocking version and more details.
+//
+// NOTE: This is a btcd extension.
+func (c *Client) GetBlockStatsRangeAsync(startHeight, endHeight int32, stats *[]string) FutureGetBlockStatsRangeResult {
+	cmd := btcjson.NewGetBlockStatsRangeCmd(startHeight, endHeight, stats)
+	return c.sendCmd(cmd)
+}
+
+// GetBlockStatsRange returns the statistics of the main chain blocks with
+// heights in the passed inclusive range from the block stats index of the
+// server.  The stats argument allows to select certain stats to return.  The
+// range may include at most 1000 heights.
+//
+// NOTE: This is a btcd extension.
+func (c *Client) GetBlockStatsRange(startHeight, endHeight int32, stats *[]string) ([]btcjson.GetBlockStatsResult, error) {
+	return c.GetBlockStatsRangeAsync(startHeight, endHeight, stats).Receive()
+}
+
 // FutureGetCurrentNetResult is a future promise to deliver the result of a
 // GetCurrentNetAsync RPC invocation (or an applicable error).
 type FutureGetCurrentNetResult chan *response
@@ -422,6 +495,62 @@ func (c *Client) Session() (*btcjson.SessionResult, error) {
 	return c.SessionAsync().Receive()
 }
 
+// FutureResumeNotificationsResult is a future promise to deliver the result of
+// a ResumeNotificationsAsync RPC invocation (or an applicable error).
+type FutureResumeNotificationsResult chan *response
+
+// Receive waits for the response promised by the future and returns the
+// resume notifications result.
+func (r FutureResumeNotificationsResult) Receive() (*btcjson.ResumeNotificationsResult, error) {
+	res, err := receiveFuture(r)
+	if err != nil {
+		return nil, err
+	}
+
+	// Unmarshal result as a resume notifications result object.
+	var result btcjson.ResumeNotificationsResult
+	err = json.Unmarshal(res, &result)
+	if err != nil {
+		return nil, err
+	}
+
+	return &result, nil
+}
+
+// ResumeNotificationsAsync returns an instance of a type that can be used to
+// get the result of the RPC at some future time by invoking the Receive
+// function on the returned instance.
+//
+// See ResumeNotifications for the blocking version and more details.
+//
+// NOTE: This is a btcd extension.
+func (c *Client) ResumeNotificationsAsync(blockHash *chainhash.Hash,
+	sequence *uint64) FutureResumeNotificationsResult {
+
+	// Not supported in HTTP POST mode.
+	if c.config.HTTPPostMode {
+		return newFutureError(ErrWebsocketsRequired)
+	}
+
+	cmd := btcjson.NewResumeNotificationsCmd(blockHash.String(), sequence)
+	return c.sendCmd(cmd)
+}
+
+// ResumeNotifications replays the block and relevant transaction notifications
+// missed since the notification with the passed sequence number or, when it is
+// nil or no longer available on the server, since the connection of the block
+// with the passed hash.  It must be called after registering for block
+// notifications and loading the transaction filter.
+//
+// This RPC requires the client to be running in websocket mode.
+//
+// NOTE: This is a btcd extension.
+func (c *Client) ResumeNotifications(blockHash *chainhash.Hash,
+	sequence *uint64) (*btcjson.ResumeNotificationsResult, error) {
+
+	return c.ResumeNotificationsAsync(blockHash, sequence).Receive()
+}
+
 // FutureVersionResult is a future promise to deliver the result of a version
 // RPC invocation (or an applicable error).
 //
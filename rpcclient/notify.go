@@ -1355,3 +1355,32 @@ func (c *Client) LoadTxFilterAsync(reload bool, addresses []btcutil.Address,
 func (c *Client) LoadTxFilter(reload bool, addresses []btcutil.Address, outPoints []wire.OutPoint) error {
 	return c.LoadTxFilterAsync(reload, addresses, outPoints).Receive()
 }
+
+// LoadTxFilterDescriptorsAsync returns an instance of a type that can be used
+// to get the result of the RPC at some future time by invoking the Receive
+// function on the returned instance.
+//
+// See LoadTxFilterDescriptors for the blocking version and more details.
+//
+// NOTE: This is a btcd extension and requires a websocket connection.
+func (c *Client) LoadTxFilterDescriptorsAsync(reload bool,
+	descriptors []btcjson.TxFilterDescriptor) FutureLoadTxFilterResult {
+
+	cmd := &btcjson.LoadTxFilterCmd{
+		Reload:      reload,
+		Addresses:   []string{},
+		OutPoints:   []btcjson.OutPoint{},
+		Descriptors: &descriptors,
+	}
+	return c.sendCmd(cmd)
+}
+
+// LoadTxFilterDescriptors loads, reloads, or adds the addresses described by
+// output descriptors to a websocket client's transaction filter.  Addresses of
+// ranged descriptors are derived by the server as they are used, up to the gap
+// limit of each descriptor.
+//
+// NOTE: This is a btcd extension and requires a websocket connection.
+func (c *Client) LoadTxFilterDescriptors(reload bool, descriptors []btcjson.TxFilterDescriptor) error {
+	return c.LoadTxFilterDescriptorsAsync(reload, descriptors).Receive()
+}
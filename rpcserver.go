@@ -7,8 +7,6 @@ package main
 
 import (
 	"bytes"
-	"crypto/sha256"
-	"crypto/subtle"
 	"encoding/base64"
 	"encoding/hex"
 	"encoding/json"
@@ -21,6 +19,7 @@ import (
 	"net"
 	"net/http"
 	"os"
+	"sort"
 	"strconv"
 	"strings"
 	"sync"
@@ -34,13 +33,16 @@ import (
 	"github.com/btcsuite/btcd/chaincfg"
 	"github.com/btcsuite/btcd/chaincfg/chainhash"
 	"github.com/btcsuite/btcd/database"
+	"github.com/btcsuite/btcd/descriptor"
 	"github.com/btcsuite/btcd/mempool"
 	"github.com/btcsuite/btcd/mining"
 	"github.com/btcsuite/btcd/mining/cpuminer"
 	"github.com/btcsuite/btcd/peer"
 	"github.com/btcsuite/btcd/txscript"
 	"github.com/btcsuite/btcd/wire"
+	"github.com/btcsuite/btclog"
 	"github.com/btcsuite/btcutil"
+	"github.com/btcsuite/btcutil/hdkeychain"
 	"github.com/btcsuite/websocket"
 )
 
@@ -123,7 +125,7 @@ var (
 	}
 )
 
-type commandHandler func(*rpcServer, interface{}, <-chan struct{}) (interface{}, error)
+type commandHandler func(*rpcServer, interface{}, *rpcRequest) (interface{}, error)
 
 // rpcHandlers maps RPC command strings to appropriate handler functions.
 // This is set by init because help references rpcHandlers and thus causes
@@ -131,13 +133,19 @@ type commandHandler func(*rpcServer, interface{}, <-chan struct{}) (interface{},
 var rpcHandlers map[string]commandHandler
 var rpcHandlersBeforeInit = map[string]commandHandler{
 	"addnode":                handleAddNode,
+	"compactdb":              handleCompactDB,
 	"createrawtransaction":   handleCreateRawTransaction,
 	"debuglevel":             handleDebugLevel,
 	"decoderawtransaction":   handleDecodeRawTransaction,
 	"decodescript":           handleDecodeScript,
+	"deriveaddresses":        handleDeriveAddresses,
 	"estimatefee":            handleEstimateFee,
 	"generate":               handleGenerate,
 	"getaddednodeinfo":       handleGetAddedNodeInfo,
+	"getaddressbalance":      handleGetAddressBalance,
+	"getaddressdeltas":       handleGetAddressDeltas,
+	"getaddressmempool":      handleGetAddressMempool,
+	"getaddressutxos":        handleGetAddressUtxos,
 	"getbestblock":           handleGetBestBlock,
 	"getbestblockhash":       handleGetBestBlockHash,
 	"getblock":               handleGetBlock,
@@ -145,11 +153,14 @@ var rpcHandlersBeforeInit = map[string]commandHandler{
 	"getblockcount":          handleGetBlockCount,
 	"getblockhash":           handleGetBlockHash,
 	"getblockheader":         handleGetBlockHeader,
+	"getblockstats":          handleGetBlockStats,
+	"getblockstatsrange":     handleGetBlockStatsRange,
 	"getblocktemplate":       handleGetBlockTemplate,
 	"getcfilter":             handleGetCFilter,
 	"getcfilterheader":       handleGetCFilterHeader,
 	"getconnectioncount":     handleGetConnectionCount,
 	"getcurrentnet":          handleGetCurrentNet,
+	"getdescriptorinfo":      handleGetDescriptorInfo,
 	"getdifficulty":          handleGetDifficulty,
 	"getgenerate":            handleGetGenerate,
 	"gethashespersec":        handleGetHashesPerSec,
@@ -163,10 +174,12 @@ var rpcHandlersBeforeInit = map[string]commandHandler{
 	"getpeerinfo":            handleGetPeerInfo,
 	"getrawmempool":          handleGetRawMempool,
 	"getrawtransaction":      handleGetRawTransaction,
+	"getspentinfo":           handleGetSpentInfo,
 	"gettxout":               handleGetTxOut,
 	"help":                   handleHelp,
 	"node":                   handleNode,
 	"ping":                   handlePing,
+	"scantxoutset":           handleScanTxOutSet,
 	"searchrawtransactions":  handleSearchRawTransactions,
 	"sendrawtransaction":     handleSendRawTransaction,
 	"setgenerate":            handleSetGenerate,
@@ -250,6 +263,7 @@ var rpcLimited = map[string]struct{}{
 	"notifyspent":           {},
 	"rescan":                {},
 	"rescanblocks":          {},
+	"resumenotifications":   {},
 	"session":               {},
 
 	// Websockets AND HTTP/S commands
@@ -259,16 +273,24 @@ var rpcLimited = map[string]struct{}{
 	"createrawtransaction":  {},
 	"decoderawtransaction":  {},
 	"decodescript":          {},
+	"deriveaddresses":       {},
 	"estimatefee":           {},
+	"getaddressbalance":     {},
+	"getaddressdeltas":      {},
+	"getaddressmempool":     {},
+	"getaddressutxos":       {},
 	"getbestblock":          {},
 	"getbestblockhash":      {},
 	"getblock":              {},
 	"getblockcount":         {},
 	"getblockhash":          {},
 	"getblockheader":        {},
+	"getblockstats":         {},
+	"getblockstatsrange":    {},
 	"getcfilter":            {},
 	"getcfilterheader":      {},
 	"getcurrentnet":         {},
+	"getdescriptorinfo":     {},
 	"getdifficulty":         {},
 	"getheaders":            {},
 	"getinfo":               {},
@@ -276,6 +298,7 @@ var rpcLimited = map[string]struct{}{
 	"getnetworkhashps":      {},
 	"getrawmempool":         {},
 	"getrawtransaction":     {},
+	"getspentinfo":          {},
 	"gettxout":              {},
 	"searchrawtransactions": {},
 	"sendrawtransaction":    {},
@@ -304,11 +327,17 @@ func builderScript(builder *txscript.ScriptBuilder) []byte {
 // context parameter is only used in the log message and may be empty if it's
 // not needed.
 func internalRPCError(errStr, context string) *btcjson.RPCError {
+	return logInternalRPCError(rpcsLog, errStr, context)
+}
+
+// logInternalRPCError converts an internal error to an RPC error like
+// internalRPCError, but logs it with the passed logger.
+func logInternalRPCError(log btclog.Logger, errStr, context string) *btcjson.RPCError {
 	logStr := errStr
 	if context != "" {
 		logStr = context + ": " + errStr
 	}
-	rpcsLog.Error(logStr)
+	log.Error(logStr)
 	return btcjson.NewRPCError(btcjson.ErrRPCInternal.Code, errStr)
 }
 
@@ -329,6 +358,15 @@ func rpcNoTxInfoError(txHash *chainhash.Hash) *btcjson.RPCError {
 			txHash))
 }
 
+// rpcNoTxIndexError is a convenience function for returning a nicely formatted
+// RPC error which indicates that transactions which are not in the memory pool
+// can't be queried because the transaction index is disabled.
+func rpcNoTxIndexError() *btcjson.RPCError {
+	return btcjson.NewRPCError(btcjson.ErrRPCNoTxInfo, "The transaction "+
+		"index must be enabled to query the blockchain (specify "+
+		"--txindex)")
+}
+
 // gbtWorkState houses state that is used in between multiple RPC invocations to
 // getblocktemplate.
 type gbtWorkState struct {
@@ -353,19 +391,19 @@ func newGbtWorkState(timeSource blockchain.MedianTimeSource) *gbtWorkState {
 
 // handleUnimplemented is the handler for commands that should ultimately be
 // supported but are not yet implemented.
-func handleUnimplemented(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
+func handleUnimplemented(s *rpcServer, cmd interface{}, req *rpcRequest) (interface{}, error) {
 	return nil, ErrRPCUnimplemented
 }
 
 // handleAskWallet is the handler for commands that are recognized as valid, but
 // are unable to answer correctly since it involves wallet state.
 // These commands will be implemented in btcwallet.
-func handleAskWallet(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
+func handleAskWallet(s *rpcServer, cmd interface{}, req *rpcRequest) (interface{}, error) {
 	return nil, ErrRPCNoWallet
 }
 
 // handleAddNode handles addnode commands.
-func handleAddNode(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
+func handleAddNode(s *rpcServer, cmd interface{}, req *rpcRequest) (interface{}, error) {
 	c := cmd.(*btcjson.AddNodeCmd)
 
 	addr := normalizeAddress(c.Addr, s.cfg.ChainParams.DefaultPort)
@@ -396,7 +434,7 @@ func handleAddNode(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (in
 }
 
 // handleNode handles node commands.
-func handleNode(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
+func handleNode(s *rpcServer, cmd interface{}, req *rpcRequest) (interface{}, error) {
 	c := cmd.(*btcjson.NodeCmd)
 
 	var addr string
@@ -513,8 +551,27 @@ func messageToHex(msg wire.Message) (string, error) {
 	return hex.EncodeToString(buf.Bytes()), nil
 }
 
+// handleCompactDB handles compactdb commands.
+func handleCompactDB(s *rpcServer, cmd interface{}, req *rpcRequest) (interface{}, error) {
+	compactor, ok := s.cfg.DB.(database.Compactor)
+	if !ok {
+		return nil, &btcjson.RPCError{
+			Code: btcjson.ErrRPCMisc,
+			Message: fmt.Sprintf("The %s database backend does not "+
+				"support compaction", cfg.DbType),
+		}
+	}
+
+	if err := compactor.Compact(); err != nil {
+		context := "Failed to compact database"
+		return nil, req.internalError(err.Error(), context)
+	}
+
+	return "Done.", nil
+}
+
 // handleCreateRawTransaction handles createrawtransaction commands.
-func handleCreateRawTransaction(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
+func handleCreateRawTransaction(s *rpcServer, cmd interface{}, req *rpcRequest) (interface{}, error) {
 	c := cmd.(*btcjson.CreateRawTransactionCmd)
 
 	// Validate the locktime, if given.
@@ -588,14 +645,14 @@ func handleCreateRawTransaction(s *rpcServer, cmd interface{}, closeChan <-chan
 		pkScript, err := txscript.PayToAddrScript(addr)
 		if err != nil {
 			context := "Failed to generate pay-to-address script"
-			return nil, internalRPCError(err.Error(), context)
+			return nil, req.internalError(err.Error(), context)
 		}
 
 		// Convert the amount to satoshi.
 		satoshi, err := btcutil.NewAmount(amount)
 		if err != nil {
 			context := "Failed to convert amount"
-			return nil, internalRPCError(err.Error(), context)
+			return nil, req.internalError(err.Error(), context)
 		}
 
 		txOut := wire.NewTxOut(int64(satoshi), pkScript)
@@ -619,7 +676,7 @@ func handleCreateRawTransaction(s *rpcServer, cmd interface{}, closeChan <-chan
 }
 
 // handleDebugLevel handles debuglevel commands.
-func handleDebugLevel(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
+func handleDebugLevel(s *rpcServer, cmd interface{}, req *rpcRequest) (interface{}, error) {
 	c := cmd.(*btcjson.DebugLevelCmd)
 
 	// Special show command to list supported subsystems.
@@ -780,7 +837,7 @@ func createTxRawResult(chainParams *chaincfg.Params, mtx *wire.MsgTx,
 }
 
 // handleDecodeRawTransaction handles decoderawtransaction commands.
-func handleDecodeRawTransaction(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
+func handleDecodeRawTransaction(s *rpcServer, cmd interface{}, req *rpcRequest) (interface{}, error) {
 	c := cmd.(*btcjson.DecodeRawTransactionCmd)
 
 	// Deserialize the transaction.
@@ -813,7 +870,7 @@ func handleDecodeRawTransaction(s *rpcServer, cmd interface{}, closeChan <-chan
 }
 
 // handleDecodeScript handles decodescript commands.
-func handleDecodeScript(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
+func handleDecodeScript(s *rpcServer, cmd interface{}, req *rpcRequest) (interface{}, error) {
 	c := cmd.(*btcjson.DecodeScriptCmd)
 
 	// Convert the hex script to bytes.
@@ -844,7 +901,7 @@ func handleDecodeScript(s *rpcServer, cmd interface{}, closeChan <-chan struct{}
 	p2sh, err := btcutil.NewAddressScriptHash(script, s.cfg.ChainParams)
 	if err != nil {
 		context := "Failed to convert script to pay-to-script-hash"
-		return nil, internalRPCError(err.Error(), context)
+		return nil, req.internalError(err.Error(), context)
 	}
 
 	// Generate and return the reply.
@@ -860,8 +917,93 @@ func handleDecodeScript(s *rpcServer, cmd interface{}, closeChan <-chan struct{}
 	return reply, nil
 }
 
+// maxDescriptorRange is the maximum number of derivation indexes of a ranged
+// descriptor deriveaddresses and scantxoutset derive scripts for.
+const maxDescriptorRange = 1000000
+
+// parseDescriptorRange returns the first and last derivation index of the
+// passed descriptor range, which is either the last index or an array of the
+// first and last index.
+func parseDescriptorRange(r *btcjson.DescriptorRange) (uint32, uint32, error) {
+	var begin, end int
+	switch v := r.Value.(type) {
+	case int:
+		end = v
+	case []int:
+		begin, end = v[0], v[1]
+	}
+	if begin < 0 || end < begin ||
+		uint64(end) >= hdkeychain.HardenedKeyStart {
+
+		return 0, 0, &btcjson.RPCError{
+			Code:    btcjson.ErrRPCInvalidParameter,
+			Message: "Range is invalid",
+		}
+	}
+	if end-begin >= maxDescriptorRange {
+		return 0, 0, &btcjson.RPCError{
+			Code:    btcjson.ErrRPCInvalidParameter,
+			Message: "Range is too large",
+		}
+	}
+	return uint32(begin), uint32(end), nil
+}
+
+// handleDeriveAddresses implements the deriveaddresses command.
+func handleDeriveAddresses(s *rpcServer, cmd interface{}, req *rpcRequest) (interface{}, error) {
+	c := cmd.(*btcjson.DeriveAddressesCmd)
+
+	if !strings.Contains(c.Descriptor, "#") {
+		return nil, &btcjson.RPCError{
+			Code:    btcjson.ErrRPCInvalidParameter,
+			Message: "Missing checksum",
+		}
+	}
+	desc, err := descriptor.Parse(c.Descriptor, s.cfg.ChainParams)
+	if err != nil {
+		return nil, &btcjson.RPCError{
+			Code:    btcjson.ErrRPCInvalidParameter,
+			Message: "Invalid descriptor: " + err.Error(),
+		}
+	}
+
+	// Determine the range of derivation indexes, which must be specified
+	// for ranged descriptors only.
+	var begin, end uint32
+	switch {
+	case desc.IsRange() && c.Range == nil:
+		return nil, &btcjson.RPCError{
+			Code:    btcjson.ErrRPCInvalidParameter,
+			Message: "Range must be specified for a ranged descriptor",
+		}
+
+	case !desc.IsRange() && c.Range != nil:
+		return nil, &btcjson.RPCError{
+			Code:    btcjson.ErrRPCInvalidParameter,
+			Message: "Range should not be specified for an un-ranged descriptor",
+		}
+
+	case c.Range != nil:
+		begin, end, err = parseDescriptorRange(c.Range)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	addresses := make(btcjson.DeriveAddressesResult, 0, end-begin+1)
+	for i := uint64(begin); i <= uint64(end); i++ {
+		addr, err := desc.Address(uint32(i))
+		if err != nil {
+			context := "Failed to derive address"
+			return nil, req.internalError(err.Error(), context)
+		}
+		addresses = append(addresses, addr.EncodeAddress())
+	}
+	return addresses, nil
+}
+
 // handleEstimateFee handles estimatefee commands.
-func handleEstimateFee(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
+func handleEstimateFee(s *rpcServer, cmd interface{}, req *rpcRequest) (interface{}, error) {
 	c := cmd.(*btcjson.EstimateFeeCmd)
 
 	if s.cfg.FeeEstimator == nil {
@@ -883,7 +1025,7 @@ func handleEstimateFee(s *rpcServer, cmd interface{}, closeChan <-chan struct{})
 }
 
 // handleGenerate handles generate commands.
-func handleGenerate(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
+func handleGenerate(s *rpcServer, cmd interface{}, req *rpcRequest) (interface{}, error) {
 	// Respond with an error if there are no addresses to pay the
 	// created blocks to.
 	if len(cfg.miningAddrs) == 0 {
@@ -937,7 +1079,7 @@ func handleGenerate(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (i
 }
 
 // handleGetAddedNodeInfo handles getaddednodeinfo commands.
-func handleGetAddedNodeInfo(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
+func handleGetAddedNodeInfo(s *rpcServer, cmd interface{}, req *rpcRequest) (interface{}, error) {
 	c := cmd.(*btcjson.GetAddedNodeInfoCmd)
 
 	// Retrieve a list of persistent (added) peers from the server and
@@ -1026,8 +1168,187 @@ func handleGetAddedNodeInfo(s *rpcServer, cmd interface{}, closeChan <-chan stru
 	return results, nil
 }
 
+// decodeAddrUtxoIndexAddrs ensures the address utxo index is enabled and
+// decodes the passed addresses for use with it.
+func decodeAddrUtxoIndexAddrs(s *rpcServer, addrStrs []string) ([]btcutil.Address, error) {
+	// Respond with an error if the address utxo index is not enabled.
+	if s.cfg.AddrUtxoIndex == nil {
+		return nil, &btcjson.RPCError{
+			Code:    btcjson.ErrRPCMisc,
+			Message: "Address utxo index must be enabled (--addrutxoindex)",
+		}
+	}
+
+	addrs := make([]btcutil.Address, 0, len(addrStrs))
+	for _, addrStr := range addrStrs {
+		addr, err := btcutil.DecodeAddress(addrStr, s.cfg.ChainParams)
+		if err != nil {
+			return nil, &btcjson.RPCError{
+				Code:    btcjson.ErrRPCInvalidAddressOrKey,
+				Message: "Invalid address or key: " + err.Error(),
+			}
+		}
+		addrs = append(addrs, addr)
+	}
+	return addrs, nil
+}
+
+// handleGetAddressBalance implements the getaddressbalance command.
+func handleGetAddressBalance(s *rpcServer, cmd interface{}, req *rpcRequest) (interface{}, error) {
+	c := cmd.(*btcjson.GetAddressBalanceCmd)
+	addrs, err := decodeAddrUtxoIndexAddrs(s, c.Addresses)
+	if err != nil {
+		return nil, err
+	}
+
+	var result btcjson.GetAddressBalanceResult
+	for _, addr := range addrs {
+		balance, err := s.cfg.AddrUtxoIndex.BalanceForAddress(addr)
+		if err != nil {
+			context := "Failed to load address balance"
+			return nil, req.internalError(err.Error(), context)
+		}
+		result.Balance += balance.Balance
+		result.Received += balance.Received
+
+		for _, delta := range s.cfg.AddrUtxoIndex.UnconfirmedDeltasForAddress(addr) {
+			result.Unconfirmed += delta.Amount
+		}
+	}
+	return &result, nil
+}
+
+// handleGetAddressDeltas implements the getaddressdeltas command.
+func handleGetAddressDeltas(s *rpcServer, cmd interface{}, req *rpcRequest) (interface{}, error) {
+	c := cmd.(*btcjson.GetAddressDeltasCmd)
+	addrs, err := decodeAddrUtxoIndexAddrs(s, c.Addresses)
+	if err != nil {
+		return nil, err
+	}
+
+	// Default to the entire main chain when no range is specified.
+	start := int32(0)
+	if c.Start != nil {
+		start = *c.Start
+	}
+	end := s.cfg.Chain.BestSnapshot().Height
+	if c.End != nil {
+		end = *c.End
+	}
+	if start < 0 || end < start {
+		return nil, &btcjson.RPCError{
+			Code: btcjson.ErrRPCInvalidParameter,
+			Message: fmt.Sprintf("Invalid height range %d-%d", start,
+				end),
+		}
+	}
+
+	results := make([]btcjson.GetAddressDeltasResult, 0)
+	for _, addr := range addrs {
+		deltas, err := s.cfg.AddrUtxoIndex.DeltasForAddress(addr, start,
+			end)
+		if err != nil {
+			context := "Failed to load address deltas"
+			return nil, req.internalError(err.Error(), context)
+		}
+
+		encodedAddr := addr.EncodeAddress()
+		for _, delta := range deltas {
+			results = append(results, btcjson.GetAddressDeltasResult{
+				Satoshis:   delta.Amount,
+				TxID:       delta.TxHash.String(),
+				Index:      delta.Index,
+				BlockIndex: delta.BlockIndex,
+				Height:     delta.Height,
+				Address:    encodedAddr,
+			})
+		}
+	}
+
+	// Order the results from all addresses by their position in the chain.
+	sort.SliceStable(results, func(i, j int) bool {
+		if results[i].Height != results[j].Height {
+			return results[i].Height < results[j].Height
+		}
+		return results[i].BlockIndex < results[j].BlockIndex
+	})
+	return results, nil
+}
+
+// handleGetAddressMempool implements the getaddressmempool command.
+func handleGetAddressMempool(s *rpcServer, cmd interface{}, req *rpcRequest) (interface{}, error) {
+	c := cmd.(*btcjson.GetAddressMempoolCmd)
+	addrs, err := decodeAddrUtxoIndexAddrs(s, c.Addresses)
+	if err != nil {
+		return nil, err
+	}
+
+	results := make([]btcjson.GetAddressMempoolResult, 0)
+	for _, addr := range addrs {
+		encodedAddr := addr.EncodeAddress()
+		for _, delta := range s.cfg.AddrUtxoIndex.UnconfirmedDeltasForAddress(addr) {
+			result := btcjson.GetAddressMempoolResult{
+				Address:   encodedAddr,
+				TxID:      delta.TxHash.String(),
+				Index:     delta.Index,
+				Satoshis:  delta.Amount,
+				Timestamp: delta.Time.Unix(),
+			}
+			if delta.PrevOut != nil {
+				prevOutIndex := delta.PrevOut.Index
+				result.PrevTxID = delta.PrevOut.Hash.String()
+				result.PrevOut = &prevOutIndex
+			}
+			results = append(results, result)
+		}
+	}
+
+	// Order the results from all addresses by the time they were added.
+	sort.SliceStable(results, func(i, j int) bool {
+		return results[i].Timestamp < results[j].Timestamp
+	})
+	return results, nil
+}
+
+// handleGetAddressUtxos implements the getaddressutxos command.
+func handleGetAddressUtxos(s *rpcServer, cmd interface{}, req *rpcRequest) (interface{}, error) {
+	c := cmd.(*btcjson.GetAddressUtxosCmd)
+	addrs, err := decodeAddrUtxoIndexAddrs(s, c.Addresses)
+	if err != nil {
+		return nil, err
+	}
+
+	results := make([]btcjson.GetAddressUtxosResult, 0)
+	for _, addr := range addrs {
+		utxos, err := s.cfg.AddrUtxoIndex.UtxosForAddress(addr)
+		if err != nil {
+			context := "Failed to load address utxos"
+			return nil, req.internalError(err.Error(), context)
+		}
+
+		encodedAddr := addr.EncodeAddress()
+		for _, utxo := range utxos {
+			results = append(results, btcjson.GetAddressUtxosResult{
+				Address:     encodedAddr,
+				TxID:        utxo.OutPoint.Hash.String(),
+				OutputIndex: utxo.OutPoint.Index,
+				Script:      hex.EncodeToString(utxo.PkScript),
+				Satoshis:    utxo.Amount,
+				Height:      utxo.Height,
+			})
+		}
+	}
+
+	// Order the results from all addresses by the height of the block
+	// that created them.
+	sort.SliceStable(results, func(i, j int) bool {
+		return results[i].Height < results[j].Height
+	})
+	return results, nil
+}
+
 // handleGetBestBlock implements the getbestblock command.
-func handleGetBestBlock(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
+func handleGetBestBlock(s *rpcServer, cmd interface{}, req *rpcRequest) (interface{}, error) {
 	// All other "get block" commands give either the height, the
 	// hash, or both but require the block SHA.  This gets both for
 	// the best block.
@@ -1040,7 +1361,7 @@ func handleGetBestBlock(s *rpcServer, cmd interface{}, closeChan <-chan struct{}
 }
 
 // handleGetBestBlockHash implements the getbestblockhash command.
-func handleGetBestBlockHash(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
+func handleGetBestBlockHash(s *rpcServer, cmd interface{}, req *rpcRequest) (interface{}, error) {
 	best := s.cfg.Chain.BestSnapshot()
 	return best.Hash.String(), nil
 }
@@ -1066,7 +1387,7 @@ func getDifficultyRatio(bits uint32, params *chaincfg.Params) float64 {
 }
 
 // handleGetBlock implements the getblock command.
-func handleGetBlock(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
+func handleGetBlock(s *rpcServer, cmd interface{}, req *rpcRequest) (interface{}, error) {
 	c := cmd.(*btcjson.GetBlockCmd)
 
 	// Load the raw block bytes from the database.
@@ -1097,14 +1418,14 @@ func handleGetBlock(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (i
 	blk, err := btcutil.NewBlockFromBytes(blkBytes)
 	if err != nil {
 		context := "Failed to deserialize block"
-		return nil, internalRPCError(err.Error(), context)
+		return nil, req.internalError(err.Error(), context)
 	}
 
 	// Get the block height from chain.
 	blockHeight, err := s.cfg.Chain.BlockHeightByHash(hash)
 	if err != nil {
 		context := "Failed to obtain block height"
-		return nil, internalRPCError(err.Error(), context)
+		return nil, req.internalError(err.Error(), context)
 	}
 	blk.SetHeight(blockHeight)
 	best := s.cfg.Chain.BestSnapshot()
@@ -1115,7 +1436,7 @@ func handleGetBlock(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (i
 		nextHash, err := s.cfg.Chain.BlockHashByHeight(blockHeight + 1)
 		if err != nil {
 			context := "No next block"
-			return nil, internalRPCError(err.Error(), context)
+			return nil, req.internalError(err.Error(), context)
 		}
 		nextHashString = nextHash.String()
 	}
@@ -1186,12 +1507,16 @@ func softForkStatus(state blockchain.ThresholdState) (string, error) {
 }
 
 // handleGetBlockChainInfo implements the getblockchaininfo command.
-func handleGetBlockChainInfo(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
+func handleGetBlockChainInfo(s *rpcServer, cmd interface{}, req *rpcRequest) (interface{}, error) {
 	// Obtain a snapshot of the current best known blockchain state. We'll
 	// populate the response to this call primarily from this snapshot.
 	params := s.cfg.ChainParams
 	chain := s.cfg.Chain
 	chainSnapshot := chain.BestSnapshot()
+	chainWork, err := chain.ChainWork(&chainSnapshot.Hash)
+	if err != nil {
+		return nil, req.internalError(err.Error(), "Unable to get chain work")
+	}
 
 	chainInfo := &btcjson.GetBlockChainInfoResult{
 		Chain:         params.Name,
@@ -1200,6 +1525,7 @@ func handleGetBlockChainInfo(s *rpcServer, cmd interface{}, closeChan <-chan str
 		BestBlockHash: chainSnapshot.Hash.String(),
 		Difficulty:    getDifficultyRatio(chainSnapshot.Bits, params),
 		MedianTime:    chainSnapshot.MedianTime.Unix(),
+		ChainWork:     fmt.Sprintf("%064x", chainWork),
 		Pruned:        false,
 		SoftForks: &btcjson.SoftForks{
 			Bip9SoftForks: make(map[string]*btcjson.Bip9SoftForkDescription),
@@ -1272,7 +1598,7 @@ func handleGetBlockChainInfo(s *rpcServer, cmd interface{}, closeChan <-chan str
 		deploymentStatus, err := chain.ThresholdState(uint32(deployment))
 		if err != nil {
 			context := "Failed to obtain deployment status"
-			return nil, internalRPCError(err.Error(), context)
+			return nil, req.internalError(err.Error(), context)
 		}
 
 		// Attempt to convert the current deployment status into a
@@ -1301,13 +1627,13 @@ func handleGetBlockChainInfo(s *rpcServer, cmd interface{}, closeChan <-chan str
 }
 
 // handleGetBlockCount implements the getblockcount command.
-func handleGetBlockCount(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
+func handleGetBlockCount(s *rpcServer, cmd interface{}, req *rpcRequest) (interface{}, error) {
 	best := s.cfg.Chain.BestSnapshot()
 	return int64(best.Height), nil
 }
 
 // handleGetBlockHash implements the getblockhash command.
-func handleGetBlockHash(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
+func handleGetBlockHash(s *rpcServer, cmd interface{}, req *rpcRequest) (interface{}, error) {
 	c := cmd.(*btcjson.GetBlockHashCmd)
 	hash, err := s.cfg.Chain.BlockHashByHeight(int32(c.Index))
 	if err != nil {
@@ -1321,7 +1647,7 @@ func handleGetBlockHash(s *rpcServer, cmd interface{}, closeChan <-chan struct{}
 }
 
 // handleGetBlockHeader implements the getblockheader command.
-func handleGetBlockHeader(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
+func handleGetBlockHeader(s *rpcServer, cmd interface{}, req *rpcRequest) (interface{}, error) {
 	c := cmd.(*btcjson.GetBlockHeaderCmd)
 
 	// Fetch the header from chain.
@@ -1344,7 +1670,7 @@ func handleGetBlockHeader(s *rpcServer, cmd interface{}, closeChan <-chan struct
 		err := blockHeader.Serialize(&headerBuf)
 		if err != nil {
 			context := "Failed to serialize block header"
-			return nil, internalRPCError(err.Error(), context)
+			return nil, req.internalError(err.Error(), context)
 		}
 		return hex.EncodeToString(headerBuf.Bytes()), nil
 	}
@@ -1355,7 +1681,7 @@ func handleGetBlockHeader(s *rpcServer, cmd interface{}, closeChan <-chan struct
 	blockHeight, err := s.cfg.Chain.BlockHeightByHash(hash)
 	if err != nil {
 		context := "Failed to obtain block height"
-		return nil, internalRPCError(err.Error(), context)
+		return nil, req.internalError(err.Error(), context)
 	}
 	best := s.cfg.Chain.BestSnapshot()
 
@@ -1365,7 +1691,7 @@ func handleGetBlockHeader(s *rpcServer, cmd interface{}, closeChan <-chan struct
 		nextHash, err := s.cfg.Chain.BlockHashByHeight(blockHeight + 1)
 		if err != nil {
 			context := "No next block"
-			return nil, internalRPCError(err.Error(), context)
+			return nil, req.internalError(err.Error(), context)
 		}
 		nextHashString = nextHash.String()
 	}
@@ -1388,6 +1714,194 @@ func handleGetBlockHeader(s *rpcServer, cmd interface{}, closeChan <-chan struct
 	return blockHeaderReply, nil
 }
 
+// blockStatsIndexEnabledError is the error returned by the block stats
+// commands when the block stats index is not enabled.
+var blockStatsIndexEnabledError = &btcjson.RPCError{
+	Code:    btcjson.ErrRPCMisc,
+	Message: "Block stats index must be enabled (--blockstatsindex)",
+}
+
+// createBlockStatsResult converts the passed block stats from the block stats
+// index to the result of the getblockstats command.  When the passed selected
+// stats are not nil, only the selected stats are included in the returned
+// result.
+func createBlockStatsResult(stats *indexers.BlockStats, selected []string, req *rpcRequest) (interface{}, error) {
+	result := &btcjson.GetBlockStatsResult{
+		AverageFee:         stats.AverageFee,
+		AverageFeeRate:     stats.AverageFeeRate,
+		AverageTxSize:      stats.AverageTxSize,
+		FeeratePercentiles: stats.FeeRatePercentiles[:],
+		Hash:               stats.Hash.String(),
+		Height:             int64(stats.Height),
+		Ins:                stats.Ins,
+		MaxFee:             stats.MaxFee,
+		MaxFeeRate:         stats.MaxFeeRate,
+		MaxTxSize:          stats.MaxTxSize,
+		MedianFee:          stats.MedianFee,
+		MedianTime:         stats.MedianTime,
+		MedianTxSize:       stats.MedianTxSize,
+		MinFee:             stats.MinFee,
+		MinFeeRate:         stats.MinFeeRate,
+		MinTxSize:          stats.MinTxSize,
+		Outs:               stats.Outs,
+		SegWitTotalSize:    stats.SegWitTotalSize,
+		SegWitTotalWeight:  stats.SegWitTotalWeight,
+		SegWitTxs:          stats.SegWitTxs,
+		Subsidy:            stats.Subsidy,
+		Time:               stats.Time,
+		TotalFee:           stats.TotalFee,
+		TotalOut:           stats.TotalOut,
+		TotalSize:          stats.TotalSize,
+		TotalWeight:        stats.TotalWeight,
+		Txs:                stats.Txs,
+		UTXOIncrease:       stats.UTXOIncrease,
+		UTXOSizeIncrease:   stats.UTXOSizeIncrease,
+	}
+	if selected == nil {
+		return result, nil
+	}
+
+	// Select the requested stats by their JSON field names.
+	marshalled, err := json.Marshal(result)
+	if err != nil {
+		context := "Failed to marshal block stats"
+		return nil, req.internalError(err.Error(), context)
+	}
+	var allStats map[string]json.RawMessage
+	if err := json.Unmarshal(marshalled, &allStats); err != nil {
+		context := "Failed to unmarshal block stats"
+		return nil, req.internalError(err.Error(), context)
+	}
+	selectedStats := make(map[string]json.RawMessage, len(selected))
+	for _, name := range selected {
+		stat, ok := allStats[name]
+		if !ok {
+			return nil, &btcjson.RPCError{
+				Code: btcjson.ErrRPCInvalidParameter,
+				Message: fmt.Sprintf("Invalid selected statistic %s",
+					name),
+			}
+		}
+		selectedStats[name] = stat
+	}
+	return selectedStats, nil
+}
+
+// handleGetBlockStats implements the getblockstats command.
+func handleGetBlockStats(s *rpcServer, cmd interface{}, req *rpcRequest) (interface{}, error) {
+	// Respond with an error if the block stats index is not enabled.
+	if s.cfg.BlockStatsIndex == nil {
+		return nil, blockStatsIndexEnabledError
+	}
+
+	c := cmd.(*btcjson.GetBlockStatsCmd)
+
+	// Determine the height of the requested block in the main chain.
+	var height int32
+	var hash *chainhash.Hash
+	switch hashOrHeight := c.HashOrHeight.Value.(type) {
+	case int:
+		best := s.cfg.Chain.BestSnapshot()
+		if hashOrHeight < 0 || hashOrHeight > int(best.Height) {
+			return nil, &btcjson.RPCError{
+				Code: btcjson.ErrRPCInvalidParameter,
+				Message: fmt.Sprintf("Target block height %d "+
+					"out of range [0, %d]", hashOrHeight,
+					best.Height),
+			}
+		}
+		height = int32(hashOrHeight)
+
+	case string:
+		var err error
+		hash, err = chainhash.NewHashFromStr(hashOrHeight)
+		if err != nil {
+			return nil, rpcDecodeHexError(hashOrHeight)
+		}
+		height, err = s.cfg.Chain.BlockHeightByHash(hash)
+		if err != nil {
+			return nil, &btcjson.RPCError{
+				Code:    btcjson.ErrRPCBlockNotFound,
+				Message: "Block not found",
+			}
+		}
+
+	default:
+		return nil, &btcjson.RPCError{
+			Code:    btcjson.ErrRPCInvalidParameter,
+			Message: "Invalid hash_or_height parameter",
+		}
+	}
+
+	stats, err := s.cfg.BlockStatsIndex.StatsForHeight(height)
+	if err != nil {
+		context := "Failed to load block stats index entry"
+		return nil, req.internalError(err.Error(), context)
+	}
+	if stats == nil || (hash != nil && stats.Hash != *hash) {
+		return nil, &btcjson.RPCError{
+			Code: btcjson.ErrRPCMisc,
+			Message: fmt.Sprintf("Block stats index has no entry "+
+				"for height %d", height),
+		}
+	}
+
+	var selected []string
+	if c.Stats != nil {
+		selected = *c.Stats
+	}
+	return createBlockStatsResult(stats, selected, req)
+}
+
+// maxBlockStatsRange is the maximum number of heights getblockstatsrange
+// returns statistics for in one call.  Clients paginate over larger ranges.
+const maxBlockStatsRange = 1000
+
+// handleGetBlockStatsRange implements the getblockstatsrange command.
+func handleGetBlockStatsRange(s *rpcServer, cmd interface{}, req *rpcRequest) (interface{}, error) {
+	// Respond with an error if the block stats index is not enabled.
+	if s.cfg.BlockStatsIndex == nil {
+		return nil, blockStatsIndexEnabledError
+	}
+
+	c := cmd.(*btcjson.GetBlockStatsRangeCmd)
+	if c.StartHeight < 0 || c.EndHeight < c.StartHeight {
+		return nil, &btcjson.RPCError{
+			Code: btcjson.ErrRPCInvalidParameter,
+			Message: fmt.Sprintf("Invalid height range [%d, %d]",
+				c.StartHeight, c.EndHeight),
+		}
+	}
+	if int64(c.EndHeight)-int64(c.StartHeight) >= maxBlockStatsRange {
+		return nil, &btcjson.RPCError{
+			Code: btcjson.ErrRPCInvalidParameter,
+			Message: fmt.Sprintf("Height range is too large "+
+				"(max: %d heights)", maxBlockStatsRange),
+		}
+	}
+
+	stats, err := s.cfg.BlockStatsIndex.StatsForHeightRange(c.StartHeight,
+		c.EndHeight)
+	if err != nil {
+		context := "Failed to load block stats index entries"
+		return nil, req.internalError(err.Error(), context)
+	}
+
+	var selected []string
+	if c.Stats != nil {
+		selected = *c.Stats
+	}
+	results := make([]interface{}, 0, len(stats))
+	for _, blockStats := range stats {
+		result, err := createBlockStatsResult(blockStats, selected, req)
+		if err != nil {
+			return nil, err
+		}
+		results = append(results, result)
+	}
+	return results, nil
+}
+
 // encodeTemplateID encodes the passed details into an ID that can be used to
 // uniquely identify a block template.
 func encodeTemplateID(prevHash *chainhash.Hash, lastGenerated time.Time) string {
@@ -1540,7 +2054,7 @@ func (state *gbtWorkState) templateUpdateChan(prevHash *chainhash.Hash, lastGene
 // addresses.
 //
 // This function MUST be called with the state locked.
-func (state *gbtWorkState) updateBlockTemplate(s *rpcServer, useCoinbaseValue bool) error {
+func (state *gbtWorkState) updateBlockTemplate(s *rpcServer, useCoinbaseValue bool, req *rpcRequest) error {
 	generator := s.cfg.Generator
 	lastTxUpdate := generator.TxSource().LastUpdated()
 	if lastTxUpdate.IsZero() {
@@ -1581,7 +2095,7 @@ func (state *gbtWorkState) updateBlockTemplate(s *rpcServer, useCoinbaseValue bo
 		// appropriate address(es).
 		blkTemplate, err := generator.NewBlockTemplate(payAddr)
 		if err != nil {
-			return internalRPCError("Failed to create new block "+
+			return req.internalError("Failed to create new block "+
 				"template: "+err.Error(), "")
 		}
 		template = blkTemplate
@@ -1603,7 +2117,7 @@ func (state *gbtWorkState) updateBlockTemplate(s *rpcServer, useCoinbaseValue bo
 		state.prevHash = latestHash
 		state.minTimestamp = minTimestamp
 
-		rpcsLog.Debugf("Generated block template (timestamp %v, "+
+		req.log.Debugf("Generated block template (timestamp %v, "+
 			"target %s, merkle root %s)",
 			msgBlock.Header.Timestamp, targetDifficulty,
 			msgBlock.Header.MerkleRoot)
@@ -1633,7 +2147,7 @@ func (state *gbtWorkState) updateBlockTemplate(s *rpcServer, useCoinbaseValue bo
 			pkScript, err := txscript.PayToAddrScript(payToAddr)
 			if err != nil {
 				context := "Failed to create pay-to-addr script"
-				return internalRPCError(err.Error(), context)
+				return req.internalError(err.Error(), context)
 			}
 			template.Block.Transactions[0].TxOut[0].PkScript = pkScript
 			template.ValidPayAddress = true
@@ -1655,7 +2169,7 @@ func (state *gbtWorkState) updateBlockTemplate(s *rpcServer, useCoinbaseValue bo
 		generator.UpdateBlockTime(msgBlock)
 		msgBlock.Header.Nonce = 0
 
-		rpcsLog.Debugf("Updated block template (timestamp %v, "+
+		req.log.Debugf("Updated block template (timestamp %v, "+
 			"target %s)", msgBlock.Header.Timestamp,
 			targetDifficulty)
 	}
@@ -1668,7 +2182,7 @@ func (state *gbtWorkState) updateBlockTemplate(s *rpcServer, useCoinbaseValue bo
 // and returned to the caller.
 //
 // This function MUST be called with the state locked.
-func (state *gbtWorkState) blockTemplateResult(useCoinbaseValue bool, submitOld *bool) (*btcjson.GetBlockTemplateResult, error) {
+func (state *gbtWorkState) blockTemplateResult(useCoinbaseValue bool, submitOld *bool, req *rpcRequest) (*btcjson.GetBlockTemplateResult, error) {
 	// Ensure the timestamps are still in valid range for the template.
 	// This should really only ever happen if the local clock is changed
 	// after the template is generated, but it's important to avoid serving
@@ -1724,7 +2238,7 @@ func (state *gbtWorkState) blockTemplateResult(useCoinbaseValue bool, submitOld
 		txBuf := bytes.NewBuffer(make([]byte, 0, tx.SerializeSize()))
 		if err := tx.Serialize(txBuf); err != nil {
 			context := "Failed to serialize transaction"
-			return nil, internalRPCError(err.Error(), context)
+			return nil, req.internalError(err.Error(), context)
 		}
 
 		bTx := btcutil.NewTx(tx)
@@ -1792,7 +2306,7 @@ func (state *gbtWorkState) blockTemplateResult(useCoinbaseValue bool, submitOld
 		txBuf := bytes.NewBuffer(make([]byte, 0, tx.SerializeSize()))
 		if err := tx.Serialize(txBuf); err != nil {
 			context := "Failed to serialize transaction"
-			return nil, internalRPCError(err.Error(), context)
+			return nil, req.internalError(err.Error(), context)
 		}
 
 		resultTx := btcjson.GetBlockTemplateResultTx{
@@ -1819,14 +2333,14 @@ func (state *gbtWorkState) blockTemplateResult(useCoinbaseValue bool, submitOld
 // has passed without finding a solution.
 //
 // See https://en.bitcoin.it/wiki/BIP_0022 for more details.
-func handleGetBlockTemplateLongPoll(s *rpcServer, longPollID string, useCoinbaseValue bool, closeChan <-chan struct{}) (interface{}, error) {
+func handleGetBlockTemplateLongPoll(s *rpcServer, longPollID string, useCoinbaseValue bool, req *rpcRequest) (interface{}, error) {
 	state := s.gbtWorkState
 	state.Lock()
 	// The state unlock is intentionally not deferred here since it needs to
 	// be manually unlocked before waiting for a notification about block
 	// template changes.
 
-	if err := state.updateBlockTemplate(s, useCoinbaseValue); err != nil {
+	if err := state.updateBlockTemplate(s, useCoinbaseValue, req); err != nil {
 		state.Unlock()
 		return nil, err
 	}
@@ -1835,7 +2349,7 @@ func handleGetBlockTemplateLongPoll(s *rpcServer, longPollID string, useCoinbase
 	// the caller is invalid.
 	prevHash, lastGenerated, err := decodeTemplateID(longPollID)
 	if err != nil {
-		result, err := state.blockTemplateResult(useCoinbaseValue, nil)
+		result, err := state.blockTemplateResult(useCoinbaseValue, nil, req)
 		if err != nil {
 			state.Unlock()
 			return nil, err
@@ -1857,7 +2371,7 @@ func handleGetBlockTemplateLongPoll(s *rpcServer, longPollID string, useCoinbase
 		// already been found and added to the block chain.
 		submitOld := prevHash.IsEqual(prevTemplateHash)
 		result, err := state.blockTemplateResult(useCoinbaseValue,
-			&submitOld)
+			&submitOld, req)
 		if err != nil {
 			state.Unlock()
 			return nil, err
@@ -1877,7 +2391,7 @@ func handleGetBlockTemplateLongPoll(s *rpcServer, longPollID string, useCoinbase
 	select {
 	// When the client closes before it's time to send a reply, just return
 	// now so the goroutine doesn't hang around.
-	case <-closeChan:
+	case <-req.closeChan:
 		return nil, ErrClientQuit
 
 	// Wait until signal received to send the reply.
@@ -1889,7 +2403,7 @@ func handleGetBlockTemplateLongPoll(s *rpcServer, longPollID string, useCoinbase
 	state.Lock()
 	defer state.Unlock()
 
-	if err := state.updateBlockTemplate(s, useCoinbaseValue); err != nil {
+	if err := state.updateBlockTemplate(s, useCoinbaseValue, req); err != nil {
 		return nil, err
 	}
 
@@ -1897,7 +2411,7 @@ func handleGetBlockTemplateLongPoll(s *rpcServer, longPollID string, useCoinbase
 	// block template depending on whether or not a solution has already
 	// been found and added to the block chain.
 	submitOld := prevHash.IsEqual(&state.template.Block.Header.PrevBlock)
-	result, err := state.blockTemplateResult(useCoinbaseValue, &submitOld)
+	result, err := state.blockTemplateResult(useCoinbaseValue, &submitOld, req)
 	if err != nil {
 		return nil, err
 	}
@@ -1912,7 +2426,7 @@ func handleGetBlockTemplateLongPoll(s *rpcServer, longPollID string, useCoinbase
 // in regards to whether or not it supports creating its own coinbase (the
 // coinbasetxn and coinbasevalue capabilities) and modifies the returned block
 // template accordingly.
-func handleGetBlockTemplateRequest(s *rpcServer, request *btcjson.TemplateRequest, closeChan <-chan struct{}) (interface{}, error) {
+func handleGetBlockTemplateRequest(s *rpcServer, request *btcjson.TemplateRequest, req *rpcRequest) (interface{}, error) {
 	// Extract the relevant passed capabilities and restrict the result to
 	// either a coinbase value or a coinbase transaction object depending on
 	// the request.  Default to only providing a coinbase value.
@@ -1971,7 +2485,7 @@ func handleGetBlockTemplateRequest(s *rpcServer, request *btcjson.TemplateReques
 	// be replaced with a new one.
 	if request != nil && request.LongPollID != "" {
 		return handleGetBlockTemplateLongPoll(s, request.LongPollID,
-			useCoinbaseValue, closeChan)
+			useCoinbaseValue, req)
 	}
 
 	// Protect concurrent access when updating block templates.
@@ -1985,10 +2499,10 @@ func handleGetBlockTemplateRequest(s *rpcServer, request *btcjson.TemplateReques
 	// seconds since the last template was generated.  Otherwise, the
 	// timestamp for the existing block template is updated (and possibly
 	// the difficulty on testnet per the consesus rules).
-	if err := state.updateBlockTemplate(s, useCoinbaseValue); err != nil {
+	if err := state.updateBlockTemplate(s, useCoinbaseValue, req); err != nil {
 		return nil, err
 	}
-	return state.blockTemplateResult(useCoinbaseValue, nil)
+	return state.blockTemplateResult(useCoinbaseValue, nil, req)
 }
 
 // chainErrToGBTErrString converts an error returned from btcchain to a string
@@ -2098,7 +2612,7 @@ func chainErrToGBTErrString(err error) string {
 // deals with block proposals.
 //
 // See https://en.bitcoin.it/wiki/BIP_0023 for more details.
-func handleGetBlockTemplateProposal(s *rpcServer, request *btcjson.TemplateRequest) (interface{}, error) {
+func handleGetBlockTemplateProposal(s *rpcServer, request *btcjson.TemplateRequest, req *rpcRequest) (interface{}, error) {
 	hexData := request.Data
 	if hexData == "" {
 		return false, &btcjson.RPCError{
@@ -2140,14 +2654,15 @@ func handleGetBlockTemplateProposal(s *rpcServer, request *btcjson.TemplateReque
 	if err := s.cfg.Chain.CheckConnectBlockTemplate(block); err != nil {
 		if _, ok := err.(blockchain.RuleError); !ok {
 			errStr := fmt.Sprintf("Failed to process block proposal: %v", err)
-			rpcsLog.Error(errStr)
+			req.log.Error(errStr)
 			return nil, &btcjson.RPCError{
 				Code:    btcjson.ErrRPCVerify,
 				Message: errStr,
 			}
 		}
 
-		rpcsLog.Infof("Rejected block proposal: %v", err)
+		req.log.withFields(logFieldBlock, block.Hash().String()).Infof(
+			"Rejected block proposal: %v", err)
 		return chainErrToGBTErrString(err), nil
 	}
 
@@ -2158,7 +2673,7 @@ func handleGetBlockTemplateProposal(s *rpcServer, request *btcjson.TemplateReque
 //
 // See https://en.bitcoin.it/wiki/BIP_0022 and
 // https://en.bitcoin.it/wiki/BIP_0023 for more details.
-func handleGetBlockTemplate(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
+func handleGetBlockTemplate(s *rpcServer, cmd interface{}, req *rpcRequest) (interface{}, error) {
 	c := cmd.(*btcjson.GetBlockTemplateCmd)
 	request := c.Request
 
@@ -2170,9 +2685,9 @@ func handleGetBlockTemplate(s *rpcServer, cmd interface{}, closeChan <-chan stru
 
 	switch mode {
 	case "template":
-		return handleGetBlockTemplateRequest(s, request, closeChan)
+		return handleGetBlockTemplateRequest(s, request, req)
 	case "proposal":
-		return handleGetBlockTemplateProposal(s, request)
+		return handleGetBlockTemplateProposal(s, request, req)
 	}
 
 	return nil, &btcjson.RPCError{
@@ -2182,7 +2697,7 @@ func handleGetBlockTemplate(s *rpcServer, cmd interface{}, closeChan <-chan stru
 }
 
 // handleGetCFilter implements the getcfilter command.
-func handleGetCFilter(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
+func handleGetCFilter(s *rpcServer, cmd interface{}, req *rpcRequest) (interface{}, error) {
 	if s.cfg.CfIndex == nil {
 		return nil, &btcjson.RPCError{
 			Code:    btcjson.ErrRPCNoCFIndex,
@@ -2198,7 +2713,7 @@ func handleGetCFilter(s *rpcServer, cmd interface{}, closeChan <-chan struct{})
 
 	filterBytes, err := s.cfg.CfIndex.FilterByBlockHash(hash, c.FilterType)
 	if err != nil {
-		rpcsLog.Debugf("Could not find committed filter for %v: %v",
+		req.log.Debugf("Could not find committed filter for %v: %v",
 			hash, err)
 		return nil, &btcjson.RPCError{
 			Code:    btcjson.ErrRPCBlockNotFound,
@@ -2206,12 +2721,12 @@ func handleGetCFilter(s *rpcServer, cmd interface{}, closeChan <-chan struct{})
 		}
 	}
 
-	rpcsLog.Debugf("Found committed filter for %v", hash)
+	req.log.Debugf("Found committed filter for %v", hash)
 	return hex.EncodeToString(filterBytes), nil
 }
 
 // handleGetCFilterHeader implements the getcfilterheader command.
-func handleGetCFilterHeader(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
+func handleGetCFilterHeader(s *rpcServer, cmd interface{}, req *rpcRequest) (interface{}, error) {
 	if s.cfg.CfIndex == nil {
 		return nil, &btcjson.RPCError{
 			Code:    btcjson.ErrRPCNoCFIndex,
@@ -2227,9 +2742,9 @@ func handleGetCFilterHeader(s *rpcServer, cmd interface{}, closeChan <-chan stru
 
 	headerBytes, err := s.cfg.CfIndex.FilterHeaderByBlockHash(hash, c.FilterType)
 	if len(headerBytes) > 0 {
-		rpcsLog.Debugf("Found header of committed filter for %v", hash)
+		req.log.Debugf("Found header of committed filter for %v", hash)
 	} else {
-		rpcsLog.Debugf("Could not find header of committed filter for %v: %v",
+		req.log.Debugf("Could not find header of committed filter for %v: %v",
 			hash, err)
 		return nil, &btcjson.RPCError{
 			Code:    btcjson.ErrRPCBlockNotFound,
@@ -2242,28 +2757,64 @@ func handleGetCFilterHeader(s *rpcServer, cmd interface{}, closeChan <-chan stru
 }
 
 // handleGetConnectionCount implements the getconnectioncount command.
-func handleGetConnectionCount(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
+func handleGetConnectionCount(s *rpcServer, cmd interface{}, req *rpcRequest) (interface{}, error) {
 	return s.cfg.ConnMgr.ConnectedCount(), nil
 }
 
 // handleGetCurrentNet implements the getcurrentnet command.
-func handleGetCurrentNet(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
+func handleGetCurrentNet(s *rpcServer, cmd interface{}, req *rpcRequest) (interface{}, error) {
 	return s.cfg.ChainParams.Net, nil
 }
 
+// handleGetDescriptorInfo implements the getdescriptorinfo command.
+func handleGetDescriptorInfo(s *rpcServer, cmd interface{}, req *rpcRequest) (interface{}, error) {
+	c := cmd.(*btcjson.GetDescriptorInfoCmd)
+
+	desc, err := descriptor.Parse(c.Descriptor, s.cfg.ChainParams)
+	if err != nil {
+		return nil, &btcjson.RPCError{
+			Code:    btcjson.ErrRPCInvalidParameter,
+			Message: "Invalid descriptor: " + err.Error(),
+		}
+	}
+
+	// The checksum is computed for the passed descriptor, which may
+	// include private keys, while the returned descriptor is in canonical
+	// form.
+	input := strings.SplitN(c.Descriptor, "#", 2)[0]
+	checksum, err := descriptor.Checksum(input)
+	if err != nil {
+		context := "Failed to compute descriptor checksum"
+		return nil, req.internalError(err.Error(), context)
+	}
+	canonical, err := descriptor.AddChecksum(desc.String())
+	if err != nil {
+		context := "Failed to compute descriptor checksum"
+		return nil, req.internalError(err.Error(), context)
+	}
+
+	return &btcjson.GetDescriptorInfoResult{
+		Descriptor:     canonical,
+		Checksum:       checksum,
+		IsRange:        desc.IsRange(),
+		IsSolvable:     desc.IsSolvable(),
+		HasPrivateKeys: desc.HasPrivateKeys(),
+	}, nil
+}
+
 // handleGetDifficulty implements the getdifficulty command.
-func handleGetDifficulty(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
+func handleGetDifficulty(s *rpcServer, cmd interface{}, req *rpcRequest) (interface{}, error) {
 	best := s.cfg.Chain.BestSnapshot()
 	return getDifficultyRatio(best.Bits, s.cfg.ChainParams), nil
 }
 
 // handleGetGenerate implements the getgenerate command.
-func handleGetGenerate(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
+func handleGetGenerate(s *rpcServer, cmd interface{}, req *rpcRequest) (interface{}, error) {
 	return s.cfg.CPUMiner.IsMining(), nil
 }
 
 // handleGetHashesPerSec implements the gethashespersec command.
-func handleGetHashesPerSec(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
+func handleGetHashesPerSec(s *rpcServer, cmd interface{}, req *rpcRequest) (interface{}, error) {
 	return int64(s.cfg.CPUMiner.HashesPerSecond()), nil
 }
 
@@ -2271,7 +2822,7 @@ func handleGetHashesPerSec(s *rpcServer, cmd interface{}, closeChan <-chan struc
 //
 // NOTE: This is a btcsuite extension originally ported from
 // github.com/decred/dcrd.
-func handleGetHeaders(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
+func handleGetHeaders(s *rpcServer, cmd interface{}, req *rpcRequest) (interface{}, error) {
 	c := cmd.(*btcjson.GetHeadersCmd)
 
 	// Fetch the requested headers from chain while respecting the provided
@@ -2299,7 +2850,7 @@ func handleGetHeaders(s *rpcServer, cmd interface{}, closeChan <-chan struct{})
 	for i, h := range headers {
 		err := h.Serialize(&buf)
 		if err != nil {
-			return nil, internalRPCError(err.Error(),
+			return nil, req.internalError(err.Error(),
 				"Failed to serialize block header")
 		}
 		hexBlockHeaders[i] = hex.EncodeToString(buf.Bytes())
@@ -2310,7 +2861,7 @@ func handleGetHeaders(s *rpcServer, cmd interface{}, closeChan <-chan struct{})
 
 // handleGetInfo implements the getinfo command. We only return the fields
 // that are not related to wallet functionality.
-func handleGetInfo(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
+func handleGetInfo(s *rpcServer, cmd interface{}, req *rpcRequest) (interface{}, error) {
 	best := s.cfg.Chain.BestSnapshot()
 	ret := &btcjson.InfoChainResult{
 		Version:         int32(1000000*appMajor + 10000*appMinor + 100*appPatch),
@@ -2328,7 +2879,7 @@ func handleGetInfo(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (in
 }
 
 // handleGetMempoolInfo implements the getmempoolinfo command.
-func handleGetMempoolInfo(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
+func handleGetMempoolInfo(s *rpcServer, cmd interface{}, req *rpcRequest) (interface{}, error) {
 	mempoolTxns := s.cfg.TxMemPool.TxDescs()
 
 	var numBytes int64
@@ -2346,12 +2897,12 @@ func handleGetMempoolInfo(s *rpcServer, cmd interface{}, closeChan <-chan struct
 
 // handleGetMiningInfo implements the getmininginfo command. We only return the
 // fields that are not related to wallet functionality.
-func handleGetMiningInfo(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
+func handleGetMiningInfo(s *rpcServer, cmd interface{}, req *rpcRequest) (interface{}, error) {
 	// Create a default getnetworkhashps command to use defaults and make
 	// use of the existing getnetworkhashps handler.
 	gnhpsCmd := btcjson.NewGetNetworkHashPSCmd(nil, nil)
 	networkHashesPerSecIface, err := handleGetNetworkHashPS(s, gnhpsCmd,
-		closeChan)
+		req)
 	if err != nil {
 		return nil, err
 	}
@@ -2381,7 +2932,7 @@ func handleGetMiningInfo(s *rpcServer, cmd interface{}, closeChan <-chan struct{
 }
 
 // handleGetNetTotals implements the getnettotals command.
-func handleGetNetTotals(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
+func handleGetNetTotals(s *rpcServer, cmd interface{}, req *rpcRequest) (interface{}, error) {
 	totalBytesRecv, totalBytesSent := s.cfg.ConnMgr.NetTotals()
 	reply := &btcjson.GetNetTotalsResult{
 		TotalBytesRecv: totalBytesRecv,
@@ -2392,7 +2943,7 @@ func handleGetNetTotals(s *rpcServer, cmd interface{}, closeChan <-chan struct{}
 }
 
 // handleGetNetworkHashPS implements the getnetworkhashps command.
-func handleGetNetworkHashPS(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
+func handleGetNetworkHashPS(s *rpcServer, cmd interface{}, req *rpcRequest) (interface{}, error) {
 	// Note: All valid error return paths should return an int64.
 	// Literal zeros are inferred as int, and won't coerce to int64
 	// because the return value is an interface{}.
@@ -2437,7 +2988,7 @@ func handleGetNetworkHashPS(s *rpcServer, cmd interface{}, closeChan <-chan stru
 	if startHeight < 0 {
 		startHeight = 0
 	}
-	rpcsLog.Debugf("Calculating network hashes per second from %d to %d",
+	req.log.Debugf("Calculating network hashes per second from %d to %d",
 		startHeight, endHeight)
 
 	// Find the min and max block timestamps as well as calculate the total
@@ -2448,14 +2999,14 @@ func handleGetNetworkHashPS(s *rpcServer, cmd interface{}, closeChan <-chan stru
 		hash, err := s.cfg.Chain.BlockHashByHeight(curHeight)
 		if err != nil {
 			context := "Failed to fetch block hash"
-			return nil, internalRPCError(err.Error(), context)
+			return nil, req.internalError(err.Error(), context)
 		}
 
 		// Fetch the header from chain.
 		header, err := s.cfg.Chain.HeaderByHash(hash)
 		if err != nil {
 			context := "Failed to fetch block header"
-			return nil, internalRPCError(err.Error(), context)
+			return nil, req.internalError(err.Error(), context)
 		}
 
 		if curHeight == startHeight {
@@ -2486,7 +3037,7 @@ func handleGetNetworkHashPS(s *rpcServer, cmd interface{}, closeChan <-chan stru
 }
 
 // handleGetNodeAddresses implements the getnodeaddresses command.
-func handleGetNodeAddresses(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
+func handleGetNodeAddresses(s *rpcServer, cmd interface{}, req *rpcRequest) (interface{}, error) {
 	c := cmd.(*btcjson.GetNodeAddressesCmd)
 
 	count := int32(1)
@@ -2520,7 +3071,7 @@ func handleGetNodeAddresses(s *rpcServer, cmd interface{}, closeChan <-chan stru
 }
 
 // handleGetPeerInfo implements the getpeerinfo command.
-func handleGetPeerInfo(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
+func handleGetPeerInfo(s *rpcServer, cmd interface{}, req *rpcRequest) (interface{}, error) {
 	peers := s.cfg.ConnMgr.ConnectedPeers()
 	syncPeerID := s.cfg.SyncMgr.SyncPeerID()
 	infos := make([]*btcjson.GetPeerInfoResult, 0, len(peers))
@@ -2547,6 +3098,9 @@ func handleGetPeerInfo(s *rpcServer, cmd interface{}, closeChan <-chan struct{})
 			BanScore:       int32(p.BanScore()),
 			FeeFilter:      p.FeeFilter(),
 			SyncNode:       statsSnap.ID == syncPeerID,
+			TransportType:  statsSnap.TransportProtocol,
+			SessionID:      statsSnap.SessionID,
+			ConnectionType: p.ConnectionType(),
 		}
 		if p.ToPeer().LastPingNonce() != 0 {
 			wait := float64(time.Since(statsSnap.LastPingTime).Nanoseconds())
@@ -2559,7 +3113,7 @@ func handleGetPeerInfo(s *rpcServer, cmd interface{}, closeChan <-chan struct{})
 }
 
 // handleGetRawMempool implements the getrawmempool command.
-func handleGetRawMempool(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
+func handleGetRawMempool(s *rpcServer, cmd interface{}, req *rpcRequest) (interface{}, error) {
 	c := cmd.(*btcjson.GetRawMempoolCmd)
 	mp := s.cfg.TxMemPool
 
@@ -2579,7 +3133,7 @@ func handleGetRawMempool(s *rpcServer, cmd interface{}, closeChan <-chan struct{
 }
 
 // handleGetRawTransaction implements the getrawtransaction command.
-func handleGetRawTransaction(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
+func handleGetRawTransaction(s *rpcServer, cmd interface{}, req *rpcRequest) (interface{}, error) {
 	c := cmd.(*btcjson.GetRawTransactionCmd)
 
 	// Convert the provided transaction hash hex to a Hash.
@@ -2601,19 +3155,14 @@ func handleGetRawTransaction(s *rpcServer, cmd interface{}, closeChan <-chan str
 	tx, err := s.cfg.TxMemPool.FetchTransaction(txHash)
 	if err != nil {
 		if s.cfg.TxIndex == nil {
-			return nil, &btcjson.RPCError{
-				Code: btcjson.ErrRPCNoTxInfo,
-				Message: "The transaction index must be " +
-					"enabled to query the blockchain " +
-					"(specify --txindex)",
-			}
+			return nil, rpcNoTxIndexError()
 		}
 
 		// Look up the location of the transaction.
 		blockRegion, err := s.cfg.TxIndex.TxBlockRegion(txHash)
 		if err != nil {
 			context := "Failed to retrieve transaction location"
-			return nil, internalRPCError(err.Error(), context)
+			return nil, req.internalError(err.Error(), context)
 		}
 		if blockRegion == nil {
 			return nil, rpcNoTxInfoError(txHash)
@@ -2642,7 +3191,7 @@ func handleGetRawTransaction(s *rpcServer, cmd interface{}, closeChan <-chan str
 		blkHeight, err = s.cfg.Chain.BlockHeightByHash(blkHash)
 		if err != nil {
 			context := "Failed to retrieve block height"
-			return nil, internalRPCError(err.Error(), context)
+			return nil, req.internalError(err.Error(), context)
 		}
 
 		// Deserialize the transaction
@@ -2650,7 +3199,7 @@ func handleGetRawTransaction(s *rpcServer, cmd interface{}, closeChan <-chan str
 		err = msgTx.Deserialize(bytes.NewReader(txBytes))
 		if err != nil {
 			context := "Failed to deserialize transaction"
-			return nil, internalRPCError(err.Error(), context)
+			return nil, req.internalError(err.Error(), context)
 		}
 		mtx = &msgTx
 	} else {
@@ -2681,7 +3230,7 @@ func handleGetRawTransaction(s *rpcServer, cmd interface{}, closeChan <-chan str
 		header, err := s.cfg.Chain.HeaderByHash(blkHash)
 		if err != nil {
 			context := "Failed to fetch block header"
-			return nil, internalRPCError(err.Error(), context)
+			return nil, req.internalError(err.Error(), context)
 		}
 
 		blkHeader = &header
@@ -2697,8 +3246,44 @@ func handleGetRawTransaction(s *rpcServer, cmd interface{}, closeChan <-chan str
 	return *rawTxn, nil
 }
 
+// handleGetSpentInfo implements the getspentinfo command.
+func handleGetSpentInfo(s *rpcServer, cmd interface{}, req *rpcRequest) (interface{}, error) {
+	// Respond with an error if the spent output index is not enabled.
+	if s.cfg.SpendIndex == nil {
+		return nil, &btcjson.RPCError{
+			Code:    btcjson.ErrRPCMisc,
+			Message: "Spent output index must be enabled (--spendindex)",
+		}
+	}
+
+	c := cmd.(*btcjson.GetSpentInfoCmd)
+	txHash, err := chainhash.NewHashFromStr(c.TxID)
+	if err != nil {
+		return nil, rpcDecodeHexError(c.TxID)
+	}
+
+	outPoint := wire.OutPoint{Hash: *txHash, Index: c.Index}
+	spend, err := s.cfg.SpendIndex.SpendingInputForOutPoint(&outPoint)
+	if err != nil {
+		context := "Failed to load spent output index entry"
+		return nil, req.internalError(err.Error(), context)
+	}
+	if spend == nil {
+		return nil, &btcjson.RPCError{
+			Code:    btcjson.ErrRPCNoTxInfo,
+			Message: "Unable to get spent info for " + outPoint.String(),
+		}
+	}
+
+	return &btcjson.GetSpentInfoResult{
+		TxID:   spend.TxHash.String(),
+		Index:  spend.InputIndex,
+		Height: spend.Height,
+	}, nil
+}
+
 // handleGetTxOut handles gettxout commands.
-func handleGetTxOut(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
+func handleGetTxOut(s *rpcServer, cmd interface{}, req *rpcRequest) (interface{}, error) {
 	c := cmd.(*btcjson.GetTxOutCmd)
 
 	// Convert the provided transaction hash hex to a Hash.
@@ -2739,7 +3324,7 @@ func handleGetTxOut(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (i
 		if txOut == nil {
 			errStr := fmt.Sprintf("Output index: %d for txid: %s "+
 				"does not exist", c.Vout, txHash)
-			return nil, internalRPCError(errStr, "")
+			return nil, req.internalError(errStr, "")
 		}
 
 		best := s.cfg.Chain.BestSnapshot()
@@ -2804,7 +3389,7 @@ func handleGetTxOut(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (i
 }
 
 // handleHelp implements the help command.
-func handleHelp(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
+func handleHelp(s *rpcServer, cmd interface{}, req *rpcRequest) (interface{}, error) {
 	c := cmd.(*btcjson.HelpCmd)
 
 	// Provide a usage overview of all commands when no specific command
@@ -2817,7 +3402,7 @@ func handleHelp(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (inter
 		usage, err := s.helpCacher.rpcUsage(false)
 		if err != nil {
 			context := "Failed to generate RPC usage"
-			return nil, internalRPCError(err.Error(), context)
+			return nil, req.internalError(err.Error(), context)
 		}
 		return usage, nil
 	}
@@ -2837,17 +3422,17 @@ func handleHelp(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (inter
 	help, err := s.helpCacher.rpcMethodHelp(command)
 	if err != nil {
 		context := "Failed to generate help"
-		return nil, internalRPCError(err.Error(), context)
+		return nil, req.internalError(err.Error(), context)
 	}
 	return help, nil
 }
 
 // handlePing implements the ping command.
-func handlePing(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
+func handlePing(s *rpcServer, cmd interface{}, req *rpcRequest) (interface{}, error) {
 	// Ask server to ping \o_
 	nonce, err := wire.RandomUint64()
 	if err != nil {
-		return nil, internalRPCError("Not sending ping - failed to "+
+		return nil, req.internalError("Not sending ping - failed to "+
 			"generate nonce: "+err.Error(), "")
 	}
 	s.cfg.ConnMgr.BroadcastMessage(wire.NewMsgPing(nonce))
@@ -2855,6 +3440,216 @@ func handlePing(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (inter
 	return nil, nil
 }
 
+// defaultScanTxOutSetRange is the last derivation index scantxoutset derives
+// scripts for when no range is specified for a ranged descriptor.
+const defaultScanTxOutSetRange = 1000
+
+// maxScanTxOutSetScripts is the maximum number of output scripts scantxoutset
+// scans the UTXO set for.
+const maxScanTxOutSetScripts = 1000000
+
+// errUTXOScanAborted is returned from the UTXO set iteration of scantxoutset
+// to stop the scan.
+var errUTXOScanAborted = errors.New("scan aborted")
+
+// utxoScan describes a scantxoutset scan in progress.
+type utxoScan struct {
+	// position is the UTXO set position of the scan as returned by
+	// blockchain.UtxoSetProgress scaled to 1<<32.  It must be accessed
+	// atomically.
+	position uint32
+
+	// abort is closed to abort the scan.  aborted is protected by the
+	// utxoScanMtx of the server.
+	abort   chan struct{}
+	aborted bool
+}
+
+// scanScript identifies the descriptor and derivation index of a script
+// scantxoutset scans the UTXO set for.
+type scanScript struct {
+	desc  *descriptor.Descriptor
+	index uint32
+}
+
+// parseScanObjects returns the scripts described by the passed scantxoutset
+// scan objects.  Scripts described more than once are rejected since each one
+// is reported along with the single descriptor and index it was derived from.
+func parseScanObjects(objects []btcjson.ScanObject, params *chaincfg.Params) (map[string]scanScript, error) {
+	scripts := make(map[string]scanScript)
+	for _, object := range objects {
+		desc, err := descriptor.Parse(object.Descriptor, params)
+		if err != nil {
+			return nil, &btcjson.RPCError{
+				Code:    btcjson.ErrRPCInvalidParameter,
+				Message: "Invalid descriptor: " + err.Error(),
+			}
+		}
+
+		var begin, end uint32
+		if desc.IsRange() {
+			end = defaultScanTxOutSetRange
+			if object.Range != nil {
+				begin, end, err = parseDescriptorRange(object.Range)
+				if err != nil {
+					return nil, err
+				}
+			}
+		}
+		if len(scripts)+int(end-begin) >= maxScanTxOutSetScripts {
+			return nil, &btcjson.RPCError{
+				Code: btcjson.ErrRPCInvalidParameter,
+				Message: fmt.Sprintf("Scan objects describe more "+
+					"than %d scripts", maxScanTxOutSetScripts),
+			}
+		}
+
+		for i := uint64(begin); i <= uint64(end); i++ {
+			script, err := desc.Script(uint32(i))
+			if err != nil {
+				return nil, &btcjson.RPCError{
+					Code:    btcjson.ErrRPCInvalidParameter,
+					Message: "Failed to derive script: " + err.Error(),
+				}
+			}
+			if dup, ok := scripts[string(script)]; ok {
+				return nil, &btcjson.RPCError{
+					Code: btcjson.ErrRPCInvalidParameter,
+					Message: fmt.Sprintf("Script %x is "+
+						"described by both %s at index "+
+						"%d and %s at index %d", script,
+						dup.desc, dup.index, desc, i),
+				}
+			}
+			scripts[string(script)] = scanScript{desc, uint32(i)}
+		}
+	}
+	return scripts, nil
+}
+
+// handleScanTxOutSet implements the scantxoutset command.
+func handleScanTxOutSet(s *rpcServer, cmd interface{}, req *rpcRequest) (interface{}, error) {
+	c := cmd.(*btcjson.ScanTxOutSetCmd)
+
+	switch c.Action {
+	case btcjson.ScanTxOutSetStatus:
+		s.utxoScanMtx.Lock()
+		scan := s.utxoScan
+		s.utxoScanMtx.Unlock()
+		if scan == nil {
+			return nil, nil
+		}
+		position := atomic.LoadUint32(&scan.position)
+		return &btcjson.ScanTxOutSetStatusResult{
+			Progress: float64(position) / (1 << 32) * 100,
+		}, nil
+
+	case btcjson.ScanTxOutSetAbort:
+		s.utxoScanMtx.Lock()
+		defer s.utxoScanMtx.Unlock()
+		if s.utxoScan == nil || s.utxoScan.aborted {
+			return false, nil
+		}
+		s.utxoScan.aborted = true
+		close(s.utxoScan.abort)
+		return true, nil
+
+	case btcjson.ScanTxOutSetStart:
+	default:
+		return nil, &btcjson.RPCError{
+			Code:    btcjson.ErrRPCInvalidParameter,
+			Message: fmt.Sprintf("Invalid action '%s'", c.Action),
+		}
+	}
+
+	if c.ScanObjects == nil {
+		return nil, &btcjson.RPCError{
+			Code:    btcjson.ErrRPCInvalidParameter,
+			Message: "Scan objects are required for the start action",
+		}
+	}
+	scripts, err := parseScanObjects(*c.ScanObjects, s.cfg.ChainParams)
+	if err != nil {
+		return nil, err
+	}
+
+	// Only allow a single scan at a time.
+	scan := &utxoScan{abort: make(chan struct{})}
+	s.utxoScanMtx.Lock()
+	if s.utxoScan != nil {
+		s.utxoScanMtx.Unlock()
+		return nil, &btcjson.RPCError{
+			Code: btcjson.ErrRPCMisc,
+			Message: "Scan already in progress, use action " +
+				"\"abort\" or \"status\"",
+		}
+	}
+	s.utxoScan = scan
+	s.utxoScanMtx.Unlock()
+	defer func() {
+		s.utxoScanMtx.Lock()
+		s.utxoScan = nil
+		s.utxoScanMtx.Unlock()
+	}()
+
+	result := &btcjson.ScanTxOutSetResult{
+		Unspents: []btcjson.ScanTxOutSetUnspent{},
+	}
+	var totalAmount btcutil.Amount
+	err = s.cfg.Chain.ForEachUtxo(func(outpoint wire.OutPoint,
+		entry *blockchain.UtxoEntry) error {
+
+		select {
+		case <-scan.abort:
+			return errUTXOScanAborted
+		case <-req.closeChan:
+			return errUTXOScanAborted
+		case <-s.quit:
+			return errUTXOScanAborted
+		default:
+		}
+
+		position := blockchain.UtxoSetProgress(outpoint) * (1 << 32)
+		atomic.StoreUint32(&scan.position, uint32(position))
+		result.TxOuts++
+
+		match, ok := scripts[string(entry.PkScript())]
+		if !ok {
+			return nil
+		}
+		desc, err := match.desc.Derive(match.index)
+		if err != nil {
+			return err
+		}
+		descStr, err := descriptor.AddChecksum(desc.String())
+		if err != nil {
+			return err
+		}
+		amount := btcutil.Amount(entry.Amount())
+		totalAmount += amount
+		result.Unspents = append(result.Unspents, btcjson.ScanTxOutSetUnspent{
+			TxID:         outpoint.Hash.String(),
+			Vout:         outpoint.Index,
+			ScriptPubKey: hex.EncodeToString(entry.PkScript()),
+			Descriptor:   descStr,
+			Amount:       amount.ToBTC(),
+			Height:       entry.BlockHeight(),
+		})
+		return nil
+	})
+	if err != nil && err != errUTXOScanAborted {
+		context := "Failed to scan the UTXO set"
+		return nil, req.internalError(err.Error(), context)
+	}
+
+	best := s.cfg.Chain.BestSnapshot()
+	result.Success = err == nil
+	result.Height = best.Height
+	result.BestBlock = best.Hash.String()
+	result.TotalAmount = totalAmount.ToBTC()
+	return result, nil
+}
+
 // retrievedTx represents a transaction that was either loaded from the
 // transaction memory pool or from the database.  When a transaction is loaded
 // from the database, it is loaded with the raw serialized bytes while the
@@ -2871,7 +3666,7 @@ type retrievedTx struct {
 // fetchInputTxos fetches the outpoints from all transactions referenced by the
 // inputs to the passed transaction by checking the transaction mempool first
 // then the transaction index for those already mined into blocks.
-func fetchInputTxos(s *rpcServer, tx *wire.MsgTx) (map[wire.OutPoint]wire.TxOut, error) {
+func fetchInputTxos(s *rpcServer, tx *wire.MsgTx, req *rpcRequest) (map[wire.OutPoint]wire.TxOut, error) {
 	mp := s.cfg.TxMemPool
 	originOutputs := make(map[wire.OutPoint]wire.TxOut)
 	for txInIndex, txIn := range tx.TxIn {
@@ -2885,7 +3680,7 @@ func fetchInputTxos(s *rpcServer, tx *wire.MsgTx) (map[wire.OutPoint]wire.TxOut,
 				errStr := fmt.Sprintf("unable to find output "+
 					"%v referenced from transaction %s:%d",
 					origin, tx.TxHash(), txInIndex)
-				return nil, internalRPCError(errStr, "")
+				return nil, req.internalError(errStr, "")
 			}
 
 			originOutputs[*origin] = *txOuts[origin.Index]
@@ -2896,7 +3691,7 @@ func fetchInputTxos(s *rpcServer, tx *wire.MsgTx) (map[wire.OutPoint]wire.TxOut,
 		blockRegion, err := s.cfg.TxIndex.TxBlockRegion(&origin.Hash)
 		if err != nil {
 			context := "Failed to retrieve transaction location"
-			return nil, internalRPCError(err.Error(), context)
+			return nil, req.internalError(err.Error(), context)
 		}
 		if blockRegion == nil {
 			return nil, rpcNoTxInfoError(&origin.Hash)
@@ -2918,7 +3713,7 @@ func fetchInputTxos(s *rpcServer, tx *wire.MsgTx) (map[wire.OutPoint]wire.TxOut,
 		err = msgTx.Deserialize(bytes.NewReader(txBytes))
 		if err != nil {
 			context := "Failed to deserialize transaction"
-			return nil, internalRPCError(err.Error(), context)
+			return nil, req.internalError(err.Error(), context)
 		}
 
 		// Add the referenced output to the map.
@@ -2926,7 +3721,7 @@ func fetchInputTxos(s *rpcServer, tx *wire.MsgTx) (map[wire.OutPoint]wire.TxOut,
 			errStr := fmt.Sprintf("unable to find output %v "+
 				"referenced from transaction %s:%d", origin,
 				tx.TxHash(), txInIndex)
-			return nil, internalRPCError(errStr, "")
+			return nil, req.internalError(errStr, "")
 		}
 		originOutputs[*origin] = *msgTx.TxOut[origin.Index]
 	}
@@ -2936,7 +3731,7 @@ func fetchInputTxos(s *rpcServer, tx *wire.MsgTx) (map[wire.OutPoint]wire.TxOut,
 
 // createVinListPrevOut returns a slice of JSON objects for the inputs of the
 // passed transaction.
-func createVinListPrevOut(s *rpcServer, mtx *wire.MsgTx, chainParams *chaincfg.Params, vinExtra bool, filterAddrMap map[string]struct{}) ([]btcjson.VinPrevOut, error) {
+func createVinListPrevOut(s *rpcServer, mtx *wire.MsgTx, chainParams *chaincfg.Params, vinExtra bool, filterAddrMap map[string]struct{}, req *rpcRequest) ([]btcjson.VinPrevOut, error) {
 	// Coinbase transactions only have a single txin by definition.
 	if blockchain.IsCoinBaseTx(mtx) {
 		// Only include the transaction if the filter map is empty
@@ -2961,7 +3756,7 @@ func createVinListPrevOut(s *rpcServer, mtx *wire.MsgTx, chainParams *chaincfg.P
 	var originOutputs map[wire.OutPoint]wire.TxOut
 	if vinExtra || len(filterAddrMap) > 0 {
 		var err error
-		originOutputs, err = fetchInputTxos(s, mtx)
+		originOutputs, err = fetchInputTxos(s, mtx, req)
 		if err != nil {
 			return nil, err
 		}
@@ -3077,7 +3872,7 @@ func fetchMempoolTxnsForAddress(s *rpcServer, addr btcutil.Address, numToSkip, n
 }
 
 // handleSearchRawTransactions implements the searchrawtransactions command.
-func handleSearchRawTransactions(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
+func handleSearchRawTransactions(s *rpcServer, cmd interface{}, req *rpcRequest) (interface{}, error) {
 	// Respond with an error if the address index is not enabled.
 	addrIndex := s.cfg.AddrIndex
 	if addrIndex == nil {
@@ -3201,7 +3996,7 @@ func handleSearchRawTransactions(s *rpcServer, cmd interface{}, closeChan <-chan
 		})
 		if err != nil {
 			context := "Failed to load address index entries"
-			return nil, internalRPCError(err.Error(), context)
+			return nil, req.internalError(err.Error(), context)
 		}
 
 	}
@@ -3278,7 +4073,7 @@ func handleSearchRawTransactions(s *rpcServer, cmd interface{}, closeChan <-chan
 			err := mtx.Deserialize(bytes.NewReader(rtx.txBytes))
 			if err != nil {
 				context := "Failed to deserialize transaction"
-				return nil, internalRPCError(err.Error(),
+				return nil, req.internalError(err.Error(),
 					context)
 			}
 		} else {
@@ -3289,7 +4084,7 @@ func handleSearchRawTransactions(s *rpcServer, cmd interface{}, closeChan <-chan
 		result.Hex = hexTxns[i]
 		result.Txid = mtx.TxHash().String()
 		result.Vin, err = createVinListPrevOut(s, mtx, params, vinExtra,
-			filterAddrMap)
+			filterAddrMap, req)
 		if err != nil {
 			return nil, err
 		}
@@ -3318,7 +4113,7 @@ func handleSearchRawTransactions(s *rpcServer, cmd interface{}, closeChan <-chan
 			height, err := s.cfg.Chain.BlockHeightByHash(blkHash)
 			if err != nil {
 				context := "Failed to obtain block height"
-				return nil, internalRPCError(err.Error(), context)
+				return nil, req.internalError(err.Error(), context)
 			}
 
 			blkHeader = &header
@@ -3341,7 +4136,7 @@ func handleSearchRawTransactions(s *rpcServer, cmd interface{}, closeChan <-chan
 }
 
 // handleSendRawTransaction implements the sendrawtransaction command.
-func handleSendRawTransaction(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
+func handleSendRawTransaction(s *rpcServer, cmd interface{}, req *rpcRequest) (interface{}, error) {
 	c := cmd.(*btcjson.SendRawTransactionCmd)
 	// Deserialize and send off to tx relay
 	hexStr := c.HexTx
@@ -3371,7 +4166,7 @@ func handleSendRawTransaction(s *rpcServer, cmd interface{}, closeChan <-chan st
 		// so log it as an actual error and return.
 		ruleErr, ok := err.(mempool.RuleError)
 		if !ok {
-			rpcsLog.Errorf("Failed to process transaction %v: %v",
+			req.log.Errorf("Failed to process transaction %v: %v",
 				tx.Hash(), err)
 
 			return nil, &btcjson.RPCError{
@@ -3380,7 +4175,7 @@ func handleSendRawTransaction(s *rpcServer, cmd interface{}, closeChan <-chan st
 			}
 		}
 
-		rpcsLog.Debugf("Rejected transaction %v: %v", tx.Hash(), err)
+		req.log.Debugf("Rejected transaction %v: %v", tx.Hash(), err)
 
 		// We'll then map the rule error to the appropriate RPC error,
 		// matching bitcoind's behavior.
@@ -3421,7 +4216,17 @@ func handleSendRawTransaction(s *rpcServer, cmd interface{}, closeChan <-chan st
 
 		errStr := fmt.Sprintf("transaction %v is not in accepted list",
 			tx.Hash())
-		return nil, internalRPCError(errStr, "")
+		return nil, req.internalError(errStr, "")
+	}
+
+	// Notify both websocket and getblocktemplate long poll clients of all
+	// newly accepted transactions.
+	s.NotifyNewTransactions(acceptedTxs)
+
+	// When private broadcast is enabled, the transactions are announced
+	// to the connected peers once they are relayed back.
+	if s.cfg.ConnMgr.PrivateBroadcast(acceptedTxs) {
+		return tx.Hash().String(), nil
 	}
 
 	// Generate and relay inventory vectors for all newly accepted
@@ -3429,10 +4234,6 @@ func handleSendRawTransaction(s *rpcServer, cmd interface{}, closeChan <-chan st
 	// accepted.
 	s.cfg.ConnMgr.RelayTransactions(acceptedTxs)
 
-	// Notify both websocket and getblocktemplate long poll clients of all
-	// newly accepted transactions.
-	s.NotifyNewTransactions(acceptedTxs)
-
 	// Keep track of all the sendrawtransaction request txns so that they
 	// can be rebroadcast if they don't make their way into a block.
 	txD := acceptedTxs[0]
@@ -3443,7 +4244,7 @@ func handleSendRawTransaction(s *rpcServer, cmd interface{}, closeChan <-chan st
 }
 
 // handleSetGenerate implements the setgenerate command.
-func handleSetGenerate(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
+func handleSetGenerate(s *rpcServer, cmd interface{}, req *rpcRequest) (interface{}, error) {
 	c := cmd.(*btcjson.SetGenerateCmd)
 
 	// Disable generation regardless of the provided generate flag if the
@@ -3483,7 +4284,7 @@ func handleSetGenerate(s *rpcServer, cmd interface{}, closeChan <-chan struct{})
 const messageSignatureHeader = "GroestlCoin Signed Message:\n"
 
 // handleSignMessageWithPrivKey implements the signmessagewithprivkey command.
-func handleSignMessageWithPrivKey(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
+func handleSignMessageWithPrivKey(s *rpcServer, cmd interface{}, req *rpcRequest) (interface{}, error) {
 	c := cmd.(*btcjson.SignMessageWithPrivKeyCmd)
 
 	wif, err := btcutil.DecodeWIF(c.PrivKey)
@@ -3525,7 +4326,7 @@ func handleSignMessageWithPrivKey(s *rpcServer, cmd interface{}, closeChan <-cha
 }
 
 // handleStop implements the stop command.
-func handleStop(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
+func handleStop(s *rpcServer, cmd interface{}, req *rpcRequest) (interface{}, error) {
 	select {
 	case s.requestProcessShutdown <- struct{}{}:
 	default:
@@ -3534,7 +4335,7 @@ func handleStop(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (inter
 }
 
 // handleSubmitBlock implements the submitblock command.
-func handleSubmitBlock(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
+func handleSubmitBlock(s *rpcServer, cmd interface{}, req *rpcRequest) (interface{}, error) {
 	c := cmd.(*btcjson.SubmitBlockCmd)
 
 	// Deserialize the submitted block.
@@ -3562,17 +4363,18 @@ func handleSubmitBlock(s *rpcServer, cmd interface{}, closeChan <-chan struct{})
 		return fmt.Sprintf("rejected: %s", err.Error()), nil
 	}
 
-	rpcsLog.Infof("Accepted block %s via submitblock", block.Hash())
+	req.log.withFields(logFieldBlock, block.Hash().String()).Infof(
+		"Accepted block %s via submitblock", block.Hash())
 	return nil, nil
 }
 
 // handleUptime implements the uptime command.
-func handleUptime(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
+func handleUptime(s *rpcServer, cmd interface{}, req *rpcRequest) (interface{}, error) {
 	return time.Now().Unix() - s.cfg.StartupTime, nil
 }
 
 // handleValidateAddress implements the validateaddress command.
-func handleValidateAddress(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
+func handleValidateAddress(s *rpcServer, cmd interface{}, req *rpcRequest) (interface{}, error) {
 	c := cmd.(*btcjson.ValidateAddressCmd)
 
 	result := btcjson.ValidateAddressChainResult{}
@@ -3619,20 +4421,20 @@ func handleValidateAddress(s *rpcServer, cmd interface{}, closeChan <-chan struc
 	return result, nil
 }
 
-func verifyChain(s *rpcServer, level, depth int32) error {
+func verifyChain(s *rpcServer, level, depth int32, req *rpcRequest) error {
 	best := s.cfg.Chain.BestSnapshot()
 	finishHeight := best.Height - depth
 	if finishHeight < 0 {
 		finishHeight = 0
 	}
-	rpcsLog.Infof("Verifying chain for %d blocks at level %d",
+	req.log.Infof("Verifying chain for %d blocks at level %d",
 		best.Height-finishHeight, level)
 
 	for height := best.Height; height > finishHeight; height-- {
 		// Level 0 just looks up the block.
 		block, err := s.cfg.Chain.BlockByHeight(height)
 		if err != nil {
-			rpcsLog.Errorf("Verify is unable to fetch block at "+
+			req.log.Errorf("Verify is unable to fetch block at "+
 				"height %d: %v", height, err)
 			return err
 		}
@@ -3642,20 +4444,20 @@ func verifyChain(s *rpcServer, level, depth int32) error {
 			err := blockchain.CheckBlockSanity(block,
 				s.cfg.ChainParams.PowLimit, s.cfg.TimeSource)
 			if err != nil {
-				rpcsLog.Errorf("Verify is unable to validate "+
+				req.log.Errorf("Verify is unable to validate "+
 					"block at hash %v height %d: %v",
 					block.Hash(), height, err)
 				return err
 			}
 		}
 	}
-	rpcsLog.Infof("Chain verify completed successfully")
+	req.log.Infof("Chain verify completed successfully")
 
 	return nil
 }
 
 // handleVerifyChain implements the verifychain command.
-func handleVerifyChain(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
+func handleVerifyChain(s *rpcServer, cmd interface{}, req *rpcRequest) (interface{}, error) {
 	c := cmd.(*btcjson.VerifyChainCmd)
 
 	var checkLevel, checkDepth int32
@@ -3666,12 +4468,12 @@ func handleVerifyChain(s *rpcServer, cmd interface{}, closeChan <-chan struct{})
 		checkDepth = *c.CheckDepth
 	}
 
-	err := verifyChain(s, checkLevel, checkDepth)
+	err := verifyChain(s, checkLevel, checkDepth, req)
 	return err == nil, nil
 }
 
 // handleVerifyMessage implements the verifymessage command.
-func handleVerifyMessage(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
+func handleVerifyMessage(s *rpcServer, cmd interface{}, req *rpcRequest) (interface{}, error) {
 	c := cmd.(*btcjson.VerifyMessageCmd)
 
 	// Decode the provided address.
@@ -3736,7 +4538,7 @@ func handleVerifyMessage(s *rpcServer, cmd interface{}, closeChan <-chan struct{
 // handleVersion implements the version command.
 //
 // NOTE: This is a btcsuite extension ported from github.com/decred/dcrd.
-func handleVersion(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
+func handleVersion(s *rpcServer, cmd interface{}, req *rpcRequest) (interface{}, error) {
 	result := map[string]btcjson.VersionResult{
 		"grsdjsonrpcapi": {
 			VersionString: jsonrpcSemverString,
@@ -3753,8 +4555,7 @@ type rpcServer struct {
 	started                int32
 	shutdown               int32
 	cfg                    rpcserverConfig
-	authsha                [sha256.Size]byte
-	limitauthsha           [sha256.Size]byte
+	users                  []*rpcUser
 	ntfnMgr                *wsNotificationManager
 	numClients             int32
 	statusLines            map[int]string
@@ -3764,6 +4565,10 @@ type rpcServer struct {
 	helpCacher             *helpCacher
 	requestProcessShutdown chan struct{}
 	quit                   chan int
+
+	// utxoScan is the scantxoutset scan in progress, if any.
+	utxoScanMtx sync.Mutex
+	utxoScan    *utxoScan
 }
 
 // httpStatusLine returns a response Status-Line (RFC 2616 Section 6.1)
@@ -3903,42 +4708,30 @@ func (s *rpcServer) decrementClients() {
 // does not match the username and password expected, a non-nil error is
 // returned.
 //
-// This check is time-constant.
-//
-// The first bool return value signifies auth success (true if successful) and
-// the second bool return value specifies whether the user can change the state
-// of the server (true) or whether the user is limited (false). The second is
-// always false if the first is.
-func (s *rpcServer) checkAuth(r *http.Request, require bool) (bool, bool, error) {
+// The returned user is nil when no authorization header is supplied and
+// authentication is not required.
+func (s *rpcServer) checkAuth(r *http.Request, require bool) (*rpcUser, error) {
 	authhdr := r.Header["Authorization"]
 	if len(authhdr) <= 0 {
 		if require {
 			rpcsLog.Warnf("RPC authentication failure from %s",
 				r.RemoteAddr)
-			return false, false, errors.New("auth failure")
+			return nil, errors.New("auth failure")
 		}
 
-		return false, false, nil
-	}
-
-	authsha := sha256.Sum256([]byte(authhdr[0]))
-
-	// Check for limited auth first as in environments with limited users, those
-	// are probably expected to have a higher volume of calls
-	limitcmp := subtle.ConstantTimeCompare(authsha[:], s.limitauthsha[:])
-	if limitcmp == 1 {
-		return true, false, nil
+		return nil, nil
 	}
 
-	// Check for admin-level auth
-	cmp := subtle.ConstantTimeCompare(authsha[:], s.authsha[:])
-	if cmp == 1 {
-		return true, true, nil
+	username, password, ok := r.BasicAuth()
+	if ok {
+		if user := s.authenticate(username, password); user != nil {
+			return user, nil
+		}
 	}
 
-	// Request's auth doesn't match either user
+	// Request's auth doesn't match any user
 	rpcsLog.Warnf("RPC authentication failure from %s", r.RemoteAddr)
-	return false, false, errors.New("auth failure")
+	return nil, errors.New("auth failure")
 }
 
 // parsedRPCCmd represents a JSON-RPC request object that has been parsed into
@@ -3950,13 +4743,81 @@ type parsedRPCCmd struct {
 	method  string
 	cmd     interface{}
 	err     *btcjson.RPCError
+
+	// reqID is the correlation ID of the request which is attached to all
+	// log entries about it.
+	reqID string
+}
+
+// rpcRequest houses the state of a request which is passed to the command
+// handlers.
+type rpcRequest struct {
+	// closeChan is closed when the client disconnects, so long-running
+	// handlers can return early.  It is nil for requests that can't be
+	// cancelled.
+	closeChan <-chan struct{}
+
+	// log attaches the correlation ID and the method of the request to all
+	// entries.  Handlers use it for all logging about the request.
+	log *subsystemLogger
+}
+
+// logger returns a logger for the RPC server which attaches the correlation
+// ID and the method of the request to all entries.
+func (cmd *parsedRPCCmd) logger() *subsystemLogger {
+	return rpcsLog.withFields(logFieldRequestID, cmd.reqID,
+		logFieldMethod, cmd.method)
+}
+
+// request returns the state of the request which is passed to its handler.
+func (cmd *parsedRPCCmd) request(closeChan <-chan struct{}) *rpcRequest {
+	return &rpcRequest{closeChan: closeChan, log: cmd.logger()}
+}
+
+// internalError is a convenience function to convert an internal error to an
+// RPC error with the appropriate code set.  It also logs the error with the
+// fields of the request.
+func (r *rpcRequest) internalError(errStr, context string) *btcjson.RPCError {
+	return logInternalRPCError(r.log, errStr, context)
+}
+
+// requestIDHeader is the HTTP header which carries the correlation ID of an
+// HTTP JSON-RPC request.  A valid ID provided by the client is used as is,
+// otherwise one is generated, and the ID is returned in the response.
+const requestIDHeader = "X-Request-Id"
+
+// maxRequestIDLen is the maximum length of a correlation ID provided by a
+// client.
+const maxRequestIDLen = 64
+
+// newRequestID returns a new random correlation ID for a request.
+func newRequestID() string {
+	return fmt.Sprintf("%016x", rand.Uint64())
+}
+
+// validRequestID returns whether the passed correlation ID provided by a
+// client is acceptable.  Only short IDs consisting of alphanumeric characters,
+// dots, dashes and underscores are accepted so they are safe to log.
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLen {
+		return false
+	}
+	for _, c := range id {
+		switch {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9':
+		case c == '.', c == '-', c == '_':
+		default:
+			return false
+		}
+	}
+	return true
 }
 
 // standardCmdResult checks that a parsed command is a standard Bitcoin JSON-RPC
 // command and runs the appropriate handler to reply to the command.  Any
 // commands which are not recognized or not implemented will return an error
 // suitable for use in replies.
-func (s *rpcServer) standardCmdResult(cmd *parsedRPCCmd, closeChan <-chan struct{}) (interface{}, error) {
+func (s *rpcServer) standardCmdResult(cmd *parsedRPCCmd, req *rpcRequest) (interface{}, error) {
 	handler, ok := rpcHandlers[cmd.method]
 	if ok {
 		goto handled
@@ -3974,7 +4835,19 @@ func (s *rpcServer) standardCmdResult(cmd *parsedRPCCmd, closeChan <-chan struct
 	return nil, btcjson.ErrRPCMethodNotFound
 handled:
 
-	return handler(s, cmd.cmd, closeChan)
+	req.log.Tracef("Handling request")
+	start := time.Now()
+	result, err := handler(s, cmd.cmd, req)
+	elapsed := time.Since(start)
+	if err != nil {
+		req.log.Debugf("Request failed after %v: %v", elapsed, err)
+	} else {
+		req.log.Debugf("Request served in %v", elapsed)
+	}
+	if s.cfg.Metrics != nil {
+		s.cfg.Metrics.observeRPC(cmd.method, elapsed, err)
+	}
+	return result, err
 }
 
 // parseCmd parses a JSON-RPC request object into known concrete command.  The
@@ -3986,6 +4859,7 @@ func parseCmd(request *btcjson.Request) *parsedRPCCmd {
 		jsonrpc: request.Jsonrpc,
 		id:      request.ID,
 		method:  request.Method,
+		reqID:   newRequestID(),
 	}
 
 	cmd, err := btcjson.UnmarshalCmd(request)
@@ -4027,17 +4901,18 @@ func createMarshalledReply(rpcVersion btcjson.RPCVersion, id interface{}, result
 }
 
 // processRequest determines the incoming request type (single or batched),
-// parses it and returns a marshalled response.
-func (s *rpcServer) processRequest(request *btcjson.Request, isAdmin bool, closeChan <-chan struct{}) []byte {
+// parses it and returns a marshalled response.  The passed correlation ID is
+// attached to all log entries about the request.
+func (s *rpcServer) processRequest(request *btcjson.Request, user *rpcUser, reqID string, closeChan <-chan struct{}) []byte {
 	var result interface{}
 	var err error
 	var jsonErr *btcjson.RPCError
+	log := rpcsLog.withFields(logFieldRequestID, reqID, logFieldMethod,
+		request.Method)
 
-	if !isAdmin {
-		if _, ok := rpcLimited[request.Method]; !ok {
-			jsonErr = internalRPCError("limited user not "+
-				"authorized for this method", "")
-		}
+	if !user.isAuthorized(request.Method) {
+		jsonErr = logInternalRPCError(log,
+			user.unauthorizedMessage(request.Method), "")
 	}
 
 	if jsonErr == nil {
@@ -4048,7 +4923,7 @@ func (s *rpcServer) processRequest(request *btcjson.Request, isAdmin bool, close
 			}
 			msg, err := createMarshalledReply(request.Jsonrpc, request.ID, result, jsonErr)
 			if err != nil {
-				rpcsLog.Errorf("Failed to marshal reply: %v", err)
+				log.Errorf("Failed to marshal reply: %v", err)
 				return nil
 			}
 			return msg
@@ -4063,11 +4938,12 @@ func (s *rpcServer) processRequest(request *btcjson.Request, isAdmin bool, close
 		// Attempt to parse the JSON-RPC request into a known
 		// concrete command.
 		parsedCmd := parseCmd(request)
+		parsedCmd.reqID = reqID
 		if parsedCmd.err != nil {
 			jsonErr = parsedCmd.err
 		} else {
 			result, err = s.standardCmdResult(parsedCmd,
-				closeChan)
+				parsedCmd.request(closeChan))
 			if err != nil {
 				if rpcErr, ok := err.(*btcjson.RPCError); ok {
 					jsonErr = rpcErr
@@ -4084,18 +4960,26 @@ func (s *rpcServer) processRequest(request *btcjson.Request, isAdmin bool, close
 	// Marshal the response.
 	msg, err := createMarshalledReply(request.Jsonrpc, request.ID, result, jsonErr)
 	if err != nil {
-		rpcsLog.Errorf("Failed to marshal reply: %v", err)
+		log.Errorf("Failed to marshal reply: %v", err)
 		return nil
 	}
 	return msg
 }
 
 // jsonRPCRead handles reading and responding to RPC messages.
-func (s *rpcServer) jsonRPCRead(w http.ResponseWriter, r *http.Request, isAdmin bool) {
+func (s *rpcServer) jsonRPCRead(w http.ResponseWriter, r *http.Request, user *rpcUser) {
 	if atomic.LoadInt32(&s.shutdown) != 0 {
 		return
 	}
 
+	// Use the correlation ID provided by the client if it is acceptable and
+	// return it in the response so the client can correlate the logs.
+	reqID := r.Header.Get(requestIDHeader)
+	if !validRequestID(reqID) {
+		reqID = newRequestID()
+	}
+	w.Header().Set(requestIDHeader, reqID)
+
 	// Read and close the JSON-RPC request body from the caller.
 	body, err := ioutil.ReadAll(r.Body)
 	r.Body.Close()
@@ -4190,7 +5074,7 @@ func (s *rpcServer) jsonRPCRead(w http.ResponseWriter, r *http.Request, isAdmin
 			if req.ID == nil && !(cfg.RPCQuirks && req.Jsonrpc == "") {
 				return
 			}
-			resp = s.processRequest(&req, isAdmin, closeChan)
+			resp = s.processRequest(&req, user, reqID, closeChan)
 		}
 
 		if resp != nil {
@@ -4240,7 +5124,7 @@ func (s *rpcServer) jsonRPCRead(w http.ResponseWriter, r *http.Request, isAdmin
 			if len(batchedRequests) > 0 {
 				batchSize = len(batchedRequests)
 
-				for _, entry := range batchedRequests {
+				for i, entry := range batchedRequests {
 					var reqBytes []byte
 					reqBytes, err = json.Marshal(entry)
 					if err != nil {
@@ -4279,7 +5163,9 @@ func (s *rpcServer) jsonRPCRead(w http.ResponseWriter, r *http.Request, isAdmin
 						continue
 					}
 
-					resp = s.processRequest(&req, isAdmin, closeChan)
+					entryID := fmt.Sprintf("%s-%d", reqID, i)
+					resp = s.processRequest(&req, user, entryID,
+						closeChan)
 					if resp != nil {
 						results = append(results, resp)
 					}
@@ -4364,19 +5250,19 @@ func (s *rpcServer) Start() {
 		// Keep track of the number of connected clients.
 		s.incrementClients()
 		defer s.decrementClients()
-		_, isAdmin, err := s.checkAuth(r, true)
+		user, err := s.checkAuth(r, true)
 		if err != nil {
 			jsonAuthFail(w)
 			return
 		}
 
 		// Read and respond to the request.
-		s.jsonRPCRead(w, r, isAdmin)
+		s.jsonRPCRead(w, r, user)
 	})
 
 	// Websocket endpoint.
 	rpcServeMux.HandleFunc("/ws", func(w http.ResponseWriter, r *http.Request) {
-		authenticated, isAdmin, err := s.checkAuth(r, false)
+		user, err := s.checkAuth(r, false)
 		if err != nil {
 			jsonAuthFail(w)
 			return
@@ -4393,9 +5279,26 @@ func (s *rpcServer) Start() {
 			http.Error(w, "400 Bad Request.", http.StatusBadRequest)
 			return
 		}
-		s.WebsocketHandler(ws, r.RemoteAddr, authenticated, isAdmin)
+		s.WebsocketHandler(ws, r.RemoteAddr, user)
 	})
 
+	// Unauthenticated read-only REST endpoint.
+	if cfg.REST {
+		rpcServeMux.HandleFunc(restPathPrefix, func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Connection", "close")
+			r.Close = true
+
+			// REST requests count towards the standard clients.
+			if s.limitConnections(w, r.RemoteAddr) {
+				return
+			}
+			s.incrementClients()
+			defer s.decrementClients()
+
+			s.handleREST(w, r)
+		})
+	}
+
 	for _, listener := range s.cfg.Listeners {
 		s.wg.Add(1)
 		go func(listener net.Listener) {
@@ -4452,6 +5355,9 @@ type rpcserverPeer interface {
 	// FeeFilter returns the requested current minimum fee rate for which
 	// transactions should be announced.
 	FeeFilter() int64
+
+	// ConnectionType returns the type of the connection to the peer.
+	ConnectionType() string
 }
 
 // rpcserverConnManager represents a connection manager for use with the RPC
@@ -4514,6 +5420,18 @@ type rpcserverConnManager interface {
 	// the passed transactions to all connected peers.
 	RelayTransactions(txns []*mempool.TxDesc)
 
+	// PrivateBroadcast broadcasts the passed transactions through
+	// short-lived Tor connections and announces them to all connected
+	// peers once they are relayed back.  It returns false without doing
+	// anything when private broadcast is disabled.
+	PrivateBroadcast(txns []*mempool.TxDesc) bool
+
+	// PrivateBroadcastPending returns whether the transaction with the
+	// passed hash is waiting to be relayed back after being broadcast
+	// privately, in which case it must be treated as unknown by anything
+	// that could reveal it originates from this node.
+	PrivateBroadcastPending(hash *chainhash.Hash) bool
+
 	// NodeAddresses returns an array consisting node addresses which can
 	// potentially be used to find new nodes in the network.
 	NodeAddresses() []*wire.NetAddress
@@ -4587,13 +5505,20 @@ type rpcserverConfig struct {
 
 	// These fields define any optional indexes the RPC server can make use
 	// of to provide additional data when queried.
-	TxIndex   *indexers.TxIndex
-	AddrIndex *indexers.AddrIndex
-	CfIndex   *indexers.CfIndex
+	TxIndex         *indexers.TxIndex
+	AddrIndex       *indexers.AddrIndex
+	AddrUtxoIndex   *indexers.AddrUtxoIndex
+	SpendIndex      *indexers.SpendIndex
+	BlockStatsIndex *indexers.BlockStatsIndex
+	CfIndex         *indexers.CfIndex
 
 	// The fee estimator keeps track of how long transactions are left in
 	// the mempool before they are mined into blocks.
 	FeeEstimator *mempool.FeeEstimator
+
+	// Metrics records the number of calls and the latency per method when
+	// the metrics endpoint is enabled.  It may be nil.
+	Metrics *serverMetrics
 }
 
 // newRPCServer returns a new instance of the rpcServer struct.
@@ -4606,16 +5531,11 @@ func newRPCServer(config *rpcserverConfig) (*rpcServer, error) {
 		requestProcessShutdown: make(chan struct{}),
 		quit:                   make(chan int),
 	}
-	if cfg.RPCUser != "" && cfg.RPCPass != "" {
-		login := cfg.RPCUser + ":" + cfg.RPCPass
-		auth := "Basic " + base64.StdEncoding.EncodeToString([]byte(login))
-		rpc.authsha = sha256.Sum256([]byte(auth))
-	}
-	if cfg.RPCLimitUser != "" && cfg.RPCLimitPass != "" {
-		login := cfg.RPCLimitUser + ":" + cfg.RPCLimitPass
-		auth := "Basic " + base64.StdEncoding.EncodeToString([]byte(login))
-		rpc.limitauthsha = sha256.Sum256([]byte(auth))
+	users, err := createRPCUsers(cfg)
+	if err != nil {
+		return nil, err
 	}
+	rpc.users = users
 	rpc.ntfnMgr = newWsNotificationManager(&rpc)
 	rpc.cfg.Chain.Subscribe(rpc.handleBlockchainNotification)
 
@@ -0,0 +1,118 @@
+// Copyright (c) 2021 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/btcsuite/btcd/blockchain/indexers"
+	"github.com/btcsuite/btcd/btcjson"
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcd/database"
+	"github.com/btcsuite/btcutil"
+)
+
+// TestGetBlockStatsRangeLimit ensures getblockstatsrange rejects ranges of
+// more heights than may be returned in one call before accessing the index.
+func TestGetBlockStatsRangeLimit(t *testing.T) {
+	t.Parallel()
+
+	s := &rpcServer{cfg: rpcserverConfig{
+		BlockStatsIndex: &indexers.BlockStatsIndex{},
+	}}
+	tests := []struct {
+		start, end int32
+	}{
+		{0, maxBlockStatsRange},
+		{100, 100 + maxBlockStatsRange},
+		{0, 1<<31 - 1},
+	}
+	for _, test := range tests {
+		cmd := btcjson.NewGetBlockStatsRangeCmd(test.start, test.end, nil)
+		_, err := handleGetBlockStatsRange(s, cmd, nil)
+		rpcErr, ok := err.(*btcjson.RPCError)
+		if !ok || rpcErr.Code != btcjson.ErrRPCInvalidParameter {
+			t.Errorf("[%d, %d]: unexpected error: %v", test.start,
+				test.end, err)
+		}
+	}
+}
+
+// TestParseScanObjectsDuplicates ensures scan objects that describe the same
+// script more than once are rejected instead of one overwriting the other.
+func TestParseScanObjectsDuplicates(t *testing.T) {
+	t.Parallel()
+
+	params := &chaincfg.MainNetParams
+	pubKey := "0279be667ef9dcbbac55a06295ce870b07029bfcdb2dce28d959f2815b16f81798"
+	serializedPubKey, _ := hex.DecodeString(pubKey)
+	addr, err := btcutil.NewAddressPubKeyHash(
+		btcutil.Hash160(serializedPubKey), params)
+	if err != nil {
+		t.Fatalf("NewAddressPubKeyHash: unexpected error: %v", err)
+	}
+
+	scripts, err := parseScanObjects([]btcjson.ScanObject{
+		{Descriptor: "pkh(" + pubKey + ")"},
+		{Descriptor: "wpkh(" + pubKey + ")"},
+	}, params)
+	if err != nil || len(scripts) != 2 {
+		t.Fatalf("parseScanObjects: got %d scripts, %v, want 2", len(scripts),
+			err)
+	}
+
+	_, err = parseScanObjects([]btcjson.ScanObject{
+		{Descriptor: "pkh(" + pubKey + ")"},
+		{Descriptor: "addr(" + addr.EncodeAddress() + ")"},
+	}, params)
+	rpcErr, ok := err.(*btcjson.RPCError)
+	if !ok || rpcErr.Code != btcjson.ErrRPCInvalidParameter {
+		t.Fatalf("parseScanObjects: unexpected error: %v", err)
+	}
+}
+
+// failingCompactor is a database which fails to compact.
+type failingCompactor struct {
+	database.DB
+}
+
+func (failingCompactor) Compact() error { return errors.New("disk full") }
+
+// TestRPCRequestLogging ensures handlers log internal errors with the
+// correlation ID and method of the request they were passed.
+func TestRPCRequestLogging(t *testing.T) {
+	t.Parallel()
+
+	var buf bytes.Buffer
+	backend := newLogBackend(&buf)
+	backend.SetFormat(logFormatJSON)
+	req := &rpcRequest{
+		log: backend.Logger("RPCS").withFields(logFieldRequestID, "abc",
+			logFieldMethod, "compactdb"),
+	}
+
+	s := &rpcServer{cfg: rpcserverConfig{DB: failingCompactor{}}}
+	_, err := handleCompactDB(s, nil, req)
+	rpcErr, ok := err.(*btcjson.RPCError)
+	if !ok || rpcErr.Code != btcjson.ErrRPCInternal.Code {
+		t.Fatalf("handleCompactDB: unexpected error: %v", err)
+	}
+
+	var entry map[string]string
+	line := strings.TrimSuffix(buf.String(), "\n")
+	if err := json.Unmarshal([]byte(line), &entry); err != nil {
+		t.Fatalf("invalid log entry %q: %v", buf.String(), err)
+	}
+	if entry[logFieldRequestID] != "abc" ||
+		entry[logFieldMethod] != "compactdb" || entry["level"] != "error" {
+
+		t.Fatalf("unexpected log entry %v", entry)
+	}
+}
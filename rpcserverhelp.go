@@ -16,6 +16,12 @@ import (
 
 // helpDescsEnUS defines the English descriptions used for the help strings.
 var helpDescsEnUS = map[string]string{
+	// CompactDBCmd help.
+	"compactdb--synopsis": "Compacts the database metadata to reclaim disk space.\n" +
+		"Transactions and blocks continue to be processed while the compaction is in progress.\n" +
+		"NOTE: This is a btcd extension and is only supported by some database backends.",
+	"compactdb--result0": "The string 'Done.'",
+
 	// DebugLevelCmd help.
 	"debuglevel--synopsis": "Dynamically changes the debug logging level.\n" +
 		"The levelspec can either a debug level or of the form:\n" +
@@ -115,6 +121,15 @@ var helpDescsEnUS = map[string]string{
 	"decodescript--synopsis": "Returns a JSON object with information about the provided hex-encoded script.",
 	"decodescript-hexscript": "Hex-encoded script",
 
+	// DeriveAddressesCmd help.
+	"deriveaddresses--synopsis":  "Derives one or more addresses from an output descriptor.",
+	"deriveaddresses-descriptor": "The output descriptor including its checksum",
+	"deriveaddresses-range":      "The end or the [begin,end] range of derivation indexes to derive addresses for, only for ranged descriptors",
+	"deriveaddresses--result0":   "The derived addresses",
+
+	// DescriptorRange help.
+	"descriptorrange-value": "The end index as a number or the [begin,end] indexes as an array of two numbers",
+
 	// EstimateFeeCmd help.
 	"estimatefee--synopsis": "Estimate the fee per kilobyte in satoshis " +
 		"required for a transaction to be mined before a certain number of " +
@@ -147,6 +162,58 @@ var helpDescsEnUS = map[string]string{
 	"getaddednodeinfo--condition1": "dns=true",
 	"getaddednodeinfo--result0":    "List of added peers",
 
+	// GetAddressBalanceCmd help.
+	"getaddressbalance--synopsis": "Returns the balance of the passed addresses.\n" +
+		"NOTE: This requires the address utxo index (--addrutxoindex).",
+	"getaddressbalance-addresses": "The addresses to return the combined balance of",
+
+	// GetAddressBalanceResult help.
+	"getaddressbalanceresult-balance":     "The confirmed balance in satoshis",
+	"getaddressbalanceresult-received":    "The total amount received in confirmed transactions in satoshis",
+	"getaddressbalanceresult-unconfirmed": "The net balance change of unconfirmed transactions in the memory pool in satoshis",
+
+	// GetAddressDeltasCmd help.
+	"getaddressdeltas--synopsis": "Returns the confirmed balance changes of the passed addresses ordered by their position in the chain.\n" +
+		"NOTE: This requires the address utxo index (--addrutxoindex).",
+	"getaddressdeltas-addresses": "The addresses to return the balance changes of",
+	"getaddressdeltas-start":     "The height of the first block to include",
+	"getaddressdeltas-end":       "The height of the last block to include (default: the current best height)",
+
+	// GetAddressDeltasResult help.
+	"getaddressdeltasresult-satoshis":   "The amount the balance changes by in satoshis (negative for spends)",
+	"getaddressdeltasresult-txid":       "The hash of the transaction",
+	"getaddressdeltasresult-index":      "The index of the output that credits the address or of the input that spends from it",
+	"getaddressdeltasresult-blockindex": "The index of the transaction within the block",
+	"getaddressdeltasresult-height":     "The height of the block containing the transaction",
+	"getaddressdeltasresult-address":    "The address",
+
+	// GetAddressMempoolCmd help.
+	"getaddressmempool--synopsis": "Returns the balance changes of the passed addresses caused by transactions in the memory pool.\n" +
+		"NOTE: This requires the address utxo index (--addrutxoindex).",
+	"getaddressmempool-addresses": "The addresses to return the balance changes of",
+
+	// GetAddressMempoolResult help.
+	"getaddressmempoolresult-address":   "The address",
+	"getaddressmempoolresult-txid":      "The hash of the transaction",
+	"getaddressmempoolresult-index":     "The index of the output that credits the address or of the input that spends from it",
+	"getaddressmempoolresult-satoshis":  "The amount the balance changes by in satoshis (negative for spends)",
+	"getaddressmempoolresult-timestamp": "The time the transaction was added to the memory pool in seconds since 1 Jan 1970 GMT",
+	"getaddressmempoolresult-prevtxid":  "The hash of the transaction that created the spent output (only for spends)",
+	"getaddressmempoolresult-prevout":   "The index of the spent output (only for spends)",
+
+	// GetAddressUtxosCmd help.
+	"getaddressutxos--synopsis": "Returns the confirmed unspent outputs that pay to the passed addresses.\n" +
+		"NOTE: This requires the address utxo index (--addrutxoindex).",
+	"getaddressutxos-addresses": "The addresses to return the unspent outputs of",
+
+	// GetAddressUtxosResult help.
+	"getaddressutxosresult-address":     "The address",
+	"getaddressutxosresult-txid":        "The hash of the transaction that created the output",
+	"getaddressutxosresult-outputIndex": "The index of the output",
+	"getaddressutxosresult-script":      "The hex-encoded public key script of the output",
+	"getaddressutxosresult-satoshis":    "The amount of the output in satoshis",
+	"getaddressutxosresult-height":      "The height of the block containing the output",
+
 	// GetBestBlockResult help.
 	"getbestblockresult-hash":   "Hex-encoded bytes of the best block hash",
 	"getbestblockresult-height": "Height of the best block",
@@ -287,6 +354,53 @@ var helpDescsEnUS = map[string]string{
 	"getblockheaderverboseresult-previousblockhash": "The hash of the previous block",
 	"getblockheaderverboseresult-nextblockhash":     "The hash of the next block (only if there is one)",
 
+	// GetBlockStatsCmd help.
+	"getblockstats--synopsis": "Returns statistics about a block in the main chain.\n" +
+		"NOTE: This requires the block stats index (--blockstatsindex).",
+	"getblockstats-hashorheight": "The hash or the height of the block",
+	"getblockstats-stats":        "The names of the statistics to return (default: all)",
+
+	// HashOrHeight help.
+	"hashorheight-value": "The hex-encoded block hash as a string or the block height as a number",
+
+	// GetBlockStatsRangeCmd help.
+	"getblockstatsrange--synopsis": "Returns statistics about the blocks in the main chain with heights in an inclusive range of at most 1000 heights ordered by height.\n" +
+		"NOTE: This requires the block stats index (--blockstatsindex).",
+	"getblockstatsrange-startheight": "The height of the first block",
+	"getblockstatsrange-endheight":   "The height of the last block; heights beyond the tip of the index are skipped",
+	"getblockstatsrange-stats":       "The names of the statistics to return for every block (default: all)",
+
+	// GetBlockStatsResult help.
+	"getblockstatsresult-avgfee":              "Average fee in the block",
+	"getblockstatsresult-avgfeerate":          "Average fee rate in gro per virtual byte",
+	"getblockstatsresult-avgtxsize":           "Average transaction size",
+	"getblockstatsresult-feerate_percentiles": "Fee rates at the 10th, 25th, 50th, 75th, and 90th percentile weight unit in gro per virtual byte",
+	"getblockstatsresult-blockhash":           "The block hash",
+	"getblockstatsresult-height":              "The height of the block",
+	"getblockstatsresult-ins":                 "The number of inputs excluding the coinbase",
+	"getblockstatsresult-maxfee":              "Maximum fee in the block",
+	"getblockstatsresult-maxfeerate":          "Maximum fee rate in gro per virtual byte",
+	"getblockstatsresult-maxtxsize":           "Maximum transaction size",
+	"getblockstatsresult-medianfee":           "Truncated median fee in the block",
+	"getblockstatsresult-mediantime":          "The median time of the block and the ten blocks before it",
+	"getblockstatsresult-mediantxsize":        "Truncated median transaction size",
+	"getblockstatsresult-minfee":              "Minimum fee in the block",
+	"getblockstatsresult-minfeerate":          "Minimum fee rate in gro per virtual byte",
+	"getblockstatsresult-mintxsize":           "Minimum transaction size",
+	"getblockstatsresult-outs":                "The number of outputs",
+	"getblockstatsresult-swtotal_size":        "Total size of all segwit transactions",
+	"getblockstatsresult-swtotal_weight":      "Total weight of all segwit transactions",
+	"getblockstatsresult-swtxs":               "The number of segwit transactions",
+	"getblockstatsresult-subsidy":             "The block subsidy",
+	"getblockstatsresult-time":                "The block time in seconds since 1 Jan 1970 GMT",
+	"getblockstatsresult-totalfee":            "The sum of all fees in the block",
+	"getblockstatsresult-total_out":           "Total amount in all outputs excluding the coinbase",
+	"getblockstatsresult-total_size":          "Total size of all transactions excluding the coinbase",
+	"getblockstatsresult-total_weight":        "Total weight of all transactions excluding the coinbase",
+	"getblockstatsresult-txs":                 "The number of transactions including the coinbase",
+	"getblockstatsresult-utxo_increase":       "The increase in the number of unspent outputs",
+	"getblockstatsresult-utxo_size_inc":       "The approximate increase in the size of the unspent output set in bytes",
+
 	// TemplateRequest help.
 	"templaterequest-mode":         "This is 'template', 'proposal', or omitted",
 	"templaterequest-capabilities": "List of capabilities",
@@ -367,6 +481,17 @@ var helpDescsEnUS = map[string]string{
 	"getcurrentnet--synopsis": "Get groestlcoin network the server is running on.",
 	"getcurrentnet--result0":  "The network identifer",
 
+	// GetDescriptorInfoCmd help.
+	"getdescriptorinfo--synopsis":  "Analyses an output descriptor.",
+	"getdescriptorinfo-descriptor": "The output descriptor with or without checksum",
+
+	// GetDescriptorInfoResult help.
+	"getdescriptorinforesult-descriptor":     "The descriptor in canonical form without private keys, including its checksum",
+	"getdescriptorinforesult-checksum":       "The checksum of the passed descriptor",
+	"getdescriptorinforesult-isrange":        "Whether the descriptor is ranged",
+	"getdescriptorinforesult-issolvable":     "Whether the descriptor is solvable",
+	"getdescriptorinforesult-hasprivatekeys": "Whether the descriptor includes at least one private key",
+
 	// GetDifficultyCmd help.
 	"getdifficulty--synopsis": "Returns the proof-of-work difficulty as a multiple of the minimum difficulty.",
 	"getdifficulty--result0":  "The difficulty",
@@ -468,27 +593,30 @@ var helpDescsEnUS = map[string]string{
 	"getnodeaddresses--result0":  "List of node addresses",
 
 	// GetPeerInfoResult help.
-	"getpeerinforesult-id":             "A unique node ID",
-	"getpeerinforesult-addr":           "The ip address and port of the peer",
-	"getpeerinforesult-addrlocal":      "Local address",
-	"getpeerinforesult-services":       "Services bitmask which represents the services supported by the peer",
-	"getpeerinforesult-relaytxes":      "Peer has requested transactions be relayed to it",
-	"getpeerinforesult-lastsend":       "Time the last message was received in seconds since 1 Jan 1970 GMT",
-	"getpeerinforesult-lastrecv":       "Time the last message was sent in seconds since 1 Jan 1970 GMT",
-	"getpeerinforesult-bytessent":      "Total bytes sent",
-	"getpeerinforesult-bytesrecv":      "Total bytes received",
-	"getpeerinforesult-conntime":       "Time the connection was made in seconds since 1 Jan 1970 GMT",
-	"getpeerinforesult-timeoffset":     "The time offset of the peer",
-	"getpeerinforesult-pingtime":       "Number of microseconds the last ping took",
-	"getpeerinforesult-pingwait":       "Number of microseconds a queued ping has been waiting for a response",
-	"getpeerinforesult-version":        "The protocol version of the peer",
-	"getpeerinforesult-subver":         "The user agent of the peer",
-	"getpeerinforesult-inbound":        "Whether or not the peer is an inbound connection",
-	"getpeerinforesult-startingheight": "The latest block height the peer knew about when the connection was established",
-	"getpeerinforesult-currentheight":  "The current height of the peer",
-	"getpeerinforesult-banscore":       "The ban score",
-	"getpeerinforesult-feefilter":      "The requested minimum fee a transaction must have to be announced to the peer",
-	"getpeerinforesult-syncnode":       "Whether or not the peer is the sync peer",
+	"getpeerinforesult-id":                      "A unique node ID",
+	"getpeerinforesult-addr":                    "The ip address and port of the peer",
+	"getpeerinforesult-addrlocal":               "Local address",
+	"getpeerinforesult-services":                "Services bitmask which represents the services supported by the peer",
+	"getpeerinforesult-relaytxes":               "Peer has requested transactions be relayed to it",
+	"getpeerinforesult-lastsend":                "Time the last message was received in seconds since 1 Jan 1970 GMT",
+	"getpeerinforesult-lastrecv":                "Time the last message was sent in seconds since 1 Jan 1970 GMT",
+	"getpeerinforesult-bytessent":               "Total bytes sent",
+	"getpeerinforesult-bytesrecv":               "Total bytes received",
+	"getpeerinforesult-conntime":                "Time the connection was made in seconds since 1 Jan 1970 GMT",
+	"getpeerinforesult-timeoffset":              "The time offset of the peer",
+	"getpeerinforesult-pingtime":                "Number of microseconds the last ping took",
+	"getpeerinforesult-pingwait":                "Number of microseconds a queued ping has been waiting for a response",
+	"getpeerinforesult-version":                 "The protocol version of the peer",
+	"getpeerinforesult-subver":                  "The user agent of the peer",
+	"getpeerinforesult-inbound":                 "Whether or not the peer is an inbound connection",
+	"getpeerinforesult-startingheight":          "The latest block height the peer knew about when the connection was established",
+	"getpeerinforesult-currentheight":           "The current height of the peer",
+	"getpeerinforesult-banscore":                "The ban score",
+	"getpeerinforesult-feefilter":               "The requested minimum fee a transaction must have to be announced to the peer",
+	"getpeerinforesult-syncnode":                "Whether or not the peer is the sync peer",
+	"getpeerinforesult-transport_protocol_type": "The transport protocol of the connection, either v1 or v2 (BIP0324)",
+	"getpeerinforesult-session_id":              "The hex encoded session ID of the v2 transport, empty for the v1 transport",
+	"getpeerinforesult-connection_type":         "The type of the connection, which is one of inbound, manual, outbound-full-relay, block-relay-only or feeler",
 
 	// GetPeerInfoCmd help.
 	"getpeerinfo--synopsis": "Returns data about each connected network peer as an array of json objects.",
@@ -519,6 +647,17 @@ var helpDescsEnUS = map[string]string{
 	"getrawtransaction--condition1": "verbose=true",
 	"getrawtransaction--result0":    "Hex-encoded bytes of the serialized transaction",
 
+	// GetSpentInfoCmd help.
+	"getspentinfo--synopsis": "Returns the transaction input in the main chain that spends an output.\n" +
+		"NOTE: This requires the spent output index (--spendindex).",
+	"getspentinfo-txid":  "The hash of the transaction that created the output",
+	"getspentinfo-index": "The index of the output",
+
+	// GetSpentInfoResult help.
+	"getspentinforesult-txid":   "The hash of the spending transaction",
+	"getspentinforesult-index":  "The index of the spending input",
+	"getspentinforesult-height": "The height of the block containing the spending transaction",
+
 	// GetTxOutResult help.
 	"gettxoutresult-bestblock":     "The block hash that contains the transaction output",
 	"gettxoutresult-confirmations": "The number of confirmations",
@@ -545,6 +684,40 @@ var helpDescsEnUS = map[string]string{
 	"ping--synopsis": "Queues a ping to be sent to each connected peer.\n" +
 		"Ping times are provided by getpeerinfo via the pingtime and pingwait fields.",
 
+	// ScanTxOutSetCmd help.
+	"scantxoutset--synopsis": "Scans the UTXO set for unspent outputs matching output descriptors.\n" +
+		"The start action returns once the scan completes, while the status and abort actions query the progress of or abort the scan in progress.\n" +
+		"Only one scan can be in progress at a time.",
+	"scantxoutset-action":      "The action to perform: \"start\" to scan, \"abort\" to abort the scan in progress, or \"status\" to return its progress",
+	"scantxoutset-scanobjects": "Output descriptors to scan for, either as strings or as objects with a range, required for the start action",
+	"scantxoutset--condition0": "action=start",
+	"scantxoutset--condition1": "action=status",
+	"scantxoutset--condition2": "action=abort",
+	"scantxoutset--result2":    "Whether a scan was aborted",
+
+	// ScanObject help.
+	"scanobject-desc":  "The output descriptor; addr(ADDRESS) and raw(HEX) descriptors match addresses and raw scripts",
+	"scanobject-range": "The end or the [begin,end] range of derivation indexes to scan for ranged descriptors (default: 1000)",
+
+	// ScanTxOutSetResult help.
+	"scantxoutsetresult-success":      "Whether the scan completed without being aborted",
+	"scantxoutsetresult-txouts":       "The number of unspent outputs scanned",
+	"scantxoutsetresult-height":       "The height of the main chain tip when the scan completed",
+	"scantxoutsetresult-bestblock":    "The hash of the main chain tip when the scan completed",
+	"scantxoutsetresult-unspents":     "The matching unspent outputs",
+	"scantxoutsetresult-total_amount": "The total amount of the matching unspent outputs in GRS",
+
+	// ScanTxOutSetUnspent help.
+	"scantxoutsetunspent-txid":         "The hash of the transaction",
+	"scantxoutsetunspent-vout":         "The index of the output",
+	"scantxoutsetunspent-scriptPubKey": "The hex-encoded output script",
+	"scantxoutsetunspent-desc":         "The descriptor of the output script",
+	"scantxoutsetunspent-amount":       "The amount of the output in GRS",
+	"scantxoutsetunspent-height":       "The height of the block containing the output",
+
+	// ScanTxOutSetStatusResult help.
+	"scantxoutsetstatusresult-progress": "The approximate progress of the scan in percent",
+
 	// SearchRawTransactionsCmd help.
 	"searchrawtransactions--synopsis": "Returns raw data for transactions involving the passed address.\n" +
 		"Returned transactions are pulled from both the database, and transactions currently in the mempool.\n" +
@@ -669,6 +842,12 @@ var helpDescsEnUS = map[string]string{
 	"loadtxfilter-reload":    "Load a new filter instead of adding data to an existing one",
 	"loadtxfilter-addresses": "Array of addresses to add to the transaction filter",
 	"loadtxfilter-outpoints": "Array of outpoints to add to the transaction filter",
+	"loadtxfilter-descriptors": "Array of output descriptors whose addresses to add to the transaction filter.\n" +
+		"The addresses of ranged descriptors are derived until gaplimit consecutive addresses after the last one used by a matching transaction are watched",
+
+	// TxFilterDescriptor help.
+	"txfilterdescriptor-desc":     "The output descriptor",
+	"txfilterdescriptor-gaplimit": "The number of unused addresses to watch after the last used one for ranged descriptors (default: 20, max: 10000)",
 
 	// Rescan help.
 	"rescan--synopsis": "Rescan block chain for transactions to addresses.\n" +
@@ -683,8 +862,20 @@ var helpDescsEnUS = map[string]string{
 	// RescanBlocks help.
 	"rescanblocks--synopsis":   "Rescan blocks for transactions matching the loaded transaction filter.",
 	"rescanblocks-blockhashes": "List of hashes to rescan.  Each next block must be a child of the previous.",
+	"rescanblocks-descriptors": "Array of output descriptors whose addresses to add to the transaction filter before rescanning, which is created when none is loaded",
 	"rescanblocks--result0":    "List of matching blocks.",
 
+	// ResumeNotificationsCmd help.
+	"resumenotifications--synopsis": "Replay the block and relevant transaction notifications a reconnecting client missed since the last notification it processed.\n" +
+		"The client must register for block notifications and load its transaction filter before resuming.\n" +
+		"Replayed notifications carry their original sequence numbers and may be sent before or after the reply.",
+	"resumenotifications-blockhash": "Hash of the last block the client received a connected notification for, used when the sequence number is omitted or no longer available",
+	"resumenotifications-sequence":  "Sequence number of the last notification processed by the client",
+
+	// ResumeNotificationsResult help.
+	"resumenotificationsresult-sequence": "The sequence number of the most recent event, after which live notifications continue",
+	"resumenotificationsresult-replayed": "The number of block and transaction events since the resume point",
+
 	// RescannedBlock help.
 	"rescannedblock-hash":         "Hash of the matching block.",
 	"rescannedblock-transactions": "List of matching transactions, serialized and hex-encoded.",
@@ -713,25 +904,34 @@ var helpDescsEnUS = map[string]string{
 // pointer to the type (or nil to indicate no return value).
 var rpcResultTypes = map[string][]interface{}{
 	"addnode":                nil,
+	"compactdb":              {(*string)(nil)},
 	"createrawtransaction":   {(*string)(nil)},
 	"debuglevel":             {(*string)(nil), (*string)(nil)},
 	"decoderawtransaction":   {(*btcjson.TxRawDecodeResult)(nil)},
 	"decodescript":           {(*btcjson.DecodeScriptResult)(nil)},
+	"deriveaddresses":        {(*btcjson.DeriveAddressesResult)(nil)},
 	"estimatefee":            {(*float64)(nil)},
 	"generate":               {(*[]string)(nil)},
 	"getaddednodeinfo":       {(*[]string)(nil), (*[]btcjson.GetAddedNodeInfoResult)(nil)},
+	"getaddressbalance":      {(*btcjson.GetAddressBalanceResult)(nil)},
+	"getaddressdeltas":       {(*[]btcjson.GetAddressDeltasResult)(nil)},
+	"getaddressmempool":      {(*[]btcjson.GetAddressMempoolResult)(nil)},
+	"getaddressutxos":        {(*[]btcjson.GetAddressUtxosResult)(nil)},
 	"getbestblock":           {(*btcjson.GetBestBlockResult)(nil)},
 	"getbestblockhash":       {(*string)(nil)},
 	"getblock":               {(*string)(nil), (*btcjson.GetBlockVerboseResult)(nil)},
 	"getblockcount":          {(*int64)(nil)},
 	"getblockhash":           {(*string)(nil)},
 	"getblockheader":         {(*string)(nil), (*btcjson.GetBlockHeaderVerboseResult)(nil)},
+	"getblockstats":          {(*btcjson.GetBlockStatsResult)(nil)},
+	"getblockstatsrange":     {(*[]btcjson.GetBlockStatsResult)(nil)},
 	"getblocktemplate":       {(*btcjson.GetBlockTemplateResult)(nil), (*string)(nil), nil},
 	"getblockchaininfo":      {(*btcjson.GetBlockChainInfoResult)(nil)},
 	"getcfilter":             {(*string)(nil)},
 	"getcfilterheader":       {(*string)(nil)},
 	"getconnectioncount":     {(*int32)(nil)},
 	"getcurrentnet":          {(*uint32)(nil)},
+	"getdescriptorinfo":      {(*btcjson.GetDescriptorInfoResult)(nil)},
 	"getdifficulty":          {(*float64)(nil)},
 	"getgenerate":            {(*bool)(nil)},
 	"gethashespersec":        {(*float64)(nil)},
@@ -745,10 +945,12 @@ var rpcResultTypes = map[string][]interface{}{
 	"getpeerinfo":            {(*[]btcjson.GetPeerInfoResult)(nil)},
 	"getrawmempool":          {(*[]string)(nil), (*btcjson.GetRawMempoolVerboseResult)(nil)},
 	"getrawtransaction":      {(*string)(nil), (*btcjson.TxRawResult)(nil)},
+	"getspentinfo":           {(*btcjson.GetSpentInfoResult)(nil)},
 	"gettxout":               {(*btcjson.GetTxOutResult)(nil)},
 	"node":                   nil,
 	"help":                   {(*string)(nil), (*string)(nil)},
 	"ping":                   nil,
+	"scantxoutset":           {(*btcjson.ScanTxOutSetResult)(nil), (*btcjson.ScanTxOutSetStatusResult)(nil), (*bool)(nil)},
 	"searchrawtransactions":  {(*string)(nil), (*[]btcjson.SearchRawTransactionsResult)(nil)},
 	"sendrawtransaction":     {(*string)(nil)},
 	"setgenerate":            nil,
@@ -774,6 +976,7 @@ var rpcResultTypes = map[string][]interface{}{
 	"stopnotifyspent":           nil,
 	"rescan":                    nil,
 	"rescanblocks":              {(*[]btcjson.RescannedBlock)(nil)},
+	"resumenotifications":       {(*btcjson.ResumeNotificationsResult)(nil)},
 }
 
 // helpCacher provides a concurrent safe type that provides help and usage for
@@ -8,9 +8,6 @@ package main
 import (
 	"bytes"
 	"container/list"
-	"crypto/sha256"
-	"crypto/subtle"
-	"encoding/base64"
 	"encoding/hex"
 	"encoding/json"
 	"errors"
@@ -25,9 +22,11 @@ import (
 	"github.com/btcsuite/btcd/chaincfg"
 	"github.com/btcsuite/btcd/chaincfg/chainhash"
 	"github.com/btcsuite/btcd/database"
+	"github.com/btcsuite/btcd/descriptor"
 	"github.com/btcsuite/btcd/txscript"
 	"github.com/btcsuite/btcd/wire"
 	"github.com/btcsuite/btcutil"
+	"github.com/btcsuite/btcutil/hdkeychain"
 	"github.com/btcsuite/websocket"
 	"golang.org/x/crypto/ripemd160"
 )
@@ -39,6 +38,29 @@ const (
 	// handler since notifications have their own queuing mechanism
 	// independent of the send channel buffer.
 	websocketSendBufferSize = 50
+
+	// defaultDescriptorGapLimit is the number of consecutive addresses
+	// after the last used one that are watched for ranged descriptors added
+	// to a transaction filter when no gap limit is specified.
+	defaultDescriptorGapLimit = 20
+
+	// maxDescriptorGapLimit is the maximum gap limit that may be specified
+	// for descriptors added to a transaction filter.
+	maxDescriptorGapLimit = 10000
+)
+
+// Policies applied when the notification queue of a websocket client is full.
+const (
+	// wsOverflowDisconnect disconnects the client so it can reconnect and
+	// resume its notifications with the resumenotifications command.
+	wsOverflowDisconnect = "disconnect"
+
+	// wsOverflowDropOldest drops the oldest queued notification to make
+	// room for the new one.
+	wsOverflowDropOldest = "dropoldest"
+
+	// wsOverflowDropNewest drops the new notification.
+	wsOverflowDropNewest = "dropnewest"
 )
 
 type semaphore chan struct{}
@@ -56,7 +78,7 @@ var timeZeroVal time.Time
 
 // wsCommandHandler describes a callback function used to handle a specific
 // command.
-type wsCommandHandler func(*wsClient, interface{}) (interface{}, error)
+type wsCommandHandler func(*wsClient, interface{}, *rpcRequest) (interface{}, error)
 
 // wsHandlers maps RPC command strings to appropriate websocket handler
 // functions.  This is set by init because help references wsHandlers and thus
@@ -76,6 +98,7 @@ var wsHandlersBeforeInit = map[string]wsCommandHandler{
 	"stopnotifyreceived":        handleStopNotifyReceived,
 	"rescan":                    handleRescan,
 	"rescanblocks":              handleRescanBlocks,
+	"resumenotifications":       handleResumeNotifications,
 }
 
 // WebsocketHandler handles a new websocket client by creating a new wsClient,
@@ -84,7 +107,7 @@ var wsHandlersBeforeInit = map[string]wsCommandHandler{
 // server handler which runs each new connection in a new goroutine thereby
 // satisfying the requirement.
 func (s *rpcServer) WebsocketHandler(conn *websocket.Conn, remoteAddr string,
-	authenticated bool, isAdmin bool) {
+	user *rpcUser) {
 
 	// Clear the read deadline that was set before the websocket hijacked
 	// the connection.
@@ -103,7 +126,7 @@ func (s *rpcServer) WebsocketHandler(conn *websocket.Conn, remoteAddr string,
 	// Create a new websocket client to handle the new websocket connection
 	// and wait for it to shutdown.  Once it has shutdown (and hence
 	// disconnected), remove it and any notifications it registered for.
-	client, err := newWebsocketClient(s, conn, remoteAddr, authenticated, isAdmin)
+	client, err := newWebsocketClient(s, conn, remoteAddr, user)
 	if err != nil {
 		rpcsLog.Errorf("Failed to serve client %s: %v", remoteAddr, err)
 		conn.Close()
@@ -139,6 +162,11 @@ type wsNotificationManager struct {
 	// Access channel for current number of connected clients.
 	numClients chan int
 
+	// journal records the most recent block and transaction events so
+	// reconnecting clients can resume their notifications.  Owned by the
+	// notification handler.
+	journal *wsJournal
+
 	// Shutdown handling
 	wg   sync.WaitGroup
 	quit chan struct{}
@@ -266,6 +294,65 @@ type wsClientFilter struct {
 
 	// Outpoints of unspent outputs.
 	unspent map[wire.OutPoint]struct{}
+
+	// Addresses derived from output descriptors keyed by their encoded
+	// form, used to extend the derivation of ranged descriptors when one
+	// of their addresses is used.  An address described by more than one
+	// descriptor, or at more than one derivation index, is tracked for
+	// each of them.
+	descriptorAddrs map[string][]wsDescriptorAddr
+}
+
+// wsFilterDescriptor tracks the addresses derived from an output descriptor
+// added to a wsClientFilter.
+type wsFilterDescriptor struct {
+	desc     *descriptor.Descriptor
+	gapLimit uint32
+
+	// derived is the number of addresses derived so far, which is also the
+	// next derivation index of ranged descriptors.
+	derived uint32
+}
+
+// wsDescriptorAddr identifies an address derived from an output descriptor.
+type wsDescriptorAddr struct {
+	desc  *wsFilterDescriptor
+	index uint32
+}
+
+// parseFilterDescriptors parses the descriptors passed to the loadtxfilter and
+// rescanblocks commands.
+func parseFilterDescriptors(descs *[]btcjson.TxFilterDescriptor, params *chaincfg.Params) ([]*wsFilterDescriptor, error) {
+	if descs == nil {
+		return nil, nil
+	}
+
+	filterDescs := make([]*wsFilterDescriptor, 0, len(*descs))
+	for _, d := range *descs {
+		desc, err := descriptor.Parse(d.Descriptor, params)
+		if err != nil {
+			return nil, &btcjson.RPCError{
+				Code:    btcjson.ErrRPCInvalidParameter,
+				Message: "Invalid descriptor: " + err.Error(),
+			}
+		}
+		gapLimit := uint32(defaultDescriptorGapLimit)
+		if d.GapLimit != nil {
+			gapLimit = *d.GapLimit
+		}
+		if gapLimit == 0 || gapLimit > maxDescriptorGapLimit {
+			return nil, &btcjson.RPCError{
+				Code: btcjson.ErrRPCInvalidParameter,
+				Message: fmt.Sprintf("Gap limit must be between 1 "+
+					"and %d", maxDescriptorGapLimit),
+			}
+		}
+		filterDescs = append(filterDescs, &wsFilterDescriptor{
+			desc:     desc,
+			gapLimit: gapLimit,
+		})
+	}
+	return filterDescs, nil
 }
 
 // newWSClientFilter creates a new, empty wsClientFilter struct to be used
@@ -280,6 +367,7 @@ func newWSClientFilter(addresses []string, unspentOutPoints []wire.OutPoint, par
 		uncompressedPubKeys: map[[65]byte]struct{}{},
 		otherAddresses:      map[string]struct{}{},
 		unspent:             make(map[wire.OutPoint]struct{}, len(unspentOutPoints)),
+		descriptorAddrs:     map[string][]wsDescriptorAddr{},
 	}
 
 	for _, s := range addresses {
@@ -420,6 +508,67 @@ func (f *wsClientFilter) removeAddressStr(s string, params *chaincfg.Params) {
 	}
 }
 
+// addDescriptor adds the addresses described by an output descriptor to the
+// wsClientFilter.  For ranged descriptors, the addresses up to the gap limit
+// are added.
+func (f *wsClientFilter) addDescriptor(d *wsFilterDescriptor) error {
+	end := uint64(1)
+	if d.desc.IsRange() {
+		end = uint64(d.gapLimit)
+	}
+	return f.deriveDescriptorAddrs(d, end)
+}
+
+// deriveDescriptorAddrs adds the addresses of the passed descriptor up to, but
+// not including, the passed derivation index to the wsClientFilter.
+func (f *wsClientFilter) deriveDescriptorAddrs(d *wsFilterDescriptor, end uint64) error {
+	// Derivation indexes of ranged descriptors must not be hardened.
+	if end > hdkeychain.HardenedKeyStart {
+		end = hdkeychain.HardenedKeyStart
+	}
+	for uint64(d.derived) < end {
+		a, err := d.desc.Address(d.derived)
+		if err != nil {
+			return err
+		}
+		f.addAddress(a)
+		encoded := a.EncodeAddress()
+		f.descriptorAddrs[encoded] = append(f.descriptorAddrs[encoded],
+			wsDescriptorAddr{desc: d, index: d.derived})
+		d.derived++
+	}
+	return nil
+}
+
+// markAddressUsed extends the derivation of the ranged descriptors the passed
+// address was derived from, if any, so the addresses up to the gap limit after
+// it are added to the wsClientFilter.
+func (f *wsClientFilter) markAddressUsed(a btcutil.Address) {
+	if len(f.descriptorAddrs) == 0 {
+		return
+	}
+
+	// Pay-to-pubkey outputs are matched by the hash of their public key.
+	if pubKeyAddr, ok := a.(*btcutil.AddressPubKey); ok {
+		a = pubKeyAddr.AddressPubKeyHash()
+	}
+	// Copy the descriptor addresses since deriving further addresses may
+	// add to them.
+	descAddrs := append([]wsDescriptorAddr(nil),
+		f.descriptorAddrs[a.EncodeAddress()]...)
+	for _, descAddr := range descAddrs {
+		if !descAddr.desc.desc.IsRange() {
+			continue
+		}
+		end := uint64(descAddr.index) + 1 + uint64(descAddr.desc.gapLimit)
+		err := f.deriveDescriptorAddrs(descAddr.desc, end)
+		if err != nil {
+			rpcsLog.Warnf("Failed to derive descriptor addresses: %v",
+				err)
+		}
+	}
+}
+
 // addUnspentOutPoint adds an outpoint to the wsClientFilter.
 //
 // NOTE: This extension was ported from github.com/decred/dcrd
@@ -453,6 +602,12 @@ type notificationTxAcceptedByMempool struct {
 }
 
 // Notification control requests
+type notificationResume struct {
+	wsc       *wsClient
+	blockHash *chainhash.Hash
+	sequence  *uint64
+	reply     chan *resumeReply
+}
 type notificationRegisterClient wsClient
 type notificationUnregisterClient wsClient
 type notificationRegisterBlocks wsClient
@@ -505,6 +660,11 @@ out:
 			switch n := n.(type) {
 			case *notificationBlockConnected:
 				block := (*btcutil.Block)(n)
+				sequence := m.journal.add(&wsJournalEntry{
+					blockHash:   *block.Hash(),
+					blockHeight: block.Height(),
+					connected:   true,
+				})
 
 				// Skip iterating through all txs if no
 				// tx notification requests exist.
@@ -517,27 +677,36 @@ out:
 
 				if len(blockNotifications) != 0 {
 					m.notifyBlockConnected(blockNotifications,
-						block)
+						block, sequence)
 					m.notifyFilteredBlockConnected(blockNotifications,
-						block)
+						block, sequence)
 				}
 
 			case *notificationBlockDisconnected:
 				block := (*btcutil.Block)(n)
+				sequence := m.journal.add(&wsJournalEntry{
+					blockHash:   *block.Hash(),
+					blockHeight: block.Height(),
+				})
 
 				if len(blockNotifications) != 0 {
 					m.notifyBlockDisconnected(blockNotifications,
-						block)
+						block, sequence)
 					m.notifyFilteredBlockDisconnected(blockNotifications,
-						block)
+						block, sequence)
 				}
 
 			case *notificationTxAcceptedByMempool:
+				sequence := m.journal.add(&wsJournalEntry{tx: n.tx})
 				if n.isNew && len(txNotifications) != 0 {
 					m.notifyForNewTx(txNotifications, n.tx)
 				}
 				m.notifyForTx(watchedOutPoints, watchedAddrs, n.tx, nil)
-				m.notifyRelevantTxAccepted(n.tx, clients)
+				m.notifyRelevantTxAccepted(n.tx, clients, sequence)
+
+			case *notificationResume:
+				_, blocks := blockNotifications[n.wsc.quit]
+				n.reply <- m.resumeNotifications(n, blocks)
 
 			case *notificationRegisterBlocks:
 				wsc := (*wsClient)(n)
@@ -678,6 +847,7 @@ func (m *wsNotificationManager) subscribedClients(tx *btcutil.Tx,
 						Index: uint32(i),
 					}
 					filter.addUnspentOutPoint(&op)
+					filter.markAddressUsed(a)
 				}
 			}
 			filter.mu.Unlock()
@@ -690,12 +860,13 @@ func (m *wsNotificationManager) subscribedClients(tx *btcutil.Tx,
 // notifyBlockConnected notifies websocket clients that have registered for
 // block updates when a block is connected to the main chain.
 func (*wsNotificationManager) notifyBlockConnected(clients map[chan struct{}]*wsClient,
-	block *btcutil.Block) {
+	block *btcutil.Block, sequence uint64) {
 
 	// Notify interested websocket clients about the connected block.
 	ntfn := btcjson.NewBlockConnectedNtfn(block.Hash().String(), block.Height(),
 		block.MsgBlock().Header.Timestamp.Unix())
-	marshalledJSON, err := btcjson.MarshalCmd(btcjson.RpcVersion1, nil, ntfn)
+	marshalledJSON, err := btcjson.MarshalCmdWithSequence(btcjson.RpcVersion1,
+		ntfn, sequence)
 	if err != nil {
 		rpcsLog.Errorf("Failed to marshal block connected notification: "+
 			"%v", err)
@@ -709,7 +880,9 @@ func (*wsNotificationManager) notifyBlockConnected(clients map[chan struct{}]*ws
 // notifyBlockDisconnected notifies websocket clients that have registered for
 // block updates when a block is disconnected from the main chain (due to a
 // reorganize).
-func (*wsNotificationManager) notifyBlockDisconnected(clients map[chan struct{}]*wsClient, block *btcutil.Block) {
+func (*wsNotificationManager) notifyBlockDisconnected(clients map[chan struct{}]*wsClient,
+	block *btcutil.Block, sequence uint64) {
+
 	// Skip notification creation if no clients have requested block
 	// connected/disconnected notifications.
 	if len(clients) == 0 {
@@ -719,7 +892,8 @@ func (*wsNotificationManager) notifyBlockDisconnected(clients map[chan struct{}]
 	// Notify interested websocket clients about the disconnected block.
 	ntfn := btcjson.NewBlockDisconnectedNtfn(block.Hash().String(),
 		block.Height(), block.MsgBlock().Header.Timestamp.Unix())
-	marshalledJSON, err := btcjson.MarshalCmd(btcjson.RpcVersion1, nil, ntfn)
+	marshalledJSON, err := btcjson.MarshalCmdWithSequence(btcjson.RpcVersion1,
+		ntfn, sequence)
 	if err != nil {
 		rpcsLog.Errorf("Failed to marshal block disconnected "+
 			"notification: %v", err)
@@ -733,7 +907,7 @@ func (*wsNotificationManager) notifyBlockDisconnected(clients map[chan struct{}]
 // notifyFilteredBlockConnected notifies websocket clients that have registered for
 // block updates when a block is connected to the main chain.
 func (m *wsNotificationManager) notifyFilteredBlockConnected(clients map[chan struct{}]*wsClient,
-	block *btcutil.Block) {
+	block *btcutil.Block, sequence uint64) {
 
 	// Create the common portion of the notification that is the same for
 	// every client.
@@ -765,7 +939,8 @@ func (m *wsNotificationManager) notifyFilteredBlockConnected(clients map[chan st
 		ntfn.SubscribedTxs = subscribedTxs[quitChan]
 
 		// Marshal and queue notification.
-		marshalledJSON, err := btcjson.MarshalCmd(btcjson.RpcVersion1, nil, ntfn)
+		marshalledJSON, err := btcjson.MarshalCmdWithSequence(
+			btcjson.RpcVersion1, ntfn, sequence)
 		if err != nil {
 			rpcsLog.Errorf("Failed to marshal filtered block "+
 				"connected notification: %v", err)
@@ -779,7 +954,7 @@ func (m *wsNotificationManager) notifyFilteredBlockConnected(clients map[chan st
 // block updates when a block is disconnected from the main chain (due to a
 // reorganize).
 func (*wsNotificationManager) notifyFilteredBlockDisconnected(clients map[chan struct{}]*wsClient,
-	block *btcutil.Block) {
+	block *btcutil.Block, sequence uint64) {
 	// Skip notification creation if no clients have requested block
 	// connected/disconnected notifications.
 	if len(clients) == 0 {
@@ -796,7 +971,8 @@ func (*wsNotificationManager) notifyFilteredBlockDisconnected(clients map[chan s
 	}
 	ntfn := btcjson.NewFilteredBlockDisconnectedNtfn(block.Height(),
 		hex.EncodeToString(w.Bytes()))
-	marshalledJSON, err := btcjson.MarshalCmd(btcjson.RpcVersion1, nil, ntfn)
+	marshalledJSON, err := btcjson.MarshalCmdWithSequence(btcjson.RpcVersion1,
+		ntfn, sequence)
 	if err != nil {
 		rpcsLog.Errorf("Failed to marshal filtered block disconnected "+
 			"notification: %v", err)
@@ -1041,13 +1217,14 @@ func (m *wsNotificationManager) notifyForTxOuts(ops map[wire.OutPoint]map[chan s
 // watched address result in the output being watched as well for future
 // notifications.
 func (m *wsNotificationManager) notifyRelevantTxAccepted(tx *btcutil.Tx,
-	clients map[chan struct{}]*wsClient) {
+	clients map[chan struct{}]*wsClient, sequence uint64) {
 
 	clientsToNotify := m.subscribedClients(tx, clients)
 
 	if len(clientsToNotify) != 0 {
 		n := btcjson.NewRelevantTxAcceptedNtfn(txHexString(tx.MsgTx()))
-		marshalled, err := btcjson.MarshalCmd(btcjson.RpcVersion1, nil, n)
+		marshalled, err := btcjson.MarshalCmdWithSequence(btcjson.RpcVersion1,
+			n, sequence)
 		if err != nil {
 			rpcsLog.Errorf("Failed to marshal notification: %v", err)
 			return
@@ -1176,6 +1353,235 @@ func (*wsNotificationManager) removeAddrRequest(addrs map[string]map[chan struct
 	}
 }
 
+// wsJournalEntry is a block or transaction event recorded in the notification
+// journal so the notifications it caused can be replayed to clients resuming
+// their notifications.
+type wsJournalEntry struct {
+	sequence uint64
+
+	// blockHash, blockHeight and connected describe block connected and
+	// disconnected events.
+	blockHash   chainhash.Hash
+	blockHeight int32
+	connected   bool
+
+	// tx is the transaction of transaction accepted events and nil for
+	// block events.
+	tx *btcutil.Tx
+}
+
+// wsJournal records the most recent block and transaction events along with
+// their sequence numbers.  It is not safe for concurrent access.
+type wsJournal struct {
+	// size is the maximum number of entries kept.
+	size int
+
+	// entries holds the most recent entries ordered by their consecutive
+	// sequence numbers.
+	entries []*wsJournalEntry
+
+	// sequence is the sequence number of the most recent event.
+	sequence uint64
+}
+
+// newWsJournal returns a journal that keeps the passed number of entries.  The
+// sequence numbers are initialized from the current time in microseconds so
+// the sequence numbers assigned after a restart of the server are larger than
+// the ones assigned before it, and stay within the range of integers that can
+// be represented exactly by JSON decoders using floating point numbers.
+func newWsJournal(size int) *wsJournal {
+	return &wsJournal{
+		size:     size,
+		sequence: uint64(time.Now().UnixNano() / int64(time.Microsecond)),
+	}
+}
+
+// add assigns the next sequence number to the passed entry, records it, and
+// returns the assigned sequence number.  The oldest entry is evicted when the
+// journal is full.
+func (j *wsJournal) add(entry *wsJournalEntry) uint64 {
+	j.sequence++
+	entry.sequence = j.sequence
+	if j.size <= 0 {
+		return j.sequence
+	}
+	if len(j.entries) == j.size {
+		j.entries[0] = nil // avoid leak
+		j.entries = j.entries[1:]
+	}
+	j.entries = append(j.entries, entry)
+	return j.sequence
+}
+
+// entriesAfter returns the entries recorded after the event with the passed
+// sequence number.  The bool return value is false when the journal no longer
+// holds all of them or the sequence number is unknown.
+func (j *wsJournal) entriesAfter(sequence uint64) ([]*wsJournalEntry, bool) {
+	switch {
+	case sequence == j.sequence:
+		return nil, true
+	case sequence > j.sequence || len(j.entries) == 0:
+		return nil, false
+	}
+	oldest := j.entries[0].sequence
+	if sequence+1 < oldest {
+		return nil, false
+	}
+	return j.entries[sequence+1-oldest:], true
+}
+
+// entriesAfterBlock returns the entries recorded after the most recent
+// connection of the block with the passed hash.  The bool return value is false
+// when the journal does not hold the connection of the block.
+func (j *wsJournal) entriesAfterBlock(hash *chainhash.Hash) ([]*wsJournalEntry, bool) {
+	for i := len(j.entries) - 1; i >= 0; i-- {
+		entry := j.entries[i]
+		if entry.tx == nil && entry.connected && entry.blockHash == *hash {
+			return j.entries[i+1:], true
+		}
+	}
+	return nil, false
+}
+
+// resumeReply houses the reply to a request to resume the notifications of a
+// websocket client.
+type resumeReply struct {
+	result *btcjson.ResumeNotificationsResult
+	err    error
+}
+
+// ResumeNotifications replays the notifications the passed websocket client
+// missed since the notification with the passed sequence number or, when it is
+// nil or no longer available, since the connection of the block with the
+// passed hash.  Block notifications are only replayed when the client is
+// registered for them, and relevant transaction notifications are only
+// replayed for transactions matching the loaded transaction filter.
+func (m *wsNotificationManager) ResumeNotifications(wsc *wsClient,
+	blockHash *chainhash.Hash, sequence *uint64) (*btcjson.ResumeNotificationsResult, error) {
+
+	n := &notificationResume{
+		wsc:       wsc,
+		blockHash: blockHash,
+		sequence:  sequence,
+		reply:     make(chan *resumeReply, 1),
+	}
+	select {
+	case m.queueNotification <- n:
+	case <-m.quit:
+		return nil, ErrClientQuit
+	}
+	select {
+	case reply := <-n.reply:
+		return reply.result, reply.err
+	case <-m.quit:
+		return nil, ErrClientQuit
+	}
+}
+
+// resumeNotifications replays the journaled events requested by the passed
+// resume notification to its client.  The blocks flag specifies whether the
+// client is registered for block notifications.  It must only be called from
+// the notification handler.
+func (m *wsNotificationManager) resumeNotifications(n *notificationResume,
+	blocks bool) *resumeReply {
+
+	var entries []*wsJournalEntry
+	var ok bool
+	if n.sequence != nil {
+		entries, ok = m.journal.entriesAfter(*n.sequence)
+	}
+	if !ok {
+		entries, ok = m.journal.entriesAfterBlock(n.blockHash)
+	}
+	if !ok {
+		return &resumeReply{err: &btcjson.RPCError{
+			Code: btcjson.ErrRPCMisc,
+			Message: fmt.Sprintf("Missed notifications since block "+
+				"%v are no longer available -- rescan required",
+				n.blockHash),
+		}}
+	}
+
+	// Ensure the replayed notifications fit into the notification queue
+	// of the client.  Every block event results in two notifications for
+	// clients registered for blocks and every transaction event in at most
+	// one notification for clients with a transaction filter.
+	n.wsc.Lock()
+	hasFilter := n.wsc.filterData != nil
+	n.wsc.Unlock()
+	var numNtfns int
+	for _, entry := range entries {
+		switch {
+		case entry.tx != nil && hasFilter:
+			numNtfns++
+		case entry.tx == nil && blocks:
+			numNtfns += 2
+		}
+	}
+	if numNtfns > cfg.RPCWSQueueSize {
+		return &resumeReply{err: &btcjson.RPCError{
+			Code: btcjson.ErrRPCMisc,
+			Message: fmt.Sprintf("Too many missed notifications (%d) "+
+				"to replay -- rescan required", numNtfns),
+		}}
+	}
+
+	clients := map[chan struct{}]*wsClient{n.wsc.quit: n.wsc}
+	for _, entry := range entries {
+		if entry.tx != nil {
+			if hasFilter {
+				m.notifyRelevantTxAccepted(entry.tx, clients,
+					entry.sequence)
+			}
+			continue
+		}
+		if !blocks {
+			continue
+		}
+
+		block, err := m.fetchBlock(&entry.blockHash)
+		if err != nil {
+			log := rpcsLog.withFields(logFieldBlock,
+				entry.blockHash.String())
+			log.Errorf("Failed to fetch block %v to resume "+
+				"notifications: %v", entry.blockHash, err)
+			return &resumeReply{err: logInternalRPCError(log,
+				err.Error(), "Failed to fetch block")}
+		}
+		block.SetHeight(entry.blockHeight)
+		if entry.connected {
+			m.notifyBlockConnected(clients, block, entry.sequence)
+			m.notifyFilteredBlockConnected(clients, block,
+				entry.sequence)
+		} else {
+			m.notifyBlockDisconnected(clients, block, entry.sequence)
+			m.notifyFilteredBlockDisconnected(clients, block,
+				entry.sequence)
+		}
+	}
+
+	return &resumeReply{result: &btcjson.ResumeNotificationsResult{
+		Sequence: m.journal.sequence,
+		Replayed: len(entries),
+	}}
+}
+
+// fetchBlock loads the block with the passed hash from the database.  Unlike
+// the chain, the database also holds blocks that were disconnected from the
+// main chain.
+func (m *wsNotificationManager) fetchBlock(hash *chainhash.Hash) (*btcutil.Block, error) {
+	var blockBytes []byte
+	err := m.server.cfg.DB.View(func(dbTx database.Tx) error {
+		var err error
+		blockBytes, err = dbTx.FetchBlock(hash)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return btcutil.NewBlockFromBytes(blockBytes)
+}
+
 // AddClient adds the passed websocket client to the notification manager.
 func (m *wsNotificationManager) AddClient(wsc *wsClient) {
 	m.queueNotification <- (*notificationRegisterClient)(wsc)
@@ -1218,6 +1624,7 @@ func newWsNotificationManager(server *rpcServer) *wsNotificationManager {
 		queueNotification: make(chan interface{}),
 		notificationMsgs:  make(chan interface{}),
 		numClients:        make(chan int),
+		journal:           newWsJournal(cfg.RPCWSJournalSize),
 		quit:              make(chan struct{}),
 	}
 }
@@ -1264,9 +1671,10 @@ type wsClient struct {
 	// and therefore is allowed to communicated over the websocket.
 	authenticated bool
 
-	// isAdmin specifies whether a client may change the state of the server;
-	// false means its access is only to the limited set of RPC calls.
-	isAdmin bool
+	// user is the authenticated user of the client, which determines the
+	// RPC calls and notifications the client is authorized to use.  It is
+	// nil until the client has been authenticated.
+	user *rpcUser
 
 	// sessionID is a random ID generated for each client when connected.
 	// These IDs may be queried by a client using the session RPC.  A change
@@ -1392,7 +1800,8 @@ out:
 				continue
 			}
 
-			rpcsLog.Debugf("Received command <%s> from %s", cmd.method, c.addr)
+			cmd.logger().Debugf("Received command <%s> from %s",
+				cmd.method, c.addr)
 
 			// Check auth.  The client is immediately disconnected if the
 			// first request of an unauthentiated websocket client is not
@@ -1410,17 +1819,14 @@ out:
 				break out
 			case !c.authenticated:
 				// Check credentials.
-				login := authCmd.Username + ":" + authCmd.Passphrase
-				auth := "Basic " + base64.StdEncoding.EncodeToString([]byte(login))
-				authSha := sha256.Sum256([]byte(auth))
-				cmp := subtle.ConstantTimeCompare(authSha[:], c.server.authsha[:])
-				limitcmp := subtle.ConstantTimeCompare(authSha[:], c.server.limitauthsha[:])
-				if cmp != 1 && limitcmp != 1 {
+				user := c.server.authenticate(authCmd.Username,
+					authCmd.Passphrase)
+				if user == nil {
 					rpcsLog.Warnf("Auth failure.")
 					break out
 				}
 				c.authenticated = true
-				c.isAdmin = cmp == 1
+				c.user = user
 
 				// Marshal and send response.
 				reply, err = createMarshalledReply(cmd.jsonrpc, cmd.id, nil, nil)
@@ -1433,24 +1839,22 @@ out:
 				continue
 			}
 
-			// Check if the client is using limited RPC credentials and
-			// error when not authorized to call the supplied RPC.
-			if !c.isAdmin {
-				if _, ok := rpcLimited[req.Method]; !ok {
-					jsonErr := &btcjson.RPCError{
-						Code:    btcjson.ErrRPCInvalidParams.Code,
-						Message: "limited user not authorized for this method",
-					}
-					// Marshal and send response.
-					reply, err = createMarshalledReply("", req.ID, nil, jsonErr)
-					if err != nil {
-						rpcsLog.Errorf("Failed to marshal parse failure "+
-							"reply: %v", err)
-						continue
-					}
-					c.SendMessage(reply, nil)
+			// Error when the client is not authorized to call the
+			// supplied RPC.
+			if !c.user.isAuthorized(req.Method) {
+				jsonErr := &btcjson.RPCError{
+					Code:    btcjson.ErrRPCInvalidParams.Code,
+					Message: c.user.unauthorizedMessage(req.Method),
+				}
+				// Marshal and send response.
+				reply, err = createMarshalledReply("", req.ID, nil, jsonErr)
+				if err != nil {
+					rpcsLog.Errorf("Failed to marshal parse failure "+
+						"reply: %v", err)
 					continue
 				}
+				c.SendMessage(reply, nil)
+				continue
 			}
 
 			// Asynchronously handle the request.  A semaphore is used to
@@ -1647,18 +2051,15 @@ out:
 							break out
 						case !c.authenticated:
 							// Check credentials.
-							login := authCmd.Username + ":" + authCmd.Passphrase
-							auth := "Basic " + base64.StdEncoding.EncodeToString([]byte(login))
-							authSha := sha256.Sum256([]byte(auth))
-							cmp := subtle.ConstantTimeCompare(authSha[:], c.server.authsha[:])
-							limitcmp := subtle.ConstantTimeCompare(authSha[:], c.server.limitauthsha[:])
-							if cmp != 1 && limitcmp != 1 {
+							user := c.server.authenticate(authCmd.Username,
+								authCmd.Passphrase)
+							if user == nil {
 								rpcsLog.Warnf("Auth failure.")
 								break out
 							}
 
 							c.authenticated = true
-							c.isAdmin = cmp == 1
+							c.user = user
 
 							// Marshal and send response.
 							reply, err = createMarshalledReply(cmd.jsonrpc, cmd.id, nil, nil)
@@ -1674,37 +2075,36 @@ out:
 							continue
 						}
 
-						// Check if the client is using limited RPC credentials and
-						// error when not authorized to call the supplied RPC.
-						if !c.isAdmin {
-							if _, ok := rpcLimited[req.Method]; !ok {
-								jsonErr := &btcjson.RPCError{
-									Code:    btcjson.ErrRPCInvalidParams.Code,
-									Message: "limited user not authorized for this method",
-								}
-								// Marshal and send response.
-								reply, err = createMarshalledReply(req.Jsonrpc, req.ID, nil, jsonErr)
-								if err != nil {
-									rpcsLog.Errorf("Failed to marshal parse failure "+
-										"reply: %v", err)
-									continue
-								}
-
-								if reply != nil {
-									results = append(results, reply)
-								}
+						// Error when the client is not authorized to call the
+						// supplied RPC.
+						if !c.user.isAuthorized(req.Method) {
+							jsonErr := &btcjson.RPCError{
+								Code:    btcjson.ErrRPCInvalidParams.Code,
+								Message: c.user.unauthorizedMessage(req.Method),
+							}
+							// Marshal and send response.
+							reply, err = createMarshalledReply(req.Jsonrpc, req.ID, nil, jsonErr)
+							if err != nil {
+								rpcsLog.Errorf("Failed to marshal parse failure "+
+									"reply: %v", err)
 								continue
 							}
+
+							if reply != nil {
+								results = append(results, reply)
+							}
+							continue
 						}
 
 						// Lookup the websocket extension for the command, if it doesn't
 						// exist fallback to handling the command as a standard command.
 						var resp interface{}
+						rpcReq := cmd.request(nil)
 						wsHandler, ok := wsHandlers[cmd.method]
 						if ok {
-							resp, err = wsHandler(c, cmd.cmd)
+							resp, err = wsHandler(c, cmd.cmd, rpcReq)
 						} else {
-							resp, err = c.server.standardCmdResult(cmd, nil)
+							resp, err = c.server.standardCmdResult(cmd, rpcReq)
 						}
 
 						// Marshal request output.
@@ -1771,11 +2171,12 @@ func (c *wsClient) serviceRequest(r *parsedRPCCmd) {
 
 	// Lookup the websocket extension for the command and if it doesn't
 	// exist fallback to handling the command as a standard command.
+	req := r.request(nil)
 	wsHandler, ok := wsHandlers[r.method]
 	if ok {
-		result, err = wsHandler(c, r.cmd)
+		result, err = wsHandler(c, r.cmd, req)
 	} else {
-		result, err = c.server.standardCmdResult(r, nil)
+		result, err = c.server.standardCmdResult(r, req)
 	}
 	reply, err := createMarshalledReply(r.jsonrpc, r.id, result, err)
 	if err != nil {
@@ -1790,8 +2191,10 @@ func (c *wsClient) serviceRequest(r *parsedRPCCmd) {
 // the websocket client.  This runs as a muxer for various sources of input to
 // ensure that queuing up notifications to be sent will not block.  Otherwise,
 // slow clients could bog down the other systems (such as the mempool or block
-// manager) which are queuing the data.  The data is passed on to outHandler to
-// actually be written.  It must be run as a goroutine.
+// manager) which are queuing the data.  The queue is bounded by the configured
+// queue size and the configured overflow policy is applied once it is full.
+// The data is passed on to outHandler to actually be written.  It must be run
+// as a goroutine.
 func (c *wsClient) notificationQueueHandler() {
 	ntfnSentChan := make(chan bool, 1) // nonblocking sync
 
@@ -1806,6 +2209,10 @@ func (c *wsClient) notificationQueueHandler() {
 	// problematic without using this approach.
 	pendingNtfns := list.New()
 	waiting := false
+
+	// dropped is the number of notifications dropped due to the overflow
+	// policy since the queue was last empty.
+	var dropped int
 out:
 	for {
 		select {
@@ -1817,10 +2224,32 @@ out:
 		case msg := <-c.ntfnChan:
 			if !waiting {
 				c.SendMessage(msg, ntfnSentChan)
-			} else {
+				waiting = true
+				continue
+			}
+			if pendingNtfns.Len() < cfg.RPCWSQueueSize {
 				pendingNtfns.PushBack(msg)
+				continue
 			}
-			waiting = true
+
+			// The queue is full, so apply the overflow policy.
+			switch cfg.RPCWSOverflow {
+			case wsOverflowDropOldest:
+				pendingNtfns.Remove(pendingNtfns.Front())
+				pendingNtfns.PushBack(msg)
+			case wsOverflowDropNewest:
+			default:
+				rpcsLog.Warnf("Notification queue of websocket "+
+					"client %s is full -- disconnecting", c.addr)
+				c.Disconnect()
+				break out
+			}
+			if dropped == 0 {
+				rpcsLog.Warnf("Notification queue of websocket "+
+					"client %s is full -- dropping notifications",
+					c.addr)
+			}
+			dropped++
 
 		// This channel is notified when a notification has been sent
 		// across the network socket.
@@ -1829,6 +2258,11 @@ out:
 			// the pending messages queue.
 			next := pendingNtfns.Front()
 			if next == nil {
+				if dropped != 0 {
+					rpcsLog.Infof("Dropped %d notifications for "+
+						"websocket client %s", dropped, c.addr)
+					dropped = 0
+				}
 				waiting = false
 				continue
 			}
@@ -1991,7 +2425,7 @@ func (c *wsClient) WaitForShutdown() {
 // incoming and outgoing messages in separate goroutines complete with queuing
 // and asynchrous handling for long-running operations.
 func newWebsocketClient(server *rpcServer, conn *websocket.Conn,
-	remoteAddr string, authenticated bool, isAdmin bool) (*wsClient, error) {
+	remoteAddr string, user *rpcUser) (*wsClient, error) {
 
 	sessionID, err := wire.RandomUint64()
 	if err != nil {
@@ -2001,8 +2435,8 @@ func newWebsocketClient(server *rpcServer, conn *websocket.Conn,
 	client := &wsClient{
 		conn:              conn,
 		addr:              remoteAddr,
-		authenticated:     authenticated,
-		isAdmin:           isAdmin,
+		authenticated:     user != nil,
+		user:              user,
 		sessionID:         sessionID,
 		server:            server,
 		addrRequests:      make(map[string]struct{}),
@@ -2016,7 +2450,7 @@ func newWebsocketClient(server *rpcServer, conn *websocket.Conn,
 }
 
 // handleWebsocketHelp implements the help command for websocket connections.
-func handleWebsocketHelp(wsc *wsClient, icmd interface{}) (interface{}, error) {
+func handleWebsocketHelp(wsc *wsClient, icmd interface{}, req *rpcRequest) (interface{}, error) {
 	cmd, ok := icmd.(*btcjson.HelpCmd)
 	if !ok {
 		return nil, btcjson.ErrRPCInternal
@@ -2032,7 +2466,7 @@ func handleWebsocketHelp(wsc *wsClient, icmd interface{}) (interface{}, error) {
 		usage, err := wsc.server.helpCacher.rpcUsage(true)
 		if err != nil {
 			context := "Failed to generate RPC usage"
-			return nil, internalRPCError(err.Error(), context)
+			return nil, req.internalError(err.Error(), context)
 		}
 		return usage, nil
 	}
@@ -2057,7 +2491,7 @@ func handleWebsocketHelp(wsc *wsClient, icmd interface{}) (interface{}, error) {
 	help, err := wsc.server.helpCacher.rpcMethodHelp(command)
 	if err != nil {
 		context := "Failed to generate help"
-		return nil, internalRPCError(err.Error(), context)
+		return nil, req.internalError(err.Error(), context)
 	}
 	return help, nil
 }
@@ -2066,7 +2500,7 @@ func handleWebsocketHelp(wsc *wsClient, icmd interface{}) (interface{}, error) {
 // websocket connections.
 //
 // NOTE: This extension is ported from github.com/decred/dcrd
-func handleLoadTxFilter(wsc *wsClient, icmd interface{}) (interface{}, error) {
+func handleLoadTxFilter(wsc *wsClient, icmd interface{}, req *rpcRequest) (interface{}, error) {
 	cmd := icmd.(*btcjson.LoadTxFilterCmd)
 
 	outPoints := make([]wire.OutPoint, len(cmd.OutPoints))
@@ -2085,6 +2519,10 @@ func handleLoadTxFilter(wsc *wsClient, icmd interface{}) (interface{}, error) {
 	}
 
 	params := wsc.server.cfg.ChainParams
+	descs, err := parseFilterDescriptors(cmd.Descriptors, params)
+	if err != nil {
+		return nil, err
+	}
 
 	wsc.Lock()
 	if cmd.Reload || wsc.filterData == nil {
@@ -2104,32 +2542,79 @@ func handleLoadTxFilter(wsc *wsClient, icmd interface{}) (interface{}, error) {
 		wsc.filterData.mu.Unlock()
 	}
 
+	if err := addFilterDescriptors(wsc, descs); err != nil {
+		return nil, err
+	}
+
 	return nil, nil
 }
 
+// addFilterDescriptors adds the addresses described by the passed descriptors
+// to the transaction filter of the passed websocket client, which must be
+// loaded.
+func addFilterDescriptors(wsc *wsClient, descs []*wsFilterDescriptor) error {
+	if len(descs) == 0 {
+		return nil
+	}
+
+	wsc.Lock()
+	filter := wsc.filterData
+	wsc.Unlock()
+
+	filter.mu.Lock()
+	defer filter.mu.Unlock()
+	for _, d := range descs {
+		if err := filter.addDescriptor(d); err != nil {
+			return &btcjson.RPCError{
+				Code: btcjson.ErrRPCInvalidParameter,
+				Message: "Failed to derive descriptor addresses: " +
+					err.Error(),
+			}
+		}
+	}
+	return nil
+}
+
 // handleNotifyBlocks implements the notifyblocks command extension for
 // websocket connections.
-func handleNotifyBlocks(wsc *wsClient, icmd interface{}) (interface{}, error) {
+func handleNotifyBlocks(wsc *wsClient, icmd interface{}, req *rpcRequest) (interface{}, error) {
 	wsc.server.ntfnMgr.RegisterBlockUpdates(wsc)
 	return nil, nil
 }
 
+// handleResumeNotifications implements the resumenotifications command
+// extension for websocket connections.
+//
+// NOTE: This is a btcd extension.
+func handleResumeNotifications(wsc *wsClient, icmd interface{}, req *rpcRequest) (interface{}, error) {
+	cmd, ok := icmd.(*btcjson.ResumeNotificationsCmd)
+	if !ok {
+		return nil, btcjson.ErrRPCInternal
+	}
+
+	blockHash, err := chainhash.NewHashFromStr(cmd.BlockHash)
+	if err != nil {
+		return nil, rpcDecodeHexError(cmd.BlockHash)
+	}
+	return wsc.server.ntfnMgr.ResumeNotifications(wsc, blockHash, cmd.Sequence)
+}
+
 // handleSession implements the session command extension for websocket
 // connections.
-func handleSession(wsc *wsClient, icmd interface{}) (interface{}, error) {
+func handleSession(wsc *wsClient, icmd interface{}, req *rpcRequest) (interface{}, error) {
 	return &btcjson.SessionResult{SessionID: wsc.sessionID}, nil
 }
 
 // handleStopNotifyBlocks implements the stopnotifyblocks command extension for
 // websocket connections.
-func handleStopNotifyBlocks(wsc *wsClient, icmd interface{}) (interface{}, error) {
+func handleStopNotifyBlocks(wsc *wsClient, icmd interface{}, req *rpcRequest) (interface{}, error) {
 	wsc.server.ntfnMgr.UnregisterBlockUpdates(wsc)
 	return nil, nil
 }
 
 // handleNotifySpent implements the notifyspent command extension for
 // websocket connections.
-func handleNotifySpent(wsc *wsClient, icmd interface{}) (interface{}, error) {
+func handleNotifySpent(wsc *wsClient, icmd interface{}, req *rpcRequest) (interface{}, error) {
 	cmd, ok := icmd.(*btcjson.NotifySpentCmd)
 	if !ok {
 		return nil, btcjson.ErrRPCInternal
@@ -2146,7 +2631,7 @@ func handleNotifySpent(wsc *wsClient, icmd interface{}) (interface{}, error) {
 
 // handleNotifyNewTransations implements the notifynewtransactions command
 // extension for websocket connections.
-func handleNotifyNewTransactions(wsc *wsClient, icmd interface{}) (interface{}, error) {
+func handleNotifyNewTransactions(wsc *wsClient, icmd interface{}, req *rpcRequest) (interface{}, error) {
 	cmd, ok := icmd.(*btcjson.NotifyNewTransactionsCmd)
 	if !ok {
 		return nil, btcjson.ErrRPCInternal
@@ -2159,14 +2644,14 @@ func handleNotifyNewTransactions(wsc *wsClient, icmd interface{}) (interface{},
 
 // handleStopNotifyNewTransations implements the stopnotifynewtransactions
 // command extension for websocket connections.
-func handleStopNotifyNewTransactions(wsc *wsClient, icmd interface{}) (interface{}, error) {
+func handleStopNotifyNewTransactions(wsc *wsClient, icmd interface{}, req *rpcRequest) (interface{}, error) {
 	wsc.server.ntfnMgr.UnregisterNewMempoolTxsUpdates(wsc)
 	return nil, nil
 }
 
 // handleNotifyReceived implements the notifyreceived command extension for
 // websocket connections.
-func handleNotifyReceived(wsc *wsClient, icmd interface{}) (interface{}, error) {
+func handleNotifyReceived(wsc *wsClient, icmd interface{}, req *rpcRequest) (interface{}, error) {
 	cmd, ok := icmd.(*btcjson.NotifyReceivedCmd)
 	if !ok {
 		return nil, btcjson.ErrRPCInternal
@@ -2185,7 +2670,7 @@ func handleNotifyReceived(wsc *wsClient, icmd interface{}) (interface{}, error)
 
 // handleStopNotifySpent implements the stopnotifyspent command extension for
 // websocket connections.
-func handleStopNotifySpent(wsc *wsClient, icmd interface{}) (interface{}, error) {
+func handleStopNotifySpent(wsc *wsClient, icmd interface{}, req *rpcRequest) (interface{}, error) {
 	cmd, ok := icmd.(*btcjson.StopNotifySpentCmd)
 	if !ok {
 		return nil, btcjson.ErrRPCInternal
@@ -2205,7 +2690,7 @@ func handleStopNotifySpent(wsc *wsClient, icmd interface{}) (interface{}, error)
 
 // handleStopNotifyReceived implements the stopnotifyreceived command extension
 // for websocket connections.
-func handleStopNotifyReceived(wsc *wsClient, icmd interface{}) (interface{}, error) {
+func handleStopNotifyReceived(wsc *wsClient, icmd interface{}, req *rpcRequest) (interface{}, error) {
 	cmd, ok := icmd.(*btcjson.StopNotifyReceivedCmd)
 	if !ok {
 		return nil, btcjson.ErrRPCInternal
@@ -2284,7 +2769,7 @@ var ErrRescanReorg = btcjson.RPCError{
 
 // rescanBlock rescans all transactions in a single block.  This is a helper
 // function for handleRescan.
-func rescanBlock(wsc *wsClient, lookups *rescanKeys, blk *btcutil.Block) {
+func rescanBlock(wsc *wsClient, lookups *rescanKeys, blk *btcutil.Block, req *rpcRequest) {
 	for _, tx := range blk.Transactions() {
 		// Hexadecimal representation of this tx.  Only created if
 		// needed, and reused for later notifications if already made.
@@ -2334,7 +2819,7 @@ func rescanBlock(wsc *wsClient, lookups *rescanKeys, blk *btcutil.Block) {
 					return
 				}
 				if err != nil {
-					rpcsLog.Errorf("Unable to notify "+
+					req.log.Errorf("Unable to notify "+
 						"redeeming transaction %v: %v",
 						tx.Hash(), err)
 					continue
@@ -2372,7 +2857,7 @@ func rescanBlock(wsc *wsClient, lookups *rescanKeys, blk *btcutil.Block) {
 					return
 				}
 				if err != nil {
-					rpcsLog.Errorf("Unable to notify "+
+					req.log.Errorf("Unable to notify "+
 						"redeeming transaction %v: %v",
 						tx.Hash(), err)
 					continue
@@ -2409,7 +2894,7 @@ func rescanBlock(wsc *wsClient, lookups *rescanKeys, blk *btcutil.Block) {
 
 				marshalledJSON, err := btcjson.MarshalCmd(btcjson.RpcVersion1, nil, ntfn)
 				if err != nil {
-					rpcsLog.Errorf("Failed to marshal recvtx notification: %v", err)
+					req.log.Errorf("Failed to marshal recvtx notification: %v", err)
 					return
 				}
 
@@ -2473,6 +2958,7 @@ func rescanBlockFilter(filter *wsClientFilter, block *btcutil.Block, params *cha
 					Index: uint32(i),
 				}
 				filter.addUnspentOutPoint(&op)
+				filter.markAddressUsed(a)
 
 				if !added {
 					transactions = append(
@@ -2492,14 +2978,23 @@ func rescanBlockFilter(filter *wsClientFilter, block *btcutil.Block, params *cha
 // websocket connections.
 //
 // NOTE: This extension is ported from github.com/decred/dcrd
-func handleRescanBlocks(wsc *wsClient, icmd interface{}) (interface{}, error) {
+func handleRescanBlocks(wsc *wsClient, icmd interface{}, req *rpcRequest) (interface{}, error) {
 	cmd, ok := icmd.(*btcjson.RescanBlocksCmd)
 	if !ok {
 		return nil, btcjson.ErrRPCInternal
 	}
 
-	// Load client's transaction filter.  Must exist in order to continue.
+	// Load client's transaction filter.  Must exist in order to continue
+	// unless descriptors to create it from are passed.
+	params := wsc.server.cfg.ChainParams
+	descs, err := parseFilterDescriptors(cmd.Descriptors, params)
+	if err != nil {
+		return nil, err
+	}
 	wsc.Lock()
+	if wsc.filterData == nil && len(descs) != 0 {
+		wsc.filterData = newWSClientFilter(nil, nil, params)
+	}
 	filter := wsc.filterData
 	wsc.Unlock()
 	if filter == nil {
@@ -2508,6 +3003,9 @@ func handleRescanBlocks(wsc *wsClient, icmd interface{}) (interface{}, error) {
 			Message: "Transaction filter must be loaded before rescanning",
 		}
 	}
+	if err := addFilterDescriptors(wsc, descs); err != nil {
+		return nil, err
+	}
 
 	blockHashes := make([]*chainhash.Hash, len(cmd.BlockHashes))
 
@@ -2524,7 +3022,6 @@ func handleRescanBlocks(wsc *wsClient, icmd interface{}) (interface{}, error) {
 	// Iterate over each block in the request and rescan.  When a block
 	// contains relevant transactions, add it to the response.
 	bc := wsc.server.cfg.Chain
-	params := wsc.server.cfg.ChainParams
 	var lastBlockHash *chainhash.Hash
 	for i := range blockHashes {
 		block, err := bc.BlockByHash(blockHashes[i])
@@ -2561,11 +3058,11 @@ func handleRescanBlocks(wsc *wsClient, icmd interface{}) (interface{}, error) {
 // range of blocks.  If this condition does not hold true, the JSON-RPC error
 // for an unrecoverable reorganize is returned.
 func recoverFromReorg(chain *blockchain.BlockChain, minBlock, maxBlock int32,
-	lastBlock *chainhash.Hash) ([]chainhash.Hash, error) {
+	lastBlock *chainhash.Hash, req *rpcRequest) ([]chainhash.Hash, error) {
 
 	hashList, err := chain.HeightRange(minBlock, maxBlock)
 	if err != nil {
-		rpcsLog.Errorf("Error looking up block range: %v", err)
+		req.log.Errorf("Error looking up block range: %v", err)
 		return nil, &btcjson.RPCError{
 			Code:    btcjson.ErrRPCDatabase,
 			Message: "Database error: " + err.Error(),
@@ -2577,14 +3074,14 @@ func recoverFromReorg(chain *blockchain.BlockChain, minBlock, maxBlock int32,
 
 	blk, err := chain.BlockByHash(&hashList[0])
 	if err != nil {
-		rpcsLog.Errorf("Error looking up possibly reorged block: %v",
+		req.log.Errorf("Error looking up possibly reorged block: %v",
 			err)
 		return nil, &btcjson.RPCError{
 			Code:    btcjson.ErrRPCDatabase,
 			Message: "Database error: " + err.Error(),
 		}
 	}
-	jsonErr := descendantBlock(lastBlock, blk)
+	jsonErr := descendantBlock(lastBlock, blk, req)
 	if jsonErr != nil {
 		return nil, jsonErr
 	}
@@ -2593,11 +3090,12 @@ func recoverFromReorg(chain *blockchain.BlockChain, minBlock, maxBlock int32,
 
 // descendantBlock returns the appropriate JSON-RPC error if a current block
 // fetched during a reorganize is not a direct child of the parent block hash.
-func descendantBlock(prevHash *chainhash.Hash, curBlock *btcutil.Block) error {
+func descendantBlock(prevHash *chainhash.Hash, curBlock *btcutil.Block, req *rpcRequest) error {
 	curHash := &curBlock.MsgBlock().Header.PrevBlock
 	if !prevHash.IsEqual(curHash) {
-		rpcsLog.Errorf("Stopping rescan for reorged block %v "+
-			"(replaced by block %v)", prevHash, curHash)
+		log := req.log.withFields(logFieldBlock, prevHash.String())
+		log.Errorf("Stopping rescan for reorged block %v (replaced by "+
+			"block %v)", prevHash, curHash)
 		return &ErrRescanReorg
 	}
 	return nil
@@ -2608,7 +3106,7 @@ func descendantBlock(prevHash *chainhash.Hash, curBlock *btcutil.Block) error {
 // we'll send back a rescan progress notification to the websockets client. The
 // final block and block hash that we've scanned will be returned.
 func scanBlockChunks(wsc *wsClient, cmd *btcjson.RescanCmd, lookups *rescanKeys, minBlock,
-	maxBlock int32, chain *blockchain.BlockChain) (
+	maxBlock int32, chain *blockchain.BlockChain, req *rpcRequest) (
 	*btcutil.Block, *chainhash.Hash, error) {
 
 	// lastBlock and lastBlockHash track the previously-rescanned block.
@@ -2638,7 +3136,7 @@ fetchRange:
 		}
 		hashList, err := chain.HeightRange(minBlock, maxLoopBlock)
 		if err != nil {
-			rpcsLog.Errorf("Error looking up block range: %v", err)
+			req.log.Errorf("Error looking up block range: %v", err)
 			return nil, nil, &btcjson.RPCError{
 				Code:    btcjson.ErrRPCDatabase,
 				Message: "Database error: " + err.Error(),
@@ -2676,7 +3174,7 @@ fetchRange:
 			}
 			close(pauseGuard)
 			if err != nil {
-				rpcsLog.Errorf("Error fetching best block "+
+				req.log.Errorf("Error fetching best block "+
 					"hash: %v", err)
 				return nil, nil, &btcjson.RPCError{
 					Code: btcjson.ErrRPCDatabase,
@@ -2699,7 +3197,7 @@ fetchRange:
 				if dbErr, ok := err.(database.Error); !ok ||
 					dbErr.ErrorCode != database.ErrBlockNotFound {
 
-					rpcsLog.Errorf("Error looking up "+
+					req.log.Errorf("Error looking up "+
 						"block: %v", err)
 					return nil, nil, &btcjson.RPCError{
 						Code: btcjson.ErrRPCDatabase,
@@ -2711,7 +3209,7 @@ fetchRange:
 				// If an absolute max block was specified, don't
 				// attempt to handle the reorg.
 				if maxBlock != math.MaxInt32 {
-					rpcsLog.Errorf("Stopping rescan for "+
+					req.log.Errorf("Stopping rescan for "+
 						"reorged block %v",
 						cmd.EndBlock)
 					return nil, nil, &ErrRescanReorg
@@ -2730,6 +3228,7 @@ fetchRange:
 				minBlock += int32(i)
 				hashList, err = recoverFromReorg(
 					chain, minBlock, maxBlock, lastBlockHash,
+					req,
 				)
 				if err != nil {
 					return nil, nil, err
@@ -2742,7 +3241,7 @@ fetchRange:
 			if i == 0 && lastBlockHash != nil {
 				// Ensure the new hashList is on the same fork
 				// as the last block from the old hashList.
-				jsonErr := descendantBlock(lastBlockHash, blk)
+				jsonErr := descendantBlock(lastBlockHash, blk, req)
 				if jsonErr != nil {
 					return nil, nil, jsonErr
 				}
@@ -2752,11 +3251,11 @@ fetchRange:
 			// client requesting the rescan has disconnected.
 			select {
 			case <-wsc.quit:
-				rpcsLog.Debugf("Stopped rescan at height %v "+
+				req.log.Debugf("Stopped rescan at height %v "+
 					"for disconnected client", blk.Height())
 				return nil, nil, nil
 			default:
-				rescanBlock(wsc, lookups, blk)
+				rescanBlock(wsc, lookups, blk, req)
 				lastBlock = blk
 				lastBlockHash = blk.Hash()
 			}
@@ -2776,14 +3275,14 @@ fetchRange:
 			)
 			mn, err := btcjson.MarshalCmd(btcjson.RpcVersion1, nil, n)
 			if err != nil {
-				rpcsLog.Errorf("Failed to marshal rescan "+
+				req.log.Errorf("Failed to marshal rescan "+
 					"progress notification: %v", err)
 				continue
 			}
 
 			if err = wsc.QueueNotification(mn); err == ErrClientQuit {
 				// Finished if the client disconnected.
-				rpcsLog.Debugf("Stopped rescan at height %v "+
+				req.log.Debugf("Stopped rescan at height %v "+
 					"for disconnected client", blk.Height())
 				return nil, nil, nil
 			}
@@ -2805,7 +3304,7 @@ fetchRange:
 // handler erroring.  Clients must handle this by finding a block still in
 // the chain (perhaps from a rescanprogress notification) to resume their
 // rescan.
-func handleRescan(wsc *wsClient, icmd interface{}) (interface{}, error) {
+func handleRescan(wsc *wsClient, icmd interface{}, req *rpcRequest) (interface{}, error) {
 	cmd, ok := icmd.(*btcjson.RescanCmd)
 	if !ok {
 		return nil, btcjson.ErrRPCInternal
@@ -2824,9 +3323,9 @@ func handleRescan(wsc *wsClient, icmd interface{}) (interface{}, error) {
 
 	numAddrs := len(cmd.Addresses)
 	if numAddrs == 1 {
-		rpcsLog.Info("Beginning rescan for 1 address")
+		req.log.Info("Beginning rescan for 1 address")
 	} else {
-		rpcsLog.Infof("Beginning rescan for %d addresses", numAddrs)
+		req.log.Infof("Beginning rescan for %d addresses", numAddrs)
 	}
 
 	// Build lookup maps.
@@ -2879,7 +3378,7 @@ func handleRescan(wsc *wsClient, icmd interface{}) (interface{}, error) {
 		// which will notify the clients of any address deposits or output
 		// spends.
 		lastBlock, lastBlockHash, err = scanBlockChunks(
-			wsc, cmd, &lookups, minBlock, maxBlock, chain,
+			wsc, cmd, &lookups, minBlock, maxBlock, chain, req,
 		)
 		if err != nil {
 			return nil, err
@@ -2892,7 +3391,7 @@ func handleRescan(wsc *wsClient, icmd interface{}) (interface{}, error) {
 			return nil, nil
 		}
 	} else {
-		rpcsLog.Infof("Skipping rescan as client has no addrs/utxos")
+		req.log.Infof("Skipping rescan as client has no addrs/utxos")
 
 		// If we didn't actually do a rescan, then we'll give the
 		// client our best known block within the final rescan finished
@@ -2920,7 +3419,7 @@ func handleRescan(wsc *wsClient, icmd interface{}) (interface{}, error) {
 		lastBlock.MsgBlock().Header.Timestamp.Unix(),
 	)
 	if mn, err := btcjson.MarshalCmd(btcjson.RpcVersion1, nil, n); err != nil {
-		rpcsLog.Errorf("Failed to marshal rescan finished "+
+		req.log.Errorf("Failed to marshal rescan finished "+
 			"notification: %v", err)
 	} else {
 		// The rescan is finished, so we don't care whether the client
@@ -2928,7 +3427,7 @@ func handleRescan(wsc *wsClient, icmd interface{}) (interface{}, error) {
 		_ = wsc.QueueNotification(mn)
 	}
 
-	rpcsLog.Info("Finished rescan")
+	req.log.Info("Finished rescan")
 	return nil, nil
 }
 
@@ -0,0 +1,181 @@
+// Copyright (c) 2021 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"testing"
+
+	"github.com/btcsuite/btcd/btcjson"
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/wire"
+	"github.com/btcsuite/btcutil"
+	"github.com/btcsuite/btcutil/hdkeychain"
+)
+
+// TestWsJournal ensures the notification journal assigns consecutive sequence
+// numbers, evicts the oldest entries, and finds the entries to replay when
+// resuming from a sequence number or block hash.
+func TestWsJournal(t *testing.T) {
+	t.Parallel()
+
+	journal := newWsJournal(4)
+	base := journal.sequence
+
+	// Record the connection of block 1, a transaction, the disconnection of
+	// block 1 and the connection of block 2.
+	block1 := chainhash.Hash{0x01}
+	block2 := chainhash.Hash{0x02}
+	tx := btcutil.NewTx(wire.NewMsgTx(wire.TxVersion))
+	journal.add(&wsJournalEntry{blockHash: block1, blockHeight: 1, connected: true})
+	journal.add(&wsJournalEntry{tx: tx})
+	journal.add(&wsJournalEntry{blockHash: block1, blockHeight: 1})
+	seq := journal.add(&wsJournalEntry{blockHash: block2, blockHeight: 1, connected: true})
+	if seq != base+4 {
+		t.Fatalf("add: got sequence %d, want %d", seq, base+4)
+	}
+
+	entries, ok := journal.entriesAfter(base + 1)
+	if !ok || len(entries) != 3 || entries[0].tx != tx ||
+		entries[1].connected || entries[2].blockHash != block2 {
+
+		t.Fatalf("entriesAfter: unexpected entries %v, %v", entries, ok)
+	}
+	entries, ok = journal.entriesAfter(seq)
+	if !ok || len(entries) != 0 {
+		t.Fatalf("entriesAfter: got %d entries, %v, want none", len(entries),
+			ok)
+	}
+	if _, ok := journal.entriesAfter(seq + 1); ok {
+		t.Fatal("entriesAfter: future sequence accepted")
+	}
+
+	// Ensure resuming from the disconnected block replays its
+	// disconnection.
+	entries, ok = journal.entriesAfterBlock(&block1)
+	if !ok || len(entries) != 3 || entries[0].sequence != base+2 {
+		t.Fatalf("entriesAfterBlock: unexpected entries %v, %v", entries, ok)
+	}
+
+	// Ensure the oldest entry is evicted once the journal is full, so
+	// resuming from before it is no longer possible.
+	journal.add(&wsJournalEntry{tx: tx})
+	if _, ok := journal.entriesAfter(base); ok {
+		t.Fatal("entriesAfter: evicted sequence accepted")
+	}
+	if _, ok := journal.entriesAfterBlock(&block1); ok {
+		t.Fatal("entriesAfterBlock: evicted block accepted")
+	}
+	entries, ok = journal.entriesAfter(base + 1)
+	if !ok || len(entries) != 4 {
+		t.Fatalf("entriesAfter: got %d entries, %v, want 4", len(entries),
+			ok)
+	}
+
+	// Ensure a disabled journal only accepts resuming from the most recent
+	// sequence number.
+	disabled := newWsJournal(0)
+	seq = disabled.add(&wsJournalEntry{tx: tx})
+	if _, ok := disabled.entriesAfter(seq - 1); ok {
+		t.Fatal("entriesAfter: disabled journal replayed entries")
+	}
+	if _, ok := disabled.entriesAfter(seq); !ok {
+		t.Fatal("entriesAfter: disabled journal rejected current sequence")
+	}
+}
+
+// TestWsClientFilterDescriptors ensures the addresses of descriptors added to a
+// transaction filter are derived up to the gap limit after the last used one.
+func TestWsClientFilterDescriptors(t *testing.T) {
+	t.Parallel()
+
+	params := &chaincfg.MainNetParams
+	seed := make([]byte, hdkeychain.RecommendedSeedLen)
+	master, err := hdkeychain.NewMaster(seed, params)
+	if err != nil {
+		t.Fatalf("NewMaster: unexpected error: %v", err)
+	}
+	xpub, err := master.Neuter()
+	if err != nil {
+		t.Fatalf("Neuter: unexpected error: %v", err)
+	}
+	descs, err := parseFilterDescriptors(&[]btcjson.TxFilterDescriptor{{
+		Descriptor: "wpkh(" + xpub.String() + "/0/*)",
+		GapLimit:   btcjson.Uint32(2),
+	}}, params)
+	if err != nil {
+		t.Fatalf("parseFilterDescriptors: unexpected error: %v", err)
+	}
+
+	// Derive the first addresses of the descriptor independently of the
+	// filter.
+	addrs := make([]btcutil.Address, 6)
+	for i := range addrs {
+		addrs[i], err = descs[0].desc.Address(uint32(i))
+		if err != nil {
+			t.Fatalf("Address: unexpected error: %v", err)
+		}
+	}
+
+	filter := newWSClientFilter(nil, nil, params)
+	if err := filter.addDescriptor(descs[0]); err != nil {
+		t.Fatalf("addDescriptor: unexpected error: %v", err)
+	}
+	checkWatched := func(watched int) {
+		t.Helper()
+		for i, a := range addrs {
+			if filter.existsAddress(a) != (i < watched) {
+				t.Fatalf("existsAddress(%d): got %v, want %v", i,
+					!(i < watched), i < watched)
+			}
+		}
+	}
+	checkWatched(2)
+
+	// Using the second address extends the derivation to two addresses
+	// after it, while using the first one again changes nothing.
+	filter.markAddressUsed(addrs[1])
+	checkWatched(4)
+	filter.markAddressUsed(addrs[0])
+	checkWatched(4)
+
+	// Ensure an address described by more than one descriptor extends the
+	// derivation of all of them instead of only the last one added.
+	descs, err = parseFilterDescriptors(&[]btcjson.TxFilterDescriptor{{
+		Descriptor: "wpkh(" + xpub.String() + "/0/*)",
+		GapLimit:   btcjson.Uint32(3),
+	}, {
+		Descriptor: "wpkh([00000000]" + xpub.String() + "/0/*)",
+		GapLimit:   btcjson.Uint32(2),
+	}}, params)
+	if err != nil {
+		t.Fatalf("parseFilterDescriptors: unexpected error: %v", err)
+	}
+	filter = newWSClientFilter(nil, nil, params)
+	for _, d := range descs {
+		if err := filter.addDescriptor(d); err != nil {
+			t.Fatalf("addDescriptor: unexpected error: %v", err)
+		}
+	}
+	checkWatched(3)
+	filter.markAddressUsed(addrs[1])
+	checkWatched(5)
+
+	// Ensure invalid descriptors and gap limits are rejected.
+	invalid := []btcjson.TxFilterDescriptor{
+		{Descriptor: "wpkh(" + xpub.String() + "/0'/*)"},
+		{Descriptor: "wpkh(" + xpub.String() + "/0/*)", GapLimit: btcjson.Uint32(0)},
+		{Descriptor: "wpkh(" + xpub.String() + "/0/*)",
+			GapLimit: btcjson.Uint32(maxDescriptorGapLimit + 1)},
+	}
+	for _, d := range invalid {
+		_, err := parseFilterDescriptors(&[]btcjson.TxFilterDescriptor{d},
+			params)
+		if err == nil {
+			t.Errorf("parseFilterDescriptors(%q): expected error",
+				d.Descriptor)
+		}
+	}
+}
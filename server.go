@@ -36,15 +36,19 @@ import (
 	"github.com/btcsuite/btcd/peer"
 	"github.com/btcsuite/btcd/txscript"
 	"github.com/btcsuite/btcd/wire"
+	"github.com/btcsuite/btcd/zmqpub"
 	"github.com/btcsuite/btcutil"
 	"github.com/btcsuite/btcutil/bloom"
 )
 
 const (
 	// defaultServices describes the default services that are supported by
-	// the server.
-	defaultServices = wire.SFNodeNetwork | wire.SFNodeBloom |
-		wire.SFNodeWitness | wire.SFNodeCF
+	// the server.  A full node also serves the recent blocks promised by
+	// SFNodeNetworkLimited, so it advertises both flags, while a node which
+	// doesn't store all blocks must only advertise SFNodeNetworkLimited.
+	defaultServices = wire.SFNodeNetwork | wire.SFNodeNetworkLimited |
+		wire.SFNodeBloom | wire.SFNodeWitness | wire.SFNodeCF |
+		wire.SFNodeP2PV2
 
 	// defaultRequiredServices describes the default services that are
 	// required to be supported by outbound peers.
@@ -53,6 +57,16 @@ const (
 	// defaultTargetOutbound is the default number of outbound peers to target.
 	defaultTargetOutbound = 8
 
+	// defaultBlockRelayOnlyOutbound is the default number of block relay
+	// only outbound peers to target in addition to the other outbound
+	// peers.
+	defaultBlockRelayOnlyOutbound = 2
+
+	// feelerInterval is the average interval between feeler connections,
+	// which test whether addresses are reachable in order to keep the
+	// address manager populated with good addresses.
+	feelerInterval = 2 * time.Minute
+
 	// connectionRetryInterval is the base amount of time to wait in between
 	// retries when connecting to persistent peers.  It is adjusted by the
 	// number of retries such that there is a retry backoff.
@@ -215,6 +229,8 @@ type server struct {
 	chain                *blockchain.BlockChain
 	txMemPool            *mempool.TxPool
 	cpuMiner             *cpuminer.CPUMiner
+	zmqPublisher         *zmqpub.Publisher
+	metrics              *serverMetrics
 	modifyRebroadcastInv chan interface{}
 	newPeers             chan *serverPeer
 	donePeers            chan *serverPeer
@@ -234,9 +250,12 @@ type server struct {
 	// if the associated index is not enabled.  These fields are set during
 	// initial creation of the server and never changed afterwards, so they
 	// do not need to be protected for concurrent access.
-	txIndex   *indexers.TxIndex
-	addrIndex *indexers.AddrIndex
-	cfIndex   *indexers.CfIndex
+	txIndex         *indexers.TxIndex
+	addrIndex       *indexers.AddrIndex
+	addrUtxoIndex   *indexers.AddrUtxoIndex
+	spendIndex      *indexers.SpendIndex
+	blockStatsIndex *indexers.BlockStatsIndex
+	cfIndex         *indexers.CfIndex
 
 	// The fee estimator keeps track of how long transactions are left in
 	// the mempool before they are mined into blocks.
@@ -254,6 +273,14 @@ type server struct {
 	// agentWhitelist is a list of whitelisted user agent substrings, no
 	// whitelisting will be applied if the list is empty or nil.
 	agentWhitelist []string
+
+	// netGroupKey is a random key used to derive the keyed network groups
+	// of inbound peers, which decide the peers protected from eviction.
+	netGroupKey []byte
+
+	// privateBroadcaster broadcasts the transactions submitted via RPC
+	// through Tor.  It is nil unless private broadcast is enabled.
+	privateBroadcaster *privateBroadcaster
 }
 
 // serverPeer extends the peer to maintain state shared by the server and
@@ -296,6 +323,12 @@ func newServerPeer(s *server, isPersistent bool) *serverPeer {
 	}
 }
 
+// logger returns a logger which attaches the address of the peer to every
+// entry written to the passed subsystem logger.
+func (sp *serverPeer) logger(log *subsystemLogger) *subsystemLogger {
+	return log.withFields(logFieldPeer, sp.Addr())
+}
+
 // newestBlock returns the current best block hash and height using the format
 // required by the configuration for the peer package.
 func (sp *serverPeer) newestBlock() (*chainhash.Hash, int32, error) {
@@ -303,6 +336,17 @@ func (sp *serverPeer) newestBlock() (*chainhash.Hash, int32, error) {
 	return &best.Hash, best.Height, nil
 }
 
+// txFeeRate returns the fee rate in satoshi per kilobyte of the transaction
+// with the passed hash and whether it is still in the mempool.  It is used by
+// the peer to order the transaction inventory it trickles to the remote peer.
+func (sp *serverPeer) txFeeRate(hash *chainhash.Hash) (int64, bool) {
+	txD, err := sp.server.txMemPool.FetchTxDesc(hash)
+	if err != nil {
+		return 0, false
+	}
+	return txD.FeePerKB, true
+}
+
 // addKnownAddresses adds the given addresses to the set of known addresses to
 // the peer to prevent sending duplicate addresses.
 func (sp *serverPeer) addKnownAddresses(addresses []*wire.NetAddress) {
@@ -340,6 +384,33 @@ func (sp *serverPeer) relayTxDisabled() bool {
 	return isDisabled
 }
 
+// blockRelayOnly returns whether the peer is an outbound peer which only
+// relays blocks, so neither transactions nor addresses are exchanged with it.
+func (sp *serverPeer) blockRelayOnly() bool {
+	return !sp.Inbound() && sp.connReq != nil &&
+		sp.connReq.Type == connmgr.ConnBlockRelayOnly
+}
+
+// feeler returns whether the peer is an outbound peer which is only connected
+// to in order to test whether its address is reachable.
+func (sp *serverPeer) feeler() bool {
+	return !sp.Inbound() && sp.connReq != nil &&
+		sp.connReq.Type == connmgr.ConnFeeler
+}
+
+// connectionType returns the type of the connection to the peer.
+func (sp *serverPeer) connectionType() string {
+	switch {
+	case sp.Inbound():
+		return "inbound"
+	case sp.persistent:
+		return "manual"
+	case sp.connReq == nil:
+		return connmgr.ConnFullRelay.String()
+	}
+	return sp.connReq.Type.String()
+}
+
 // pushAddrMsg sends an addr message to the connected peer using the provided
 // addresses.
 func (sp *serverPeer) pushAddrMsg(addresses []*wire.NetAddress) {
@@ -352,7 +423,8 @@ func (sp *serverPeer) pushAddrMsg(addresses []*wire.NetAddress) {
 	}
 	known, err := sp.PushAddrMsg(addrs)
 	if err != nil {
-		peerLog.Errorf("Can't push address message to %s: %v", sp.Peer, err)
+		sp.logger(peerLog).Errorf("Can't push address message to "+
+			"%s: %v", sp.Peer, err)
 		sp.Disconnect()
 		return
 	}
@@ -370,7 +442,8 @@ func (sp *serverPeer) addBanScore(persistent, transient uint32, reason string) b
 		return false
 	}
 	if sp.isWhitelisted {
-		peerLog.Debugf("Misbehaving whitelisted peer %s: %s", sp, reason)
+		sp.logger(peerLog).Debugf("Misbehaving whitelisted peer %s: %s",
+			sp, reason)
 		return false
 	}
 
@@ -380,18 +453,19 @@ func (sp *serverPeer) addBanScore(persistent, transient uint32, reason string) b
 		// logged if the score is above the warn threshold.
 		score := sp.banScore.Int()
 		if score > warnThreshold {
-			peerLog.Warnf("Misbehaving peer %s: %s -- ban score is %d, "+
-				"it was not increased this time", sp, reason, score)
+			sp.logger(peerLog).Warnf("Misbehaving peer %s: %s -- "+
+				"ban score is %d, it was not increased this "+
+				"time", sp, reason, score)
 		}
 		return false
 	}
 	score := sp.banScore.Increase(persistent, transient)
 	if score > warnThreshold {
-		peerLog.Warnf("Misbehaving peer %s: %s -- ban score increased to %d",
-			sp, reason, score)
+		sp.logger(peerLog).Warnf("Misbehaving peer %s: %s -- ban "+
+			"score increased to %d", sp, reason, score)
 		if score > cfg.BanThreshold {
-			peerLog.Warnf("Misbehaving peer %s -- banning and disconnecting",
-				sp)
+			sp.logger(peerLog).Warnf("Misbehaving peer %s -- "+
+				"banning and disconnecting", sp)
 			sp.server.BanPeer(sp)
 			sp.Disconnect()
 			return true
@@ -433,13 +507,20 @@ func (sp *serverPeer) OnVersion(_ *peer.Peer, msg *wire.MsgVersion) *wire.MsgRej
 		return nil
 	}
 
-	// Reject outbound peers that are not full nodes.
+	// Reject outbound peers that are not full nodes.  Peers which only
+	// serve recent blocks are accepted as well once the chain is current,
+	// since the blocks needed to stay in sync are then recent.
 	wantServices := wire.SFNodeNetwork
+	if sp.server.syncManager.IsCurrent() &&
+		hasServices(msg.Services, wire.SFNodeNetworkLimited) {
+
+		wantServices = wire.SFNodeNetworkLimited
+	}
 	if !isInbound && !hasServices(msg.Services, wantServices) {
 		missingServices := wantServices & ^msg.Services
-		srvrLog.Debugf("Rejecting peer %s with services %v due to not "+
-			"providing desired services %v", sp.Peer, msg.Services,
-			missingServices)
+		sp.logger(srvrLog).Debugf("Rejecting peer %s with services %v "+
+			"due to not providing desired services %v", sp.Peer,
+			msg.Services, missingServices)
 		reason := fmt.Sprintf("required services %#x not offered",
 			uint64(missingServices))
 		return wire.NewMsgReject(msg.Command(), wire.RejectNonstandard, reason)
@@ -458,8 +539,9 @@ func (sp *serverPeer) OnVersion(_ *peer.Peer, msg *wire.MsgVersion) *wire.MsgRej
 		}
 
 		if segwitActive && !sp.IsWitnessEnabled() {
-			peerLog.Infof("Disconnecting non-segwit peer %v, isn't segwit "+
-				"enabled and we need more segwit enabled peers", sp)
+			sp.logger(peerLog).Infof("Disconnecting non-segwit "+
+				"peer %v, isn't segwit enabled and we need "+
+				"more segwit enabled peers", sp)
 			sp.Disconnect()
 			return nil
 		}
@@ -490,8 +572,8 @@ func (sp *serverPeer) OnMemPool(_ *peer.Peer, msg *wire.MsgMemPool) {
 	// Only allow mempool requests if the server has bloom filtering
 	// enabled.
 	if sp.server.services&wire.SFNodeBloom != wire.SFNodeBloom {
-		peerLog.Debugf("peer %v sent mempool request with bloom "+
-			"filtering disabled -- disconnecting", sp)
+		sp.logger(peerLog).Debugf("peer %v sent mempool request with "+
+			"bloom filtering disabled -- disconnecting", sp)
 		sp.Disconnect()
 		return
 	}
@@ -513,7 +595,15 @@ func (sp *serverPeer) OnMemPool(_ *peer.Peer, msg *wire.MsgMemPool) {
 	txDescs := txMemPool.TxDescs()
 	invMsg := wire.NewMsgInvSizeHint(uint(len(txDescs)))
 
+	privateBroadcaster := sp.server.privateBroadcaster
 	for _, txDesc := range txDescs {
+		// Don't reveal transactions which are being broadcast privately.
+		if privateBroadcaster != nil &&
+			privateBroadcaster.IsPending(txDesc.Tx.Hash()) {
+
+			continue
+		}
+
 		// Either add all transactions when there is no bloom filter,
 		// or only the transactions that match the filter when there is
 		// one.
@@ -538,8 +628,17 @@ func (sp *serverPeer) OnMemPool(_ *peer.Peer, msg *wire.MsgMemPool) {
 // transactions don't rely on the previous one in a linear fashion like blocks.
 func (sp *serverPeer) OnTx(_ *peer.Peer, msg *wire.MsgTx) {
 	if cfg.BlocksOnly {
-		peerLog.Tracef("Ignoring tx %v from %v - blocksonly enabled",
-			msg.TxHash(), sp)
+		sp.logger(peerLog).Tracef("Ignoring tx %v from %v - "+
+			"blocksonly enabled", msg.TxHash(), sp)
+		return
+	}
+
+	// Block relay only peers are told not to relay transactions, so
+	// sending one is a protocol violation.
+	if sp.blockRelayOnly() {
+		sp.logger(peerLog).Infof("Block relay only peer %v sent tx %v "+
+			"-- disconnecting", sp, msg.TxHash())
+		sp.Disconnect()
 		return
 	}
 
@@ -590,7 +689,17 @@ func (sp *serverPeer) OnBlock(_ *peer.Peer, msg *wire.MsgBlock, buf []byte) {
 // accordingly.  We pass the message down to blockmanager which will call
 // QueueMessage with any appropriate responses.
 func (sp *serverPeer) OnInv(_ *peer.Peer, msg *wire.MsgInv) {
-	if !cfg.BlocksOnly {
+	if !cfg.BlocksOnly && !sp.blockRelayOnly() {
+		// Transactions which are being broadcast privately are
+		// announced as usual once a peer relays them back.
+		if sp.server.privateBroadcaster != nil {
+			for _, invVect := range msg.InvList {
+				if invVect.Type == wire.InvTypeTx {
+					sp.server.privateBroadcaster.TxSeen(
+						&invVect.Hash)
+				}
+			}
+		}
 		if len(msg.InvList) > 0 {
 			sp.server.syncManager.QueueInv(msg, sp.Peer)
 		}
@@ -600,11 +709,12 @@ func (sp *serverPeer) OnInv(_ *peer.Peer, msg *wire.MsgInv) {
 	newInv := wire.NewMsgInvSizeHint(uint(len(msg.InvList)))
 	for _, invVect := range msg.InvList {
 		if invVect.Type == wire.InvTypeTx {
-			peerLog.Tracef("Ignoring tx %v in inv from %v -- "+
-				"blocksonly enabled", invVect.Hash, sp)
+			sp.logger(peerLog).Tracef("Ignoring tx %v in inv from "+
+				"%v -- blocksonly enabled", invVect.Hash, sp)
 			if sp.ProtocolVersion() >= wire.BIP0037Version {
-				peerLog.Infof("Peer %v is announcing "+
-					"transactions -- disconnecting", sp)
+				sp.logger(peerLog).Infof("Peer %v is "+
+					"announcing transactions -- "+
+					"disconnecting", sp)
 				sp.Disconnect()
 				return
 			}
@@ -1128,8 +1238,8 @@ func (sp *serverPeer) enforceNodeBloomFlag(cmd string) bool {
 
 		// Disconnect the peer regardless of protocol version or banning
 		// state.
-		peerLog.Debugf("%s sent an unsupported %s request -- "+
-			"disconnecting", sp, cmd)
+		sp.logger(peerLog).Debugf("%s sent an unsupported %s request "+
+			"-- disconnecting", sp, cmd)
 		sp.Disconnect()
 		return false
 	}
@@ -1144,8 +1254,9 @@ func (sp *serverPeer) enforceNodeBloomFlag(cmd string) bool {
 func (sp *serverPeer) OnFeeFilter(_ *peer.Peer, msg *wire.MsgFeeFilter) {
 	// Check that the passed minimum fee is a valid amount.
 	if msg.MinFee < 0 || msg.MinFee > btcutil.MaxSatoshi {
-		peerLog.Debugf("Peer %v sent an invalid feefilter '%v' -- "+
-			"disconnecting", sp, btcutil.Amount(msg.MinFee))
+		sp.logger(peerLog).Debugf("Peer %v sent an invalid feefilter "+
+			"'%v' -- disconnecting", sp,
+			btcutil.Amount(msg.MinFee))
 		sp.Disconnect()
 		return
 	}
@@ -1165,8 +1276,8 @@ func (sp *serverPeer) OnFilterAdd(_ *peer.Peer, msg *wire.MsgFilterAdd) {
 	}
 
 	if !sp.filter.IsLoaded() {
-		peerLog.Debugf("%s sent a filteradd request with no filter "+
-			"loaded -- disconnecting", sp)
+		sp.logger(peerLog).Debugf("%s sent a filteradd request with "+
+			"no filter loaded -- disconnecting", sp)
 		sp.Disconnect()
 		return
 	}
@@ -1186,8 +1297,8 @@ func (sp *serverPeer) OnFilterClear(_ *peer.Peer, msg *wire.MsgFilterClear) {
 	}
 
 	if !sp.filter.IsLoaded() {
-		peerLog.Debugf("%s sent a filterclear request with no "+
-			"filter loaded -- disconnecting", sp)
+		sp.logger(peerLog).Debugf("%s sent a filterclear request with "+
+			"no filter loaded -- disconnecting", sp)
 		sp.Disconnect()
 		return
 	}
@@ -1227,16 +1338,16 @@ func (sp *serverPeer) OnGetAddr(_ *peer.Peer, msg *wire.MsgGetAddr) {
 	// Do not accept getaddr requests from outbound peers.  This reduces
 	// fingerprinting attacks.
 	if !sp.Inbound() {
-		peerLog.Debugf("Ignoring getaddr request from outbound peer "+
-			"%v", sp)
+		sp.logger(peerLog).Debugf("Ignoring getaddr request from "+
+			"outbound peer %v", sp)
 		return
 	}
 
 	// Only allow one getaddr request per connection to discourage
 	// address stamping of inv announcements.
 	if sp.sentAddrs {
-		peerLog.Debugf("Ignoring repeated getaddr request from peer "+
-			"%v", sp)
+		sp.logger(peerLog).Debugf("Ignoring repeated getaddr request "+
+			"from peer %v", sp)
 		return
 	}
 	sp.sentAddrs = true
@@ -1264,10 +1375,19 @@ func (sp *serverPeer) OnAddr(_ *peer.Peer, msg *wire.MsgAddr) {
 		return
 	}
 
+	// Ignore addresses from block relay only peers, which are never asked
+	// for addresses, so they can't be used to learn about or poison the
+	// addresses known to the server.
+	if sp.blockRelayOnly() {
+		sp.logger(peerLog).Debugf("Ignoring addresses from block "+
+			"relay only peer %v", sp)
+		return
+	}
+
 	// A message that has no addresses is invalid.
 	if len(msg.AddrList) == 0 {
-		peerLog.Errorf("Command [%s] from %s does not contain any addresses",
-			msg.Command(), sp.Peer)
+		sp.logger(peerLog).Errorf("Command [%s] from %s does not "+
+			"contain any addresses", msg.Command(), sp.Peer)
 		sp.Disconnect()
 		return
 	}
@@ -1328,8 +1448,8 @@ func (sp *serverPeer) OnNotFound(p *peer.Peer, msg *wire.MsgNotFound) {
 		case wire.InvTypeWitnessTx:
 			numTxns++
 		default:
-			peerLog.Debugf("Invalid inv type '%d' in notfound message from %s",
-				inv.Type, sp)
+			sp.logger(peerLog).Debugf("Invalid inv type '%d' in "+
+				"notfound message from %s", inv.Type, sp)
 			sp.Disconnect()
 			return
 		}
@@ -1415,6 +1535,35 @@ func (s *server) AnnounceNewTransactions(txns []*mempool.TxDesc) {
 	if s.rpcServer != nil {
 		s.rpcServer.NotifyNewTransactions(txns)
 	}
+
+	// Publish the newly accepted transactions to ZMQ subscribers.
+	if s.zmqPublisher != nil {
+		for _, txD := range txns {
+			s.zmqPublisher.NotifyTxAccepted(txD.Tx)
+		}
+	}
+}
+
+// handleZMQNotification publishes blocks connected to and disconnected from
+// the main chain to ZMQ subscribers.
+func (s *server) handleZMQNotification(notification *blockchain.Notification) {
+	switch notification.Type {
+	case blockchain.NTBlockConnected:
+		block, ok := notification.Data.(*btcutil.Block)
+		if !ok {
+			srvrLog.Warnf("Chain connected notification is not a block.")
+			break
+		}
+		s.zmqPublisher.NotifyBlockConnected(block)
+
+	case blockchain.NTBlockDisconnected:
+		block, ok := notification.Data.(*btcutil.Block)
+		if !ok {
+			srvrLog.Warnf("Chain disconnected notification is not a block.")
+			break
+		}
+		s.zmqPublisher.NotifyBlockDisconnected(block)
+	}
 }
 
 // Transaction has one confirmation on the main chain. Now we can mark it as no
@@ -1437,7 +1586,14 @@ func (s *server) pushTxMsg(sp *serverPeer, hash *chainhash.Hash, doneChan chan<-
 	// Attempt to fetch the requested transaction from the pool.  A
 	// call could be made to check for existence first, but simply trying
 	// to fetch a missing transaction results in the same behavior.
+	// Transactions which are being broadcast privately are treated as
+	// missing, so peers can't find out they originate from this node.
 	tx, err := s.txMemPool.FetchTransaction(hash)
+	if err == nil && s.privateBroadcaster != nil &&
+		s.privateBroadcaster.IsPending(hash) {
+
+		err = errors.New("transaction is being broadcast privately")
+	}
 	if err != nil {
 		peerLog.Tracef("Unable to fetch tx %v from transaction "+
 			"pool: %v", hash, err)
@@ -1458,11 +1614,47 @@ func (s *server) pushTxMsg(sp *serverPeer, hash *chainhash.Hash, doneChan chan<-
 	return nil
 }
 
+// checkBlockServable returns an error when the block with the passed hash must
+// not be served to peers.  Nodes which advertise SFNodeNetworkLimited but not
+// SFNodeNetwork only serve the blocks of the main chain which are at most
+// wire.NodeNetworkLimitedBlocks below its tip (BIP0159), so peers can't
+// mistake them for nodes which store the whole chain.
+func (s *server) checkBlockServable(hash *chainhash.Hash) error {
+	if s.services&wire.SFNodeNetwork == wire.SFNodeNetwork {
+		return nil
+	}
+
+	height, err := s.chain.BlockHeightByHash(hash)
+	if err != nil {
+		return err
+	}
+	best := s.chain.BestSnapshot()
+	if best.Height-height > wire.NodeNetworkLimitedBlocks {
+		return fmt.Errorf("block height %d is more than %d blocks "+
+			"below the tip at height %d", height,
+			wire.NodeNetworkLimitedBlocks, best.Height)
+	}
+	return nil
+}
+
 // pushBlockMsg sends a block message for the provided block hash to the
 // connected peer.  An error is returned if the block hash is not known.
 func (s *server) pushBlockMsg(sp *serverPeer, hash *chainhash.Hash, doneChan chan<- struct{},
 	waitChan <-chan struct{}, encoding wire.MessageEncoding) error {
 
+	log := sp.logger(peerLog).withFields(logFieldBlock, hash.String())
+
+	// Refuse to serve blocks which aren't promised by the advertised
+	// services.
+	if err := s.checkBlockServable(hash); err != nil {
+		log.Debugf("Not serving block %v to %v: %v", hash, sp, err)
+
+		if doneChan != nil {
+			doneChan <- struct{}{}
+		}
+		return err
+	}
+
 	// Fetch the raw block bytes from the database.
 	var blockBytes []byte
 	err := sp.server.db.View(func(dbTx database.Tx) error {
@@ -1471,7 +1663,7 @@ func (s *server) pushBlockMsg(sp *serverPeer, hash *chainhash.Hash, doneChan cha
 		return err
 	})
 	if err != nil {
-		peerLog.Tracef("Unable to fetch requested block hash %v: %v",
+		log.Tracef("Unable to fetch requested block hash %v: %v",
 			hash, err)
 
 		if doneChan != nil {
@@ -1484,7 +1676,7 @@ func (s *server) pushBlockMsg(sp *serverPeer, hash *chainhash.Hash, doneChan cha
 	var msgBlock wire.MsgBlock
 	err = msgBlock.Deserialize(bytes.NewReader(blockBytes))
 	if err != nil {
-		peerLog.Tracef("Unable to deserialize requested block hash "+
+		log.Tracef("Unable to deserialize requested block hash "+
 			"%v: %v", hash, err)
 
 		if doneChan != nil {
@@ -1531,6 +1723,8 @@ func (s *server) pushBlockMsg(sp *serverPeer, hash *chainhash.Hash, doneChan cha
 func (s *server) pushMerkleBlockMsg(sp *serverPeer, hash *chainhash.Hash,
 	doneChan chan<- struct{}, waitChan <-chan struct{}, encoding wire.MessageEncoding) error {
 
+	log := sp.logger(peerLog).withFields(logFieldBlock, hash.String())
+
 	// Do not send a response if the peer doesn't have a filter loaded.
 	if !sp.filter.IsLoaded() {
 		if doneChan != nil {
@@ -1539,10 +1733,22 @@ func (s *server) pushMerkleBlockMsg(sp *serverPeer, hash *chainhash.Hash,
 		return nil
 	}
 
+	// Refuse to serve blocks which aren't promised by the advertised
+	// services.
+	if err := s.checkBlockServable(hash); err != nil {
+		log.Debugf("Not serving merkle block %v to %v: %v", hash,
+			sp, err)
+
+		if doneChan != nil {
+			doneChan <- struct{}{}
+		}
+		return err
+	}
+
 	// Fetch the raw block bytes from the database.
 	blk, err := sp.server.chain.BlockByHash(hash)
 	if err != nil {
-		peerLog.Tracef("Unable to fetch requested block hash %v: %v",
+		log.Tracef("Unable to fetch requested block hash %v: %v",
 			hash, err)
 
 		if doneChan != nil {
@@ -1628,7 +1834,8 @@ func (s *server) handleAddPeerMsg(state *peerState, sp *serverPeer) bool {
 
 	// Ignore new peers if we're shutting down.
 	if atomic.LoadInt32(&s.shutdown) != 0 {
-		srvrLog.Infof("New peer %s ignored - server is shutting down", sp)
+		sp.logger(srvrLog).Infof("New peer %s ignored - server is "+
+			"shutting down", sp)
 		sp.Disconnect()
 		return false
 	}
@@ -1642,22 +1849,39 @@ func (s *server) handleAddPeerMsg(state *peerState, sp *serverPeer) bool {
 	}
 	if banEnd, ok := state.banned[host]; ok {
 		if time.Now().Before(banEnd) {
-			srvrLog.Debugf("Peer %s is banned for another %v - disconnecting",
-				host, time.Until(banEnd))
+			sp.logger(srvrLog).Debugf("Peer %s is banned for "+
+				"another %v - disconnecting", host,
+				time.Until(banEnd))
 			sp.Disconnect()
 			return false
 		}
 
-		srvrLog.Infof("Peer %s is no longer banned", host)
+		sp.logger(srvrLog).Infof("Peer %s is no longer banned", host)
 		delete(state.banned, host)
 	}
 
+	// Feeler connections are only made to test whether an address is
+	// reachable, so mark it as a known good address now that the
+	// handshake completed and disconnect right away.
+	if sp.feeler() {
+		sp.logger(srvrLog).Debugf("Feeler connection to %s succeeded",
+			sp)
+		if !cfg.SimNet {
+			s.addrManager.Good(sp.NA())
+		}
+		sp.Disconnect()
+		return false
+	}
+
 	// TODO: Check for max peers from a single IP.
 
-	// Limit max number of total peers.
-	if state.Count() >= cfg.MaxPeers {
-		srvrLog.Infof("Max peers reached [%d] - disconnecting peer %s",
-			cfg.MaxPeers, sp)
+	// Limit max number of total peers.  An existing inbound peer is
+	// evicted to make room for a new inbound peer when possible.
+	if state.Count() >= cfg.MaxPeers &&
+		!(sp.Inbound() && s.evictInboundPeer(state)) {
+
+		sp.logger(srvrLog).Infof("Max peers reached [%d] - "+
+			"disconnecting peer %s", cfg.MaxPeers, sp)
 		sp.Disconnect()
 		// TODO: how to handle permanent peers here?
 		// they should be rescheduled.
@@ -1665,11 +1889,11 @@ func (s *server) handleAddPeerMsg(state *peerState, sp *serverPeer) bool {
 	}
 
 	// Add the new peer and start it.
-	srvrLog.Debugf("New peer %s", sp)
+	sp.logger(srvrLog).Debugf("New peer %s", sp)
 	if sp.Inbound() {
 		state.inboundPeers[sp.ID()] = sp
 	} else {
-		state.outboundGroups[addrmgr.GroupKey(sp.NA())]++
+		state.outboundGroups[s.addrManager.GroupKey(sp.NA())]++
 		if sp.persistent {
 			state.persistentPeers[sp.ID()] = sp
 		} else {
@@ -1690,8 +1914,9 @@ func (s *server) handleAddPeerMsg(state *peerState, sp *serverPeer) bool {
 	// remote peer for outbound connections. This is skipped when running on
 	// the simulation test network since it is only intended to connect to
 	// specified peers and actively avoids advertising and connecting to
-	// discovered peers.
-	if !cfg.SimNet && !sp.Inbound() {
+	// discovered peers.  Addresses are not exchanged with block relay only
+	// peers.
+	if !cfg.SimNet && !sp.Inbound() && !sp.blockRelayOnly() {
 		// Advertise the local address when the server accepts incoming
 		// connections and it believes itself to be close to the best
 		// known tip.
@@ -1712,14 +1937,74 @@ func (s *server) handleAddPeerMsg(state *peerState, sp *serverPeer) bool {
 		if s.addrManager.NeedMoreAddresses() && hasTimestamp {
 			sp.QueueMessage(wire.NewMsgGetAddr(), nil)
 		}
+	}
 
-		// Mark the address as a known good address.
+	// Mark the address of every successful outbound connection, including
+	// block relay only ones, as a known good address.
+	if !cfg.SimNet && !sp.Inbound() {
 		s.addrManager.Good(sp.NA())
 	}
 
 	return true
 }
 
+// evictInboundPeer disconnects an inbound peer selected by selectPeerToEvict to
+// make room for a new inbound peer.  It returns whether a peer was evicted.  It
+// is invoked from the peerHandler goroutine.
+func (s *server) evictInboundPeer(state *peerState) bool {
+	candidates := make([]*evictionCandidate, 0, len(state.inboundPeers))
+	for _, sp := range state.inboundPeers {
+		if sp.isWhitelisted || !sp.Connected() || sp.NA() == nil {
+			continue
+		}
+		netGroup := s.addrManager.GroupKey(sp.NA())
+		candidates = append(candidates, &evictionCandidate{
+			id:            sp.ID(),
+			timeConnected: sp.TimeConnected(),
+			pingMicros:    sp.LastPingMicros(),
+			lastBlockTime: sp.LastBlockTime(),
+			lastTxTime:    sp.LastTxTime(),
+			relayTxs:      !sp.relayTxDisabled(),
+			netGroup:      netGroup,
+			keyedNetGroup: keyedNetGroup(s.netGroupKey, netGroup),
+		})
+	}
+
+	evict := selectPeerToEvict(candidates)
+	if evict == nil {
+		return false
+	}
+	sp := state.inboundPeers[evict.id]
+	sp.logger(srvrLog).Debugf("Evicting inbound peer %s to make room for "+
+		"a new inbound peer", sp)
+	delete(state.inboundPeers, evict.id)
+	sp.Disconnect()
+	return true
+}
+
+// saveAnchors saves the addresses of the connected block relay only peers as
+// anchors.  It is invoked from the peerHandler goroutine on shutdown.
+func (s *server) saveAnchors(state *peerState) {
+	var anchors []string
+	for _, sp := range state.outboundPeers {
+		if len(anchors) == maxAnchors {
+			break
+		}
+		if sp.blockRelayOnly() && sp.Connected() {
+			anchors = append(anchors, sp.Addr())
+		}
+	}
+	if len(anchors) == 0 {
+		return
+	}
+	if err := saveAnchors(cfg.DataDir, anchors); err != nil {
+		srvrLog.Errorf("Unable to save anchors: %v", err)
+		return
+	}
+	srvrLog.Debugf("Saved %d %s", len(anchors), pickNoun(uint64(len(anchors)),
+		"anchor", "anchors"))
+}
+
 // handleDonePeerMsg deals with peers that have signalled they are done.  It is
 // invoked from the peerHandler goroutine.
 func (s *server) handleDonePeerMsg(state *peerState, sp *serverPeer) {
@@ -1734,22 +2019,32 @@ func (s *server) handleDonePeerMsg(state *peerState, sp *serverPeer) {
 
 	// Regardless of whether the peer was found in our list, we'll inform
 	// our connection manager about the disconnection. This can happen if we
-	// process a peer's `done` message before its `add`.
+	// process a peer's `done` message before its `add`.  Feeler
+	// connections are not replaced.
 	if !sp.Inbound() {
 		if sp.persistent {
 			s.connManager.Disconnect(sp.connReq.ID())
 		} else {
 			s.connManager.Remove(sp.connReq.ID())
-			go s.connManager.NewConnReq()
+			if !sp.feeler() {
+				go s.connManager.NewConnReq()
+			}
 		}
 	}
 
+	// Forget that an outbound peer supports the v2 transport when the
+	// handshake failed, so the next connection to it uses the v1 transport.
+	if !sp.Inbound() && sp.V2HandshakeFailed() {
+		services := s.addrManager.Services(sp.NA())
+		s.addrManager.SetServices(sp.NA(), services&^wire.SFNodeP2PV2)
+	}
+
 	if _, ok := list[sp.ID()]; ok {
 		if !sp.Inbound() && sp.VersionKnown() {
-			state.outboundGroups[addrmgr.GroupKey(sp.NA())]--
+			state.outboundGroups[s.addrManager.GroupKey(sp.NA())]--
 		}
 		delete(list, sp.ID())
-		srvrLog.Debugf("Removed peer %s", sp)
+		sp.logger(srvrLog).Debugf("Removed peer %s", sp)
 		return
 	}
 }
@@ -1759,11 +2054,12 @@ func (s *server) handleDonePeerMsg(state *peerState, sp *serverPeer) {
 func (s *server) handleBanPeerMsg(state *peerState, sp *serverPeer) {
 	host, _, err := net.SplitHostPort(sp.Addr())
 	if err != nil {
-		srvrLog.Debugf("can't split ban peer %s %v", sp.Addr(), err)
+		sp.logger(srvrLog).Debugf("can't split ban peer %s %v",
+			sp.Addr(), err)
 		return
 	}
 	direction := directionString(sp.Inbound())
-	srvrLog.Infof("Banned peer %s (%s) for %v", host, direction,
+	sp.logger(srvrLog).Infof("Banned peer %s (%s) for %v", host, direction,
 		cfg.BanDuration)
 	state.banned[host] = time.Now().Add(cfg.BanDuration)
 }
@@ -1798,8 +2094,8 @@ func (s *server) handleRelayInvMsg(state *peerState, msg relayMsg) {
 
 		if msg.invVect.Type == wire.InvTypeTx {
 			// Don't relay the transaction to the peer when it has
-			// transaction relaying disabled.
-			if sp.relayTxDisabled() {
+			// transaction relaying disabled or only relays blocks.
+			if sp.relayTxDisabled() || sp.blockRelayOnly() {
 				return
 			}
 
@@ -1942,7 +2238,7 @@ func (s *server) handleQuery(state *peerState, querymsg interface{}) {
 		found := disconnectPeer(state.persistentPeers, msg.cmp, func(sp *serverPeer) {
 			// Keep group counts ok since we remove from
 			// the list now.
-			state.outboundGroups[addrmgr.GroupKey(sp.NA())]--
+			state.outboundGroups[s.addrManager.GroupKey(sp.NA())]--
 		})
 
 		if found {
@@ -1978,7 +2274,7 @@ func (s *server) handleQuery(state *peerState, querymsg interface{}) {
 		found = disconnectPeer(state.outboundPeers, msg.cmp, func(sp *serverPeer) {
 			// Keep group counts ok since we remove from
 			// the list now.
-			state.outboundGroups[addrmgr.GroupKey(sp.NA())]--
+			state.outboundGroups[s.addrManager.GroupKey(sp.NA())]--
 		})
 		if found {
 			// If there are multiple outbound connections to the same
@@ -1986,7 +2282,7 @@ func (s *server) handleQuery(state *peerState, querymsg interface{}) {
 			// peers are found.
 			for found {
 				found = disconnectPeer(state.outboundPeers, msg.cmp, func(sp *serverPeer) {
-					state.outboundGroups[addrmgr.GroupKey(sp.NA())]--
+					state.outboundGroups[s.addrManager.GroupKey(sp.NA())]--
 				})
 			}
 			msg.reply <- nil
@@ -2065,6 +2361,7 @@ func newPeerConfig(sp *serverPeer) *peer.Config {
 		DisableRelayTx:    cfg.BlocksOnly,
 		ProtocolVersion:   peer.MaxProtocolVersion,
 		TrickleInterval:   cfg.TrickleInterval,
+		TxFeeRate:         sp.txFeeRate,
 	}
 }
 
@@ -2075,7 +2372,9 @@ func newPeerConfig(sp *serverPeer) *peer.Config {
 func (s *server) inboundPeerConnected(conn net.Conn) {
 	sp := newServerPeer(s, false)
 	sp.isWhitelisted = isWhitelisted(conn.RemoteAddr())
-	sp.Peer = peer.NewInboundPeer(newPeerConfig(sp))
+	peerCfg := newPeerConfig(sp)
+	peerCfg.V2Transport = s.services&wire.SFNodeP2PV2 != 0
+	sp.Peer = peer.NewInboundPeer(peerCfg)
 	sp.AssociateConnection(conn)
 	go s.peerDoneHandler(sp)
 }
@@ -2087,14 +2386,22 @@ func (s *server) inboundPeerConnected(conn net.Conn) {
 // manager of the attempt.
 func (s *server) outboundPeerConnected(c *connmgr.ConnReq, conn net.Conn) {
 	sp := newServerPeer(s, c.Permanent)
-	p, err := peer.NewOutboundPeer(newPeerConfig(sp), c.Addr.String())
+	peerCfg := newPeerConfig(sp)
+	peerCfg.V2Transport = s.services&wire.SFNodeP2PV2 != 0 &&
+		s.v2TransportSupported(c.Addr)
+	if c.Type == connmgr.ConnBlockRelayOnly || c.Type == connmgr.ConnFeeler {
+		peerCfg.DisableRelayTx = true
+	}
+	p, err := peer.NewOutboundPeer(peerCfg, c.Addr.String())
 	if err != nil {
 		srvrLog.Debugf("Cannot create outbound peer %s: %v", c.Addr, err)
 		if c.Permanent {
 			s.connManager.Disconnect(c.ID())
 		} else {
 			s.connManager.Remove(c.ID())
-			go s.connManager.NewConnReq()
+			if c.Type != connmgr.ConnFeeler {
+				go s.connManager.NewConnReq()
+			}
 		}
 		return
 	}
@@ -2105,6 +2412,18 @@ func (s *server) outboundPeerConnected(c *connmgr.ConnReq, conn net.Conn) {
 	go s.peerDoneHandler(sp)
 }
 
+// v2TransportSupported returns whether the passed address is known to support
+// the v2 transport.  Addresses which are unknown to the address manager, such
+// as the ones of manually added peers, are assumed to only support the v1
+// transport.
+func (s *server) v2TransportSupported(addr net.Addr) bool {
+	na, err := s.addrManager.DeserializeNetAddress(addr.String(), 0)
+	if err != nil {
+		return false
+	}
+	return s.addrManager.Services(na)&wire.SFNodeP2PV2 != 0
+}
+
 // peerDoneHandler handles peer disconnects by notifiying the server that it's
 // done along with other performing other desirable cleanup.
 func (s *server) peerDoneHandler(sp *serverPeer) {
@@ -2112,15 +2431,17 @@ func (s *server) peerDoneHandler(sp *serverPeer) {
 	s.donePeers <- sp
 
 	// Only tell sync manager we are gone if we ever told it we existed.
-	if sp.VerAckReceived() {
+	// Feeler connections are disconnected once the handshake completes
+	// without being added, so they are never known to it.
+	if sp.VerAckReceived() && !sp.feeler() {
 		s.syncManager.DonePeer(sp.Peer)
 
 		// Evict any remaining orphans that were sent by the peer.
 		numEvicted := s.txMemPool.RemoveOrphansByTag(mempool.Tag(sp.ID()))
 		if numEvicted > 0 {
-			txmpLog.Debugf("Evicted %d %s from peer %v (id %d)",
-				numEvicted, pickNoun(numEvicted, "orphan",
-					"orphans"), sp, sp.ID())
+			noun := pickNoun(numEvicted, "orphan", "orphans")
+			sp.logger(txmpLog).Debugf("Evicted %d %s from peer %v "+
+				"(id %d)", numEvicted, noun, sp, sp.ID())
 		}
 	}
 	close(sp.quit)
@@ -2194,9 +2515,15 @@ out:
 			s.handleQuery(state, qmsg)
 
 		case <-s.quit:
+			// Save the block relay only peers as anchors to
+			// reconnect to on startup, which makes it harder to
+			// eclipse the node across restarts.
+			s.saveAnchors(state)
+
 			// Disconnect all peers on server shutdown.
 			state.forAllPeers(func(sp *serverPeer) {
-				srvrLog.Tracef("Shutdown peer %s", sp)
+				sp.logger(srvrLog).Tracef("Shutdown peer %s",
+					sp)
 				sp.Disconnect()
 			})
 			break out
@@ -2384,9 +2711,22 @@ func (s *server) Start() {
 		// the RPC server are rebroadcast until being included in a block.
 		go s.rebroadcastHandler()
 
+		if s.privateBroadcaster != nil {
+			s.wg.Add(1)
+			go s.privateBroadcaster.handler()
+		}
+
 		s.rpcServer.Start()
 	}
 
+	if s.zmqPublisher != nil {
+		s.zmqPublisher.Start()
+	}
+
+	if s.metrics != nil {
+		s.metrics.Start()
+	}
+
 	// Start the CPU miner if generation is enabled.
 	if cfg.Generate {
 		s.cpuMiner.Start()
@@ -2412,6 +2752,16 @@ func (s *server) Stop() error {
 		s.rpcServer.Stop()
 	}
 
+	// Stop publishing to ZMQ subscribers.
+	if s.zmqPublisher != nil {
+		s.zmqPublisher.Stop()
+	}
+
+	// Stop serving metrics.
+	if s.metrics != nil {
+		s.metrics.Stop()
+	}
+
 	// Save fee estimator state in the database.
 	s.db.Update(func(tx database.Tx) error {
 		metadata := tx.Metadata()
@@ -2631,8 +2981,24 @@ func newServer(listenAddrs, agentBlacklist, agentWhitelist []string,
 	if cfg.NoCFilters {
 		services &^= wire.SFNodeCF
 	}
+	if cfg.NoV2Transport {
+		services &^= wire.SFNodeP2PV2
+	}
+	if cfg.NoNodeNetwork {
+		services &^= wire.SFNodeNetwork
+	}
 
 	amgr := addrmgr.New(cfg.DataDir, btcdLookup)
+	if cfg.ASMap != "" {
+		asmap, err := addrmgr.LoadASMap(cfg.ASMap)
+		if err != nil {
+			return nil, fmt.Errorf("unable to load asmap %s: %v",
+				cfg.ASMap, err)
+		}
+		amgr.SetASMap(asmap)
+		srvrLog.Infof("Using asmap %s to group peers by autonomous "+
+			"system", cfg.ASMap)
+	}
 
 	var listeners []net.Listener
 	var nat NAT
@@ -2675,6 +3041,10 @@ func newServer(listenAddrs, agentBlacklist, agentWhitelist []string,
 		cfCheckptCaches:      make(map[wire.FilterType][]cfHeaderKV),
 		agentBlacklist:       agentBlacklist,
 		agentWhitelist:       agentWhitelist,
+		netGroupKey:          make([]byte, 32),
+	}
+	if _, err := rand.Read(s.netGroupKey); err != nil {
+		return nil, err
 	}
 
 	// Create the transaction and address indexes if needed.
@@ -2703,6 +3073,21 @@ func newServer(listenAddrs, agentBlacklist, agentWhitelist []string,
 		s.addrIndex = indexers.NewAddrIndex(db, chainParams)
 		indexes = append(indexes, s.addrIndex)
 	}
+	if cfg.AddrUtxoIndex {
+		indxLog.Info("Address utxo index is enabled")
+		s.addrUtxoIndex = indexers.NewAddrUtxoIndex(db, chainParams)
+		indexes = append(indexes, s.addrUtxoIndex)
+	}
+	if cfg.SpendIndex {
+		indxLog.Info("Spent output index is enabled")
+		s.spendIndex = indexers.NewSpendIndex(db)
+		indexes = append(indexes, s.spendIndex)
+	}
+	if cfg.BlockStatsIndex {
+		indxLog.Info("Block stats index is enabled")
+		s.blockStatsIndex = indexers.NewBlockStatsIndex(db, chainParams)
+		indexes = append(indexes, s.blockStatsIndex)
+	}
 	if !cfg.NoCFilters {
 		indxLog.Info("Committed filter index is enabled")
 		s.cfIndex = indexers.NewCfIndex(db, chainParams)
@@ -2790,10 +3175,30 @@ func newServer(listenAddrs, agentBlacklist, agentWhitelist []string,
 		SigCache:           s.sigCache,
 		HashCache:          s.hashCache,
 		AddrIndex:          s.addrIndex,
+		AddrUtxoIndex:      s.addrUtxoIndex,
 		FeeEstimator:       s.feeEstimator,
 	}
 	s.txMemPool = mempool.New(&txC)
 
+	if cfg.PrivateBroadcast {
+		s.privateBroadcaster = newPrivateBroadcaster(&s,
+			cfg.privateBroadcastDial)
+	}
+
+	// Setup the metrics before the subsystems which report to them.
+	var blockProcessed func(time.Duration)
+	if len(cfg.MetricsListeners) > 0 {
+		metricsListeners, err := setupMetricsListeners()
+		if err != nil {
+			return nil, err
+		}
+		if len(metricsListeners) == 0 {
+			return nil, errors.New("Metrics: No valid listen address")
+		}
+		s.metrics = newServerMetrics(&s, metricsListeners)
+		blockProcessed = s.metrics.observeBlockProcessing
+	}
+
 	s.syncManager, err = netsync.New(&netsync.Config{
 		PeerNotifier:       &s,
 		Chain:              s.chain,
@@ -2801,7 +3206,9 @@ func newServer(listenAddrs, agentBlacklist, agentWhitelist []string,
 		ChainParams:        s.chainParams,
 		DisableCheckpoints: cfg.DisableCheckpoints,
 		MaxPeers:           cfg.MaxPeers,
+		MinimumChainWork:   cfg.minimumChainWork,
 		FeeEstimator:       s.feeEstimator,
+		BlockProcessed:     blockProcessed,
 	})
 	if err != nil {
 		return nil, err
@@ -2853,7 +3260,7 @@ func newServer(listenAddrs, agentBlacklist, agentWhitelist []string,
 				// in the same group so that we are not connecting
 				// to the same network segment at the expense of
 				// others.
-				key := addrmgr.GroupKey(addr.NetAddress())
+				key := s.addrManager.GroupKey(addr.NetAddress())
 				if s.OutboundGroupCount(key) != 0 {
 					continue
 				}
@@ -2881,19 +3288,78 @@ func newServer(listenAddrs, agentBlacklist, agentWhitelist []string,
 		}
 	}
 
-	// Create a connection manager.
+	// Likewise, only setup a function to return addresses to test with
+	// feeler connections when not running in connect-only mode.  Feelers
+	// test addresses which were never connected to and the addresses which
+	// would be evicted from the tried table when another address is marked
+	// good.
+	var feelerAddressFunc func() (net.Addr, error)
+	if newAddressFunc != nil {
+		feelerAddressFunc = func() (net.Addr, error) {
+			addr := s.addrManager.GetFeelerAddress()
+			if addr == nil {
+				return nil, errors.New("no valid feeler address")
+			}
+
+			// Don't connect to the same network segment as an
+			// outbound peer.
+			key := s.addrManager.GroupKey(addr.NetAddress())
+			if s.OutboundGroupCount(key) != 0 {
+				return nil, errors.New("no valid feeler address")
+			}
+
+			// Mark an attempt for the valid address.
+			s.addrManager.Attempt(addr.NetAddress())
+
+			addrString := addrmgr.NetAddressKey(addr.NetAddress())
+			return addrStringToNetAddr(addrString)
+		}
+	}
+
+	// Create a connection manager.  Block relay only connections are only
+	// made to discovered peers.
 	targetOutbound := defaultTargetOutbound
 	if cfg.MaxPeers < targetOutbound {
 		targetOutbound = cfg.MaxPeers
 	}
+	var targetBlockRelayOnly int
+	if newAddressFunc != nil {
+		targetBlockRelayOnly = defaultBlockRelayOnlyOutbound
+		if cfg.MaxPeers-targetOutbound < targetBlockRelayOnly {
+			targetBlockRelayOnly = cfg.MaxPeers - targetOutbound
+		}
+	}
+
+	// Reconnect to the anchors saved on the last shutdown as block relay
+	// only peers once the connection manager is started.
+	var anchorAddrs []net.Addr
+	if targetBlockRelayOnly > 0 {
+		anchors, err := loadAnchors(cfg.DataDir)
+		if err != nil {
+			srvrLog.Warnf("Unable to load anchors: %v", err)
+		}
+		for _, addr := range anchors {
+			netAddr, err := addrStringToNetAddr(addr)
+			if err != nil {
+				srvrLog.Debugf("Ignoring anchor %s: %v", addr, err)
+				continue
+			}
+			anchorAddrs = append(anchorAddrs, netAddr)
+		}
+	}
+
 	cmgr, err := connmgr.New(&connmgr.Config{
-		Listeners:      listeners,
-		OnAccept:       s.inboundPeerConnected,
-		RetryDuration:  connectionRetryInterval,
-		TargetOutbound: uint32(targetOutbound),
-		Dial:           btcdDial,
-		OnConnection:   s.outboundPeerConnected,
-		GetNewAddress:  newAddressFunc,
+		Listeners:            listeners,
+		OnAccept:             s.inboundPeerConnected,
+		RetryDuration:        connectionRetryInterval,
+		TargetOutbound:       uint32(targetOutbound),
+		TargetBlockRelayOnly: uint32(targetBlockRelayOnly),
+		Anchors:              anchorAddrs,
+		Dial:                 btcdDial,
+		OnConnection:         s.outboundPeerConnected,
+		GetNewAddress:        newAddressFunc,
+		FeelerInterval:       feelerInterval,
+		GetFeelerAddress:     feelerAddressFunc,
 	})
 	if err != nil {
 		return nil, err
@@ -2929,21 +3395,25 @@ func newServer(listenAddrs, agentBlacklist, agentWhitelist []string,
 		}
 
 		s.rpcServer, err = newRPCServer(&rpcserverConfig{
-			Listeners:    rpcListeners,
-			StartupTime:  s.startupTime,
-			ConnMgr:      &rpcConnManager{&s},
-			SyncMgr:      &rpcSyncMgr{&s, s.syncManager},
-			TimeSource:   s.timeSource,
-			Chain:        s.chain,
-			ChainParams:  chainParams,
-			DB:           db,
-			TxMemPool:    s.txMemPool,
-			Generator:    blockTemplateGenerator,
-			CPUMiner:     s.cpuMiner,
-			TxIndex:      s.txIndex,
-			AddrIndex:    s.addrIndex,
-			CfIndex:      s.cfIndex,
-			FeeEstimator: s.feeEstimator,
+			Listeners:       rpcListeners,
+			StartupTime:     s.startupTime,
+			ConnMgr:         &rpcConnManager{&s},
+			SyncMgr:         &rpcSyncMgr{&s, s.syncManager},
+			TimeSource:      s.timeSource,
+			Chain:           s.chain,
+			ChainParams:     chainParams,
+			DB:              db,
+			TxMemPool:       s.txMemPool,
+			Generator:       blockTemplateGenerator,
+			CPUMiner:        s.cpuMiner,
+			TxIndex:         s.txIndex,
+			AddrIndex:       s.addrIndex,
+			AddrUtxoIndex:   s.addrUtxoIndex,
+			SpendIndex:      s.spendIndex,
+			BlockStatsIndex: s.blockStatsIndex,
+			CfIndex:         s.cfIndex,
+			FeeEstimator:    s.feeEstimator,
+			Metrics:         s.metrics,
 		})
 		if err != nil {
 			return nil, err
@@ -2956,9 +3426,54 @@ func newServer(listenAddrs, agentBlacklist, agentWhitelist []string,
 		}()
 	}
 
+	// Setup the ZMQ publisher when any of its topics are enabled.
+	zmqEndpoints := make(map[string]string)
+	for topic, addr := range map[string]string{
+		zmqpub.TopicHashBlock: cfg.ZMQPubHashBlock,
+		zmqpub.TopicHashTx:    cfg.ZMQPubHashTx,
+		zmqpub.TopicRawBlock:  cfg.ZMQPubRawBlock,
+		zmqpub.TopicRawTx:     cfg.ZMQPubRawTx,
+		zmqpub.TopicSequence:  cfg.ZMQPubSequence,
+	} {
+		if addr != "" {
+			zmqEndpoints[topic] = addr
+		}
+	}
+	if len(zmqEndpoints) > 0 {
+		s.zmqPublisher, err = zmqpub.New(&zmqpub.Config{
+			Endpoints:     zmqEndpoints,
+			HighWaterMark: cfg.ZMQPubHWM,
+		})
+		if err != nil {
+			return nil, err
+		}
+		s.chain.Subscribe(s.handleZMQNotification)
+	}
+
 	return &s, nil
 }
 
+// setupMetricsListeners returns a slice of listeners for the configured
+// metrics listen addresses.
+func setupMetricsListeners() ([]net.Listener, error) {
+	netAddrs, err := parseListeners(cfg.MetricsListeners)
+	if err != nil {
+		return nil, err
+	}
+
+	listeners := make([]net.Listener, 0, len(netAddrs))
+	for _, addr := range netAddrs {
+		listener, err := net.Listen(addr.Network(), addr.String())
+		if err != nil {
+			srvrLog.Warnf("Can't listen on %s: %v", addr, err)
+			continue
+		}
+		listeners = append(listeners, listener)
+	}
+
+	return listeners, nil
+}
+
 // initListeners initializes the configured net listeners and adds any bound
 // addresses to the address manager. Returns the listeners and a NAT interface,
 // which is non-nil if UPnP is in use.
@@ -3248,9 +3763,9 @@ func (sp *serverPeer) HasUndesiredUserAgent(blacklistedAgents,
 	// will ignore the connection request.
 	for _, blacklistedAgent := range blacklistedAgents {
 		if strings.Contains(agent, blacklistedAgent) {
-			srvrLog.Debugf("Ignoring peer %s, user agent "+
-				"contains blacklisted user agent: %s", sp,
-				agent)
+			sp.logger(srvrLog).Debugf("Ignoring peer %s, user "+
+				"agent contains blacklisted user agent: %s",
+				sp, agent)
 			return true
 		}
 	}
@@ -3270,8 +3785,8 @@ func (sp *serverPeer) HasUndesiredUserAgent(blacklistedAgents,
 
 	// Otherwise, the peer's user agent was not included in our whitelist.
 	// Ignore just in case it could stall the initial block download.
-	srvrLog.Debugf("Ignoring peer %s, user agent: %s not found in "+
-		"whitelist", sp, agent)
+	sp.logger(srvrLog).Debugf("Ignoring peer %s, user agent: %s not found "+
+		"in whitelist", sp, agent)
 
 	return true
 }
@@ -0,0 +1,225 @@
+// Copyright (c) 2021 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/btcsuite/btcd/blockchain"
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/database"
+	"github.com/btcsuite/btcd/mempool"
+	"github.com/btcsuite/btcd/txscript"
+	"github.com/btcsuite/btcd/wire"
+	"github.com/btcsuite/btclog"
+	"github.com/btcsuite/btcutil"
+)
+
+// newTestChain returns a chain with the passed number of blocks after the
+// genesis block of the simulation test network, which is stored in a temporary
+// database, along with a function which removes the database.
+func newTestChain(t *testing.T, numBlocks int) (*blockchain.BlockChain, func()) {
+	t.Helper()
+
+	// The loggers can't be used before the log rotator is initialized.
+	bcdbLog.SetLevel(btclog.LevelOff)
+	chanLog.SetLevel(btclog.LevelOff)
+
+	params := &chaincfg.SimNetParams
+	dbPath, err := ioutil.TempDir("", "servertest")
+	if err != nil {
+		t.Fatalf("unable to create temp dir: %v", err)
+	}
+	db, err := database.Create("ffldb", filepath.Join(dbPath, "db"),
+		params.Net)
+	if err != nil {
+		os.RemoveAll(dbPath)
+		t.Fatalf("unable to create database: %v", err)
+	}
+	teardown := func() {
+		db.Close()
+		os.RemoveAll(dbPath)
+	}
+
+	chain, err := blockchain.New(&blockchain.Config{
+		DB:          db,
+		ChainParams: params,
+		TimeSource:  blockchain.NewMedianTime(),
+		SigCache:    txscript.NewSigCache(1000),
+	})
+	if err != nil {
+		teardown()
+		t.Fatalf("unable to create chain: %v", err)
+	}
+
+	prevHeader := &params.GenesisBlock.Header
+	target := blockchain.CompactToBig(params.PowLimitBits)
+	for height := int64(1); height <= int64(numBlocks); height++ {
+		coinbaseScript, err := txscript.NewScriptBuilder().
+			AddInt64(height).AddInt64(0).Script()
+		if err != nil {
+			teardown()
+			t.Fatalf("unable to create coinbase script: %v", err)
+		}
+		coinbaseTx := wire.NewMsgTx(wire.TxVersion)
+		coinbaseTx.AddTxIn(&wire.TxIn{
+			PreviousOutPoint: *wire.NewOutPoint(&chainhash.Hash{},
+				wire.MaxPrevOutIndex),
+			SignatureScript: coinbaseScript,
+			Sequence:        wire.MaxTxInSequenceNum,
+		})
+		coinbaseTx.AddTxOut(wire.NewTxOut(0, []byte{txscript.OP_TRUE}))
+
+		msgBlock := wire.NewMsgBlock(&wire.BlockHeader{
+			Version:    4,
+			PrevBlock:  prevHeader.BlockHash(),
+			MerkleRoot: coinbaseTx.TxHash(),
+			Timestamp:  prevHeader.Timestamp.Add(time.Minute),
+			Bits:       params.PowLimitBits,
+		})
+		msgBlock.AddTransaction(coinbaseTx)
+		for {
+			hash := msgBlock.Header.BlockHash()
+			if blockchain.HashToBig(&hash).Cmp(target) <= 0 {
+				break
+			}
+			msgBlock.Header.Nonce++
+		}
+
+		_, _, err = chain.ProcessBlock(btcutil.NewBlock(msgBlock),
+			blockchain.BFNone)
+		if err != nil {
+			teardown()
+			t.Fatalf("unable to process block %d: %v", height, err)
+		}
+		prevHeader = &msgBlock.Header
+	}
+	return chain, teardown
+}
+
+// newTestMemPool returns a memory pool for the passed chain with a transaction
+// spending the coinbase of each of the passed number of blocks after the
+// genesis block.
+func newTestMemPool(t *testing.T, chain *blockchain.BlockChain, numTxns int) (*mempool.TxPool, []*mempool.TxDesc) {
+	t.Helper()
+
+	txPool := mempool.New(&mempool.Config{
+		Policy: mempool.Policy{
+			AcceptNonStd:      true,
+			MaxSigOpCostPerTx: blockchain.MaxBlockSigOpsCost / 4,
+			MaxTxVersion:      2,
+		},
+		ChainParams:    &chaincfg.SimNetParams,
+		FetchUtxoView:  chain.FetchUtxoView,
+		BestHeight:     func() int32 { return chain.BestSnapshot().Height },
+		MedianTimePast: func() time.Time { return chain.BestSnapshot().MedianTime },
+		CalcSequenceLock: func(tx *btcutil.Tx, view *blockchain.UtxoViewpoint) (*blockchain.SequenceLock, error) {
+			return chain.CalcSequenceLock(tx, view, true)
+		},
+		IsDeploymentActive: chain.IsDeploymentActive,
+		SigCache:           txscript.NewSigCache(1000),
+		HashCache:          txscript.NewHashCache(1000),
+	})
+
+	txDescs := make([]*mempool.TxDesc, 0, numTxns)
+	for i := 0; i < numTxns; i++ {
+		block, err := chain.BlockByHeight(int32(i + 1))
+		if err != nil {
+			t.Fatalf("unable to fetch block %d: %v", i+1, err)
+		}
+		coinbaseHash := block.Transactions()[0].Hash()
+
+		tx := wire.NewMsgTx(wire.TxVersion)
+		tx.AddTxIn(wire.NewTxIn(wire.NewOutPoint(coinbaseHash, 0), nil,
+			nil))
+		tx.AddTxOut(wire.NewTxOut(0, []byte{txscript.OP_TRUE}))
+		_, txD, err := txPool.MaybeAcceptTransaction(btcutil.NewTx(tx),
+			true, false)
+		if err != nil {
+			t.Fatalf("unable to add transaction %d to the memory "+
+				"pool: %v", i, err)
+		}
+		txDescs = append(txDescs, txD)
+	}
+	return txPool, txDescs
+}
+
+// TestCheckBlockServable ensures a node which advertises SFNodeNetworkLimited
+// without SFNodeNetwork only serves the recent blocks of its main chain, while
+// a full node serves all blocks.
+func TestCheckBlockServable(t *testing.T) {
+	chain, teardown := newTestChain(t, wire.NodeNetworkLimitedBlocks+1)
+	defer teardown()
+
+	full := &server{
+		chain:    chain,
+		services: wire.SFNodeNetwork | wire.SFNodeNetworkLimited,
+	}
+	limited := &server{
+		chain:    chain,
+		services: wire.SFNodeNetworkLimited,
+	}
+	unknownHash := chainhash.Hash{0x01}
+	tests := []struct {
+		name     string
+		server   *server
+		height   int32
+		hash     *chainhash.Hash
+		servable bool
+	}{
+		{
+			name:     "full node genesis block",
+			server:   full,
+			height:   0,
+			servable: true,
+		},
+		{
+			name:     "limited node genesis block",
+			server:   limited,
+			height:   0,
+			servable: false,
+		},
+		{
+			name:     "limited node oldest recent block",
+			server:   limited,
+			height:   1,
+			servable: true,
+		},
+		{
+			name:     "limited node tip",
+			server:   limited,
+			height:   wire.NodeNetworkLimitedBlocks + 1,
+			servable: true,
+		},
+		{
+			name:     "limited node unknown block",
+			server:   limited,
+			hash:     &unknownHash,
+			servable: false,
+		},
+	}
+
+	for _, test := range tests {
+		hash := test.hash
+		if hash == nil {
+			var err error
+			hash, err = chain.BlockHashByHeight(test.height)
+			if err != nil {
+				t.Fatalf("%s: unable to get block hash: %v",
+					test.name, err)
+			}
+		}
+		err := test.server.checkBlockServable(hash)
+		if servable := err == nil; servable != test.servable {
+			t.Errorf("%s: servable %v, want %v (err: %v)", test.name,
+				servable, test.servable, err)
+		}
+	}
+}
@@ -0,0 +1,120 @@
+// Copyright (c) 2021 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package v2transport
+
+import (
+	"crypto/cipher"
+	"encoding/binary"
+
+	"golang.org/x/crypto/chacha20"
+	"golang.org/x/crypto/chacha20poly1305"
+)
+
+const (
+	// rekeyInterval is the number of chunks or packets after which the
+	// forward secure ciphers derive a new key.
+	rekeyInterval = 224
+
+	// keyLen is the length of the keys of the ciphers.
+	keyLen = chacha20.KeySize
+)
+
+// fsChaCha20 is the forward secure ChaCha20 stream cipher which encrypts the
+// length fields of the packets.  It rekeys itself after every rekeyInterval
+// chunks with the next bytes of its key stream.
+type fsChaCha20 struct {
+	cipher       *chacha20.Cipher
+	chunkCounter uint32
+	rekeyCounter uint64
+}
+
+// newFSChaCha20 returns a forward secure ChaCha20 cipher with the passed initial
+// key.
+func newFSChaCha20(key []byte) *fsChaCha20 {
+	c := &fsChaCha20{}
+	c.setKey(key)
+	return c
+}
+
+// setKey starts the key stream of the passed key with a nonce made of the
+// rekey counter.
+func (c *fsChaCha20) setKey(key []byte) {
+	var nonce [chacha20.NonceSize]byte
+	binary.LittleEndian.PutUint64(nonce[4:], c.rekeyCounter)
+
+	// The key and nonce always have the correct lengths.
+	c.cipher, _ = chacha20.NewUnauthenticatedCipher(key, nonce[:])
+}
+
+// crypt encrypts or decrypts the passed chunk in place.
+func (c *fsChaCha20) crypt(chunk []byte) {
+	c.cipher.XORKeyStream(chunk, chunk)
+	c.chunkCounter++
+	if c.chunkCounter == rekeyInterval {
+		var key [keyLen]byte
+		c.cipher.XORKeyStream(key[:], key[:])
+		c.chunkCounter = 0
+		c.rekeyCounter++
+		c.setKey(key[:])
+	}
+}
+
+// fsChaCha20Poly1305 is the forward secure ChaCha20-Poly1305 AEAD which
+// encrypts the contents of the packets.  The nonce is made of the packet
+// counter, and the cipher rekeys itself after every rekeyInterval packets.
+type fsChaCha20Poly1305 struct {
+	aead          cipher.AEAD
+	packetCounter uint32
+	rekeyCounter  uint64
+}
+
+// newFSChaCha20Poly1305 returns a forward secure ChaCha20-Poly1305 AEAD with the
+// passed initial key.
+func newFSChaCha20Poly1305(key []byte) *fsChaCha20Poly1305 {
+	// The key always has the correct length.
+	aead, _ := chacha20poly1305.New(key)
+	return &fsChaCha20Poly1305{aead: aead}
+}
+
+// nonce returns the nonce of the next packet.
+func (c *fsChaCha20Poly1305) nonce() []byte {
+	var nonce [chacha20poly1305.NonceSize]byte
+	binary.LittleEndian.PutUint32(nonce[:4], c.packetCounter)
+	binary.LittleEndian.PutUint64(nonce[4:], c.rekeyCounter)
+	return nonce[:]
+}
+
+// nextPacket advances the packet counter and rekeys the AEAD when the rekey
+// interval is reached.  The new key is the first part of the encryption of
+// zeros with a nonce whose packet counter part has all bits set.
+func (c *fsChaCha20Poly1305) nextPacket() {
+	c.packetCounter++
+	if c.packetCounter != rekeyInterval {
+		return
+	}
+
+	nonce := c.nonce()
+	binary.LittleEndian.PutUint32(nonce[:4], 0xffffffff)
+	key := c.aead.Seal(nil, nonce, make([]byte, keyLen), nil)[:keyLen]
+	c.aead, _ = chacha20poly1305.New(key)
+	c.packetCounter = 0
+	c.rekeyCounter++
+}
+
+// encrypt returns the encryption of the passed plaintext authenticated along
+// with the passed additional data.
+func (c *fsChaCha20Poly1305) encrypt(aad, plaintext []byte) []byte {
+	ciphertext := c.aead.Seal(nil, c.nonce(), plaintext, aad)
+	c.nextPacket()
+	return ciphertext
+}
+
+// decrypt returns the decryption of the passed ciphertext, or an error when it
+// or the passed additional data fails to authenticate.
+func (c *fsChaCha20Poly1305) decrypt(aad, ciphertext []byte) ([]byte, error) {
+	plaintext, err := c.aead.Open(nil, c.nonce(), ciphertext, aad)
+	c.nextPacket()
+	return plaintext, err
+}
@@ -0,0 +1,72 @@
+// Copyright (c) 2021 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package v2transport
+
+import (
+	"bytes"
+	"testing"
+)
+
+// TestFSChaCha20Rekey ensures both sides of the forward secure ChaCha20 cipher
+// stay in sync across several rekeys and that the key stream changes with the
+// key.
+func TestFSChaCha20Rekey(t *testing.T) {
+	key := bytes.Repeat([]byte{0x01}, keyLen)
+	enc := newFSChaCha20(key)
+	dec := newFSChaCha20(key)
+	seen := make(map[string]bool)
+	for i := 0; i < 3*rekeyInterval+5; i++ {
+		chunk := []byte{0x00, 0x00, 0x00}
+		enc.crypt(chunk)
+		if i%rekeyInterval == 0 {
+			if seen[string(chunk)] {
+				t.Fatalf("chunk %d: key stream repeated after rekey", i)
+			}
+			seen[string(chunk)] = true
+		}
+		dec.crypt(chunk)
+		if !bytes.Equal(chunk, []byte{0x00, 0x00, 0x00}) {
+			t.Fatalf("chunk %d: decrypted %x", i, chunk)
+		}
+	}
+	if enc.rekeyCounter != 3 || enc.chunkCounter != 5 {
+		t.Fatalf("unexpected counters %d and %d", enc.rekeyCounter,
+			enc.chunkCounter)
+	}
+}
+
+// TestFSChaCha20Poly1305Rekey ensures both sides of the forward secure AEAD
+// stay in sync across several rekeys and that tampered packets and additional
+// data are rejected.
+func TestFSChaCha20Poly1305Rekey(t *testing.T) {
+	key := bytes.Repeat([]byte{0x02}, keyLen)
+	enc := newFSChaCha20Poly1305(key)
+	dec := newFSChaCha20Poly1305(key)
+	aad := []byte("aad")
+	for i := 0; i < 2*rekeyInterval+3; i++ {
+		plaintext := []byte{byte(i), byte(i >> 8)}
+		ciphertext := enc.encrypt(aad, plaintext)
+		got, err := dec.decrypt(aad, ciphertext)
+		if err != nil {
+			t.Fatalf("packet %d: unable to decrypt: %v", i, err)
+		}
+		if !bytes.Equal(got, plaintext) {
+			t.Fatalf("packet %d: decrypted %x, want %x", i, got,
+				plaintext)
+		}
+	}
+
+	// A tampered packet or different additional data fail to decrypt.
+	ciphertext := enc.encrypt(aad, []byte{0x01})
+	check := newFSChaCha20Poly1305(key)
+	*check = *dec
+	if _, err := check.decrypt(nil, ciphertext); err == nil {
+		t.Fatal("decrypted packet with different additional data")
+	}
+	ciphertext[0] ^= 0x01
+	if _, err := dec.decrypt(aad, ciphertext); err == nil {
+		t.Fatal("decrypted tampered packet")
+	}
+}
@@ -0,0 +1,26 @@
+// Copyright (c) 2021 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+/*
+Package v2transport implements the encrypted v2 transport protocol for the
+bitcoin peer-to-peer network as defined in BIP0324.
+
+Overview
+
+The v2 transport encrypts and authenticates all messages exchanged between two
+peers.  The handshake exchanges ephemeral public keys encoded with
+ElligatorSwift, which makes the whole stream indistinguishable from random
+bytes, and both sides derive the keys of the ciphers and a session ID from the
+ECDH secret.  The ciphers are rekeyed periodically for forward secrecy.
+
+Messages are sent in packets whose contents start with a message type, which is
+either a one byte short ID for common messages or a zero byte followed by the
+padded command.  The payloads are encoded as in the v1 transport.
+
+Since peers which don't support the v2 transport send their version message
+right away, the responding side of a connection detects them from the first
+bytes it reads and returns ErrV1Transport, so the connection can fall back to
+the v1 transport.
+*/
+package v2transport
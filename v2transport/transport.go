@@ -0,0 +1,479 @@
+// Copyright (c) 2021 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package v2transport
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+
+	"github.com/btcsuite/btcd/btcec"
+	"github.com/btcsuite/btcd/wire"
+	"golang.org/x/crypto/hkdf"
+)
+
+const (
+	// MaxGarbageLen is the maximum number of garbage bytes which may follow
+	// the public key of each side of the handshake.
+	MaxGarbageLen = 4095
+
+	// garbageTerminatorLen is the length of the terminators which follow
+	// the garbage of each side.
+	garbageTerminatorLen = 16
+
+	// lengthFieldLen is the length of the encrypted length field of the
+	// packets.
+	lengthFieldLen = 3
+
+	// headerLen is the length of the header of the packet contents.
+	headerLen = 1
+
+	// ignoreBit is the bit of the header which marks decoy packets that
+	// are ignored by the receiver.
+	ignoreBit = 1 << 7
+
+	// tagLen is the length of the authentication tag of the packets.
+	tagLen = 16
+
+	// maxContentsLen is the maximum length of the contents of a packet,
+	// which is made of the message type and the payload of the largest
+	// message.
+	maxContentsLen = 1 + wire.CommandSize + wire.MaxMessagePayload
+)
+
+var (
+	// ErrV1Transport is returned by the handshake of the responding side
+	// when the initiating side uses the plaintext v1 transport.  The bytes
+	// already read from the connection are returned by ReceivedPrefix.
+	ErrV1Transport = errors.New("peer uses the v1 transport")
+
+	// ErrGarbageTerminator is returned when the garbage terminator of the
+	// remote side is not found within the maximum garbage length.
+	ErrGarbageTerminator = errors.New("garbage terminator not found")
+
+	// ErrPacketAuthentication is returned when a received packet fails to
+	// authenticate.
+	ErrPacketAuthentication = errors.New("packet authentication failed")
+
+	// errPacketTooLarge is returned when a received packet exceeds the
+	// maximum contents length.
+	errPacketTooLarge = errors.New("packet too large")
+)
+
+// Transport is the encrypted v2 transport protocol (BIP0324) of a connection.
+// A handshake must be performed before messages are read and written.  Reading
+// and writing messages may happen concurrently, however each of them must not
+// be done concurrently with itself.
+type Transport struct {
+	conn      io.ReadWriter
+	r         *bufio.Reader
+	btcnet    wire.BitcoinNet
+	initiator bool
+
+	// received holds the bytes read by the responding side to detect the
+	// v1 transport.
+	received []byte
+
+	sessionID             [32]byte
+	sendLength            *fsChaCha20
+	sendPacket            *fsChaCha20Poly1305
+	recvLength            *fsChaCha20
+	recvPacket            *fsChaCha20Poly1305
+	sendGarbageTerminator []byte
+	recvGarbageTerminator []byte
+
+	// recvAAD is the garbage of the other side, which is authenticated by
+	// the first packet it sends.
+	recvAAD []byte
+
+	// handshakeWritten receives the result of the last asynchronous write
+	// of the handshake.
+	handshakeWritten chan error
+}
+
+// NewTransport returns the v2 transport of the passed connection on the
+// passed network.  The initiator is the side which opened the connection.
+func NewTransport(conn io.ReadWriter, btcnet wire.BitcoinNet,
+	initiator bool) *Transport {
+
+	return &Transport{
+		conn:      conn,
+		btcnet:    btcnet,
+		initiator: initiator,
+	}
+}
+
+// v1Prefix returns the first bytes a peer using the v1 transport sends, which
+// are the network magic and the version command of its version message.
+func v1Prefix(btcnet wire.BitcoinNet) []byte {
+	prefix := make([]byte, 4+wire.CommandSize)
+	binary.LittleEndian.PutUint32(prefix, uint32(btcnet))
+	copy(prefix[4:], wire.CmdVersion)
+	return prefix
+}
+
+// ReceivedPrefix returns the bytes read from the connection by the handshake
+// of the responding side before ErrV1Transport was returned.  They are the
+// start of the first message of the v1 transport.
+func (t *Transport) ReceivedPrefix() []byte {
+	return t.received
+}
+
+// SessionID returns the session ID both sides derive from the handshake, which
+// can be compared out of band to detect a man in the middle.
+func (t *Transport) SessionID() [32]byte {
+	return t.sessionID
+}
+
+// taggedHash returns the BIP0340 tagged hash of the passed message.
+func taggedHash(tag string, msg ...[]byte) []byte {
+	tagHash := sha256.Sum256([]byte(tag))
+	h := sha256.New()
+	h.Write(tagHash[:])
+	h.Write(tagHash[:])
+	for _, m := range msg {
+		h.Write(m)
+	}
+	return h.Sum(nil)
+}
+
+// randomGarbage returns a random number of random garbage bytes.
+func randomGarbage() ([]byte, error) {
+	n, err := rand.Int(rand.Reader, big.NewInt(MaxGarbageLen+1))
+	if err != nil {
+		return nil, err
+	}
+	garbage := make([]byte, n.Int64())
+	if _, err := rand.Read(garbage); err != nil {
+		return nil, err
+	}
+	return garbage, nil
+}
+
+// writeAsync writes the passed bytes to the connection without blocking.  The
+// handshake writes asynchronously since the other side might not read before
+// it has written its own handshake.
+func (t *Transport) writeAsync(b []byte) {
+	prev := t.handshakeWritten
+	done := make(chan error, 1)
+	t.handshakeWritten = done
+	go func() {
+		if prev != nil {
+			if err := <-prev; err != nil {
+				done <- err
+				return
+			}
+		}
+		_, err := t.conn.Write(b)
+		done <- err
+	}()
+}
+
+// Handshake performs the handshake of the v2 transport, which exchanges the
+// keys of both sides followed by their garbage and the version packets.  The
+// responding side returns ErrV1Transport when the initiating side uses the
+// v1 transport.
+func (t *Transport) Handshake() error {
+	privKey, err := btcec.NewPrivateKey(btcec.S256())
+	if err != nil {
+		return err
+	}
+	ourKey, err := btcec.EllswiftEncode(privKey.PubKey())
+	if err != nil {
+		return err
+	}
+	garbage, err := randomGarbage()
+	if err != nil {
+		return err
+	}
+
+	// The initiating side sends its key and garbage right away, while the
+	// responding side first makes sure the other side is not using the v1
+	// transport.
+	var theirKey [btcec.EllswiftEncodingLen]byte
+	if t.initiator {
+		t.writeAsync(append(ourKey[:], garbage...))
+	} else {
+		prefix := v1Prefix(t.btcnet)
+		t.received = make([]byte, len(prefix))
+		if _, err := io.ReadFull(t.conn, t.received); err != nil {
+			return err
+		}
+		if bytes.Equal(t.received, prefix) {
+			return ErrV1Transport
+		}
+		copy(theirKey[:], t.received)
+	}
+	t.r = bufio.NewReader(t.conn)
+	if _, err := io.ReadFull(t.r, theirKey[len(t.received):]); err != nil {
+		return err
+	}
+	t.initCiphers(privKey, ourKey, theirKey)
+
+	// Send the garbage terminator and the version packet, which
+	// authenticates the garbage.  The version packet has no contents.
+	var handshake []byte
+	if !t.initiator {
+		handshake = append(ourKey[:], garbage...)
+	}
+	handshake = append(handshake, t.sendGarbageTerminator...)
+	handshake = append(handshake, t.encryptPacket(nil, garbage, false)...)
+	t.writeAsync(handshake)
+
+	// Receive the garbage of the other side up to its terminator.
+	received := make([]byte, 0, MaxGarbageLen+garbageTerminatorLen)
+	for !bytes.HasSuffix(received, t.recvGarbageTerminator) {
+		if len(received) == cap(received) {
+			return ErrGarbageTerminator
+		}
+		b, err := t.r.ReadByte()
+		if err != nil {
+			return err
+		}
+		received = append(received, b)
+	}
+	t.recvAAD = received[:len(received)-garbageTerminatorLen]
+
+	// Receive the version packet of the other side.  Its contents are
+	// reserved for future extensions and ignored.
+	if _, _, err := t.readPacket(); err != nil {
+		return err
+	}
+
+	return <-t.handshakeWritten
+}
+
+// initCiphers derives the keys of the ciphers and the session ID from the
+// ECDH secret of the passed keys.
+func (t *Transport) initCiphers(privKey *btcec.PrivateKey,
+	ourKey, theirKey [btcec.EllswiftEncodingLen]byte) {
+
+	initiatorKey, responderKey := ourKey, theirKey
+	if !t.initiator {
+		initiatorKey, responderKey = theirKey, ourKey
+	}
+	ecdh := btcec.EllswiftECDH(privKey, theirKey)
+	secret := taggedHash("bip324_ellswift_xonly_ecdh", initiatorKey[:],
+		responderKey[:], ecdh[:])
+
+	salt := []byte("bitcoin_v2_shared_secret")
+	var magic [4]byte
+	binary.LittleEndian.PutUint32(magic[:], uint32(t.btcnet))
+	salt = append(salt, magic[:]...)
+	prk := hkdf.Extract(sha256.New, secret, salt)
+	expand := func(info string) []byte {
+		key := make([]byte, 32)
+		r := hkdf.Expand(sha256.New, prk, []byte(info))
+		// Reading 32 bytes from the HKDF never fails.
+		_, _ = io.ReadFull(r, key)
+		return key
+	}
+
+	copy(t.sessionID[:], expand("session_id"))
+	initiatorL := newFSChaCha20(expand("initiator_L"))
+	initiatorP := newFSChaCha20Poly1305(expand("initiator_P"))
+	responderL := newFSChaCha20(expand("responder_L"))
+	responderP := newFSChaCha20Poly1305(expand("responder_P"))
+	terminators := expand("garbage_terminators")
+	if t.initiator {
+		t.sendLength, t.sendPacket = initiatorL, initiatorP
+		t.recvLength, t.recvPacket = responderL, responderP
+		t.sendGarbageTerminator = terminators[:garbageTerminatorLen]
+		t.recvGarbageTerminator = terminators[garbageTerminatorLen:]
+	} else {
+		t.sendLength, t.sendPacket = responderL, responderP
+		t.recvLength, t.recvPacket = initiatorL, initiatorP
+		t.sendGarbageTerminator = terminators[garbageTerminatorLen:]
+		t.recvGarbageTerminator = terminators[:garbageTerminatorLen]
+	}
+}
+
+// encryptPacket returns the encrypted packet with the passed contents, which
+// authenticates the passed additional data.  Decoy packets are marked by the
+// ignore flag.
+func (t *Transport) encryptPacket(contents, aad []byte, ignore bool) []byte {
+	plaintext := make([]byte, headerLen+len(contents))
+	if ignore {
+		plaintext[0] = ignoreBit
+	}
+	copy(plaintext[headerLen:], contents)
+
+	packet := make([]byte, lengthFieldLen, lengthFieldLen+len(plaintext)+tagLen)
+	var length [4]byte
+	binary.LittleEndian.PutUint32(length[:], uint32(len(contents)))
+	copy(packet, length[:lengthFieldLen])
+	t.sendLength.crypt(packet)
+	return append(packet, t.sendPacket.encrypt(aad, plaintext)...)
+}
+
+// readPacket reads the next packet which is not a decoy and returns its
+// contents along with the number of bytes read.
+func (t *Transport) readPacket() ([]byte, int, error) {
+	totalBytes := 0
+	for {
+		var length [4]byte
+		n, err := io.ReadFull(t.r, length[:lengthFieldLen])
+		totalBytes += n
+		if err != nil {
+			return nil, totalBytes, err
+		}
+		t.recvLength.crypt(length[:lengthFieldLen])
+		contentsLen := binary.LittleEndian.Uint32(length[:])
+		if contentsLen > maxContentsLen {
+			return nil, totalBytes, errPacketTooLarge
+		}
+
+		ciphertext := make([]byte, headerLen+contentsLen+tagLen)
+		n, err = io.ReadFull(t.r, ciphertext)
+		totalBytes += n
+		if err != nil {
+			return nil, totalBytes, err
+		}
+
+		// Only the first packet after the garbage authenticates it.
+		aad := t.recvAAD
+		t.recvAAD = nil
+		plaintext, err := t.recvPacket.decrypt(aad, ciphertext)
+		if err != nil {
+			return nil, totalBytes, ErrPacketAuthentication
+		}
+		if plaintext[0]&ignoreBit != 0 {
+			continue
+		}
+		return plaintext[headerLen:], totalBytes, nil
+	}
+}
+
+// ReadMessage reads, validates, and parses the next message of the other side
+// for the provided protocol version and message encoding.  It returns the
+// number of bytes read in addition to the parsed message and its payload.
+func (t *Transport) ReadMessage(pver uint32,
+	enc wire.MessageEncoding) (int, wire.Message, []byte, error) {
+
+	contents, n, err := t.readPacket()
+	if err != nil {
+		return n, nil, nil, err
+	}
+	command, payload, err := decodeMessageType(contents)
+	if err != nil {
+		return n, nil, nil, err
+	}
+	msg, err := wire.DecodeMessagePayload(command, payload, pver, enc)
+	if err != nil {
+		return n, nil, nil, err
+	}
+	return n, msg, payload, nil
+}
+
+// WriteMessage writes the passed message to the other side for the provided
+// protocol version and message encoding.  It returns the number of bytes
+// written.
+func (t *Transport) WriteMessage(msg wire.Message, pver uint32,
+	enc wire.MessageEncoding) (int, error) {
+
+	command, payload, err := wire.EncodeMessagePayload(msg, pver, enc)
+	if err != nil {
+		return 0, err
+	}
+	contents := append(encodeMessageType(command), payload...)
+	return t.conn.Write(t.encryptPacket(contents, nil, false))
+}
+
+// shortIDs maps the commands which have a short message type ID as defined in
+// BIP0324 to their IDs.  The IDs of messages which are not supported by the
+// wire package are still reserved.
+var shortIDs = map[string]byte{
+	wire.CmdAddr:         1,
+	wire.CmdBlock:        2,
+	"blocktxn":           3,
+	"cmpctblock":         4,
+	wire.CmdFeeFilter:    5,
+	wire.CmdFilterAdd:    6,
+	wire.CmdFilterClear:  7,
+	wire.CmdFilterLoad:   8,
+	wire.CmdGetBlocks:    9,
+	"getblocktxn":        10,
+	wire.CmdGetData:      11,
+	wire.CmdGetHeaders:   12,
+	wire.CmdHeaders:      13,
+	wire.CmdInv:          14,
+	wire.CmdMemPool:      15,
+	wire.CmdMerkleBlock:  16,
+	wire.CmdNotFound:     17,
+	wire.CmdPing:         18,
+	wire.CmdPong:         19,
+	"sendcmpct":          20,
+	wire.CmdTx:           21,
+	wire.CmdGetCFilters:  22,
+	wire.CmdCFilter:      23,
+	wire.CmdGetCFHeaders: 24,
+	wire.CmdCFHeaders:    25,
+	wire.CmdGetCFCheckpt: 26,
+	wire.CmdCFCheckpt:    27,
+	"addrv2":             28,
+}
+
+// shortIDCommands maps the short message type IDs to their commands.
+var shortIDCommands = func() map[byte]string {
+	commands := make(map[byte]string, len(shortIDs))
+	for command, id := range shortIDs {
+		commands[id] = command
+	}
+	return commands
+}()
+
+// messageError returns a wire message error for the passed function and
+// description.
+func messageError(f, desc string) *wire.MessageError {
+	return &wire.MessageError{Func: f, Description: desc}
+}
+
+// encodeMessageType returns the encoding of the passed command at the start of
+// the contents of a packet, which is the short ID of the command if it has one
+// or otherwise a zero byte followed by the padded command.
+func encodeMessageType(command string) []byte {
+	if id, ok := shortIDs[command]; ok {
+		return []byte{id}
+	}
+	msgType := make([]byte, 1+wire.CommandSize)
+	copy(msgType[1:], command)
+	return msgType
+}
+
+// decodeMessageType returns the command and the payload of the passed packet
+// contents.
+func decodeMessageType(contents []byte) (string, []byte, error) {
+	if len(contents) == 0 {
+		return "", nil, messageError("decodeMessageType",
+			"packet without message type")
+	}
+	if contents[0] != 0 {
+		command, ok := shortIDCommands[contents[0]]
+		if !ok {
+			str := fmt.Sprintf("unknown short message type ID %d",
+				contents[0])
+			return "", nil, messageError("decodeMessageType", str)
+		}
+		return command, contents[1:], nil
+	}
+
+	if len(contents) < 1+wire.CommandSize {
+		return "", nil, messageError("decodeMessageType",
+			"packet with truncated message type")
+	}
+	msgType := contents[1 : 1+wire.CommandSize]
+	command := string(bytes.TrimRight(msgType, "\x00"))
+	if bytes.IndexByte([]byte(command), 0) != -1 {
+		str := fmt.Sprintf("invalid message type %q", msgType)
+		return "", nil, messageError("decodeMessageType", str)
+	}
+	return command, contents[1+wire.CommandSize:], nil
+}
@@ -0,0 +1,303 @@
+// Copyright (c) 2021 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package v2transport
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"net"
+	"reflect"
+	"testing"
+
+	"github.com/btcsuite/btcd/btcec"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/wire"
+)
+
+// handshakePair performs the handshake of both sides of a pipe and returns
+// their transports.
+func handshakePair(t *testing.T) (*Transport, *Transport, net.Conn, net.Conn) {
+	t.Helper()
+
+	initiatorConn, responderConn := net.Pipe()
+	initiator := NewTransport(initiatorConn, wire.SimNet, true)
+	responder := NewTransport(responderConn, wire.SimNet, false)
+	errChan := make(chan error, 1)
+	go func() {
+		errChan <- responder.Handshake()
+	}()
+	if err := initiator.Handshake(); err != nil {
+		t.Fatalf("initiator handshake failed: %v", err)
+	}
+	if err := <-errChan; err != nil {
+		t.Fatalf("responder handshake failed: %v", err)
+	}
+	return initiator, responder, initiatorConn, responderConn
+}
+
+// TestHandshake ensures both sides of a handshake derive the same session ID
+// and can exchange messages in both directions, including messages without a
+// short message type ID.
+func TestHandshake(t *testing.T) {
+	initiator, responder, initiatorConn, responderConn := handshakePair(t)
+	defer initiatorConn.Close()
+	defer responderConn.Close()
+
+	if initiator.SessionID() != responder.SessionID() {
+		t.Fatalf("session IDs %x and %x differ", initiator.SessionID(),
+			responder.SessionID())
+	}
+
+	hash := chainhash.Hash{0x01}
+	msgs := []wire.Message{
+		wire.NewMsgPing(42),
+		wire.NewMsgVerAck(),
+		wire.NewMsgSendHeaders(),
+		wire.NewMsgGetData(),
+		&wire.MsgInv{InvList: []*wire.InvVect{
+			wire.NewInvVect(wire.InvTypeTx, &hash),
+		}},
+	}
+	for _, pair := range [][2]*Transport{
+		{initiator, responder}, {responder, initiator},
+	} {
+		sender, receiver := pair[0], pair[1]
+		for _, msg := range msgs {
+			errChan := make(chan error, 1)
+			go func(msg wire.Message) {
+				_, err := sender.WriteMessage(msg,
+					wire.ProtocolVersion, wire.BaseEncoding)
+				errChan <- err
+			}(msg)
+			_, got, _, err := receiver.ReadMessage(
+				wire.ProtocolVersion, wire.BaseEncoding)
+			if err != nil {
+				t.Fatalf("unable to read %s: %v", msg.Command(),
+					err)
+			}
+			if err := <-errChan; err != nil {
+				t.Fatalf("unable to write %s: %v", msg.Command(),
+					err)
+			}
+			if !reflect.DeepEqual(got, msg) {
+				t.Fatalf("read %v, want %v", got, msg)
+			}
+		}
+	}
+}
+
+// TestV1Detection ensures the responding side detects an initiating side which
+// uses the v1 transport and returns the bytes it read.
+func TestV1Detection(t *testing.T) {
+	initiatorConn, responderConn := net.Pipe()
+	defer initiatorConn.Close()
+	defer responderConn.Close()
+
+	var buf bytes.Buffer
+	version := wire.NewMsgVersion(&wire.NetAddress{}, &wire.NetAddress{},
+		1, 0)
+	_, err := wire.WriteMessageN(&buf, version, wire.ProtocolVersion,
+		wire.SimNet)
+	if err != nil {
+		t.Fatalf("unable to encode version: %v", err)
+	}
+	go initiatorConn.Write(buf.Bytes())
+
+	responder := NewTransport(responderConn, wire.SimNet, false)
+	if err := responder.Handshake(); err != ErrV1Transport {
+		t.Fatalf("handshake returned %v, want %v", err, ErrV1Transport)
+	}
+
+	// The prefix followed by the rest of the stream is the v1 message.
+	r := io.MultiReader(bytes.NewReader(responder.ReceivedPrefix()),
+		responderConn)
+	_, got, _, err := wire.ReadMessageN(r, wire.ProtocolVersion,
+		wire.SimNet)
+	if err != nil {
+		t.Fatalf("unable to read v1 message: %v", err)
+	}
+	if got.Command() != wire.CmdVersion {
+		t.Fatalf("read %s, want %s", got.Command(), wire.CmdVersion)
+	}
+}
+
+// TestTamperedPacket ensures a packet which was modified in transit is
+// rejected.
+func TestTamperedPacket(t *testing.T) {
+	initiator, responder, initiatorConn, responderConn := handshakePair(t)
+	defer initiatorConn.Close()
+	defer responderConn.Close()
+
+	// Write the encrypted packet to a buffer, flip a bit of its contents and
+	// hand it to the responder.
+	var buf bytes.Buffer
+	initiator.conn = &buf
+	if _, err := initiator.WriteMessage(wire.NewMsgPing(1),
+		wire.ProtocolVersion, wire.BaseEncoding); err != nil {
+		t.Fatalf("unable to write message: %v", err)
+	}
+	packet := buf.Bytes()
+	packet[len(packet)-tagLen-1] ^= 0x01
+	responder.r.Reset(bytes.NewReader(packet))
+	_, _, _, err := responder.ReadMessage(wire.ProtocolVersion,
+		wire.BaseEncoding)
+	if err != ErrPacketAuthentication {
+		t.Fatalf("read returned %v, want %v", err,
+			ErrPacketAuthentication)
+	}
+}
+
+// TestMessageType ensures the message types of packets are encoded and decoded
+// correctly.
+func TestMessageType(t *testing.T) {
+	for command, id := range shortIDs {
+		encoded := encodeMessageType(command)
+		if !bytes.Equal(encoded, []byte{id}) {
+			t.Fatalf("%s encoded as %x, want %x", command, encoded, id)
+		}
+		got, _, err := decodeMessageType(encoded)
+		if err != nil || got != command {
+			t.Fatalf("decoded %s as %s: %v", command, got, err)
+		}
+	}
+
+	encoded := encodeMessageType(wire.CmdVersion)
+	if len(encoded) != 1+wire.CommandSize || encoded[0] != 0 {
+		t.Fatalf("unexpected encoding %x", encoded)
+	}
+	got, payload, err := decodeMessageType(append(encoded, 0x05))
+	if err != nil || got != wire.CmdVersion || !bytes.Equal(payload,
+		[]byte{0x05}) {
+		t.Fatalf("decoded %s with payload %x: %v", got, payload, err)
+	}
+
+	invalid := [][]byte{
+		nil,
+		{0xff},
+		{0x00, 'a'},
+		append([]byte{0x00, 'a', 0x00, 'b'}, make([]byte, 9)...),
+	}
+	for _, contents := range invalid {
+		if _, _, err := decodeMessageType(contents); err == nil {
+			t.Fatalf("decoded invalid message type %x", contents)
+		}
+	}
+}
+
+// cipherPair returns the transports of both sides with ciphers derived from
+// fixed private keys, without performing a handshake.
+func cipherPair(t *testing.T) (*Transport, *Transport) {
+	t.Helper()
+
+	initiatorPriv, _ := btcec.PrivKeyFromBytes(btcec.S256(),
+		bytes.Repeat([]byte{0x01}, 32))
+	responderPriv, _ := btcec.PrivKeyFromBytes(btcec.S256(),
+		bytes.Repeat([]byte{0x02}, 32))
+	initiatorKey, err := btcec.EllswiftEncode(initiatorPriv.PubKey())
+	if err != nil {
+		t.Fatalf("unable to encode initiator key: %v", err)
+	}
+	responderKey, err := btcec.EllswiftEncode(responderPriv.PubKey())
+	if err != nil {
+		t.Fatalf("unable to encode responder key: %v", err)
+	}
+
+	initiator := NewTransport(nil, wire.MainNet, true)
+	responder := NewTransport(nil, wire.MainNet, false)
+	initiator.initCiphers(initiatorPriv, initiatorKey, responderKey)
+	responder.initCiphers(responderPriv, responderKey, initiatorKey)
+	return initiator, responder
+}
+
+// TestPacketEncoding ensures packets encrypted by one side decode on the other
+// side at various positions in the cipher streams, including positions after
+// rekeys, and that decoy packets are skipped by the receiver.
+func TestPacketEncoding(t *testing.T) {
+	tests := []struct {
+		name     string
+		inIdx    int
+		contents []byte
+		aad      []byte
+		ignore   bool
+	}{
+		{
+			name:     "first packet",
+			inIdx:    0,
+			contents: []byte{},
+		},
+		{
+			name:     "first packet with garbage",
+			inIdx:    0,
+			contents: []byte{0x8e},
+			aad:      bytes.Repeat([]byte{0x3f}, MaxGarbageLen),
+		},
+		{
+			name:     "before rekey",
+			inIdx:    rekeyInterval - 1,
+			contents: bytes.Repeat([]byte{0xa4}, 300),
+		},
+		{
+			name:     "after rekey",
+			inIdx:    rekeyInterval,
+			contents: []byte("ping"),
+		},
+		{
+			name:     "after several rekeys",
+			inIdx:    3*rekeyInterval + 7,
+			contents: bytes.Repeat([]byte{0x5a}, 1<<16),
+		},
+		{
+			name:     "decoy",
+			inIdx:    1,
+			contents: []byte{0x01, 0x02},
+			ignore:   true,
+		},
+	}
+
+	for _, test := range tests {
+		initiator, responder := cipherPair(t)
+		for i := 0; i < test.inIdx; i++ {
+			packet := initiator.encryptPacket(nil, nil, false)
+			responder.r = bufio.NewReader(bytes.NewReader(packet))
+			if _, _, err := responder.readPacket(); err != nil {
+				t.Fatalf("%s: unable to read packet %d: %v",
+					test.name, i, err)
+			}
+		}
+
+		packet := initiator.encryptPacket(test.contents, test.aad,
+			test.ignore)
+		wantLen := lengthFieldLen + headerLen + len(test.contents) +
+			tagLen
+		if len(packet) != wantLen {
+			t.Errorf("%s: packet length %d, want %d", test.name,
+				len(packet), wantLen)
+			continue
+		}
+
+		responder.r = bufio.NewReader(bytes.NewReader(packet))
+		responder.recvAAD = test.aad
+		contents, n, err := responder.readPacket()
+		if test.ignore {
+			if err != io.EOF || n != len(packet) {
+				t.Errorf("%s: decoy packet was not skipped: "+
+					"read %d bytes, err %v", test.name, n, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: unable to read packet: %v", test.name, err)
+			continue
+		}
+		if n != len(packet) {
+			t.Errorf("%s: read %d bytes, want %d", test.name, n,
+				len(packet))
+		}
+		if !bytes.Equal(contents, test.contents) {
+			t.Errorf("%s: decoded contents differ", test.name)
+		}
+	}
+}
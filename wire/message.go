@@ -442,3 +442,95 @@ func ReadMessage(r io.Reader, pver uint32, btcnet BitcoinNet) (Message, []byte,
 	_, msg, buf, err := ReadMessageN(r, pver, btcnet)
 	return msg, buf, err
 }
+
+// EncodeMessagePayload returns the command and the encoded payload of the
+// passed message for the provided protocol version and message encoding.  It
+// enforces the same limits as WriteMessageWithEncodingN and is intended for
+// transports which frame messages without the message header, such as the
+// encrypted v2 transport (BIP0324).
+func EncodeMessagePayload(msg Message, pver uint32,
+	encoding MessageEncoding) (string, []byte, error) {
+
+	// Enforce max command size.
+	cmd := msg.Command()
+	if len(cmd) > CommandSize {
+		str := fmt.Sprintf("command [%s] is too long [max %v]",
+			cmd, CommandSize)
+		return "", nil, messageError("EncodeMessagePayload", str)
+	}
+
+	// Encode the message payload.
+	var bw bytes.Buffer
+	err := msg.BtcEncode(&bw, pver, encoding)
+	if err != nil {
+		return "", nil, err
+	}
+	payload := bw.Bytes()
+	lenp := len(payload)
+
+	// Enforce maximum overall message payload.
+	if lenp > MaxMessagePayload {
+		str := fmt.Sprintf("message payload is too large - encoded "+
+			"%d bytes, but maximum message payload is %d bytes",
+			lenp, MaxMessagePayload)
+		return "", nil, messageError("EncodeMessagePayload", str)
+	}
+
+	// Enforce maximum message payload based on the message type.
+	mpl := msg.MaxPayloadLength(pver)
+	if uint32(lenp) > mpl {
+		str := fmt.Sprintf("message payload is too large - encoded "+
+			"%d bytes, but maximum message payload size for "+
+			"messages of type [%s] is %d.", lenp, cmd, mpl)
+		return "", nil, messageError("EncodeMessagePayload", str)
+	}
+
+	return cmd, payload, nil
+}
+
+// DecodeMessagePayload validates and parses the passed payload of a message
+// with the passed command for the provided protocol version and message
+// encoding.  It enforces the same limits as ReadMessageWithEncodingN and is
+// intended for transports which frame messages without the message header,
+// such as the encrypted v2 transport (BIP0324).
+func DecodeMessagePayload(command string, payload []byte, pver uint32,
+	enc MessageEncoding) (Message, error) {
+
+	// Enforce maximum message payload.
+	if len(payload) > MaxMessagePayload {
+		str := fmt.Sprintf("message payload is too large - %d bytes, "+
+			"but max message payload is %d bytes.", len(payload),
+			MaxMessagePayload)
+		return nil, messageError("DecodeMessagePayload", str)
+	}
+
+	// Check for malformed commands.
+	if !utf8.ValidString(command) {
+		str := fmt.Sprintf("invalid command %v", []byte(command))
+		return nil, messageError("DecodeMessagePayload", str)
+	}
+
+	// Create struct of appropriate message type based on the command.
+	msg, err := makeEmptyMessage(command)
+	if err != nil {
+		return nil, messageError("DecodeMessagePayload", err.Error())
+	}
+
+	// Check for maximum length based on the message type.
+	mpl := msg.MaxPayloadLength(pver)
+	if uint32(len(payload)) > mpl {
+		str := fmt.Sprintf("payload exceeds max length - %v bytes, "+
+			"but max payload size for messages of type [%v] is %v.",
+			len(payload), command, mpl)
+		return nil, messageError("DecodeMessagePayload", str)
+	}
+
+	// Unmarshal message.  NOTE: This must be a *bytes.Buffer since the
+	// MsgVersion BtcDecode function requires it.
+	err = msg.BtcDecode(bytes.NewBuffer(payload), pver, enc)
+	if err != nil {
+		return nil, err
+	}
+
+	return msg, nil
+}
@@ -457,3 +457,52 @@ func TestWriteMessageWireErrors(t *testing.T) {
 		}
 	}
 }
+
+// TestMessagePayload tests the EncodeMessagePayload and DecodeMessagePayload
+// API used by transports which frame messages without the message header.
+func TestMessagePayload(t *testing.T) {
+	pver := ProtocolVersion
+	tests := []Message{
+		NewMsgVerAck(),
+		NewMsgPing(123123),
+		NewMsgGetHeaders(),
+		&blockOne,
+		NewMsgReject("block", RejectDuplicate, "duplicate block"),
+	}
+	for i, msg := range tests {
+		command, payload, err := EncodeMessagePayload(msg, pver,
+			LatestEncoding)
+		if err != nil {
+			t.Errorf("EncodeMessagePayload #%d error %v", i, err)
+			continue
+		}
+		if command != msg.Command() {
+			t.Errorf("EncodeMessagePayload #%d command %s, want %s",
+				i, command, msg.Command())
+		}
+		decoded, err := DecodeMessagePayload(command, payload, pver,
+			LatestEncoding)
+		if err != nil {
+			t.Errorf("DecodeMessagePayload #%d error %v", i, err)
+			continue
+		}
+		if !reflect.DeepEqual(decoded, msg) {
+			t.Errorf("DecodeMessagePayload #%d\n got: %v want: %v", i,
+				spew.Sdump(decoded), spew.Sdump(msg))
+		}
+	}
+
+	// Unknown commands and payloads exceeding the maximum of the message
+	// type are rejected.
+	_, err := DecodeMessagePayload("bogus", nil, pver, LatestEncoding)
+	if _, ok := err.(*MessageError); !ok {
+		t.Errorf("DecodeMessagePayload unknown command: wrong error "+
+			"type %T", err)
+	}
+	_, err = DecodeMessagePayload(CmdVerAck, []byte{0x00}, pver,
+		LatestEncoding)
+	if _, ok := err.(*MessageError); !ok {
+		t.Errorf("DecodeMessagePayload oversized payload: wrong error "+
+			"type %T", err)
+	}
+}
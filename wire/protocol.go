@@ -53,6 +53,10 @@ const (
 	FeeFilterVersion uint32 = 70013
 )
 
+// NodeNetworkLimitedBlocks is the number of blocks below the tip of its best
+// chain a peer which signals SFNodeNetworkLimited is required to serve.
+const NodeNetworkLimitedBlocks = 288
+
 // ServiceFlag identifies services supported by a bitcoin peer.
 type ServiceFlag uint64
 
@@ -86,18 +90,28 @@ const (
 	// SFNode2X is a flag used to indicate a peer is running the Segwit2X
 	// software.
 	SFNode2X
+
+	// SFNodeNetworkLimited is a flag used to indicate a peer serves at least
+	// the last NodeNetworkLimitedBlocks blocks of its best chain (BIP0159).
+	SFNodeNetworkLimited ServiceFlag = 1 << 10
+
+	// SFNodeP2PV2 is a flag used to indicate a peer supports the encrypted
+	// v2 transport protocol (BIP0324).
+	SFNodeP2PV2 ServiceFlag = 1 << 11
 )
 
 // Map of service flags back to their constant names for pretty printing.
 var sfStrings = map[ServiceFlag]string{
-	SFNodeNetwork: "SFNodeNetwork",
-	SFNodeGetUTXO: "SFNodeGetUTXO",
-	SFNodeBloom:   "SFNodeBloom",
-	SFNodeWitness: "SFNodeWitness",
-	SFNodeXthin:   "SFNodeXthin",
-	SFNodeBit5:    "SFNodeBit5",
-	SFNodeCF:      "SFNodeCF",
-	SFNode2X:      "SFNode2X",
+	SFNodeNetwork:        "SFNodeNetwork",
+	SFNodeGetUTXO:        "SFNodeGetUTXO",
+	SFNodeBloom:          "SFNodeBloom",
+	SFNodeWitness:        "SFNodeWitness",
+	SFNodeXthin:          "SFNodeXthin",
+	SFNodeBit5:           "SFNodeBit5",
+	SFNodeCF:             "SFNodeCF",
+	SFNode2X:             "SFNode2X",
+	SFNodeNetworkLimited: "SFNodeNetworkLimited",
+	SFNodeP2PV2:          "SFNodeP2PV2",
 }
 
 // orderedSFStrings is an ordered list of service flags from highest to
@@ -111,6 +125,8 @@ var orderedSFStrings = []ServiceFlag{
 	SFNodeBit5,
 	SFNodeCF,
 	SFNode2X,
+	SFNodeNetworkLimited,
+	SFNodeP2PV2,
 }
 
 // String returns the ServiceFlag in human-readable form.
@@ -0,0 +1,34 @@
+// Copyright (c) 2021 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+/*
+Package zmqpub implements a publisher of block and transaction notifications
+which is compatible with the ZMQ interface of Groestlcoin Core.
+
+Publisher Overview
+
+The publisher accepts connections from ZMQ SUB and XSUB sockets speaking the
+ZeroMQ Message Transport Protocol (ZMTP) 3 with the NULL security mechanism, so
+any ZMQ library can subscribe to it without the publisher depending on one.
+
+The following topics are available, each of which can be published on its own
+endpoint or share an endpoint with other topics:
+
+  - hashblock: the hash of every block connected to the main chain
+  - rawblock:  every block connected to the main chain in serialized form
+  - hashtx:    the hash of every transaction accepted to the memory pool and of
+               every transaction in a connected or disconnected block
+  - rawtx:     the same transactions as hashtx in serialized form
+  - sequence:  the hash of every connected block (C), disconnected block (D),
+               and transaction accepted to the memory pool (A) followed by the
+               label, and for accepted transactions, the 8-byte little endian
+               memory pool sequence number
+
+Every message consists of three parts: the topic, the body, and a 4-byte little
+endian sequence number which is incremented with every message published on the
+topic, so subscribers can detect dropped messages.  Hashes are published in the
+byte order they are displayed in.  Messages for a subscriber are dropped when
+the number of messages queued for it reaches the high water mark.
+*/
+package zmqpub
@@ -0,0 +1,643 @@
+// Copyright (c) 2021 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package zmqpub
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcutil"
+)
+
+// Topics which may be published.  They match the topics published by the ZMQ
+// interface of Groestlcoin Core.
+const (
+	// TopicHashBlock publishes the hash of every block connected to the
+	// main chain.
+	TopicHashBlock = "hashblock"
+
+	// TopicHashTx publishes the hash of every transaction accepted to the
+	// memory pool and of every transaction in a block connected to or
+	// disconnected from the main chain.
+	TopicHashTx = "hashtx"
+
+	// TopicRawBlock publishes every block connected to the main chain in
+	// its serialized form.
+	TopicRawBlock = "rawblock"
+
+	// TopicRawTx publishes the same transactions as TopicHashTx in their
+	// serialized form.
+	TopicRawTx = "rawtx"
+
+	// TopicSequence publishes the hash of every block connected to or
+	// disconnected from the main chain and of every transaction accepted to
+	// the memory pool along with a label identifying the event.
+	TopicSequence = "sequence"
+)
+
+// Labels which identify the event of a message published on TopicSequence.
+const (
+	// SeqBlockConnected identifies a block connected to the main chain.
+	SeqBlockConnected = 'C'
+
+	// SeqBlockDisconnected identifies a block disconnected from the main
+	// chain.
+	SeqBlockDisconnected = 'D'
+
+	// SeqTxAccepted identifies a transaction accepted to the memory pool.
+	// The message also includes the memory pool sequence number.
+	SeqTxAccepted = 'A'
+)
+
+const (
+	// DefaultHighWaterMark is the default maximum number of messages that
+	// are queued for a subscriber before further messages are dropped.
+	DefaultHighWaterMark = 1000
+
+	// handshakeTimeout is the maximum amount of time a subscriber is given
+	// to complete the ZMTP handshake.
+	handshakeTimeout = 10 * time.Second
+)
+
+// Config houses the configuration of a publisher.
+type Config struct {
+	// Endpoints maps the name of each topic to publish to the address to
+	// accept subscribers for the topic on.  The address may be prefixed
+	// with tcp:// and use * as the host to listen on all interfaces as
+	// done with ZMQ endpoints.  Topics with the same address are published
+	// on the same endpoint.
+	Endpoints map[string]string
+
+	// HighWaterMark is the maximum number of messages that are queued for
+	// a subscriber before further messages to it are dropped.  It defaults
+	// to DefaultHighWaterMark when not set.
+	HighWaterMark int
+}
+
+// endpoint houses a listener which accepts subscribers along with the
+// subscribers connected to it.
+type endpoint struct {
+	address  string
+	listener net.Listener
+
+	mtx         sync.Mutex
+	subscribers map[*subscriber]struct{}
+}
+
+// subscriber houses a connection to a ZMQ SUB or XSUB socket along with the
+// topic prefixes it is subscribed to.
+type subscriber struct {
+	conn      net.Conn
+	sendQueue chan [][]byte
+	quit      chan struct{}
+	quitOnce  sync.Once
+
+	writeMtx sync.Mutex
+	writer   *bufio.Writer
+
+	subscriptionsMtx sync.Mutex
+	subscriptions    [][]byte
+}
+
+// matches returns whether the subscriber is subscribed to a prefix of the
+// passed topic.
+func (s *subscriber) matches(topic string) bool {
+	s.subscriptionsMtx.Lock()
+	defer s.subscriptionsMtx.Unlock()
+
+	for _, prefix := range s.subscriptions {
+		if strings.HasPrefix(topic, string(prefix)) {
+			return true
+		}
+	}
+	return false
+}
+
+// subscribe adds the passed topic prefix to the subscriptions.
+func (s *subscriber) subscribe(prefix []byte) {
+	s.subscriptionsMtx.Lock()
+	s.subscriptions = append(s.subscriptions, prefix)
+	s.subscriptionsMtx.Unlock()
+}
+
+// cancel removes one subscription to the passed topic prefix.  As with ZMQ,
+// subscribing to a prefix multiple times requires cancelling it the same
+// number of times.
+func (s *subscriber) cancel(prefix []byte) {
+	s.subscriptionsMtx.Lock()
+	defer s.subscriptionsMtx.Unlock()
+
+	for i, subscription := range s.subscriptions {
+		if bytes.Equal(subscription, prefix) {
+			s.subscriptions = append(s.subscriptions[:i],
+				s.subscriptions[i+1:]...)
+			return
+		}
+	}
+}
+
+// write writes the passed frames to the subscriber.  When command is set, the
+// frames are written as command frames, otherwise they are written as a single
+// multipart message.
+func (s *subscriber) write(command bool, parts [][]byte) error {
+	s.writeMtx.Lock()
+	defer s.writeMtx.Unlock()
+
+	var err error
+	if command {
+		for _, part := range parts {
+			if err = writeFrame(s.writer, flagCommand, part); err != nil {
+				return err
+			}
+		}
+	} else {
+		err = writeMessage(s.writer, parts)
+	}
+	if err != nil {
+		return err
+	}
+	return s.writer.Flush()
+}
+
+// disconnect closes the connection to the subscriber.  It is safe to call it
+// multiple times.
+func (s *subscriber) disconnect() {
+	s.quitOnce.Do(func() {
+		close(s.quit)
+		s.conn.Close()
+	})
+}
+
+// Publisher publishes notifications about blocks and transactions to ZMQ
+// subscribers using the topics and message framing of Groestlcoin Core.  Every
+// message consists of three parts: the topic, the body, and a 4-byte little
+// endian sequence number that is incremented with every message published on
+// the topic.
+type Publisher struct {
+	started  int32
+	shutdown int32
+
+	highWaterMark  int
+	endpoints      []*endpoint
+	topicEndpoints map[string]*endpoint
+
+	// mtx protects the sequence numbers and ensures the messages of a
+	// notification are queued for the subscribers without the messages of
+	// concurrent notifications interleaving with them.
+	mtx             sync.Mutex
+	sequences       map[string]uint32
+	mempoolSequence uint64
+
+	wg   sync.WaitGroup
+	quit chan struct{}
+}
+
+// parseAddress converts the passed ZMQ style endpoint address to an address
+// which can be passed to net.Listen.
+func parseAddress(addr string) (string, error) {
+	if i := strings.Index(addr, "://"); i != -1 {
+		if addr[:i] != "tcp" {
+			return "", fmt.Errorf("unsupported transport %q in "+
+				"address %q", addr[:i], addr)
+		}
+		addr = addr[i+3:]
+	}
+
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return "", err
+	}
+	if host == "*" {
+		host = ""
+	}
+	return net.JoinHostPort(host, port), nil
+}
+
+// New returns a new publisher which accepts subscribers on the endpoints in
+// the passed config.  The listeners for the endpoints are created immediately
+// so any errors binding to the addresses are reported to the caller, however
+// subscribers are not accepted until Start is called.
+func New(cfg *Config) (*Publisher, error) {
+	p := Publisher{
+		highWaterMark:  cfg.HighWaterMark,
+		topicEndpoints: make(map[string]*endpoint),
+		sequences:      make(map[string]uint32),
+		quit:           make(chan struct{}),
+	}
+	if p.highWaterMark <= 0 {
+		p.highWaterMark = DefaultHighWaterMark
+	}
+
+	endpoints := make(map[string]*endpoint)
+	for topic, addr := range cfg.Endpoints {
+		switch topic {
+		case TopicHashBlock, TopicHashTx, TopicRawBlock, TopicRawTx,
+			TopicSequence:
+		default:
+			p.closeListeners()
+			return nil, fmt.Errorf("unknown topic %q", topic)
+		}
+
+		listenAddr, err := parseAddress(addr)
+		if err != nil {
+			p.closeListeners()
+			return nil, fmt.Errorf("invalid address for topic %s: %v",
+				topic, err)
+		}
+
+		ep, ok := endpoints[listenAddr]
+		if !ok {
+			listener, err := net.Listen("tcp", listenAddr)
+			if err != nil {
+				p.closeListeners()
+				return nil, err
+			}
+			ep = &endpoint{
+				address:     addr,
+				listener:    listener,
+				subscribers: make(map[*subscriber]struct{}),
+			}
+			endpoints[listenAddr] = ep
+			p.endpoints = append(p.endpoints, ep)
+		}
+		p.topicEndpoints[topic] = ep
+	}
+
+	return &p, nil
+}
+
+// closeListeners closes the listeners of all endpoints.
+func (p *Publisher) closeListeners() {
+	for _, ep := range p.endpoints {
+		ep.listener.Close()
+	}
+}
+
+// Start begins accepting subscribers on all endpoints.
+func (p *Publisher) Start() {
+	// Already started?
+	if atomic.AddInt32(&p.started, 1) != 1 {
+		return
+	}
+
+	for _, ep := range p.endpoints {
+		log.Infof("Publishing ZMQ notifications on %v",
+			ep.listener.Addr())
+		p.wg.Add(1)
+		go p.listenHandler(ep)
+	}
+}
+
+// Stop stops accepting subscribers, disconnects all connected subscribers, and
+// waits for all goroutines to finish.
+func (p *Publisher) Stop() {
+	if atomic.AddInt32(&p.shutdown, 1) != 1 {
+		log.Infof("ZMQ publisher is already in the process of " +
+			"shutting down")
+		return
+	}
+
+	close(p.quit)
+	p.closeListeners()
+	for _, ep := range p.endpoints {
+		ep.mtx.Lock()
+		for sub := range ep.subscribers {
+			sub.disconnect()
+		}
+		ep.mtx.Unlock()
+	}
+	p.wg.Wait()
+}
+
+// listenHandler accepts subscribers on the passed endpoint until the listener
+// is closed.
+//
+// This must be run as a goroutine.
+func (p *Publisher) listenHandler(ep *endpoint) {
+	defer p.wg.Done()
+
+	for {
+		conn, err := ep.listener.Accept()
+		if err != nil {
+			// Only log the error if not forcibly shutting down.
+			if atomic.LoadInt32(&p.shutdown) == 0 {
+				log.Errorf("Can't accept connection: %v", err)
+			}
+			return
+		}
+
+		p.wg.Add(1)
+		go p.subscriberHandler(ep, conn)
+	}
+}
+
+// handshake performs the ZMTP handshake with a new subscriber and ensures the
+// peer is a SUB or XSUB socket.
+func handshake(conn net.Conn, writer *bufio.Writer) error {
+	conn.SetDeadline(time.Now().Add(handshakeTimeout))
+	defer conn.SetDeadline(time.Time{})
+
+	if err := writeGreeting(writer); err != nil {
+		return err
+	}
+	props := encodeProperties([][2]string{{"Socket-Type", "PUB"}})
+	err := writeFrame(writer, flagCommand, encodeCommand(cmdReady, props))
+	if err != nil {
+		return err
+	}
+	if err := writer.Flush(); err != nil {
+		return err
+	}
+
+	if err := readGreeting(conn); err != nil {
+		return err
+	}
+	f, err := readFrame(conn)
+	if err != nil {
+		return err
+	}
+	name, data, err := decodeCommand(f.body)
+	if err != nil {
+		return err
+	}
+	if !f.command || name != cmdReady {
+		return fmt.Errorf("expected %s command", cmdReady)
+	}
+	peerProps, err := decodeProperties(data)
+	if err != nil {
+		return err
+	}
+	switch socketType := peerProps["socket-type"]; socketType {
+	case "SUB", "XSUB":
+	default:
+		reason := fmt.Sprintf("invalid socket type %s", socketType)
+		writeFrame(writer, flagCommand, encodeCommand(cmdError,
+			append([]byte{byte(len(reason))}, reason...)))
+		writer.Flush()
+		return fmt.Errorf("peer is not a subscriber (socket type %q)",
+			socketType)
+	}
+
+	return nil
+}
+
+// subscriberHandler performs the handshake with a new subscriber, registers it
+// with the passed endpoint, and then handles the subscriptions it sends until
+// it disconnects.
+//
+// This must be run as a goroutine.
+func (p *Publisher) subscriberHandler(ep *endpoint, conn net.Conn) {
+	defer p.wg.Done()
+
+	sub := &subscriber{
+		conn:      conn,
+		sendQueue: make(chan [][]byte, p.highWaterMark),
+		quit:      make(chan struct{}),
+		writer:    bufio.NewWriter(conn),
+	}
+	if err := handshake(conn, sub.writer); err != nil {
+		log.Debugf("ZMQ handshake with %v failed: %v", conn.RemoteAddr(),
+			err)
+		conn.Close()
+		return
+	}
+
+	ep.mtx.Lock()
+	if atomic.LoadInt32(&p.shutdown) != 0 {
+		ep.mtx.Unlock()
+		conn.Close()
+		return
+	}
+	ep.subscribers[sub] = struct{}{}
+	ep.mtx.Unlock()
+	log.Debugf("New ZMQ subscriber %v on %v", conn.RemoteAddr(),
+		ep.listener.Addr())
+
+	p.wg.Add(1)
+	go p.outHandler(sub)
+	p.inHandler(sub)
+
+	ep.mtx.Lock()
+	delete(ep.subscribers, sub)
+	ep.mtx.Unlock()
+	sub.disconnect()
+	log.Debugf("ZMQ subscriber %v disconnected", conn.RemoteAddr())
+}
+
+// inHandler reads the frames sent by the passed subscriber and updates its
+// subscriptions accordingly until the connection is closed.  Subscriptions are
+// accepted both as ZMTP 3.0 subscription messages and ZMTP 3.1 commands.
+func (p *Publisher) inHandler(sub *subscriber) {
+	for {
+		f, err := readFrame(sub.conn)
+		if err != nil {
+			return
+		}
+
+		if !f.command {
+			// Subscription messages consist of a single frame
+			// whose first byte is 1 to subscribe and 0 to cancel a
+			// subscription.  Any other messages are ignored.
+			if f.more || len(f.body) == 0 {
+				continue
+			}
+			switch f.body[0] {
+			case 1:
+				sub.subscribe(f.body[1:])
+			case 0:
+				sub.cancel(f.body[1:])
+			}
+			continue
+		}
+
+		name, data, err := decodeCommand(f.body)
+		if err != nil {
+			return
+		}
+		switch name {
+		case cmdSubscribe:
+			sub.subscribe(data)
+
+		case cmdCancel:
+			sub.cancel(data)
+
+		case cmdPing:
+			// The ping data consists of a 2-byte TTL followed by a
+			// context which is echoed back in the pong.
+			if len(data) < 2 {
+				return
+			}
+			pong := encodeCommand(cmdPong, data[2:])
+			if err := sub.write(true, [][]byte{pong}); err != nil {
+				return
+			}
+		}
+	}
+}
+
+// outHandler writes the messages queued for the passed subscriber until it is
+// disconnected.
+//
+// This must be run as a goroutine.
+func (p *Publisher) outHandler(sub *subscriber) {
+	defer p.wg.Done()
+
+	for {
+		select {
+		case msg := <-sub.sendQueue:
+			if err := sub.write(false, msg); err != nil {
+				sub.disconnect()
+				return
+			}
+
+		case <-sub.quit:
+			return
+		}
+	}
+}
+
+// enabled returns whether the passed topic is published.
+func (p *Publisher) enabled(topic string) bool {
+	_, ok := p.topicEndpoints[topic]
+	return ok
+}
+
+// publish queues a message with the passed topic and body for all subscribers
+// of the topic.  Messages are dropped for subscribers which have reached the
+// high water mark.
+//
+// This function MUST be called with the publisher lock held.
+func (p *Publisher) publish(topic string, body []byte) {
+	ep, ok := p.topicEndpoints[topic]
+	if !ok {
+		return
+	}
+
+	var seq [4]byte
+	binary.LittleEndian.PutUint32(seq[:], p.sequences[topic])
+	p.sequences[topic]++
+	msg := [][]byte{[]byte(topic), body, seq[:]}
+
+	ep.mtx.Lock()
+	for sub := range ep.subscribers {
+		if !sub.matches(topic) {
+			continue
+		}
+		select {
+		case sub.sendQueue <- msg:
+		default:
+			log.Debugf("Dropping %s message for ZMQ subscriber %v: "+
+				"high water mark reached", topic,
+				sub.conn.RemoteAddr())
+		}
+	}
+	ep.mtx.Unlock()
+}
+
+// reversedHash returns the passed hash in the byte order it is displayed in,
+// which is the byte order used for hashes in published messages.
+func reversedHash(hash *chainhash.Hash) []byte {
+	reversed := make([]byte, chainhash.HashSize)
+	for i, b := range hash {
+		reversed[chainhash.HashSize-1-i] = b
+	}
+	return reversed
+}
+
+// publishSequence publishes a message on the sequence topic for the passed
+// hash and label with an optional memory pool sequence number.
+//
+// This function MUST be called with the publisher lock held.
+func (p *Publisher) publishSequence(hash *chainhash.Hash, label byte,
+	mempoolSequence *uint64) {
+
+	if !p.enabled(TopicSequence) {
+		return
+	}
+
+	body := append(reversedHash(hash), label)
+	if mempoolSequence != nil {
+		var seq [8]byte
+		binary.LittleEndian.PutUint64(seq[:], *mempoolSequence)
+		body = append(body, seq[:]...)
+	}
+	p.publish(TopicSequence, body)
+}
+
+// publishTx publishes the passed transaction on the hashtx and rawtx topics.
+//
+// This function MUST be called with the publisher lock held.
+func (p *Publisher) publishTx(tx *btcutil.Tx) {
+	if p.enabled(TopicHashTx) {
+		p.publish(TopicHashTx, reversedHash(tx.Hash()))
+	}
+	if p.enabled(TopicRawTx) {
+		var buf bytes.Buffer
+		buf.Grow(tx.MsgTx().SerializeSize())
+		if err := tx.MsgTx().Serialize(&buf); err != nil {
+			log.Errorf("Failed to serialize transaction %v: %v",
+				tx.Hash(), err)
+			return
+		}
+		p.publish(TopicRawTx, buf.Bytes())
+	}
+}
+
+// NotifyBlockConnected publishes the transactions of the passed block, which
+// has been connected to the main chain, followed by the block itself.
+func (p *Publisher) NotifyBlockConnected(block *btcutil.Block) {
+	p.mtx.Lock()
+	defer p.mtx.Unlock()
+
+	for _, tx := range block.Transactions() {
+		p.publishTx(tx)
+	}
+	p.publishSequence(block.Hash(), SeqBlockConnected, nil)
+	if p.enabled(TopicHashBlock) {
+		p.publish(TopicHashBlock, reversedHash(block.Hash()))
+	}
+	if p.enabled(TopicRawBlock) {
+		serialized, err := block.Bytes()
+		if err != nil {
+			log.Errorf("Failed to serialize block %v: %v",
+				block.Hash(), err)
+			return
+		}
+		p.publish(TopicRawBlock, serialized)
+	}
+}
+
+// NotifyBlockDisconnected publishes the transactions of the passed block, which
+// has been disconnected from the main chain, followed by the disconnection of
+// the block on the sequence topic.
+func (p *Publisher) NotifyBlockDisconnected(block *btcutil.Block) {
+	p.mtx.Lock()
+	defer p.mtx.Unlock()
+
+	for _, tx := range block.Transactions() {
+		p.publishTx(tx)
+	}
+	p.publishSequence(block.Hash(), SeqBlockDisconnected, nil)
+}
+
+// NotifyTxAccepted publishes the passed transaction which has been accepted to
+// the memory pool.  The memory pool sequence number published on the sequence
+// topic is incremented with every accepted transaction.
+func (p *Publisher) NotifyTxAccepted(tx *btcutil.Tx) {
+	p.mtx.Lock()
+	defer p.mtx.Unlock()
+
+	p.mempoolSequence++
+	p.publishTx(tx)
+	p.publishSequence(tx.Hash(), SeqTxAccepted, &p.mempoolSequence)
+}
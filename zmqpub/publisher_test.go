@@ -0,0 +1,190 @@
+// Copyright (c) 2021 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package zmqpub
+
+import (
+	"bytes"
+	"encoding/binary"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/btcsuite/btcd/wire"
+	"github.com/btcsuite/btcutil"
+)
+
+// testSubscriber connects to the passed publisher endpoint as a SUB socket,
+// subscribes to the passed topic prefixes using ZMTP 3.0 subscription messages,
+// and waits until the publisher has registered the subscriptions.
+func testSubscriber(t *testing.T, ep *endpoint, prefixes ...string) net.Conn {
+	t.Helper()
+
+	// numSubscriptions returns the total number of subscriptions of all
+	// subscribers connected to the endpoint.
+	numSubscriptions := func() int {
+		ep.mtx.Lock()
+		defer ep.mtx.Unlock()
+
+		var n int
+		for sub := range ep.subscribers {
+			sub.subscriptionsMtx.Lock()
+			n += len(sub.subscriptions)
+			sub.subscriptionsMtx.Unlock()
+		}
+		return n
+	}
+	wantSubscriptions := numSubscriptions() + len(prefixes)
+
+	conn, err := net.Dial("tcp", ep.listener.Addr().String())
+	if err != nil {
+		t.Fatalf("Dial: unexpected error: %v", err)
+	}
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+	if err := writeGreeting(conn); err != nil {
+		t.Fatalf("writeGreeting: unexpected error: %v", err)
+	}
+	props := encodeProperties([][2]string{{"Socket-Type", "SUB"}})
+	err = writeFrame(conn, flagCommand, encodeCommand(cmdReady, props))
+	if err != nil {
+		t.Fatalf("writeFrame: unexpected error: %v", err)
+	}
+	if err := readGreeting(conn); err != nil {
+		t.Fatalf("readGreeting: unexpected error: %v", err)
+	}
+	f, err := readFrame(conn)
+	if err != nil {
+		t.Fatalf("readFrame: unexpected error: %v", err)
+	}
+	name, data, err := decodeCommand(f.body)
+	if err != nil || name != cmdReady {
+		t.Fatalf("unexpected handshake command %q: %v", name, err)
+	}
+	peerProps, err := decodeProperties(data)
+	if err != nil || peerProps["socket-type"] != "PUB" {
+		t.Fatalf("unexpected handshake properties %v: %v", peerProps, err)
+	}
+	for _, prefix := range prefixes {
+		err := writeFrame(conn, 0, append([]byte{1}, prefix...))
+		if err != nil {
+			t.Fatalf("writeFrame: unexpected error: %v", err)
+		}
+	}
+
+	// Wait for the publisher to register the subscriptions.
+	for i := 0; i < 500; i++ {
+		if numSubscriptions() == wantSubscriptions {
+			return conn
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatal("subscriptions were not registered")
+	return nil
+}
+
+// readTestMessage reads a multipart message from the passed connection.
+func readTestMessage(t *testing.T, conn net.Conn) [][]byte {
+	t.Helper()
+
+	var parts [][]byte
+	for {
+		f, err := readFrame(conn)
+		if err != nil {
+			t.Fatalf("readFrame: unexpected error: %v", err)
+		}
+		parts = append(parts, f.body)
+		if !f.more {
+			return parts
+		}
+	}
+}
+
+// TestPublisher ensures notifications are published to subscribers of the
+// matching topics with the expected framing and sequence numbers.
+func TestPublisher(t *testing.T) {
+	t.Parallel()
+
+	p, err := New(&Config{Endpoints: map[string]string{
+		TopicHashBlock: "tcp://127.0.0.1:0",
+		TopicHashTx:    "tcp://127.0.0.1:0",
+		TopicSequence:  "tcp://127.0.0.1:0",
+	}})
+	if err != nil {
+		t.Fatalf("New: unexpected error: %v", err)
+	}
+	p.Start()
+	defer p.Stop()
+
+	// All topics share the same address, so they are published on a single
+	// endpoint.
+	if len(p.endpoints) != 1 {
+		t.Fatalf("got %d endpoints, want 1", len(p.endpoints))
+	}
+	blockConn := testSubscriber(t, p.topicEndpoints[TopicHashBlock],
+		TopicHashBlock)
+	defer blockConn.Close()
+	seqConn := testSubscriber(t, p.topicEndpoints[TopicSequence],
+		TopicSequence)
+	defer seqConn.Close()
+
+	coinbase := wire.NewMsgTx(wire.TxVersion)
+	coinbase.AddTxIn(&wire.TxIn{PreviousOutPoint: wire.OutPoint{
+		Index: wire.MaxPrevOutIndex}})
+	block := btcutil.NewBlock(&wire.MsgBlock{
+		Transactions: []*wire.MsgTx{coinbase},
+	})
+	tx := btcutil.NewTx(wire.NewMsgTx(wire.TxVersion))
+
+	p.NotifyBlockConnected(block)
+	p.NotifyTxAccepted(tx)
+	p.NotifyBlockConnected(block)
+
+	// Ensure the hashblock subscriber receives both blocks with increasing
+	// sequence numbers and the hash in display byte order.
+	wantHash := reversedHash(block.Hash())
+	for i := uint32(0); i < 2; i++ {
+		msg := readTestMessage(t, blockConn)
+		if len(msg) != 3 || string(msg[0]) != TopicHashBlock ||
+			!bytes.Equal(msg[1], wantHash) ||
+			binary.LittleEndian.Uint32(msg[2]) != i {
+
+			t.Fatalf("unexpected hashblock message %x", msg)
+		}
+	}
+
+	// Ensure the sequence subscriber receives the block connection, the
+	// accepted transaction with the memory pool sequence, and the second
+	// block connection.
+	wantBodies := [][]byte{
+		append(reversedHash(block.Hash()), SeqBlockConnected),
+		append(append(reversedHash(tx.Hash()), SeqTxAccepted),
+			1, 0, 0, 0, 0, 0, 0, 0),
+		append(reversedHash(block.Hash()), SeqBlockConnected),
+	}
+	for i, wantBody := range wantBodies {
+		msg := readTestMessage(t, seqConn)
+		if len(msg) != 3 || string(msg[0]) != TopicSequence ||
+			!bytes.Equal(msg[1], wantBody) ||
+			binary.LittleEndian.Uint32(msg[2]) != uint32(i) {
+
+			t.Fatalf("unexpected sequence message #%d: %x", i, msg)
+		}
+	}
+}
+
+// TestNewErrors ensures invalid configurations are rejected.
+func TestNewErrors(t *testing.T) {
+	t.Parallel()
+
+	tests := []map[string]string{
+		{"unknown": "127.0.0.1:0"},
+		{TopicRawTx: "ipc:///tmp/grsd"},
+		{TopicRawTx: "127.0.0.1"},
+	}
+	for i, endpoints := range tests {
+		if _, err := New(&Config{Endpoints: endpoints}); err == nil {
+			t.Errorf("#%d: New: expected error for %v", i, endpoints)
+		}
+	}
+}
@@ -0,0 +1,229 @@
+// Copyright (c) 2021 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package zmqpub
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// This file implements the subset of the ZeroMQ Message Transport Protocol
+// (ZMTP) 3.0 with the NULL security mechanism that is required to act as a
+// PUB socket.  See https://rfc.zeromq.org/spec/23/ for the specification.
+
+const (
+	// greetingSize is the size of the greeting exchanged by both peers
+	// when a connection is established.
+	greetingSize = 64
+
+	// zmtpMajorVersion and zmtpMinorVersion are the version of the protocol
+	// announced in the greeting.  Version 3.0 makes subscribers send their
+	// subscriptions as messages, which is understood by all ZMTP 3 peers.
+	zmtpMajorVersion = 3
+	zmtpMinorVersion = 0
+
+	// maxInboundFrameSize is the maximum size of a frame accepted from a
+	// subscriber.  Subscribers only send subscriptions and commands, so
+	// there is no reason to accept large frames.
+	maxInboundFrameSize = 64 * 1024
+)
+
+// Frame flag bits as defined by the specification.
+const (
+	flagMore    = 0x01
+	flagLong    = 0x02
+	flagCommand = 0x04
+)
+
+// Command names used by this implementation.
+const (
+	cmdReady     = "READY"
+	cmdError     = "ERROR"
+	cmdSubscribe = "SUBSCRIBE"
+	cmdCancel    = "CANCEL"
+	cmdPing      = "PING"
+	cmdPong      = "PONG"
+)
+
+var (
+	// mechanismNull is the name of the NULL security mechanism padded to
+	// the size of the mechanism field of the greeting.
+	mechanismNull = [20]byte{'N', 'U', 'L', 'L'}
+
+	// errInvalidGreeting is returned when the greeting of a peer is not a
+	// valid ZMTP 3 greeting.
+	errInvalidGreeting = errors.New("invalid ZMTP greeting")
+)
+
+// frame describes a single ZMTP frame.
+type frame struct {
+	more    bool
+	command bool
+	body    []byte
+}
+
+// writeGreeting writes the greeting announcing a ZMTP 3.0 peer using the NULL
+// security mechanism to w.
+func writeGreeting(w io.Writer) error {
+	var greeting [greetingSize]byte
+	greeting[0] = 0xff
+	greeting[9] = 0x7f
+	greeting[10] = zmtpMajorVersion
+	greeting[11] = zmtpMinorVersion
+	copy(greeting[12:32], mechanismNull[:])
+	_, err := w.Write(greeting[:])
+	return err
+}
+
+// readGreeting reads the greeting of a peer from r and ensures it announces a
+// ZMTP 3 peer using the NULL security mechanism.
+func readGreeting(r io.Reader) error {
+	var greeting [greetingSize]byte
+	if _, err := io.ReadFull(r, greeting[:]); err != nil {
+		return err
+	}
+	if greeting[0] != 0xff || greeting[9] != 0x7f {
+		return errInvalidGreeting
+	}
+	if greeting[10] < zmtpMajorVersion {
+		return fmt.Errorf("unsupported ZMTP version %d.%d", greeting[10],
+			greeting[11])
+	}
+	if !bytes.Equal(greeting[12:32], mechanismNull[:]) {
+		return fmt.Errorf("unsupported ZMTP security mechanism %q",
+			bytes.TrimRight(greeting[12:32], "\x00"))
+	}
+	return nil
+}
+
+// writeFrame writes a single frame with the passed flags and body to w.
+func writeFrame(w io.Writer, flags byte, body []byte) error {
+	var header [9]byte
+	headerLen := 2
+	if len(body) > 255 {
+		flags |= flagLong
+		binary.BigEndian.PutUint64(header[1:], uint64(len(body)))
+		headerLen = 9
+	} else {
+		header[1] = byte(len(body))
+	}
+	header[0] = flags
+	if _, err := w.Write(header[:headerLen]); err != nil {
+		return err
+	}
+	_, err := w.Write(body)
+	return err
+}
+
+// writeMessage writes the passed parts as a single multipart message to w.
+func writeMessage(w io.Writer, parts [][]byte) error {
+	for i, part := range parts {
+		var flags byte
+		if i < len(parts)-1 {
+			flags = flagMore
+		}
+		if err := writeFrame(w, flags, part); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// readFrame reads a single frame from r.  Frames with a body larger than
+// maxInboundFrameSize are rejected.
+func readFrame(r io.Reader) (*frame, error) {
+	var flags [1]byte
+	if _, err := io.ReadFull(r, flags[:]); err != nil {
+		return nil, err
+	}
+
+	var size uint64
+	if flags[0]&flagLong != 0 {
+		var sizeBytes [8]byte
+		if _, err := io.ReadFull(r, sizeBytes[:]); err != nil {
+			return nil, err
+		}
+		size = binary.BigEndian.Uint64(sizeBytes[:])
+	} else {
+		var sizeByte [1]byte
+		if _, err := io.ReadFull(r, sizeByte[:]); err != nil {
+			return nil, err
+		}
+		size = uint64(sizeByte[0])
+	}
+	if size > maxInboundFrameSize {
+		return nil, fmt.Errorf("frame size %d exceeds maximum of %d", size,
+			maxInboundFrameSize)
+	}
+
+	body := make([]byte, size)
+	if _, err := io.ReadFull(r, body); err != nil {
+		return nil, err
+	}
+	return &frame{
+		more:    flags[0]&flagMore != 0,
+		command: flags[0]&flagCommand != 0,
+		body:    body,
+	}, nil
+}
+
+// encodeCommand returns the body of a command frame with the passed name and
+// data.
+func encodeCommand(name string, data []byte) []byte {
+	body := make([]byte, 0, 1+len(name)+len(data))
+	body = append(body, byte(len(name)))
+	body = append(body, name...)
+	return append(body, data...)
+}
+
+// decodeCommand splits the body of a command frame into the command name and
+// its data.
+func decodeCommand(body []byte) (string, []byte, error) {
+	if len(body) < 1 || len(body) < 1+int(body[0]) {
+		return "", nil, errors.New("malformed command frame")
+	}
+	nameLen := int(body[0])
+	return string(body[1 : 1+nameLen]), body[1+nameLen:], nil
+}
+
+// encodeProperties encodes the passed metadata properties in the format used
+// by the READY command.  The properties are encoded in the passed order.
+func encodeProperties(props [][2]string) []byte {
+	var buf bytes.Buffer
+	for _, prop := range props {
+		var valueLen [4]byte
+		binary.BigEndian.PutUint32(valueLen[:], uint32(len(prop[1])))
+		buf.WriteByte(byte(len(prop[0])))
+		buf.WriteString(prop[0])
+		buf.Write(valueLen[:])
+		buf.WriteString(prop[1])
+	}
+	return buf.Bytes()
+}
+
+// decodeProperties decodes the metadata properties of a READY command.  The
+// property names are case insensitive, so they are returned in lower case.
+func decodeProperties(data []byte) (map[string]string, error) {
+	props := make(map[string]string)
+	for len(data) > 0 {
+		nameLen := int(data[0])
+		if len(data) < 1+nameLen+4 {
+			return nil, errors.New("malformed metadata property")
+		}
+		name := string(bytes.ToLower(data[1 : 1+nameLen]))
+		data = data[1+nameLen:]
+		valueLen := binary.BigEndian.Uint32(data)
+		data = data[4:]
+		if uint64(len(data)) < uint64(valueLen) {
+			return nil, errors.New("malformed metadata property")
+		}
+		props[name] = string(data[:valueLen])
+		data = data[valueLen:]
+	}
+	return props, nil
+}
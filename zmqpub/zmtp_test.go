@@ -0,0 +1,131 @@
+// Copyright (c) 2021 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package zmqpub
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+)
+
+// TestFrames ensures frames are written and read as expected.
+func TestFrames(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name    string
+		flags   byte
+		body    []byte
+		encoded []byte
+	}{
+		{
+			name:    "short message frame",
+			flags:   flagMore,
+			body:    []byte("hashtx"),
+			encoded: append([]byte{0x01, 0x06}, "hashtx"...),
+		},
+		{
+			name:    "short command frame",
+			flags:   flagCommand,
+			body:    encodeCommand(cmdPong, nil),
+			encoded: append([]byte{0x04, 0x05, 0x04}, "PONG"...),
+		},
+		{
+			name:  "long message frame",
+			flags: 0,
+			body:  bytes.Repeat([]byte{0xaa}, 256),
+			encoded: append([]byte{0x02, 0, 0, 0, 0, 0, 0, 0x01, 0x00},
+				bytes.Repeat([]byte{0xaa}, 256)...),
+		},
+	}
+
+	for _, test := range tests {
+		var buf bytes.Buffer
+		if err := writeFrame(&buf, test.flags, test.body); err != nil {
+			t.Errorf("%s: writeFrame: unexpected error: %v", test.name,
+				err)
+			continue
+		}
+		if !bytes.Equal(buf.Bytes(), test.encoded) {
+			t.Errorf("%s: writeFrame: got %x, want %x", test.name,
+				buf.Bytes(), test.encoded)
+			continue
+		}
+
+		f, err := readFrame(&buf)
+		if err != nil {
+			t.Errorf("%s: readFrame: unexpected error: %v", test.name,
+				err)
+			continue
+		}
+		if f.more != (test.flags&flagMore != 0) ||
+			f.command != (test.flags&flagCommand != 0) ||
+			!bytes.Equal(f.body, test.body) {
+
+			t.Errorf("%s: readFrame: unexpected frame %+v", test.name, f)
+		}
+	}
+
+	// Ensure oversized frames are rejected.
+	oversized := []byte{0x02, 0, 0, 0, 0, 0, 0x01, 0, 0x01}
+	if _, err := readFrame(bytes.NewReader(oversized)); err == nil {
+		t.Error("readFrame: oversized frame accepted")
+	}
+}
+
+// TestGreeting ensures greetings are written and validated as expected.
+func TestGreeting(t *testing.T) {
+	t.Parallel()
+
+	var buf bytes.Buffer
+	if err := writeGreeting(&buf); err != nil {
+		t.Fatalf("writeGreeting: unexpected error: %v", err)
+	}
+	greeting := buf.Bytes()
+	if len(greeting) != greetingSize {
+		t.Fatalf("writeGreeting: got %d bytes, want %d", len(greeting),
+			greetingSize)
+	}
+	if err := readGreeting(bytes.NewReader(greeting)); err != nil {
+		t.Fatalf("readGreeting: unexpected error: %v", err)
+	}
+
+	// Ensure other security mechanisms are rejected.
+	curve := append([]byte(nil), greeting...)
+	copy(curve[12:], "CURVE")
+	if err := readGreeting(bytes.NewReader(curve)); err == nil {
+		t.Fatal("readGreeting: CURVE mechanism accepted")
+	}
+
+	// Ensure an invalid signature is rejected.
+	invalid := append([]byte(nil), greeting...)
+	invalid[9] = 0
+	if err := readGreeting(bytes.NewReader(invalid)); err != errInvalidGreeting {
+		t.Fatalf("readGreeting: got %v, want %v", err, errInvalidGreeting)
+	}
+}
+
+// TestProperties ensures READY command metadata properties are encoded and
+// decoded as expected.
+func TestProperties(t *testing.T) {
+	t.Parallel()
+
+	encoded := encodeProperties([][2]string{
+		{"Socket-Type", "SUB"},
+		{"Identity", ""},
+	})
+	props, err := decodeProperties(encoded)
+	if err != nil {
+		t.Fatalf("decodeProperties: unexpected error: %v", err)
+	}
+	want := map[string]string{"socket-type": "SUB", "identity": ""}
+	if !reflect.DeepEqual(props, want) {
+		t.Fatalf("decodeProperties: got %v, want %v", props, want)
+	}
+
+	if _, err := decodeProperties(encoded[:len(encoded)-1]); err == nil {
+		t.Fatal("decodeProperties: truncated properties accepted")
+	}
+}